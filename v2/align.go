@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNothingToAlign = errors.New("nothing to align")
+
+// stringColumns returns the number of columns that the given string takes up in the editor
+func (e *Editor) stringColumns(s string) int {
+	columns := 0
+	for _, r := range s {
+		columns += e.runeColumns(r)
+	}
+	return columns
+}
+
+// alignLines pads the given lines with spaces before the first occurrence of sep, so that sep starts
+// at the same column on all the lines that contain it. Lines without sep are left as they are.
+// Only spaces are added, nothing is removed. Returns false if no lines were changed.
+func (e *Editor) alignLines(lines []string, sep string) bool {
+	if sep == "" {
+		return false
+	}
+	alignColumn := -1
+	for _, line := range lines {
+		if i := strings.Index(line, sep); i >= 0 {
+			if columns := e.stringColumns(line[:i]); columns > alignColumn {
+				alignColumn = columns
+			}
+		}
+	}
+	changed := false
+	for n, line := range lines {
+		i := strings.Index(line, sep)
+		if i < 0 {
+			continue
+		}
+		if padding := alignColumn - e.stringColumns(line[:i]); padding > 0 {
+			lines[n] = line[:i] + strings.Repeat(" ", padding) + line[i:]
+			changed = true
+		}
+	}
+	return changed
+}
+
+// AlignRange aligns the lines in the given range on the first occurrence of sep on each line,
+// by padding with spaces before it. Returns false if no lines were changed.
+func (e *Editor) AlignRange(r Range, sep string, bookmark *Position) bool {
+	lines := e.RangeLines(r)
+	if !e.alignLines(lines, sep) {
+		return false
+	}
+	e.ReplaceRange(r, lines, bookmark)
+	return true
+}
+
+// AlignBlock aligns the block of lines at the current position on the given string, like "=" or "//",
+// and moves the cursor to the start of the current line
+func (e *Editor) AlignBlock(c *vt100.Canvas, status *StatusBar, bookmark *Position, sep string) error {
+	if blankLine(e.CurrentLine()) {
+		return errors.New("no text block at the current position")
+	}
+	y := e.LineIndex()
+	if !e.AlignRange(e.BlockAt(y), sep, bookmark) {
+		return errNothingToAlign
+	}
+	e.GoTo(y, c, status)
+	e.Home()
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAlignRange(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a = 1 // one\nlonger = 2 // two\n// just a comment\nb  = 3\n\nc = 4\n"))
+	if !e.AlignRange(e.BlockAt(0), "=", nil) {
+		t.Fatal("expected the block to be aligned")
+	}
+	if s := e.String(); s != "a      = 1 // one\nlonger = 2 // two\n// just a comment\nb      = 3\n\nc = 4\n" {
+		t.Errorf("expected the = signs in the first block to be aligned, got %q", s)
+	}
+	if !e.AlignRange(e.BlockAt(0), "//", nil) {
+		t.Fatal("expected the comments to be aligned")
+	}
+	if s := e.String(); s != "a      = 1 // one\nlonger = 2 // two\n           // just a comment\nb      = 3\n\nc = 4\n" {
+		t.Errorf("expected the comments to be aligned, got %q", s)
+	}
+	if e.AlignRange(e.BlockAt(0), "=", nil) {
+		t.Error("expected nothing to change when the block is already aligned")
+	}
+	if e.AlignRange(e.BlockAt(5), "=", nil) {
+		t.Error("expected nothing to change for a single line")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// autoClosePairs are the runes that are closed automatically when typed, and the runes that close them
+var autoClosePairs = map[rune]rune{
+	'(':  ')',
+	'[':  ']',
+	'{':  '}',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// autoClose is true if brackets and quotes should be closed automatically when typing.
+// It is enabled by default, and can be disabled with the auto-close setting or from the menu.
+var autoClose = true
+
+// autoCloseEnabled checks if brackets and quotes should be closed automatically, which is only done for code
+func (e *Editor) autoCloseEnabled() bool {
+	if !autoClose {
+		return false
+	}
+	switch e.mode {
+	case mode.Blank, mode.Doc, mode.Email, mode.Git, mode.Log, mode.ManPage, mode.Markdown, mode.ReStructured, mode.Text:
+		return false
+	}
+	return true
+}
+
+// isClosingRune checks if the given rune closes one of the auto-closed pairs
+func isClosingRune(r rune) bool {
+	for _, closing := range autoClosePairs {
+		if r == closing {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoClose handles a bracket or quote that is being typed. If the next rune is the same closing rune,
+// the cursor is moved past it. If it is an opening rune, the closing rune is inserted as well,
+// with the cursor between them. Returns false if the rune should be inserted as usual.
+func (e *Editor) AutoClose(c *vt100.Canvas, r rune) bool {
+	if !e.autoCloseEnabled() {
+		return false
+	}
+	next := e.Rune()
+	if isClosingRune(r) && next == r {
+		// Skip over the closing rune that is already there, but dedent a closing bracket that is alone on the line,
+		// like when it is typed on an empty line
+		if strings.TrimSpace(e.CurrentLine()) == string(r) {
+			if whitespace, ok := e.ClosingBracketIndentation(r); ok {
+				e.setLeadingWhitespace(c, whitespace)
+			}
+		}
+		e.Next(c)
+		return true
+	}
+	closing, ok := autoClosePairs[r]
+	if !ok || unicode.IsLetter(next) || unicode.IsDigit(next) {
+		return false
+	}
+	if r == closing {
+		// A quote only starts a string if the quotes on the line are balanced, and not after a letter, like in "don't"
+		left := e.LeftRune()
+		if e.CountRune(r, e.DataY())%2 != 0 || unicode.IsLetter(left) || unicode.IsDigit(left) {
+			return false
+		}
+		// Single quotes are used for lifetimes in Rust and for quoting in the Lisps and the MLs
+		switch e.mode {
+		case mode.Clojure, mode.Lisp, mode.OCaml, mode.Rust, mode.StandardML:
+			if r == '\'' {
+				return false
+			}
+		}
+	}
+	e.InsertRune(c, r)
+	e.WriteRune(c)
+	e.Next(c)
+	e.InsertRune(c, closing)
+	e.WriteRune(c)
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestAutoClose(t *testing.T) {
+	defer func(b bool) { autoClose = b }(autoClose)
+	autoClose = true
+	discardStdout(t)
+
+	tests := []struct {
+		m        mode.Mode
+		contents string
+		x        int
+		typed    string
+		want     string
+		wantX    int
+	}{
+		// An opening bracket is closed, and the closing bracket is skipped over
+		{mode.Go, "f", 1, "(", "f()", 2},
+		{mode.Go, "f", 1, "()", "f()", 3},
+		{mode.Go, "x := ", 5, "[]", "x := []", 7},
+		// Not before a letter
+		{mode.Go, "fx", 1, "(", "f(x", 2},
+		// Quotes are closed when the quotes on the line are balanced
+		{mode.Go, "s := ", 5, "\"", "s := \"\"", 6},
+		{mode.Go, "s := \"abc", 9, "\"", "s := \"abc\"", 10},
+		{mode.Python, "print(", 6, "'", "print(''", 7},
+		// Not after a letter, and not for lifetimes in Rust
+		{mode.Python, "# don", 5, "'", "# don'", 6},
+		{mode.Rust, "fn f<", 5, "'", "fn f<'", 6},
+		// Not for prose
+		{mode.Markdown, "See ", 4, "(", "See (", 5},
+	}
+	for _, test := range tests {
+		c := vt100.NewCanvas()
+		e := NewSimpleEditor(80)
+		e.mode = test.m
+		e.LoadBytes([]byte(test.contents))
+		e.GoToDataX(c, test.x)
+		for _, r := range test.typed {
+			if !e.AutoClose(c, r) {
+				e.InsertRune(c, r)
+				e.WriteRune(c)
+				e.Next(c)
+			}
+		}
+		x, err := e.DataX()
+		if err != nil {
+			// After the end of the line
+			x = len([]rune(e.Line(0)))
+		}
+		if e.Line(0) != test.want || x != test.wantX {
+			t.Errorf("%s: typing %q in %q: expected %q with the cursor at %d, got %q at %d", test.m, test.typed, test.contents, test.want, test.wantX, e.Line(0), x)
+		}
+	}
+
+	// Skipping over a closing bracket that is alone on the line dedents it, like typing it on an empty line
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("func f() {\n\t\t}"))
+	e.GoTo(1, c, nil)
+	e.GoToDataX(c, 2)
+	if !e.AutoClose(c, '}') || e.Line(1) != "}" {
+		t.Errorf("expected the closing bracket to be skipped over and dedented, got %q", e.Line(1))
+	}
+	if x, err := e.DataX(); err == nil && x != 1 {
+		t.Errorf("expected the cursor after the closing bracket, got %d", x)
+	}
+
+	// The feature is disabled by default, and can be turned on from the menu
+	autoClose = false
+	if e.AutoClose(c, '(') {
+		t.Error("expected auto-closing to be disabled")
+	}
+}
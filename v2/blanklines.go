@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// endOfBufferRune is drawn in the first column of the rows after the last line, like in vim
+const endOfBufferRune = '~'
+
+// TrailingBlankLines returns the number of blank lines at the end of the file.
+// A file that only contains blank lines has one line that is not counted.
+func (e *Editor) TrailingBlankLines() int {
+	count := 0
+	for i := e.Len() - 1; i > 0; i-- {
+		if strings.TrimSpace(e.Line(LineIndex(i))) != "" {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// TrimTrailingBlankLines removes the blank lines at the end of the file, and moves the cursor
+// to the last line if it was on one of them. Returns the number of lines that were removed.
+func (e *Editor) TrimTrailingBlankLines(c *vt100.Canvas, status *StatusBar) int {
+	n := e.TrailingBlankLines()
+	if n == 0 {
+		return 0
+	}
+	for i := 0; i < n; i++ {
+		e.DeleteLine(LineIndex(e.Len() - 1))
+	}
+	e.changed = true
+	e.redraw = true
+	if lastIndex := LineIndex(e.Len() - 1); e.DataY() > lastIndex {
+		e.redraw, _ = e.GoTo(lastIndex, c, status)
+		e.End(c)
+	}
+	return n
+}
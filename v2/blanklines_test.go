@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTrailingBlankLines(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected int
+	}{
+		{"", 0},
+		{"\n", 0},
+		{"a\n", 0},
+		{"a\n\n", 1},
+		{"a\n\n  \n\t\n", 3},
+		{"a\n\nb\n", 0},
+		{"\n\n\n", 2},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.LoadBytes([]byte(test.data))
+		if got := e.TrailingBlankLines(); got != test.expected {
+			t.Errorf("TrailingBlankLines() for %q = %d, expected %d", test.data, got, test.expected)
+		}
+	}
+}
+
+func TestTrimTrailingBlankLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\n\nb\n\n \n\n"))
+	e.GoTo(4, nil, nil)
+	if n := e.TrimTrailingBlankLines(nil, nil); n != 3 {
+		t.Errorf("expected 3 lines to be removed, got %d", n)
+	}
+	if got := e.String(); got != "a\n\nb\n" {
+		t.Errorf("got %q", got)
+	}
+	if e.DataY() != 2 {
+		t.Errorf("expected the cursor to be moved to the last line, got line index %d", e.DataY())
+	}
+	if !e.changed {
+		t.Error("expected the contents to be marked as changed")
+	}
+	if n := e.TrimTrailingBlankLines(nil, nil); n != 0 {
+		t.Errorf("expected nothing to be removed the second time, got %d", n)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// lineSource is a document that consists of lines, like the editor contents
+type lineSource interface {
+	Len() int
+	Line(n LineIndex) string
+}
+
+// braceLanguage checks if blocks of code are delimited by curly braces, for the given mode
+func braceLanguage(m mode.Mode) bool {
+	switch m {
+	case mode.AIDL, mode.C, mode.Cpp, mode.CS, mode.D, mode.Go, mode.Hare, mode.Haxe, mode.HIDL, mode.Jakt, mode.Java, mode.JavaScript, mode.JSON, mode.Kotlin, mode.Odin, mode.Rust, mode.Scala, mode.Shader, mode.TypeScript, mode.V, mode.Zig:
+		return true
+	}
+	return false
+}
+
+// indentationLanguage checks if blocks of code are delimited by indentation, for the given mode
+func indentationLanguage(m mode.Mode) bool {
+	switch m {
+	case mode.Bazel, mode.Config, mode.GDScript, mode.Nim, mode.Python:
+		return true
+	}
+	return false
+}
+
+// blankLine checks if the given line only consists of whitespace
+func blankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// paragraphEnd returns the index of the last line before the next blank line, or the last line of the document.
+// The line at the start index is expected to not be blank.
+func paragraphEnd(src lineSource, start LineIndex) LineIndex {
+	end := start
+	for n := start + 1; int(n) < src.Len() && !blankLine(src.Line(n)); n++ {
+		end = n
+	}
+	return end
+}
+
+// braceDelta returns how many more curly braces are opened than closed in the given line of code.
+// Braces in string literals, rune literals and comments are skipped.
+// inComment is true if the line starts within a /* */ comment, and the returned bool is true if the line
+// ends within such a comment.
+func braceDelta(line string, inComment bool) (int, bool) {
+	var (
+		runes = []rune(line)
+		delta int
+		quote rune
+	)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case inComment:
+			if r == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+				inComment = false
+				i++
+			}
+		case quote != 0:
+			if r == '\\' {
+				i++
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			return delta, false
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			inComment = true
+			i++
+		case r == '"' || r == '`':
+			quote = r
+		case r == '\'':
+			// Only skip rune literals like 'x' and '\n', since ' is also used for Rust lifetimes
+			if i+2 < len(runes) && runes[i+1] == '\\' {
+				quote = r
+			} else if i+2 < len(runes) && runes[i+2] == '\'' {
+				i += 2
+			}
+		case r == '{':
+			delta++
+		case r == '}':
+			delta--
+		}
+	}
+	return delta, inComment
+}
+
+// braceBlockEnd returns the index of the last line of the block of code that starts at the given line index.
+// The block ends at the next blank line or at the end of the document, but if a curly brace is opened
+// in the block, blank lines are skipped until the brace has been closed again.
+// The line at the start index is expected to not be blank.
+func braceBlockEnd(src lineSource, start LineIndex) LineIndex {
+	var (
+		end       = start
+		depth     int
+		delta     int
+		inComment bool
+	)
+	for n := start; int(n) < src.Len(); n++ {
+		line := src.Line(n)
+		if blankLine(line) {
+			if depth > 0 {
+				continue
+			}
+			break
+		}
+		delta, inComment = braceDelta(line, inComment)
+		depth += delta
+		end = n
+	}
+	return end
+}
+
+// indentBlockEnd returns the index of the last line of the block of code that starts at the given line index.
+// The block ends at the next blank line or at the end of the document, but blank lines are skipped as long as
+// the lines after them are indented deeper than the line at the start index.
+// The line at the start index is expected to not be blank.
+func indentBlockEnd(src lineSource, start LineIndex, ts mode.TabsSpaces) LineIndex {
+	var (
+		end         = start
+		indentWidth = func(line string) int {
+			return ts.WSLen(line[:len(line)-len(strings.TrimLeft(line, " \t"))])
+		}
+		startIndent = indentWidth(src.Line(start))
+		deeper      = true // only lines that are indented deeper than the start line so far
+		blankSeen   bool
+	)
+	for n := start + 1; int(n) < src.Len(); n++ {
+		line := src.Line(n)
+		if blankLine(line) {
+			if !deeper {
+				break
+			}
+			blankSeen = true
+			continue
+		}
+		if indentWidth(line) <= startIndent {
+			if blankSeen {
+				break
+			}
+			deeper = false
+		}
+		end = n
+	}
+	return end
+}
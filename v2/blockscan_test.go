@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// newModeEditor returns an editor in the given mode, with the given contents
+func newModeEditor(m mode.Mode, contents string) *Editor {
+	e := NewSimpleEditor(80)
+	e.mode = m
+	e.indentation = m.TabsSpaces()
+	e.LoadBytes([]byte(contents))
+	return e
+}
+
+func TestBraceDelta(t *testing.T) {
+	tests := []struct {
+		line           string
+		inComment      bool
+		delta          int
+		stillInComment bool
+	}{
+		{"func main() {", false, 1, false},
+		{"}", false, -1, false},
+		{"} else {", false, 0, false},
+		{`fmt.Println("{")`, false, 0, false},
+		{`s := "\"{"`, false, 0, false},
+		{"r := '{'", false, 0, false},
+		{`r := '\''; {`, false, 1, false},
+		{"s := `{`", false, 0, false},
+		{"x := 1 // {", false, 0, false},
+		{"/* { */ {", false, 1, false},
+		{"/* {", false, 0, true},
+		{"} */ }", true, -1, false},
+		{"impl<'a> Foo<'a> {", false, 1, false},
+	}
+	for _, test := range tests {
+		delta, inComment := braceDelta(test.line, test.inComment)
+		if delta != test.delta || inComment != test.stillInComment {
+			t.Errorf("%q: expected %d and %v, got %d and %v", test.line, test.delta, test.stillInComment, delta, inComment)
+		}
+	}
+}
+
+func TestBlockAtBraces(t *testing.T) {
+	e := newModeEditor(mode.Go, "func main() {\n\tx := 1\n\n\tfmt.Println(x)\n}\n\nfunc f() {\n}\n")
+	if r := e.BlockAt(0); r != Lines(0, 4) {
+		t.Errorf("expected the whole function, across the blank line, got %v", r)
+	}
+	if r := e.BlockAt(1); r != Lines(1, 1) {
+		t.Errorf("expected only the line before the blank line, got %v", r)
+	}
+	if r := e.BlockAt(3); r != Lines(3, 4) {
+		t.Errorf("expected the block to end at the closing brace, got %v", r)
+	}
+	if r := e.BlockAt(6); r != Lines(6, 7) {
+		t.Errorf("expected the last function, got %v", r)
+	}
+	// A brace that is never closed extends the block to the end of the document
+	e = newModeEditor(mode.C, "int main() {\n\n\treturn 0;\n\n")
+	if r := e.BlockAt(0); r != Lines(0, 2) {
+		t.Errorf("expected the block to end at the last line that is not blank, got %v", r)
+	}
+	// Braces in comments do not count
+	e = newModeEditor(mode.Go, "// {\nx := 1\n\ny := 2\n")
+	if r := e.BlockAt(0); r != Lines(0, 1) {
+		t.Errorf("expected the block to end at the blank line, got %v", r)
+	}
+}
+
+func TestBlockAtIndentation(t *testing.T) {
+	e := newModeEditor(mode.Python, "def f():\n    x = 1\n\n    return x\n\ndef g():\n    pass\n")
+	if r := e.BlockAt(0); r != Lines(0, 3) {
+		t.Errorf("expected the whole function, across the blank line, got %v", r)
+	}
+	if r := e.BlockAt(1); r != Lines(1, 1) {
+		t.Errorf("expected only the line before the blank line, got %v", r)
+	}
+	if r := e.BlockAt(5); r != Lines(5, 6) {
+		t.Errorf("expected the last function, got %v", r)
+	}
+	// Lines that are not indented deeper than the first line end the block after a blank line
+	e = newModeEditor(mode.Config, "a:\n  b: 1\nc: 2\n\n  d: 3\n")
+	if r := e.BlockAt(0); r != Lines(0, 2) {
+		t.Errorf("expected the block to end at the blank line, got %v", r)
+	}
+}
+
+func TestBlockAtProse(t *testing.T) {
+	e := newModeEditor(mode.Markdown, "a {\nb\n\nc }\n")
+	if r := e.BlockAt(0); r != Lines(0, 1) {
+		t.Errorf("expected braces to be ignored for prose, got %v", r)
+	}
+	e = newModeEditor(mode.Text, "    a\n\n        b\n")
+	if r := e.BlockAt(0); r != Lines(0, 0) {
+		t.Errorf("expected indentation to be ignored for prose, got %v", r)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+const (
+	bookmarkHistoryVersion    = 1
+	bookmarkHistoryHeader     = "o bookmarks"
+	maxBookmarkHistoryEntries = 1024
+)
+
+var (
+	bookmarkHistory            map[string]map[rune]LineNumber // per filename named bookmarks
+	bookmarkHistoryFilename    = filepath.Join(userCacheDir, "o", "bookmarks.txt")
+	errBookmarkHistoryVersion  = errors.New("unsupported bookmark history version")
+	errBookmarkHistoryNoHeader = errors.New("missing bookmark history header")
+)
+
+// Bookmarks are the named bookmarks for the current file, from "0" to "9".
+// They are set and jumped to with ctrl-b followed by a digit.
+type Bookmarks map[rune]*Position
+
+// isBookmarkName checks if the given rune can be used as the name of a bookmark
+func isBookmarkName(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// Names returns the names of the bookmarks that are set, sorted
+func (b Bookmarks) Names() []rune {
+	names := make([]rune, 0, len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// LineInserted moves the bookmarks at or below the given line index one line down,
+// for when a new line has been inserted at that index
+func (b Bookmarks) LineInserted(n LineIndex) {
+	for _, pos := range b {
+		if pos.LineIndex() >= n {
+			pos.sy++
+		}
+	}
+}
+
+// LineDeleted moves the bookmarks below the given line index one line up,
+// for when the line at that index has been deleted
+func (b Bookmarks) LineDeleted(n LineIndex) {
+	for _, pos := range b {
+		if pos.LineIndex() > n {
+			if pos.sy > 0 {
+				pos.sy--
+			} else {
+				pos.offsetY--
+			}
+		}
+	}
+}
+
+// LineNumbers returns the line number of each bookmark
+func (b Bookmarks) LineNumbers() map[rune]LineNumber {
+	lineNumbers := make(map[rune]LineNumber, len(b))
+	for name, pos := range b {
+		lineNumbers[name] = pos.LineNumber()
+	}
+	return lineNumbers
+}
+
+// bookmarkHistoryFile is where the named bookmarks are stored, one line per filename,
+// like: "/home/user/main.go" 1=12 3=140
+var bookmarkHistoryFile = keyedFile{header: bookmarkHistoryHeader, version: bookmarkHistoryVersion, errNoHeader: errBookmarkHistoryNoHeader, errVersion: errBookmarkHistoryVersion}
+
+// bookmarkHistoryEntries returns the fields that the bookmarks are stored as, per filename.
+// Files without bookmarks are left out.
+func bookmarkHistoryEntries(bookmarkHistory map[string]map[rune]LineNumber) map[string][]string {
+	entries := make(map[string][]string, len(bookmarkHistory))
+	for filename, lineNumbers := range bookmarkHistory {
+		if len(lineNumbers) == 0 {
+			continue
+		}
+		names := make([]rune, 0, len(lineNumbers))
+		for name := range lineNumbers {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+		fields := make([]string, len(names))
+		for i, name := range names {
+			fields[i] = fmt.Sprintf("%c=%d", name, lineNumbers[name])
+		}
+		entries[filename] = fields
+	}
+	return entries
+}
+
+// bookmarkHistoryFromEntries returns the bookmarks per filename, from the stored fields.
+// Bookmarks that can not be parsed are skipped.
+func bookmarkHistoryFromEntries(entries map[string][]string) map[string]map[rune]LineNumber {
+	bookmarkHistory := make(map[string]map[rune]LineNumber, len(entries))
+	for filename, fields := range entries {
+		lineNumbers := make(map[rune]LineNumber)
+		for _, field := range fields {
+			nameString, lineNumberString, ok := strings.Cut(field, "=")
+			if !ok || len(nameString) != 1 || !isBookmarkName(rune(nameString[0])) {
+				continue
+			}
+			if n, err := strconv.Atoi(lineNumberString); err == nil && n > 0 {
+				lineNumbers[rune(nameString[0])] = LineNumber(n)
+			}
+		}
+		if len(lineNumbers) > 0 {
+			bookmarkHistory[filename] = lineNumbers
+		}
+	}
+	return bookmarkHistory
+}
+
+// formatBookmarkHistory returns the given bookmarks in the keyed file format, sorted by filename
+func formatBookmarkHistory(bookmarkHistory map[string]map[rune]LineNumber) string {
+	return bookmarkHistoryFile.format(bookmarkHistoryEntries(bookmarkHistory))
+}
+
+// parseBookmarkHistory parses bookmarks in the format written by formatBookmarkHistory
+func parseBookmarkHistory(data string) (map[string]map[rune]LineNumber, error) {
+	entries, err := bookmarkHistoryFile.parse(data)
+	return bookmarkHistoryFromEntries(entries), err
+}
+
+// LoadBookmarkHistory loads the per-absolute-filename named bookmarks. The returned map can be empty.
+func LoadBookmarkHistory(bookmarkHistoryFilename string) (map[string]map[rune]LineNumber, error) {
+	entries, err := bookmarkHistoryFile.load(bookmarkHistoryFilename)
+	return bookmarkHistoryFromEntries(entries), err
+}
+
+// SaveBookmarkHistory saves the per-absolute-filename named bookmarks
+func SaveBookmarkHistory(bookmarkHistory map[string]map[rune]LineNumber, bookmarkHistoryFilename string) error {
+	return bookmarkHistoryFile.save(bookmarkHistoryFilename, bookmarkHistoryEntries(bookmarkHistory))
+}
+
+// SetBookmarks replaces the named bookmarks with bookmarks at the given line numbers.
+// Line numbers that are past the end of the file are skipped.
+func (e *Editor) SetBookmarks(lineNumbers map[rune]LineNumber) {
+	e.bookmarks = make(Bookmarks, len(lineNumbers))
+	for name, lineNumber := range lineNumbers {
+		if index := lineNumber.LineIndex(); index >= 0 && int(index) < e.Len() {
+			pos := NewPosition(e.pos.scrollSpeed)
+			pos.sy = int(index)
+			e.bookmarks[name] = pos
+		}
+	}
+}
+
+// SaveBookmarks stores the named bookmarks for the given filename. If there are no bookmarks,
+// the file is removed from the bookmark history.
+func (e *Editor) SaveBookmarks(absFilename string, bookmarkHistory map[string]map[rune]LineNumber) error {
+	if bookmarkHistory == nil {
+		return nil
+	}
+	_, found := bookmarkHistory[absFilename]
+	if len(e.bookmarks) == 0 {
+		if !found {
+			// Nothing to save or remove
+			return nil
+		}
+		delete(bookmarkHistory, absFilename)
+	} else {
+		if !found && len(bookmarkHistory) >= maxBookmarkHistoryEntries {
+			// Cull the bookmark history
+			for k := range bookmarkHistory {
+				delete(bookmarkHistory, k)
+			}
+		}
+		bookmarkHistory[absFilename] = e.bookmarks.LineNumbers()
+	}
+	return SaveBookmarkHistory(bookmarkHistory, bookmarkHistoryFilename)
+}
+
+// JumpToNamedBookmark moves the cursor to the named bookmark, if it is set
+func (e *Editor) JumpToNamedBookmark(c *vt100.Canvas, status *StatusBar, undo *Undo, name rune) {
+	pos, ok := e.bookmarks[name]
+	if !ok {
+		status.SetMessageAfterRedraw(fmt.Sprintf("No bookmark %c", name))
+		return
+	}
+	if lastIndex := LineIndex(e.Len() - 1); pos.LineIndex() > lastIndex && lastIndex >= 0 {
+		// The end of the file has been deleted
+		pos.sy, pos.offsetY = int(lastIndex), 0
+	}
+	undo.Snapshot(e)
+	e.GoToPosition(c, status, *pos)
+	status.SetMessageAfterRedraw(fmt.Sprintf("Jumped to bookmark %c at line %s", name, e.LineNumber()))
+}
+
+// ToggleNamedBookmark sets the named bookmark at the current line if it is not set, removes it if it is
+// at the current line, or else jumps to it
+func (e *Editor) ToggleNamedBookmark(c *vt100.Canvas, status *StatusBar, undo *Undo, name rune) {
+	pos, ok := e.bookmarks[name]
+	switch {
+	case !ok:
+		if e.bookmarks == nil {
+			e.bookmarks = make(Bookmarks)
+		}
+		e.bookmarks[name] = e.pos.Copy()
+		status.SetMessageAfterRedraw(fmt.Sprintf("Bookmarked line %s as %c", e.LineNumber(), name))
+	case pos.LineIndex() == e.DataY():
+		delete(e.bookmarks, name)
+		status.SetMessageAfterRedraw(fmt.Sprintf("Removed bookmark %c for line %s", name, e.LineNumber()))
+	default:
+		e.JumpToNamedBookmark(c, status, undo, name)
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBookmarksFollowInsertedAndDeletedLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	for i, line := range []string{"zero", "one", "two", "three", "four"} {
+		e.SetLine(LineIndex(i), line)
+	}
+	e.SetBookmarks(map[rune]LineNumber{'1': 2, '2': 4})
+
+	// Insert a line below the first line, above both bookmarks
+	e.pos.sy = 0
+	e.InsertLineBelow()
+	if e.Line(e.bookmarks['1'].LineIndex()) != "one" || e.Line(e.bookmarks['2'].LineIndex()) != "three" {
+		t.Fatalf("bookmarks did not follow an inserted line: %v", e.bookmarks.LineNumbers())
+	}
+
+	// Delete the line that was just inserted
+	e.DeleteLine(1)
+	if e.Line(e.bookmarks['1'].LineIndex()) != "one" || e.Line(e.bookmarks['2'].LineIndex()) != "three" {
+		t.Fatalf("bookmarks did not follow a deleted line: %v", e.bookmarks.LineNumbers())
+	}
+
+	// Insert a line above the bookmarked line "three"
+	e.pos.sy = 3
+	e.InsertLineAbove()
+	if e.Line(e.bookmarks['1'].LineIndex()) != "one" || e.Line(e.bookmarks['2'].LineIndex()) != "three" {
+		t.Fatalf("bookmarks did not follow a line inserted above: %v", e.bookmarks.LineNumbers())
+	}
+}
+
+func TestBookmarkHistoryRoundTrip(t *testing.T) {
+	bookmarkHistory := map[string]map[rune]LineNumber{
+		"/tmp/main.go":         {'1': 12, '3': 140},
+		"/tmp/with \"quotes\"": {'0': 1},
+	}
+	data := formatBookmarkHistory(bookmarkHistory)
+	parsed, err := parseBookmarkHistory(data + "\"/tmp/garbage\" x=1 4=-2 5=abc\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed["/tmp/main.go"]['3'] != 140 || parsed["/tmp/with \"quotes\""]['0'] != 1 {
+		t.Errorf("unexpected bookmark history: %v", parsed)
+	}
+	if _, err := parseBookmarkHistory("o bookmarks 2\n"); err != errBookmarkHistoryVersion {
+		t.Errorf("expected a version error, got %v", err)
+	}
+	if _, err := parseBookmarkHistory(""); err != errBookmarkHistoryNoHeader {
+		t.Errorf("expected a header error, got %v", err)
+	}
+}
+
+func TestSetBookmarksPastTheEnd(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	e.SetLine(1, "two")
+	e.SetBookmarks(map[rune]LineNumber{'1': 2, '2': 3})
+	if names := e.bookmarks.Names(); len(names) != 1 || names[0] != '1' {
+		t.Errorf("expected only bookmark 1 to be set, got %q", string(names))
+	}
+}
@@ -30,6 +30,14 @@ type BoxTheme struct {
 	TL         rune
 }
 
+// BorderStyle is the set of runes that are used for drawing the borders of a box
+type BorderStyle int
+
+const (
+	roundedBorders BorderStyle = iota // rounded corners and single lines, for panes
+	doubleBorders                     // double lines, for menus
+)
+
 // NewBox creates a new box/container
 func NewBox() *Box {
 	return &Box{0, 0, 0, 0}
@@ -55,6 +63,18 @@ func (e *Editor) NewBoxTheme() *BoxTheme {
 	}
 }
 
+// SetBorderStyle changes the runes that are used for drawing the borders
+func (bt *BoxTheme) SetBorderStyle(style BorderStyle) {
+	switch style {
+	case doubleBorders:
+		bt.TL, bt.TR, bt.BL, bt.BR = '╔', '╗', '╚', '╝'
+		bt.VL, bt.VR, bt.HT, bt.HB = '║', '║', '═', '═'
+	default:
+		bt.TL, bt.TR, bt.BL, bt.BR = '╭', '╮', '╰', '╯'
+		bt.VL, bt.VR, bt.HT, bt.HB = '│', '│', '─', '─'
+	}
+}
+
 // NewCanvasBox creates a new box/container for the entire canvas/screen
 func NewCanvasBox(c *vt100.Canvas) *Box {
 	w := int(c.W())
@@ -168,64 +188,122 @@ func (b *Box) LowerPlacement(container *Box, minWidth int) {
 	}
 }
 
+// Clip returns the part of the box that is within the given container.
+// The width and height of the returned box are 0 if nothing is within the container.
+func (b *Box) Clip(container *Box) *Box {
+	x1 := clamp(b.X, container.X, container.X+container.W)
+	y1 := clamp(b.Y, container.Y, container.Y+container.H)
+	x2 := clamp(b.X+b.W, x1, container.X+container.W)
+	y2 := clamp(b.Y+b.H, y1, container.Y+container.H)
+	return &Box{x1, y1, x2 - x1, y2 - y1}
+}
+
+// writeClipped writes text at the given coordinates, but only the runes that are within both the given box and the canvas.
+// Unlike c.Write, text that reaches the right edge is cut instead of continuing on the next line.
+func writeClipped(c *vt100.Canvas, clip *Box, x, y int, fg, bg vt100.AttributeColor, text string) {
+	clip = clip.Clip(NewCanvasBox(c))
+	if y < clip.Y || y >= clip.Y+clip.H {
+		return
+	}
+	for _, r := range text {
+		if x >= clip.X+clip.W {
+			break
+		}
+		if x >= clip.X {
+			c.WriteRune(uint(x), uint(y), fg, bg, r)
+		}
+		x++
+	}
+}
+
+// fitTitle shortens the given title with an ellipsis, if it is wider than the given width
+func fitTitle(title string, width int) string {
+	runes := []rune(title)
+	switch {
+	case len(runes) <= width:
+		return title
+	case width <= 0:
+		return ""
+	case width == 1:
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
+
 // Say will output text at the given coordinates, with the configured theme
 func (e *Editor) Say(bt *BoxTheme, c *vt100.Canvas, x, y int, text string) {
-	c.Write(uint(x), uint(y), *bt.Text, *bt.Background, text)
+	writeClipped(c, NewCanvasBox(c), x, y, *bt.Text, *bt.Background, text)
+}
+
+// ClearBox fills the part of the given box that is within the canvas with the background color,
+// so that nothing that was drawn behind the box shows through.
+func (e *Editor) ClearBox(bt *BoxTheme, c *vt100.Canvas, r *Box) {
+	clipped := r.Clip(NewCanvasBox(c))
+	if clipped.W <= 0 {
+		return
+	}
+	spaces := repeatRune(' ', uint(clipped.W))
+	for y := clipped.Y; y < clipped.Y+clipped.H; y++ {
+		c.Write(uint(clipped.X), uint(y), *bt.UpperEdge, *bt.Background, spaces)
+	}
 }
 
 // DrawBox can draw a box using "text graphics".
 // The given Box struct defines the size and placement.
-// If extrude is True, the box looks a bit more like it's sticking out.
-// bg is expected to be a background color, for instance e.BoxBackground.
+// The area behind the box is cleared first, and the parts of the box that are outside of the canvas are not drawn.
+// bt.Background is expected to be a background color, for instance e.BoxBackground.
+// Lines that are highlighted when the editor is idle are not drawn on top of the box.
 func (e *Editor) DrawBox(bt *BoxTheme, c *vt100.Canvas, r *Box) *Box {
+	// The box stays on top of the lines until they are all drawn again
+	e.overlayShown = true
 	var (
-		bg     = bt.Background
-		FG1    = bt.UpperEdge
-		FG2    = bt.LowerEdge
-		x      = uint(r.X)
-		y      = uint(r.Y)
-		width  = uint(r.W)
-		height = uint(r.H)
+		bg     = *bt.Background
+		FG1    = *bt.UpperEdge
+		FG2    = *bt.LowerEdge
+		right  = r.X + r.W - 1
+		bottom = r.Y + r.H - 1
 	)
-	c.WriteRune(x, y, *FG1, *bg, bt.TL)
-	for i := x + 1; i < x+(width-1); i++ {
-		c.WriteRune(i, y, *FG1, *bg, bt.HT)
+	e.ClearBox(bt, c, r)
+	if r.W < 2 || r.H < 2 {
+		// Too small for the borders
+		return &Box{r.X, r.Y, r.W, r.H}
 	}
-	c.WriteRune(x+width-1, y, *FG1, *bg, bt.TR)
-	for i := y + 1; i < y+height; i++ {
-		c.WriteRune(x, i, *FG1, *bg, bt.VL)
-		c.Write(x+1, i, *FG1, *bg, repeatRune(' ', width-2))
-		c.WriteRune(x+width-1, i, *FG2, *bg, bt.VR)
+	horizontalTop := repeatRune(bt.HT, uint(r.W-2))
+	horizontalBottom := repeatRune(bt.HB, uint(r.W-2))
+	writeClipped(c, r, r.X, r.Y, FG1, bg, string(bt.TL)+horizontalTop+string(bt.TR))
+	for y := r.Y + 1; y < bottom; y++ {
+		writeClipped(c, r, r.X, y, FG1, bg, string(bt.VL))
+		writeClipped(c, r, right, y, FG2, bg, string(bt.VR))
 	}
-	c.WriteRune(x, y+height-1, *FG1, *bg, bt.BL)
-	for i := x + 1; i < x+(width-1); i++ {
-		c.WriteRune(i, y+height-1, *FG2, *bg, bt.HB)
-	}
-	c.WriteRune(x+width-1, y+height-1, *FG2, *bg, bt.BR)
-	return &Box{int(x), int(y), int(width), int(height)}
+	writeClipped(c, r, r.X, bottom, FG1, bg, string(bt.BL))
+	writeClipped(c, r, r.X+1, bottom, FG2, bg, horizontalBottom+string(bt.BR))
+	return &Box{r.X, r.Y, r.W, r.H}
 }
 
 // DrawList will draw a list widget. Takes a Box struct for the size and position.
 // Takes a list of strings to be listed and an int that represents
-// which item is currently selected. Does not scroll or wrap.
+// which item is currently selected. Does not scroll or wrap, items that are too wide are cut at the right edge of the box.
 // Set selected to -1 to skip highlighting one of the items.
 func (e *Editor) DrawList(bt *BoxTheme, c *vt100.Canvas, r *Box, items []string, selected int) {
-	x := uint(r.X)
+	clip := &Box{r.X, r.Y, r.W, len(items)}
 	for i, s := range items {
-		y := uint(r.Y + i)
+		y := r.Y + i
 		if i == selected {
-			c.Write(x, y, *bt.Highlight, *bt.Background, s)
+			writeClipped(c, clip, r.X, y, *bt.Highlight, *bt.Background, s)
 		} else {
-			c.Write(x, y, *bt.Text, *bt.Background, s)
+			writeClipped(c, clip, r.X, y, *bt.Text, *bt.Background, s)
 		}
 	}
 }
 
-// DrawTitle draws a title at the top of a box, not exactly centered
+// DrawTitle draws a title at the top of a box, not exactly centered.
+// The title is shortened if it does not fit between the corners of the box.
 func (e *Editor) DrawTitle(bt *BoxTheme, c *vt100.Canvas, r *Box, title string) {
+	title = fitTitle(title, r.W-4)
+	if title == "" {
+		return
+	}
 	titleWithSpaces := " " + title + " "
-	tmp := bt.Text
-	bt.Text = bt.UpperEdge
-	e.Say(bt, c, r.X+(r.W-len(titleWithSpaces))/2, r.Y, titleWithSpaces)
-	bt.Text = tmp
+	x := r.X + (r.W-len([]rune(titleWithSpaces)))/2
+	writeClipped(c, r, x, r.Y, *bt.UpperEdge, *bt.Background, titleWithSpaces)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestBoxClip(t *testing.T) {
+	container := &Box{0, 0, 80, 25}
+	tests := []struct {
+		box, expected Box
+	}{
+		{Box{10, 5, 20, 10}, Box{10, 5, 20, 10}},
+		{Box{-3, -2, 10, 5}, Box{0, 0, 7, 3}},
+		{Box{75, 20, 10, 10}, Box{75, 20, 5, 5}},
+		{Box{90, 30, 10, 10}, Box{80, 25, 0, 0}},
+	}
+	for _, test := range tests {
+		if clipped := test.box.Clip(container); *clipped != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.box, test.expected, *clipped)
+		}
+	}
+}
+
+func TestDrawBoxClipped(t *testing.T) {
+	c := vt100.NewCanvas()
+	w, h := int(c.W()), int(c.H())
+	e := NewSimpleEditor(80)
+	bt := e.NewBoxTheme()
+
+	// A box that reaches past the right edge must not continue on the next line
+	e.DrawBox(bt, c, &Box{w - 4, 1, 10, 3})
+	if line := canvasLine(c, 1); !strings.HasSuffix(line, "╭───") {
+		t.Errorf("expected the top of the box at the right edge, got %q", line)
+	}
+	if r, _ := c.At(0, 2); r == '─' || r == '╮' || r == '│' {
+		t.Errorf("expected the box not to wrap around to the next line, got %q", r)
+	}
+
+	// A box that starts above and to the left of the canvas only draws the visible parts
+	e.DrawBox(bt, c, &Box{-2, -1, 6, 4})
+	if r, _ := c.At(3, 0); r != '│' {
+		t.Errorf("expected the right border to be visible, got %q", r)
+	}
+	if r, _ := c.At(0, 2); r != '─' {
+		t.Errorf("expected the bottom border to be visible, got %q", r)
+	}
+
+	// The area behind the box is cleared
+	c.Write(10, uint(h-3), vt100.Default, vt100.DefaultBackground, "behind")
+	e.DrawBox(bt, c, &Box{8, h - 4, 12, 3})
+	if r, _ := c.At(10, uint(h-3)); r != ' ' {
+		t.Errorf("expected the text behind the box to be cleared, got %q", r)
+	}
+}
+
+func TestDrawTitleTruncated(t *testing.T) {
+	if title := fitTitle("Changed registers", 10); title != "Changed r…" {
+		t.Errorf("expected a shortened title, got %q", title)
+	}
+	if title := fitTitle("stdout", 10); title != "stdout" {
+		t.Errorf("expected the title to be kept, got %q", title)
+	}
+	if title := fitTitle("stdout", 0); title != "" {
+		t.Errorf("expected no title, got %q", title)
+	}
+
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	bt := e.NewBoxTheme()
+	r := &Box{2, 3, 12, 4}
+	e.DrawBox(bt, c, r)
+	e.DrawTitle(bt, c, r, "A very long title")
+	if line := string([]rune(canvasLine(c, 3))[2:14]); line != "╭ A very … ╮" {
+		t.Errorf("expected the title to fit between the corners, got %q", line)
+	}
+}
+
+func TestMenuFrame(t *testing.T) {
+	choices := []string{"First", "Second choice"}
+	m := NewMenuWidget("Title", choices, vt100.Default, vt100.Default, vt100.Default, vt100.Default, vt100.Default, 80, 25, false, nil)
+	frame := m.Frame()
+	if frame.X != m.marginLeft-2 || frame.Y != m.marginTop-1 {
+		t.Errorf("expected the frame around the margins, got %v", *frame)
+	}
+	if frame.W != len("-> Second choice ")+4 || frame.H != len(choices)+4 {
+		t.Errorf("expected the frame to fit the title and the choices, got %v", *frame)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// Buffer is a file that is open in the editor, but not currently shown.
+// It has a snapshot of the editor, with the lines, the position and the mode, and its own undo history.
+type Buffer struct {
+	absFilename string
+	state       *Undo // the editor, as it was when another file was switched to
+	undo        *Undo // the undo history for this file
+}
+
+// BufferRing contains the open files that are not currently shown, with the most recently shown file first
+type BufferRing struct {
+	buffers []*Buffer
+}
+
+var (
+	// openBuffers contains the files that have been switched away from, and that can be switched back to
+	openBuffers = &BufferRing{}
+
+	errNoOtherBuffers = errors.New("no other open files")
+)
+
+// Len returns the number of buffers in the ring
+func (br *BufferRing) Len() int {
+	return len(br.buffers)
+}
+
+// Filenames returns the absolute filenames of the buffers, with the most recently shown file first
+func (br *BufferRing) Filenames() []string {
+	filenames := make([]string, len(br.buffers))
+	for i, b := range br.buffers {
+		filenames[i] = b.absFilename
+	}
+	return filenames
+}
+
+// Push stores a snapshot of the given editor, together with the given undo history,
+// as the most recently shown buffer. An older buffer for the same file is replaced.
+func (br *BufferRing) Push(e *Editor, u *Undo) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	br.Take(absFilename)
+	state := NewUndo(1, defaultUndoMemory)
+	state.Snapshot(e)
+	br.buffers = append([]*Buffer{{absFilename: absFilename, state: state, undo: u}}, br.buffers...)
+	return nil
+}
+
+// Take removes and returns the buffer for the given absolute filename, or nil if the file is not open
+func (br *BufferRing) Take(absFilename string) *Buffer {
+	for i, b := range br.buffers {
+		if b.absFilename == absFilename {
+			br.buffers = append(br.buffers[:i], br.buffers[i+1:]...)
+			return b
+		}
+	}
+	return nil
+}
+
+// Find returns the buffer for the given absolute filename, without removing it, or nil if the file is not open
+func (br *BufferRing) Find(absFilename string) *Buffer {
+	for _, b := range br.buffers {
+		if b.absFilename == absFilename {
+			return b
+		}
+	}
+	return nil
+}
+
+// Lines returns the contents of the buffer, as they were when another file was switched to
+func (b *Buffer) Lines() [][]rune {
+	b.state.mut.RLock()
+	defer b.state.mut.RUnlock()
+	return b.state.editorLineCopies[(b.state.index+b.state.size-1)%b.state.size]
+}
+
+// Contents returns the contents of the buffer as lines joined by "\n"
+func (b *Buffer) Contents() string {
+	lines := b.Lines()
+	strs := make([]string, len(lines))
+	for i, line := range lines {
+		strs[i] = string(line)
+	}
+	return strings.Join(strs, "\n")
+}
+
+// SetContents replaces the contents of the buffer, and marks it as changed,
+// so that it is saved when it is switched away from after being shown again
+func (b *Buffer) SetContents(contents string) {
+	b.state.mut.Lock()
+	defer b.state.mut.Unlock()
+	i := (b.state.index + b.state.size - 1) % b.state.size
+	var lines [][]rune
+	for _, line := range strings.Split(contents, "\n") {
+		lines = append(lines, []rune(line))
+	}
+	b.state.editorLineCopies[i] = lines
+	b.state.editorCopies[i].changed = true
+}
+
+// Newest returns the most recently shown buffer, or nil if the ring is empty
+func (br *BufferRing) Newest() *Buffer {
+	if len(br.buffers) == 0 {
+		return nil
+	}
+	return br.buffers[0]
+}
+
+// Oldest returns the buffer that was shown the longest time ago, or nil if the ring is empty.
+// Switching to the oldest buffer each time cycles through all open files.
+func (br *BufferRing) Oldest() *Buffer {
+	if len(br.buffers) == 0 {
+		return nil
+	}
+	return br.buffers[len(br.buffers)-1]
+}
+
+// openFilesMessage returns a status message with the current filename and the number of open files
+func (e *Editor) openFilesMessage() string {
+	return fmt.Sprintf("%s (%d open files)", e.filename, openBuffers.Len()+1)
+}
+
+// NextBuffer switches to the open file that was shown the longest time ago
+func (e *Editor) NextBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	b := openBuffers.Oldest()
+	if b == nil {
+		return errNoOtherBuffers
+	}
+	if err := e.Switch(c, tty, status, lk, b.absFilename, false); err != nil {
+		return err
+	}
+	status.SetMessageAfterRedraw(e.openFilesMessage())
+	return nil
+}
+
+// CloseBuffer saves and closes the current file, and switches to the most recently shown of the other open files
+func (e *Editor) CloseBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	b := openBuffers.Newest()
+	if b == nil {
+		return errNoOtherBuffers
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	// Switch saves the file first, and does not switch if it could not be saved
+	if err := e.Switch(c, tty, status, lk, b.absFilename, false); err != nil {
+		return err
+	}
+	openBuffers.Take(absFilename)
+	status.SetMessageAfterRedraw("Closed " + filepath.Base(absFilename) + ", showing " + e.openFilesMessage())
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBufferRing(t *testing.T) {
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{
+		"tmp.a.txt": "tmp.a.txt\nsecond line\n",
+		"tmp.b.txt": "tmp.b.txt\nsecond line\n",
+		"tmp.c.txt": "tmp.c.txt\nsecond line\n",
+	})
+	a, b, cFilename := filepath.Join(dir, "tmp.a.txt"), filepath.Join(dir, "tmp.b.txt"), filepath.Join(dir, "tmp.c.txt")
+
+	c, e, status := openTestEditor(t, a)
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+	lk.Lock(a)
+
+	// Make a change in the first file, with its own undo history
+	e.GoToLineNumber(2, c, status, false)
+	undo.Snapshot(e)
+	e.InsertStringAndMove(c, "changed ")
+	undoA := undo
+
+	if err := e.Switch(c, nil, status, lk, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Switch(c, nil, status, lk, cFilename, false); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != cFilename || undo == undoA {
+		t.Fatalf("expected %s to be shown with a new undo history, got %s", cFilename, e.filename)
+	}
+	if got := openBuffers.Filenames(); len(got) != 2 || got[0] != b || got[1] != a {
+		t.Errorf("expected the other files with the most recent first, got %v", got)
+	}
+	if !lk.IsLocked(cFilename) || lk.IsLocked(a) || lk.IsLocked(b) {
+		t.Error("expected only the shown file to be locked")
+	}
+	if data, _ := os.ReadFile(a); string(data) != "tmp.a.txt\nchanged second line\n" {
+		t.Errorf("expected the first file to be saved when switching away from it, got %q", data)
+	}
+
+	// Cycling goes to the file that was shown the longest time ago, as it was left
+	if err := e.NextBuffer(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != a || e.LineNumber() != 2 || e.Line(1) != "changed second line" {
+		t.Errorf("expected %s to be restored at line 2, got %s at line %d", a, e.filename, e.LineNumber())
+	}
+	if undo != undoA {
+		t.Error("expected the undo history of the first file to be restored")
+	}
+	if err := undo.Undo(e); err != nil || e.Line(1) != "second line" {
+		t.Errorf("expected the change to be undone, got %q (%v)", e.Line(1), err)
+	}
+
+	// Switching to an open file uses the buffer instead of reading the file again
+	if err := e.Switch(c, nil, status, lk, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := openBuffers.Filenames(); len(got) != 2 || got[0] != a || got[1] != cFilename {
+		t.Errorf("expected the buffer for %s to be taken from the ring, got %v", b, got)
+	}
+
+	// Read-only files and files that have been released to another instance are not saved when switching
+	for _, release := range []func(){func() { e.readOnly = true }, func() { e.lockReleased = true }} {
+		release()
+		e.InsertStringAndMove(c, "unsaved ")
+		if err := e.Switch(c, nil, status, lk, a, false); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(b); string(data) != "tmp.b.txt\nsecond line\n" {
+			t.Errorf("expected %s not to be saved, got %q", b, data)
+		}
+		if err := e.Switch(c, nil, status, lk, b, false); err != nil {
+			t.Fatal(err)
+		}
+		e.readOnly, e.lockReleased = false, false
+	}
+
+	// Closing drops the file from the ring and shows the most recent one
+	if err := e.CloseBuffer(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != a || openBuffers.Len() != 1 || openBuffers.Newest().absFilename != cFilename {
+		t.Errorf("expected %s to be shown and only %s to be left in the ring, got %s and %v", a, cFilename, e.filename, openBuffers.Filenames())
+	}
+	if lk.IsLocked(b) || !lk.IsLocked(a) {
+		t.Error("expected the closed file to be unlocked")
+	}
+	if err := e.CloseBuffer(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CloseBuffer(c, nil, status, lk); err != errNoOtherBuffers {
+		t.Errorf("expected the last file not to be closed, got %v", err)
+	}
+}
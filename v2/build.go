@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/xyproto/mode"
 	"github.com/xyproto/vt100"
@@ -64,6 +65,11 @@ func (e *Editor) GenerateBuildCommand(filename string) (*exec.Cmd, func() (bool,
 		return cmd, nothingIsFine, err
 	}
 
+	// A project build file, like ".o-build" with "make -C build", is used instead of the built-in build commands
+	if projectCmd, ok := ProjectBuildCommand(sourceFilename); ok {
+		return projectCmd, everythingIsFine, nil
+	}
+
 	// Set up a few basic variables about the given source file
 	var (
 		sourceDir      = filepath.Dir(sourceFilename)
@@ -364,6 +370,13 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 		status.ClearAll(c)
 	}
 
+	// Register the operation, so that it can be shown in the status bar
+	operationName := "building"
+	if e.mode == mode.Markdown || e.mode == mode.Doc {
+		operationName = "exporting"
+	}
+	defer operations.Start(operationName)()
+
 	// Find the absolute path to the source file
 	sourceFilename, err := filepath.Abs(filename)
 	if err != nil {
@@ -409,6 +422,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 			pdfFilename := strings.ReplaceAll(filepath.Base(sourceFilename), ".", "_") + ".pdf"
 			if background {
 				go func() {
+					defer operations.Start("exporting to PDF")()
 					pandocMutex.Lock()
 					_ = e.exportPandoc(c, tty, status, pandocPath, pdfFilename)
 					pandocMutex.Unlock()
@@ -434,7 +448,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 		return "", errNoSuitableBuildCommand
 	}
 
-	// Display a status message with no timeout, about what is currently being done
+	// Display a status message about what is currently being done, until the result is drawn
 	if status != nil {
 		var progressStatusMessage string
 		if e.mode == mode.HTML || e.mode == mode.XML {
@@ -443,7 +457,7 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 			progressStatusMessage = "Building"
 		}
 		status.SetMessage(progressStatusMessage)
-		status.ShowNoTimeout(c, e)
+		status.ShowUntilRedraw(c, e)
 	}
 
 	// Save the command in a temporary file
@@ -451,9 +465,23 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 
 	// --- Compilation ---
 
-	// Run the command and fetch the combined output from stderr and stdout.
-	// Ignore the status code / error, only look at the output.
-	output, err := cmd.CombinedOutput()
+	// Run the command and fetch the combined output from stderr and stdout, while showing the latest line of output.
+	// The command can be cancelled with esc. Ignore the status code / error, only look at the output.
+	var lastShown time.Time
+	output, err := runBuildCommand(cmd, func(line string) {
+		if line = strings.TrimSpace(line); status == nil || line == "" || time.Since(lastShown) < buildOutputInterval {
+			return
+		}
+		lastShown = time.Now()
+		status.SetMessage(line)
+		status.ShowUntilRedraw(c, e)
+	})
+	if err == errBuildCancelled {
+		if status != nil {
+			status.ClearAll(c)
+		}
+		return "", err
+	}
 
 	// Done building, clear the "Building" message
 	if status != nil {
@@ -467,6 +495,17 @@ func (e *Editor) BuildOrExport(c *vt100.Canvas, tty *vt100.TTY, status *StatusBa
 	}
 	outputString := string(bytes.TrimSpace(output))
 
+	// Keep all the errors with a location, so that they can be jumped between. A successful build clears them.
+	if err == nil {
+		e.buildErrors = nil
+	} else {
+		buildDir := cmd.Dir
+		if buildDir == "" {
+			buildDir, _ = os.Getwd()
+		}
+		e.buildErrors = NewBuildErrors(string(output), buildDir, sourceFilename)
+	}
+
 	// Check if there was a non-zero exit code together with no output
 	if exitCode != 0 && len(outputString) == 0 {
 		return "", errors.New("non-zero exit code and no error message")
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// BuildError is an error message from the compiler, at a location in a source file
+type BuildError struct {
+	absFilename string
+	line        LineNumber
+	col         ColNumber // 0 if the compiler did not give a column
+	message     string
+}
+
+// BuildErrors are the errors from the last build, and the one that was jumped to the last time
+type BuildErrors struct {
+	errors  []BuildError
+	current int // -1 before the first error has been jumped to
+}
+
+var (
+	// compilerErrorLine matches "file:line:col: message" and "file:line: message", as used by Go, C, C++ and Zig
+	compilerErrorLine = regexp.MustCompile(`^([^\s:][^:]*):(\d+):(?:(\d+):)?\s*(.*)$`)
+
+	// rustErrorLine matches the first line of an error from rustc, like "error[E0425]: cannot find value"
+	rustErrorLine = regexp.MustCompile(`^error(?:\[\w+\])?: (.*)$`)
+
+	// rustLocationLine matches the location line after an error from rustc, like "  --> src/main.rs:3:5"
+	rustLocationLine = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`)
+
+	errNoBuildErrors = errors.New("no errors from the last build")
+)
+
+// ParseBuildErrors finds all the error messages with a location in the given compiler output.
+// Warnings and notes are skipped. Relative filenames are resolved from the given directory.
+func ParseBuildErrors(output, dir string) []BuildError {
+	var (
+		buildErrors []BuildError
+		rustMessage string // the message from the last "error:" line, waiting for a "-->" line
+	)
+	add := func(filename, lineString, colString, message string) {
+		lineNumber, err := strconv.Atoi(lineString)
+		if err != nil || lineNumber < 1 {
+			return
+		}
+		colNumber, _ := strconv.Atoi(colString)
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		buildErrors = append(buildErrors, BuildError{filepath.Clean(filename), LineNumber(lineNumber), ColNumber(colNumber), message})
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if matches := rustErrorLine.FindStringSubmatch(line); matches != nil {
+			rustMessage = matches[1]
+			continue
+		}
+		if matches := rustLocationLine.FindStringSubmatch(line); matches != nil {
+			if rustMessage != "" {
+				add(matches[1], matches[2], matches[3], rustMessage)
+				rustMessage = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "warning") {
+			rustMessage = ""
+			continue
+		}
+		matches := compilerErrorLine.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		message := matches[4]
+		if strings.HasPrefix(message, "warning:") || strings.HasPrefix(message, "note:") {
+			continue
+		}
+		for _, prefix := range []string{"fatal error:", "error:"} {
+			if strings.HasPrefix(message, prefix) {
+				message = strings.TrimSpace(message[len(prefix):])
+				break
+			}
+		}
+		add(matches[1], matches[2], matches[3], message)
+	}
+	return buildErrors
+}
+
+// NewBuildErrors returns the build errors from the given compiler output, or nil if there are none.
+// If the first error is in the file that was built, it is counted as already jumped to.
+func NewBuildErrors(output, dir, absFilename string) *BuildErrors {
+	buildErrors := ParseBuildErrors(output, dir)
+	if len(buildErrors) == 0 {
+		return nil
+	}
+	current := -1
+	if buildErrors[0].absFilename == absFilename {
+		current = 0
+	}
+	return &BuildErrors{buildErrors, current}
+}
+
+// Len returns the number of build errors
+func (be *BuildErrors) Len() int {
+	if be == nil {
+		return 0
+	}
+	return len(be.errors)
+}
+
+// String returns the current build error as a status message, like "2/5 main.go: undefined: x"
+func (be *BuildErrors) String() string {
+	if be.current < 0 || be.current >= len(be.errors) {
+		return ""
+	}
+	buildError := be.errors[be.current]
+	return fmt.Sprintf("%d/%d %s: %s", be.current+1, len(be.errors), filepath.Base(buildError.absFilename), buildError.message)
+}
+
+// goToBuildError moves the given number of steps through the errors from the last build, wrapping around at the ends,
+// and jumps to the location of the error, switching to the file it is in if needed.
+// If a syntax error was found when the current file was last saved, that one is jumped to instead.
+func (e *Editor) goToBuildError(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, steps int) error {
+	if se := e.syntaxError; se != nil {
+		e.MoveToLineColumnNumber(c, status, int(se.line), int(se.col), false)
+		e.redraw = true
+		e.redrawCursor = true
+		status.SetMessageAfterRedraw(fmt.Sprintf("%s:%d: %s", filepath.Base(se.absFilename), se.line, se.message))
+		return nil
+	}
+	be := e.buildErrors
+	if be.Len() == 0 {
+		return errNoBuildErrors
+	}
+	if be.current < 0 && steps < 0 {
+		be.current = 0
+	}
+	n := be.Len()
+	be.current = ((be.current+steps)%n + n) % n
+	buildError := be.errors[be.current]
+	if err := e.Switch(c, tty, status, lk, buildError.absFilename, false); err != nil {
+		return err
+	}
+	colNumber := buildError.col
+	if colNumber < 1 {
+		colNumber = 1
+	}
+	e.MoveToLineColumnNumber(c, status, int(buildError.line), int(colNumber), false)
+	e.redraw = true
+	e.redrawCursor = true
+	status.SetMessageAfterRedraw(be.String())
+	return nil
+}
+
+// NextBuildError jumps to the next error from the last build
+func (e *Editor) NextBuildError(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	return e.goToBuildError(c, tty, status, lk, 1)
+}
+
+// PrevBuildError jumps to the previous error from the last build
+func (e *Editor) PrevBuildError(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	return e.goToBuildError(c, tty, status, lk, -1)
+}
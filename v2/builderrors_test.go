@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBuildErrors(t *testing.T) {
+	dir := "/src/project"
+	tests := []struct {
+		name   string
+		output string
+		want   []BuildError
+	}{
+		{"go", "# example.com/hello\n./main.go:8:2: undefined: asdf\n./util.go:12:10: cannot use x (variable of type int) as string value in return statement\n",
+			[]BuildError{
+				{"/src/project/main.go", 8, 2, "undefined: asdf"},
+				{"/src/project/util.go", 12, 10, "cannot use x (variable of type int) as string value in return statement"},
+			}},
+		{"gcc", "main.c: In function 'main':\nmain.c:4:5: warning: unused variable 'y' [-Wunused-variable]\nmain.c:5:12: error: 'x' undeclared (first use in this function)\nmain.c:5:12: note: each undeclared identifier is reported only once\ninclude/util.h:2:10: fatal error: missing.h: No such file or directory\n",
+			[]BuildError{
+				{"/src/project/main.c", 5, 12, "'x' undeclared (first use in this function)"},
+				{"/src/project/include/util.h", 2, 10, "missing.h: No such file or directory"},
+			}},
+		{"rust", "warning: unused variable: `y`\n --> src/main.rs:2:9\n  |\nerror[E0425]: cannot find value `x` in this scope\n --> src/main.rs:3:20\n  |\n3 |     println!(\"{}\", x);\n  |                    ^ not found in this scope\n\nerror: aborting due to previous error\n",
+			[]BuildError{
+				{"/src/project/src/main.rs", 3, 20, "cannot find value `x` in this scope"},
+			}},
+		{"zig", "/home/user/hello.zig:3:5: error: use of undeclared identifier 'x'\n    x += 1;\n    ^\n",
+			[]BuildError{
+				{"/home/user/hello.zig", 3, 5, "use of undeclared identifier 'x'"},
+			}},
+		{"no column", "main.go:7: syntax error\n", []BuildError{{"/src/project/main.go", 7, 0, "syntax error"}}},
+		{"no errors", "go: downloading example.com/hello v1.0.0\nBuilt at 12:30\n", nil},
+	}
+	for _, test := range tests {
+		got := ParseBuildErrors(test.output, dir)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: expected %d errors, got %d: %v", test.name, len(test.want), len(got), got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: expected %v, got %v", test.name, test.want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestNextBuildError(t *testing.T) {
+	withTestBuffers(t)
+	const source = "package main\n\nfunc f() {\n\treturn x\n}\n"
+	dir := writeTempFiles(t, map[string]string{"tmp.a.go": source, "tmp.b.go": source})
+	a, b := filepath.Join(dir, "tmp.a.go"), filepath.Join(dir, "tmp.b.go")
+
+	c, e, status := openTestEditor(t, a)
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+
+	if err := e.NextBuildError(c, nil, status, lk); err != errNoBuildErrors {
+		t.Errorf("expected no errors before building, got %v", err)
+	}
+
+	// The first error is in the file that was built, and has already been jumped to
+	output := "./tmp.a.go:4:9: undefined: x\n./tmp.b.go:3:1: missing return\n"
+	e.buildErrors = NewBuildErrors(output, dir, a)
+
+	if err := e.NextBuildError(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != b || e.LineNumber() != 3 {
+		t.Errorf("expected line 3 in %s, got line %d in %s", b, e.LineNumber(), e.filename)
+	}
+	if status.messageAfterRedraw != "2/2 tmp.b.go: missing return" {
+		t.Errorf("unexpected message: %q", status.messageAfterRedraw)
+	}
+
+	// The errors are kept when switching files, and going past the last one wraps around
+	if err := e.NextBuildError(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != a || e.LineNumber() != 4 {
+		t.Errorf("expected line 4 in %s, got line %d in %s", a, e.LineNumber(), e.filename)
+	}
+	if err := e.PrevBuildError(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != b || e.buildErrors.current != 1 {
+		t.Errorf("expected the second error in %s, got error %d in %s", b, e.buildErrors.current+1, e.filename)
+	}
+}
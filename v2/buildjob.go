@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// buildOutputInterval is how often the latest line of output from a running build is shown in the status bar
+const buildOutputInterval = 100 * time.Millisecond
+
+// BuildJob is a build command that is running in the background, and that can be cancelled
+type BuildJob struct {
+	cmd       *exec.Cmd
+	mut       sync.Mutex
+	cancelled bool
+}
+
+var (
+	// runningBuild is the build command that is currently running, if any
+	runningBuild    *BuildJob
+	runningBuildMut sync.Mutex
+
+	// startedBuilds counts the builds that have been started with ctrl-space,
+	// so that a build that is cancelled can tell if another build has replaced it
+	startedBuilds int32
+
+	errBuildCancelled = errors.New("build cancelled")
+)
+
+// Cancel kills the build command, together with all the processes it has started
+func (job *BuildJob) Cancel() {
+	job.mut.Lock()
+	defer job.mut.Unlock()
+	job.cancelled = true
+	if job.cmd.Process != nil {
+		// The build command is the leader of its own process group
+		syscall.Kill(-job.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Cancelled checks if the build command was cancelled
+func (job *BuildJob) Cancelled() bool {
+	job.mut.Lock()
+	defer job.mut.Unlock()
+	return job.cancelled
+}
+
+// CancelBuild cancels the build command that is currently running. Returns false if no build is running.
+func CancelBuild() bool {
+	runningBuildMut.Lock()
+	job := runningBuild
+	runningBuild = nil
+	runningBuildMut.Unlock()
+	if job == nil {
+		return false
+	}
+	job.Cancel()
+	return true
+}
+
+// runBuildCommand runs the given command in a process group of its own, so that it can be cancelled with CancelBuild.
+// Each line of the combined output from stdout and stderr is passed to the given function while the command is running.
+// A build command that is already running is cancelled first. Returns the combined output and the error from running the command.
+func runBuildCommand(cmd *exec.Cmd, onLine func(string)) ([]byte, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	job := &BuildJob{cmd: cmd}
+	runningBuildMut.Lock()
+	previous := runningBuild
+	runningBuild = job
+	runningBuildMut.Unlock()
+	if previous != nil {
+		previous.Cancel()
+	}
+	defer func() {
+		runningBuildMut.Lock()
+		if runningBuild == job {
+			runningBuild = nil
+		}
+		runningBuildMut.Unlock()
+	}()
+
+	// Start the command while holding the lock, so that it is not cancelled before the process is there to be killed
+	job.mut.Lock()
+	if job.cancelled {
+		job.mut.Unlock()
+		return nil, errBuildCancelled
+	}
+	err = cmd.Start()
+	job.mut.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		output.Write(scanner.Bytes())
+		output.WriteByte('\n')
+		if onLine != nil {
+			onLine(scanner.Text())
+		}
+	}
+	// Keep the rest of the output, if a line was too long for the scanner
+	io.Copy(&output, stdout)
+
+	err = cmd.Wait()
+	if job.Cancelled() {
+		return output.Bytes(), errBuildCancelled
+	}
+	return output.Bytes(), err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunBuildCommand(t *testing.T) {
+	var lines []string
+	output, err := runBuildCommand(exec.Command("sh", "-c", "echo compiling; echo main.c:1:1: error: oops >&2; exit 1"), func(line string) {
+		lines = append(lines, line)
+	})
+	if string(output) != "compiling\nmain.c:1:1: error: oops\n" {
+		t.Errorf("expected the combined output, got %q", output)
+	}
+	if len(lines) != 2 || lines[1] != "main.c:1:1: error: oops" {
+		t.Errorf("expected each line to be passed on while running, got %q", lines)
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("expected the exit code to be returned, got %v", err)
+	}
+	if CancelBuild() {
+		t.Error("expected no build to be running")
+	}
+}
+
+// waitForBuild waits until a build command other than the given one is running
+func waitForBuild(t *testing.T, previous *BuildJob) *BuildJob {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		runningBuildMut.Lock()
+		job := runningBuild
+		runningBuildMut.Unlock()
+		if job != nil && job != previous && !job.Cancelled() {
+			return job
+		}
+	}
+	t.Fatal("the build command was not started")
+	return nil
+}
+
+func TestCancelBuild(t *testing.T) {
+	// The sleep command is in the same process group as the shell, and is killed too
+	slowBuild := func(done chan<- error) {
+		_, err := runBuildCommand(exec.Command("sh", "-c", "echo building; sleep 30; echo done"), nil)
+		done <- err
+	}
+
+	first := make(chan error, 1)
+	go slowBuild(first)
+	job := waitForBuild(t, nil)
+
+	// Starting another build cancels the first one
+	second := make(chan error, 1)
+	go slowBuild(second)
+	waitForBuild(t, job)
+	select {
+	case err := <-first:
+		if err != errBuildCancelled {
+			t.Errorf("expected the first build to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the first build to be stopped")
+	}
+
+	if !CancelBuild() {
+		t.Error("expected the second build to be running")
+	}
+	select {
+	case err := <-second:
+		if err != errBuildCancelled {
+			t.Errorf("expected the second build to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second build to be stopped")
+	}
+}
@@ -49,24 +49,125 @@ func NewActions2(actionTitles []string, actionFunctions []func()) (*Actions, err
 	return a, nil
 }
 
-// UserSave saves the file and the location history
-func (e *Editor) UserSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+// UserSave saves the file and the location history. If the file was changed on disk since it was loaded or saved,
+// the user is asked if it should be reloaded, overwritten or compared first, unless undo is nil, like when
+// the editor is being terminated. Returns true if the file was saved.
+func (e *Editor) UserSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) bool {
+	// Another instance of the editor has taken over the file
+	if e.lockReleased {
+		status.Clear(c)
+		status.SetErrorMessage("Can not save, the file has been released to another instance of the editor")
+		status.Show(c, e)
+		return false
+	}
+
+	// The rendered man page must never replace the nroff source
+	if e.manPagePreview {
+		status.Clear(c)
+		status.SetErrorMessage("Can not save the man page preview, press ctrl-space to go back to the source")
+		status.Show(c, e)
+		return false
+	}
+
+	// Ask before saving a file in a generated or ignored directory for the first time
+	if e.generatedFile && !e.generatedFileSaved {
+		answer, ok := e.UserInput(c, tty, status, "Editing a generated/ignored file. Save anyway? (y/n)", []string{"y", "n"}, false)
+		if !ok || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			status.Clear(c)
+			status.SetMessage("Not saved")
+			status.Show(c, e)
+			return false
+		}
+		e.generatedFileSaved = true
+	}
+
+	// Ask before overwriting changes that another program has made to the file
+	if undo != nil && !e.ConfirmSaveIfChangedOnDisk(c, tty, status, undo) {
+		return false
+	}
+
+	// Run the before-save hooks, which may abort the save
+	if err := e.RunBeforeSaveHooks(); err != nil {
+		status.Clear(c)
+		status.SetError(err)
+		status.Show(c, e)
+		return false
+	}
+
+	// Format the file first, if format on save is enabled, but save it anyway if formatting fails
+	formatErr := e.FormatBeforeSave(c, tty, status, undo)
+
+	// Text files are saved with a final newline, so tell the user if one is added
+	addedFinalNewline := e.noFinalNewline && !e.binaryFile && e.savePolicy.finalNewline
+
 	// Save the file
 	if err := e.Save(c, tty); err != nil {
 		status.SetError(err)
 		status.Show(c, e)
-		return
+		return false
 	}
 
 	// Save the current location in the location history and write it to file
 	if absFilename, err := e.AbsFilename(); err == nil { // no error
-		e.SaveLocation(absFilename, locationHistory)
+		e.SaveLocation(absFilename, loadedLocationHistory())
+	}
+
+	// Check JSON files for syntax errors and YAML files for indentation with tabs, which do not stop the file from being saved
+	syntaxError := e.CheckSyntaxOnSave()
+
+	// The file was saved, but the permissions could not be kept or set
+	if e.saveWarning != nil {
+		status.Clear(c)
+		status.SetErrorMessage("Saved " + e.filename + ", but " + e.saveWarning.Error())
+		status.Show(c, e)
+		if !e.skippedSave {
+			e.RunHooksInBackground(c, status, hookAfterSave)
+		}
+		return true
+	}
+
+	// The file was saved, but it could not be formatted first
+	if formatErr != nil {
+		status.Clear(c)
+		status.SetErrorMessage("Saved " + e.filename + ", but " + formatErr.Error())
+		status.Show(c, e)
+		if !e.skippedSave {
+			e.RunHooksInBackground(c, status, hookAfterSave)
+		}
+		return true
+	}
+
+	// The file was saved, but it has a syntax error, which can be jumped to
+	if syntaxError != nil {
+		status.Clear(c)
+		status.SetErrorMessage(fmt.Sprintf("Saved %s with a syntax error at line %d (press esc e to jump to it)", e.filename, syntaxError.line))
+		status.Show(c, e)
+		if !e.skippedSave {
+			e.RunHooksInBackground(c, status, hookAfterSave)
+		}
+		return true
+	}
+
+	// The file already had the same contents, so it was not written
+	if e.skippedSave {
+		status.Clear(c)
+		status.SetMessage("No changes, " + e.filename + " was not written (press ctrl-s again to write anyway)")
+		status.Show(c, e)
+		return true
 	}
 
+	// Run the after-save hooks, without waiting for them
+	e.RunHooksInBackground(c, status, hookAfterSave)
+
 	// Status message
 	status.Clear(c)
-	status.SetMessage("Saved " + e.filename)
+	if addedFinalNewline {
+		status.SetMessage("Saved " + e.filename + " (added a final newline)")
+	} else {
+		status.SetMessage("Saved " + e.filename)
+	}
 	status.Show(c, e)
+	return true
 }
 
 // Add will add an action title and an action function
@@ -100,7 +201,12 @@ func (a *Actions) AddCommand(e *Editor, c *vt100.Canvas, tty *vt100.TTY, status
 		//panic(err)
 		return err
 	}
-	a.Add(title, f)
+	a.Add(title, func() {
+		if e.macro != nil && e.macro.Recording {
+			e.macro.RecordCommand(args...)
+		}
+		f()
+	})
 	return nil
 }
 
@@ -132,10 +238,65 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// TODO: Create a string->[]string map from title to command, then add them
 	// TODO: Add the 6 first arguments to a context struct instead
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Save and quit", "savequitclear")
+	actions.Add("Save as...", func() {
+		if newFilename, ok := e.UserInput(c, tty, status, "Save as", []string{}, false); ok {
+			e.SaveAs(c, tty, status, lk, undo, newFilename)
+		}
+	})
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Reload file", "reload")
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort strings on the current line", "sortwords")
+	if !blankLine(e.CurrentLine()) {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the block", "sort")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the block in reverse order", "sort", "reverse")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the block numerically", "sort", "numeric")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the block, ignoring case", "sort", "ignorecase")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the block and remove duplicate lines", "sort", "unique")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Align the block on...", "align")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Filter the block through a command...", "filter")
+	}
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert \""+insertFilename+"\" at the current line", "insertfile", insertFilename)
-	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current date", "insertdate") // in the RFC 3339 format
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Filter the whole file through a command...", "filterall")
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current date", "insertdate") // in the ISO 8601 format, or O_DATE_FORMAT
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current time", "inserttime")
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert the current timestamp", "inserttimestamp") // in the RFC 3339 format
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert a new UUID", "insertuuid")
+	if path := e.PathAtCursor(); path != "" && strings.ContainsAny(path, "./") {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Open "+shortenPathForDisplay(path, 40), "openatcursor")
+	}
+	if e.mode == mode.Go && which(goplsCommand[0]) != "" {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Go to definition", "definition")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Show documentation", "hover")
+	}
+	if e.syntaxError != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, fmt.Sprintf("Go to the syntax error at line %d", e.syntaxError.line), "nexterror")
+	} else if n := e.buildErrors.Len(); n > 0 {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, fmt.Sprintf("Next build error (%d errors)", n), "nexterror")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Previous build error", "preverror")
+	}
+	if openBuffers.Len() > 0 {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, fmt.Sprintf("Next open file (%d open)", openBuffers.Len()+1), "nextbuffer")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Close this file", "closebuffer")
+	}
+	if _, ok := outlineRules[e.mode]; ok {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Outline", "outline")
+	}
+	if braceLanguage(e.mode) || indentationLanguage(e.mode) {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Reindent this block", "reindent")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Reindent the whole file", "reindentall")
+	}
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Search in project...", "projectsearch")
+	if projectSearch != nil && projectSearch.Len() > 0 {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Replace in project...", "projectreplace")
+	}
+	if lastMultiReplace != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Revert the last replace in project", "revertreplace")
+	}
+	if _, ok := testFileRules[e.mode]; ok {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Toggle test file", "testfile")
+		if name, err := e.TestAtCursor(); err == nil {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Run "+name, "runtest")
+		}
+	}
 
 	// Word wrap at a custom width + enable word wrap when typing
 	actions.Add("Word wrap at...", func() {
@@ -162,6 +323,162 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		}
 	})
 
+	// Toggle the column ruler and the crosshair, for editing fixed-width data
+	if e.showRuler {
+		actions.Add("Hide column ruler", func() {
+			e.showRuler = false
+		})
+	} else {
+		actions.Add("Show column ruler", func() {
+			e.showRuler = true
+		})
+	}
+	if e.MixedIndentation() || e.markMixedIndent {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Next line with mixed indentation", "nextmixed")
+		if e.markMixedIndent {
+			actions.Add("Stop marking mixed indentation", func() {
+				e.markMixedIndent = false
+			})
+		} else {
+			actions.Add("Mark mixed indentation", func() {
+				e.markMixedIndent = true
+			})
+		}
+	}
+	if e.showCrosshair {
+		actions.Add("Hide cursor crosshair", func() {
+			e.showCrosshair = false
+		})
+	} else {
+		actions.Add("Show cursor crosshair", func() {
+			e.showCrosshair = true
+		})
+	}
+
+	if highlightCurrentLine {
+		actions.Add("Stop highlighting the current line", func() {
+			highlightCurrentLine = false
+		})
+	} else {
+		actions.Add("Highlight the current line", func() {
+			highlightCurrentLine = true
+		})
+	}
+	if e.wrapWidth > 0 {
+		if showColorColumn {
+			actions.Add(fmt.Sprintf("Hide the guide at column %d", e.wrapWidth), func() {
+				showColorColumn = false
+			})
+		} else {
+			actions.Add(fmt.Sprintf("Show a guide at column %d", e.wrapWidth), func() {
+				showColorColumn = true
+			})
+		}
+	}
+
+	// Let the terminal emulator select text with the mouse, or let o handle clicks and the scroll wheel
+	if useMouse {
+		actions.Add("Disable mouse (select text in the terminal)", func() {
+			useMouse = false
+			DisableMouse()
+		})
+	} else {
+		actions.Add("Enable mouse (click and scroll)", func() {
+			useMouse = true
+			EnableMouse()
+		})
+	}
+
+	// Jump to one of the named bookmarks, that are set with ctrl-b followed by a digit
+	for _, name := range e.bookmarks.Names() {
+		name := name
+		actions.Add(fmt.Sprintf("Jump to bookmark %c (line %s)", name, e.bookmarks[name].LineNumber()), func() {
+			e.JumpToNamedBookmark(c, status, undo, name)
+		})
+	}
+
+	// Forget the view state for this file, like the column ruler or word wrap
+	if e.ViewState() != e.DefaultViewState() {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Reset view state for this file", "resetview")
+	}
+
+	// Toggle ASCII draw mode
+	if e.drawMode {
+		actions.Add("Text edit mode (stop drawing)", func() {
+			e.ToggleDrawMode()
+		})
+	} else {
+		actions.Add("ASCII draw mode", func() {
+			e.ToggleDrawMode()
+			status.SetMessageAfterRedraw("Draw with shift-arrow. Mark rectangle corners with return.")
+		})
+	}
+
+	// Toggle overwrite mode, which can also be done with the Insert key
+	if e.overwriteMode {
+		actions.Add("Insert mode (stop overwriting)", func() {
+			e.ToggleOverwriteMode()
+		})
+	} else {
+		actions.Add("Overwrite mode", func() {
+			e.ToggleOverwriteMode()
+		})
+	}
+
+	// Convert the line endings, byte order mark or encoding that the file is saved with
+	if !e.binaryFile {
+		for _, conversion := range textFormatConversions {
+			if conversion.applies(e.textFormat) {
+				conversion := conversion
+				actions.Add(conversion.title, func() {
+					e.ConvertTextFormat(c, tty, status, conversion)
+				})
+			}
+		}
+	}
+
+	// Keep or replace non-breaking spaces and odd characters, when loading and saving
+	if !e.binaryFile {
+		if e.keepCharacters {
+			actions.Add("Replace non-breaking spaces and odd characters", func() {
+				e.ToggleKeepCharacters(c, tty, status, undo)
+			})
+		} else {
+			actions.Add("Keep non-breaking spaces and odd characters", func() {
+				e.ToggleKeepCharacters(c, tty, status, undo)
+			})
+		}
+	}
+
+	// Choose what to do with trailing whitespace and the final newline, when saving
+	if !e.binaryFile && !e.readOnly {
+		actions.Add("Whitespace when saving...", func() {
+			e.SavePolicyMenu(c, tty, status, extraDashes)
+		})
+	}
+
+	// Remove the blank lines at the end of the file
+	if n := e.TrailingBlankLines(); n > 0 {
+		title := "Remove 1 trailing blank line"
+		if n > 1 {
+			title = fmt.Sprintf("Remove %d trailing blank lines", n)
+		}
+		actions.AddCommand(e, c, tty, status, bookmark, undo, title, "trimblank")
+	}
+
+	// Reveal or hide what looks like passwords, keys and tokens
+	if e.secretsFound {
+		if e.redactSecrets {
+			actions.Add("Reveal secrets", func() {
+				e.ToggleRedactSecrets()
+			})
+		} else {
+			actions.Add("Hide secrets", func() {
+				e.ToggleRedactSecrets()
+			})
+		}
+	}
+
 	// Disable or enable word wrap when typing
 	if e.wrapWhenTyping {
 		actions.Add("Disable word wrap when typing", func() {
@@ -198,11 +515,7 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 			if f, err = os.CreateTemp(tempdir, "__o*"+"guessica"); err == nil {
 				// no error, everything is fine
 				tempFilename = f.Name()
-				// TODO: Implement e.SaveAs
-				oldFilename := e.filename
-				e.filename = tempFilename
-				err = e.Save(c, tty)
-				e.filename = oldFilename
+				err = e.SaveTemporary(c, tty, tempFilename)
 			}
 			if err != nil {
 				status.SetError(err)
@@ -241,6 +554,49 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Copy all text to the clipboard", "copyall")
 
+	// Disable or enable closing brackets and quotes automatically when typing
+	if !autoClose {
+		actions.Add("Enable auto-closing of brackets and quotes", func() {
+			autoClose = true
+		})
+	} else {
+		actions.Add("Disable auto-closing of brackets and quotes", func() {
+			autoClose = false
+		})
+	}
+
+	// Check JSON files for syntax errors and YAML files for indentation with tabs when saving,
+	// unless it is too slow for huge files
+	if ext := strings.ToLower(filepath.Ext(e.filename)); ext == ".json" || ext == ".yaml" || ext == ".yml" {
+		check := "syntax check"
+		if ext != ".json" {
+			check = "indentation check"
+		}
+		if syntaxCheckOnSave {
+			actions.Add("Disable the "+check+" on save", func() {
+				syntaxCheckOnSave = false
+			})
+		} else {
+			actions.Add("Enable the "+check+" on save", func() {
+				syntaxCheckOnSave = true
+			})
+		}
+	}
+
+	// Format the file every time it is saved, for all files of the same type
+	if e.hasFormatter() {
+		if formatOnSave[e.mode] {
+			actions.Add("Disable format on save for "+e.mode.String(), func() {
+				formatOnSave[e.mode] = false
+			})
+		} else {
+			actions.Add("Enable format on save for "+e.mode.String(), func() {
+				formatOnSave[e.mode] = true
+				status.SetMessageAfterRedraw("The file will be formatted every time it is saved")
+			})
+		}
+	}
+
 	// Disable or enable the tag-expanding behavior when typing in HTML or XML
 	if e.mode == mode.HTML || e.mode == mode.XML {
 		if !e.noExpandTags {
@@ -273,7 +629,7 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 			actions.Add("Debug mode", func() {
 				// Save the file when entering debug mode, since gdb may crash for some languages
 				// TODO: Identify which languages work poorly together with gdb
-				e.UserSave(c, tty, status)
+				e.UserSave(c, tty, status, undo)
 
 				status.Clear(c)
 				status.SetMessage("Debug mode enabled")
@@ -312,32 +668,18 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 
 	// Delete the rest of the file
 	actions.Add("Delete the rest of the file", func() { // copy file to clipboard
+		// Get the current index and remove the rest of the lines
+		currentLineIndex := int(e.DataY())
 
-		prepareFunction := func() {
+		if currentLineIndex < len(e.lines) {
 			// Prepare to delete all lines from this one and out
 			undo.Snapshot(e)
 			// Also close the portal, if any
 			ClosePortal(e)
+			e.lines = e.lines[:currentLineIndex]
+			e.dirty.MarkAll()
 			// Mark the file as changed
 			e.changed = true
-		}
-
-		// Get the current index and remove the rest of the lines
-		currentLineIndex := int(e.DataY())
-
-		for y := range e.lines {
-			if y >= currentLineIndex {
-				// Run the prepareFunction, but only once, if there was changes to be made
-				if prepareFunction != nil {
-					prepareFunction()
-					prepareFunction = nil
-				}
-				delete(e.lines, y)
-			}
-		}
-
-		if e.changed {
-			e.MakeConsistent()
 			e.redraw = true
 			e.redrawCursor = true
 		}
@@ -364,7 +706,7 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 
 		// Show a status message while writing
 		status.SetMessage("Writing " + pdfFilename + "...")
-		status.ShowNoTimeout(c, e)
+		status.ShowUntilRedraw(c, e)
 
 		statusMessage := ""
 
@@ -379,7 +721,7 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		// Show a status message after writing
 		status.ClearAll(c)
 		status.SetMessage(statusMessage)
-		status.ShowNoTimeout(c, e)
+		status.Show(c, e)
 	})
 
 	// Render to PDF using pandoc
@@ -399,10 +741,24 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		})
 	}
 
+	// Preview the rendered man page of an nroff source, or go back to the source
+	if e.mode == mode.Nroff && (which("man") != "" || which("groff") != "") {
+		actions.Add("Preview man page", func() {
+			e.PreviewManPage(c, status)
+		})
+	} else if e.manPagePreview {
+		actions.Add("Back to the nroff source", func() {
+			if err := e.LeaveManPagePreview(); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+			}
+		})
+	}
+
 	if !envNoColor || changedTheme {
 		// Add an option for selecting a theme
 		actions.Add("Change theme", func() {
-			menuChoices := []string{"Default", "Red & black", "VS", "Synthwave", "Blue Edit", "Amber Mono", "Green Mono", "Blue Mono", "No color"}
+			menuChoices := []string{"Default", "Red & black", "VS", "Synthwave", "Blue Edit", "Amber Mono", "Green Mono", "Blue Mono", "High contrast", "No color"}
 			useMenuIndex := 0
 			for i, menuChoiceText := range menuChoices {
 				if strings.HasPrefix(e.Theme.Name, menuChoiceText) {
@@ -443,7 +799,11 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 				envNoColor = false
 				e.setBlueTheme()
 				e.syntaxHighlight = false
-			case 8: // No color
+			case 8: // High contrast
+				envNoColor = false
+				e.setHighContrastTheme()
+				e.syntaxHighlight = true
+			case 9: // No color
 				envNoColor = true
 				e.setNoColorTheme()
 				e.syntaxHighlight = false
@@ -2,8 +2,14 @@ package main
 
 import "time"
 
-// Keypress combo time limit
-const keypressComboTimeLimit = 120 * time.Millisecond
+const (
+	// Keypress combo time limit
+	keypressComboTimeLimit = 120 * time.Millisecond
+
+	// Time limit for the key that follows esc, when esc is used as a leader key, like in esc v or esc 1 2.
+	// Keys that are pressed later are handled as regular keys, so that they can be typed after pressing esc.
+	leaderTimeLimit = 500 * time.Millisecond
+)
 
 // KeyHistory represents the last 3 keypresses, and when they were pressed
 type KeyHistory struct {
@@ -69,6 +75,12 @@ func (kh *KeyHistory) PrevIs(keyPresses ...string) bool {
 	return false
 }
 
+// AfterLeader checks if the previous keypress was esc, and if it was pressed within the leader time limit,
+// so that the current keypress should be handled as a key that follows the esc leader key
+func (kh *KeyHistory) AfterLeader() bool {
+	return kh.keys[2] == "c:27" && time.Since(kh.t[2]) < leaderTimeLimit
+}
+
 // PrevPrevIs checks if the one before the previous keypress is the given one
 func (kh *KeyHistory) PrevPrevIs(keyPresses ...string) bool {
 	for _, keyPress := range keyPresses {
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAfterLeader(t *testing.T) {
+	kh := NewKeyHistory()
+	kh.Push("c:27")
+	if !kh.AfterLeader() {
+		t.Error("expected a key right after esc to follow the leader key")
+	}
+	kh.t[2] = time.Now().Add(-2 * leaderTimeLimit)
+	if kh.AfterLeader() {
+		t.Error("expected a key pressed long after esc to be a regular key")
+	}
+	kh.Push("a")
+	if kh.AfterLeader() {
+		t.Error("expected a key after another key to be a regular key")
+	}
+}
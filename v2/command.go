@@ -1,16 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/xyproto/mode"
 	"github.com/xyproto/vt100"
 )
@@ -26,85 +22,47 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 
 	trimmedCommand := strings.TrimPrefix(strings.TrimSpace(args[0]), ":")
 
-	if strings.HasPrefix(trimmedCommand, "!") {
+	// Sed-like edit expressions, like "%s/foo/bar/g" or "g/^$/d", may contain spaces
+	if expression := strings.TrimPrefix(strings.TrimSpace(strings.Join(args, " ")), ":"); isEditExpression(expression) {
+		ee, err := ParseEditExpression(expression)
+		if err != nil {
+			return nil, err
+		}
 		return func() {
-
-			cmd := exec.Command(trimmedCommand[1:])
-			if len(args) > 1 {
-				cmd.Args = args[1:]
-			}
-
-			// Now run the cmd with the current block of lines as input
-			stdin, err := cmd.StdinPipe()
-			if err != nil {
+			if err := e.ApplyEditExpression(c, status, undo, ee); err != nil {
 				status.Clear(c)
 				status.SetError(err)
 				status.Show(c, e)
-				return
 			}
-			go func() {
-				defer stdin.Close()
-				io.WriteString(stdin, e.Block(e.LineIndex()))
-			}()
+		}, nil
+	}
 
-			// Gather the output in the same way as CombinedOutput and Run
-			var buf bytes.Buffer
-			cmd.Stdout = &buf
-			cmd.Stderr = &buf
-			err = cmd.Start()
-			if err != nil {
+	// Filter the current block of lines through a shell command, like "!sort -u"
+	if strings.HasPrefix(trimmedCommand, "!") {
+		command := strings.TrimSpace(strings.Join(append([]string{trimmedCommand[1:]}, args[1:]...), " "))
+		return func() {
+			if err := e.FilterBlock(c, tty, status, undo, bookmark, command, false); err != nil {
 				status.Clear(c)
 				status.SetError(err)
 				status.Show(c, e)
-				return
-			}
-
-			outputString := ""
-
-			// Create a completion channel, thanks
-			// https://medium.com/@vCabbage/go-timeout-commands-with-os-exec-commandcontext-ba0c861ed738
-			done := make(chan error)
-			go func() { done <- cmd.Wait() }()
-
-			// Start a timer
-			timeout := time.After(commandTimeout)
-
-			// Check if the timeout channel or done channel receives something first
-			select {
-			case <-timeout:
-				cmd.Process.Kill()
-				status.Clear(c)
-				status.SetErrorMessage("command timed out")
-				status.Show(c, e)
-				return
-			case err := <-done:
-				outputString = buf.String()
-				if err != nil {
-					status.Clear(c)
-					status.SetErrorMessage(cmd.String() + ": " + err.Error())
-					status.Show(c, e)
-					return
-				}
-			}
-
-			if outputString == "" {
-				status.Clear(c)
-				status.SetErrorMessage("no output")
-				status.Show(c, e)
-				return
 			}
-
-			undo.Snapshot(e)
-			e.ReplaceBlock(c, status, bookmark, outputString)
 		}, nil
 	}
 
 	// Argument checks, remember to use all available aliases
 	switch trimmedCommand {
-	case "if", "i", "insertfile", "insert", "insertf":
+	case "if", "i", "insertfile", "insert", "insertf", "saveas", "sas", "wa":
 		if len(args) != 2 {
 			return nil, fmt.Errorf("%s requires a filename as the second argument", trimmedCommand)
 		}
+	case "filter", "pipe", "|", "filterall", "fa", "pipeall":
+		// The shell command is optional, and is asked for if it is not given
+	case "align", "al", "alignon":
+		// The string to align on is optional, and is asked for if it is not given
+	case "sb", "so", "sor", "sort":
+		if _, err := parseSortOptions(args[1:]); err != nil {
+			return nil, err
+		}
 	default:
 		if len(args) != 1 {
 			return nil, fmt.Errorf("%s takes no arguments", args[0])
@@ -114,18 +72,49 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 	const (
 		nothing = iota
 		build
+		closebuffer
 		copyall
+		definition
+		fileinfo
+		forcesave
 		help
+		hover
 		insertdate
 		insertfile
 		inserttime
+		inserttimestamp
+		insertuuid
+		nextbuffer
+		nexterror
+		nextmixed
+		openatcursor
+		outline
+		preverror
+		projectreplace
+		projectsearch
+		projectsearchresults
 		quit
+		reindent
+		reindentall
+		reload
+		resetview
+		revertreplace
+		runtest
 		save
+		saveas
 		savequit
 		savequitclear
+		tag
 		sortblock
 		sortstrings
+		testfile
+		trimblanklines
 		version
+		wordcase
+		identifiercase
+		align
+		filter
+		filterall
 	)
 
 	// Define args and corresponding functions
@@ -160,9 +149,14 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			// --- Success ---
 			status.SetMessage("Success, built " + outputExecutable)
 			status.Show(c, e)
+			e.RunHooksInBackground(c, status, hookBuildSuccess)
 		},
 		copyall: func() { // copy all contents to the clipboard
-			if err := clipboard.WriteAll(e.String()); err != nil {
+			if !e.ConfirmClipboardCopy(c, tty, status, e.String()) {
+				status.Clear(c)
+				status.SetError(errSecretNotCopied)
+				status.Show(c, e)
+			} else if err := e.CopyToClipboard(e.String()); err != nil {
 				status.Clear(c)
 				status.SetError(err)
 				status.Show(c, e)
@@ -170,16 +164,32 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				status.SetMessageAfterRedraw("Copied everything")
 			}
 		},
+		definition: func() { // go to the definition of the identifier at the cursor
+			if err := e.GoToDefinition(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		hover: func() { // show the documentation for the identifier at the cursor
+			if err := e.ShowHover(c, status); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		fileinfo: func() { // show the full path of the current file in an overlay
+			e.ShowFileInfo(c)
+		},
+		forcesave: func() { // save the current file, even if it already has the same contents on disk
+			e.forceSave = true
+			e.UserSave(c, tty, status, undo)
+		},
 		help: func() { // display an informative status message
 			// TODO: Draw the same type of box that is used in debug mode, listing all possible commands
-			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], build")
+			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, w!, forcesave, saveas [filename], q, quit, h, help, sort [reverse|numeric|ignorecase|unique], v, version, date, time, timestamp, uuid, insertfile [filename], build, grep, results, bn, nextbuffer, bd, closebuffer, gf, openatcursor, ol, outline, gd, definition, doc, hover, tag, ne, nexterror, pe, preverror, nm, nextmixed, replaceall, revertreplace, ri, reindent, ria, reindentall, reload, testfile, rt, runtest, resetview, trimblank, fileinfo, wc, wordcase, cs, camelsnake, align [string], filter [command], filterall [command], !command, s/a/b/g, %s/a/b/g, 10,20s/a/b/, g/re/d")
 		},
 		insertdate: func() { // insert the current date
 			undo.Snapshot(e)
 			// If a space is added after the string here, instead of using e.addSpace,
 			// it will be stripped when the command menu disappears.
-			dateString := time.Now().Format(time.RFC3339)[:10]
-			e.InsertString(c, dateString)
+			e.InsertString(c, dateString(time.Now()))
 			e.addSpace = true
 		},
 		insertfile: func() { // insert a file
@@ -199,21 +209,110 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.InsertString(c, timeString)
 			e.addSpace = true
 		},
+		inserttimestamp: func() { // insert the current date and time, as an RFC 3339 timestamp
+			undo.Snapshot(e)
+			e.InsertString(c, timestampString(time.Now()))
+			e.addSpace = true
+		},
+		insertuuid: func() { // insert a new random UUID
+			uuid, err := newUUID()
+			if err != nil {
+				status.ShowErrorAfterRedraw(err)
+				return
+			}
+			undo.Snapshot(e)
+			e.InsertString(c, uuid)
+			e.addSpace = true
+		},
+		nextbuffer: func() { // switch to the next open file
+			if err := e.NextBuffer(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		nexterror: func() { // jump to the next error from the last build
+			if err := e.NextBuildError(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		nextmixed: func() { // jump to the next line that is not indented like the rest of the file
+			if err := e.NextMixedIndentation(c, status); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		preverror: func() { // jump to the previous error from the last build
+			if err := e.PrevBuildError(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		openatcursor: func() { // open the file at the cursor
+			if err := e.OpenPathAtCursor(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		closebuffer: func() { // save and close the current file, and switch to the previous open file
+			if err := e.CloseBuffer(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		outline: func() { // list the definitions in the current file, and jump to the selected one
+			if err := e.ShowOutline(c, tty, status); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		projectreplace: func() { // replace the matches from the last project search, in all files
+			e.ProjectReplacePrompt(c, tty, status, undo)
+		},
+		projectsearch: func() { // search all files in the project
+			e.ProjectSearchPrompt(c, tty, status)
+		},
+		projectsearchresults: func() { // show the results from the last project search again
+			e.ShowProjectSearch(c, tty, status)
+		},
+		reindent: func() { // reindent the current block
+			e.reindentCommand(c, status, bookmark, undo, e.BlockAt(e.DataY()))
+		},
+		reindentall: func() { // reindent the whole file
+			e.reindentCommand(c, status, bookmark, undo, e.WholeFile())
+		},
+		resetview: func() { // reset the stored view state for this file
+			if err := e.ResetViewState(); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+				return
+			}
+			status.SetMessageAfterRedraw("Reset the view state")
+		},
+		reload: func() { // load the file from disk again, while keeping the cursor position
+			if err := e.Reload(c, tty, status, undo); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				return
+			}
+			status.SetMessageAfterRedraw("Reloaded " + e.filename)
+		},
+		revertreplace: func() { // revert the last multi-file replace
+			e.RevertProjectReplace(c, status, undo)
+		},
 		save: func() { // save the current file
-			e.UserSave(c, tty, status)
+			e.UserSave(c, tty, status, undo)
 		},
-		savequit: func() { // save and quit
-			e.UserSave(c, tty, status)
-			e.quit = true
+		saveas: func() { // save the file with a new filename
+			e.SaveAs(c, tty, status, fileLock, undo, args[1])
 		},
-		savequitclear: func() { // save and quit, then clear the screen
-			e.UserSave(c, tty, status)
-			e.quit = true
-			e.clearOnQuit = true
+		savequit: func() { // save and quit, unless the file could not be saved
+			e.quit = e.UserSave(c, tty, status, undo)
+		},
+		savequitclear: func() { // save and quit, then clear the screen, unless the file could not be saved
+			if e.UserSave(c, tty, status, undo) {
+				e.quit = true
+				e.clearOnQuit = true
+			}
 		},
 		sortblock: func() { // sort the current block of lines, until the next blank line or EOF
+			opts, _ := parseSortOptions(args[1:]) // checked above
 			undo.Snapshot(e)
-			e.SortBlock(c, status, bookmark)
+			e.SortBlock(c, status, bookmark, opts)
 		},
 		sortstrings: func() { // sort the words on the current line
 			undo.Snapshot(e)
@@ -221,12 +320,69 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.redraw = true
 			e.redrawCursor = true
 		},
+		runtest: func() { // run the test function that the cursor is in
+			if err := e.RunTestAtCursor(c, tty, status); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		tag: func() { // jump to the definition of the word at the cursor, using the tags file from ctags
+			if err := e.JumpToTag(c, tty, status, fileLock); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		testfile: func() { // switch between the source file and the test file, and create the test file if missing
+			e.ToggleTestFile(c, tty, status)
+		},
+		trimblanklines: func() { // remove the blank lines at the end of the file
+			if e.TrailingBlankLines() == 0 {
+				status.SetMessageAfterRedraw("No trailing blank lines")
+				return
+			}
+			undo.Snapshot(e)
+			n := e.TrimTrailingBlankLines(c, status)
+			if n == 1 {
+				status.SetMessageAfterRedraw("Removed 1 trailing blank line")
+			} else {
+				status.SetMessageAfterRedraw(fmt.Sprintf("Removed %d trailing blank lines", n))
+			}
+		},
 		quit: func() { // quit
 			e.quit = true
 		},
 		version: func() { // display the program name and version as a status message
 			status.SetMessageAfterRedraw(versionString)
 		},
+		identifiercase: func() { // convert the identifier at the cursor between camelCase and snake_case
+			undo.Snapshot(e)
+			if _, err := e.ToggleIdentifierCase(c); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		filter: func() { // filter the current block of lines through a shell command
+			e.filterCommand(c, tty, status, bookmark, undo, strings.Join(args[1:], " "), false)
+		},
+		filterall: func() { // filter the whole file through a shell command
+			e.filterCommand(c, tty, status, bookmark, undo, strings.Join(args[1:], " "), true)
+		},
+		align: func() { // align the current block of lines on a string, like "=" or "//"
+			sep := strings.Join(args[1:], " ")
+			if sep == "" {
+				var ok bool
+				if sep, ok = e.UserInput(c, tty, status, "Align on", []string{}, false); !ok || sep == "" {
+					return
+				}
+			}
+			undo.Snapshot(e)
+			if err := e.AlignBlock(c, status, bookmark, sep); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
+		wordcase: func() { // change the word at the cursor from lowercase to UPPERCASE to Title case
+			undo.Snapshot(e)
+			if _, err := e.CycleWordCase(); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+		},
 	}
 
 	// TODO: Also handle the command arguments, command[1:], if given.
@@ -239,8 +395,18 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = quit
 	case "build", "b", "bu", "bui":
 		functionID = build
+	case "closebuffer", "bd", "close":
+		functionID = closebuffer
 	case "copyall", "copya":
 		functionID = copyall
+	case "definition", "def", "gd", "godef":
+		functionID = definition
+	case "hover", "doc", "docs", "K":
+		functionID = hover
+	case "fileinfo", "fi", "info", "path", "fullpath":
+		functionID = fileinfo
+	case "forcesave", "fs", "w!", "save!":
+		functionID = forcesave
 	case "h", "he", "hh", "hel", "help":
 		functionID = help
 	case "if", "i", "insertfile", "insert", "insertf":
@@ -249,18 +415,70 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = insertdate
 	case "inserttime", "time", "t", "ti", "tim":
 		functionID = inserttime
+	case "inserttimestamp", "timestamp", "its", "now", "rfc3339":
+		functionID = inserttimestamp
+	case "insertuuid", "uuid", "iu", "guid":
+		functionID = insertuuid
+	case "nextbuffer", "bn", "next":
+		functionID = nextbuffer
+	case "nexterror", "ne", "cn", "next-error":
+		functionID = nexterror
+	case "nextmixed", "mixed", "nm":
+		functionID = nextmixed
+	case "preverror", "pe", "cp", "previous-error", "prev-error":
+		functionID = preverror
+	case "openatcursor", "gf", "open":
+		functionID = openatcursor
+	case "outline", "ol", "symbols", "toc":
+		functionID = outline
+	case "grep", "gr", "projectsearch", "ps", "searchproject", "rg":
+		functionID = projectsearch
+	case "results", "grepresults", "psr":
+		functionID = projectsearchresults
+	case "replaceall", "ra", "projectreplace", "pr":
+		functionID = projectreplace
+	case "reindent", "ri", "indent":
+		functionID = reindent
+	case "reindentall", "ria", "indentall":
+		functionID = reindentall
+	case "reload", "rl", "e!", "revert":
+		functionID = reload
+	case "resetview", "rv", "resetviewstate":
+		functionID = resetview
+	case "revertreplace", "rr", "undoreplace":
+		functionID = revertreplace
 	case "qs", "byes", "cus", "exitsave", "quitandsave", "quitsave", "qw", "saq", "saveandquit", "saveexit", "saveq", "savequit", "savq", "sq", "wq", "↑":
 		functionID = savequit
 	case "s", "sa", "sav", "save", "w", "ww", "↓":
 		functionID = save
+	case "saveas", "sas", "wa":
+		functionID = saveas
 	case "sb", "so", "sor", "sort":
 		functionID = sortblock
 	case "sortstrings", "sortw", "sortwords", "sow", "ss", "sw", "sortfields", "sf":
 		functionID = sortstrings
 	case "sqc", "savequitclear":
 		functionID = savequitclear
+	case "runtest", "rt", "testhere", "testatcursor":
+		functionID = runtest
+	case "tag", "ta", "tj", "jumptotag":
+		functionID = tag
+	case "testfile", "test", "tf", "toggletest":
+		functionID = testfile
+	case "trimblank", "trimblanklines", "tb", "trim":
+		functionID = trimblanklines
 	case "v", "ver", "vv", "version":
 		functionID = version
+	case "wordcase", "case", "wc", "togglecase":
+		functionID = wordcase
+	case "snakecamel", "camel", "snake", "camelsnake", "cs":
+		functionID = identifiercase
+	case "align", "al", "alignon":
+		functionID = align
+	case "filter", "pipe", "|":
+		functionID = filter
+	case "filterall", "fa", "pipeall":
+		functionID = filterall
 	default:
 		return nil, fmt.Errorf("unknown command: %s", args[0])
 	}
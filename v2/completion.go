@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/syntax"
+	"github.com/xyproto/vt100"
+)
+
+// completionMaxCandidates is the maximum number of words that are shown in the completion popup
+const completionMaxCandidates = 8
+
+// isCompletionRune checks if the given rune can be part of a word that is suggested when completing
+func isCompletionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// countCompletionWords counts the words in the given lines that start with the given prefix and are longer than it
+func countCompletionWords(wordCount map[string]int, lines [][]rune, prefix string) {
+	first := []rune(prefix)[0]
+	for _, runes := range lines {
+		for i := 0; i < len(runes); i++ {
+			if runes[i] != first || (i > 0 && isCompletionRune(runes[i-1])) {
+				continue
+			}
+			end := i + 1
+			for end < len(runes) && isCompletionRune(runes[end]) {
+				end++
+			}
+			if word := string(runes[i:end]); len(word) > len(prefix) && strings.HasPrefix(word, prefix) {
+				wordCount[word]++
+			}
+			i = end
+		}
+	}
+}
+
+// CompletionCandidates returns the words that the given prefix can be completed to, the most frequent ones first.
+// The words are collected from the current file and the other open files, followed by the keywords for the current mode.
+func (e *Editor) CompletionCandidates(prefix string) []string {
+	if prefix == "" {
+		return []string{}
+	}
+	wordCount := make(map[string]int)
+	countCompletionWords(wordCount, e.lines, prefix)
+	for _, b := range openBuffers.buffers {
+		countCompletionWords(wordCount, b.Lines(), prefix)
+	}
+	words := make([]string, 0, len(wordCount))
+	for word := range wordCount {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if wordCount[words[i]] != wordCount[words[j]] {
+			return wordCount[words[i]] > wordCount[words[j]]
+		}
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) < len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	var keywords []string
+	prepareSyntaxKeywords(e.mode)
+	for kw := range syntax.Keywords {
+		// skip too short suggestions
+		if _, found := wordCount[kw]; !found && len(kw) >= 3 && len(kw) > len(prefix) && strings.HasPrefix(kw, prefix) {
+			keywords = append(keywords, kw)
+		}
+	}
+	sort.Strings(keywords)
+	words = append(words, keywords...)
+	if len(words) > completionMaxCandidates {
+		words = words[:completionMaxCandidates]
+	}
+	return words
+}
+
+// CompletionPopup shows the given candidates in a small box below the cursor, or above it if there is no room below.
+// The arrow keys select a candidate and return chooses it. Returns the chosen word, or false if the popup was dismissed.
+// Esc only dismisses the popup, while other keys also are handled by the key loop afterwards.
+// The editor must be redrawn afterwards, to remove the popup.
+func (e *Editor) CompletionPopup(c *vt100.Canvas, tty *vt100.TTY, prefix string, candidates []string) (string, bool) {
+	longest := 0
+	for _, candidate := range candidates {
+		if l := e.stringColumns(candidate); l > longest {
+			longest = l
+		}
+	}
+	items := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		items[i] = " " + candidate + strings.Repeat(" ", longest-e.stringColumns(candidate)) + " "
+	}
+	var (
+		bt       = e.NewBoxTheme()
+		w, h     = int(c.W()), int(c.H())
+		x, y     = e.pos.ScreenX(), e.pos.ScreenY() + e.topRows()
+		popupBox = &Box{x - e.stringColumns(prefix) - 2, y + 1, longest + 4, len(items) + 2}
+		selected = 0
+	)
+	// Place the popup so that the words line up with the word at the cursor, but keep it on the screen
+	if popupBox.X+popupBox.W > w {
+		popupBox.X = w - popupBox.W
+	}
+	if popupBox.X < 0 {
+		popupBox.X = 0
+	}
+	if popupBox.Y+popupBox.H > h-1 && y-popupBox.H >= 0 {
+		popupBox.Y = y - popupBox.H
+	}
+	listBox := &Box{popupBox.X + 1, popupBox.Y + 1, popupBox.W - 2, len(items)}
+	for {
+		e.DrawBox(bt, c, popupBox)
+		e.DrawList(bt, c, listBox, items, selected)
+		c.Draw()
+
+		switch key := readKey(tty); key {
+		case "↑", "c:16": // up or ctrl-p
+			selected = (selected + len(items) - 1) % len(items)
+		case "↓", "c:14", "c:9": // down, ctrl-n or tab
+			selected = (selected + 1) % len(items)
+		case "c:13": // return
+			return candidates[selected], true
+		case "c:27": // esc
+			return "", false
+		default:
+			// Close the popup and let the key loop handle the key, like when typing on
+			unreadKey(key)
+			return "", false
+		}
+	}
+}
+
+// Complete completes the word before the cursor with a word from the open files or a keyword.
+// If there are several candidates, one can be picked from a popup.
+// Returns false if there was nothing to complete the word to.
+func (e *Editor) Complete(c *vt100.Canvas, tty *vt100.TTY, undo *Undo) bool {
+	prefix := e.LettersBeforeCursor()
+	candidates := e.CompletionCandidates(prefix)
+	if len(candidates) == 0 {
+		return false
+	}
+	chosen := candidates[0]
+	if len(candidates) > 1 {
+		var ok bool
+		chosen, ok = e.CompletionPopup(c, tty, prefix, candidates)
+		// Redraw all the lines, not only the changed ones, to remove the popup
+		e.dirty.RedrawAll()
+		e.redraw = true
+		e.redrawCursor = true
+		if !ok {
+			return true
+		}
+	}
+	undo.Snapshot(e)
+	e.InsertString(c, strings.TrimPrefix(chosen, prefix))
+	e.redraw = true
+	e.redrawCursor = true
+	return true
+}
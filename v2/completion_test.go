@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestCompletionCandidates(t *testing.T) {
+	defer func(br *BufferRing) { openBuffers = br }(openBuffers)
+	openBuffers = &BufferRing{}
+
+	other := NewSimpleEditor(80)
+	other.filename = "/src/other.go"
+	other.LoadBytes([]byte("func parseHeader() {}\nfunc parseHeader2() {}\n"))
+	if err := openBuffers.Push(other, NewUndo(1, defaultUndoMemory)); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("parseBody(parseBody(x), parseBody2, pars)\nvar p = unparsed\n"))
+	got := e.CompletionCandidates("pars")
+	want := []string{"parseBody", "parseBody2", "parseHeader", "parseHeader2"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	// Keywords are suggested after the words from the files
+	if got := e.CompletionCandidates("packa"); len(got) != 1 || got[0] != "package" {
+		t.Errorf("expected the package keyword, got %v", got)
+	}
+	if got := e.CompletionCandidates("zzz"); len(got) != 0 {
+		t.Errorf("expected no candidates, got %v", got)
+	}
+
+	var sb strings.Builder
+	for _, letter := range "abcdefghij" {
+		sb.WriteString("word" + string(letter) + " ")
+	}
+	e.LoadBytes([]byte(sb.String()))
+	if got := e.CompletionCandidates("word"); len(got) != completionMaxCandidates {
+		t.Errorf("expected %d candidates, got %v", completionMaxCandidates, got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	defer func(br *BufferRing) { openBuffers = br }(openBuffers)
+	openBuffers = &BufferRing{}
+
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("configuration := 1\nfmt.Println(conf"))
+	e.pos.sy = 1
+	e.End(c)
+	// With only one candidate, it is inserted without showing the popup
+	if !e.Complete(c, nil, NewUndo(defaultUndoCount, defaultUndoMemory)) {
+		t.Fatal("expected the word to be completed")
+	}
+	if line := e.Line(1); line != "fmt.Println(configuration" {
+		t.Errorf("expected the word to be completed, got %q", line)
+	}
+	e.InsertString(c, " xyz")
+	if e.Complete(c, nil, NewUndo(defaultUndoCount, defaultUndoMemory)) {
+		t.Error("expected nothing to complete xyz to")
+	}
+}
+
+func TestCompletionPopupKeys(t *testing.T) {
+	defer func(pending []byte) { pendingKeyBytes, keyToReadAgain = pending, "" }(pendingKeyBytes)
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	candidates := []string{"configuration", "confirm"}
+
+	// Down and return chooses the second candidate
+	pendingKeyBytes = []byte("\x1b[B\r")
+	if chosen, ok := e.CompletionPopup(c, nil, "conf", candidates); !ok || chosen != "confirm" {
+		t.Errorf("expected the second candidate to be chosen, got %q", chosen)
+	}
+
+	// Any other key dismisses the popup, and is then read again by the key loop
+	pendingKeyBytes = []byte("x")
+	if _, ok := e.CompletionPopup(c, nil, "conf", candidates); ok {
+		t.Error("expected the popup to be dismissed")
+	}
+	if key := readKey(nil); key != "x" {
+		t.Errorf("expected the key that dismissed the popup to be read again, got %q", key)
+	}
+}
+
+func TestCompletionPopupPlacement(t *testing.T) {
+	defer func(pending []byte) { pendingKeyBytes, keyToReadAgain = pending, "" }(pendingKeyBytes)
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.showRuler = true
+	e.pos.sx = 10
+
+	// The popup is placed below the line with the cursor, which is one row further down when the ruler is shown,
+	// and the words line up with the wide runes that have been typed
+	pendingKeyBytes = []byte("\x1b")
+	e.CompletionPopup(c, nil, "日本", []string{"日本語"})
+	row := func(y uint) string {
+		var sb strings.Builder
+		for x := uint(0); x < c.W(); x++ {
+			r, _ := c.At(x, y)
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	}
+	if strings.Contains(row(2), "日本語") || !strings.Contains(row(3), "日本語") {
+		t.Errorf("expected the word in the popup to be drawn at row 3, got %q", row(3))
+	}
+	if r, _ := c.At(6, 3); r != '日' {
+		t.Errorf("expected the word in the popup to start at column 6, got %q", r)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/env"
+	"github.com/xyproto/vt100"
+)
+
+// The control socket lets external tools open files, move the cursor, insert text and save in a running editor.
+// It is a Unix socket named after the process ID, like $XDG_RUNTIME_DIR/o/1234.sock, and the protocol is line based:
+//
+//  1. When a client connects, the editor sends the greeting "OK o control 1".
+//  2. The client sends one command per line:
+//     OPEN path [line [col]], GOTO line, INSERT base64-encoded-text, SAVE or STATUS
+//  3. The editor answers each command with "OK", optionally followed by information, or with "ERR" and an error message.
+//
+// "o --remote filename [line [col]]" is a client that opens the file in the editor that has locked it.
+
+const (
+	// controlGreeting is sent to every client that connects to the control socket
+	controlGreeting = "OK o control 1"
+
+	// controlTimeout is how long a client waits for the editor to answer, for instance while a menu is open
+	controlTimeout = 10 * time.Second
+)
+
+var (
+	// useControlSocket is true if the control socket should be opened when the editor starts
+	useControlSocket bool
+
+	errNoRunningEditor = errors.New("the file is not open in a running editor")
+	errEditorBusy      = errors.New("the editor is busy")
+)
+
+// remoteCommand is a parsed command from a control socket client
+type remoteCommand struct {
+	name string // OPEN, GOTO, INSERT, SAVE or STATUS
+	path string // the file to open, for OPEN
+	line int    // the line number, counting from 1, or 0 if not given
+	col  int    // the column number, counting from 1, or 0 if not given
+	text string // the decoded text, for INSERT
+}
+
+// parseRemoteCommand parses a line like "OPEN main.go 12 4" or "INSERT aGVsbG8="
+func parseRemoteCommand(line string) (remoteCommand, error) {
+	var rc remoteCommand
+	line = strings.TrimRight(line, "\r\n")
+	name, args, _ := strings.Cut(line, " ")
+	rc.name = strings.ToUpper(name)
+	switch rc.name {
+	case "OPEN":
+		// The path may contain spaces, so the line and column numbers are parsed from the right
+		fields := strings.Fields(args)
+		numbers := 0
+		for numbers < 2 && len(fields)-numbers > 1 {
+			if _, err := strconv.Atoi(fields[len(fields)-1-numbers]); err != nil {
+				break
+			}
+			numbers++
+		}
+		if len(fields) == 0 {
+			return rc, errors.New("OPEN needs a path")
+		}
+		rc.path = strings.Join(fields[:len(fields)-numbers], " ")
+		if numbers > 0 {
+			rc.line, _ = strconv.Atoi(fields[len(fields)-numbers])
+		}
+		if numbers > 1 {
+			rc.col, _ = strconv.Atoi(fields[len(fields)-1])
+		}
+		if rc.line < 0 || rc.col < 0 {
+			return rc, errors.New("OPEN needs positive line and column numbers")
+		}
+	case "GOTO":
+		n, err := strconv.Atoi(strings.TrimSpace(args))
+		if err != nil || n < 1 {
+			return rc, errors.New("GOTO needs a line number")
+		}
+		rc.line = n
+	case "INSERT":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(args))
+		if err != nil {
+			return rc, errors.New("INSERT needs base64 encoded text")
+		}
+		if len(data) == 0 {
+			return rc, errors.New("INSERT needs some text")
+		}
+		rc.text = string(data)
+	case "SAVE", "STATUS":
+		if strings.TrimSpace(args) != "" {
+			return rc, errors.New(rc.name + " takes no arguments")
+		}
+	default:
+		return rc, fmt.Errorf("unknown command: %q", name)
+	}
+	return rc, nil
+}
+
+// String returns the command as a line that can be sent to the control socket, without the newline
+func (rc remoteCommand) String() string {
+	switch rc.name {
+	case "OPEN":
+		s := "OPEN " + rc.path
+		if rc.line > 0 {
+			s += " " + strconv.Itoa(rc.line)
+			if rc.col > 0 {
+				s += " " + strconv.Itoa(rc.col)
+			}
+		}
+		return s
+	case "GOTO":
+		return "GOTO " + strconv.Itoa(rc.line)
+	case "INSERT":
+		return "INSERT " + base64.StdEncoding.EncodeToString([]byte(rc.text))
+	}
+	return rc.name
+}
+
+// controlReply formats the answer to a command
+func controlReply(info string, err error) string {
+	if err != nil {
+		return "ERR " + strings.ReplaceAll(err.Error(), "\n", " ")
+	}
+	if info == "" {
+		return "OK"
+	}
+	return "OK " + info
+}
+
+// parseControlReply returns the information from an "OK" reply, or the error from an "ERR" reply
+func parseControlReply(reply string) (string, error) {
+	reply = strings.TrimRight(reply, "\r\n")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasPrefix(reply, "OK "):
+		return reply[3:], nil
+	case reply == "ERR":
+		return "", errors.New("unknown error")
+	case strings.HasPrefix(reply, "ERR "):
+		return "", errors.New(reply[4:])
+	}
+	return "", fmt.Errorf("unexpected reply: %q", reply)
+}
+
+// controlSocketDir returns the directory for the control sockets, preferably in $XDG_RUNTIME_DIR
+func controlSocketDir() string {
+	if runtimeDir := env.Str("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "o")
+	}
+	return filepath.Join(os.TempDir(), "o-"+strconv.Itoa(os.Getuid()))
+}
+
+// checkControlSocketDir returns an error if the given directory is not a real directory that is owned by
+// the given user and only accessible by that user. Another user could otherwise have created the directory
+// or a symlink in its place, and replaced the socket with one of their own.
+func checkControlSocketDir(dir string, uid int) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if fi.Mode().Perm() != 0o700 {
+		return fmt.Errorf("%s has mode %o, expected 700", dir, fi.Mode().Perm())
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != uid {
+		return fmt.Errorf("%s is owned by another user", dir)
+	}
+	return nil
+}
+
+// controlSocketFilename returns the path to the control socket of the editor with the given process ID
+func controlSocketFilename(pid int) string {
+	return filepath.Join(controlSocketDir(), strconv.Itoa(pid)+".sock")
+}
+
+// ControlServer listens for commands on a control socket
+type ControlServer struct {
+	listener net.Listener
+	filename string
+	handler  func(remoteCommand) (string, error)
+	wg       sync.WaitGroup
+}
+
+// StartControlServer starts listening on the given socket filename, and handles each command
+// from each client with the given handler, in the background.
+func StartControlServer(filename string, handler func(remoteCommand) (string, error)) (*ControlServer, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return nil, err
+	}
+	if err := checkControlSocketDir(filepath.Dir(filename), os.Getuid()); err != nil {
+		return nil, err
+	}
+	// Remove the socket of a previous process with the same process ID
+	os.Remove(filename)
+	listener, err := net.Listen("unix", filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(filename, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	cs := &ControlServer{listener: listener, filename: filename, handler: handler}
+	cs.wg.Add(1)
+	go cs.serve()
+	return cs, nil
+}
+
+// serve accepts connections until the control server is closed
+func (cs *ControlServer) serve() {
+	defer cs.wg.Done()
+	for {
+		conn, err := cs.listener.Accept()
+		if err != nil {
+			return
+		}
+		go cs.handle(conn)
+	}
+}
+
+// handle greets a client and then answers one command per line, until the client disconnects
+func (cs *ControlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, controlGreeting); err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rc, err := parseRemoteCommand(scanner.Text())
+		var info string
+		if err == nil {
+			info, err = cs.handler(rc)
+		}
+		if _, err := fmt.Fprintln(conn, controlReply(info, err)); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops listening and removes the socket file
+func (cs *ControlServer) Close() error {
+	err := cs.listener.Close()
+	cs.wg.Wait()
+	os.Remove(cs.filename)
+	return err
+}
+
+// sendRemoteCommands connects to the given control socket, checks the greeting and sends the commands.
+// Returns the information from the last reply, or the first error.
+func sendRemoteCommands(socketFilename string, commands ...remoteCommand) (string, error) {
+	conn, err := net.DialTimeout("unix", socketFilename, controlTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	reader := bufio.NewReader(conn)
+	greeting, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimRight(greeting, "\r\n") != controlGreeting {
+		return "", fmt.Errorf("unexpected greeting: %q", strings.TrimSpace(greeting))
+	}
+	var info string
+	for _, rc := range commands {
+		if _, err := fmt.Fprintln(conn, rc.String()); err != nil {
+			return "", err
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if info, err = parseControlReply(reply); err != nil {
+			return "", err
+		}
+	}
+	return info, nil
+}
+
+// RemoteOpen asks the editor that has locked the given file to open it and go to the given line and column
+func RemoteOpen(lk *LockKeeper, filename string, line, col int) error {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if err := lk.Load(); err != nil {
+		return errNoRunningEditor
+	}
+	pid := lk.Owner(absFilename)
+	if !runningEditor(pid) {
+		return errNoRunningEditor
+	}
+	socketFilename := controlSocketFilename(pid)
+	if err := checkControlSocketDir(filepath.Dir(socketFilename), os.Getuid()); err != nil {
+		return err
+	}
+	_, err = sendRemoteCommands(socketFilename, remoteCommand{name: "OPEN", path: absFilename, line: line, col: col})
+	return err
+}
+
+// The states of a command from the control socket that has been sent to the key loop
+const (
+	commandQueued int32 = iota
+	commandStarted
+	commandCancelled
+)
+
+// runControlCommand sends the given command to the key loop, and waits for the result. If the key loop has not
+// started the command within the given timeout, the command is cancelled and errEditorBusy is returned.
+// A command that has been started is waited for, so that a client that tries again does not make it run twice.
+func runControlCommand(command func() (string, error), timeout time.Duration) (string, error) {
+	type result struct {
+		info string
+		err  error
+	}
+	var (
+		done  = make(chan result, 1)
+		state = commandQueued
+	)
+	f := func() {
+		// A command that the client has already been told is too late must not run
+		if !atomic.CompareAndSwapInt32(&state, commandQueued, commandStarted) {
+			return
+		}
+		info, err := command()
+		done <- result{info, err}
+	}
+	deadline := time.After(timeout)
+	select {
+	case keyLoopEvents <- f:
+	case <-deadline:
+		return "", errEditorBusy
+	}
+	select {
+	case r := <-done:
+		return r.info, r.err
+	case <-deadline:
+		if atomic.CompareAndSwapInt32(&state, commandQueued, commandCancelled) {
+			return "", errEditorBusy
+		}
+		r := <-done
+		return r.info, r.err
+	}
+}
+
+// StartControlSocket opens the control socket for this editor, and handles the commands
+// between the keypresses. The returned control server must be closed when the editor quits.
+func (e *Editor) StartControlSocket(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) (*ControlServer, error) {
+	return StartControlServer(controlSocketFilename(os.Getpid()), func(rc remoteCommand) (string, error) {
+		// The command is run by the key loop, so that only the key loop reads from the terminal,
+		// for instance when asking if a file should be saved
+		return runControlCommand(func() (string, error) {
+			info, err := e.RemoteCommand(c, tty, status, rc)
+			e.RedrawAtEndOfKeyLoop(c, status)
+			return info, err
+		}, controlTimeout)
+	})
+}
+
+// RemoteCommand performs a command from the control socket
+func (e *Editor) RemoteCommand(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, rc remoteCommand) (string, error) {
+	switch rc.name {
+	case "OPEN":
+		absFilename, err := filepath.Abs(rc.path)
+		if err != nil {
+			return "", err
+		}
+		if currentAbsFilename, err := e.AbsFilename(); err != nil || currentAbsFilename != absFilename {
+			if e.lockReleased {
+				return "", errors.New("the file has been released to another instance of the editor")
+			}
+			if err := e.Switch(c, tty, status, fileLock, absFilename, false); err != nil {
+				return "", err
+			}
+		}
+		if rc.line > 0 {
+			col := rc.col
+			if col < 1 {
+				col = 1
+			}
+			e.MoveToLineColumnNumber(c, status, rc.line, col, false)
+		}
+		e.redraw = true
+		e.redrawCursor = true
+	case "GOTO":
+		e.redraw = e.GoToLineNumber(LineNumber(rc.line), c, status, true)
+		e.redrawCursor = true
+	case "INSERT":
+		if e.readOnly {
+			return "", errors.New("the file is read-only")
+		}
+		undo.Snapshot(e)
+		e.InsertStringAndMove(c, rc.text)
+		e.redraw = true
+		e.redrawCursor = true
+	case "SAVE":
+		if !e.UserSave(c, tty, status, undo) {
+			return "", errors.New("could not save " + e.filename)
+		}
+	case "STATUS":
+		absFilename, err := e.AbsFilename()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d %d %t %s", e.LineNumber(), e.ColNumber(), e.Changed(), absFilename), nil
+	}
+	return "", nil
+}
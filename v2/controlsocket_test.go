@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestParseRemoteCommand(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected remoteCommand
+	}{
+		{"OPEN main.go", remoteCommand{name: "OPEN", path: "main.go"}},
+		{"OPEN /tmp/main.go 12", remoteCommand{name: "OPEN", path: "/tmp/main.go", line: 12}},
+		{"open /tmp/my file.go 12 4\r\n", remoteCommand{name: "OPEN", path: "/tmp/my file.go", line: 12, col: 4}},
+		{"OPEN 42", remoteCommand{name: "OPEN", path: "42"}},
+		{"GOTO 7", remoteCommand{name: "GOTO", line: 7}},
+		{"INSERT aGVsbG8K", remoteCommand{name: "INSERT", text: "hello\n"}},
+		{"SAVE", remoteCommand{name: "SAVE"}},
+		{"STATUS", remoteCommand{name: "STATUS"}},
+	}
+	for _, test := range tests {
+		rc, err := parseRemoteCommand(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+		} else if rc != test.expected {
+			t.Errorf("%q: expected %+v, got %+v", test.line, test.expected, rc)
+		}
+		// Formatting and parsing again gives the same command
+		if again, err := parseRemoteCommand(rc.String()); err != nil || again != rc {
+			t.Errorf("%q: expected %q to parse to %+v, got %+v (%v)", test.line, rc.String(), rc, again, err)
+		}
+	}
+	for _, line := range []string{"", "OPEN", "GOTO", "GOTO 0", "GOTO x", "INSERT", "INSERT !!", "SAVE now", "QUIT"} {
+		if _, err := parseRemoteCommand(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestControlReply(t *testing.T) {
+	if info, err := parseControlReply(controlReply("3 1 false /tmp/a", nil) + "\n"); err != nil || info != "3 1 false /tmp/a" {
+		t.Errorf("expected the information to be returned, got %q (%v)", info, err)
+	}
+	if _, err := parseControlReply(controlReply("", errors.New("could not\nsave"))); err == nil || err.Error() != "could not save" {
+		t.Errorf("expected the error to be returned on one line, got %v", err)
+	}
+	if _, err := parseControlReply("HELLO"); err == nil {
+		t.Error("expected an error for an unexpected reply")
+	}
+}
+
+func TestControlServerHandshake(t *testing.T) {
+	// The directory is created by StartControlServer, and must only be accessible by the current user
+	socketFilename := filepath.Join(t.TempDir(), "o", "1234.sock")
+	var received []remoteCommand
+	cs, err := StartControlServer(socketFilename, func(rc remoteCommand) (string, error) {
+		received = append(received, rc)
+		switch rc.name {
+		case "SAVE":
+			return "", errors.New("read-only")
+		case "STATUS":
+			return fmt.Sprintf("%d commands", len(received)), nil
+		}
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Close()
+
+	info, err := sendRemoteCommands(socketFilename, remoteCommand{name: "OPEN", path: "/tmp/a b.go", line: 3}, remoteCommand{name: "INSERT", text: "hi"}, remoteCommand{name: "STATUS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != "3 commands" {
+		t.Errorf("expected the reply to the last command, got %q", info)
+	}
+	if len(received) != 3 || received[0].path != "/tmp/a b.go" || received[1].text != "hi" {
+		t.Errorf("unexpected commands: %+v", received)
+	}
+	if _, err := sendRemoteCommands(socketFilename, remoteCommand{name: "SAVE"}); err == nil || err.Error() != "read-only" {
+		t.Errorf("expected the error from the handler, got %v", err)
+	}
+
+	// Closing the server removes the socket
+	cs.Close()
+	if exists(socketFilename) {
+		t.Error("expected the socket file to be removed")
+	}
+	if _, err := sendRemoteCommands(socketFilename, remoteCommand{name: "STATUS"}); err == nil {
+		t.Error("expected an error when no editor is listening")
+	}
+}
+
+func TestControlClientWrongGreeting(t *testing.T) {
+	socketFilename := filepath.Join(t.TempDir(), "other.sock")
+	listener, err := net.Listen("unix", socketFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "SSH-2.0-OpenSSH")
+	}()
+	if _, err := sendRemoteCommands(socketFilename, remoteCommand{name: "STATUS"}); err == nil || !strings.Contains(err.Error(), "greeting") {
+		t.Errorf("expected a greeting error, got %v", err)
+	}
+}
+
+func TestCheckControlSocketDir(t *testing.T) {
+	tempDir := t.TempDir()
+	uid := os.Getuid()
+
+	private := filepath.Join(tempDir, "private")
+	if err := os.Mkdir(private, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkControlSocketDir(private, uid); err != nil {
+		t.Errorf("expected a private directory to be accepted, got %v", err)
+	}
+
+	// A directory that is owned by another user
+	if err := checkControlSocketDir(private, uid+1); err == nil {
+		t.Error("expected an error for a directory that is owned by another user")
+	}
+
+	// A directory that others can write to
+	shared := filepath.Join(tempDir, "shared")
+	if err := os.Mkdir(shared, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkControlSocketDir(shared, uid); err == nil {
+		t.Error("expected an error for a directory with the wrong mode")
+	}
+
+	// A symlink to a private directory
+	link := filepath.Join(tempDir, "link")
+	if err := os.Symlink(private, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkControlSocketDir(link, uid); err == nil {
+		t.Error("expected an error for a symlink")
+	}
+
+	// StartControlServer refuses to use a directory with the wrong mode
+	if _, err := StartControlServer(filepath.Join(shared, "1234.sock"), func(remoteCommand) (string, error) { return "", nil }); err == nil {
+		t.Error("expected StartControlServer to refuse a directory with the wrong mode")
+	}
+}
+
+func TestRunControlCommand(t *testing.T) {
+	runKeyLoopEvents()
+
+	// A command that the key loop has not started in time is cancelled, and never runs
+	ran := false
+	if _, err := runControlCommand(func() (string, error) { ran = true; return "", nil }, 20*time.Millisecond); err != errEditorBusy {
+		t.Errorf("expected the editor to be busy, got %v", err)
+	}
+	runKeyLoopEvents()
+	if ran {
+		t.Error("expected a cancelled command not to run")
+	}
+
+	// A command that has been started is waited for, also after the timeout
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		runKeyLoopEvents()
+	}()
+	info, err := runControlCommand(func() (string, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "done", nil
+	}, 20*time.Millisecond)
+	if err != nil || info != "done" {
+		t.Errorf("expected the result of the started command, got %q (%v)", info, err)
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.filename = filepath.Join(t.TempDir(), "notes.txt")
+	e.LoadBytes([]byte("one\ntwo\nthree\n"))
+	status := testStatusBar(e)
+
+	if _, err := e.RemoteCommand(c, nil, status, remoteCommand{name: "GOTO", line: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RemoteCommand(c, nil, status, remoteCommand{name: "INSERT", text: "new "}); err != nil {
+		t.Fatal(err)
+	}
+	if line := e.Line(1); line != "new two" {
+		t.Errorf("expected the text to be inserted on the second line, got %q", line)
+	}
+	info, err := e.RemoteCommand(c, nil, status, remoteCommand{name: "STATUS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2 5 true " + e.filename; info != expected {
+		t.Errorf("expected %q, got %q", expected, info)
+	}
+
+	e.readOnly = true
+	if _, err := e.RemoteCommand(c, nil, status, remoteCommand{name: "INSERT", text: "x"}); err == nil {
+		t.Error("expected read-only files not to be changed")
+	}
+}
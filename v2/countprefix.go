@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// maxRepeatCount is the largest count that can be given as a count prefix
+const maxRepeatCount = 9999
+
+var (
+	// countWithoutLeaderModes are the lowercase names of the modes where a count prefix can be typed without
+	// pressing esc first, since digits are rarely typed as text there. Can be set with "count-without-leader".
+	countWithoutLeaderModes = []string{"man"}
+
+	// repeatableKeys are the movement and editing keys that a count prefix can be used with
+	repeatableKeys = []string{
+		"↑",     // up arrow
+		"↓",     // down arrow
+		"←",     // left arrow
+		"→",     // right arrow
+		"c:14",  // ctrl-n, scroll down or go to the next match
+		"c:16",  // ctrl-p, scroll up or go to the previous match
+		"c:11",  // ctrl-k, delete to the end of the line
+		"c:4",   // ctrl-d, delete
+		"c:8",   // ctrl-h, delete backwards
+		"c:127", // backspace
+		"c:10",  // ctrl-j, join lines
+	}
+)
+
+// RepeatCount is a count prefix, like the "12" in esc 1 2 ctrl-n for scrolling down 12 lines,
+// and the repetition of the key that it is then applied to
+type RepeatCount struct {
+	digits      string // the digits that have been typed so far
+	key         string // the key that is being repeated
+	left        int    // how many more times the key should be repeated
+	scrollSpeed int    // the scroll speed to restore when done repeating, or 0
+}
+
+// parseModeList parses a comma separated list of mode names, like "man, log", into lowercase names
+func parseModeList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// countNeedsLeader checks if esc must be pressed before typing a count prefix in the given mode
+func countNeedsLeader(m mode.Mode) bool {
+	return !hasS(countWithoutLeaderModes, strings.ToLower(m.String()))
+}
+
+// isCountDigit checks if the given key is a digit that can be part of a count prefix.
+// A count can not start with 0.
+func (rc *RepeatCount) isCountDigit(key string) bool {
+	return len(key) == 1 && key[0] >= '0' && key[0] <= '9' && (key != "0" || rc.digits != "")
+}
+
+// Pending checks if a count prefix is being typed
+func (rc *RepeatCount) Pending() bool {
+	return rc.digits != ""
+}
+
+// AddDigit adds a digit to the count prefix, unless the count would be too large
+func (rc *RepeatCount) AddDigit(key string) {
+	if n, err := strconv.Atoi(rc.digits + key); err == nil && n <= maxRepeatCount {
+		rc.digits += key
+	}
+}
+
+// Count returns the count that has been typed so far, or 1 if no count has been typed
+func (rc *RepeatCount) Count() int {
+	n, err := strconv.Atoi(rc.digits)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Cancel forgets the count prefix that is being typed
+func (rc *RepeatCount) Cancel() {
+	rc.digits = ""
+}
+
+// Start applies the count prefix to the given key, which will then be repeated by Next.
+// Returns false if the key can not be repeated, in which case the count is forgotten.
+func (rc *RepeatCount) Start(key string) bool {
+	n := rc.Count()
+	rc.digits = ""
+	if !hasS(repeatableKeys, key) {
+		return false
+	}
+	rc.key, rc.left = key, n-1
+	return true
+}
+
+// ScrollOneLineAtATime makes ctrl-n and ctrl-p scroll one line per repetition, until the repetition is done
+func (rc *RepeatCount) ScrollOneLineAtATime(e *Editor) {
+	if rc.scrollSpeed == 0 {
+		rc.scrollSpeed = e.pos.scrollSpeed
+	}
+	e.pos.scrollSpeed = 1
+}
+
+// Next returns the key that should be repeated next, if any.
+// When the repetition is done, the scroll speed is restored.
+func (rc *RepeatCount) Next(e *Editor) (string, bool) {
+	if rc.left > 0 {
+		rc.left--
+		return rc.key, true
+	}
+	if rc.scrollSpeed > 0 {
+		e.pos.scrollSpeed = rc.scrollSpeed
+		rc.scrollSpeed = 0
+	}
+	return "", false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestRepeatCount(t *testing.T) {
+	var rc RepeatCount
+	if rc.isCountDigit("0") {
+		t.Error("a count should not start with 0")
+	}
+	for _, key := range []string{"1", "2"} {
+		if !rc.isCountDigit(key) {
+			t.Fatalf("expected %q to be a count digit", key)
+		}
+		rc.AddDigit(key)
+	}
+	if !rc.isCountDigit("0") || rc.isCountDigit("c:4") || rc.Count() != 12 {
+		t.Fatalf("unexpected count %d", rc.Count())
+	}
+	if !rc.Start("c:4") || rc.Pending() {
+		t.Fatal("expected ctrl-d to be repeatable")
+	}
+	e := NewSimpleEditor(80)
+	repeated := 0
+	for {
+		key, ok := rc.Next(e)
+		if !ok {
+			break
+		}
+		if key != "c:4" {
+			t.Fatalf("unexpected key %q", key)
+		}
+		repeated++
+	}
+	// The first of the 12 keypresses is the one that the count was applied to
+	if repeated != 11 {
+		t.Errorf("expected 11 repetitions, got %d", repeated)
+	}
+
+	// Keys that can not be repeated forget the count
+	rc.AddDigit("3")
+	if rc.Start("c:19") || rc.Pending() {
+		t.Error("expected ctrl-s to not be repeatable")
+	}
+	if _, ok := rc.Next(e); ok {
+		t.Error("expected nothing to repeat")
+	}
+
+	// The count is limited
+	for i := 0; i < 10; i++ {
+		rc.AddDigit("9")
+	}
+	if rc.Count() != maxRepeatCount {
+		t.Errorf("expected the count to be limited to %d, got %d", maxRepeatCount, rc.Count())
+	}
+	rc.Cancel()
+	if rc.Pending() || rc.Count() != 1 {
+		t.Error("expected the count to be cancelled")
+	}
+}
+
+func TestRepeatCountScrollSpeed(t *testing.T) {
+	var rc RepeatCount
+	e := NewSimpleEditor(80)
+	e.pos.scrollSpeed = 10
+	rc.AddDigit("2")
+	rc.Start("c:14")
+	rc.ScrollOneLineAtATime(e)
+	if e.pos.scrollSpeed != 1 {
+		t.Fatalf("expected a scroll speed of 1 while repeating, got %d", e.pos.scrollSpeed)
+	}
+	for {
+		if _, ok := rc.Next(e); !ok {
+			break
+		}
+	}
+	if e.pos.scrollSpeed != 10 {
+		t.Errorf("expected the scroll speed to be restored, got %d", e.pos.scrollSpeed)
+	}
+}
+
+func TestCountNeedsLeader(t *testing.T) {
+	defer func(modes []string) { countWithoutLeaderModes = modes }(countWithoutLeaderModes)
+	if countNeedsLeader(mode.ManPage) || !countNeedsLeader(mode.Go) {
+		t.Error("expected only man pages to not need a leader by default")
+	}
+	countWithoutLeaderModes = parseModeList(" Log, man ,, ")
+	if len(countWithoutLeaderModes) != 2 || countNeedsLeader(mode.Log) {
+		t.Errorf("unexpected modes: %v", countWithoutLeaderModes)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// tagsFilename is the name of the file that ctags generates, which is searched for in the directory of the current file and the parent directories
+const tagsFilename = "tags"
+
+var (
+	errNoTagsFile  = errors.New("no tags file")
+	errTagNotFound = errors.New("tag not found")
+)
+
+// Tag is an entry in a tags file, generated by ctags
+type Tag struct {
+	name        string
+	absFilename string
+	lineNumber  LineNumber // the line number, if the address is a line number
+	pattern     string     // the literal text to search for, if the address is a search pattern
+	anchorStart bool       // the pattern must match at the start of the line
+	anchorEnd   bool       // the pattern must match at the end of the line
+	kind        string     // the kind of tag, like "f" or "function", for extended tags files
+}
+
+// findTagsFile searches the given directory and the parent directories for a tags file.
+// Returns the path to the file, or an empty string.
+func findTagsFile(dir string) string {
+	for {
+		if path := filepath.Join(dir, tagsFilename); exists(path) && !isDir(path) {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseTagAddress parses the address field of a tag, which is either a line number, or a search pattern like /^func main() {$/
+// or ?^func main() {$?. Extended tags files may combine the two, like 42;/^func main() {$/, and then the line number is used.
+func (tag *Tag) parseTagAddress(address string) error {
+	if n, err := strconv.Atoi(strings.SplitN(address, ";", 2)[0]); err == nil {
+		tag.lineNumber = LineNumber(n)
+		return nil
+	}
+	if len(address) < 2 || (address[0] != '/' && address[0] != '?') {
+		return errors.New("invalid tag address: " + address)
+	}
+	delimiter := address[0]
+	var sb strings.Builder
+	escaped, closed := false, false
+	for i := 1; i < len(address); i++ {
+		b := address[i]
+		if escaped {
+			// Only the delimiter and backslash are escaped, keep the backslash for anything else
+			if b != delimiter && b != '\\' {
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(b)
+			escaped = false
+		} else if b == '\\' {
+			escaped = true
+		} else if b == delimiter {
+			closed = true
+			break
+		} else {
+			sb.WriteByte(b)
+		}
+	}
+	if !closed {
+		return errors.New("invalid tag address: " + address)
+	}
+	pattern := sb.String()
+	if strings.HasPrefix(pattern, "^") {
+		tag.anchorStart = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, "\\$") {
+		tag.anchorEnd = true
+		pattern = pattern[:len(pattern)-1]
+	}
+	tag.pattern = pattern
+	return nil
+}
+
+// parseTagLine parses a line from a tags file, in either the classic format, "name<tab>file<tab>address",
+// or the extended format, where the address is followed by ;" and fields like "kind:function" or just "f".
+// Relative filenames are resolved from the given directory.
+func parseTagLine(line, dir string) (*Tag, error) {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 {
+		return nil, errors.New("invalid tag: " + line)
+	}
+	tag := &Tag{name: fields[0], absFilename: fields[1]}
+	if !filepath.IsAbs(tag.absFilename) {
+		tag.absFilename = filepath.Join(dir, tag.absFilename)
+	}
+	address, extensionFields := fields[2], ""
+	if pos := strings.LastIndex(address, ";\"\t"); pos != -1 {
+		address, extensionFields = address[:pos], address[pos+3:]
+	} else {
+		address = strings.TrimSuffix(address, ";\"")
+	}
+	if err := tag.parseTagAddress(address); err != nil {
+		return nil, err
+	}
+	for _, field := range strings.Split(extensionFields, "\t") {
+		if name, value, ok := strings.Cut(field, ":"); !ok && field != "" {
+			tag.kind = field
+		} else if name == "kind" {
+			tag.kind = value
+		}
+	}
+	return tag, nil
+}
+
+// FindTags returns all the tags with the given name in the given tags file
+func FindTags(tagsFilename, name string) ([]*Tag, error) {
+	f, err := os.Open(tagsFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		tags    []*Tag
+		dir     = filepath.Dir(tagsFilename)
+		prefix  = name + "\t"
+		scanner = bufio.NewScanner(f)
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+			if tag, err := parseTagLine(line, dir); err == nil {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, scanner.Err()
+}
+
+// matches checks if the given line matches the search pattern of the tag
+func (tag *Tag) matches(line string) bool {
+	switch {
+	case tag.anchorStart && tag.anchorEnd:
+		return line == tag.pattern
+	case tag.anchorStart:
+		return strings.HasPrefix(line, tag.pattern)
+	case tag.anchorEnd:
+		return strings.HasSuffix(line, tag.pattern)
+	default:
+		return strings.Contains(line, tag.pattern)
+	}
+}
+
+// String returns a description of the tag for the picker, like "function main (src/main.c:12)"
+func (tag *Tag) String() string {
+	location := filepath.Base(tag.absFilename)
+	if tag.lineNumber > 0 {
+		location += ":" + tag.lineNumber.String()
+	} else {
+		location += ": " + strings.TrimSpace(tag.pattern)
+	}
+	if tag.kind != "" {
+		return fmt.Sprintf("%s %s (%s)", tag.kind, tag.name, location)
+	}
+	return fmt.Sprintf("%s (%s)", tag.name, location)
+}
+
+// GoToTag switches to the file of the given tag, and jumps to the line and the name of the tag
+func (e *Editor) GoToTag(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, tag *Tag) error {
+	if err := e.Switch(c, tty, status, lk, tag.absFilename, false); err != nil {
+		return err
+	}
+	y := tag.lineNumber.LineIndex()
+	if tag.lineNumber < 1 {
+		found := false
+		for i := 0; i < e.Len(); i++ {
+			if tag.matches(e.Line(LineIndex(i))) {
+				y, found = LineIndex(i), true
+				break
+			}
+		}
+		if !found {
+			return errors.New("could not find " + tag.name + " in " + filepath.Base(tag.absFilename))
+		}
+	}
+	x := 0
+	if runes, ok := e.lineRunes(int(y)); ok {
+		if pos := strings.Index(string(runes), tag.name); pos != -1 {
+			x = len([]rune(string(runes)[:pos]))
+		}
+	}
+	e.MoveToLineColumnNumber(c, status, int(y.LineNumber()), x+1, false)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// JumpToTag jumps to the definition of the word at the cursor, by looking it up in the tags file for the current file.
+// If there are several definitions, the user can pick one from a menu.
+func (e *Editor) JumpToTag(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	word := e.WordAtCursor()
+	if word == "" {
+		return errTagNotFound
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	tagsFile := findTagsFile(filepath.Dir(absFilename))
+	if tagsFile == "" {
+		return errNoTagsFile
+	}
+	tags, err := FindTags(tagsFile, word)
+	if err != nil {
+		return err
+	}
+	if pos := strings.LastIndex(word, "."); len(tags) == 0 && pos != -1 && pos < len(word)-1 {
+		// For method calls and struct fields, like "list.append", look up the part after the dot
+		word = word[pos+1:]
+		if tags, err = FindTags(tagsFile, word); err != nil {
+			return err
+		}
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("tag not found: %s", word)
+	}
+	tag := tags[0]
+	if len(tags) > 1 {
+		choices := make([]string, len(tags))
+		for i, tag := range tags {
+			choices[i] = tag.String()
+		}
+		const extraDashes = false
+		selected := e.Menu(status, tty, "Definitions of "+word, choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+		e.redraw = true
+		e.redrawCursor = true
+		if selected < 0 || selected >= len(tags) {
+			return nil
+		}
+		tag = tags[selected]
+	}
+	return e.GoToTag(c, tty, status, lk, tag)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTagLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Tag
+	}{
+		// Classic, with a line number
+		{"main\tmain.c\t12", Tag{name: "main", absFilename: "/src/main.c", lineNumber: 12}},
+		// Classic, with a search pattern, where the slash is escaped
+		{"parse\tlib/parse.c\t/^int parse(char *a\\/b)$/", Tag{name: "parse", absFilename: "/src/lib/parse.c", pattern: "int parse(char *a/b)", anchorStart: true, anchorEnd: true}},
+		// Exuberant ctags, with a short kind
+		{"Parser\tparser.py\t/^class Parser:$/;\"\tc", Tag{name: "Parser", absFilename: "/src/parser.py", pattern: "class Parser:", anchorStart: true, anchorEnd: true, kind: "c"}},
+		// Universal ctags, with a backward search, a kind field and other fields
+		{"run\t/abs/run.rs\t?^    fn run(&self) {?;\"\tkind:method\tline:7\timpl:App", Tag{name: "run", absFilename: "/abs/run.rs", pattern: "    fn run(&self) {", anchorStart: true, kind: "method"}},
+		// A line number combined with a pattern
+		{"init\tinit.c\t42;/^void init() {$/;\"\tf", Tag{name: "init", absFilename: "/src/init.c", lineNumber: 42, kind: "f"}},
+	}
+	for _, test := range tests {
+		tag, err := parseTagLine(test.line, "/src")
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if *tag != test.want {
+			t.Errorf("%q: expected %+v, got %+v", test.line, test.want, *tag)
+		}
+	}
+	for _, line := range []string{"main\tmain.c", "main\tmain.c\t/^int main("} {
+		if _, err := parseTagLine(line, "/src"); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestJumpToTag(t *testing.T) {
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{
+		"src/tmp.main.c": "#include \"util.h\"\n\nint main() {\n    return answer();\n}\n",
+		"src/tmp.util.c": "// The answer\n\nint answer() {\n    return 42;\n}\n",
+		tagsFilename:     "!_TAG_FILE_FORMAT\t2\t/extended format/\nanswer\tsrc/tmp.util.c\t/^int answer() {$/;\"\tf\nmain\tsrc/tmp.main.c\t/^int main() {$/;\"\tf\n",
+	})
+	srcDir := filepath.Join(dir, "src")
+	mainFilename, utilFilename := filepath.Join(srcDir, "tmp.main.c"), filepath.Join(srcDir, "tmp.util.c")
+
+	c, e, status := openTestEditor(t, mainFilename)
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+
+	// The tags file in the parent directory is used, and the file with the definition is switched to
+	e.MoveToLineColumnNumber(c, status, 4, 13, false)
+	if word := e.WordAtCursor(); word != "answer" {
+		t.Fatalf("expected the cursor to be at answer, got %q", word)
+	}
+	if err := e.JumpToTag(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != utilFilename || e.LineNumber() != 3 {
+		t.Errorf("expected line 3 in %s, got line %d in %s", utilFilename, e.LineNumber(), e.filename)
+	}
+	if x, _ := e.DataX(); x != 4 {
+		t.Errorf("expected the cursor to be at the name, got column %d", x+1)
+	}
+
+	// "The" in the comment at the top
+	e.MoveToLineColumnNumber(c, status, 1, 5, false)
+	if err := e.JumpToTag(c, nil, status, lk); err == nil || err.Error() != "tag not found: The" {
+		t.Errorf("expected the tag not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// splitPaste is true if ctrl-v should paste only the first line of several lines,
+// and then the rest of the lines when ctrl-v is pressed again on the same line
+var splitPaste = false
+
+// ClipEntry is the text that was last cut or copied, as a list of lines
+type ClipEntry struct {
+	lines     []string
+	block     bool // was a whole block of text cut or copied, by pressing ctrl-x or ctrl-c twice?
+	selection bool // was the text copied from a selection, so that it should be pasted at the cursor?
+}
+
+// newClipEntry returns a clipboard entry for the given text, where a final newline is not counted as an extra line
+func newClipEntry(s string) ClipEntry {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return ClipEntry{lines: lines}
+}
+
+// String returns the text of the entry, as it should be placed in the system clipboard
+func (ce ClipEntry) String() string {
+	s := strings.Join(ce.lines, "\n")
+	if ce.block {
+		s += "\n"
+	}
+	return s
+}
+
+// Empty checks if there is nothing to paste
+func (ce ClipEntry) Empty() bool {
+	return len(ce.lines) == 0
+}
+
+// lineCount returns a string like "1 line" or "14 lines"
+func lineCount(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	return fmt.Sprintf("%d lines", n)
+}
+
+// CutCopyPaste is the internal clipboard, together with what is needed for
+// detecting if ctrl-x, ctrl-c or ctrl-v is pressed twice on the same line.
+//
+// The state machine, where "the same line" means that the key was pressed on this line the last time,
+// and any other cut, copy or paste, and keys like esc, undo and redo, forget which line that was:
+//
+//	ctrl-c:                   copy the trimmed current line
+//	ctrl-c on the same line:  copy the block of text that starts at the current line
+//	ctrl-x:                   cut the current line
+//	ctrl-x on the same line:  cut the block of text that follows, and add it to the line that was just cut
+//	ctrl-x on a blank line:   remove the line, but keep what is in the clipboard
+//	ctrl-v:                   paste all the lines, or a single line at the cursor
+//	ctrl-v, if splitPaste:    paste only the first line, at the cursor
+//	ctrl-v on the same line:  paste the rest of the lines, if splitPaste (return may be pressed in between)
+//
+// Text that was copied from a selection is always pasted at the cursor, as it is.
+// When the system clipboard has other text than the current entry, a new entry is made from it.
+type CutCopyPaste struct {
+	entry      ClipEntry
+	splitPaste bool
+	lastCopyY  LineIndex // used for keeping track if ctrl-c has been pressed twice on the same line
+	lastCutY   LineIndex // used for keeping track if ctrl-x has been pressed twice on the same line
+	lastPasteY LineIndex // used for keeping track if ctrl-v has been pressed twice on the same line
+}
+
+// NewCutCopyPaste returns an empty internal clipboard
+func NewCutCopyPaste(splitPaste bool) *CutCopyPaste {
+	return &CutCopyPaste{splitPaste: splitPaste, lastCopyY: -1, lastCutY: -1, lastPasteY: -1}
+}
+
+// PasteHint describes what ctrl-v will paste, like "ctrl-v pastes 14 lines"
+func (ccp *CutCopyPaste) PasteHint() string {
+	n := len(ccp.entry.lines)
+	if ccp.splitPaste && n > 1 && !ccp.entry.selection {
+		return "ctrl-v pastes 1 line, then " + lineCount(n-1)
+	}
+	return "ctrl-v pastes " + lineCount(n)
+}
+
+// Reset forgets on which line ctrl-x, ctrl-c or ctrl-v was last pressed
+func (ccp *CutCopyPaste) Reset() {
+	ccp.lastCopyY = -1
+	ccp.lastCutY = -1
+	ccp.lastPasteY = -1
+}
+
+// NewLinePressed lets the rest of the lines be pasted after the first line has been pasted and
+// return has been pressed, as if ctrl-v was pressed on the same line
+func (ccp *CutCopyPaste) NewLinePressed(previousKeyWasReturn bool) {
+	if ccp.lastPasteY != -1 && !previousKeyWasReturn {
+		ccp.lastPasteY++
+	}
+}
+
+// UseText makes a new entry from the given text from the system clipboard,
+// unless it is the same as the text of the current entry
+func (ccp *CutCopyPaste) UseText(s string) {
+	if !ccp.entry.Empty() && s == ccp.entry.String() {
+		return
+	}
+	ccp.entry = newClipEntry(s)
+	// Start with the first line if the contents are new
+	ccp.lastPasteY = -1
+}
+
+// SetSelection makes a new entry from text that was copied or cut from a selection
+func (ccp *CutCopyPaste) SetSelection(s string) {
+	ccp.entry = ClipEntry{lines: strings.Split(s, "\n"), selection: true}
+	ccp.Reset()
+}
+
+// Copy copies the trimmed current line, or the block of text that starts at the current line if
+// ctrl-c was pressed on this line the last time.
+// Returns the text that should be placed in the system clipboard, or "" if there was nothing to copy.
+func (ccp *CutCopyPaste) Copy(e *Editor) string {
+	y := e.DataY()
+	ccp.lastCutY = -1
+	ccp.lastPasteY = -1
+	if ccp.lastCopyY != y {
+		ccp.lastCopyY = y
+		trimmed := strings.TrimSpace(e.Line(y))
+		if trimmed == "" {
+			return ""
+		}
+		ccp.entry = ClipEntry{lines: []string{trimmed}}
+		return trimmed
+	}
+	r := e.BlockAt(y)
+	if r.Empty() {
+		return ""
+	}
+	ccp.entry = ClipEntry{lines: e.RangeLines(r), block: true}
+	return ccp.entry.String()
+}
+
+// Cut cuts the current line, or the block of text that follows if ctrl-x was pressed on this line the
+// last time, in which case the block is added to the line that was just cut. A blank line is just removed.
+// Returns the text that should be placed in the system clipboard, or "" if only a blank line was removed.
+func (ccp *CutCopyPaste) Cut(e *Editor, bookmark *Position) string {
+	y := e.DataY()
+	if blankLine(e.Line(y)) {
+		e.Home()
+		e.DeleteCurrentLineMoveBookmark(bookmark)
+		return ""
+	}
+	ccp.lastCopyY = -1
+	ccp.lastPasteY = -1
+	if ccp.lastCutY != y {
+		ccp.lastCutY = y
+		ccp.entry = ClipEntry{lines: []string{e.Line(y)}}
+		e.DeleteLineMoveBookmark(y, bookmark)
+		return ccp.entry.String()
+	}
+	r := e.BlockAt(y)
+	ccp.entry.lines = append(ccp.entry.lines, e.RangeLines(r)...)
+	ccp.entry.block = true
+	// Also remove the blank line after the block, if there is one
+	if next := r.To + 1; int(next) < e.Len() && blankLine(e.Line(next)) {
+		r.To = next
+	}
+	e.DeleteRange(r, bookmark)
+	return ccp.entry.String()
+}
+
+// Paste pastes the entry at the current line. A single line, or text from a selection, is pasted at the cursor.
+// Several lines are pasted as lines, replacing the current line if it is blank, or below it if not.
+// If splitPaste is enabled, only the first line is pasted at first, and the rest when ctrl-v is pressed
+// on the same line again. afterReturn is true if return was pressed right before ctrl-v.
+// Returns the number of lines that were pasted, and the number of lines that are left to paste.
+func (ccp *CutCopyPaste) Paste(e *Editor, c *vt100.Canvas, bookmark *Position, afterReturn bool) (int, int) {
+	y := e.DataY()
+	lines := ccp.entry.lines
+	ccp.lastCutY = -1
+	ccp.lastCopyY = -1
+	switch {
+	case len(lines) == 0:
+		return 0, 0
+	case ccp.entry.selection:
+		ccp.Reset()
+		e.InsertTextAtCursor(c, ccp.entry.String())
+		return len(lines), 0
+	case len(lines) == 1:
+		e.pasteLineAtCursor(c, lines[0])
+		return 1, 0
+	case !ccp.splitPaste:
+		e.pasteLines(c, lines, bookmark)
+		return len(lines), 0
+	case ccp.lastPasteY != y: // the first line
+		ccp.lastPasteY = y
+		e.pasteLineAtCursor(c, lines[0])
+		return 1, len(lines) - 1
+	}
+	// Pressed the second time for this line number, paste the rest of the lines
+	if !afterReturn {
+		// Replace the trimmed line that was pasted by an untrimmed version
+		e.SetLine(y, lines[0])
+		e.InsertLines(y+1, lines[1:], bookmark)
+		e.GoTo(y+LineIndex(len(lines)-1), c, nil)
+		e.End(c)
+	} else {
+		e.pasteLines(c, lines[1:], bookmark)
+	}
+	return len(lines) - 1, 0
+}
+
+// pasteLineAtCursor inserts the trimmed line at the cursor.
+// If the current line is blank, its indentation is used instead.
+func (e *Editor) pasteLineAtCursor(c *vt100.Canvas, line string) {
+	if e.EmptyRightTrimmedLine() {
+		y := e.DataY()
+		e.SetLine(y, e.LeadingWhitespace()+strings.TrimSpace(line))
+		return
+	}
+	e.InsertStringAndMove(c, strings.TrimSpace(line))
+}
+
+// pasteLines pastes the given lines untrimmed, in place of the current line if it is blank, or below it if not.
+// The cursor is placed at the end of the last line that was pasted.
+func (e *Editor) pasteLines(c *vt100.Canvas, lines []string, bookmark *Position) {
+	y := e.DataY()
+	if e.EmptyRightTrimmedLine() {
+		e.ReplaceRange(Lines(y, y), lines, bookmark)
+	} else {
+		y++
+		e.InsertLines(y, lines, bookmark)
+	}
+	e.GoTo(y+LineIndex(len(lines)-1), c, nil)
+	e.End(c)
+}
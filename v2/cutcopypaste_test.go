@@ -0,0 +1,185 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+// newPasteEditor returns an editor with two blocks of text, and the cursor at the first line
+func newPasteEditor() *Editor {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("  one\n  two\n\nthree\nfour\n"))
+	return e
+}
+
+func TestCopyAndPaste(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newPasteEditor()
+	ccp := NewCutCopyPaste(false)
+
+	// ctrl-c copies the trimmed line
+	if s := ccp.Copy(e); s != "one" || ccp.entry.block {
+		t.Errorf("expected the trimmed line to be copied, got %q", s)
+	}
+	// ctrl-c on the same line copies the block
+	if s := ccp.Copy(e); s != "  one\n  two\n" || !ccp.entry.block {
+		t.Errorf("expected the block to be copied, got %q", s)
+	}
+	// ctrl-v on a line with text pastes all the lines below it
+	e.GoTo(3, c, nil)
+	if pasted, remaining := ccp.Paste(e, c, nil, false); pasted != 2 || remaining != 0 {
+		t.Errorf("expected 2 lines to be pasted at once, got %d and %d left", pasted, remaining)
+	}
+	if s := e.String(); s != "  one\n  two\n\nthree\n  one\n  two\nfour\n" {
+		t.Errorf("expected the lines to be pasted below the current line, got %q", s)
+	}
+	if y := e.DataY(); y != 5 {
+		t.Errorf("expected the cursor to be at the last pasted line, got %d", y)
+	}
+	// ctrl-v again pastes all the lines again
+	ccp.Paste(e, c, nil, false)
+	if s := e.String(); s != "  one\n  two\n\nthree\n  one\n  two\n  one\n  two\nfour\n" {
+		t.Errorf("expected the lines to be pasted again, got %q", s)
+	}
+
+	// Copying a single line after a block replaces the block, so that only that line is pasted
+	e = newPasteEditor()
+	ccp.Reset()
+	ccp.Copy(e)
+	ccp.Copy(e)
+	e.GoTo(3, c, nil)
+	ccp.Copy(e)
+	e.GoTo(2, c, nil)
+	if pasted, _ := ccp.Paste(e, c, nil, false); pasted != 1 {
+		t.Errorf("expected a single line to be pasted, got %d lines", pasted)
+	}
+	if s := e.String(); s != "  one\n  two\nthree\nthree\nfour\n" {
+		t.Errorf("expected the single line to be pasted in the blank line, got %q", s)
+	}
+
+	// After a reset, ctrl-c copies a single line again
+	e = newPasteEditor()
+	ccp.Copy(e)
+	ccp.Reset()
+	if s := ccp.Copy(e); s != "one" {
+		t.Errorf("expected a single line to be copied after a reset, got %q", s)
+	}
+	// Nothing is copied from a blank line
+	e.GoTo(2, c, nil)
+	if s := ccp.Copy(e); s != "" || ccp.entry.String() != "one" {
+		t.Errorf("expected nothing to be copied from a blank line, got %q", s)
+	}
+}
+
+func TestCutAndPaste(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newPasteEditor()
+	ccp := NewCutCopyPaste(false)
+
+	// ctrl-x cuts the line, untrimmed
+	if s := ccp.Cut(e, nil); s != "  one" || e.String() != "  two\n\nthree\nfour\n" {
+		t.Errorf("expected the first line to be cut, got %q and %q", s, e.String())
+	}
+	// ctrl-x on the same line cuts the rest of the block, and the blank line after it
+	if s := ccp.Cut(e, nil); s != "  one\n  two\n" || e.String() != "three\nfour\n" {
+		t.Errorf("expected the rest of the block to be cut, got %q and %q", s, e.String())
+	}
+	// ctrl-v pastes all the lines that were cut, at once
+	e.GoTo(1, c, nil)
+	if pasted, remaining := ccp.Paste(e, c, nil, false); pasted != 2 || remaining != 0 {
+		t.Errorf("expected all the cut lines to be pasted, got %d and %d left", pasted, remaining)
+	}
+	if s := e.String(); s != "three\nfour\n  one\n  two\n" {
+		t.Errorf("expected the lines to be pasted below the last line, got %q", s)
+	}
+	if hint := ccp.PasteHint(); hint != "ctrl-v pastes 2 lines" {
+		t.Errorf("expected a hint about pasting 2 lines, got %q", hint)
+	}
+
+	// ctrl-x on a blank line removes it, but keeps the clipboard contents
+	e = newPasteEditor()
+	e.GoTo(2, c, nil)
+	if s := ccp.Cut(e, nil); s != "" || e.String() != "  one\n  two\nthree\nfour\n" {
+		t.Errorf("expected the blank line to be removed, got %q", e.String())
+	}
+	if ccp.entry.String() != "  one\n  two\n" {
+		t.Errorf("expected the clipboard to be kept, got %q", ccp.entry.String())
+	}
+}
+
+func TestSplitPaste(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newPasteEditor()
+	ccp := NewCutCopyPaste(true)
+	ccp.Copy(e)
+	ccp.Copy(e)
+	if hint := ccp.PasteHint(); hint != "ctrl-v pastes 1 line, then 1 line" {
+		t.Errorf("expected a hint about pasting in two steps, got %q", hint)
+	}
+
+	// The first ctrl-v pastes the trimmed first line, and the second one the rest, untrimmed
+	e.GoTo(2, c, nil)
+	if pasted, remaining := ccp.Paste(e, c, nil, false); pasted != 1 || remaining != 1 {
+		t.Errorf("expected 1 line to be pasted, with 1 left, got %d and %d", pasted, remaining)
+	}
+	if s := e.Line(2); s != "one" {
+		t.Errorf("expected the trimmed first line, got %q", s)
+	}
+	if pasted, remaining := ccp.Paste(e, c, nil, false); pasted != 1 || remaining != 0 {
+		t.Errorf("expected the rest to be pasted, got %d and %d left", pasted, remaining)
+	}
+	if s := e.String(); s != "  one\n  two\n  one\n  two\nthree\nfour\n" {
+		t.Errorf("expected the untrimmed lines to be pasted, got %q", s)
+	}
+
+	// Pressing return between the two ctrl-v presses pastes the rest at the new line
+	e = newPasteEditor()
+	ccp.Reset()
+	e.GoTo(2, c, nil)
+	ccp.Paste(e, c, nil, false)
+	ccp.NewLinePressed(false)
+	e.InsertLineBelow()
+	e.GoTo(3, c, nil)
+	if pasted, _ := ccp.Paste(e, c, nil, true); pasted != 1 {
+		t.Errorf("expected the rest to be pasted after return, got %d lines", pasted)
+	}
+	if s := e.String(); s != "  one\n  two\none\n  two\nthree\nfour\n" {
+		t.Errorf("expected the rest to be pasted at the new line, got %q", s)
+	}
+
+	// Single lines are always pasted at once
+	ccp.Reset()
+	ccp.Copy(e)
+	if pasted, remaining := ccp.Paste(e, c, nil, false); pasted != 1 || remaining != 0 {
+		t.Errorf("expected a single line to be pasted at once, got %d and %d left", pasted, remaining)
+	}
+}
+
+func TestClipboardText(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newPasteEditor()
+	ccp := NewCutCopyPaste(false)
+	ccp.Copy(e)
+	ccp.Copy(e)
+
+	// The same text from the system clipboard keeps the entry
+	ccp.UseText("  one\n  two\n")
+	if !ccp.entry.block {
+		t.Error("expected the entry to be kept when the system clipboard has the same text")
+	}
+	// Other text replaces it, where a final newline does not count as a line
+	ccp.UseText("a\nb\n")
+	if ccp.entry.block || len(ccp.entry.lines) != 2 {
+		t.Errorf("expected a new entry with two lines, got %v", ccp.entry)
+	}
+
+	// Text from a selection is pasted at the cursor, as it is
+	ccp.SetSelection("X\nY")
+	e.GoTo(3, c, nil)
+	e.Home()
+	ccp.Paste(e, c, nil, false)
+	if s := e.String(); s != "  one\n  two\n\nX\nYthree\nfour\n" {
+		t.Errorf("expected the selection to be pasted at the cursor, got %q", s)
+	}
+}
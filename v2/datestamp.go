@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/xyproto/env"
+)
+
+// dateFormat is the layout that is used when inserting the current date, in the format used by the time package.
+// The default is the ISO 8601 date, like 2006-01-02, but it can be changed with the O_DATE_FORMAT environment variable.
+var dateFormat = env.Str("O_DATE_FORMAT", "2006-01-02")
+
+// dateString returns the given time as a date, formatted with dateFormat
+func dateString(t time.Time) string {
+	return t.Format(dateFormat)
+}
+
+// timestampString returns the given time as an RFC 3339 timestamp, like 2006-01-02T15:04:05+07:00
+func timestampString(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// newUUID returns a randomly generated version 4 UUID, like 0b6e1f4e-9a2c-4d6b-8f3e-2c1a5b7d9e0f
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDateStrings(t *testing.T) {
+	when := time.Date(2023, time.March, 4, 5, 6, 7, 0, time.UTC)
+	if s := dateString(when); s != "2023-03-04" {
+		t.Errorf("expected an ISO 8601 date, got %q", s)
+	}
+	if s := timestampString(when); s != "2023-03-04T05:06:07Z" {
+		t.Errorf("expected an RFC 3339 timestamp, got %q", s)
+	}
+	previous := dateFormat
+	t.Cleanup(func() { dateFormat = previous })
+	dateFormat = "02.01.2006"
+	if s := dateString(when); s != "04.03.2023" {
+		t.Errorf("expected the date format to be used, got %q", s)
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	uuidRegexp := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, err := newUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newUUID()
+	if !uuidRegexp.MatchString(a) || !uuidRegexp.MatchString(b) {
+		t.Errorf("expected version 4 UUIDs, got %q and %q", a, b)
+	}
+	if a == b {
+		t.Error("expected two different UUIDs")
+	}
+}
@@ -812,25 +812,20 @@ func (e *Editor) DrawFlags(c *vt100.Canvas, repositionCursor bool) {
 
 	const title = "Changed flags:"
 
-	lastWidthIndex := int(c.W() - 1)
-	lastHeightIndex := int(c.H() - 1)
-
 	// Length of all flags, joined with a "|" in between
 	textLength := len(title + " " + strings.Join(changedFlags, "|"))
 
-	// The left side margin, if the text is adjusted to the right
-	x := uint(lastWidthIndex - textLength)
-
-	// The bottom line
-	y := uint(lastHeightIndex)
+	// A box on the bottom line, adjusted to the right. If the canvas is too narrow, the left side is cut.
+	flagsBox := &Box{int(c.W()) - 1 - textLength, int(c.H()) - 1, textLength, 1}
+	x, y := flagsBox.X, flagsBox.Y
 
 	// Title colors
 	fg := e.StatusForeground
 	bg := e.DebugOutputBackground
 
 	// Draw the title
-	c.Write(x, y, fg, bg, title+" ")
-	x += uint(len(title)) + 1
+	writeClipped(c, flagsBox, x, y, fg, bg, title+" ")
+	x += len(title) + 1
 
 	// Flag colors
 	fg = e.StatusErrorForeground
@@ -838,11 +833,11 @@ func (e *Editor) DrawFlags(c *vt100.Canvas, repositionCursor bool) {
 
 	for i, flag := range changedFlags {
 		if i > 0 {
-			c.Write(x, y, e.DebugInstructionsForeground, bg, "|")
+			writeClipped(c, flagsBox, x, y, e.DebugInstructionsForeground, bg, "|")
 			x++
 		}
-		c.Write(x, y, fg, bg, flag)
-		x += uint(len(flag))
+		writeClipped(c, flagsBox, x, y, fg, bg, flag)
+		x += len(flag)
 	}
 
 	// Blit
@@ -1033,7 +1028,7 @@ func (e *Editor) DrawInstructions(c *vt100.Canvas, repositionCursor bool) error
 			if longInstructionPaneWidth > 0 {
 				centerBox.X = 0
 				centerBox.W = longInstructionPaneWidth
-			} else if w := int(c.W() - 1); (centerBox.X + centerBox.W) >= w {
+			} else if w := int(c.W()); (centerBox.X + centerBox.W) > w {
 				centerBox.X = 0
 				centerBox.W = w
 				longInstructionPaneWidth = w
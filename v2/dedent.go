@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// openingBrackets are the opening brackets for the closing brackets that are dedented when typed
+var openingBrackets = map[rune]rune{
+	'}': '{',
+	']': '[',
+	')': '(',
+}
+
+// pythonClauses are the keywords that are dedented when typed at the start of a line in Python,
+// together with the keywords of the statements that they can continue
+var pythonClauses = map[string][]string{
+	"else":    {"if", "elif", "for", "while", "try", "except"},
+	"elif":    {"if", "elif"},
+	"except":  {"try", "except"},
+	"finally": {"try", "except", "else"},
+}
+
+// openBracket is a bracket that has not been closed yet, and the line it is on
+type openBracket struct {
+	r rune
+	y LineIndex
+}
+
+// newQuoteState returns a QuoteState for the current mode, for telling strings and comments apart from code
+func (e *Editor) newQuoteState() (*QuoteState, error) {
+	ignoreSingleQuotes := e.mode == mode.Lisp || e.mode == mode.Clojure
+	return NewQuoteState(e.SingleLineCommentMarker(), e.mode, ignoreSingleQuotes)
+}
+
+// processLineQuoteState processes one line with the given QuoteState, and calls the given function for each rune
+// that is not in a string or a comment. Only multi-line comments and backtick strings continue on the next line.
+func processLineQuoteState(q *QuoteState, runes []rune, f func(x int, r rune)) {
+	q.hasSingleLineComment = false
+	q.startedMultiLineString = false
+	q.stoppedMultiLineComment = false
+	q.containsMultiLineComments = false
+	q.singleQuote = 0
+	q.doubleQuote = 0
+	prevRune, prevPrevRune := '\n', '\n'
+	for x, r := range runes {
+		q.ProcessRune(r, prevRune, prevPrevRune)
+		if q.None() && f != nil {
+			f(x, r)
+		}
+		prevPrevRune, prevRune = prevRune, r
+	}
+}
+
+// openBracketsBefore returns the brackets that are still open at the start of the given line, ignoring the brackets
+// in strings and comments. Returns false if the line starts within a multi-line comment or string.
+func (e *Editor) openBracketsBefore(y LineIndex) ([]openBracket, bool) {
+	q, err := e.newQuoteState()
+	if err != nil {
+		return nil, false
+	}
+	var stack []openBracket
+	for i := LineIndex(0); i < y; i++ {
+		runes, _ := e.lineRunes(int(i))
+		lineIndex := i
+		processLineQuoteState(q, runes, func(_ int, r rune) {
+			switch r {
+			case '{', '[', '(':
+				stack = append(stack, openBracket{r, lineIndex})
+			case '}', ']', ')':
+				// Pop the matching bracket, and any unclosed brackets of other kinds above it
+				for j := len(stack) - 1; j >= 0; j-- {
+					if stack[j].r == openingBrackets[r] {
+						stack = stack[:j]
+						break
+					}
+				}
+			}
+		})
+	}
+	q.hasSingleLineComment = false
+	return stack, q.None()
+}
+
+// indentationWidth returns the width of the given leading whitespace, where a tab is PerTab wide
+func (e *Editor) indentationWidth(whitespace string) int {
+	return len(strings.ReplaceAll(whitespace, "\t", strings.Repeat(" ", e.indentation.PerTab)))
+}
+
+// setLeadingWhitespace replaces the leading whitespace on the current line, and keeps the cursor at the same text
+func (e *Editor) setLeadingWhitespace(c *vt100.Canvas, whitespace string) {
+	y := e.DataY()
+	oldWhitespace := e.LeadingWhitespace()
+	runes, _ := e.lineRunes(int(y))
+	x, err := e.DataX()
+	if err != nil {
+		x = len(runes)
+	}
+	e.SetLine(y, whitespace+strings.TrimLeft(string(runes), " \t"))
+	e.GoToDataX(c, x-len([]rune(oldWhitespace))+len([]rune(whitespace)))
+	e.redraw = true
+}
+
+// ClosingBracketIndentation returns the leading whitespace of the line with the opening bracket for the given
+// closing bracket, when typed on the current line. Returns false if the current line is in a string or a comment,
+// or if there is no opening bracket.
+func (e *Editor) ClosingBracketIndentation(r rune) (string, bool) {
+	opening, ok := openingBrackets[r]
+	if !ok {
+		return "", false
+	}
+	stack, ok := e.openBracketsBefore(e.DataY())
+	if !ok {
+		return "", false
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].r == opening {
+			return e.LeadingWhitespaceAt(stack[i].y), true
+		}
+	}
+	return "", false
+}
+
+// PythonClauseIndentation returns the leading whitespace of the statement that the clause on the current line,
+// like "else:" or "except ValueError:", continues. Returns false if the line is not such a clause,
+// or if the statement could not be found.
+func (e *Editor) PythonClauseIndentation() (string, bool) {
+	// Trailing whitespace is kept, to tell "elif " from "elif"
+	trimmedLine := strings.TrimLeft(e.CurrentLine(), " \t")
+	keyword := strings.FieldsFunc(trimmedLine, func(r rune) bool { return r == ' ' || r == ':' || r == '(' })
+	if len(keyword) == 0 {
+		return "", false
+	}
+	statements, ok := pythonClauses[keyword[0]]
+	if !ok {
+		return "", false
+	}
+	// Only when the line looks complete, like "else:", "elif " or "except ValueError:"
+	if keyword[0] == "elif" {
+		if !strings.HasPrefix(trimmedLine, "elif ") {
+			return "", false
+		}
+	} else if !strings.HasSuffix(trimmedLine, ":") {
+		return "", false
+	}
+	y := e.DataY()
+	if _, ok := e.openBracketsBefore(y); !ok {
+		return "", false
+	}
+	// Look at the enclosing lines, each one less indented than the previous one
+	width := e.indentationWidth(e.LeadingWhitespace())
+	for i := y - 1; i >= 0 && width > 0; i-- {
+		trimmed := strings.TrimSpace(e.Line(i))
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		whitespace := e.LeadingWhitespaceAt(i)
+		w := e.indentationWidth(whitespace)
+		if w >= width {
+			continue
+		}
+		for _, statement := range statements {
+			if strings.HasPrefix(trimmed, statement+" ") || strings.HasPrefix(trimmed, statement+":") {
+				return whitespace, true
+			}
+		}
+		width = w
+	}
+	return "", false
+}
+
+// DedentClosingBracket dedents the current line to match the line with the opening bracket, if a closing bracket
+// is typed on an otherwise empty line. Returns false if there was nothing to dedent to.
+func (e *Editor) DedentClosingBracket(c *vt100.Canvas, r rune) bool {
+	if e.TrimmedLine() != "" {
+		return false
+	}
+	whitespace, ok := e.ClosingBracketIndentation(r)
+	if !ok {
+		return false
+	}
+	e.setLeadingWhitespace(c, whitespace)
+	return true
+}
+
+// DedentPythonClause dedents the current line to match the "if" or "try" statement, after "else:", "elif ",
+// "except:" or "finally:" has been typed. Returns false if the line was not changed.
+func (e *Editor) DedentPythonClause(c *vt100.Canvas) bool {
+	if e.mode != mode.Python {
+		return false
+	}
+	whitespace, ok := e.PythonClauseIndentation()
+	if !ok || whitespace == e.LeadingWhitespace() {
+		return false
+	}
+	e.setLeadingWhitespace(c, whitespace)
+	return true
+}
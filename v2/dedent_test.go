@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestDedentClosingBracket(t *testing.T) {
+	discardStdout(t)
+	tests := []struct {
+		contents string
+		line     string // the line that the bracket is typed on, after the contents
+		r        rune
+		want     string
+		changed  bool
+	}{
+		// Dedent to the line with the opening brace, also with several levels of indentation to remove
+		{"func main() {\n\tif x {\n\t\tf()", "\t\t", '}', "\t", true},
+		{"func main() {\n\tif x {\n\t\tf()\n\t}", "\t\t\t", '}', "", true},
+		{"x := []int{\n    1,\n    2,", "    ", '}', "", true},
+		{"f(a,\n  b,", "  ", ')', "", true},
+		// Brackets in strings and comments are ignored
+		{"func main() {\n\ts := \"{\" // {", "\t\t", '}', "", true},
+		// Within a multi-line comment or string, nothing happens
+		{"func main() {\n\t/* {", "\t\t", '}', "\t\t", false},
+		{"func main() {\n\ts := `", "\t\t", '}', "\t\t", false},
+		// Not on a line with other contents
+		{"func main() {", "\tf()", '}', "\tf()", false},
+	}
+	for _, test := range tests {
+		c := vt100.NewCanvas()
+		e := NewSimpleEditor(80)
+		e.mode = mode.Go
+		e.indentation.Spaces = false
+		e.LoadBytes([]byte(test.contents))
+		y := LineIndex(e.Len())
+		e.SetLine(y, test.line)
+		e.pos.sy = int(y)
+		e.GoToDataX(c, len([]rune(test.line)))
+		if changed := e.DedentClosingBracket(c, test.r); changed != test.changed || e.Line(y) != test.want {
+			t.Errorf("%q: expected %q (%v), got %q (%v)", test.contents, test.want, test.changed, e.Line(y), changed)
+		}
+	}
+}
+
+func TestDedentPythonClause(t *testing.T) {
+	discardStdout(t)
+	tests := []struct {
+		contents string
+		line     string // the line that is being typed, after the contents
+		want     string
+	}{
+		{"if x:\n    f()", "    else:", "else:"},
+		{"def f():\n    if x:\n        g()", "        elif ", "    elif "},
+		{"try:\n    f()\nexcept ValueError:\n    g()", "    finally:", "finally:"},
+		// The else of a for loop, in an if block
+		{"if x:\n    for y in z:\n        f(y)", "        else:", "    else:"},
+		// With tabs
+		{"try:\n\tf()", "\texcept:", "except:"},
+		// Not complete yet, or no matching statement
+		{"if x:\n    f()", "    elif", "    elif"},
+		{"def f():\n    g()", "    else:", "    else:"},
+	}
+	for _, test := range tests {
+		c := vt100.NewCanvas()
+		e := NewSimpleEditor(80)
+		e.mode = mode.Python
+		e.LoadBytes([]byte(test.contents))
+		y := LineIndex(e.Len())
+		e.SetLine(y, test.line)
+		e.pos.sy = int(y)
+		e.GoToDataX(c, len([]rune(test.line)))
+		e.DedentPythonClause(c)
+		if line := e.Line(y); line != test.want {
+			t.Errorf("%q: expected %q, got %q", test.line, test.want, line)
+		}
+	}
+}
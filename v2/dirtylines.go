@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// lineState is what is carried over from one drawn line to the next, like being within a multi-line comment.
+// If the state after a changed line is the same as the last time it was drawn, the lines below look the same.
+type lineState struct {
+	doubleQuote, backtick, singleQuote int
+	parCount, braCount                 int
+	multiLineComment, inCodeBlock      bool
+}
+
+// DirtyLines keeps track of which lines have been changed since all the lines were last drawn,
+// so that only those rows need to be sent to the terminal
+type DirtyLines struct {
+	mut      sync.Mutex
+	lines    map[LineIndex]bool      // the changed lines
+	all      bool                    // true if everything must be drawn, like when lines are inserted or deleted
+	drawn    bool                    // true if all the lines have been drawn at least once
+	states   map[LineIndex]lineState // the state after each drawn line
+	offsetX  int                     // the horizontal scroll offset when all the lines were last drawn
+	offsetY  int                     // the vertical scroll offset when all the lines were last drawn
+	w, h     uint                    // the canvas size when all the lines were last drawn
+	redrawOK bool                    // true if the state after each redrawn line was unchanged
+	changes  uint64                  // increased every time the contents are changed
+}
+
+// NewDirtyLines returns a new DirtyLines struct, where everything needs to be drawn
+func NewDirtyLines() *DirtyLines {
+	return &DirtyLines{lines: make(map[LineIndex]bool), states: make(map[LineIndex]lineState), all: true}
+}
+
+// Mark marks the given line as changed
+func (d *DirtyLines) Mark(y LineIndex) {
+	if d == nil {
+		return
+	}
+	d.mut.Lock()
+	d.lines[y] = true
+	d.changes++
+	d.mut.Unlock()
+}
+
+// MarkAll marks everything as changed, so that the next redraw draws all lines
+func (d *DirtyLines) MarkAll() {
+	if d == nil {
+		return
+	}
+	d.mut.Lock()
+	d.all = true
+	d.changes++
+	d.mut.Unlock()
+}
+
+// RedrawAll makes the next redraw draw all lines, for when the contents are the same but may look different
+func (d *DirtyLines) RedrawAll() {
+	if d == nil {
+		return
+	}
+	d.mut.Lock()
+	d.all = true
+	d.mut.Unlock()
+}
+
+// Generation returns a number that changes every time the contents are changed,
+// for knowing when values that are calculated from the contents must be calculated again
+func (d *DirtyLines) Generation() uint64 {
+	if d == nil {
+		return 0
+	}
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.changes
+}
+
+// reset is called when all the lines are about to be drawn, with the current scroll offsets and canvas size
+func (d *DirtyLines) reset(offsetX, offsetY int, w, h uint) {
+	if d == nil {
+		return
+	}
+	d.mut.Lock()
+	d.lines = make(map[LineIndex]bool)
+	d.states = make(map[LineIndex]lineState)
+	d.all = false
+	d.drawn = true
+	d.offsetX, d.offsetY = offsetX, offsetY
+	d.w, d.h = w, h
+	d.mut.Unlock()
+}
+
+// setState stores the state after the given line, as it was drawn. When a changed line is drawn on its own,
+// the state is compared with the state from the last time, instead.
+func (d *DirtyLines) setState(y LineIndex, state lineState, single bool) {
+	if d == nil {
+		return
+	}
+	d.mut.Lock()
+	if single {
+		if previous, ok := d.states[y]; !ok || previous != state {
+			d.redrawOK = false
+		}
+	}
+	d.states[y] = state
+	d.mut.Unlock()
+}
+
+// changedRows returns the changed lines that are visible, sorted, if only those lines need to be drawn.
+// Returns false if everything needs to be drawn.
+func (d *DirtyLines) changedRows(offsetX, offsetY int, w, h uint, cursorY LineIndex) ([]LineIndex, bool) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.all || !d.drawn || len(d.lines) == 0 || d.offsetX != offsetX || d.offsetY != offsetY || d.w != w || d.h != h {
+		return nil, false
+	}
+	d.lines[cursorY] = true
+	var ys []LineIndex
+	for y := range d.lines {
+		if y >= LineIndex(offsetY) && y < LineIndex(offsetY)+LineIndex(h) {
+			ys = append(ys, y)
+		}
+	}
+	sort.Slice(ys, func(i, j int) bool { return ys[i] < ys[j] })
+	return ys, true
+}
+
+// coloredCell is one cell on the canvas
+type coloredCell struct {
+	fg, bg vt100.AttributeColor // the background color has already been converted with .Background()
+	r      rune
+}
+
+// cellWriter writes to a canvas, and can also record what is written to one of the rows,
+// so that the row can be sent to the terminal on its own
+type cellWriter struct {
+	c     *vt100.Canvas
+	row   int // the row to record, or -1
+	cells []coloredCell
+}
+
+// newCellWriter returns a cellWriter that records the given row, or no row if the row is -1
+func newCellWriter(c *vt100.Canvas, row int) *cellWriter {
+	cw := &cellWriter{c: c, row: row}
+	if row >= 0 {
+		cw.cells = make([]coloredCell, c.W())
+		for i := range cw.cells {
+			cw.cells[i] = coloredCell{vt100.Default, vt100.DefaultBackground, ' '}
+		}
+	}
+	return cw
+}
+
+// record records a cell, if it is on the row that is recorded
+func (cw *cellWriter) record(x, y uint, fg, bgb vt100.AttributeColor, r rune) {
+	if int(y) == cw.row && x < uint(len(cw.cells)) {
+		cw.cells[x] = coloredCell{fg, bgb, r}
+	}
+}
+
+// Write writes a string to the canvas
+func (cw *cellWriter) Write(x, y uint, fg, bg vt100.AttributeColor, s string) {
+	cw.c.Write(x, y, fg, bg, s)
+	if int(y) == cw.row {
+		bgb := bg.Background()
+		for _, r := range s {
+			cw.record(x, y, fg, bgb, r)
+			x++
+		}
+	}
+}
+
+// WriteRune writes a rune to the canvas
+func (cw *cellWriter) WriteRune(x, y uint, fg, bg vt100.AttributeColor, r rune) {
+	cw.c.WriteRune(x, y, fg, bg, r)
+	cw.record(x, y, fg, bg.Background(), r)
+}
+
+// WriteRuneB writes a rune to the canvas, where bg.Background() has already been called on the background color
+func (cw *cellWriter) WriteRuneB(x, y uint, fg, bgb vt100.AttributeColor, r rune) {
+	cw.c.WriteRuneB(x, y, fg, bgb, r)
+	cw.record(x, y, fg, bgb, r)
+}
+
+// WriteRunesB writes the same rune count times to the canvas, where bg.Background() has already been called
+// on the background color
+func (cw *cellWriter) WriteRunesB(x, y uint, fg, bgb vt100.AttributeColor, r rune, count uint) {
+	cw.c.WriteRunesB(x, y, fg, bgb, r, count)
+	for i := uint(0); i < count; i++ {
+		cw.record(x+i, y, fg, bgb, r)
+	}
+}
+
+// writeRow writes the VT100 commands for drawing the given cells at the given row to w.
+// The cursor position is saved and restored.
+func writeRow(w io.Writer, row uint, cells []coloredCell) {
+	var sb strings.Builder
+	// Save the cursor position and move to the start of the row
+	fmt.Fprintf(&sb, "\0337\033[%d;1H", row+1)
+	for i, cell := range cells {
+		if i == 0 || !cell.fg.Equal(cells[i-1].fg) || !cell.bg.Equal(cells[i-1].bg) {
+			sb.WriteString(cell.fg.Combine(cell.bg).String())
+		}
+		sb.WriteRune(cell.r)
+	}
+	// Reset the colors and restore the cursor position
+	sb.WriteString(vt100.NoColor() + "\0338")
+	io.WriteString(w, sb.String())
+}
+
+// DrawChangedLines draws only the lines that have been changed, and the line with the cursor,
+// if nothing else needs to be drawn. The rows are sent directly to the terminal, instead of the whole canvas.
+// Returns false if all the lines need to be drawn instead.
+func (e *Editor) DrawChangedLines(c *vt100.Canvas) bool {
+	return e.drawChangedLines(c, os.Stdout)
+}
+
+// drawChangedLines draws the changed lines on the canvas and writes the rows to w.
+// Returns false if all the lines need to be drawn instead.
+func (e *Editor) drawChangedLines(c *vt100.Canvas, w io.Writer) bool {
+	if e.dirty == nil || e.showRuler || e.showCrosshair || e.markMixedIndent || highlightCurrentLine || e.Selecting() || e.debugMode {
+		return false
+	}
+	// Man pages and Markdown list items are highlighted depending on the lines above them in the viewport
+	switch e.mode {
+	case mode.ManPage, mode.Doc, mode.Markdown, mode.ReStructured:
+		return false
+	}
+	offsetY := e.pos.OffsetY()
+	ys, ok := e.dirty.changedRows(e.pos.offsetX, offsetY, c.W(), c.H(), e.DataY())
+	if !ok {
+		return false
+	}
+	rows := make([][]coloredCell, len(ys))
+	e.dirty.mut.Lock()
+	e.dirty.redrawOK = true
+	e.dirty.mut.Unlock()
+	for i, y := range ys {
+		row := uint(int(y) - offsetY)
+		out := newCellWriter(c, int(row))
+		e.writeLines(out, y, y+1, 0, row, highlightTimeBudget)
+		rows[i] = out.cells
+	}
+	e.dirty.mut.Lock()
+	redrawOK := e.dirty.redrawOK
+	e.dirty.mut.Unlock()
+	if !redrawOK {
+		// The lines below may look different now, like when a multi-line comment was started
+		return false
+	}
+	for i, y := range ys {
+		writeRow(w, uint(int(y)-offsetY), rows[i])
+	}
+	e.dirty.mut.Lock()
+	e.dirty.lines = make(map[LineIndex]bool)
+	e.dirty.mut.Unlock()
+	return true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// newDrawnGoEditor returns an editor with some Go code, where all the lines have been drawn once
+func newDrawnGoEditor(c *vt100.Canvas) *Editor {
+	e := NewSimpleEditor(0)
+	e.mode = mode.Go
+	e.syntaxHighlight = true
+	e.LoadBytes([]byte(strings.Repeat("func main() {\n\tfmt.Println(\"hi\")\n}\n", 20)))
+	e.WriteLines(c, 0, LineIndex(c.H()), 0, 0)
+	return e
+}
+
+func TestDrawChangedLines(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newDrawnGoEditor(c)
+	var buf bytes.Buffer
+	if e.drawChangedLines(c, &buf) {
+		t.Fatal("expected nothing to be drawn when no lines have been changed")
+	}
+	e.SetLine(1, "\tfmt.Println(\"hello\")")
+	if !e.drawChangedLines(c, &buf) {
+		t.Fatal("expected only the changed line to be drawn")
+	}
+	if !strings.Contains(buf.String(), "hello") {
+		t.Error("expected the changed line to be written")
+	}
+	if full := int(c.W() * c.H()); buf.Len() > full/2 {
+		t.Errorf("expected far less than a full screen to be written, got %d bytes", buf.Len())
+	}
+	if got := canvasLine(c, 1); !strings.Contains(got, "hello") {
+		t.Errorf("expected the canvas to be updated as well, got %q", got)
+	}
+}
+
+func TestDrawChangedLinesFallback(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := newDrawnGoEditor(c)
+	var buf bytes.Buffer
+
+	// Starting a multi-line comment changes how the lines below look
+	e.SetLine(1, "\t/* fmt.Println(\"hi\")")
+	if e.drawChangedLines(c, &buf) {
+		t.Error("expected all lines to be drawn after starting a multi-line comment")
+	}
+
+	// Scrolling moves all the lines
+	e = newDrawnGoEditor(c)
+	e.SetLine(1, "\tfmt.Println(\"hello\")")
+	e.pos.offsetY = 1
+	if e.drawChangedLines(c, &buf) {
+		t.Error("expected all lines to be drawn after scrolling")
+	}
+
+	// Deleting a line moves the lines below it
+	e = newDrawnGoEditor(c)
+	e.DeleteLine(1)
+	if e.drawChangedLines(c, &buf) {
+		t.Error("expected all lines to be drawn after deleting a line")
+	}
+	if buf.Len() != 0 {
+		t.Error("expected nothing to be written when falling back")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// diskCheckInterval is how often the file is checked for changes on disk, while the editor is running
+const diskCheckInterval = 2 * time.Second
+
+// DiskState is the modification time, size and permissions of a file, as it was when it was loaded or saved
+type DiskState struct {
+	modTime time.Time
+	size    int64
+	perm    os.FileMode
+}
+
+// statDiskState returns the current modification time, size and permissions of the given file, if it is a regular file
+func statDiskState(filename string) (DiskState, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return DiskState{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return DiskState{}, fmt.Errorf("not a regular file: %s", filename)
+	}
+	return DiskState{fi.ModTime(), fi.Size(), permissionBits(fi.Mode())}, nil
+}
+
+// Equal checks if two disk states are the same, where only changes to the contents are considered
+func (ds DiskState) Equal(other DiskState) bool {
+	return ds.modTime.Equal(other.modTime) && ds.size == other.size
+}
+
+// RecordDiskState remembers the modification time, size and permissions of the file, after it has been loaded or saved
+func (e *Editor) RecordDiskState() {
+	e.diskState, _ = statDiskState(e.filename)
+}
+
+// SaveTemporary saves the editor contents to another file, like a temporary file for formatting or exporting.
+// The editor keeps the filename and the state of the file on disk that it had before.
+func (e *Editor) SaveTemporary(c *vt100.Canvas, tty *vt100.TTY, tempFilename string) error {
+	oldFilename, oldDiskState := e.filename, e.diskState
+	err := func() error {
+		e.filename = tempFilename
+		return e.Save(c, tty)
+	}()
+	e.filename, e.diskState = oldFilename, oldDiskState
+	return err
+}
+
+// ChangedOnDisk checks if the file has been changed by another program since it was loaded or saved.
+// Files that were not loaded from disk, or that have been removed, are not considered to be changed.
+func (e *Editor) ChangedOnDisk() bool {
+	if e.diskState.modTime.IsZero() {
+		return false
+	}
+	current, err := statDiskState(e.filename)
+	return err == nil && !current.Equal(e.diskState)
+}
+
+// Reload loads the file from disk again, as one undo step, while keeping the cursor at the same position
+func (e *Editor) Reload(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) error {
+	undo.Snapshot(e)
+	pos := e.pos.Copy()
+	if _, err := e.Load(c, tty, FilenameOrData{filename: e.filename}); err != nil {
+		return err
+	}
+	// The file may have become shorter
+	if last := LineIndex(e.Len() - 1); pos.LineIndex() > last {
+		e.redraw, _ = e.GoTo(last, c, status)
+	} else {
+		e.GoToPosition(c, status, *pos)
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// diffLines compares two versions of a file, line by line, and returns the lines that differ, where the
+// lines that are only in the old version start with "- " and the lines that are only in the new version
+// start with "+ ". The lines that are the same at the start and at the end are left out.
+// If the lines only differ in indentation or trailing whitespace, the new lines start with "~ " instead,
+// or nothing is returned if hideWhitespace is true.
+func diffLines(oldLines, newLines []string, hideWhitespace bool) []string {
+	start := 0
+	for start < len(oldLines) && start < len(newLines) && oldLines[start] == newLines[start] {
+		start++
+	}
+	oldEnd, newEnd := len(oldLines), len(newLines)
+	for oldEnd > start && newEnd > start && oldLines[oldEnd-1] == newLines[newEnd-1] {
+		oldEnd--
+		newEnd--
+	}
+	if start == oldEnd && start == newEnd {
+		return nil
+	}
+	if whitespaceOnlyChange(oldLines[start:oldEnd], newLines[start:newEnd]) {
+		if hideWhitespace {
+			return nil
+		}
+		diff := []string{fmt.Sprintf("@@ line %d, whitespace only @@", start+1)}
+		for _, line := range newLines[start:newEnd] {
+			diff = append(diff, "~ "+line)
+		}
+		return diff
+	}
+	diff := []string{fmt.Sprintf("@@ line %d @@", start+1)}
+	for _, line := range oldLines[start:oldEnd] {
+		diff = append(diff, "- "+line)
+	}
+	for _, line := range newLines[start:newEnd] {
+		diff = append(diff, "+ "+line)
+	}
+	return diff
+}
+
+// whitespaceOnlyChange checks if the old and the new lines are the same, except for leading and trailing whitespace,
+// like when tabs are replaced with spaces, or trailing spaces are removed when saving
+func whitespaceOnlyChange(oldLines, newLines []string) bool {
+	if len(oldLines) != len(newLines) {
+		return false
+	}
+	for i, line := range oldLines {
+		if strings.TrimSpace(line) != strings.TrimSpace(newLines[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShowDiskDiff shows the lines that differ between the file on disk and the editor contents, in an overlay.
+// Changes to only indentation or trailing whitespace are dimmed, or left out if hideWhitespace is true.
+func (e *Editor) ShowDiskDiff(c *vt100.Canvas, tty *vt100.TTY, hideWhitespace bool) error {
+	data, err := os.ReadFile(e.filename)
+	if err != nil {
+		return err
+	}
+	onDisk := strings.Split(strings.TrimSuffix(string(e.textFormat.Decode(data)), "\n"), "\n")
+	inEditor := strings.Split(strings.TrimSuffix(e.String(), "\n"), "\n")
+	diff := diffLines(onDisk, inEditor, hideWhitespace)
+	if len(diff) == 0 {
+		diff = []string{"The contents are the same"}
+		if hideWhitespace {
+			diff = []string{"The contents are the same, except for whitespace"}
+		}
+	}
+	title := fmt.Sprintf("- on disk, + in the editor (%s)", e.filename)
+	e.ListOverlay(c, tty, title, len(diff), 0, func(bt *BoxTheme, index, x, y, w int, selected bool) {
+		textColor := *bt.Text
+		if strings.HasPrefix(diff[index], "~ ") {
+			textColor = e.CommentColor
+		}
+		if selected {
+			textColor = *bt.Highlight
+		}
+		line := fitString(strings.ReplaceAll(diff[index], "\t", "    "), w)
+		line += strings.Repeat(" ", w-utf8.RuneCountInString(line))
+		c.Write(uint(x), uint(y), textColor, *bt.Background, line)
+	})
+	e.redraw = true
+	return nil
+}
+
+// ConfirmSaveIfChangedOnDisk asks what to do if the file has been changed on disk since it was loaded or saved.
+// The file can be reloaded, overwritten or compared with the editor contents first, with or without whitespace changes.
+// Returns true if the file should be saved.
+func (e *Editor) ConfirmSaveIfChangedOnDisk(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) bool {
+	for e.ChangedOnDisk() {
+		answer, ok := e.UserInput(c, tty, status, e.filename+" was changed on disk. Reload, overwrite, diff or diff without whitespace changes? (r/o/d/w)", []string{"r", "o", "d", "w"}, false)
+		switch answer = strings.ToLower(strings.TrimSpace(answer)); {
+		case ok && answer == "r":
+			if err := e.Reload(c, tty, status, undo); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+			} else {
+				status.SetMessageAfterRedraw("Reloaded " + e.filename)
+			}
+			return false
+		case ok && answer == "o":
+			return true
+		case ok && (answer == "d" || answer == "w"):
+			if err := e.ShowDiskDiff(c, tty, answer == "w"); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				return false
+			}
+		default:
+			status.Clear(c)
+			status.SetMessage("Not saved")
+			status.Show(c, e)
+			return false
+		}
+	}
+	return true
+}
+
+// WatchDisk checks if the file has been changed on disk by another program, while the editor is running,
+// and tells the user once per change. It should be run in a goroutine, and never returns.
+// The checks are done by the key loop, between keypresses.
+func (e *Editor) WatchDisk(c *vt100.Canvas, status *StatusBar) {
+	var notified DiskState
+	for range time.Tick(diskCheckInterval) {
+		runInKeyLoop(func() {
+			e.notifyIfChangedOnDisk(c, status, &notified)
+		})
+	}
+}
+
+// notifyIfChangedOnDisk tells the user if the file has been changed on disk, unless the user has already been
+// told about this change, which is then stored in notified. It must only be called by the key loop.
+func (e *Editor) notifyIfChangedOnDisk(c *vt100.Canvas, status *StatusBar, notified *DiskState) {
+	if !e.ChangedOnDisk() {
+		return
+	}
+	current, err := statDiskState(e.filename)
+	if err != nil || current.Equal(*notified) {
+		return
+	}
+	*notified = current
+	status.SetErrorMessage(e.filename + " was changed on disk (reload from the ctrl-o menu)")
+	status.ShowNoTimeout(c, e)
+}
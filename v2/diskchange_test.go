@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestChangedOnDisk(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(filename, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	if e.ChangedOnDisk() {
+		t.Fatal("expected the file to be unchanged right after loading it")
+	}
+
+	// Another program changes the file, with the same size
+	if err := os.WriteFile(filename, []byte("one\ntwo\nthrice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !e.ChangedOnDisk() {
+		t.Fatal("expected the file to be changed on disk")
+	}
+
+	// Saving records the new state
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e.ChangedOnDisk() {
+		t.Error("expected the file to be unchanged after saving it")
+	}
+
+	// Saving a temporary copy, like when formatting, does not change the recorded state
+	if err := e.SaveTemporary(nil, nil, filepath.Join(t.TempDir(), "copy.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != filename || e.ChangedOnDisk() {
+		t.Errorf("expected the state of %s to be kept after saving a temporary copy, got %s", filename, e.filename)
+	}
+
+	// Undoing a change does not restore the state from before the last save
+	undo := NewUndo(10, 0)
+	undo.Snapshot(e)
+	e.SetLine(0, "changed")
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := undo.Undo(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ChangedOnDisk() {
+		t.Error("expected the state of the last save to be kept after undoing")
+	}
+
+	// Data that was not loaded from a file is never changed on disk
+	e = NewSimpleEditor(80)
+	e.filename = filename
+	e.LoadBytes([]byte("hello\n"))
+	if e.ChangedOnDisk() {
+		t.Error("did not expect data that was not loaded from disk to be changed on disk")
+	}
+}
+
+func TestReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("line\n", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	c := vt100.NewCanvas()
+	status := testStatusBar(e)
+	undo := NewUndo(10, 0)
+	e.GoTo(5, c, status)
+	e.SetLine(0, "changed in the editor")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("new line\n", 8)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(c, nil, status, undo); err != nil {
+		t.Fatal(err)
+	}
+	if e.Line(0) != "new line" || e.Len() != 8 || e.Changed() {
+		t.Errorf("expected the contents on disk, got %q and %d lines", e.Line(0), e.Len())
+	}
+	if y := e.DataY(); y != 5 {
+		t.Errorf("expected the cursor to stay at line index 5, got %d", y)
+	}
+	if err := undo.Undo(e); err != nil || e.Line(0) != "changed in the editor" {
+		t.Errorf("expected reloading to be undoable, got %q", e.Line(0))
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	if diff := diffLines([]string{"a", "b"}, []string{"a", "b"}, false); diff != nil {
+		t.Errorf("expected no differences, got %v", diff)
+	}
+	diff := diffLines([]string{"a", "b", "c", "d"}, []string{"a", "x", "y", "d"}, false)
+	expected := []string{"@@ line 2 @@", "- b", "- c", "+ x", "+ y"}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, diff)
+	}
+	diff = diffLines([]string{"a"}, []string{"a", "b"}, true)
+	if strings.Join(diff, "\n") != "@@ line 2 @@\n+ b" {
+		t.Errorf("expected an added line, got %v", diff)
+	}
+}
+
+func TestDiffLinesWhitespaceOnly(t *testing.T) {
+	// Tabs replaced with spaces
+	diff := diffLines([]string{"func f() {", "\treturn", "}"}, []string{"func f() {", "    return", "}"}, false)
+	if strings.Join(diff, "\n") != "@@ line 2, whitespace only @@\n~     return" {
+		t.Errorf("expected a whitespace only change, got %q", diff)
+	}
+	if diff := diffLines([]string{"a", "\tb"}, []string{"a", "    b"}, true); diff != nil {
+		t.Errorf("expected the whitespace only change to be hidden, got %q", diff)
+	}
+	// Trailing spaces removed
+	diff = diffLines([]string{"a  ", "b \t"}, []string{"a", "b"}, false)
+	if strings.Join(diff, "\n") != "@@ line 1, whitespace only @@\n~ a\n~ b" {
+		t.Errorf("expected a whitespace only change, got %q", diff)
+	}
+	if diff := diffLines([]string{"a  ", "b \t"}, []string{"a", "b"}, true); diff != nil {
+		t.Errorf("expected the whitespace only change to be hidden, got %q", diff)
+	}
+	// Whitespace and other changes in the same hunk are not hidden
+	diff = diffLines([]string{"\ta", "b"}, []string{"    a", "c"}, true)
+	expected := []string{"@@ line 1 @@", "- \ta", "- b", "+     a", "+ c"}
+	if strings.Join(diff, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, diff)
+	}
+}
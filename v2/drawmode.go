@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+// DrawMark is the first corner of a rectangle, when drawing ASCII diagrams
+type DrawMark struct {
+	x int
+	y LineIndex
+}
+
+// ToggleDrawMode toggles between text edit mode and ASCII draw mode
+func (e *Editor) ToggleDrawMode() {
+	e.drawMode = !e.drawMode
+	e.drawMark = nil
+}
+
+// drawLineRune returns the rune that should be drawn on top of the existing rune,
+// when drawing a horizontal or vertical line through it. Crossing lines and corners become '+'.
+func drawLineRune(existing rune, horizontal bool) rune {
+	switch existing {
+	case '+':
+		return '+'
+	case '-':
+		if horizontal {
+			return '-'
+		}
+		return '+'
+	case '|':
+		if horizontal {
+			return '+'
+		}
+		return '|'
+	}
+	if horizontal {
+		return '-'
+	}
+	return '|'
+}
+
+// padToDataX makes sure that the given line is at least long enough to have a rune at data position x,
+// by filling it up with spaces
+func (e *Editor) padToDataX(x int, y LineIndex) {
+	if line, _ := e.lineRunes(int(y)); x >= len(line) {
+		e.Set(x, y, ' ')
+	}
+}
+
+// DrawMove moves the cursor one step in the given direction, without being constrained by the line lengths.
+// The lines are extended with spaces as needed. If draw is true, a line is drawn from the current
+// position to the new position, using '-', '|' and '+'.
+func (e *Editor) DrawMove(c *vt100.Canvas, status *StatusBar, dx, dy int, draw bool) {
+	x, _ := e.DataX()
+	y := e.DataY()
+	newX, newY := x+dx, y+LineIndex(dy)
+	if newX < 0 || newY < 0 {
+		return
+	}
+	if draw {
+		horizontal := dy == 0
+		e.padToDataX(x, y)
+		e.Set(x, y, drawLineRune(e.Get(x, y), horizontal))
+		e.padToDataX(newX, newY)
+		e.Set(newX, newY, drawLineRune(e.Get(newX, newY), horizontal))
+		e.redraw = true
+	} else {
+		e.padToDataX(newX, newY)
+	}
+	if newY != y {
+		e.GoTo(newY, c, status)
+		e.redraw = true
+	}
+	e.GoToDataX(c, newX)
+	e.SaveX(true)
+	e.redrawCursor = true
+}
+
+// DrawRectangle draws a rectangle between the two given corners, including both corners
+func (e *Editor) DrawRectangle(x1 int, y1 LineIndex, x2 int, y2 LineIndex) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for y := y1; y <= y2; y++ {
+		e.padToDataX(x2, y)
+	}
+	for x := x1 + 1; x < x2; x++ {
+		e.Set(x, y1, drawLineRune(e.Get(x, y1), true))
+		e.Set(x, y2, drawLineRune(e.Get(x, y2), true))
+	}
+	for y := y1 + 1; y < y2; y++ {
+		e.Set(x1, y, drawLineRune(e.Get(x1, y), false))
+		e.Set(x2, y, drawLineRune(e.Get(x2, y), false))
+	}
+	e.Set(x1, y1, '+')
+	e.Set(x2, y1, '+')
+	e.Set(x1, y2, '+')
+	e.Set(x2, y2, '+')
+	e.redraw = true
+}
+
+// DrawRectangleCorner marks the first corner of a rectangle, or draws the rectangle if the first corner is already marked
+func (e *Editor) DrawRectangleCorner(c *vt100.Canvas, status *StatusBar) {
+	x, _ := e.DataX()
+	y := e.DataY()
+	if e.drawMark == nil {
+		e.drawMark = &DrawMark{x, y}
+		status.SetMessage("Marked the first corner, move to the opposite corner and press return")
+		status.Show(c, e)
+		return
+	}
+	e.DrawRectangle(e.drawMark.x, e.drawMark.y, x, y)
+	e.drawMark = nil
+	// The rectangle may have padded the current line, so place the cursor again
+	e.GoToDataX(c, x)
+	e.redrawCursor = true
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDrawMode(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.ToggleDrawMode()
+
+	// Draw a line to the right and then down, past the end of the document
+	for i := 0; i < 3; i++ {
+		e.DrawMove(nil, nil, 1, 0, true)
+	}
+	for i := 0; i < 2; i++ {
+		e.DrawMove(nil, nil, 0, 1, true)
+	}
+	expected := "---+\n   |\n   |\n"
+	if s := e.String(); s != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s)
+	}
+
+	// A rectangle that crosses the vertical line
+	e.DrawRectangle(2, 1, 5, 3)
+	expected = "---+\n  ++-+\n  || |\n  +--+\n"
+	if s := e.String(); s != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, s)
+	}
+}
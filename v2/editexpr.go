@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// editExpressionStart matches the start of an edit expression, like "s/", "%s/", "10,20s/" or "g/",
+// so that edit expressions can be told apart from the other commands in the command prompt
+var editExpressionStart = regexp.MustCompile(`^(%|[0-9.$]+(,[0-9.$]+)?)?([sg])([[:punct:]])`)
+
+var (
+	errBadRange      = errors.New("bad range")
+	errNoEditPattern = errors.New("no pattern given")
+)
+
+// EditExpression is a small sed-like expression, like "s/foo/bar/g" for replacing on the current line,
+// "%s/foo/bar/g" for replacing in the whole file, "10,20s/foo/bar/" for replacing in a range of lines
+// or "g/pattern/d" for deleting all lines that match
+type EditExpression struct {
+	from, to    string         // the start and end of the range, like "10", "." or "$", or empty for the default range
+	wholeFile   bool           // true if the range is "%"
+	command     byte           // 's' for substitute or 'g' for deleting matching lines
+	re          *regexp.Regexp // the pattern
+	replacement string         // the replacement, in the format used by regexp.Expand
+	global      bool           // replace all matches on each line, not only the first one
+}
+
+// EditResult is the outcome of applying an edit expression to a slice of lines
+type EditResult struct {
+	lines        []string // the resulting lines
+	deleted      []int    // the indexes of the deleted lines, in increasing order
+	matchCount   int      // the number of replaced matches
+	changedLines int      // the number of changed or deleted lines
+	firstChanged int      // the index of the first changed or deleted line, or -1
+}
+
+// isEditExpression checks if the given command looks like an edit expression
+func isEditExpression(s string) bool {
+	m := editExpressionStart.FindStringSubmatch(s)
+	return m != nil && m[4] != "\\"
+}
+
+// splitDelimited splits the given string on the delimiter, but not on delimiters that are escaped with a backslash.
+// Escaped delimiters are unescaped, while all other backslashes are kept.
+func splitDelimited(s string, delim rune) []string {
+	var (
+		parts   []string
+		sb      strings.Builder
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r != delim {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == delim:
+			parts = append(parts, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if escaped {
+		sb.WriteRune('\\')
+	}
+	return append(parts, sb.String())
+}
+
+// convertReplacement converts a sed-style replacement, where "&" is the whole match and "\1" is the first group,
+// to the format used by regexp.Expand
+func convertReplacement(s string) string {
+	var (
+		sb      strings.Builder
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped && r >= '0' && r <= '9':
+			sb.WriteString("${" + string(r) + "}")
+			escaped = false
+		case escaped && r == 't':
+			sb.WriteRune('\t')
+			escaped = false
+		case escaped:
+			// Like "\&" for a literal "&", or "\\" for a backslash
+			if r == '$' {
+				sb.WriteRune('$')
+			}
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '&':
+			sb.WriteString("${0}")
+		case r == '$':
+			sb.WriteString("$$")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if escaped {
+		sb.WriteRune('\\')
+	}
+	return sb.String()
+}
+
+// ParseEditExpression parses an edit expression, like "%s/foo/bar/g" or "g/^$/d".
+// The pattern is a Go regular expression. The "i" flag makes the pattern case-insensitive.
+func ParseEditExpression(s string) (*EditExpression, error) {
+	if !isEditExpression(s) {
+		return nil, fmt.Errorf("not an edit expression: %s", s)
+	}
+	m := editExpressionStart.FindStringSubmatch(s)
+	var ee EditExpression
+	rangePart := m[1]
+	if rangePart == "%" {
+		ee.wholeFile = true
+	} else if rangePart != "" {
+		ee.from = rangePart
+		ee.to = rangePart
+		if i := strings.Index(rangePart, ","); i >= 0 {
+			ee.from, ee.to = rangePart[:i], rangePart[i+1:]
+		}
+	}
+	ee.command = m[3][0]
+	delim := rune(m[4][0])
+	parts := splitDelimited(s[len(m[0]):], delim)
+
+	var pattern, flags string
+	switch ee.command {
+	case 's':
+		// s/pattern/replacement/flags, where the last delimiter may be left out
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("expected s%cpattern%creplacement%c", delim, delim, delim)
+		}
+		pattern = parts[0]
+		ee.replacement = convertReplacement(parts[1])
+		if len(parts) == 3 {
+			flags = parts[2]
+		}
+		for _, flag := range flags {
+			switch flag {
+			case 'g':
+				ee.global = true
+			case 'i':
+			default:
+				return nil, fmt.Errorf("unknown flag: %c", flag)
+			}
+		}
+	case 'g':
+		// g/pattern/d
+		if len(parts) != 2 || parts[1] != "d" {
+			return nil, fmt.Errorf("expected g%cpattern%cd", delim, delim)
+		}
+		pattern = parts[0]
+		if ee.from == "" {
+			ee.wholeFile = true
+		}
+	}
+	if pattern == "" {
+		return nil, errNoEditPattern
+	}
+	if strings.ContainsRune(flags, 'i') {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReplacementGroups(re, ee.replacement); err != nil {
+		return nil, err
+	}
+	ee.re = re
+	return &ee, nil
+}
+
+// parseLineAddress parses a 1-based line number, "." for the current line or "$" for the last line,
+// and returns a line index
+func parseLineAddress(s string, current, count int) (int, error) {
+	switch s {
+	case ".":
+		return current, nil
+	case "$":
+		return count - 1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > count {
+		return 0, errBadRange
+	}
+	return n - 1, nil
+}
+
+// LineRange returns the first and last line index that the expression applies to,
+// given the current line index and the number of lines
+func (ee *EditExpression) LineRange(current, count int) (int, int, error) {
+	if count == 0 {
+		return 0, 0, errBadRange
+	}
+	if ee.wholeFile {
+		return 0, count - 1, nil
+	}
+	if ee.from == "" {
+		return current, current, nil
+	}
+	from, err := parseLineAddress(ee.from, current, count)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseLineAddress(ee.to, current, count)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > to {
+		return 0, 0, errBadRange
+	}
+	return from, to, nil
+}
+
+// replaceFirst replaces the first match of re in s
+func replaceFirst(re *regexp.Regexp, s, template string) string {
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return s
+	}
+	return s[:loc[0]] + string(re.ExpandString(nil, template, s, loc)) + s[loc[1]:]
+}
+
+// Apply applies the expression to the given lines, without modifying them,
+// where current is the index of the line that the cursor is at
+func (ee *EditExpression) Apply(lines []string, current int) (*EditResult, error) {
+	from, to, err := ee.LineRange(current, len(lines))
+	if err != nil {
+		return nil, err
+	}
+	result := &EditResult{firstChanged: -1}
+	for i, line := range lines {
+		if i < from || i > to || !ee.re.MatchString(line) {
+			result.lines = append(result.lines, line)
+			continue
+		}
+		if result.firstChanged < 0 {
+			result.firstChanged = i
+		}
+		result.changedLines++
+		if ee.command == 'g' {
+			result.deleted = append(result.deleted, i)
+			continue
+		}
+		if ee.global {
+			result.matchCount += len(ee.re.FindAllStringIndex(line, -1))
+			line = ee.re.ReplaceAllString(line, ee.replacement)
+		} else {
+			result.matchCount++
+			line = replaceFirst(ee.re, line, ee.replacement)
+		}
+		result.lines = append(result.lines, line)
+	}
+	return result, nil
+}
+
+// ApplyEditExpression applies an edit expression to the editor contents, as one undo step.
+// If the range is invalid, an error is returned and nothing is changed.
+func (e *Editor) ApplyEditExpression(c *vt100.Canvas, status *StatusBar, undo *Undo, ee *EditExpression) error {
+	lines := make([]string, e.Len())
+	for i := range lines {
+		lines[i] = e.Line(LineIndex(i))
+	}
+	result, err := ee.Apply(lines, int(e.DataY()))
+	if err != nil {
+		return err
+	}
+	if result.changedLines == 0 {
+		status.SetMessageAfterRedraw("No matches")
+		return nil
+	}
+	undo.Snapshot(e)
+	if ee.command == 'g' {
+		// Delete the lines from the bottom up, so that the line indexes stay valid
+		for i := len(result.deleted) - 1; i >= 0; i-- {
+			e.DeleteLine(LineIndex(result.deleted[i]))
+		}
+		if len(result.deleted) == 1 {
+			status.SetMessageAfterRedraw("Deleted 1 line")
+		} else {
+			status.SetMessageAfterRedraw(fmt.Sprintf("Deleted %d lines", len(result.deleted)))
+		}
+	} else {
+		for i, line := range result.lines {
+			if line != lines[i] {
+				e.SetLine(LineIndex(i), line)
+			}
+		}
+		matches := "1 match"
+		if result.matchCount != 1 {
+			matches = fmt.Sprintf("%d matches", result.matchCount)
+		}
+		if result.changedLines == 1 {
+			status.SetMessageAfterRedraw(fmt.Sprintf("Replaced %s on 1 line", matches))
+		} else {
+			status.SetMessageAfterRedraw(fmt.Sprintf("Replaced %s on %d lines", matches, result.changedLines))
+		}
+	}
+	e.changed = true
+	// Go to the first changed line, or to the line after the first deleted line
+	y := result.firstChanged
+	if last := e.Len() - 1; y > last {
+		y = last
+	}
+	if y >= 0 {
+		e.GoTo(LineIndex(y), c, nil)
+		e.Home()
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
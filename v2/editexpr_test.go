@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsEditExpression(t *testing.T) {
+	for _, s := range []string{"s/a/b/", "%s/a/b/g", "10,20s/a/b/", ".,$s|a|b|", "g/^$/d", "s#a#b#"} {
+		if !isEditExpression(s) {
+			t.Errorf("expected %q to be an edit expression", s)
+		}
+	}
+	for _, s := range []string{"s", "sq", "save", "sort", "grep", "g", "s\\a\\b\\", "savequit", "ss"} {
+		if isEditExpression(s) {
+			t.Errorf("expected %q to not be an edit expression", s)
+		}
+	}
+}
+
+func TestParseEditExpressionErrors(t *testing.T) {
+	for _, s := range []string{"s/a", "s/a/b/c/d", "s/(/b/", "s//b/", "s/a/b/x", "g/a/x", "g/a/", "g//d"} {
+		if _, err := ParseEditExpression(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestApplyEditExpression(t *testing.T) {
+	lines := []string{"foo foo", "bar", "Foo", "", "foo bar"}
+	cases := []struct {
+		expression string
+		current    int
+		expected   string
+		matches    int
+		changed    int
+	}{
+		{"s/foo/x/", 0, "x foo|bar|Foo||foo bar", 1, 1},
+		{"s/foo/x/g", 0, "x x|bar|Foo||foo bar", 2, 1},
+		{"%s/foo/x/g", 0, "x x|bar|Foo||x bar", 3, 2},
+		{"%s/foo/x/gi", 0, "x x|bar|x||x bar", 4, 3},
+		{"2,3s/^/> /", 0, "foo foo|> bar|> Foo||foo bar", 2, 2},
+		{".,$s/bar/[&]/", 3, "foo foo|bar|Foo||foo [bar]", 1, 1},
+		{`%s/(\w+) (\w+)/\2 \1/`, 0, "foo foo|bar|Foo||bar foo", 2, 2},
+		{"%s/o/$1/", 2, "f$1o foo|bar|F$1o||f$1o bar", 3, 3},
+		{`s/foo/a\/b/`, 0, "a/b foo|bar|Foo||foo bar", 1, 1},
+		{"g/^$/d", 0, "foo foo|bar|Foo|foo bar", 0, 1},
+		{"g/foo/d", 0, "bar|Foo|", 0, 2},
+		{"1,2g/foo/d", 0, "bar|Foo||foo bar", 0, 1},
+		{"%s/nothing/x/", 0, "foo foo|bar|Foo||foo bar", 0, 0},
+	}
+	for _, c := range cases {
+		ee, err := ParseEditExpression(c.expression)
+		if err != nil {
+			t.Errorf("%s: %v", c.expression, err)
+			continue
+		}
+		result, err := ee.Apply(lines, c.current)
+		if err != nil {
+			t.Errorf("%s: %v", c.expression, err)
+			continue
+		}
+		if s := strings.Join(result.lines, "|"); s != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.expression, c.expected, s)
+		}
+		if result.matchCount != c.matches || result.changedLines != c.changed {
+			t.Errorf("%s: expected %d matches on %d lines, got %d on %d", c.expression, c.matches, c.changed, result.matchCount, result.changedLines)
+		}
+	}
+	if strings.Join(lines, "|") != "foo foo|bar|Foo||foo bar" {
+		t.Error("the given lines should not be modified")
+	}
+	for _, s := range []string{"0,2s/a/b/", "3,2s/a/b/", "1,9s/a/b/", "x,2s/a/b/"} {
+		ee, err := ParseEditExpression(s)
+		if err != nil {
+			continue
+		}
+		if _, err := ee.Apply(lines, 0); err != errBadRange {
+			t.Errorf("%s: expected a bad range error, got %v", s, err)
+		}
+	}
+}
+
+func TestEditorApplyEditExpression(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "one\n\ntwo\n\nthree")
+	undo := NewUndo(10, 0)
+	status := &StatusBar{}
+
+	// A bad range changes nothing
+	ee, err := ParseEditExpression("2,9s/o/0/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ApplyEditExpression(nil, status, undo, ee); err != errBadRange || e.String() != "one\n\ntwo\n\nthree\n" {
+		t.Fatalf("expected a bad range error and no changes, got %v and %q", err, e.String())
+	}
+
+	ee, err = ParseEditExpression("g/^$/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ApplyEditExpression(nil, status, undo, ee); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "one\ntwo\nthree\n" {
+		t.Errorf("unexpected contents after deleting blank lines: %q", s)
+	}
+	if status.messageAfterRedraw != "Deleted 2 lines" {
+		t.Errorf("unexpected message: %q", status.messageAfterRedraw)
+	}
+
+	ee, err = ParseEditExpression("%s/o/0/g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ApplyEditExpression(nil, status, undo, ee); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "0ne\ntw0\nthree\n" {
+		t.Errorf("unexpected contents after replacing: %q", s)
+	}
+	if status.messageAfterRedraw != "Replaced 2 matches on 2 lines" {
+		t.Errorf("unexpected message: %q", status.messageAfterRedraw)
+	}
+
+	// Each expression is one undo step
+	if err := undo.Undo(e); err != nil || e.String() != "one\ntwo\nthree\n" {
+		t.Errorf("expected the replacement to be undone in one step, got %q (%v)", e.String(), err)
+	}
+}
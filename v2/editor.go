@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,45 +21,84 @@ import (
 
 // Editor represents the contents and editor settings, but not settings related to the viewport or scrolling
 type Editor struct {
-	macro              *Macro          // the contents of the current macro (will be cleared when esc is pressed)
-	breakpoint         *Position       // for the breakpoint/jump functionality in debug mode
-	gdb                *gdb.Gdb        // connection to gdb, if debugMode is enabled
-	sameFilePortal     *Portal         // a portal that points to the same file
-	lines              map[int][]rune  // the contents of the current document
-	filename           string          // the current filename
-	searchTerm         string          // the current search term, used when searching
-	stickySearchTerm   string          // used when going to the next match with ctrl-n, unless esc has been pressed
-	Theme                              // editor theme, embedded struct
-	pos                Position        // the current cursor and scroll position
-	indentation        mode.TabsSpaces // spaces or tabs, and how many spaces per tab character
-	wrapWidth          int             // set to ie. 80 or 100 to trigger word wrap when typing to that column
-	mode               mode.Mode       // a filetype mode, like for git, markdown or various programming languages
-	debugShowRegisters int             // show no register box, show changed registers, show all changed registers
-	previousY          int             // previous cursor position
-	previousX          int             // previous cursor position
-	lineBeforeSearch   LineIndex       // save the current line number before jumping between search results
-	redrawCursor       bool            // if the cursor should be moved to the location it is supposed to be
-	slowLoad           bool            // was the initial file slow to load? (might be an indication of a slow disk or USB stick)
-	readOnly           bool            // is the file read-only when initializing o?
-	rainbowParenthesis bool            // rainbow parenthesis
-	sshMode            bool            // is o used over ssh, tmux or screen, in a way that usually requires extra redrawing?
-	debugMode          bool            // in a mode where ctrl-b toggles breakpoints, ctrl-n steps to the next line and ctrl-space runs the application
-	statusMode         bool            // display a status line at all times at the bottom of the screen
-	noExpandTags       bool            // used for XML and HTML
-	syntaxHighlight    bool            // syntax highlighting
-	stopParentOnQuit   bool            // send SIGQUIT to the parent PID when quitting
-	clearOnQuit        bool            // clear the terminal when quitting the editor, or not
-	quit               bool            // for indicating if the user wants to end the editor session
-	changed            bool            // has the contents changed, since last save?
-	redraw             bool            // if the contents should be redrawn in the next loop
-	debugHideOutput    bool            // hide the GDB stdout pane when in debug mode?
-	binaryFile         bool            // is this a binary file, or a text file?
-	wrapWhenTyping     bool            // wrap text at a certain limit when typing
-	addSpace           bool            // add a space to the editor, once
-	debugStepInto      bool            // when stepping to the next instruction, step into instead of over
-	detectedTabs       *bool           // were tab or space indentations detected when loading the data?
-	building           bool            // currently buildig code or exporting to a file?
-	runAfterBuild      bool            // run the application after building?
+	macro               *Macro           // the contents of the current macro (will be cleared when esc is pressed)
+	breakpoint          *Position        // for the breakpoint/jump functionality in debug mode
+	gdb                 *gdb.Gdb         // connection to gdb, if debugMode is enabled
+	sameFilePortal      *Portal          // a portal that points to the same file
+	bookmarks           Bookmarks        // named bookmarks, set with ctrl-b followed by a digit
+	lines               [][]rune         // the contents of the current document
+	filename            string           // the current filename
+	searchTerm          string           // the current search term, used when searching
+	searchRegexp        *regexp.Regexp   // the compiled search term, if it starts with "re:"
+	searchRegexpTerm    string           // the search term that searchRegexp was compiled from
+	searchRegexpErr     error            // the error from compiling searchRegexpTerm, if any
+	stickySearchTerm    string           // used when going to the next match with ctrl-n, unless esc has been pressed
+	searchWholeWord     bool             // only match the search term when it is not a part of a longer word
+	diskState           DiskState        // the modification time and size of the file when it was loaded or saved
+	Theme                                // editor theme, embedded struct
+	pos                 Position         // the current cursor and scroll position
+	indentation         mode.TabsSpaces  // spaces or tabs, and how many spaces per tab character
+	wrapWidth           int              // set to ie. 80 or 100 to trigger word wrap when typing to that column
+	mode                mode.Mode        // a filetype mode, like for git, markdown or various programming languages
+	debugShowRegisters  int              // show no register box, show changed registers, show all changed registers
+	previousY           int              // previous cursor position
+	previousX           int              // previous cursor position
+	lineBeforeSearch    LineIndex        // save the current line number before jumping between search results
+	redrawCursor        bool             // if the cursor should be moved to the location it is supposed to be
+	slowLoad            bool             // was the initial file slow to load? (might be an indication of a slow disk or USB stick)
+	readOnly            bool             // is the file read-only when initializing o?
+	lockReleased        bool             // has the file been saved and released to another instance of the editor?
+	keepCharacters      bool             // keep non-breaking spaces and odd characters when loading and saving
+	savePolicy          SavePolicy       // what to do with trailing whitespace and the final newline when saving
+	modeline            *Modeline        // the Vim or Emacs modeline that was found when loading, if any
+	manPagePreview      bool             // is this a rendered preview of an nroff source, which is in the switch buffer?
+	rainbowParenthesis  bool             // rainbow parenthesis
+	sshMode             bool             // is o used over ssh, tmux or screen, in a way that usually requires extra redrawing?
+	debugMode           bool             // in a mode where ctrl-b toggles breakpoints, ctrl-n steps to the next line and ctrl-space runs the application
+	statusMode          bool             // display a status line at all times at the bottom of the screen
+	noExpandTags        bool             // used for XML and HTML
+	syntaxHighlight     bool             // syntax highlighting
+	stopParentOnQuit    bool             // send SIGQUIT to the parent PID when quitting
+	clearOnQuit         bool             // clear the terminal when quitting the editor, or not
+	quit                bool             // for indicating if the user wants to end the editor session
+	changed             bool             // has the contents changed, since last save?
+	redraw              bool             // if the contents should be redrawn in the next loop
+	debugHideOutput     bool             // hide the GDB stdout pane when in debug mode?
+	binaryFile          bool             // is this a binary file, or a text file?
+	wrapWhenTyping      bool             // wrap text at a certain limit when typing
+	addSpace            bool             // add a space to the editor, once
+	debugStepInto       bool             // when stepping to the next instruction, step into instead of over
+	detectedTabs        *bool            // were tab or space indentations detected when loading the data?
+	tabIndentCount      uint64           // the number of lines indented with tabs, when the data was loaded
+	spaceIndentCount    uint64           // the number of lines indented with spaces, when the data was loaded
+	markMixedIndent     bool             // mark the indentation of lines that are not indented like the rest of the file
+	building            bool             // currently buildig code or exporting to a file?
+	runAfterBuild       bool             // run the application after building?
+	generatedFile       bool             // is the file in a git-ignored or generated directory, like "node_modules"?
+	generatedFileSaved  bool             // has saving a generated file been confirmed?
+	overwriteMode       bool             // typing replaces the rune under the cursor, instead of inserting
+	drawMode            bool             // ASCII draw mode, where the arrow keys move freely and shift-arrow draws lines
+	drawMark            *DrawMark        // the first corner of a rectangle, when in ASCII draw mode
+	showRuler           bool             // show a column ruler at the top of the view
+	showCrosshair       bool             // show a vertical line at the column of the cursor
+	selection           *Selection       // the anchor of the selection, if text is being selected
+	secretsFound        bool             // does the file have a filename or lines that look like secrets?
+	redactSecrets       bool             // draw the secrets as "••••", without changing the contents
+	textFormat          TextFormat       // the line endings, byte order mark and encoding to use when saving
+	mixedEndings        *MixedEndings    // the line endings of each line, if the file has mixed line endings
+	noFinalNewline      bool             // the loaded data did not end with a newline
+	forceSave           bool             // write the file when saving next time, even if it already has the same contents
+	skippedSave         bool             // was writing skipped the last time, since the file already had the same contents?
+	saveWarning         error            // was the file saved the last time, but without the right permissions?
+	wordCount           wordCountCache   // the word count, for the current generation of the contents
+	searchMatches       searchMatchCache // the matches of the search term, for the current generation of the contents
+	highlightDeferredAt time.Time        // when lines were last drawn without syntax highlighting because the time budget ran out
+	overlayShown        bool             // a box, like the output from running a program, is shown until all lines are drawn again
+	dirty               *DirtyLines      // the lines that have changed since all the lines were last drawn
+	buildErrors         *BuildErrors     // the errors from the last build, which can be jumped between
+	syntaxError         *BuildError      // the syntax error that was found the last time the file was saved, if any
+	snippetStops        []snippetStop    // the placeholders that are left to jump to, in the last expanded snippet
+	snippetStart        LineIndex        // the first line of the last expanded snippet
 }
 
 // NewCustomEditor takes:
@@ -79,29 +118,36 @@ type Editor struct {
 func NewCustomEditor(indentation mode.TabsSpaces, scrollSpeed int, m mode.Mode, theme Theme, syntaxHighlight, rainbowParenthesis bool) *Editor {
 	e := &Editor{}
 	e.SetTheme(theme)
-	e.lines = make(map[int][]rune)
+	e.lines = make([][]rune, 0)
+	e.dirty = NewDirtyLines()
+	e.bookmarks = make(Bookmarks)
 	e.indentation = indentation
 	e.syntaxHighlight = syntaxHighlight
 	e.rainbowParenthesis = rainbowParenthesis
 	p := NewPosition(scrollSpeed)
 	e.pos = *p
-	// If the file is not to be highlighted, set word wrap to 79 (0 to disable)
-	if e.syntaxHighlight {
-		e.wrapWidth = 79
-		e.wrapWhenTyping = false
-	}
+	e.wrapWidth, e.wrapWhenTyping = defaultWrap(m, syntaxHighlight)
+	e.mode = m
+	e.savePolicy = defaultSavePolicy(m, "")
+	return e
+}
+
+// defaultWrap returns the default word wrap width (0 to disable) and if text should be wrapped when typing,
+// for the given mode
+func defaultWrap(m mode.Mode, syntaxHighlight bool) (int, bool) {
 	switch m {
 	case mode.Email, mode.Git:
 		// The subject should ideally be maximum 50 characters long, then the body of the
 		// git commit message can be 72 characters long. Because e-mail standards.
-		e.wrapWidth = 72
-		e.wrapWhenTyping = true
+		return 72, true
 	case mode.Blank, mode.Doc, mode.Markdown, mode.Text, mode.ReStructured:
-		e.wrapWidth = 79
-		e.wrapWhenTyping = false
+		return 79, false
 	}
-	e.mode = m
-	return e
+	// If the file is to be highlighted, set word wrap to 79
+	if syntaxHighlight {
+		return 79, false
+	}
+	return 0, false
 }
 
 // NewSimpleEditor return a new simple editor, where the settings are 4 spaces per tab, white text on black background,
@@ -116,27 +162,33 @@ func NewSimpleEditor(wordWrapLimit int) *Editor {
 	return e
 }
 
-// CopyLines will create a new map[int][]rune struct that is the copy of all the lines in the editor
-func (e *Editor) CopyLines() map[int][]rune {
-	lines2 := make(map[int][]rune)
-	for key, runes := range e.lines {
+// CopyLines will create a new [][]rune slice that is the copy of all the lines in the editor
+func (e *Editor) CopyLines() [][]rune {
+	lines2 := make([][]rune, len(e.lines))
+	for y, runes := range e.lines {
 		runes2 := make([]rune, len(runes))
 		copy(runes2, runes)
-		lines2[key] = runes2
+		lines2[y] = runes2
 	}
 	return lines2
 }
 
+// lineRunes returns the runes of the given line index, and false if there is no such line
+func (e *Editor) lineRunes(y int) ([]rune, bool) {
+	if y < 0 || y >= len(e.lines) {
+		return nil, false
+	}
+	return e.lines[y], true
+}
+
 // Set will store a rune in the editor data, at the given data coordinates
 func (e *Editor) Set(x int, index LineIndex, r rune) {
 	y := int(index)
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = make([]rune, 0, x+1)
+	if y < 0 {
+		return
 	}
+	e.CreateLineIfMissing(index)
+	e.dirty.Mark(index)
 	l := len(e.lines[y])
 	if x < l {
 		e.lines[y][x] = r
@@ -156,10 +208,7 @@ func (e *Editor) Set(x int, index LineIndex, r rune) {
 
 // Get will retrieve a rune from the editor data, at the given coordinates
 func (e *Editor) Get(x int, y LineIndex) rune {
-	if e.lines == nil {
-		return ' '
-	}
-	runes, ok := e.lines[int(y)]
+	runes, ok := e.lineRunes(int(y))
 	if !ok {
 		return ' '
 	}
@@ -176,21 +225,14 @@ func (e *Editor) Changed() bool {
 
 // Line returns the contents of line number N, counting from 0
 func (e *Editor) Line(n LineIndex) string {
-	line, ok := e.lines[int(n)]
-	if ok {
-		var sb strings.Builder
-		for _, r := range line {
-			sb.WriteRune(r)
-		}
-		return sb.String()
-	}
-	return ""
+	line, _ := e.lineRunes(int(n))
+	return string(line)
 }
 
 // ScreenLine returns the screen contents of line number N, counting from 0.
 // The tabs are expanded.
 func (e *Editor) ScreenLine(n int) string {
-	line, ok := e.lines[n]
+	line, ok := e.lineRunes(n)
 	if ok {
 		var sb strings.Builder
 		skipX := e.pos.offsetX
@@ -213,18 +255,16 @@ func (e *Editor) LastDataPosition(n LineIndex) int {
 	return utf8.RuneCountInString(e.Line(n)) - 1
 }
 
-// LastScreenPosition returns the last X index for this line, for the screen (expands tabs)
+// LastScreenPosition returns the last X index for this line, for the screen (expands tabs and wide runes)
 // Can be negative, if the line is empty.
 func (e *Editor) LastScreenPosition(n LineIndex) int {
-	extraSpaceBecauseOfTabs := int(e.CountRune('\t', n) * (e.indentation.PerTab - 1))
-	return (e.LastDataPosition(n) + extraSpaceBecauseOfTabs)
+	return e.lineColumns(n) - 1
 }
 
 // LastTextPosition returns the last X index for this line, regardless of horizontal scrolling.
-// Can be negative if the line is empty. Tabs are expanded.
+// Can be negative if the line is empty. Tabs and wide runes are expanded.
 func (e *Editor) LastTextPosition(n LineIndex) int {
-	extraSpaceBecauseOfTabs := int(e.CountRune('\t', n) * (e.indentation.PerTab - 1))
-	return (e.LastDataPosition(n) + extraSpaceBecauseOfTabs)
+	return e.lineColumns(n) - 1
 }
 
 // FirstScreenPosition returns the first X index for this line, that is not '\t' or ' '.
@@ -261,7 +301,7 @@ func (e *Editor) FirstDataPosition(n LineIndex) int {
 // CountRune will count the number of instances of the rune r in the line n
 func (e *Editor) CountRune(r rune, n LineIndex) int {
 	var counter int
-	line, ok := e.lines[int(n)]
+	line, ok := e.lineRunes(int(n))
 	if ok {
 		for _, l := range line {
 			if l == r {
@@ -272,15 +312,12 @@ func (e *Editor) CountRune(r rune, n LineIndex) int {
 	return counter
 }
 
-// Len returns the number of lines
+// Len returns the number of lines. An empty document has one empty line.
 func (e *Editor) Len() int {
-	maxy := 0
-	for y := range e.lines {
-		if y > maxy {
-			maxy = y
-		}
+	if len(e.lines) == 0 {
+		return 1
 	}
-	return maxy + 1
+	return len(e.lines)
 }
 
 // String returns the contents of the editor
@@ -317,7 +354,8 @@ func (e *Editor) ContentsAndReverseSearchPrefix(prefix string) (string, LineInde
 
 // Clear removes all data from the editor
 func (e *Editor) Clear() {
-	e.lines = make(map[int][]rune)
+	e.lines = make([][]rune, 0)
+	e.dirty.MarkAll()
 	e.changed = true
 }
 
@@ -327,18 +365,27 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 	var (
 		message string
 		err     error
+		crlf    []bool // which line breaks are CRLF, if the file has mixed line endings
 	)
 
-	// Start a spinner, in a short while
-	quitChan := Spinner(c, tty, fmt.Sprintf("Reading %s... ", fnord.filename), fmt.Sprintf("reading %s: stopped by user", fnord.filename), 200*time.Millisecond, e.ItalicsColor)
+	// Start a spinner, in a short while, unless the file is small enough to be read in an instant.
+	// The .class files may be decompiled by jad, which can take a while.
+	stoppedMessage := fmt.Sprintf("reading %s: stopped by user", fnord.filename)
+	var abortChan <-chan bool
+	if !fnord.Small() || filepath.Ext(fnord.filename) == ".class" {
+		var quitChan chan bool
+		quitChan, abortChan = startSpinner(c, tty, fmt.Sprintf("Reading %s... ", fnord.filename), stoppedMessage, 200*time.Millisecond, e.ItalicsColor)
 
-	// Stop the spinner at the end of the function
-	defer func() {
-		quitChan <- true
-	}()
+		// Stop the spinner at the end of the function
+		defer func() {
+			quitChan <- true
+		}()
+	}
 
 	start := time.Now()
 
+	e.mixedEndings = nil
+
 	// Check if the file extension is ".class" and if "jad" is installed
 	if filepath.Ext(fnord.filename) == ".class" && which("jad") != "" && fnord.Empty() {
 		if fnord.data, err = e.LoadClass(fnord.filename); err != nil {
@@ -352,9 +399,22 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 				return message, err
 			}
 		}
+		// Discard the data if the user stopped the reading, before anything is changed
+		if spinnerAborted(abortChan) {
+			return message, errors.New(stoppedMessage)
+		}
+		// Detect the line endings, byte order mark and encoding, so that the file can be saved in the same way
+		e.textFormat = detectTextFormat(fnord.data)
+		decoded := e.textFormat.Decode(fnord.data)
 		// Check if it's a binary file or a text file
-		if e.binaryFile = binary.Data(fnord.data); e.binaryFile {
+		if e.binaryFile = binary.Data(decoded); e.binaryFile {
 			e.mode = mode.Blank
+			e.textFormat = TextFormat{}
+		} else {
+			fnord.data = decoded
+			if e.textFormat.mixed {
+				crlf = crlfLineBreaks(decoded)
+			}
 		}
 	}
 
@@ -363,15 +423,29 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 
 	// Opinionated replacements, but not for binary files
 	if !e.binaryFile {
-		fnord.data = opinionatedByteReplacer.Replace(fnord.data)
+		fnord.data = e.byteReplacer().Replace(fnord.data)
+		// Remember the line endings of each line, so that they can be kept for the lines that are not changed
+		if crlf != nil {
+			e.mixedEndings = newMixedEndings(fnord.data, crlf)
+		}
 	}
 
 	// Load the data
 	e.LoadBytes(fnord.data)
 
+	// Use the file type and indentation from a Vim or Emacs modeline, if there is one
+	e.modeline = nil
+	if !e.binaryFile {
+		e.modeline = e.FindModeline()
+		e.ApplyModeline()
+	}
+
 	// Mark the data as "not changed"
 	e.changed = false
 
+	// Remember the modification time and size, so that changes made by other programs can be detected
+	e.diskState, _ = statDiskState(fnord.filename)
+
 	return message, nil
 }
 
@@ -379,6 +453,9 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 func (e *Editor) LoadBytes(data []byte) {
 	e.Clear()
 
+	// Remember if the data ends with a newline, so that binary files can be saved exactly as they were
+	e.noFinalNewline = len(data) > 0 && data[len(data)-1] != '\n'
+
 	byteLines := bytes.Split(data, []byte{'\n'})
 
 	lb := len(byteLines)
@@ -390,7 +467,8 @@ func (e *Editor) LoadBytes(data []byte) {
 	}
 
 	// One allocation for all the lines
-	e.lines = make(map[int][]rune, lb)
+	e.lines = make([][]rune, lb)
+	e.dirty.MarkAll()
 
 	// Place the lines into the editor, while counting tab indentations
 	var (
@@ -408,6 +486,12 @@ func (e *Editor) LoadBytes(data []byte) {
 		e.lines[y] = []rune(line)
 	}
 
+	// Empty data is a single empty line, so that Len and Empty agree
+	if lb == 0 {
+		e.lines = append(e.lines, []rune{})
+	}
+
+	e.tabIndentCount, e.spaceIndentCount = tabIndentCounter, spaceIndentCounter
 	if tabIndentCounter > 0 || spaceIndentCounter > 0 {
 		// Check if there were more tab indentations than space indentations
 		var detectedTabs = tabIndentCounter > spaceIndentCounter
@@ -452,29 +536,50 @@ func (e *Editor) PrepareEmpty(c *vt100.Canvas, tty *vt100.TTY, filename string)
 
 // Save will try to save the current editor contents to file.
 // It needs a canvas in case trailing spaces are stripped and the cursor needs to move to the end.
+// What is done with trailing whitespace and the final newline depends on the save policy of the editor.
 func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 	var (
 		bookmark = e.pos.Copy() // Save the current position
 		changed  bool
 		shebang  bool
 		data     []byte
+		// the line endings of each line, as they are saved, if the file has mixed line endings
+		mixedEndings *MixedEndings
 	)
+	e.skippedSave = false
+	e.saveWarning = nil
 	if e.binaryFile {
 		data = []byte(e.String())
+		// Save binary files byte for byte, also when the last line does not end with a newline
+		if e.noFinalNewline {
+			data = bytes.TrimSuffix(data, []byte{'\n'})
+		}
 	} else {
 		// Strip trailing spaces on all lines
-		l := e.Len()
-		for i := 0; i < l; i++ {
-			if e.TrimRight(LineIndex(i)) {
-				changed = true
+		if e.savePolicy.stripTrailingWhitespace {
+			l := e.Len()
+			for i := 0; i < l; i++ {
+				if e.TrimRight(LineIndex(i)) {
+					changed = true
+				}
 			}
 		}
 
-		// Trim away trailing whitespace
-		s := strings.TrimRightFunc(e.String(), unicode.IsSpace)
+		// Trim away trailing blank lines
+		s := e.String()
+		if e.savePolicy.stripTrailingBlankLines {
+			s = withoutTrailingBlankLines(s)
+		}
 
-		// Make additional replacements, and add a final newline
-		s = opinionatedStringReplacer.Replace(s) + "\n"
+		// Make additional replacements
+		s = e.stringReplacer().Replace(s)
+
+		// Add a final newline, or leave it out if the file was loaded without one
+		if e.savePolicy.finalNewline && !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		} else if !e.savePolicy.finalNewline && e.noFinalNewline {
+			s = strings.TrimSuffix(s, "\n")
+		}
 
 		// TODO: Auto-detect tabs/spaces instead of per-language assumptions
 		if e.mode.Spaces() {
@@ -490,10 +595,15 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 		// (Does it either start with a shebang or reside in a common bin directory like /usr/bin?)
 		shebang = aBinDirectory(e.filename) || strings.HasPrefix(s, "#!")
 
-		data = []byte(s)
+		// Use the line endings, byte order mark and encoding of the file
+		var err error
+		if data, mixedEndings, err = e.encode(s); err != nil {
+			return err
+		}
 	}
 
 	// Mark the data as "not changed" if it's not a binary file
+	changedBeforeSave := e.changed
 	if !e.binaryFile {
 		e.changed = false
 	}
@@ -501,26 +611,42 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 	// Shell scripts that contains the word "source" typically needs to be sourced and should not be "chmod +x"-ed
 	containsTheWordSource := bytes.Contains(data, []byte("source"))
 
-	// Default file mode (0644 for regular files, 0755 for executable files)
-	var fileMode os.FileMode = 0644
+	// Keep the permissions of an existing file, or the permissions it had when it was loaded,
+	// if it has been removed since then. Create new files with 0644.
+	defaultMode := os.FileMode(0644)
+	if e.diskState.perm != 0 {
+		defaultMode = e.diskState.perm
+	}
+	fileMode := filePermissions(e.filename, defaultMode)
 
+	// "chmod +x" or "chmod -x", in order to toggle the executable bit.
 	// Checking the syntax highlighting makes it easy to press `ctrl-t` before saving a script,
 	// to toggle the executable bit on or off. This is only for files that start with "#!".
 	// Also, if the file is in one of the common bin directories, like "/usr/bin", then assume that it
 	// is supposed to be executable.
-	if shebang && e.syntaxHighlight && !containsTheWordSource {
+	// rust source may start with something like "#![feature(core_intrinsics)]", so avoid that.
+	scriptFile := shebang && e.mode != mode.Rust && e.mode != mode.Python
+	if scriptFile && e.syntaxHighlight && !containsTheWordSource {
 		// This is a script file, syntax highlighting is enabled and it does not contain the word "source"
-		fileMode = 0755
+		fileMode = withExecutableBits(fileMode)
+	} else if scriptFile || e.mode == mode.Make || e.mode == mode.Markdown || e.mode == mode.Doc || e.mode == mode.ReStructured || filepath.Base(e.filename) == "PKGBUILD" {
+		fileMode = withoutExecutableBits(fileMode)
 	}
 
 	// Unless it's a binary file and no changes has been made, save the data
 	if !(e.binaryFile && !e.changed) {
 
+		// Don't write the file if it already has the same contents, so that tools that
+		// check the modification time, like make, don't rebuild needlessly. Unless forced.
+		e.skippedSave = !e.forceSave && sameAsOnDisk(e.filename, data)
+		e.forceSave = false
+
 		// Start a spinner, in a short while
-		quitChan := Spinner(c, tty, fmt.Sprintf("Saving %s... ", e.filename), fmt.Sprintf("saving %s: stopped by user", e.filename), 200*time.Millisecond, e.ItalicsColor)
+		stoppedMessage := fmt.Sprintf("saving %s: stopped by user", e.filename)
+		quitChan, abortChan := startSpinner(c, tty, fmt.Sprintf("Saving %s... ", e.filename), stoppedMessage, 200*time.Millisecond, e.ItalicsColor)
 
 		// Prepare gzipped data
-		if strings.HasSuffix(e.filename, ".gz") {
+		if strings.HasSuffix(e.filename, ".gz") && !e.skippedSave {
 			var err error
 			data, err = gZipData(data)
 			if err != nil {
@@ -529,8 +655,27 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 			}
 		}
 
+		// If the user stopped the saving before the file is written, leave the file as it is.
+		// Once writing has started, it is completed, since the file is replaced all at once.
+		if spinnerAborted(abortChan) {
+			quitChan <- true
+			e.changed = changedBeforeSave
+			return errors.New(stoppedMessage)
+		}
+
 		// Save the file and return any errors
-		if err := os.WriteFile(e.filename, data, fileMode); err != nil {
+		var err error
+		if e.skippedSave {
+			// The file already has these contents, but the executable bit may have been toggled
+			err = chmodIfNeeded(e.filename, fileMode)
+		} else {
+			err = saveFile(e.filename, data, fileMode)
+		}
+		var kae *keepAttributesError
+		if errors.As(err, &kae) {
+			// The file was saved, but the user should be told about the permissions
+			e.saveWarning = err
+		} else if err != nil {
 			// Stop the spinner and return
 			quitChan <- true
 			return err
@@ -539,19 +684,23 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 		// This file should not be considered read-only, since saving went fine
 		e.readOnly = false
 
-		// TODO: Consider the previous fileMode of the file when doing chmod +x instead of just setting 0755 or 0644
+		// Compare with the lines as they were saved, when keeping mixed line endings the next time
+		if mixedEndings != nil {
+			e.mixedEndings = mixedEndings
+		}
+
+		// Text files are saved with a final newline, unless the save policy says otherwise
+		if !e.binaryFile && e.savePolicy.finalNewline {
+			e.noFinalNewline = false
+		}
 
-		// "chmod +x" or "chmod -x". This is needed after saving the file, in order to toggle the executable bit.
-		// rust source may start with something like "#![feature(core_intrinsics)]", so avoid that.
-		if shebang && e.mode != mode.Rust && e.mode != mode.Python && !e.readOnly {
-			// Call Chmod, but ignore errors (since this is just a bonus and not critical)
-			os.Chmod(e.filename, fileMode)
+		if scriptFile {
 			e.syntaxHighlight = true
-		} else if e.mode == mode.Make || e.mode == mode.Markdown || e.mode == mode.Doc || e.mode == mode.ReStructured || filepath.Base(e.filename) == "PKGBUILD" {
-			fileMode = 0644
-			os.Chmod(e.filename, fileMode)
 		}
 
+		// Remember the modification time and size, so that changes made by other programs can be detected
+		e.RecordDiskState()
+
 		// Stop the spinner
 		quitChan <- true
 
@@ -581,11 +730,12 @@ func (e *Editor) Save(c *vt100.Canvas, tty *vt100.TTY) error {
 func (e *Editor) TrimRight(index LineIndex) bool {
 	changed := false
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lineRunes(n); ok {
 		newRunes := []rune(strings.TrimRightFunc(string(line), unicode.IsSpace))
 		// TODO: Just compare lengths instead of contents?
 		if string(newRunes) != string(line) {
 			e.lines[n] = newRunes
+			e.dirty.Mark(index)
 			changed = true
 		}
 	}
@@ -597,11 +747,12 @@ func (e *Editor) TrimRight(index LineIndex) bool {
 func (e *Editor) TrimLeft(index LineIndex) bool {
 	changed := false
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lineRunes(n); ok {
 		newRunes := []rune(strings.TrimLeftFunc(string(line), unicode.IsSpace))
 		// TODO: Just compare lengths instead of contents?
 		if string(newRunes) != string(line) {
 			e.lines[n] = newRunes
+			e.dirty.Mark(index)
 			changed = true
 		}
 	}
@@ -627,24 +778,13 @@ func (e *Editor) DeleteRestOfLine() {
 		return
 	}
 	y := int(e.DataY())
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	v, ok := e.lines[y]
-	if !ok {
+	v, ok := e.lineRunes(y)
+	if !ok || x > len(v) {
 		return
 	}
-	if v == nil {
-		e.lines[y] = make([]rune, 0)
-	}
-	if x > len(e.lines[y]) {
-		return
-	}
-	e.lines[y] = e.lines[y][:x]
+	e.lines[y] = v[:x]
+	e.dirty.Mark(LineIndex(y))
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLine will delete the given line index
@@ -653,45 +793,24 @@ func (e *Editor) DeleteLine(n LineIndex) {
 		// This should never happen
 		return
 	}
+	e.bookmarks.LineDeleted(n)
+	e.dirty.MarkAll()
 	lastLineIndex := LineIndex(e.Len() - 1)
 	endOfDocument := n >= lastLineIndex
 	if endOfDocument {
 		// Just delete this line
-		delete(e.lines, int(n))
-		return
-	}
-	// TODO: Rely on the length of the hash map for finding the index instead of
-	//       searching through each line number key.
-	var maxIndex LineIndex
-	found := false
-	for k := range e.lines {
-		if LineIndex(k) > maxIndex {
-			maxIndex = LineIndex(k)
-			found = true
+		if int(n) < len(e.lines) {
+			e.lines = e.lines[:n]
 		}
-	}
-	if !found {
-		// This should never happen
-		return
-	}
-	if _, ok := e.lines[int(maxIndex)]; !ok {
-		// The line numbers and the length of e.lines does not match
 		return
 	}
-	// Shift all lines after y:
-	// shift all lines after n one step closer to n, overwriting e.lines[n]
-	for index := n; index <= (maxIndex - 1); index++ {
-		i := int(index)
-		e.lines[i] = e.lines[i+1]
-	}
-	// Then delete the final item
-	delete(e.lines, int(maxIndex))
+	// Shift all lines after n one step closer to n, overwriting e.lines[n]
+	copy(e.lines[n:], e.lines[n+1:])
+	e.lines[len(e.lines)-1] = nil
+	e.lines = e.lines[:len(e.lines)-1]
 
 	// This changes the document
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLineMoveBookmark will delete the given line index and also move the bookmark if it's after n
@@ -711,9 +830,9 @@ func (e *Editor) DeleteCurrentLineMoveBookmark(bookmark *Position) {
 // Delete will delete a character at the given position
 func (e *Editor) Delete() {
 	y := int(e.DataY())
-	lineLen := len(e.lines[y])
-	if _, ok := e.lines[y]; !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(e.lines[y][0])) {
-		// All keys in the map that are > y should be shifted -1.
+	line, ok := e.lineRunes(y)
+	if lineLen := len(line); !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(line[0])) {
+		// All lines that are after y should be shifted -1.
 		// This also overwrites e.lines[y].
 		e.DeleteLine(LineIndex(y))
 		e.changed = true
@@ -723,52 +842,74 @@ func (e *Editor) Delete() {
 	if err != nil || x > len(e.lines[y])-1 {
 		// on the last index, just use every element but x
 		e.lines[y] = e.lines[y][:x]
+		e.dirty.Mark(LineIndex(y))
 		// check if the next line exists
-		if _, ok := e.lines[y+1]; ok {
-			// then add the contents of the next line, if available
-			nextLine, ok := e.lines[y+1]
-			if ok && len(nextLine) > 0 {
-				e.lines[y] = append(e.lines[y], nextLine...)
-				// then delete the next line
-				e.DeleteLine(LineIndex(y + 1))
-			}
+		if nextLine, ok := e.lineRunes(y + 1); ok {
+			// then join it with this line, while collapsing the indentation
+			e.lines[y] = []rune(e.joinLine(string(e.lines[y]), string(nextLine)))
+			// then delete the next line
+			e.DeleteLine(LineIndex(y + 1))
 		}
 		e.changed = true
 		return
 	}
-	// Delete just this character
-	e.lines[y] = append(e.lines[y][:x], e.lines[y][x+1:]...)
+	// Delete just this character, together with any combining marks after it
+	e.lines[y] = append(e.lines[y][:x], e.lines[y][clusterEnd(e.lines[y], x):]...)
+	e.dirty.Mark(LineIndex(y))
 	e.changed = true
+}
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
+// joinLines returns the given line joined with the line below it. The indentation of the line below is
+// collapsed to a single space, or to nothing if the line ends with whitespace or an opening bracket.
+// If both lines are single-line comments, the comment marker of the line below is also removed.
+// If the line is blank, the line below is returned as it is, including the indentation.
+func joinLines(line, nextLine, commentMarker string) string {
+	if strings.TrimSpace(line) == "" {
+		return nextLine
+	}
+	trimmedNextLine := strings.TrimLeftFunc(nextLine, unicode.IsSpace)
+	if commentMarker != "" && strings.HasPrefix(strings.TrimSpace(line), commentMarker) && strings.HasPrefix(trimmedNextLine, commentMarker) {
+		trimmedNextLine = strings.TrimLeftFunc(strings.TrimPrefix(trimmedNextLine, commentMarker), unicode.IsSpace)
+	}
+	if trimmedNextLine == "" {
+		return line
+	}
+	lastRune, _ := utf8.DecodeLastRuneInString(line)
+	if unicode.IsSpace(lastRune) || strings.ContainsRune("([{", lastRune) {
+		return line + trimmedNextLine
+	}
+	return line + " " + trimmedNextLine
+}
+
+// joinLine returns the given line joined with the line below it, like joinLines, using the comment marker of
+// the current mode. For prose, any trailing whitespace, like after a period, is collapsed to a single space.
+func (e *Editor) joinLine(line, nextLine string) string {
+	if e.proseMode() && strings.TrimSpace(line) != "" && strings.TrimSpace(nextLine) != "" {
+		line = strings.TrimRightFunc(line, unicode.IsSpace) + " "
+	}
+	return joinLines(line, nextLine, e.SingleLineCommentMarker())
 }
 
 // Empty will check if the current editor contents are empty or not.
 // If there's only one line left and it is only whitespace, that will be considered empty as well.
 func (e *Editor) Empty() bool {
-	l := len(e.lines)
-	if l == 0 {
+	switch len(e.lines) {
+	case 0:
 		return true
-	}
-	if l == 1 {
-		// Regardless of line number key, check the contents of the one remaining trimmed line
-		for _, line := range e.lines {
-			return len(strings.TrimSpace(string(line))) == 0
-		}
+	case 1:
+		// Check the contents of the one remaining trimmed line
+		return len(strings.TrimSpace(string(e.lines[0]))) == 0
 	}
 	// > 1 lines
 	return false
 }
 
-// MakeConsistent creates an empty slice of runes for any empty lines,
-// to make sure that no line number below e.Len() points to a nil map.
+// MakeConsistent creates an empty slice of runes for any nil lines,
+// to make sure that no line index below e.Len() points to a nil slice.
 func (e *Editor) MakeConsistent() {
-	// Check if the keys in the map are consistent
-	for i := 0; i < len(e.lines); i++ {
-		if _, found := e.lines[i]; !found {
+	for i, line := range e.lines {
+		if line == nil {
 			e.lines[i] = make([]rune, 0)
-			e.changed = true
 		}
 	}
 }
@@ -776,14 +917,16 @@ func (e *Editor) MakeConsistent() {
 // WithinLimit will check if a line is within the word wrap limit,
 // given a Y position.
 func (e *Editor) WithinLimit(y LineIndex) bool {
-	return len(e.lines[int(y)]) < e.wrapWidth
+	line, _ := e.lineRunes(int(y))
+	return len(line) < e.wrapWidth
 }
 
 // LastWord will return the last word of a line,
 // given a Y position. Returns an empty string if there is no last word.
 func (e *Editor) LastWord(y int) string {
 	// TODO: Use a faster method
-	words := strings.Fields(strings.TrimSpace(string(e.lines[y])))
+	line, _ := e.lineRunes(y)
+	words := strings.Fields(strings.TrimSpace(string(line)))
 	if len(words) > 0 {
 		return words[len(words)-1]
 	}
@@ -802,8 +945,9 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	// Maximum word length to not keep as one word
 	maxDistance := e.wrapWidth / 2
+	line, _ := e.lineRunes(y)
 	if e.WithinLimit(index) {
-		return e.lines[y], make([]rune, 0), false
+		return line, make([]rune, 0), false
 	}
 	splitPosition := e.wrapWidth
 	if isSpace {
@@ -813,7 +957,7 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 		// If a space is reached, check if it is too far away from n to be used as a split position, or not.
 		spacePosition := -1
 		for i := splitPosition; i >= 0; i-- {
-			if i < len(e.lines[y]) && unicode.IsSpace(e.lines[y][i]) {
+			if i < len(line) && unicode.IsSpace(line[i]) {
 				// Found a space at position i
 				spacePosition = i
 				break
@@ -837,11 +981,11 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	n := splitPosition
 	// Make space for the two parts
-	first := make([]rune, len(e.lines[y][:n]))
-	second := make([]rune, len(e.lines[y][n:]))
+	first := make([]rune, len(line[:n]))
+	second := make([]rune, len(line[n:]))
 	// Copy the line into first and second
-	copy(first, e.lines[y][:n])
-	copy(second, e.lines[y][n:])
+	copy(first, line[:n])
+	copy(second, line[n:])
 
 	// If the second part starts with a space, remove it
 	if len(second) > 0 && unicode.IsSpace(second[0]) {
@@ -874,6 +1018,7 @@ func (e *Editor) WrapAllLines() bool {
 			if spaceBetween {
 				second = append(second, ' ')
 			}
+			e.CreateLineIfMissing(LineIndex(i + 1))
 			e.lines[i+1] = append(second, e.lines[i+1]...)
 			e.InsertLineBelowAt(LineIndex(i + 1))
 
@@ -923,55 +1068,47 @@ func (e *Editor) InsertLineAbove() {
 	if e.sameFilePortal != nil {
 		e.sameFilePortal.NewLineInserted(lineIndex)
 	}
+	e.bookmarks.LineInserted(lineIndex)
 
 	y := int(lineIndex)
 
-	// Create new set of lines
-	lines2 := make(map[int][]rune)
-
-	// If at the first line, just add a line at the top
 	if y == 0 {
-
-		// Insert a blank line
-		lines2[0] = make([]rune, 0)
-		// Then insert all the other lines, shifted by 1
-		for k, v := range e.lines {
-			lines2[k+1] = v
-		}
+		// If at the first line, just add a line at the top
+		e.insertLinesAt(0, 1)
 		y++
-
 	} else {
-
-		// For each line in the old map, if at (y-1), insert a blank line
-		// (insert a blank line above)
-		for k, v := range e.lines {
-			if k < (y - 1) {
-				lines2[k] = v
-			} else if k == (y - 1) {
-				lines2[k] = v
-				lines2[k+1] = make([]rune, 0)
-			} else if k > (y - 1) {
-				lines2[k+1] = v
-			}
-		}
-
+		// Insert a blank line above
+		e.insertLinesAt(y, 1)
 	}
 
-	// Use the new set of lines
-	e.lines = lines2
+	// Skip trailing newlines after this line
+	e.trimEmptyLinesAfter(y)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
+	e.changed = true
+}
 
-	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
-			break
-		}
+// insertLinesAt inserts n empty lines at the given line index, shifting the lines at and after it
+func (e *Editor) insertLinesAt(y, n int) {
+	e.CreateLineIfMissing(LineIndex(y - 1))
+	if y > len(e.lines) {
+		y = len(e.lines)
+	}
+	e.dirty.MarkAll()
+	// Grow the slice by n lines, move the lines after y to the end and then clear the lines in between
+	e.lines = append(e.lines, make([][]rune, n)...)
+	copy(e.lines[y+n:], e.lines[y:])
+	for i := y; i < y+n; i++ {
+		e.lines[i] = make([]rune, 0)
+	}
+}
+
+// trimEmptyLinesAfter removes the empty lines at the end of the document, but only those after the given line index
+func (e *Editor) trimEmptyLinesAfter(y int) {
+	for len(e.lines) > y+1 && len(e.lines[len(e.lines)-1]) == 0 {
+		e.dirty.MarkAll()
+		e.lines[len(e.lines)-1] = nil
+		e.lines = e.lines[:len(e.lines)-1]
 	}
-	e.changed = true
 }
 
 // InsertLineBelow will attempt to insert a new line below the current position
@@ -986,43 +1123,23 @@ func (e *Editor) InsertLineBelow() {
 // InsertLineBelowAt will attempt to insert a new line below the given y position
 func (e *Editor) InsertLineBelowAt(index LineIndex) {
 	y := int(index)
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
+	e.bookmarks.LineInserted(index + 1)
 
 	// If we are the the last line, add an empty line at the end and return
 	if y == (len(e.lines) - 1) {
-		e.lines[int(y)+1] = make([]rune, 0)
+		e.lines = append(e.lines, make([]rune, 0))
+		e.dirty.MarkAll()
 		e.changed = true
 		return
 	}
 
-	// Create new set of lines, with room for one more
-	lines2 := make(map[int][]rune, len(e.lines)+1)
-
-	// For each line in the old map, if at y, insert a blank line
-	// (insert a blank line below)
-	for k, v := range e.lines {
-		if k < y {
-			lines2[k] = v
-		} else if k == y {
-			lines2[k] = v
-			lines2[k+1] = make([]rune, 0)
-		} else if k > y {
-			lines2[k+1] = v
-		}
+	// Insert a blank line below
+	if y >= 0 && y < len(e.lines) {
+		e.insertLinesAt(y+1, 1)
 	}
-	// Use the new set of lines
-	e.lines = lines2
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
-			break
-		}
-	}
+	e.trimEmptyLinesAfter(y)
 
 	e.changed = true
 }
@@ -1035,17 +1152,11 @@ func (e *Editor) Insert(r rune) {
 
 	y := int(e.DataY())
 
-	// If there are no lines, initialize and set the 0th rune to the given one
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-		e.lines[0] = []rune{r}
-		return
-	}
-
-	// If the current line is empty, initialize it with a line that is just the given rune
-	_, ok := e.lines[y]
-	if !ok {
+	// If the current line is missing, initialize it with a line that is just the given rune
+	if _, ok := e.lineRunes(y); !ok {
+		e.CreateLineIfMissing(LineIndex(y))
 		e.lines[y] = []rune{r}
+		e.dirty.Mark(LineIndex(y))
 		return
 	}
 	if len(e.lines[y]) < x {
@@ -1062,30 +1173,21 @@ func (e *Editor) Insert(r rune) {
 		newline[i] = e.lines[y][i-1]
 	}
 	e.lines[y] = newline
+	e.dirty.Mark(LineIndex(y))
 
 	e.changed = true
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
-// CreateLineIfMissing will create a line at the given Y index, if it's missing
+// CreateLineIfMissing will create a line at the given Y index, if it's missing,
+// together with any missing lines before it
 func (e *Editor) CreateLineIfMissing(n LineIndex) {
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[int(n)]
-	if !ok {
-		e.lines[int(n)] = make([]rune, 0)
+	for int(n) >= len(e.lines) {
+		e.lines = append(e.lines, make([]rune, 0))
+		e.dirty.MarkAll()
 		e.changed = true
 	}
 }
 
-// WordCount returns the number of spaces in the text + 1
-func (e *Editor) WordCount() int {
-	return len(strings.Fields(e.String()))
-}
-
 // ToggleSyntaxHighlight toggles syntax highlighting
 func (e *Editor) ToggleSyntaxHighlight() {
 	e.syntaxHighlight = !e.syntaxHighlight
@@ -1104,15 +1206,13 @@ func (e *Editor) SetRainbow(rainbowParenthesis bool) {
 // SetLine will fill the given line index with the given string.
 // Any previous contents of that line is removed.
 func (e *Editor) SetLine(n LineIndex, s string) {
-	e.CreateLineIfMissing(n)
-	e.lines[int(n)] = make([]rune, 0)
-	counter := 0
-	// It's important not to use the index value when looping over a string,
-	// unless the byte index is what one's after, as opposed to the rune index.
-	for _, letter := range s {
-		e.Set(counter, n, letter)
-		counter++
+	if n < 0 {
+		return
 	}
+	e.CreateLineIfMissing(n)
+	e.lines[int(n)] = []rune(s)
+	e.dirty.Mark(n)
+	e.changed = true
 }
 
 // SetCurrentLine will replace the current line with the given string
@@ -1132,7 +1232,7 @@ func (e *Editor) SplitLine() bool {
 	y := e.DataY()
 
 	// Get the contents of this line
-	runeLine := e.lines[int(y)]
+	runeLine, _ := e.lineRunes(int(y))
 	if len(runeLine) < 2 {
 		// Did not split
 		return false
@@ -1159,19 +1259,29 @@ func (e *Editor) DataX() (int, error) {
 	found := false
 	dataX := 0
 	runeCounter := 0
-	for _, r := range e.lines[dataY] {
+	line, _ := e.lineRunes(dataY)
+	screenX := e.pos.sx + e.pos.offsetX
+	for i, r := range line {
+		columns := e.runeColumns(r)
+		if columns == 0 && i > 0 {
+			// A combining mark belongs to the rune before it, so the cursor can not be placed at it
+			runeCounter++
+			continue
+		}
 		// When we reached the correct screen position, use i as the data position
-		if screenCounter == (e.pos.sx + e.pos.offsetX) {
+		if screenCounter == screenX {
 			dataX = runeCounter
 			found = true
 			break
 		}
 		// Increase the counter, based on the current rune
-		if r == '\t' {
-			screenCounter += e.indentation.PerTab
-		} else {
-			screenCounter++
+		if r != '\t' && screenCounter+columns > screenX {
+			// The screen position is on the second column of a wide rune
+			dataX = runeCounter
+			found = true
+			break
 		}
+		screenCounter += columns
 		runeCounter++
 	}
 	if !found {
@@ -1204,8 +1314,10 @@ func (e *Editor) NextLine(y LineIndex, c *vt100.Canvas, status *StatusBar) {
 // InsertBelow will insert the given rune at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertBelow(y int, r rune) {
-	if _, ok := e.lines[y+1]; !ok {
+	e.dirty.Mark(LineIndex(y + 1))
+	if _, ok := e.lineRunes(y + 1); !ok {
 		// If the next line does not exist, create one containing just "r"
+		e.CreateLineIfMissing(LineIndex(y + 1))
 		e.lines[y+1] = []rune{r}
 	} else if len(e.lines[y+1]) > 0 {
 		// If the next line is non-empty, insert "r" at the start
@@ -1219,8 +1331,10 @@ func (e *Editor) InsertBelow(y int, r rune) {
 // InsertStringBelow will insert the given string at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertStringBelow(y int, s string) {
-	if _, ok := e.lines[y+1]; !ok {
+	e.dirty.Mark(LineIndex(y + 1))
+	if _, ok := e.lineRunes(y + 1); !ok {
 		// If the next line does not exist, create one containing the string
+		e.CreateLineIfMissing(LineIndex(y + 1))
 		e.lines[y+1] = []rune(s)
 	} else if len(e.lines[y+1]) > 0 {
 		// If the next line is non-empty, insert the string at the start
@@ -1272,7 +1386,7 @@ func (e *Editor) LeftRune() rune {
 	x, err := e.DataX()
 	if err != nil {
 		// This is after the line contents, return the last rune
-		runes, ok := e.lines[int(y)]
+		runes, ok := e.lineRunes(int(y))
 		if !ok || len(runes) == 0 {
 			return rune(0)
 		}
@@ -1317,6 +1431,72 @@ func (e *Editor) EndNoTrim(c *vt100.Canvas) {
 	e.redraw = true
 }
 
+// ScreenXForDataX returns the screen X position (with tabs expanded, but without the horizontal scroll offset)
+// for the given data X position on the given line
+func (e *Editor) ScreenXForDataX(y LineIndex, dataX int) int {
+	screenX := 0
+	for i, r := range []rune(e.Line(y)) {
+		if i >= dataX {
+			return screenX
+		}
+		screenX += e.runeColumns(r)
+	}
+	// After the end of the line
+	return screenX + (dataX - utf8.RuneCountInString(e.Line(y)))
+}
+
+// GoToDataX moves the cursor to the given data X position on the current line,
+// then lets HorizontalScrollIfNeeded scroll the line so that the cursor is visible
+func (e *Editor) GoToDataX(c *vt100.Canvas, dataX int) {
+	if dataX < 0 {
+		dataX = 0
+	}
+	e.pos.offsetX = 0
+	e.pos.sx = e.ScreenXForDataX(e.DataY(), dataX)
+	e.HorizontalScrollIfNeeded(c)
+}
+
+// HomeCycle is used by ctrl-a. It moves the cursor to the start of the text on the current line,
+// then to the start of the line and then to the end of the previous line.
+// Only data positions are used, so that horizontal scrolling does not affect the order.
+// If justMovedUpOrDown is true (or there is a search term), the cursor never moves to another line.
+func (e *Editor) HomeCycle(c *vt100.Canvas, status *StatusBar, justMovedUpOrDown bool) {
+	y := e.DataY()
+	x, _ := e.DataX()
+	canChangeLine := !justMovedUpOrDown && e.SearchTerm() == "" && y > 0
+	if canChangeLine && (x == 0 || e.EmptyRightTrimmedLine()) {
+		// At the start of the line, or at an empty line, so go to the end of the previous line
+		e.Up(c, status)
+		e.End(c)
+	} else if firstX := e.FirstDataPosition(y); x == firstX || x == 0 {
+		// At the start of the text, go to the start of the line
+		e.GoToDataX(c, 0)
+	} else {
+		// Go to the start of the text
+		e.GoToDataX(c, firstX)
+	}
+}
+
+// EndCycle is used by ctrl-e. It moves the cursor to the end of the current line,
+// and if it is already after the end, to the start of the next line.
+// Only data positions are used, so that horizontal scrolling does not affect the order.
+// If justMovedUpOrDown is true (or there is a search term), the cursor never moves to another line.
+func (e *Editor) EndCycle(c *vt100.Canvas, status *StatusBar, justMovedUpOrDown bool) {
+	y := e.DataY()
+	e.TrimRight(y)
+	x, _ := e.DataX()
+	lastX := e.LastDataPosition(y)
+	canChangeLine := !justMovedUpOrDown && e.SearchTerm() == "" && int(y) < e.Len()-1
+	if canChangeLine && x > lastX {
+		// After the end of the line, go to the start of the next line
+		e.Down(c, status)
+		e.GoToDataX(c, 0)
+	} else {
+		// Go to the position right after the end of the line
+		e.GoToDataX(c, lastX+1)
+	}
+}
+
 // AtEndOfLine returns true if the cursor is at exactly the last character of the line, not the one after
 func (e *Editor) AtEndOfLine() bool {
 	return e.pos.sx+e.pos.offsetX == e.LastTextPosition(e.DataY())
@@ -1358,6 +1538,9 @@ func (e *Editor) DownEnd(c *vt100.Canvas) error {
 		if e.pos.sx < len(expandedRunes) && expandedRunes[e.pos.sx] == '\t' {
 			e.pos.sx = int(e.FirstScreenPosition(e.DataY()))
 		}
+
+		// Do not place the cursor in the middle of a wide rune
+		e.alignCursorToRune()
 	}
 	return nil
 }
@@ -1394,27 +1577,25 @@ func (e *Editor) UpEnd(c *vt100.Canvas) error {
 		if e.pos.sx < len(expandedRunes) && expandedRunes[e.pos.sx] == '\t' {
 			e.pos.sx = int(e.FirstScreenPosition(e.DataY()))
 		}
+
+		// Do not place the cursor in the middle of a wide rune
+		e.alignCursorToRune()
 	}
 	return nil
 }
 
 // Next will move the cursor to the next position in the contents
 func (e *Editor) Next(c *vt100.Canvas) error {
-	// Ignore it if the position is out of bounds
-	atTab := e.Rune() == '\t'
-	if atTab {
-		e.pos.sx += e.indentation.PerTab
-	} else {
-		e.pos.sx++
+	// Move past tabs and wide runes, and one step after the end of the line
+	columns := 1
+	if r := e.Rune(); r != 0 {
+		columns = e.runeColumns(r)
 	}
+	e.pos.sx += columns
 	// Did we move too far on this line?
 	if e.AfterLineScreenContentsPlusOne() {
 		// Undo the move
-		if atTab {
-			e.pos.sx -= e.indentation.PerTab
-		} else {
-			e.pos.sx--
-		}
+		e.pos.sx -= columns
 		// Move down
 		err := e.pos.Down(c)
 		if err != nil {
@@ -1451,26 +1632,21 @@ func (e *Editor) TabToTheLeft() bool {
 // Prev will move the cursor to the previous position in the contents
 func (e *Editor) Prev(c *vt100.Canvas) error {
 
-	atTab := e.TabToTheLeft() || (e.pos.sx <= e.indentation.PerTab && e.Get(0, e.DataY()) == '\t')
+	columns := e.leftRuneColumns()
+	if e.pos.sx <= e.indentation.PerTab && e.Get(0, e.DataY()) == '\t' {
+		columns = e.indentation.PerTab
+	}
 	if e.pos.sx == 0 && e.pos.offsetX > 0 {
 		// at left edge, but can scroll to the left
 		e.pos.offsetX--
 		e.redraw = true
 	} else {
-		// If at a tab character, move a few more positions
-		if atTab {
-			e.pos.sx -= e.indentation.PerTab
-		} else {
-			e.pos.sx--
-		}
+		// If at a tab character or a wide rune, move a few more positions
+		e.pos.sx -= columns
 	}
 	if e.pos.sx < 0 { // Did we move too far and there is no X offset?
 		// Undo the move
-		if atTab {
-			e.pos.sx += e.indentation.PerTab
-		} else {
-			e.pos.sx++
-		}
+		e.pos.sx += columns
 		// Move up, and to the end of the line above, if in EOL mode
 		err := e.pos.Up()
 		if err != nil {
@@ -1689,7 +1865,16 @@ func (e *Editor) AfterLineScreenContentsPlusOne() bool {
 // WriteRune writes the current rune to the given canvas
 func (e *Editor) WriteRune(c *vt100.Canvas) {
 	if c != nil {
-		c.WriteRune(uint(e.pos.sx+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, e.Rune())
+		x, y, r := uint(e.pos.sx+e.pos.offsetX), uint(e.pos.sy+e.topRows()), e.Rune()
+		if runeWidth(r) == 0 {
+			// Combining marks are drawn together with the rune before them, when the line is drawn
+			return
+		}
+		c.WriteRune(x, y, e.Foreground, e.Background, r)
+		if runeWidth(r) == 2 {
+			// The wide rune covers the next cell as well
+			c.WriteRune(x+1, y, e.Foreground, e.Background, wideRunePlaceholder)
+		}
 	}
 }
 
@@ -1697,7 +1882,7 @@ func (e *Editor) WriteRune(c *vt100.Canvas) {
 func (e *Editor) WriteTab(c *vt100.Canvas) {
 	spacesPerTab := e.indentation.PerTab
 	for x := e.pos.sx; x < e.pos.sx+spacesPerTab; x++ {
-		c.WriteRune(uint(x+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, ' ')
+		c.WriteRune(uint(x+e.pos.offsetX), uint(e.pos.sy+e.topRows()), e.Foreground, e.Background, ' ')
 	}
 }
 
@@ -1900,7 +2085,24 @@ func (e *Editor) StatusMessage() string {
 	if !e.indentation.Spaces {
 		indentations = " tabs"
 	}
-	return fmt.Sprintf("line %d col %d rune %U words %d [%s]%s", e.LineNumber(), e.ColNumber(), e.Rune(), e.WordCount(), e.mode, indentations)
+	overwrite := ""
+	if e.overwriteMode {
+		overwrite = " OVR"
+	}
+	textFormat := ""
+	if !e.binaryFile {
+		textFormat = " " + e.textFormat.String()
+	}
+	trailingBlankLines := ""
+	if n := e.TrailingBlankLines(); n > 0 {
+		trailingBlankLines = fmt.Sprintf(" trailing blank lines %d", n)
+	}
+	words, proseWords := e.WordCounts()
+	wordCount := strconv.Itoa(words)
+	if e.proseMode() {
+		wordCount += fmt.Sprintf(" (prose %d)", proseWords)
+	}
+	return fmt.Sprintf("line %d col %d rune %U words %s%s [%s]%s%s%s", e.LineNumber(), e.ColNumber(), e.Rune(), wordCount, trailingBlankLines, e.mode, indentations, textFormat, overwrite)
 }
 
 // GoToPosition can go to the given position struct and use it as the new position
@@ -1994,21 +2196,21 @@ func (e *Editor) Center(c *vt100.Canvas) {
 	e.pos.sy = newScreenY
 }
 
-// CommentOn will insert a comment marker (like # or //) in front of a line
-func (e *Editor) CommentOn(commentMarker string) {
+// CommentOn will insert a comment marker (like # or //) in front of the given line
+func (e *Editor) CommentOn(y LineIndex, commentMarker string) {
 	space := " "
 	if e.mode == mode.Config { // For config files, assume things will be toggled in and out, without a space
 		space = ""
 	}
-	e.SetCurrentLine(commentMarker + space + e.CurrentLine())
+	e.SetLine(y, commentMarker+space+e.Line(y))
 }
 
-// CommentOff will remove "//" or "// " from the front of the line if "//" is given
-func (e *Editor) CommentOff(commentMarker string) {
+// CommentOff will remove "//" or "// " from the front of the given line if "//" is given
+func (e *Editor) CommentOff(y LineIndex, commentMarker string) {
 	var (
 		changed      bool
 		newContents  string
-		contents     = e.CurrentLine()
+		contents     = e.Line(y)
 		trimContents = strings.TrimSpace(contents)
 	)
 	commentMarkerPlusSpace := commentMarker + " "
@@ -2022,121 +2224,28 @@ func (e *Editor) CommentOff(commentMarker string) {
 		changed = true
 	}
 	if changed {
-		e.SetCurrentLine(newContents)
-		// If the line was shortened and the cursor ended up after the line, move it
-		if e.AfterEndOfLine() {
-			e.End(nil)
-		}
+		e.SetLine(y, newContents)
 	}
 }
 
-// CurrentLineCommented checks if the current trimmed line starts with "//", if "//" is given
-func (e *Editor) CurrentLineCommented(commentMarker string) bool {
-	return strings.HasPrefix(e.TrimmedLine(), commentMarker)
-}
-
-// ForEachLineInBlock will move the cursor and run the given function for
-// each line in the current block of text (until newline or end of document)
-// Also takes a string that will be passed on to the function.
-func (e *Editor) ForEachLineInBlock(c *vt100.Canvas, f func(string), commentMarker string) {
-	downCounter := 0
-	for !e.EmptyRightTrimmedLine() {
-		f(commentMarker)
-		if e.AtOrAfterEndOfDocument() {
-			break
-		}
-		if e.Down(c, nil) { // reached the end
-			break
-		}
-		downCounter++
-		if downCounter > 10 { // safeguard
-			break
-		}
-	}
-	// Go up again
-	for i := downCounter; i > 0; i-- {
-		e.Up(c, nil)
-	}
+// LineCommented checks if the given trimmed line starts with "//", if "//" is given
+func (e *Editor) LineCommented(y LineIndex, commentMarker string) bool {
+	return strings.HasPrefix(strings.TrimSpace(e.Line(y)), commentMarker)
 }
 
 // Block will return the text from the given line until
 // either a newline or the end of the document.
 func (e *Editor) Block(n LineIndex) string {
-	var (
-		bb, lb strings.Builder // block string builder and line string builder
-		line   []rune
-		ok     bool
-		s      string
-	)
-	for {
-		line, ok = e.lines[int(n)]
-		n++
-		if !ok || len(line) == 0 {
-			// End of document, empty line or invalid line: end of block
-			return bb.String()
-		}
-		lb.Reset()
-		for _, r := range line {
-			lb.WriteRune(r)
-		}
-		s = lb.String()
-		if len(strings.TrimSpace(s)) == 0 {
-			// Empty trimmed line, end of block
-			return bb.String()
-		}
-		// Save this line to bb
-		bb.WriteString(s)
-		// And add a newline
-		bb.Write([]byte{'\n'})
-	}
+	return e.RangeString(e.BlockAt(n))
 }
 
 // ToggleCommentBlock will toggle comments until a blank line or the end of the document is reached
 // The amount of existing commented lines is considered before deciding to comment the block in or out
-func (e *Editor) ToggleCommentBlock(c *vt100.Canvas) {
-	// If most of the lines in the block are comments, comment it out
-	// If most of the lines in the block are not comments, comment it in
-
-	var (
-		downCounter    = 0
-		commentCounter = 0
-		commentMarker  = e.SingleLineCommentMarker()
-	)
-
-	// Count the commented lines in this block while going down
-	for !e.EmptyRightTrimmedLine() {
-		if e.CurrentLineCommented(commentMarker) {
-			commentCounter++
-		}
-		if e.AtOrAfterEndOfDocument() {
-			break
-		}
-		if e.Down(c, nil) { // reached the end
-			break
-		}
-		// TODO: Remove the safeguard
-		downCounter++
-		if downCounter > 10 { // safeguard at the end of the document
-			break
-		}
-	}
-	// Go up again
-	for i := downCounter; i > 0; i-- {
-		e.Up(c, nil)
-	}
-
-	// Check if most lines are commented out
-	mostLinesAreComments := commentCounter >= (downCounter / 2)
-
-	// Handle the single-line case differently
-	if downCounter == 1 && commentCounter == 0 {
-		e.CommentOn(commentMarker)
-	} else if downCounter == 1 && commentCounter == 1 {
-		e.CommentOff(commentMarker)
-	} else if mostLinesAreComments {
-		e.ForEachLineInBlock(c, e.CommentOff, commentMarker)
-	} else {
-		e.ForEachLineInBlock(c, e.CommentOn, commentMarker)
+func (e *Editor) ToggleCommentBlock() {
+	e.ToggleCommentRange(e.BlockAt(e.DataY()))
+	// If the line was shortened and the cursor ended up after the line, move it
+	if e.AfterEndOfLine() {
+		e.End(nil)
 	}
 }
 
@@ -2148,25 +2257,75 @@ func (e *Editor) NewLine(c *vt100.Canvas, status *StatusBar) {
 
 // ChopLine takes a string where the tabs have been expanded
 // and scrolls it + chops it up for display in the current viewport.
-// e.pos.offsetX and the given viewportWidth are respected.
+// e.pos.offsetX and the given viewportWidth are respected, as columns.
+// Each wide rune is followed by wideRunePlaceholder, so that each rune in the returned string is one cell,
+// and a wide rune that would be split in half by the edges of the viewport is replaced by a space.
+// Combining marks are drawn together with the rune before them, as a precomposed rune or as controlRuneReplacement.
 func (e *Editor) ChopLine(line string, viewportWidth int) string {
-	var screenLine string
-	// Shorten the screen line to account for the X offset
-	if utf8.RuneCountInString(line) > e.pos.offsetX {
-		screenLine = line[e.pos.offsetX:]
+	if viewportWidth <= 0 {
+		return ""
 	}
-	// Shorten the screen line to account for the terminal width
-	if len(string(screenLine)) >= viewportWidth {
-		screenLine = screenLine[:viewportWidth]
+	// Find the byte positions of the first and last rune that are visible, without going through the rest of
+	// the line, since the line may be very long
+	var (
+		start, end = len(line), len(line)
+		column     = 0
+		wide       = false
+		from, to   = e.pos.offsetX, e.pos.offsetX + viewportWidth
+	)
+	for i, r := range line {
+		if column >= to {
+			end = i
+			break
+		}
+		if column >= from && start == len(line) {
+			start = i
+		}
+		w := runeWidth(r)
+		if w != 1 {
+			wide = true
+		}
+		column += w
+	}
+	if !wide {
+		return line[start:end]
+	}
+	var chopped []rune
+	column = 0
+	for _, r := range line {
+		w := runeWidth(r)
+		switch {
+		case w == 0:
+			// Draw a combining mark together with the rune before it, if that rune is in a single cell
+			if column > from && len(chopped) > 0 && chopped[len(chopped)-1] != wideRunePlaceholder {
+				chopped[len(chopped)-1] = combineRune(chopped[len(chopped)-1], r)
+			}
+		case column+w <= from:
+		case column < from || column+w > to:
+			// Only part of the wide rune is visible
+			for i := column; i < column+w; i++ {
+				if i >= from && i < to {
+					chopped = append(chopped, ' ')
+				}
+			}
+		case w > 1:
+			chopped = append(chopped, r, wideRunePlaceholder)
+		default:
+			chopped = append(chopped, r)
+		}
+		column += w
+		if column >= to {
+			break
+		}
 	}
-	return screenLine
+	return string(chopped)
 }
 
 // HorizontalScrollIfNeeded will scroll along the X axis, if needed
 func (e *Editor) HorizontalScrollIfNeeded(c *vt100.Canvas) {
 	x := e.pos.sx
 	w := 80
-	if c != nil {
+	if c != nil && c.W() > 0 {
 		w = int(c.W())
 	}
 	if x < w {
@@ -2202,7 +2361,7 @@ func (e *Editor) InsertFile(c *vt100.Canvas, filename string) error {
 	if err != nil {
 		return err
 	}
-	s := opinionatedStringReplacer.Replace(strings.TrimRightFunc(string(data), unicode.IsSpace))
+	s := e.stringReplacer().Replace(strings.TrimRightFunc(string(data), unicode.IsSpace))
 	e.InsertStringAndMove(c, s)
 	return nil
 }
@@ -2217,58 +2376,84 @@ func (e *Editor) AbsFilename() (string, error) {
 	return filepath.Clean(absFilename), nil
 }
 
-// Switch replaces the current editor with a new Editor that opens the given file.
-// The undo stack is also swapped.
-// Only works for switching to one file, and then back again.
+// Switch replaces the current editor with an Editor for the given file.
+// The current file is kept in the ring of open buffers, together with its undo stack.
+// If the given file is already in the ring, it is shown as it was, with its own undo stack.
 func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filenameToOpen string, forceOpen bool) error {
 
 	absFilename, err := e.AbsFilename()
 	if err != nil {
 		return err
 	}
+	absFilenameToOpen, err := filepath.Abs(filenameToOpen)
+	if err != nil {
+		return err
+	}
+	absFilenameToOpen = filepath.Clean(absFilenameToOpen)
+	if absFilenameToOpen == absFilename {
+		return nil
+	}
 
-	// About to switch from absFilename to filenameToOpen
-
-	// Unlock and save the lock file
-	lk.Unlock(absFilename)
-	lk.Save()
-	// Now open the header filename instead of the current file. Save the current file first.
-	e.Save(c, tty)
-	// Save the current location in the location history and write it to file
-	e.SaveLocation(absFilename, locationHistory)
+	// Save the current file before switching, with the same checks as when pressing ctrl-s. Read-only files,
+	// the man page preview and files that have been released to another instance of the editor are never saved.
+	if e.changed && !e.readOnly && !e.manPagePreview && !e.lockReleased && !e.UserSave(c, tty, status, undo) {
+		return errors.New("not switching files, since " + e.filename + " was not saved")
+	}
 
+	// Use the open buffer for the file, if there is one, or else open the file
 	var (
-		e2            *Editor
+		e2            = &Editor{}
+		u2            *Undo
 		statusMessage string
+		searchState   = e.SearchState()
+		buildErrors   = e.buildErrors
 	)
-
-	if switchBuffer.Len() == 1 {
-		// Load the Editor from the switchBuffer if switchBuffer has length 1, then use that editor.
-		switchBuffer.Restore(e)
-		undo, switchUndoBackup = switchUndoBackup, undo
+	if b := openBuffers.Take(absFilenameToOpen); b != nil && b.state.Restore(e2) == nil {
+		u2 = b.undo
 	} else {
 		fnord := FilenameOrData{filenameToOpen, []byte{}, 0}
 		e2, statusMessage, err = NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false)
-		if err == nil { // no issue
-			// Save the current Editor to the switchBuffer if switchBuffer if empty, then use the new editor.
-			switchBuffer.Snapshot(e)
-
-			// Now use e2 as the current editor
-			*e = *e2
-			(*e).lines = (*e2).lines
-			(*e).pos = (*e2).pos
-		} else {
-			// logf("While switching from %s to %s, got error: %s\n", absFilename, filenameToOpen, err)
-			panic(err)
+		if err != nil {
+			return err
 		}
-		fnord.SetTitle()
-		undo, switchUndoBackup = switchUndoBackup, undo
+		u2 = NewUndo(defaultUndoCount, defaultUndoMemory)
+	}
+
+	// About to switch from absFilename to absFilenameToOpen
+
+	// Unlock and save the lock file
+	lk.Unlock(absFilename)
+	lk.Save()
+	// Save the current location in the location history and write it to file
+	e.SaveLocation(absFilename, loadedLocationHistory())
+	// Keep the current file, with its undo stack, in the ring of open buffers
+	openBuffers.Push(e, undo)
+
+	// Now use e2 as the current editor, and lock the file if it is not locked by another instance
+	*e = *e2
+	undo = u2
+	if lk.Lock(absFilenameToOpen) == nil {
+		lk.Save()
 	}
+	fnord := FilenameOrData{filename: e.filename}
+	fnord.SetTitle()
 
 	if statusMessage != "" {
 		status.SetMessageAfterRedraw(statusMessage)
 	}
 
+	// Always start in insert mode after switching
+	e.overwriteMode = false
+
+	// Keep on searching for the same term in the file that was switched to
+	e.RestoreSearchState(searchState)
+
+	// Keep the errors from the last build, which may be in several files
+	e.buildErrors = buildErrors
+
+	// Run the after-open hooks for the file that was switched to, without waiting for them
+	e.RunHooksInBackground(c, status, hookAfterOpen)
+
 	e.redraw = true
 	e.redrawCursor = true
 
@@ -2290,11 +2475,16 @@ func (e *Editor) LineContentsFromCursorPosition() string {
 	return strings.TrimSpace(e.CurrentLine()[x:])
 }
 
+// isWordAtCursorRune checks if the given rune can be part of the word that WordAtCursor returns
+func isWordAtCursorRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.'
+}
+
 // WordAtCursor returns the current word under the cursor, or an empty string.
 // The word may contain numbers or dashes, but not spaces or special characters.
 func (e *Editor) WordAtCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lineRunes(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2311,12 +2501,8 @@ func (e *Editor) WordAtCursor() string {
 		x = len(runes)
 	}
 
-	qualifies := func(r rune) bool {
-		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.'
-	}
-
 	// Check if the cursor is at a word
-	if !qualifies(runes[x]) {
+	if x >= len(runes) || !isWordAtCursorRune(runes[x]) {
 		return ""
 	}
 
@@ -2324,7 +2510,7 @@ func (e *Editor) WordAtCursor() string {
 	firstLetterIndex := 0
 	for i := x; i >= 0; i-- {
 		r := runes[i]
-		if !qualifies(r) {
+		if !isWordAtCursorRune(r) {
 			break
 		}
 		firstLetterIndex = i
@@ -2335,7 +2521,7 @@ func (e *Editor) WordAtCursor() string {
 	var word []rune
 	for i := firstLetterIndex; i < len(runes); i++ {
 		r := runes[i]
-		if !qualifies(r) {
+		if !isWordAtCursorRune(r) {
 			break
 		}
 		// Gather the letters
@@ -2349,7 +2535,7 @@ func (e *Editor) WordAtCursor() string {
 // LettersBeforeCursor returns the current word up until the cursor (for autocompletion)
 func (e *Editor) LettersBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lineRunes(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2384,7 +2570,7 @@ func (e *Editor) LettersBeforeCursor() string {
 // Will also include ".".
 func (e *Editor) LettersOrDotBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lineRunes(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2435,7 +2621,7 @@ func (e *Editor) UserInput(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, t
 			e.DrawFlags(c, false)        // don't reposition cursor
 			e.DrawGDBOutput(c, false)    // don't reposition cursor
 		}
-		pressed := tty.String()
+		pressed := readKey(tty)
 		switch pressed {
 		case "c:8", "c:127": // ctrl-h or backspace
 			if len(entered) > 0 {
@@ -2462,7 +2648,12 @@ func (e *Editor) UserInput(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, t
 			fallthrough // done
 		case "c:13": // return
 			doneCollectingLetters = true
+		case "", keyHome, keyEnd, keyCtrlHome, keyCtrlEnd, keyInsert, keyShiftUp, keyShiftDown, keyShiftRight, keyShiftLeft, keyCtrlLeft, keyCtrlRight, keyAltLeft, keyAltRight, keyAltUp, keyAltDown, keyAltBackspace, keyShiftTab:
+			// Ignore unrecognized and positional keys
 		default:
+			if isMouseKey(pressed) {
+				break
+			}
 			entered += pressed
 			status.SetMessage(title + ": " + entered)
 			status.ShowNoTimeout(c, e)
@@ -2551,31 +2742,14 @@ func (e *Editor) GoToEnd(c *vt100.Canvas, status *StatusBar) {
 	e.redraw = e.GoToLineNumber(LineNumber(e.Len()), c, status, true)
 }
 
-// SortBlock sorts the a block of lines, at the current position
-func (e *Editor) SortBlock(c *vt100.Canvas, status *StatusBar, bookmark *Position) {
+// SortBlock sorts the a block of lines, at the current position, according to the given sort options
+func (e *Editor) SortBlock(c *vt100.Canvas, status *StatusBar, bookmark *Position, opts SortOptions) {
 	if e.CurrentLine() == "" {
 		status.SetErrorMessage("no text block at the current position")
 		return
 	}
 	y := e.LineIndex()
-	s := e.Block(y)
-	var lines sort.StringSlice
-	lines = strings.Split(s, "\n")
-	if len(lines) == 0 {
-		status.SetErrorMessage("no text block to sort")
-		return
-	}
-	// Remove the last empty line, if it's there
-	addEmptyLine := false
-	if lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
-		addEmptyLine = true
-	}
-	lines.Sort()
-	e.GoTo(y, c, status)
-	e.DeleteBlock(bookmark)
-	e.GoTo(y, c, status)
-	e.InsertBlock(c, lines, addEmptyLine)
+	e.SortRange(e.BlockAt(y), opts, bookmark)
 	e.GoTo(y, c, status)
 }
 
@@ -2586,62 +2760,6 @@ func (e *Editor) ReplaceBlock(c *vt100.Canvas, status *StatusBar, bookmark *Posi
 		return
 	}
 	y := e.LineIndex()
-	lines := strings.Split(s, "\n")
-	if len(lines) == 0 {
-		status.SetErrorMessage("no text block to replace")
-		return
-	}
-	// Remove the last empty line, if it's there
-	addEmptyLine := false
-	if lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
-		addEmptyLine = true
-	}
-	e.GoTo(y, c, status)
-	e.DeleteBlock(bookmark)
-	e.GoTo(y, c, status)
-	e.InsertBlock(c, lines, addEmptyLine)
+	e.ReplaceRange(e.BlockAt(y), strings.Split(strings.TrimSuffix(s, "\n"), "\n"), bookmark)
 	e.GoTo(y, c, status)
 }
-
-// DeleteBlock will deletes a block of lines at the current position
-func (e *Editor) DeleteBlock(bookmark *Position) {
-	s := e.Block(e.LineIndex())
-	lines := strings.Split(s, "\n")
-	if len(lines) == 0 {
-		// Need at least 1 line to be able to cut "the rest" after the first line has been cut
-		return
-	}
-	for range lines {
-		e.DeleteLineMoveBookmark(e.LineIndex(), bookmark)
-	}
-}
-
-// InsertBlock will insert multiple lines at the current position, without trimming
-// If addEmptyLine is true, an empty line will be added at the end
-func (e *Editor) InsertBlock(c *vt100.Canvas, addLines []string, addEmptyLine bool) {
-	e.InsertLineAbove()
-	// copyLines contains the lines to be pasted, and they are > 1
-	// the first line is skipped since that was already pasted when ctrl-v was pressed the first time
-	lastIndex := len(addLines[1:]) - 1
-	// If the first line has been pasted, and return has been pressed, paste the rest of the lines differently
-	skipFirstLineInsert := e.EmptyRightTrimmedLine()
-	// Insert the lines
-	for i, line := range addLines {
-		if i == lastIndex && len(strings.TrimSpace(line)) == 0 {
-			// If the last line is blank, skip it
-			break
-		}
-		if skipFirstLineInsert {
-			skipFirstLineInsert = false
-		} else {
-			e.InsertLineBelow()
-			e.Down(c, nil) // no status message if the end of document is reached, there should always be a new line
-		}
-		e.InsertStringAndMove(c, line)
-	}
-	if addEmptyLine {
-		e.InsertLineBelow()
-		e.Down(c, nil) // no status message if the end of document is reached, there should always be a new line
-	}
-}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/xyproto/mode"
 )
@@ -78,3 +83,398 @@ func ExampleEditor_InsertRune() {
 	// text
 	//  -- comment
 }
+
+func TestHomeEndCycleLongLine(t *testing.T) {
+	// With a nil canvas, the canvas is assumed to be 80 columns wide
+	e := NewSimpleEditor(80)
+	longLine := "    " + strings.Repeat("x", 296)
+	e.SetLine(0, "first")
+	e.SetLine(1, longLine)
+	e.SetLine(2, "third")
+	e.GoTo(1, nil, nil)
+
+	// Start in the middle of the long line, scrolled horizontally
+	e.GoToDataX(nil, 150)
+	if x, _ := e.DataX(); x != 150 || e.pos.offsetX == 0 {
+		t.Fatalf("expected data x 150 with a horizontal scroll offset, got %d and offset %d", x, e.pos.offsetX)
+	}
+
+	// ctrl-a: start of text, start of line, then the end of the previous line
+	e.HomeCycle(nil, nil, false)
+	if x, _ := e.DataX(); x != 4 || e.DataY() != 1 || e.pos.offsetX != 0 {
+		t.Errorf("expected the start of the text, got x %d, y %d, offset %d", x, e.DataY(), e.pos.offsetX)
+	}
+	e.HomeCycle(nil, nil, false)
+	if x, _ := e.DataX(); x != 0 || e.DataY() != 1 {
+		t.Errorf("expected the start of the line, got x %d, y %d", x, e.DataY())
+	}
+	e.HomeCycle(nil, nil, false)
+	if x, _ := e.DataX(); x != 5 || e.DataY() != 0 {
+		t.Errorf("expected the end of the previous line, got x %d, y %d", x, e.DataY())
+	}
+
+	// ctrl-e: the end of the long line, with scrolling, then the start of the next line
+	e.GoTo(1, nil, nil)
+	e.GoToDataX(nil, 10)
+	e.EndCycle(nil, nil, false)
+	if x, _ := e.DataX(); x != 300 || e.DataY() != 1 || e.pos.offsetX == 0 || e.pos.sx >= 80 {
+		t.Errorf("expected the end of the long line, got x %d, y %d, sx %d, offset %d", x, e.DataY(), e.pos.sx, e.pos.offsetX)
+	}
+	e.EndCycle(nil, nil, false)
+	if x, _ := e.DataX(); x != 0 || e.DataY() != 2 || e.pos.offsetX != 0 {
+		t.Errorf("expected the start of the next line, got x %d, y %d, offset %d", x, e.DataY(), e.pos.offsetX)
+	}
+
+	// ctrl-e right after moving down should stay on the line
+	e.GoTo(1, nil, nil)
+	e.EndCycle(nil, nil, true)
+	e.EndCycle(nil, nil, true)
+	if x, _ := e.DataX(); x != 300 || e.DataY() != 1 {
+		t.Errorf("expected to stay at the end of the long line, got x %d, y %d", x, e.DataY())
+	}
+}
+
+func TestOverwriteMode(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "abcdef")
+	e.GoTo(0, nil, nil)
+	e.ToggleOverwriteMode()
+
+	e.OverwriteRune(nil, 'x')
+	e.OverwriteRune(nil, 'y')
+	if line := e.Line(0); line != "xycdef" {
+		t.Errorf("expected xycdef, got %s", line)
+	}
+	e.OverwriteBackspace(nil)
+	if line := e.Line(0); line != "x cdef" {
+		t.Errorf("expected backspace to leave a space, got %s", line)
+	}
+
+	// Overwriting past the end of the line appends
+	e.GoToDataX(nil, 6)
+	e.OverwriteRune(nil, 'z')
+	if line := e.Line(0); line != "x cdefz" {
+		t.Errorf("expected x cdefz, got %s", line)
+	}
+
+	// Backspace at the start of a line does not join lines
+	e.SetLine(1, "second")
+	e.GoTo(1, nil, nil)
+	e.OverwriteBackspace(nil)
+	if e.Len() != 2 || e.Line(1) != "second" {
+		t.Errorf("expected the lines to be left as they are, got %q", e.Line(1))
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		line, nextLine, commentMarker, expected string
+	}{
+		{"foo", "        bar", "//", "foo bar"},
+		{"", "    bar", "//", "    bar"},
+		{"    ", "\tbar", "//", "\tbar"},
+		{"foo", "", "//", "foo"},
+		{"foo(", "    a, b)", "//", "foo(a, b)"},
+		{"x := []int{", "\t1, 2}", "//", "x := []int{1, 2}"},
+		{"foo ", "  bar", "//", "foo bar"},
+		{"    // first part", "    // second part", "//", "    // first part second part"},
+		{"# first", "#   second", "#", "# first second"},
+		{"    // comment", "    code()", "//", "    // comment code()"},
+		{"x = 1", "# comment", "//", "x = 1 # comment"},
+	}
+	for _, test := range tests {
+		if got := joinLines(test.line, test.nextLine, test.commentMarker); got != test.expected {
+			t.Errorf("joinLines(%q, %q) = %q, expected %q", test.line, test.nextLine, got, test.expected)
+		}
+	}
+}
+
+func TestDeleteAtEndOfLine(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "\tif x {")
+	e.SetLine(1, "\t\treturn")
+	e.SetLine(2, "")
+	e.SetLine(3, "\t}")
+	e.GoTo(0, nil, nil)
+	e.GoToDataX(nil, 7)
+	e.Delete()
+	if e.Line(0) != "\tif x {return" || e.Len() != 3 {
+		t.Errorf("expected the lines to be joined without a space after the bracket, got %q", e.Line(0))
+	}
+	// Joining with an empty line below removes the empty line
+	e.GoToDataX(nil, 13)
+	e.Delete()
+	if e.Line(0) != "\tif x {return" || e.Line(1) != "\t}" || e.Len() != 2 {
+		t.Errorf("expected the empty line to be removed, got %q and %q", e.Line(0), e.Line(1))
+	}
+	// Joining collapses the indentation of the line below to a single space
+	e.Delete()
+	if e.Line(0) != "\tif x {return }" || e.Len() != 1 {
+		t.Errorf("expected the indentation to be collapsed, got %q", e.Line(0))
+	}
+}
+
+func TestLoadBytesFinalNewline(t *testing.T) {
+	tests := []struct {
+		data           string
+		length         int
+		empty          bool
+		noFinalNewline bool
+		contents       string
+	}{
+		{"", 1, true, false, "\n"},
+		{"\n", 1, true, false, "\n"},
+		{"x", 1, false, true, "x\n"},
+		{"x\n", 1, false, false, "x\n"},
+		{"x\n\n", 2, false, false, "x\n\n"},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.LoadBytes([]byte(test.data))
+		if e.Len() != test.length {
+			t.Errorf("%q: expected Len() to be %d, got %d", test.data, test.length, e.Len())
+		}
+		if e.Empty() != test.empty {
+			t.Errorf("%q: expected Empty() to be %v", test.data, test.empty)
+		}
+		if e.Empty() && len(e.lines) != e.Len() {
+			t.Errorf("%q: expected %d lines, got %d", test.data, e.Len(), len(e.lines))
+		}
+		if e.noFinalNewline != test.noFinalNewline {
+			t.Errorf("%q: expected noFinalNewline to be %v", test.data, test.noFinalNewline)
+		}
+		if e.String() != test.contents {
+			t.Errorf("%q: expected the contents %q, got %q", test.data, test.contents, e.String())
+		}
+	}
+}
+
+func TestSaveBinaryWithoutFinalNewline(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.bin")
+	data := []byte{0, 1, 2, '\n', 3, 4}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.binaryFile = true
+	e.LoadBytes(data)
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != string(data) {
+		t.Errorf("expected the binary file to be saved as it was, got %v", saved)
+	}
+}
+
+func TestSaveSkipsUnchangedFile(t *testing.T) {
+	for _, name := range []string{"hello.txt", "hello.txt.gz"} {
+		filename := filepath.Join(t.TempDir(), name)
+		e := NewSimpleEditor(80)
+		e.filename = filename
+		e.LoadBytes([]byte("hello\n"))
+		if err := e.Save(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if e.skippedSave {
+			t.Fatalf("%s: expected the file to be written the first time", name)
+		}
+		if !sameAsOnDisk(filename, []byte("hello\n")) || sameAsOnDisk(filename, []byte("hello!\n")) {
+			t.Errorf("%s: unexpected comparison with the contents on disk", name)
+		}
+
+		// Saving the same contents again does not write the file
+		oldTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := os.Chtimes(filename, oldTime, oldTime); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Save(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Stat(filename); err != nil || !e.skippedSave || !fi.ModTime().Equal(oldTime) {
+			t.Errorf("%s: expected the write to be skipped", name)
+		}
+
+		// Unless forced
+		e.forceSave = true
+		if err := e.Save(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if fi, err := os.Stat(filename); err != nil || e.skippedSave || fi.ModTime().Equal(oldTime) {
+			t.Errorf("%s: expected a forced save to write the file", name)
+		}
+		if e.forceSave {
+			t.Errorf("%s: expected forceSave to only apply once", name)
+		}
+	}
+}
+
+func TestLineStorage(t *testing.T) {
+	e := NewSimpleEditor(80)
+	if e.Len() != 1 || !e.Empty() {
+		t.Fatalf("expected an empty editor to have one empty line, got %d lines", e.Len())
+	}
+	// Setting a rune after the last line creates the lines in between
+	e.Set(2, 3, 'x')
+	if e.Len() != 4 || e.Line(3) != "  x" || e.Line(1) != "" {
+		t.Errorf("unexpected contents: %q", e.String())
+	}
+	e.LoadBytes([]byte("a\nb\nc\nd\n"))
+	e.InsertLineBelowAt(1)
+	if got := e.String(); got != "a\nb\n\nc\nd\n" {
+		t.Errorf("expected a blank line after b, got %q", got)
+	}
+	e.DeleteLine(0)
+	e.DeleteLine(LineIndex(e.Len() - 1))
+	if got := e.String(); got != "b\n\nc\n" {
+		t.Errorf("expected the first and last line to be deleted, got %q", got)
+	}
+	if e.Block(0) != "b\n" || e.Get(0, 2) != 'c' || e.Get(5, 2) != ' ' || e.Get(0, 10) != ' ' {
+		t.Error("unexpected block or runes")
+	}
+	lines := e.CopyLines()
+	e.SetLine(0, "changed")
+	if string(lines[0]) != "b" {
+		t.Error("expected CopyLines to return a copy")
+	}
+}
+
+func BenchmarkInsertAndDeleteLines(b *testing.B) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte(strings.Repeat("package main // a line of code\n", 100000)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.InsertLineBelowAt(50000)
+		e.DeleteLine(50001)
+		if e.Len() != 100000 {
+			b.Fatalf("expected 100000 lines, got %d", e.Len())
+		}
+	}
+}
+
+func TestSaveAtomically(t *testing.T) {
+	dir := t.TempDir()
+
+	// The permissions of an existing file are kept
+	filename := filepath.Join(dir, "private.txt")
+	if err := os.WriteFile(filename, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.LoadBytes([]byte("new\n"))
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the permissions to be kept, got %v", fi.Mode().Perm())
+	}
+
+	// Saving through a symbolic link updates the file that the link points to
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(filename, link); err != nil {
+		t.Skip(err)
+	}
+	e.filename = link
+	e.LoadBytes([]byte("through the link\n"))
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symbolic link to be kept")
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != "through the link\n" {
+		t.Errorf("expected the link target to be updated, got %q", data)
+	}
+
+	// Scripts are made executable, without changing the other permissions
+	script := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(script, []byte(""), 0640); err != nil {
+		t.Fatal(err)
+	}
+	e = NewSimpleEditor(80)
+	e.filename = script
+	e.mode = mode.Shell
+	e.syntaxHighlight = true
+	e.LoadBytes([]byte("#!/bin/sh\necho hi\n"))
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(script); err != nil || fi.Mode().Perm() != 0750 {
+		t.Errorf("expected the script to be executable, got %v", fi.Mode().Perm())
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected only the saved files and the link, got %d files", len(entries))
+	}
+}
+
+func TestSaveKeepsFileAttributes(t *testing.T) {
+	dir := t.TempDir()
+
+	// The setgid bit and the group and other permissions are kept when a script is made executable
+	script := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(script, []byte(""), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(script, 0640|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = script
+	e.mode = mode.Shell
+	e.syntaxHighlight = true
+	e.LoadBytes([]byte("#!/bin/sh\necho hi\n"))
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(script); err != nil || permissionBits(fi.Mode()) != 0750|os.ModeSetgid {
+		t.Errorf("expected the setgid bit to be kept, got %v", fi.Mode())
+	}
+	if e.saveWarning != nil {
+		t.Errorf("did not expect a warning, got %v", e.saveWarning)
+	}
+
+	// The permissions the file had when it was loaded are used if it has been removed since then
+	filename := filepath.Join(dir, "private.txt")
+	if err := os.WriteFile(filename, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e = NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filename); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the permissions from when the file was loaded, got %v", fi.Mode().Perm())
+	}
+
+	// The owner is kept when root edits a file owned by someone else
+	if os.Geteuid() == 0 {
+		if err := os.Chown(filename, 1234, 1234); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Save(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st := fi.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 1234 {
+			t.Errorf("expected the owner to be kept, got %d:%d", st.Uid, st.Gid)
+		}
+	}
+}
@@ -52,15 +52,10 @@ func (e *Editor) exportAdoc(c *vt100.Canvas, tty *vt100.TTY, manFilename string)
 		return errors.New(tmpfn + " already exists, please remove it")
 	}
 
-	// TODO: Write a SaveAs function for the Editor
-	oldFilename := e.filename
-	e.filename = tmpfn
-	err := e.Save(c, tty)
+	err := e.SaveTemporary(c, tty, tmpfn)
 	if err != nil {
-		e.filename = oldFilename
 		return err
 	}
-	e.filename = oldFilename
 
 	// Run asciidoctor
 	adocCommand := exec.Command("asciidoctor", "-b", "manpage", "-o", manFilename, tmpfn)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepAttributesError is returned when a file was saved, but its permissions could not be kept or set
+type keepAttributesError struct {
+	filename string
+	err      error
+}
+
+func (kae *keepAttributesError) Error() string {
+	return "could not set the permissions of " + kae.filename + ": " + kae.err.Error()
+}
+
+func (kae *keepAttributesError) Unwrap() error {
+	return kae.err
+}
+
+// chmodIfNeeded sets the given permissions for the given file, if it does not already have them.
+// This avoids an error when the permissions of a file that is owned by someone else are already right.
+func chmodIfNeeded(filename string, perm os.FileMode) error {
+	if filePermissions(filename, 0) == perm {
+		return nil
+	}
+	if err := os.Chmod(filename, perm); err != nil {
+		return &keepAttributesError{filename, err}
+	}
+	return nil
+}
+
+// copyFileAttributes gives the new file the same owner and extended attributes as the original file,
+// so that the original file can be replaced by it. Nothing is done if the original file does not exist.
+func copyFileAttributes(original, newFile string) error {
+	fi, err := os.Stat(original)
+	if err != nil {
+		return nil
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		newFi, err := os.Stat(newFile)
+		if err != nil {
+			return err
+		}
+		if newSt, ok := newFi.Sys().(*syscall.Stat_t); !ok || newSt.Uid != st.Uid || newSt.Gid != st.Gid {
+			// This only works for root, or for a group that the current user is a member of
+			if err := os.Chown(newFile, int(st.Uid), int(st.Gid)); err != nil {
+				return err
+			}
+		}
+	}
+	return copyXattrs(original, newFile)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -8,6 +9,9 @@ import (
 	"github.com/xyproto/termtitle"
 )
 
+// smallFileSize is the size in bytes below which a file is read without starting a spinner
+const smallFileSize = 256 * 1024
+
 // FilenameOrData represents either a filename, or data read in from stdin
 type FilenameOrData struct {
 	filename string
@@ -29,6 +33,15 @@ func (fnord *FilenameOrData) Empty() bool {
 	return fnord.length == 0
 }
 
+// Small checks if the data, or the regular file that is about to be read, is small enough to be loaded in an instant
+func (fnord *FilenameOrData) Small() bool {
+	if !fnord.Empty() {
+		return fnord.length < smallFileSize
+	}
+	fileInfo, err := os.Stat(fnord.filename)
+	return err == nil && fileInfo.Mode().IsRegular() && fileInfo.Size() < smallFileSize
+}
+
 // String returns the contents as a string
 func (fnord *FilenameOrData) String() string {
 	return string(fnord.data)
@@ -43,7 +56,7 @@ func (fnord *FilenameOrData) SetTitle() {
 	if fnord.filename == "-" {
 		title = "stdin"
 	} else if fnord.filename != "" {
-		title = fnord.filename
+		title = shortenPathForDisplay(fnord.filename, maxTitlePathLength)
 	}
 	termtitle.Set(termtitle.GenerateTitle(title))
 }
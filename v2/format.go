@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"os"
@@ -14,28 +15,41 @@ import (
 	"github.com/xyproto/vt100"
 )
 
-// Map from formatting command to a list of file extensions
-var format = map[*exec.Cmd][]string{
-	exec.Command("goimports", "-w", "--"):                                             {".go"},
-	exec.Command("clang-format", "-fallback-style=WebKit", "-style=file", "-i", "--"): {".cpp", ".cc", ".cxx", ".h", ".hpp", ".c++", ".h++", ".c"},
-	exec.Command("zig", "fmt"):                                                        {".zig"},
-	exec.Command("v", "fmt"):                                                          {".v"},
-	exec.Command("rustfmt"):                                                           {".rs"},
-	exec.Command("brittany", "--write-mode=inplace"):                                  {".hs"},
-	exec.Command("autopep8", "-i", "--max-line-length", "120"):                        {".py"},
-	exec.Command("ocamlformat"):                                                       {".ml"},
-	exec.Command("crystal", "tool", "format"):                                         {".cr"},
-	exec.Command("ktlint", "-F"):                                                      {".kt", ".kts"},
-	exec.Command("google-java-format", "-a", "-i"):                                    {".java"},
-	exec.Command("scalafmt"):                                                          {".scala"},
-	exec.Command("astyle", "--mode=cs"):                                               {".cs"},
-	exec.Command("prettier", "--tab-width", "4", "-w"):                                {".js", ".ts"},
-	exec.Command("prettier", "--tab-width", "2", "-w"):                                {".css"},
-	exec.Command("shfmt", "-s", "-w", "-i", "2", "-bn", "-ci", "-sr", "-kp"):          {".sh", ".bash", "PKGBUILD"},
-	exec.Command("lua-format", "-i", "--no-keep-simple-function-one-line", "--column-limit=120", "--indent-width=2", "--no-use-tab"):                                                                                                 {".lua"},
-	exec.Command("tidy", "-w", "80", "-q", "-i", "-utf8", "--show-errors", "0", "--show-warnings", "no", "--tidy-mark", "no", "-xml", "-m"):                                                                                          {".xml"},
-	exec.Command("tidy", "-w", "120", "-q", "-i", "-utf8", "--show-errors", "0", "--show-warnings", "no", "--tidy-mark", "no", "--hide-endtags", "yes", "--force-output", "yes", "-ashtml", "-omit", "no", "-xml", "no", "-m", "-c"): {".html", ".htm"},
-	exec.Command("/usr/bin/vendor_perl/perltidy", "-se", "-b", "-i=2", "-ole=unix", "-bt=2", "-pt=2", "-sbt=2", "-ce"):                                                                                                               {".pl"},
+// formatter is a command that formats a file in place, when the filename is added as the last argument.
+// If indentFlag is set, it is added together with the indentation width of the file, where 0 means tabs.
+type formatter struct {
+	args       []string
+	extensions []string
+	indentFlag string
+}
+
+// formatters are the formatting commands for each file extension. If several commands can format the same
+// type of file, the first one that is installed is used.
+var formatters = []formatter{
+	{args: []string{"goimports", "-w", "--"}, extensions: []string{".go"}},
+	{args: []string{"gofmt", "-w", "--"}, extensions: []string{".go"}},
+	{args: []string{"clang-format", "-fallback-style=WebKit", "-style=file", "-i", "--"}, extensions: []string{".cpp", ".cc", ".cxx", ".h", ".hpp", ".c++", ".h++", ".c"}},
+	{args: []string{"zig", "fmt"}, extensions: []string{".zig"}},
+	{args: []string{"v", "fmt"}, extensions: []string{".v"}},
+	{args: []string{"rustfmt"}, extensions: []string{".rs"}},
+	{args: []string{"brittany", "--write-mode=inplace"}, extensions: []string{".hs"}},
+	{args: []string{"black", "-q"}, extensions: []string{".py"}},
+	{args: []string{"autopep8", "-i", "--max-line-length", "120"}, extensions: []string{".py"}},
+	{args: []string{"ocamlformat"}, extensions: []string{".ml"}},
+	{args: []string{"crystal", "tool", "format"}, extensions: []string{".cr"}},
+	{args: []string{"ktlint", "-F"}, extensions: []string{".kt", ".kts"}},
+	{args: []string{"google-java-format", "-a", "-i"}, extensions: []string{".java"}},
+	{args: []string{"scalafmt"}, extensions: []string{".scala"}},
+	{args: []string{"astyle", "--mode=cs"}, extensions: []string{".cs"}},
+	{args: []string{"prettier", "--tab-width", "4", "-w"}, extensions: []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx"}},
+	{args: []string{"prettier", "--tab-width", "2", "-w"}, extensions: []string{".css", ".json"}},
+	{args: []string{"shfmt", "-s", "-w", "-bn", "-ci", "-sr", "-kp"}, extensions: []string{".sh", ".bash", "PKGBUILD"}, indentFlag: "-i"},
+	{args: []string{"stylua"}, extensions: []string{".lua"}},
+	{args: []string{"lua-format", "-i", "--no-keep-simple-function-one-line", "--column-limit=120", "--indent-width=2", "--no-use-tab"}, extensions: []string{".lua"}},
+	{args: []string{"tidy", "-w", "80", "-q", "-i", "-utf8", "--show-errors", "0", "--show-warnings", "no", "--tidy-mark", "no", "-xml", "-m"}, extensions: []string{".xml"}},
+	{args: []string{"tidy", "-w", "120", "-q", "-i", "-utf8", "--show-errors", "0", "--show-warnings", "no", "--tidy-mark", "no", "--hide-endtags", "yes", "--force-output", "yes", "-ashtml", "-omit", "no", "-xml", "no", "-m", "-c"}, extensions: []string{".html", ".htm"}},
+	{args: []string{"/usr/bin/vendor_perl/perltidy", "-se", "-b", "-i=2", "-ole=unix", "-bt=2", "-pt=2", "-sbt=2", "-ce"}, extensions: []string{".pl"}},
+	{args: []string{"perltidy", "-se", "-b", "-i=2", "-ole=unix", "-bt=2", "-pt=2", "-sbt=2", "-ce"}, extensions: []string{".pl"}},
 }
 
 // Using exec.Cmd instead of *exec.Cmd is on purpose, to get a new cmd.stdout and cmd.stdin every time.
@@ -44,6 +58,9 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		return errors.New(cmd.Path + " is missing")
 	}
 
+	// Register the operation, so that it can be shown in the status bar
+	defer operations.Start("formatting")()
+
 	tempFirstName := "o"
 	if e.mode == mode.Kotlin {
 		tempFirstName = "O"
@@ -58,11 +75,7 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		defer os.Remove(tempFilename)
 		defer f.Close()
 
-		// TODO: Implement e.SaveAs
-		oldFilename := e.filename
-		e.filename = tempFilename
-		err := e.Save(c, tty)
-		e.filename = oldFilename
+		err := e.SaveTemporary(c, tty, tempFilename)
 
 		if err == nil {
 			// Add the filename of the temporary file to the command
@@ -71,24 +84,19 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			// Save the command in a temporary file
 			saveCommand(&cmd)
 
-			// Format the temporary file
-			output, err := cmd.CombinedOutput()
+			// Format the temporary file. The formatter error is what it writes to stderr, or to stdout if there is nothing on stderr.
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			output := stderr.Bytes()
+			if len(bytes.TrimSpace(output)) == 0 {
+				output = stdout.Bytes()
+			}
 
 			// Ignore errors if the command is "tidy" and tidy exists
 			ignoreErrors := strings.HasSuffix(cmd.Path, "tidy") && which("tidy") != ""
 
-			// Perl may place executables in /usr/bin/vendor_perl
-			if e.mode == mode.Perl {
-				// Use perltidy from the PATH if /usr/bin/vendor_perl/perltidy does not exists
-				if cmd.Path == "/usr/bin/vendor_perl/perltidy" && !exists("/usr/bin/vendor_perl/perltidy") {
-					perltidyPath := which("perltidy")
-					if perltidyPath == "" {
-						return errors.New("perltidy is missing")
-					}
-					cmd.Path = perltidyPath
-				}
-			}
-
 			if err != nil && !ignoreErrors {
 				// Only grab the first error message
 				errorMessage := strings.TrimSpace(string(output))
@@ -140,17 +148,61 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 	return nil
 }
 
-func (e *Editor) formatCode(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, jsonFormatToggle *bool) {
+// formatter returns the formatting command for the current file, together with the file extension or base filename
+// that the temporary file should end with. Formatters that are not installed are skipped, and nil is returned
+// if no formatter for the file is installed.
+func (e *Editor) formatter() (*exec.Cmd, string) {
+	if baseFilename := filepath.Base(e.filename); baseFilename == "fstab" {
+		if which("fstabfmt") == "" {
+			return nil, ""
+		}
+		return exec.Command("fstabfmt", "-i"), baseFilename
+	}
+	for _, f := range formatters {
+		for _, ext := range f.extensions {
+			if !strings.HasSuffix(e.filename, ext) || which(f.args[0]) == "" {
+				continue
+			}
+			args := append([]string{}, f.args...)
+			if f.indentFlag != "" {
+				width := 0 // tabs
+				if e.indentation.Spaces {
+					width = e.indentation.PerTab
+				}
+				args = append(args, f.indentFlag, strconv.Itoa(width))
+			}
+			return exec.Command(args[0], args[1:]...), ext
+		}
+	}
+	return nil, ""
+}
+
+// hasFormatter checks if the current file can be formatted with ctrl-w
+func (e *Editor) hasFormatter() bool {
+	if e.mode == mode.JSON {
+		return true
+	}
+	cmd, _ := e.formatter()
+	return cmd != nil
+}
 
-	// Format JSON
+// formatCode formats the current file, with the first installed formatting command for the file extension.
+// If prettier is not installed, JSON is formatted without it, and is toggled between being indented and compact.
+// Returns the name of the formatting command that was used, or an empty string if no command was used.
+func (e *Editor) formatCode(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, jsonFormatToggle *bool) (string, error) {
+
+	// Format Go or C++ code with goimports or clang-format, and so on, if a formatter is installed
+	if cmd, extOrBaseFilename := e.formatter(); cmd != nil {
+		return filepath.Base(cmd.Path), e.formatWithUtility(c, tty, status, *cmd, extOrBaseFilename)
+	}
+
+	// Format JSON, if prettier is not installed
 	if e.mode == mode.JSON {
 		var v any
 
 		err := json.Unmarshal([]byte(e.String()), &v)
 		if err != nil {
-			status.ClearAll(c)
-			status.ShowErrorAfterRedraw(err)
-			return
+			return "", err
 		}
 
 		// Format the JSON bytes, first without indentation and then
@@ -165,47 +217,11 @@ func (e *Editor) formatCode(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 			*jsonFormatToggle = true
 		}
 		if err != nil {
-			status.ClearAll(c)
-			status.ShowErrorAfterRedraw(err)
-			return
+			return "", err
 		}
 
 		e.LoadBytes(indentedJSON)
 		e.redraw = true
-		return
 	}
-
-	baseFilename := filepath.Base(e.filename)
-	if baseFilename == "fstab" {
-		cmd := exec.Command("fstabfmt", "-i")
-		if which(cmd.Path) == "" { // Does the formatting tool even exist?
-			status.ClearAll(c)
-			status.SetErrorMessage(cmd.Path + " is missing")
-			status.Show(c, e)
-			return
-		}
-		if err := e.formatWithUtility(c, tty, status, *cmd, baseFilename); err != nil {
-			status.ClearAll(c)
-			status.SetMessage(err.Error())
-			status.Show(c, e)
-		}
-		return
-	}
-
-	// Not in git mode, format Go or C++ code with goimports or clang-format
-
-OUT:
-	for cmd, extensions := range format {
-		for _, ext := range extensions {
-			if strings.HasSuffix(e.filename, ext) {
-				if err := e.formatWithUtility(c, tty, status, *cmd, ext); err != nil {
-					status.ClearAll(c)
-					status.SetMessage(err.Error())
-					status.Show(c, e)
-				}
-				break OUT
-			}
-		}
-	}
-
+	return "", nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// installFakeCommands places executables with the given names in a temporary directory,
+// and makes that directory the only one in the PATH
+func installFakeCommands(t *testing.T, names ...string) {
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestFormatter(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.filename = "main.py"
+
+	installFakeCommands(t, "autopep8")
+	if cmd, ext := e.formatter(); cmd == nil || filepath.Base(cmd.Path) != "autopep8" || ext != ".py" {
+		t.Errorf("expected autopep8 when black is missing, got %v", cmd)
+	}
+	installFakeCommands(t, "autopep8", "black")
+	if cmd, _ := e.formatter(); cmd == nil || filepath.Base(cmd.Path) != "black" {
+		t.Errorf("expected black to be preferred, got %v", cmd)
+	}
+	installFakeCommands(t)
+	if cmd, _ := e.formatter(); cmd != nil || e.hasFormatter() {
+		t.Errorf("expected no formatter when none are installed, got %v", cmd)
+	}
+
+	installFakeCommands(t, "shfmt")
+	e.filename = "build.sh"
+	e.indentation = mode.TabsSpaces{PerTab: 2, Spaces: true}
+	if cmd, _ := e.formatter(); cmd == nil || !strings.HasSuffix(strings.Join(cmd.Args, " "), "-i 2") {
+		t.Errorf("expected shfmt to indent with 2 spaces, got %v", cmd)
+	}
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: false}
+	if cmd, _ := e.formatter(); cmd == nil || !strings.HasSuffix(strings.Join(cmd.Args, " "), "-i 0") {
+		t.Errorf("expected shfmt to indent with tabs, got %v", cmd)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// formatOnSave has the modes where the file is formatted right before it is saved, as if ctrl-w was pressed.
+// It is toggled in the ctrl-o menu, and is kept while the editor is running, also when switching files.
+var formatOnSave = make(map[mode.Mode]bool)
+
+// cursorAnchor is the text of the line that the cursor is on, and of the lines above and below it, without any
+// whitespace, and how many runes that are not whitespace are before the cursor, so that the cursor can be placed
+// at the same text after formatting
+type cursorAnchor struct {
+	y      LineIndex
+	text   string
+	before string
+	after  string
+	x      int
+}
+
+// withoutWhitespace returns the given string without any whitespace
+func withoutWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// compactLine returns the line at the given index without any whitespace, or an empty string if there is no line there
+func (e *Editor) compactLine(y LineIndex) string {
+	if y < 0 || int(y) >= e.Len() {
+		return ""
+	}
+	return withoutWhitespace(e.Line(y))
+}
+
+// anchorCursor returns the current cursor position, as a position in the text of the current line
+func (e *Editor) anchorCursor() cursorAnchor {
+	runes, x := e.cursorRunes()
+	y := e.DataY()
+	a := cursorAnchor{y: y, text: withoutWhitespace(string(runes)), before: e.compactLine(y - 1), after: e.compactLine(y + 1)}
+	for _, r := range runes[:x] {
+		if !unicode.IsSpace(r) {
+			a.x++
+		}
+	}
+	return a
+}
+
+// anchorLine returns the index of the line with the same text as the anchor, preferring lines where the lines
+// above and below are also the same, and then the line that is closest to the line that the anchor was on.
+// If no line has the same text, the same line index, within the document, is returned.
+func (e *Editor) anchorLine(a cursorAnchor) LineIndex {
+	l := LineIndex(e.Len())
+	found, bestScore := LineIndex(-1), -1
+	if a.text != "" {
+		for d := LineIndex(0); d < l; d++ {
+			for _, y := range []LineIndex{a.y + d, a.y - d} {
+				if y < 0 || y >= l || e.compactLine(y) != a.text {
+					continue
+				}
+				score := 0
+				if e.compactLine(y-1) == a.before {
+					score++
+				}
+				if e.compactLine(y+1) == a.after {
+					score++
+				}
+				if score > bestScore {
+					found, bestScore = y, score
+				}
+				if bestScore == 2 {
+					return found
+				}
+			}
+		}
+	}
+	switch {
+	case found >= 0:
+		return found
+	case a.y >= l:
+		return l - 1
+	}
+	return a.y
+}
+
+// restoreCursor moves the cursor to the same text as when the anchor was made, after the lines
+// have been reformatted, or as close to it as possible
+func (e *Editor) restoreCursor(c *vt100.Canvas, status *StatusBar, a cursorAnchor) {
+	y := e.anchorLine(a)
+	e.GoTo(y, c, status)
+	runes, _ := e.lineRunes(int(y))
+	x, seen := 0, 0
+	for x < len(runes) && (seen < a.x || unicode.IsSpace(runes[x])) {
+		if !unicode.IsSpace(runes[x]) {
+			seen++
+		}
+		x++
+	}
+	e.GoToDataX(c, x)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// FormatBeforeSave formats the file if format on save is enabled for the current mode, and places the cursor
+// at the same text as before. If the formatter fails, the file is left as it is and the error is returned.
+func (e *Editor) FormatBeforeSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) error {
+	if !formatOnSave[e.mode] || !e.hasFormatter() || e.binaryFile {
+		return nil
+	}
+	if undo != nil {
+		undo.Snapshot(e)
+	}
+	anchor := e.anchorCursor()
+	indentJSON := false // always indent JSON when saving, instead of toggling between indented and compact
+	_, err := e.formatCode(c, tty, status, &indentJSON)
+	e.restoreCursor(c, status, anchor)
+	return err
+}
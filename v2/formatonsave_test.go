@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRestoreCursorAfterFormatting(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("package main\n\nfunc main(){\nx:=1\n}\n"))
+	e.GoTo(3, nil, nil)
+	e.GoToDataX(nil, 3)
+	anchor := e.anchorCursor()
+
+	// Formatting adds an import and indents the line that the cursor is on
+	e.LoadBytes([]byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tx := 1\n\tfmt.Println(x)\n}\n"))
+	e.restoreCursor(nil, nil, anchor)
+	if x, _ := e.DataX(); e.DataY() != 5 || x != 6 {
+		t.Errorf("expected the cursor to be at the same text on the moved line, got %d,%d", x, e.DataY())
+	}
+
+	// Among lines with the same text, the one with the same lines around it is used
+	e.LoadBytes([]byte("func a() {\n}\n\nfunc b() {\n}\n"))
+	e.GoTo(4, nil, nil)
+	anchor = e.anchorCursor()
+	e.LoadBytes([]byte("import (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc a() {\n}\n\nfunc b() {\n}\n"))
+	e.restoreCursor(nil, nil, anchor)
+	if e.DataY() != 9 {
+		t.Errorf("expected the cursor to follow the closing bracket of b, got line index %d", e.DataY())
+	}
+
+	// If the line is gone, the cursor stays at the same line index
+	e.LoadBytes([]byte("a\nb\nc\nd\n"))
+	e.restoreCursor(nil, nil, anchor)
+	if e.DataY() != 3 {
+		t.Errorf("expected the cursor to stay at the same line index, got %d", e.DataY())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// generatedFileWarning is shown in the status bar when editing a file in an ignored or generated directory
+const generatedFileWarning = "editing a generated/ignored file"
+
+// generatedDirectories is a list of directory names that usually contain
+// generated or vendored files that will be overwritten by the next build
+var generatedDirectories = []string{"vendor", "node_modules", "bower_components", "dist", "__pycache__", ".venv"}
+
+// ignorePattern is a single pattern from a .gitignore file
+type ignorePattern struct {
+	pattern  string // the glob pattern, without any leading "!" or trailing "/"
+	negate   bool   // the pattern started with "!"
+	dirOnly  bool   // the pattern ended with "/"
+	anchored bool   // the pattern contains a "/", so it is relative to the .gitignore file
+}
+
+// IgnoreMatcher can match paths against a subset of the .gitignore pattern syntax:
+// comments, directory suffixes, "*" / "?" / "[...]" globs, leading "**/" and negation.
+type IgnoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// NewIgnoreMatcher creates an IgnoreMatcher from the lines of a .gitignore file
+func NewIgnoreMatcher(lines []string) *IgnoreMatcher {
+	var im IgnoreMatcher
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\") {
+			// Escaped "!" or "#"
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		for strings.HasPrefix(line, "**/") {
+			line = line[3:]
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.pattern = line
+		im.patterns = append(im.patterns, p)
+	}
+	return &im
+}
+
+// LoadIgnoreMatcher reads the given .gitignore file and returns an IgnoreMatcher
+func LoadIgnoreMatcher(gitignoreFilename string) (*IgnoreMatcher, error) {
+	data, err := os.ReadFile(gitignoreFilename)
+	if err != nil {
+		return nil, err
+	}
+	return NewIgnoreMatcher(strings.Split(string(data), "\n")), nil
+}
+
+// matchOne checks the given slash-separated relative path against all patterns,
+// without considering the parent directories. The last matching pattern wins.
+func (im *IgnoreMatcher) matchOne(relPath string, isDir bool) bool {
+	ignored := false
+	basename := path.Base(relPath)
+	for _, p := range im.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		var matched bool
+		if p.anchored {
+			matched, _ = path.Match(p.pattern, relPath)
+		} else {
+			matched, _ = path.Match(p.pattern, basename)
+		}
+		if matched {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// Match checks if the given slash-separated path, relative to the directory of the .gitignore file,
+// is ignored. A path is also ignored if any of its parent directories are ignored.
+func (im *IgnoreMatcher) Match(relPath string, isDir bool) bool {
+	if im == nil {
+		return false
+	}
+	relPath = strings.Trim(path.Clean(relPath), "/")
+	if relPath == "." || relPath == "" {
+		return false
+	}
+	parts := strings.Split(relPath, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		lastPart := i == len(parts)-1
+		if im.matchOne(prefix, !lastPart || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// findGitRoot searches the given directory and all parent directories for a ".git" directory or file.
+// Returns the directory containing ".git", or an empty string.
+func findGitRoot(dir string) string {
+	for {
+		if exists(filepath.Join(dir, ".git")) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// inIgnoredOrGeneratedDirectory checks if the given filename (symlinks are followed) is placed
+// within a directory that is either ignored by the .gitignore file at the root of the git
+// repository, or within a directory that usually contains generated files, like "node_modules".
+func inIgnoredOrGeneratedDirectory(filename string) bool {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	if realFilename, err := filepath.EvalSymlinks(absFilename); err == nil { // no error
+		absFilename = realFilename
+	}
+	dir := filepath.Dir(absFilename)
+	gitRoot := findGitRoot(dir)
+
+	// Check the directory names, from the root of the git repository and inwards
+	relDir := dir
+	if gitRoot != "" {
+		if relDir, err = filepath.Rel(gitRoot, dir); err != nil {
+			return false
+		}
+	}
+	for _, dirName := range strings.Split(filepath.ToSlash(relDir), "/") {
+		if hasS(generatedDirectories, dirName) {
+			return true
+		}
+	}
+
+	if gitRoot == "" || relDir == "." {
+		return false
+	}
+	im, err := LoadIgnoreMatcher(filepath.Join(gitRoot, ".gitignore"))
+	if err != nil {
+		return false
+	}
+	return im.Match(filepath.ToSlash(relDir), true)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	im := NewIgnoreMatcher([]string{
+		"# build output",
+		"dist/",
+		"*.log",
+		"/tmp",
+		"docs/generated/",
+		"**/cache",
+		"out*/",
+		"!out_keep/",
+		"!important.log",
+	})
+	cases := []struct {
+		relPath string
+		isDir   bool
+		ignored bool
+	}{
+		{"dist", true, true},
+		{"dist", false, false},
+		{"dist/main.js", false, true},
+		{"src/dist/main.js", false, true},
+		{"error.log", false, true},
+		{"src/error.log", false, true},
+		{"important.log", false, false},
+		{"tmp/a.txt", false, true},
+		{"src/tmp/a.txt", false, false},
+		{"docs/generated/index.html", false, true},
+		{"src/docs/generated/index.html", false, false},
+		{"a/b/cache/x", false, true},
+		{"output/x.bin", false, true},
+		{"out_keep/x.bin", false, false},
+		{"main.go", false, false},
+	}
+	for _, c := range cases {
+		if im.Match(c.relPath, c.isDir) != c.ignored {
+			t.Errorf("%s (dir: %v) should have ignored=%v", c.relPath, c.isDir, c.ignored)
+		}
+	}
+}
+
+func TestInIgnoredOrGeneratedDirectory(t *testing.T) {
+	// The repository is placed in a directory named "vendor", which should not count,
+	// since only the directories within the git repository are checked
+	dir := writeTempFiles(t, map[string]string{
+		"vendor/repo/.git/HEAD":                     "ref: refs/heads/main\n",
+		"vendor/repo/.gitignore":                    "build/\n",
+		"vendor/repo/src/main.go":                   "package main\n",
+		"vendor/repo/build/gen.go":                  "package main\n",
+		"vendor/repo/web/node_modules/pkg/index.js": "module.exports = {}\n",
+	})
+	repo := filepath.Join(dir, "vendor", "repo")
+	link := filepath.Join(repo, "src", "gen.go")
+	if err := os.Symlink(filepath.Join(repo, "build", "gen.go"), link); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		filename string
+		expected bool
+	}{
+		{filepath.Join(repo, "src", "main.go"), false},
+		{filepath.Join(repo, "web", "node_modules", "pkg", "index.js"), true},
+		{filepath.Join(repo, "build", "gen.go"), true},
+		{link, true},
+	}
+	for _, c := range cases {
+		if got := inIgnoredOrGeneratedDirectory(c.filename); got != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.filename, c.expected, got)
+		}
+	}
+}
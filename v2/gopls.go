@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// hoverMaxLines is the maximum number of lines of documentation that are shown
+const hoverMaxLines = 20
+
+var (
+	// goplsClient is the connection to gopls, which is started the first time it is needed
+	goplsClient *LSPClient
+	goplsMut    sync.Mutex
+
+	// goplsCommand is the language server that is started for Go files, and the arguments for it
+	goplsCommand = []string{"gopls"}
+
+	errNoDefinition    = errors.New("found no definition")
+	errNoDocumentation = errors.New("found no documentation")
+)
+
+// goModuleRoot returns the directory that contains the go.mod file for the given Go source file,
+// or the directory of the source file if there is no go.mod file
+func goModuleRoot(absFilename string) string {
+	for dir := filepath.Dir(absFilename); ; dir = filepath.Dir(dir) {
+		if exists(filepath.Join(dir, "go.mod")) {
+			return dir
+		}
+		if dir == filepath.Dir(dir) {
+			return filepath.Dir(absFilename)
+		}
+	}
+}
+
+// gopls returns the connection to gopls, and starts gopls for the module of the given file if it is not running
+func gopls(absFilename string) (*LSPClient, error) {
+	goplsMut.Lock()
+	defer goplsMut.Unlock()
+	if goplsClient != nil && !goplsClient.Stopped() {
+		return goplsClient, nil
+	}
+	client, err := StartLSPClient(goModuleRoot(absFilename), goplsCommand[0], goplsCommand[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	goplsClient = client
+	return client, nil
+}
+
+// StopGopls shuts down gopls, if it was started
+func StopGopls() {
+	goplsMut.Lock()
+	defer goplsMut.Unlock()
+	if goplsClient != nil {
+		goplsClient.Stop()
+		goplsClient = nil
+	}
+}
+
+// goplsAtCursor sends the current contents to gopls, and returns the connection, the document URI and the position of the cursor
+func (e *Editor) goplsAtCursor() (*LSPClient, string, lspPosition, error) {
+	if e.mode != mode.Go {
+		return nil, "", lspPosition{}, errors.New("only available for Go")
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return nil, "", lspPosition{}, err
+	}
+	client, err := gopls(absFilename)
+	if err != nil {
+		return nil, "", lspPosition{}, err
+	}
+	uri := fileURI(absFilename)
+	if err := client.SyncDocument(uri, "go", e.String()); err != nil {
+		return nil, "", lspPosition{}, err
+	}
+	y := e.DataY()
+	runes, _ := e.lineRunes(int(y))
+	x, err := e.DataX()
+	if err != nil {
+		x = len(runes)
+	}
+	return client, uri, lspPosition{int(y), utf16Column(runes, x)}, nil
+}
+
+// GoToDefinition jumps to the definition of the identifier at the cursor, using gopls.
+// If the definition is in another file, that file is switched to.
+func (e *Editor) GoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	client, uri, pos, err := e.goplsAtCursor()
+	if err != nil {
+		return err
+	}
+	locations, err := client.Definition(uri, pos)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return errNoDefinition
+	}
+	location := locations[0]
+	filename, err := uriToPath(location.URI)
+	if err != nil {
+		return err
+	}
+	if err := e.Switch(c, tty, status, lk, filename, false); err != nil {
+		return err
+	}
+	y := LineIndex(location.Range.Start.Line)
+	runes, _ := e.lineRunes(int(y))
+	x := runeColumn(runes, location.Range.Start.Character)
+	e.MoveToLineColumnNumber(c, status, int(y.LineNumber()), x+1, false)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// ShowHover shows the documentation for the identifier at the cursor in a pane, using gopls.
+// The pane is removed when the editor is redrawn.
+func (e *Editor) ShowHover(c *vt100.Canvas, status *StatusBar) error {
+	client, uri, pos, err := e.goplsAtCursor()
+	if err != nil {
+		return err
+	}
+	text, err := client.Hover(uri, pos)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return errNoDocumentation
+	}
+	title := e.WordAtCursor()
+	if lines := strings.SplitN(text, "\n", 2); len(lines) > 1 {
+		// The first line is the signature, and the rest is the documentation
+		title, text = lines[0], strings.TrimSpace(lines[1])
+	}
+	// DrawOutput shows the last lines, but the start of the documentation is the most interesting part
+	if lines := strings.Split(text, "\n"); len(lines) > hoverMaxLines {
+		text = strings.Join(lines[:hoverMaxLines-1], "\n") + "\n..."
+	}
+	e.DrawOutput(c, hoverMaxLines, title, text, e.DebugRunningBackground, true)
+	return nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"hash/crc32"
 	"io"
+	"os"
 	"strings"
 )
 
@@ -12,6 +14,29 @@ func withoutGZ(filename string) string {
 	return strings.TrimSuffix(filename, ".gz")
 }
 
+// sameAsOnDisk checks if the given file already has the given contents. For ".gz" files,
+// the given data is compared with the uncompressed contents of the file.
+func sameAsOnDisk(filename string, data []byte) bool {
+	gz := strings.HasSuffix(filename, ".gz")
+	if !gz {
+		// Files with a different size can not have the same contents
+		if fi, err := os.Stat(filename); err != nil || fi.Size() != int64(len(data)) {
+			return false
+		}
+	}
+	onDisk, err := os.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	if gz {
+		if onDisk, err = gUnzipData(onDisk); err != nil {
+			return false
+		}
+	}
+	// Compare the checksums first, and then all the bytes
+	return crc32.ChecksumIEEE(onDisk) == crc32.ChecksumIEEE(data) && bytes.Equal(onDisk, data)
+}
+
 // gUnzipData uncompressed gzip data
 func gUnzipData(data []byte) ([]byte, error) {
 	var (
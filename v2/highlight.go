@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -22,12 +23,51 @@ const (
 var (
 	tout      = textoutput.NewTextOutput(true, true)
 	resizeMut sync.RWMutex // locked when the terminal emulator is being resized
+
+	// highlightMaxLineLength is the length, in bytes, of the longest line that is syntax highlighted.
+	// Longer lines, like minified JavaScript, are drawn without syntax highlighting. 0 means no limit.
+	highlightMaxLineLength = 10000
+
+	// highlightTimeBudget is how long syntax highlighting may take when the lines are drawn.
+	// When the time is up, the rest of the lines are drawn without syntax highlighting,
+	// and then highlighted when the editor is idle. 0 means no limit.
+	highlightTimeBudget = 50 * time.Millisecond
 )
 
 // WriteLines will draw editor lines from "fromline" to and up to "toline" to the canvas, at cx, cy
 func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy uint) {
+	e.writeLines(newCellWriter(c, -1), fromline, toline, cx, cy, highlightTimeBudget)
+}
+
+// HighlightDeferred checks if some lines were drawn without syntax highlighting because the time budget ran out,
+// and nothing has been drawn for at least the given duration
+func (e *Editor) HighlightDeferred(idle time.Duration) bool {
+	resizeMut.RLock()
+	defer resizeMut.RUnlock()
+	return !e.highlightDeferredAt.IsZero() && time.Since(e.highlightDeferredAt) >= idle
+}
+
+// WriteDeferredHighlight draws the lines on the screen again, with syntax highlighting for all lines, regardless of
+// how long it takes. The column ruler, if shown, takes up the topRows, and the bottom row is left alone, since it may
+// contain a status message. Nothing is drawn while an overlay, like the output from running a program, is shown.
+func (e *Editor) WriteDeferredHighlight(c *vt100.Canvas) {
+	if e.overlayShown {
+		return
+	}
+	offsetY := e.pos.OffsetY()
+	// The rows that are available for text, below the ruler and above the status row
+	textRows := int(c.H()) - 1 - e.topRows()
+	// writeLines draws the ruler in the top row, if it is shown, and counts it as one of the lines
+	e.writeLines(newCellWriter(c, -1), LineIndex(offsetY), LineIndex(offsetY+textRows+e.topRows()), 0, 0, 0)
+}
+
+// writeLines draws the editor lines from "fromline" to and up to "toline" to the canvas, at cx, cy.
+// If budget is larger than 0, lines are drawn without syntax highlighting once the time is up.
+// If the cell writer records a row, only the changed lines are being drawn, one at a time.
+func (e *Editor) writeLines(out *cellWriter, fromline, toline LineIndex, cx, cy uint, budget time.Duration) {
+	c := out.c
+	single := out.row >= 0
 
-	bg := e.Background.Background()
 	tabString := strings.Repeat(" ", e.indentation.PerTab)
 	inCodeBlock := false // used when highlighting Doc, Markdown or Python
 
@@ -35,6 +75,13 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 	resizeMut.Lock()
 	defer resizeMut.Unlock()
 
+	started := time.Now()
+	if !single {
+		e.highlightDeferredAt = time.Time{}
+		e.overlayShown = false
+		e.dirty.reset(e.pos.offsetX, int(fromline), c.W(), c.H())
+	}
+
 	cw := c.Width()
 	if fromline >= toline {
 		return //errors.New("fromline >= toline in WriteLines")
@@ -42,8 +89,19 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 	numLinesToDraw := toline - fromline // Number of lines available on the canvas for drawing
 	offsetY := fromline
 
+	// Draw the column ruler at the top, and shift the lines one row down
+	if e.showRuler && numLinesToDraw > 1 {
+		e.WriteRuler(c, cx, cy)
+		cy++
+		numLinesToDraw--
+	}
+
 	//logf("numlines: %d offsetY %d\n", numlines, offsetY)
 
+	if e.syntaxHighlight {
+		prepareSyntaxKeywords(e.mode)
+	}
+
 	switch e.mode {
 	// If in Markdown mode, figure out the current state of block quotes
 	case mode.Doc, mode.Markdown, mode.ReStructured:
@@ -138,6 +196,15 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 
 		line = e.Line(LineIndex(y + offsetY))
 
+		// The line with the cursor may have a different background color
+		background := e.lineBackground(y + offsetY)
+		bg := background.Background()
+
+		// Only the drawn line is redacted, never the contents
+		if e.redactSecrets {
+			line = redactLine(line)
+		}
+
 		line = strings.TrimRightFunc(line, unicode.IsSpace)
 
 		// already trimmed right, just trim left
@@ -146,7 +213,18 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		// expand tabs
 		line = strings.ReplaceAll(line, "\t", tabString)
 
-		if e.syntaxHighlight && !envNoColor {
+		highlightLine := e.syntaxHighlight && !envNoColor
+		if highlightLine && highlightMaxLineLength > 0 && len(line) > highlightMaxLineLength {
+			// Draw very long lines as plain text, but keep track of strings and comments for the lines below
+			highlightLine = false
+			q.Process(trimmedLine)
+		} else if highlightLine && budget > 0 && time.Since(started) > budget {
+			// Out of time, highlight the rest of the lines when the editor is idle
+			highlightLine = false
+			e.highlightDeferredAt = time.Now()
+		}
+
+		if highlightLine {
 			// Output a syntax highlighted line. Escape any tags in the input line.
 			// textWithTags must be unescaped if there is not an error.
 			if textWithTags, err := syntax.AsText([]byte(escapeFunction(line)), e.mode); err != nil {
@@ -425,15 +503,6 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 				// Extract a slice of runes and color attributes
 				runesAndAttributes := tout.Extract(coloredString)
 
-				// Also handle things like ZALGO HE COMES which contains unicode "mark" runes
-				// TODO: Also handle all languages in v2/test/problematic.desktop
-				for k, v := range runesAndAttributes {
-					if unicode.IsMark(v.R) {
-						// Replace the "unprintable" (for a terminal emulator) characters
-						runesAndAttributes[k].R = controlRuneReplacement
-					}
-				}
-
 				// If e.rainbowParenthesis is true and we're not in a comment or a string, enable rainbow parenthesis
 				if e.mode != mode.Git && e.mode != mode.Email && e.rainbowParenthesis && q.None() && !q.hasSingleLineComment && !q.stoppedMultiLineComment {
 					thisLineParCount, thisLineBraCount := q.ParBraCount(trimmedLine)
@@ -446,51 +515,62 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 					}
 				}
 
-				// Search term highlighting
-				searchTermRunes := []rune(e.searchTerm)
-				matchForAnotherN := 0
+				// Search term highlighting, for the spans that match the search term or regular expression
+				runes := make([]rune, len(runesAndAttributes))
+				for i, ra := range runesAndAttributes {
+					runes[i] = ra.R
+				}
+				searchMatches := e.searchMatchRunes(runes)
 
 				// Output a line with the chars (Rune + AttributeColor)
 				skipX := e.pos.offsetX
+				var (
+					previousFg vt100.AttributeColor
+					lastLetter rune // the last rune that was drawn in a single cell, for combining marks
+					lastX      uint
+					lastFg     vt100.AttributeColor
+				)
 				for runeIndex, ra := range runesAndAttributes {
+					letter := ra.R
+					width := runeWidth(letter)
 					if skipX > 0 {
-						skipX--
+						if skipX < width {
+							// Draw a space for the visible half of a wide rune that is scrolled partly out of view
+							out.WriteRuneB(cx+lineRuneCount, cy+uint(y), e.Foreground, bg, ' ')
+							lineRuneCount++
+							lineStringCount++
+							skipX = 0
+						} else {
+							skipX -= width
+						}
 						continue
 					}
-					letter := ra.R
+					if width == 0 {
+						// Combining marks, like in ZALGO HE COMES, take up no cells. Draw the mark together with the
+						// rune before it, as a precomposed rune or as controlRuneReplacement.
+						if lastLetter != 0 {
+							if combined := combineRune(lastLetter, letter); combined != lastLetter {
+								out.WriteRuneB(lastX, cy+uint(y), lastFg, bg, combined)
+								lastLetter = combined
+							}
+						}
+						continue
+					}
+					lastLetter = 0
 					fg := ra.A
 					if letter == ' ' {
 						fg = e.Foreground
 					}
-					if matchForAnotherN > 0 {
-						// Coloring an already found match
+					if searchMatches != nil && searchMatches[runeIndex] {
 						fg = e.SearchHighlight
-						matchForAnotherN--
-					} else if len(e.searchTerm) > 0 && letter == searchTermRunes[0] {
-						// Potential search highlight match
-						length := utf8.RuneCountInString(e.searchTerm)
-						counter := 0
-						match := true
-						for i := runeIndex; i < (runeIndex + length); i++ {
-							if i >= len(runesAndAttributes) {
-								match = false
-								break
-							}
-							ra2 := runesAndAttributes[i]
-							if ra2.R != []rune(e.searchTerm)[counter] {
-								// mismatch, not a hit
-								match = false
-								break
-							}
-							counter++
-						}
-						if match {
-							fg = e.SearchHighlight
-							matchForAnotherN = length - 1
-						}
 					}
+					// Turn off bold, underline or reverse video from the previous rune, like a search match
+					if hasTextAttributes(previousFg) && !hasTextAttributes(fg) {
+						fg = withPlainAttributes(fg)
+					}
+					previousFg = fg
 					if letter == '\t' {
-						c.Write(cx+lineRuneCount, cy+uint(y), fg, e.Background, tabString)
+						out.Write(cx+lineRuneCount, cy+uint(y), fg, background, tabString)
 						lineRuneCount += uint(e.indentation.PerTab)
 						lineStringCount += uint(e.indentation.PerTab)
 					} else {
@@ -499,8 +579,20 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						}
 						tx := cx + lineRuneCount
 						ty := cy + uint(y)
-						if tx < cw {
-							c.WriteRuneB(tx, ty, fg, bg, letter)
+						if width > 1 && tx+1 < cw {
+							// A wide rune, where the next cell is covered by the rune
+							out.WriteRuneB(tx, ty, fg, bg, letter)
+							out.WriteRuneB(tx+1, ty, fg, bg, wideRunePlaceholder)
+							lineRuneCount += 2
+							lineStringCount += uint(len(string(letter)))
+						} else if width > 1 && tx < cw {
+							// Do not draw half of a wide rune at the right edge
+							out.WriteRuneB(tx, ty, fg, bg, ' ')
+							lineRuneCount++
+							lineStringCount++
+						} else if tx < cw {
+							out.WriteRuneB(tx, ty, fg, bg, letter)
+							lastLetter, lastX, lastFg = letter, tx, fg
 							lineRuneCount++                              // 1 rune
 							lineStringCount += uint(len(string(letter))) // 1 rune, expanded
 						}
@@ -514,7 +606,7 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 			}
 			// Output a regular line, scrolled to the current e.pos.offsetX
 			screenLine = e.ChopLine(line, int(cw))
-			c.Write(cx+lineRuneCount, cy+uint(y), e.Foreground, e.Background, screenLine)
+			out.Write(cx+lineRuneCount, cy+uint(y), e.Foreground, background, screenLine)
 			lineRuneCount += uint(utf8.RuneCountInString(screenLine)) // rune count
 			lineStringCount += uint(len(screenLine))                  // string length, not rune length
 		}
@@ -523,8 +615,44 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		// TODO: This may draw the wrong number of blanks, since lineRuneCount should really be the number of visible glyphs at this point
 		yp := cy + uint(y)
 		xp := cx + lineRuneCount
-		c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-lineRuneCount)
+		if lineRuneCount < cw {
+			out.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-lineRuneCount)
+		}
+
+		// Draw the guide at the word wrap column, if the line is shorter than it
+		if col, ok := e.colorColumn(); ok && lineRuneCount <= col && cx+col < cw && y+offsetY < LineIndex(e.Len()) {
+			fg := e.MultiLineComment
+			if envNoColor {
+				fg = e.Foreground
+			}
+			out.WriteRune(cx+col, yp, fg, background, colorColumnRune)
+		}
+
+		// Mark the rows after the end of the buffer, so that trailing blank lines can be told apart from them
+		if y+offsetY >= LineIndex(e.Len()) && lineRuneCount == 0 {
+			fg := e.MultiLineComment
+			if envNoColor {
+				fg = e.Foreground
+			}
+			out.WriteRune(cx, yp, fg, e.Background, endOfBufferRune)
+		}
+
+		// Remember what is carried over to the next line, so that it can be checked if a changed line
+		// affects how the lines below it look
+		e.dirty.setState(y+offsetY, lineState{q.doubleQuote, q.backtick, q.singleQuote, q.parCount, q.braCount, q.multiLineComment, inCodeBlock}, single)
+	}
+
+	// Draw the selected text, if any
+	e.WriteSelection(c, offsetY, uint(numLinesToDraw), cx, cy)
+
+	// Mark the indentation of the lines that are not indented like the rest of the file
+	if e.markMixedIndent {
+		e.WriteMixedIndentation(c, offsetY, uint(numLinesToDraw), cx, cy)
+	}
 
+	// Draw a vertical line at the column of the cursor
+	if e.showCrosshair {
+		e.WriteCrosshair(c, cx, cy, uint(numLinesToDraw))
 	}
 }
 
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// minifiedJS returns a single line of JavaScript that looks like the output of a minifier
+func minifiedJS(length int) string {
+	const chunk = `function a(b,c){var d="é"+b;return c?d.split("").map(function(e){return e.charCodeAt(0)}):{x:[1,2,3],y:'z'}}`
+	return strings.Repeat(chunk, length/len(chunk)+1)[:length]
+}
+
+// canvasLine returns the runes on the given row of the canvas
+func canvasLine(c *vt100.Canvas, y uint) string {
+	var sb strings.Builder
+	for x := uint(0); x < c.W(); x++ {
+		r, err := c.At(x, y)
+		if err != nil {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func TestChopLine(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.pos.offsetX = 2
+	if got := e.ChopLine("æøåabc", 3); got != "åab" {
+		t.Errorf("expected the line to be scrolled and chopped by runes, got %q", got)
+	}
+	if got := e.ChopLine("æø", 3); got != "" {
+		t.Errorf("expected an empty string when scrolled past the end of the line, got %q", got)
+	}
+}
+
+func TestWriteLinesLongLine(t *testing.T) {
+	e := NewSimpleEditor(0)
+	e.mode = mode.JavaScript
+	e.syntaxHighlight = true
+	line := minifiedJS(highlightMaxLineLength * 2)
+	e.LoadBytes([]byte("var x = 1;\n" + line))
+	c := vt100.NewCanvas()
+	e.pos.offsetX = 5
+	e.WriteLines(c, 0, 2, 0, 0)
+	expected := []rune(line)[5 : 5+int(c.W())]
+	if got := canvasLine(c, 1); got != string(expected) {
+		t.Errorf("expected the long line to be scrolled and chopped, got %q", got)
+	}
+	if !e.highlightDeferredAt.IsZero() {
+		t.Error("expected the highlighting to finish within the time budget")
+	}
+}
+
+func TestWriteLinesTimeBudget(t *testing.T) {
+	e := NewSimpleEditor(0)
+	e.mode = mode.JavaScript
+	e.syntaxHighlight = true
+	e.LoadBytes([]byte(strings.Repeat("var x = 1;\n", 50)))
+	c := vt100.NewCanvas()
+	h := LineIndex(c.H())
+	e.writeLines(newCellWriter(c, -1), 0, h, 0, 0, time.Nanosecond)
+	if e.highlightDeferredAt.IsZero() || !e.HighlightDeferred(0) {
+		t.Fatal("expected the highlighting to be deferred when the time budget runs out")
+	}
+	if got := canvasLine(c, uint(h-1)); !strings.HasPrefix(got, "var x = 1;") {
+		t.Errorf("expected the lines to be drawn without syntax highlighting, got %q", got)
+	}
+	e.WriteDeferredHighlight(c)
+	if e.HighlightDeferred(0) {
+		t.Error("expected all lines to be highlighted")
+	}
+}
+
+func TestWriteDeferredHighlight(t *testing.T) {
+	e := NewSimpleEditor(0)
+	e.LoadBytes([]byte(strings.Repeat("line\n", 100)))
+	e.showRuler = true
+	c := vt100.NewCanvas()
+	h := c.H()
+	c.Write(0, h-1, vt100.Default, vt100.DefaultBackground, "status")
+
+	// The lines are drawn below the ruler, and the status row is left alone
+	e.WriteDeferredHighlight(c)
+	if got := canvasLine(c, 1); !strings.HasPrefix(got, "line") {
+		t.Errorf("expected the first line below the ruler, got %q", got)
+	}
+	if got := canvasLine(c, h-1); !strings.HasPrefix(got, "status") {
+		t.Errorf("expected the status row to be left alone, got %q", got)
+	}
+
+	// Nothing is drawn on top of an overlay
+	box := &Box{0, 2, 20, 5}
+	e.DrawBox(e.NewBoxTheme(), c, box)
+	before := canvasLine(c, 3)
+	e.WriteDeferredHighlight(c)
+	if got := canvasLine(c, 3); got != before {
+		t.Errorf("expected the overlay to be left alone, got %q", got)
+	}
+}
+
+func BenchmarkWriteLinesMinified(b *testing.B) {
+	e := NewSimpleEditor(0)
+	e.mode = mode.JavaScript
+	e.syntaxHighlight = true
+	var sb strings.Builder
+	for i := 0; i < 100; i++ {
+		sb.WriteString(minifiedJS(200000))
+		sb.WriteString("\n")
+	}
+	e.LoadBytes([]byte(sb.String()))
+	c := vt100.NewCanvas()
+	h := LineIndex(c.H())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.WriteLines(c, 0, h, 0, 0)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// The events that hooks can be configured for
+const (
+	hookBeforeSave   = "before-save"
+	hookAfterSave    = "after-save"
+	hookAfterOpen    = "after-open"
+	hookBuildSuccess = "on-build-success"
+)
+
+var (
+	hooks         map[string][]string // shell commands per event, from the [hooks] section of hooks.conf
+	hooksFilename = filepath.Join(userConfigDir, "o", "hooks.conf")
+	hookEvents    = []string{hookBeforeSave, hookAfterSave, hookAfterOpen, hookBuildSuccess}
+)
+
+// parseHooks parses the [hooks] section of a configuration file, where each line is on the form "event = command".
+// An event may be given several times, then the commands are run in order. Lines starting with "#" are comments.
+func parseHooks(data string) (map[string][]string, error) {
+	hooks := make(map[string][]string)
+	inHooksSection := false
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inHooksSection = line == "[hooks]"
+			continue
+		}
+		if !inHooksSection {
+			continue
+		}
+		event, command, ok := strings.Cut(line, "=")
+		event, command = strings.TrimSpace(event), strings.TrimSpace(command)
+		if !ok || command == "" {
+			return hooks, fmt.Errorf("line %d: expected event = command", i+1)
+		}
+		if !hasS(hookEvents, event) {
+			return hooks, fmt.Errorf("line %d: unknown event: %s", i+1, event)
+		}
+		hooks[event] = append(hooks[event], command)
+	}
+	return hooks, nil
+}
+
+// LoadHooks loads the hooks from the given configuration file. The returned map can be empty.
+func LoadHooks(hooksFilename string) (map[string][]string, error) {
+	data, err := os.ReadFile(hooksFilename)
+	if err != nil {
+		return make(map[string][]string), err
+	}
+	return parseHooks(string(data))
+}
+
+// shellQuote quotes the given string for use as a single argument in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// expandHookCommand replaces %f with the quoted filename, %l with the line number and %% with %
+func expandHookCommand(command, filename string, lineNumber LineNumber) string {
+	var sb strings.Builder
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' || i+1 == len(runes) {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		i++
+		switch runes[i] {
+		case 'f':
+			sb.WriteString(shellQuote(filename))
+		case 'l':
+			sb.WriteString(strconv.Itoa(int(lineNumber)))
+		case '%':
+			sb.WriteRune('%')
+		default:
+			sb.WriteRune('%')
+			sb.WriteRune(runes[i])
+		}
+	}
+	return sb.String()
+}
+
+// firstLine returns the first non-empty line of the given output, trimmed
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// runHook runs the given shell command and returns the first line of the output.
+// An error is returned if the command fails or exits with a non-zero exit status.
+func runHook(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	line := firstLine(string(output))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && line == "" {
+			line = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		} else if line == "" {
+			line = err.Error()
+		}
+		return line, errors.New(line)
+	}
+	return line, nil
+}
+
+// runHooks runs all hooks for the given event, in order, and stops at the first one that fails.
+// The first line of the output from the last hook that was run is returned.
+func runHooks(hooks map[string][]string, event, filename string, lineNumber LineNumber) (string, error) {
+	var line string
+	for _, command := range hooks[event] {
+		var err error
+		if line, err = runHook(expandHookCommand(command, filename, lineNumber)); err != nil {
+			return line, fmt.Errorf("%s hook: %w", event, err)
+		}
+	}
+	return line, nil
+}
+
+// RunBeforeSaveHooks runs the before-save hooks and waits for them to complete.
+// If one of them fails, an error with the first line of its output is returned, and the file should not be saved.
+func (e *Editor) RunBeforeSaveHooks() error {
+	if len(hooks[hookBeforeSave]) == 0 {
+		return nil
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	_, err = runHooks(hooks, hookBeforeSave, absFilename, e.LineNumber())
+	return err
+}
+
+// RunHooksInBackground runs the hooks for the given event without waiting for them to complete.
+// The exit status, or the first line of output, is shown in the status bar by the key loop when they are done.
+func (e *Editor) RunHooksInBackground(c *vt100.Canvas, status *StatusBar, event string) {
+	if len(hooks[event]) == 0 {
+		return
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	lineNumber := e.LineNumber()
+	go func() {
+		line, err := runHooks(hooks, event, absFilename, lineNumber)
+		// Only the key loop draws, so that the result is not drawn over a menu or a prompt
+		runInKeyLoop(func() {
+			status.Clear(c)
+			if err != nil {
+				status.SetError(err)
+			} else if line != "" {
+				status.SetMessage(event + ": " + line)
+			} else {
+				status.SetMessage(event + " hook: ok")
+			}
+			status.Show(c, e)
+		})
+	}()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHooks(t *testing.T) {
+	hooks, err := parseHooks("# hooks for o\n[other]\nafter-save = ignored\n\n[hooks]\nbefore-save = lint %f\nbefore-save = scan %f\nafter-open=echo %l\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks[hookBeforeSave]) != 2 || hooks[hookBeforeSave][1] != "scan %f" || len(hooks[hookAfterSave]) != 0 || hooks[hookAfterOpen][0] != "echo %l" {
+		t.Errorf("unexpected hooks: %v", hooks)
+	}
+	if _, err := parseHooks("[hooks]\nbefore-lunch = eat\n"); err == nil {
+		t.Error("expected an error for an unknown event")
+	}
+}
+
+func TestExpandHookCommand(t *testing.T) {
+	if s := expandHookCommand("check %f:%l 100%% %x", "/tmp/it's here.go", 42); s != `check '/tmp/it'\''s here.go':42 100% %x` {
+		t.Errorf("unexpected expansion: %s", s)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	okScript := filepath.Join(dir, "ok.sh")
+	failScript := filepath.Join(dir, "fail.sh")
+	silentScript := filepath.Join(dir, "silent.sh")
+	os.WriteFile(okScript, []byte("#!/bin/sh\necho \"checked $1 at $2\"\n"), 0o755)
+	os.WriteFile(failScript, []byte("#!/bin/sh\necho\necho \"found a secret in $1\"\necho more\nexit 3\n"), 0o755)
+	os.WriteFile(silentScript, []byte("#!/bin/sh\nexit 2\n"), 0o755)
+
+	filename := filepath.Join(dir, "a b.txt")
+	hooks := map[string][]string{
+		hookAfterSave:  {okScript + " %f %l"},
+		hookBeforeSave: {okScript + " %f %l", failScript + " %f", okScript},
+		hookAfterOpen:  {silentScript},
+	}
+	if line, err := runHooks(hooks, hookAfterSave, filename, 7); err != nil || line != "checked "+filename+" at 7" {
+		t.Errorf("unexpected result from a successful hook: %q, %v", line, err)
+	}
+	// A failing before-save hook stops the rest of the hooks, and the first output line is used as the message
+	if _, err := runHooks(hooks, hookBeforeSave, filename, 7); err == nil || err.Error() != "before-save hook: found a secret in "+filename {
+		t.Errorf("unexpected error from a failing hook: %v", err)
+	}
+	// Without any output, the exit status is used as the message
+	if _, err := runHooks(hooks, hookAfterOpen, filename, 1); err == nil || !strings.Contains(err.Error(), "exit status 2") {
+		t.Errorf("expected the exit status in the error, got %v", err)
+	}
+	if line, err := runHooks(hooks, hookBuildSuccess, filename, 1); err != nil || line != "" {
+		t.Errorf("expected no hooks to be run, got %q, %v", line, err)
+	}
+}
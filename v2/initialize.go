@@ -48,8 +48,6 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		syntaxHighlight = origSyntaxHighlight && m != mode.Text && m != mode.Blank
 	}
 
-	adjustSyntaxHighlightingKeywords(m) // no theme changes, just language detection and keyword configuration
-
 	indentation := m.TabsSpaces()
 
 	// Additional per-mode considerations, before launching the editor
@@ -91,6 +89,9 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	// Set the editor filename
 	e.filename = fnord.filename
 
+	// Keep non-breaking spaces and odd characters in files where they are likely to be there on purpose
+	e.keepCharacters = keepCharactersByDefault(fnord.filename, m)
+
 	// We wish to redraw the canvas and reposition the cursor
 	e.redraw = true
 	e.redrawCursor = true
@@ -187,6 +188,19 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 			}
 			testfile.Close()
 		}
+
+		// Warn if the file is in a directory that is ignored by git or is usually generated, like "node_modules"
+		if !e.readOnly && inIgnoredOrGeneratedDirectory(e.filename) {
+			e.generatedFile = true
+			warningMessage += " (" + generatedFileWarning + ")"
+		}
+
+		// Warn about, and hide, what looks like passwords, keys and tokens
+		if e.DetectSecrets() {
+			e.secretsFound = true
+			e.redactSecrets = true
+			warningMessage += " (" + secretsWarning + ")"
+		}
 	} else {
 
 		// Prepare an empty file
@@ -210,10 +224,13 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		createdNewFile = true
 	}
 
-	// The editing mode is decided at this point
+	// A modeline takes precedence over the mode that was detected from the filename or the contents
+	if e.modeline != nil && e.modeline.modeSet {
+		e.mode = e.modeline.m
+	}
 
-	// The shebang may have been for bash, make further adjustments
-	adjustSyntaxHighlightingKeywords(e.mode)
+	// The editing mode is decided at this point.
+	// The syntax highlighting keywords for the mode are configured when they are first needed, by prepareSyntaxKeywords.
 
 	// Additional per-mode considerations, before launching the editor
 	e.indentation = m.TabsSpaces()
@@ -222,6 +239,16 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.indentation.Spaces = !detectedTabs
 	}
 
+	// The indentation from a modeline takes precedence over the detected indentation
+	if e.ApplyModeline() {
+		warningMessage += " (" + e.modelineIndentationMessage() + ")"
+	}
+
+	// Warn if some lines are indented with tabs and others with spaces
+	if e.MixedIndentation() {
+		warningMessage += " (" + e.mixedIndentationMessage() + ")"
+	}
+
 	switch e.mode {
 	case mode.Blank, mode.Doc, mode.Email, mode.Markdown, mode.Text, mode.ReStructured:
 		e.rainbowParenthesis = false
@@ -320,9 +347,33 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		absFilename = e.filename
 	}
 
-	// Load the location history. This will be saved again later. Errors are ignored.
-	if locationHistory, err = LoadLocationHistory(locationHistoryFilename); err == nil { // success
-		recordedLineNumber, found = locationHistory[absFilename]
+	// Look up the location of this file only. The whole location history is loaded when it is saved. Errors are ignored.
+	if recordedLineNumber, err = FindInLocationHistory(locationHistoryFilename, absFilename); err == nil { // success
+		found = true
+	}
+
+	// Load the view states, and restore the view state for this file. Errors are ignored.
+	viewStates, _ = LoadViewStates(viewStateFilename)
+	if vs, ok := viewStates[absFilename]; ok {
+		e.SetViewState(vs)
+	}
+
+	// Load the per-mode save policies, and use the one for this file. Errors are ignored.
+	savePolicies, _ = LoadSavePolicies(savePolicyFilename)
+	e.savePolicy = savePolicyFor(e.mode, e.filename)
+
+	// Load the named bookmarks for this file. Errors are ignored.
+	bookmarkHistory, _ = LoadBookmarkHistory(bookmarkHistoryFilename)
+	e.SetBookmarks(bookmarkHistory[absFilename])
+
+	// Load the hooks that are run on events like saving. A missing configuration file is fine.
+	if hooks, err = LoadHooks(hooksFilename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		warningMessage += " (" + filepath.Base(hooksFilename) + ": " + err.Error() + ")"
+	}
+
+	// The settings are loaded at startup, but errors are reported here. A missing settings file is fine.
+	if settingsErr != nil && !errors.Is(settingsErr, os.ErrNotExist) {
+		warningMessage += " (" + filepath.Base(settingsFilename) + ": " + settingsErr.Error() + ")"
 	}
 
 	if !e.slowLoad {
@@ -367,12 +418,6 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.redraw = false
 	}
 
-	// Make sure the location history isn't empty (the search history can be empty, it's just a string slice)
-	if locationHistory == nil {
-		locationHistory = make(map[string]LineNumber, 1)
-		locationHistory[absFilename] = lineNumber
-	}
-
 	// Redraw the TUI, if needed
 	if e.redraw {
 		e.Center(c)
@@ -0,0 +1,2198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/xyproto/env"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// keyLoopState is the state that the key loop keeps between key presses
+type keyLoopState struct {
+	bookmark             *Position     // for the bookmark/jump functionality
+	bookmarkBeforeKey    *Position     // the bookmark before ctrl-b was pressed, in case a digit follows
+	posBeforeBookmark    Position      // the position before ctrl-b was pressed, in case a digit follows
+	ccp                  *CutCopyPaste // the internal clipboard, for the cut/copy/paste functionality
+	firstPasteAction     bool
+	firstCopyAction      bool
+	clearKeyHistory      bool        // for clearing the last pressed key, for exiting modes that also reads keys
+	kh                   *KeyHistory // keep track of the previous key presses
+	lastCommandMenuIndex int         // for the command menu
+	jsonFormatToggle     bool        // for toggling indentation or not when pressing ctrl-w for JSON
+	playBackMacroCount   int         // number of times the macro should be played back, right now
+	forceFlag            bool        // was the file force opened?
+}
+
+// newKeyLoopState returns the state of the key loop, before any keys have been pressed
+func newKeyLoopState(forceFlag bool) *keyLoopState {
+	return &keyLoopState{
+		ccp:              NewCutCopyPaste(splitPaste),
+		firstPasteAction: true,
+		firstCopyAction:  true,
+		kh:               NewKeyHistory(),
+		forceFlag:        forceFlag,
+	}
+}
+
+// handleKey does what the given key should do, like moving the cursor, inserting text or opening a menu.
+// This is called by the key loop for every key that is read, replayed or repeated.
+func (e *Editor) handleKey(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, ks *keyLoopState, key string) {
+	var err error
+	switch key {
+	case "c:17": // ctrl-q, quit
+		e.quit = true
+	case "c:23": // ctrl-w, format or insert template (or if in git mode, cycle interactive rebase keywords)
+
+		undo.Snapshot(e)
+
+		// Clear the search term
+		e.ClearSearchTerm()
+
+		// Add a watch
+		if e.debugMode { // AddWatch will start a new gdb session if needed
+			// Ask the user to type in a watch expression
+			if expression, ok := e.UserInput(c, tty, status, "Variable name to watch", []string{}, false); ok {
+				if _, err := e.AddWatch(expression); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.ShowNoTimeout(c, e)
+					break
+				}
+			}
+			break
+		}
+
+		// Cycle git rebase keywords
+		if line := e.CurrentLine(); e.mode == mode.Git && hasAnyPrefixWord(line, gitRebasePrefixes) {
+			newLine := nextGitRebaseKeyword(line)
+			e.SetCurrentLine(newLine)
+			e.redraw = true
+			e.redrawCursor = true
+			break
+		}
+
+		if e.Empty() {
+			// Empty file, nothing to format, insert a program template, if available
+			if err := e.InsertTemplateProgram(c); err != nil {
+				status.ClearAll(c)
+				status.SetMessage("nothing to format and no template available")
+				status.Show(c, e)
+			} else {
+				e.redraw = true
+				e.redrawCursor = true
+			}
+			break
+		}
+
+		if e.mode == mode.Markdown {
+			e.ToggleCheckboxCurrentLine()
+			break
+		}
+
+		status.ClearAll(c)
+		// Formatting may add or remove lines, like imports, so keep the cursor at the same text
+		anchor := e.anchorCursor()
+		if formatterName, err := e.formatCode(c, tty, status, &ks.jsonFormatToggle); err != nil {
+			status.SetError(err)
+			status.Show(c, e)
+		} else {
+			e.restoreCursor(c, status, anchor)
+			if formatterName != "" {
+				status.SetMessageAfterRedraw("Formatted with " + formatterName)
+			}
+		}
+
+		// Move the cursor if after the end of the line
+		if e.AtOrAfterEndOfLine() {
+			e.End(c)
+		}
+
+	case "c:6": // ctrl-f, search for a string
+
+		// If in Debug mode, let ctrl-f mean "finish"
+		if e.debugMode {
+			if e.gdb == nil {
+				status.SetMessageAfterRedraw("Not running")
+				break
+			}
+			status.ClearAll(c)
+			if err := e.DebugFinish(); err != nil {
+				e.DebugEnd()
+				status.SetMessage(err.Error())
+				e.GoToEnd(c, nil)
+			} else {
+				status.SetMessage("Finish")
+			}
+			status.SetMessageAfterRedraw(status.Message())
+			break
+		}
+
+		e.SearchMode(c, status, tty, true, undo)
+	case "c:0": // ctrl-space, build source code to executable, or export, depending on the mode
+
+		if e.Empty() {
+			// Empty file, nothing to build
+			status.ClearAll(c)
+			status.SetErrorMessage("Nothing to build")
+			status.Show(c, e)
+			break
+		}
+
+		// Save the current file, but only if it has changed
+		if e.changed {
+			if err := e.Save(c, tty); err != nil {
+				status.ClearAll(c)
+				status.SetError(err)
+				status.Show(c, e)
+				break
+			}
+		}
+
+		// debug stepping
+		if e.debugMode && e.gdb != nil {
+			if !programRunning {
+				e.DebugEnd()
+				status.SetMessage("Program stopped")
+				e.redrawCursor = true
+				e.redraw = true
+				status.SetMessageAfterRedraw(status.Message())
+				break
+			}
+			status.ClearAll(c)
+			// If we have a breakpoint, continue to it
+			if e.breakpoint != nil { // exists
+				// continue forward to the end or to the next breakpoint
+				if err := e.DebugContinue(); err != nil {
+					//logf("[continue] gdb output: %s\n", gdbOutput)
+					e.DebugEnd()
+					status.SetMessage("Done")
+					e.GoToEnd(nil, nil)
+				} else {
+					status.SetMessage("Continue")
+				}
+			} else { // if not, make one step
+				err := e.DebugStep()
+				if err != nil {
+					if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
+						e.DebugEnd()
+						status.SetMessage("Done stepping")
+					} else if err == errProgramStopped {
+						e.DebugEnd()
+						status.SetMessage("Program stopped")
+					} else {
+						e.DebugEnd()
+						status.SetMessage(errorMessage)
+					}
+					// Go to the end, no status message
+					e.GoToEnd(c, nil)
+				} else {
+					status.SetMessage("Step")
+				}
+			}
+			e.redrawCursor = true
+
+			// Redraw and use the triggered status message instead of Show
+			status.SetMessageAfterRedraw(status.Message())
+
+			break
+		}
+
+		// Clear the current search term, but don't redraw if there are status messages
+		e.ClearSearchTerm()
+		e.redraw = false
+
+		// ctrl-space was pressed while in Nroff mode, render a preview of the man page
+		if e.mode == mode.Nroff {
+			e.PreviewManPage(c, status)
+			break
+		} else if e.manPagePreview {
+			// Go back to the nroff source
+			if err := e.LeaveManPagePreview(); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		} else if e.mode == mode.ManPage {
+			e.mode = mode.Nroff
+			//e.syntaxHighlight = true
+			//e.LoadBytes([]byte(e.String()))
+			e.redraw = true
+			e.redrawCursor = true
+			break
+		}
+
+		// Press ctrl-space twice the first time the Markdown file should be exported to PDF
+		// to avoid the first accidental ctrl-space key press.
+
+		if e.building {
+			if e.CanRun() && !e.runAfterBuild {
+				// Run after building, for some modes
+				status.ClearAll(c)
+				e.DrawOutput(c, 20, "", "Building and running...", e.DebugRegistersBackground, true)
+				e.runAfterBuild = true
+				break
+			}
+			// Pressed again, so cancel the running build and start again, with the latest changes
+			CancelBuild()
+		}
+
+		// Start building, and let a build that was cancelled know that it has been replaced
+		e.building = true
+		buildNumber := atomic.AddInt32(&startedBuilds, 1)
+		go func() {
+			var err error
+			defer func() {
+				if atomic.LoadInt32(&startedBuilds) != buildNumber {
+					// Replaced by a newer build, which is the one that is running now
+					return
+				}
+				e.building = false
+				if err == errBuildCancelled {
+					// Cancelled with esc, or by running a test
+					e.runAfterBuild = false
+					return
+				}
+				if e.runAfterBuild {
+					e.runAfterBuild = false
+
+					doneRunning := false
+					go func() {
+						time.Sleep(500 * time.Millisecond)
+						if !doneRunning {
+							e.DrawOutput(c, 20, "", "Done building. Running...", e.DebugStoppedBackground, true)
+						}
+					}()
+
+					output, err := e.Run(c, tty, status, e.filename)
+					doneRunning = true
+					if err != nil {
+						status.SetError(err)
+						status.Show(c, e)
+						return // from goroutine
+					}
+					title := "Last 20 lines of output"
+					if strings.Count(output, "\n") <= 19 {
+						title = "Program output"
+					}
+
+					e.DrawOutput(c, 20, title, output, e.DebugRunningBackground, true) // also reposition cursor after drawing
+				}
+			}()
+
+			// Build or export the current file
+			// The last argument is if the command should run in the background or not
+			var outputExecutable string
+			outputExecutable, err = e.BuildOrExport(c, tty, status, e.filename, e.mode == mode.Markdown)
+			if err == errBuildCancelled {
+				return // return from goroutine
+			}
+			// All clear when it comes to status messages and redrawing
+			status.ClearAll(c)
+			if err != nil {
+				// There was an error, so don't run after building after all
+				e.runAfterBuild = false
+				// Error while building
+				status.SetError(err)
+				status.ShowNoTimeout(c, e)
+				return // return from goroutine
+			}
+			// Not building any more
+			e.building = false
+
+			// --- success ---
+
+			// ctrl-space was pressed while in debug mode, and without a debug session running
+			if e.debugMode && e.gdb == nil {
+				if err := e.DebugStartSession(c, tty, status, outputExecutable); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.ShowNoTimeout(c, e)
+					e.redrawCursor = true
+				}
+				return // return from goroutine
+			}
+
+			// Regular success, no debug mode
+			status.SetMessage("Success")
+			status.Show(c, e)
+			e.RunHooksInBackground(c, status, hookBuildSuccess)
+		}()
+
+	case "c:20": // ctrl-tV
+		// for C or C++: jump to header/source, or insert symbol
+		// for Agda: insert symbol
+		// for the rest: record and play back macros
+		// debug mode: next insTruction
+
+		// Save the current file, but only if it has changed
+		if e.changed {
+			if err := e.Save(c, tty); err != nil {
+				status.ClearAll(c)
+				status.SetError(err)
+				status.Show(c, e)
+				break
+			}
+		}
+
+		e.redrawCursor = true
+
+		if (e.mode == mode.C || e.mode == mode.Cpp) && hasS([]string{".cpp", ".cc", ".c", ".cxx", ".c++"}, filepath.Ext(e.filename)) { // jump from source to header file
+			// If this is a C++ source file, try finding and opening the corresponding header file
+			// Check if there is a corresponding header file
+			if absFilename, err := e.AbsFilename(); err == nil { // no error
+				headerExtensions := []string{".h", ".hpp", ".h++"}
+				if headerFilename, err := ExtFileSearch(absFilename, headerExtensions, fileSearchMaxTime); err == nil && headerFilename != "" { // no error
+					// Switch to another file (without forcing it)
+					if err := e.Switch(c, tty, status, fileLock, headerFilename, false); err != nil {
+						status.ClearAll(c)
+						status.SetError(err)
+						status.Show(c, e)
+					}
+					break
+				}
+			}
+			status.ClearAll(c)
+			status.SetErrorMessage("No corresponding header file")
+			status.Show(c, e)
+		} else if (e.mode == mode.C || e.mode == mode.Cpp) && hasS([]string{".h", ".hpp", ".h++"}, filepath.Ext(e.filename)) { // jump from header to source file
+			// If this is a header file, present a menu option for open the corresponding source file
+			// Check if there is a corresponding header file
+			if absFilename, err := e.AbsFilename(); err == nil { // no error
+				sourceExtensions := []string{".c", ".cpp", ".cxx", ".cc", ".c++"}
+				if headerFilename, err := ExtFileSearch(absFilename, sourceExtensions, fileSearchMaxTime); err == nil && headerFilename != "" { // no error
+					// Switch to another file (without forcing it)
+					if err := e.Switch(c, tty, status, fileLock, headerFilename, false); err != nil {
+						status.ClearAll(c)
+						status.SetError(err)
+						status.Show(c, e)
+					}
+					break
+				}
+			}
+			status.ClearAll(c)
+			status.SetErrorMessage("No corresponding source file")
+			status.Show(c, e)
+		} else if e.mode == mode.Agda { // insert symbol
+			e.redraw = true
+			menuChoices := agdaSymbols
+			selectedSymbol := "¤"
+			selectedX, selectedY, cancel := e.SymbolMenu(status, tty, "Insert symbol", menuChoices, e.MenuTitleColor, e.MenuTextColor, e.MenuArrowColor)
+			if !cancel {
+				undo.Snapshot(e)
+				if selectedY < len(menuChoices) {
+					row := menuChoices[selectedY]
+					if selectedX < len(row) {
+						selectedSymbol = menuChoices[selectedY][selectedX]
+					}
+				}
+				e.InsertString(c, selectedSymbol)
+			}
+		} else if e.mode == mode.Ivy { // insert symbol
+			e.redraw = true
+			menuChoices := ivySymbols
+			selectedSymbol := "×"
+			selectedX, selectedY, cancel := e.SymbolMenu(status, tty, "Insert symbol", menuChoices, e.MenuTitleColor, e.MenuTextColor, e.MenuArrowColor)
+			if !cancel {
+				undo.Snapshot(e)
+				if selectedY < len(menuChoices) {
+					row := menuChoices[selectedY]
+					if selectedX < len(row) {
+						selectedSymbol = menuChoices[selectedY][selectedX]
+					}
+				}
+				e.InsertString(c, selectedSymbol)
+			}
+
+			// Start recording a macro, then stop the recording when ctrl-t is pressed again,
+			// then ask for the number of repetitions to play it back when it's pressed after that,
+			// then clear the macro when esc is pressed.
+		} else if e.macro == nil {
+			undo.Snapshot(e)
+			undo.IgnoreSnapshots(true)
+			status.Clear(c)
+			status.SetMessage("Recording macro")
+			status.Show(c, e)
+			e.macro = NewMacro()
+			e.macro.Recording = true
+			ks.playBackMacroCount = 0
+		} else if e.macro.Recording { // && e.macro != nil
+			e.macro.Recording = false
+			undo.IgnoreSnapshots(true)
+			ks.playBackMacroCount = 0
+			status.Clear(c)
+			if macroLen := e.macro.Len(); macroLen == 0 {
+				status.SetMessage("Stopped recording")
+				e.macro = nil
+			} else if macroLen < 10 {
+				status.SetMessage("Recorded " + strings.Join(e.macro.KeyPresses, " "))
+			} else {
+				status.SetMessage(fmt.Sprintf("Recorded %d steps", macroLen))
+			}
+			status.Show(c, e)
+		} else if ks.playBackMacroCount > 0 {
+			undo.IgnoreSnapshots(false)
+			status.Clear(c)
+			status.SetMessage("Stopped macro") // stop macro playback
+			status.Show(c, e)
+			ks.playBackMacroCount = 0
+			e.macro.Home()
+		} else { // && e.macro != nil && playBackMacroCount == 0 // start macro playback
+			undo.IgnoreSnapshots(false)
+			undo.Snapshot(e)
+			status.ClearAll(c)
+			// Play back the macro, once
+			ks.playBackMacroCount = 1
+		}
+	case "c:28": // ctrl-\, toggle comment for this block
+		undo.Snapshot(e)
+		e.ToggleCommentBlock()
+		e.redraw = true
+		e.redrawCursor = true
+	case "c:15": // ctrl-o, launch the command menu
+		status.ClearAll(c)
+		undo.Snapshot(e)
+		undoBackup := undo
+		ks.lastCommandMenuIndex = e.CommandMenu(c, tty, status, ks.bookmark, undo, ks.lastCommandMenuIndex, ks.forceFlag, fileLock)
+		undo = undoBackup
+		if e.AfterEndOfLine() {
+			e.End(c)
+		}
+
+	case "c:7": // ctrl-g, status mode
+		e.statusMode = !e.statusMode
+		if e.statusMode {
+			status.ShowLineColWordCount(c, e, e.filename)
+		} else {
+			status.ClearAll(c)
+		}
+	case "←": // left arrow
+
+		// Check if it's a special case
+		if ks.kh.SpecialArrowKeypressWith("←") {
+			// Ask the user for a command and run it
+			e.CommandPrompt(c, tty, status, ks.bookmark, undo)
+			// It's important to reset the key history after hitting this combo
+			ks.clearKeyHistory = true
+			break
+		}
+
+		// Move freely in ASCII draw mode
+		if e.drawMode {
+			e.DrawMove(c, status, -1, 0, false)
+			break
+		}
+
+		// movement if there is horizontal scrolling
+		if e.pos.offsetX > 0 {
+			if e.pos.sx > 0 {
+				// Move one step left, past a tab or a wide rune
+				e.pos.sx -= e.leftRuneColumns()
+				if e.pos.sx < 0 {
+					e.pos.sx = 0
+				}
+			} else {
+				// Scroll one step left
+				e.pos.offsetX--
+				e.redraw = true
+			}
+			e.SaveX(true)
+		} else if e.pos.sx > 0 {
+			// no horizontal scrolling going on
+			// Move one step left, past a tab or a wide rune
+			e.pos.sx -= e.leftRuneColumns()
+			if e.pos.sx < 0 {
+				e.pos.sx = 0
+			}
+			e.SaveX(true)
+		} else if e.DataY() > 0 {
+			// no scrolling or movement to the left going on
+			e.Up(c, status)
+			e.End(c)
+			//e.redraw = true
+		} // else at the start of the document
+		e.redrawCursor = true
+		// Workaround for Konsole
+		if e.pos.sx <= 2 {
+			// Konsole prints "2H" here, but
+			// no other terminal emulator does that
+			e.redraw = true
+		}
+	case "→": // right arrow
+
+		// Check if it's a special case
+		if ks.kh.SpecialArrowKeypressWith("→") {
+			// Ask the user for a command and run it
+			e.CommandPrompt(c, tty, status, ks.bookmark, undo)
+			// It's important to reset the key history after hitting this combo
+			ks.clearKeyHistory = true
+			break
+		}
+
+		// Move freely in ASCII draw mode
+		if e.drawMode {
+			e.DrawMove(c, status, 1, 0, false)
+			break
+		}
+
+		// If on the last line or before, go to the next character
+		if e.DataY() <= LineIndex(e.Len()) {
+			e.Next(c)
+		}
+		if e.AfterScreenWidth(c) {
+			// Scroll far enough for all of a wide rune to be visible
+			for e.AfterScreenWidth(c) && e.pos.sx > 0 {
+				e.pos.offsetX++
+				e.pos.sx--
+			}
+			e.redraw = true
+			if e.AfterEndOfLine() {
+				e.Down(c, status)
+			}
+		} else if e.AfterEndOfLine() {
+			e.End(c)
+		}
+		e.SaveX(true)
+		e.redrawCursor = true
+	case "↑": // up arrow
+
+		// Check if it's a special case
+		if ks.kh.SpecialArrowKeypressWith("↑") {
+			// Ask the user for a command and run it
+			e.CommandPrompt(c, tty, status, ks.bookmark, undo)
+			// It's important to reset the key history after hitting this combo
+			ks.clearKeyHistory = true
+			break
+		}
+
+		// Move freely in ASCII draw mode
+		if e.drawMode {
+			e.DrawMove(c, status, 0, -1, false)
+			break
+		}
+
+		// TODO: Stay at the same X offset when moving up in the document?
+		if e.pos.offsetX > 0 {
+			e.pos.offsetX = 0
+		}
+
+		if e.DataY() > 0 {
+			// Move the position up in the current screen
+			if e.UpEnd(c) != nil {
+				// If below the top, scroll the contents up
+				if e.DataY() > 0 {
+					e.redraw = e.ScrollUp(c, status, 1)
+					e.pos.Down(c)
+					e.UpEnd(c)
+				}
+			}
+			// If the cursor is after the length of the current line, move it to the end of the current line
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+		}
+		// If the cursor is after the length of the current line, move it to the end of the current line
+		if e.AfterLineScreenContents() {
+			e.End(c)
+
+			// Then, if the rune to the left is '}', move one step to the left
+			if r := e.LeftRune(); r == '}' {
+				e.Prev(c)
+			}
+		}
+		e.redrawCursor = true
+	case "↓": // down arrow
+
+		// Check if it's a special case
+		if ks.kh.SpecialArrowKeypressWith("↓") {
+			// Ask the user for a command and run it
+			e.CommandPrompt(c, tty, status, ks.bookmark, undo)
+			// It's important to reset the key history after hitting this combo
+			ks.clearKeyHistory = true
+			break
+		}
+
+		// Move freely in ASCII draw mode
+		if e.drawMode {
+			e.DrawMove(c, status, 0, 1, false)
+			break
+		}
+
+		// TODO: Stay at the same X offset when moving down in the document?
+		if e.pos.offsetX > 0 {
+			e.pos.offsetX = 0
+		}
+
+		if e.DataY() < LineIndex(e.Len()) {
+			// Move the position down in the current screen
+			if e.DownEnd(c) != nil {
+				// If at the bottom, don't move down, but scroll the contents
+				// Output a helpful message
+				if !e.AfterEndOfDocument() {
+					e.redraw = e.ScrollDown(c, status, 1)
+					e.pos.Up()
+					e.DownEnd(c)
+				}
+			}
+			// If the cursor is after the length of the current line, move it to the end of the current line
+			if e.AfterLineScreenContents() {
+				e.End(c)
+
+				// Then, if the rune to the left is '}', move one step to the left
+				if r := e.LeftRune(); r == '}' {
+					e.Prev(c)
+				}
+			}
+		}
+		// If the cursor is after the length of the current line, move it to the end of the current line
+		if e.AfterLineScreenContents() {
+			e.End(c)
+		}
+		e.redrawCursor = true
+	case "c:14": // ctrl-n, scroll down or jump to next match, using the sticky search term
+
+		// If in Debug mode, let ctrl-n mean "next instruction"
+		if e.debugMode {
+			if e.gdb != nil {
+				if !programRunning {
+					e.DebugEnd()
+					status.SetMessage("Program stopped")
+					status.SetMessageAfterRedraw(status.Message())
+					e.redraw = true
+					e.redrawCursor = true
+					break
+				}
+				if err := e.DebugNextInstruction(); err != nil {
+					if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
+						e.DebugEnd()
+						status.SetMessage("Could not start GDB")
+					} else if err == errProgramStopped {
+						e.DebugEnd()
+						status.SetMessage("Program stopped, could not step")
+					} else { // got an unrecognized error
+						e.DebugEnd()
+						status.SetMessage(errorMessage)
+					}
+				} else {
+					if !programRunning {
+						e.DebugEnd()
+						status.SetMessage("Program stopped when stepping") // Next instruction
+					} else {
+						// Don't show a status message per instruction/step when pressing ctrl-n
+						break
+					}
+				}
+				e.redrawCursor = true
+				status.SetMessageAfterRedraw(status.Message())
+				break
+			} else { // e.gdb == nil
+				// Build or export the current file
+				// The last argument is if the command should run in the background or not
+				outputExecutable, err := e.BuildOrExport(c, tty, status, e.filename, e.mode == mode.Markdown)
+				// All clear when it comes to status messages and redrawing
+				status.ClearAll(c)
+				if err != nil && err != errNoSuitableBuildCommand {
+					// Error while building
+					status.SetError(err)
+					status.ShowNoTimeout(c, e)
+					e.debugMode = false
+					e.redrawCursor = true
+					e.redraw = true
+					break
+				}
+				// Was no suitable compilation or export command found?
+				if err == errNoSuitableBuildCommand {
+					//status.ClearAll(c)
+					if e.debugMode {
+						// Both in debug mode and can not find a command to build this file with.
+						status.SetError(err)
+						status.ShowNoTimeout(c, e)
+						e.debugMode = false
+						e.redrawCursor = true
+						e.redraw = true
+						break
+					}
+					// Building this file extension is not implemented yet.
+					// Just display the current time and word count.
+					// TODO: status.ClearAll() should have cleared the status bar first, but this is not always true,
+					//       which is why the message is hackily surrounded by spaces. Fix.
+					statsMessage := fmt.Sprintf("    %d words, %s    ", e.WordCount(), time.Now().Format("15:04")) // HH:MM
+					status.SetMessage(statsMessage)
+					status.Show(c, e)
+					e.redrawCursor = true
+					break
+				}
+				// Start debugging
+				if err := e.DebugStartSession(c, tty, status, outputExecutable); err != nil {
+					status.ClearAll(c)
+					status.SetError(err)
+					status.ShowNoTimeout(c, e)
+					e.redrawCursor = true
+				}
+				break
+			}
+		}
+
+		e.UseStickySearchTerm()
+		if e.SearchTerm() != "" {
+			// Go to next match
+			wrap := searchWrap
+			forward := true
+			if wrapped, err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
+				status.Clear(c)
+				status.SetMessage(e.searchNotFoundMessage(wrap))
+				status.Show(c, e)
+			} else if err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			} else {
+				// Show the number of the match, and if the search wrapped around
+				status.SetMessageAfterRedraw(e.searchMatchMessage(wrapped, forward))
+			}
+		} else if projectSearch != nil {
+			// Go to the next match from the project search
+			if m, err := projectSearch.Next(); err == nil { // no error
+				if err := e.GoToProjectMatch(c, tty, status, projectSearch, m); err != nil {
+					status.SetError(err)
+					status.Show(c, e)
+				}
+			}
+		} else {
+
+			// Scroll down
+			e.redraw = e.ScrollDown(c, status, e.pos.scrollSpeed)
+			// If e.redraw is false, the end of file is reached
+			if !e.redraw {
+				status.Clear(c)
+				status.SetMessage("EOF")
+				status.Show(c, e)
+			}
+			e.redrawCursor = true
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+
+		}
+	case "c:16": // ctrl-p, scroll up or jump to the previous match, using the sticky search term. In debug mode, change the pane layout.
+
+		if e.debugMode {
+			// e.showRegisters has three states, 0 (SmallRegisterWindow), 1 (LargeRegisterWindow) and 2 (NoRegisterWindow)
+			e.debugShowRegisters++
+			if e.debugShowRegisters > noRegisterWindow {
+				e.debugShowRegisters = smallRegisterWindow
+			}
+			break
+		}
+
+		e.UseStickySearchTerm()
+		if e.SearchTerm() != "" {
+			// Go to previous match
+			wrap := searchWrap
+			forward := false
+			if wrapped, err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
+				status.Clear(c)
+				status.SetMessage(e.searchNotFoundMessage(wrap))
+				status.Show(c, e)
+			} else if err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			} else {
+				// Show the number of the match, and if the search wrapped around
+				status.SetMessageAfterRedraw(e.searchMatchMessage(wrapped, forward))
+			}
+		} else if projectSearch != nil {
+			// Go to the previous match from the project search
+			if m, err := projectSearch.Prev(); err == nil { // no error
+				if err := e.GoToProjectMatch(c, tty, status, projectSearch, m); err != nil {
+					status.SetError(err)
+					status.Show(c, e)
+				}
+			}
+		} else {
+			e.redraw = e.ScrollUp(c, status, e.pos.scrollSpeed)
+			e.redrawCursor = true
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+
+		}
+		// Additional way to clear the sticky search term, like with Esc
+	case "c:27": // esc, clear search term (but not the sticky search term), reset, clean and redraw
+		// If o is used as a man page viewer, exit at the press of esc
+		if e.mode == mode.ManPage {
+			e.clearOnQuit = false
+			e.quit = true
+			break
+		}
+		// Exit debug mode, if active
+		if e.debugMode {
+			e.DebugEnd()
+			e.debugMode = false
+			status.SetMessageAfterRedraw("Normal mode")
+			break
+		}
+		// Cancel the build that is running in the background, if any
+		if CancelBuild() {
+			e.building = false
+			e.runAfterBuild = false
+			status.SetMessageAfterRedraw("Build cancelled")
+		}
+		// Reset the cut/copy/paste double-keypress detection
+		ks.ccp.Reset()
+		// Stop cycling through the project search results with ctrl-n and ctrl-p
+		projectSearch = nil
+		// Forget the first rectangle corner, if in ASCII draw mode
+		e.drawMark = nil
+		// Return to where the search was started, if esc is pressed right after jumping between the matches
+		if e.SearchTerm() != "" && ks.kh.PrevIs("c:14", "c:16") {
+			e.GoTo(e.lineBeforeSearch, c, status)
+		}
+		// Do a full clear and redraw + clear search term + jump
+		drawLines := true
+		resized := false
+		e.FullResetRedraw(c, status, drawLines, resized)
+		if e.macro != nil || ks.playBackMacroCount > 0 {
+			// Stop the playback
+			ks.playBackMacroCount = 0
+			// Clear the macro
+			e.macro = nil
+			// Show a message after the redraw
+			status.SetMessageAfterRedraw("Macro cleared")
+			break
+		}
+		e.redraw = true
+		e.redrawCursor = true
+	case " ": // space
+
+		// Scroll down if a man page is being viewed, or if the editor is read-only
+		if e.readOnly {
+			// Scroll down at double scroll speed
+			e.redraw = e.ScrollDown(c, status, e.pos.scrollSpeed*2)
+			// If e.redraw is false, the end of file is reached
+			if !e.redraw {
+				status.Clear(c)
+				status.SetMessage("EOF")
+				status.Show(c, e)
+			}
+			e.redrawCursor = true
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+			break
+		}
+
+		// Mark a rectangle corner, or draw a rectangle, if in ASCII draw mode
+		if e.drawMode {
+			undo.Snapshot(e)
+			e.DrawRectangleCorner(c, status)
+			break
+		}
+
+		// Regular behavior, take an undo snapshot and insert a space
+		undo.Snapshot(e)
+		if e.Overwriting() && !lastKeyPasted {
+			e.OverwriteRune(c, ' ')
+			break
+		}
+		// Place a space
+		wrapped := e.InsertRune(c, ' ')
+		if !wrapped {
+			e.WriteRune(c)
+			// Move to the next position
+			e.Next(c)
+		}
+		e.redraw = true
+	case "c:13": // return
+
+		// Scroll down if a man page is being viewed, or if the editor is read-only
+		if e.readOnly {
+			// Scroll down at double scroll speed
+			e.redraw = e.ScrollDown(c, status, e.pos.scrollSpeed*2)
+			// If e.redraw is false, the end of file is reached
+			if !e.redraw {
+				status.Clear(c)
+				status.SetMessage("EOF")
+				status.Show(c, e)
+			}
+			e.redrawCursor = true
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+			break
+		}
+
+		// Regular behavior
+
+		// Modify the paste double-keypress detection to allow for a manual return before pasting the rest
+		ks.ccp.NewLinePressed(ks.kh.Prev() == "c:13")
+
+		undo.Snapshot(e)
+
+		var (
+			lineContents             = e.CurrentLine()
+			trimmedLine              = strings.TrimSpace(lineContents)
+			currentLeadingWhitespace = e.LeadingWhitespace()
+
+			// Grab the leading whitespace from the current line, and indent depending on the end of trimmedLine
+			leadingWhitespace = e.smartIndentation(currentLeadingWhitespace, trimmedLine, false) // the last parameter is "also dedent"
+
+			noHome = false
+			indent = true
+		)
+
+		// TODO: add and use something like "e.shouldAutoIndent" for these file types
+		if e.mode == mode.Markdown || e.mode == mode.Text || e.mode == mode.Blank {
+			indent = false
+		}
+
+		if trimmedLine == "private:" || trimmedLine == "protected:" || trimmedLine == "public:" {
+			// De-indent the current line before moving on to the next
+			e.SetCurrentLine(trimmedLine)
+			leadingWhitespace = currentLeadingWhitespace
+		} else if e.mode == mode.C || e.mode == mode.Cpp || e.mode == mode.Shader || e.mode == mode.Zig || e.mode == mode.Java || e.mode == mode.JavaScript || e.mode == mode.Kotlin || e.mode == mode.TypeScript || e.mode == mode.D || e.mode == mode.Hare || e.mode == mode.Jakt {
+			// Add missing parenthesis for "if ... {", "} else if", "} elif", "for", "while" and "when" for C-like languages
+			for _, kw := range []string{"for", "foreach", "foreach_reverse", "if", "switch", "when", "while", "while let", "} else if", "} elif"} {
+				if strings.HasPrefix(trimmedLine, kw+" ") && !strings.HasPrefix(trimmedLine, kw+" (") {
+					if strings.HasSuffix(trimmedLine, " {") {
+						// Add ( and ), keep the final "{"
+						e.SetCurrentLine(currentLeadingWhitespace + kw + " (" + trimmedLine[len(kw)+1:len(trimmedLine)-2] + ") {")
+						e.pos.sx += 2
+					} else if !strings.HasSuffix(trimmedLine, ")") {
+						// Add ( and ), there is no final "{"
+						e.SetCurrentLine(currentLeadingWhitespace + kw + " (" + trimmedLine[len(kw)+1:] + ")")
+						e.pos.sx += 2
+						indent = true
+						leadingWhitespace = e.indentation.String() + currentLeadingWhitespace
+					}
+				}
+			}
+		} else if snippet, ok := Snippets(e.mode)[trimmedLine]; ok && trimmedLine != "" {
+			// Expand a snippet, like "iferr" for Go, when it is alone on the line
+			e.SetCurrentLine(currentLeadingWhitespace + trimmedLine)
+			e.End(c)
+			e.ExpandSnippet(c, status, snippet)
+			if e.InSnippet() {
+				// Stay at the first placeholder instead of adding a new line
+				break
+			}
+		} else if (e.mode == mode.XML || e.mode == mode.HTML) && !e.noExpandTags && trimmedLine != "" && !strings.Contains(trimmedLine, "<") && !strings.Contains(trimmedLine, ">") && strings.ToLower(string(trimmedLine[0])) == string(trimmedLine[0]) {
+			// Words one a line without < or >? Expand into <tag asdf> above and </tag> below.
+			words := strings.Fields(trimmedLine)
+			tagName := words[0] // must be at least one word
+			// the second word after the tag name needs to be ie. x=42 or href=...,
+			// and the tag name must only contain letters a-z A-Z
+			if (len(words) == 1 || strings.Contains(words[1], "=")) && onlyAZaz(tagName) {
+				above := "<" + trimmedLine + ">"
+				if tagName == "img" && !strings.Contains(trimmedLine, "alt=") && strings.Contains(trimmedLine, "src=") {
+					// Pick out the image URI from the "src=" declaration
+					imageURI := ""
+					for _, word := range strings.Fields(trimmedLine) {
+						if strings.HasPrefix(word, "src=") {
+							imageURI = strings.SplitN(word, "=", 2)[1]
+							imageURI = strings.TrimPrefix(imageURI, "\"")
+							imageURI = strings.TrimSuffix(imageURI, "\"")
+							imageURI = strings.TrimPrefix(imageURI, "'")
+							imageURI = strings.TrimSuffix(imageURI, "'")
+							break
+						}
+					}
+					// If we got something that looks like and image URI, use the description before "." and capitalize it,
+					// then use that as the default "alt=" declaration.
+					if strings.Contains(imageURI, ".") {
+						imageName := capitalizeWords(strings.TrimSuffix(imageURI, filepath.Ext(imageURI)))
+						above = "<" + trimmedLine + " alt=\"" + imageName + "\">"
+					}
+				}
+				// Now replace the current line
+				e.SetCurrentLine(currentLeadingWhitespace + above)
+				e.End(c)
+				// And insert a line below
+				e.InsertLineBelow()
+				// Then if it's not an img tag, insert the closing tag below the current line
+				if tagName != "img" {
+					e.pos.sy++
+					below := "</" + tagName + ">"
+					e.SetCurrentLine(currentLeadingWhitespace + below)
+					e.pos.sy--
+					e.pos.sx += 2
+					indent = true
+					leadingWhitespace = e.indentation.String() + currentLeadingWhitespace
+				}
+			}
+		}
+
+		//onlyOneLine := e.AtFirstLineOfDocument() && e.AtOrAfterLastLineOfDocument()
+		//middleOfText := !e.AtOrBeforeStartOfTextLine() && !e.AtOrAfterEndOfLine()
+
+		scrollBack := false
+
+		// TODO: Collect the criteria that trigger the same behavior
+
+		switch {
+		case e.AtOrAfterLastLineOfDocument() && (e.AtStartOfTheLine() || e.AtOrBeforeStartOfTextScreenLine()):
+			e.InsertLineAbove()
+			noHome = true
+		case e.AtOrAfterEndOfDocument() && !e.AtStartOfTheLine() && !e.AtOrAfterEndOfLine():
+			e.InsertStringAndMove(c, "")
+			e.InsertLineBelow()
+			scrollBack = true
+		case e.AfterEndOfLine():
+			e.InsertLineBelow()
+			scrollBack = true
+		case !e.AtFirstLineOfDocument() && e.AtOrAfterLastLineOfDocument() && (e.AtStartOfTheLine() || e.AtOrAfterEndOfLine()):
+			e.InsertStringAndMove(c, "")
+			scrollBack = true
+		case e.AtStartOfTheLine():
+			e.InsertLineAbove()
+			noHome = true
+		default:
+			// Split the current line in two
+			if !e.SplitLine() {
+				e.InsertLineBelow()
+			}
+			scrollBack = true
+			// Indent the next line if at the end, not else
+			if !e.AfterEndOfLine() {
+				indent = false
+			}
+		}
+		e.MakeConsistent()
+
+		h := int(c.Height())
+		if e.pos.sy > (h - 1) {
+			e.pos.Down(c)
+			e.redraw = e.ScrollDown(c, status, 1)
+			e.redrawCursor = true
+		} else if e.pos.sy == (h - 1) {
+			e.redraw = e.ScrollDown(c, status, 1)
+			e.redrawCursor = true
+		} else {
+			e.pos.Down(c)
+		}
+
+		if !noHome {
+			e.pos.sx = 0
+			//e.Home()
+			if scrollBack {
+				e.pos.SetX(c, 0)
+			}
+		}
+
+		if indent && len(leadingWhitespace) > 0 {
+			// If the leading whitespace starts with a tab and ends with a space, remove the final space
+			if strings.HasPrefix(leadingWhitespace, "\t") && strings.HasSuffix(leadingWhitespace, " ") {
+				leadingWhitespace = leadingWhitespace[:len(leadingWhitespace)-1]
+				//logf("cleaned leading whitespace: %v\n", []rune(leadingWhitespace))
+			}
+			if !noHome {
+				// Insert the same leading whitespace for the new line
+				e.SetCurrentLine(leadingWhitespace + e.LineContentsFromCursorPosition())
+				// Then move to the start of the text
+				e.GoToStartOfTextLine(c)
+			}
+		}
+
+		e.SaveX(true)
+		e.redraw = true
+		e.redrawCursor = true
+	case "c:8", "c:127": // ctrl-h or backspace
+
+		// Delete the selected text, if any
+		if e.Selecting() {
+			undo.Snapshot(e)
+			e.DeleteSelection(c)
+			e.redraw = true
+			e.redrawCursor = true
+			break
+		}
+
+		// Scroll up if a man page is being viewed, or if the editor is read-only
+		if e.readOnly {
+			// Scroll up at double speed
+			e.redraw = e.ScrollUp(c, status, e.pos.scrollSpeed*2)
+			e.redrawCursor = true
+			if e.AfterLineScreenContents() {
+				e.End(c)
+			}
+			break
+		}
+
+		// Just clear the search term, if there is an active search
+		if len(e.SearchTerm()) > 0 {
+			e.ClearSearchTerm()
+			e.redraw = true
+			e.redrawCursor = true
+			// Don't break, continue to delete to the left after clearing the search,
+			// since Esc can be used to only clear the search.
+			//break
+		}
+
+		undo.Snapshot(e)
+		// Replace the character to the left with a space, if in overwrite mode or draw mode
+		if e.Overwriting() {
+			e.OverwriteBackspace(c)
+			break
+		}
+		// Delete the character to the left
+		if e.EmptyLine() {
+			e.DeleteCurrentLineMoveBookmark(ks.bookmark)
+			e.pos.Up()
+			e.TrimRight(e.DataY())
+			e.End(c)
+		} else if e.AtStartOfTheLine() { // at the start of the screen line, the line may be scrolled
+			// remove the rest of the current line and move to the last letter of the line above
+			// before deleting it
+			if e.DataY() > 0 {
+				e.pos.Up()
+				e.TrimRight(e.DataY())
+				e.End(c)
+				e.Delete()
+			}
+		} else if e.indentation.Spaces && (e.EmptyLine() || e.AtStartOfTheLine()) && e.indentation.WSLen(e.LeadingWhitespace()) >= e.indentation.PerTab {
+			// Delete several spaces
+			for i := 0; i < e.indentation.PerTab; i++ {
+				// Move back
+				e.Prev(c)
+				// Type a blank
+				e.SetRune(' ')
+				e.WriteRune(c)
+				e.Delete()
+			}
+		} else {
+			// Move back
+			e.Prev(c)
+			// Type a blank
+			e.SetRune(' ')
+			e.WriteRune(c)
+			if !e.AtOrAfterEndOfLine() {
+				// Delete the blank
+				e.Delete()
+			}
+		}
+		e.redrawCursor = true
+		e.redraw = true
+	case "c:9": // tab or ctrl-i
+
+		if e.debugMode {
+			e.debugStepInto = !e.debugStepInto
+			break
+		}
+
+		// Indent the selected lines
+		if e.Selecting() && !e.readOnly {
+			undo.Snapshot(e)
+			e.IndentRange(e.SelectedLines(), false)
+			break
+		}
+
+		// Move to the next tab stop, overwriting with spaces, if in overwrite mode and not pasting
+		if e.Overwriting() && !lastKeyPasted {
+			undo.Snapshot(e)
+			e.OverwriteTab(c)
+			break
+		}
+
+		y := int(e.DataY())
+		r := e.Rune()
+		leftRune := e.LeftRune()
+		ext := filepath.Ext(e.filename)
+
+		// Expand the snippet before the cursor, or jump to the next placeholder in the last expanded snippet
+		if snippet := e.SnippetBeforeCursor(); snippet != nil {
+			undo.Snapshot(e)
+			e.ExpandSnippet(c, status, snippet)
+			break
+		} else if e.InSnippet() {
+			e.NextSnippetStop(c, status)
+			break
+		}
+
+		// Tab completion of words from the open files and of keywords
+		if word := e.LettersBeforeCursor(); e.mode != mode.Blank && e.mode != mode.GoAssembly && e.mode != mode.Assembly && leftRune != '.' && !unicode.IsLetter(r) && len(word) > 0 {
+			if e.Complete(c, tty, undo) {
+				break
+			}
+
+			// Tab completion after a '.'
+		} else if word := e.LettersOrDotBeforeCursor(); e.mode != mode.Blank && e.mode != mode.GoAssembly && e.mode != mode.Assembly && leftRune == '.' && !unicode.IsLetter(r) && len(word) > 0 {
+			// Now the preceding word before the "." has been found
+
+			// Trim the trailing ".", if needed
+			word = strings.TrimSuffix(strings.TrimSpace(word), ".")
+
+			// Grep all files in this directory with the same extension as the currently edited file
+			// for what could follow the word and a "."
+			suggestions := corpus(word, "*"+ext)
+
+			// Choose a suggestion (tab cycles to the next suggestion)
+			chosen := e.SuggestMode(c, status, tty, suggestions)
+			e.redrawCursor = true
+			e.redraw = true
+
+			if chosen != "" {
+				undo.Snapshot(e)
+				// Insert the chosen word
+				e.InsertStringAndMove(c, chosen)
+				break
+			}
+
+		}
+
+		// Enable auto indent if the extension is not "" and either:
+		// * The mode is set to Go and the position is not at the very start of the line (empty or not)
+		// * Syntax highlighting is enabled and the cursor is not at the start of the line (or before)
+		trimmedLine := e.TrimmedLine()
+
+		// Check if a line that is more than just a '{', '(', '[' or ':' ends with one of those
+		endsWithSpecial := len(trimmedLine) > 1 && r == '{' || r == '(' || r == '[' || r == ':'
+
+		// Smart indent if:
+		// * the rune to the left is not a blank character or the line ends with {, (, [ or :
+		// * and also if it the cursor is not to the very left
+		// * and also if this is not a text file or a blank file
+		noSmartIndentation := e.mode == mode.GoAssembly || e.mode == mode.Perl || e.mode == mode.Assembly || e.mode == mode.OCaml || e.mode == mode.StandardML || e.mode == mode.Blank
+		if (!unicode.IsSpace(leftRune) || endsWithSpecial) && e.pos.sx > 0 && !noSmartIndentation {
+			lineAbove := 1
+			if strings.TrimSpace(e.Line(LineIndex(y-lineAbove))) == "" {
+				// The line above is empty, use the indentation before the line above that
+				lineAbove--
+			}
+			indexAbove := LineIndex(y - lineAbove)
+			// If we have a line (one or two lines above) as a reference point for the indentation
+			if strings.TrimSpace(e.Line(indexAbove)) != "" {
+
+				// Move the current indentation to the same as the line above
+				undo.Snapshot(e)
+
+				var (
+					spaceAbove        = e.LeadingWhitespaceAt(indexAbove)
+					strippedLineAbove = e.StripSingleLineComment(strings.TrimSpace(e.Line(indexAbove)))
+					newLeadingSpace   string
+				)
+
+				oneIndentation := e.indentation.String()
+
+				// Smart-ish indentation
+				if !strings.HasPrefix(strippedLineAbove, "switch ") && (strings.HasPrefix(strippedLineAbove, "case ")) ||
+					strings.HasSuffix(strippedLineAbove, "{") || strings.HasSuffix(strippedLineAbove, "[") ||
+					strings.HasSuffix(strippedLineAbove, "(") || strings.HasSuffix(strippedLineAbove, ":") ||
+					strings.HasSuffix(strippedLineAbove, " \\") ||
+					strings.HasPrefix(strippedLineAbove, "if ") {
+					// Use one more indentation than the line above
+					newLeadingSpace = spaceAbove + oneIndentation
+				} else if ((len(spaceAbove) - len(oneIndentation)) > 0) && strings.HasSuffix(trimmedLine, "}") {
+					// Use one less indentation than the line above
+					newLeadingSpace = spaceAbove[:len(spaceAbove)-len(oneIndentation)]
+				} else {
+					// Use the same indentation as the line above
+					newLeadingSpace = spaceAbove
+				}
+
+				e.SetCurrentLine(newLeadingSpace + trimmedLine)
+				if e.AtOrAfterEndOfLine() {
+					e.End(c)
+				}
+				e.redrawCursor = true
+				e.redraw = true
+
+				// job done
+				break
+
+			}
+		}
+
+		undo.Snapshot(e)
+		if e.indentation.Spaces {
+			for i := 0; i < e.indentation.PerTab; i++ {
+				e.InsertRune(c, ' ')
+				// Write the spaces that represent the tab to the canvas
+				e.WriteTab(c)
+				// Move to the next position
+				e.Next(c)
+			}
+		} else {
+			// Insert a tab character to the file
+			e.InsertRune(c, '\t')
+			// Write the spaces that represent the tab to the canvas
+			e.WriteTab(c)
+			// Move to the next position
+			e.Next(c)
+		}
+
+		// Prepare to redraw
+		e.redrawCursor = true
+		e.redraw = true
+	case "c:1": // ctrl-a, home
+
+		// Do not reset cut/copy/paste status
+
+		// First check if we just moved to this line with the arrow keys
+		justMovedUpOrDown := ks.kh.PrevIs("↓") || ks.kh.PrevIs("↑")
+		e.HomeCycle(c, status, justMovedUpOrDown)
+
+		e.redrawCursor = true
+		e.SaveX(true)
+	case "c:5": // ctrl-e, end
+
+		// Do not reset cut/copy/paste status
+
+		// First check if we just moved to this line with the arrow keys, or just cut a line with ctrl-x
+		justMovedUpOrDown := ks.kh.PrevIs("↓") || ks.kh.PrevIs("↑") || ks.kh.PrevIs("c:24")
+		e.EndCycle(c, status, justMovedUpOrDown)
+
+		e.redrawCursor = true
+		e.SaveX(true)
+	case keyShiftLeft, keyShiftRight, keyShiftUp, keyShiftDown: // shift-arrow, draw lines in ASCII draw mode
+		if !e.drawMode {
+			break
+		}
+		undo.Snapshot(e)
+		switch key {
+		case keyShiftLeft:
+			e.DrawMove(c, status, -1, 0, true)
+		case keyShiftRight:
+			e.DrawMove(c, status, 1, 0, true)
+		case keyShiftUp:
+			e.DrawMove(c, status, 0, -1, true)
+		case keyShiftDown:
+			e.DrawMove(c, status, 0, 1, true)
+		}
+	case keyCtrlLeft, keyAltLeft: // ctrl-arrow left or alt-arrow left, go to the previous word
+		e.PrevWord(c, status)
+		e.redrawCursor = true
+		e.SaveX(true)
+	case keyCtrlRight, keyAltRight: // ctrl-arrow right or alt-arrow right, go to the next word
+		e.NextWord(c, status)
+		e.redrawCursor = true
+		e.SaveX(true)
+	case keyShiftTab: // shift-tab, dedent the selected lines or the current block
+		if e.readOnly {
+			break
+		}
+		undo.Snapshot(e)
+		e.IndentRange(e.SelectedLinesOrBlock(), true)
+	case keyAltUp, keyAltDown: // alt-arrow up or alt-arrow down, move the current line or the selected lines
+		if e.readOnly {
+			break
+		}
+		undo.Snapshot(e)
+		if !e.MoveLines(c, status, e.SelectedLines(), key == keyAltUp, ks.bookmark) {
+			status.SetMessageAfterRedraw("Can not move further")
+		}
+	case keyAltBackspace: // alt-backspace, delete the word before the cursor
+		if e.readOnly {
+			break
+		}
+		undo.Snapshot(e)
+		if e.DeleteWordBeforeCursor(c) {
+			e.redraw = true
+			e.redrawCursor = true
+		}
+	case keyInsert: // Insert, toggle overwrite mode
+		e.ToggleOverwriteMode()
+		status.Clear(c)
+		if e.overwriteMode {
+			status.SetMessage("Overwrite mode")
+		} else {
+			status.SetMessage("Insert mode")
+		}
+		status.Show(c, e)
+	case keyHome: // Home, go to the start of the text or the start of the line, like ctrl-a, but stay on this line
+		justMovedUpOrDown := true
+		e.HomeCycle(c, status, justMovedUpOrDown)
+		e.redrawCursor = true
+		e.SaveX(true)
+	case keyEnd: // End, go to the end of the line, like ctrl-e, but stay on this line
+		justMovedUpOrDown := true
+		e.EndCycle(c, status, justMovedUpOrDown)
+		e.redrawCursor = true
+		e.SaveX(true)
+	case keyCtrlHome: // ctrl-Home, go to the top of the file, like "ctrl-l t"
+		e.ClearSearchTerm()
+		e.GoToTop(c, status)
+		e.redrawCursor = true
+	case keyCtrlEnd: // ctrl-End, go to the end of the file, like "ctrl-l e"
+		e.ClearSearchTerm()
+		e.GoToEnd(c, status)
+		e.redrawCursor = true
+	case "c:4": // ctrl-d, delete
+		undo.Snapshot(e)
+		if e.Selecting() {
+			e.DeleteSelection(c)
+			e.redraw = true
+			e.redrawCursor = true
+			break
+		}
+		if e.Empty() {
+			status.SetMessage("Empty")
+			status.Show(c, e)
+		} else {
+			e.Delete()
+			e.redraw = true
+		}
+		e.redrawCursor = true
+	case "c:29", "c:30": // ctrl-~, jump to matching parenthesis or curly bracket
+		r := e.Rune()
+
+		if e.AfterEndOfLine() {
+			e.Prev(c)
+			r = e.Rune()
+		}
+
+		// Find which opening and closing parenthesis/curly brackets to look for
+		opening, closing := rune(0), rune(0)
+		switch r {
+		case '(', ')':
+			opening = '('
+			closing = ')'
+		case '{', '}':
+			opening = '{'
+			closing = '}'
+		case '[', ']':
+			opening = '['
+			closing = ']'
+		}
+
+		if opening == rune(0) {
+			status.Clear(c)
+			status.SetMessage("No matching (, ), [, ], { or }")
+			status.Show(c, e)
+			break
+		}
+
+		// Search either forwards or backwards to find a matching rune
+		switch r {
+		case '(', '{', '[':
+			parcount := 0
+			for !e.AtOrAfterEndOfDocument() {
+				if r := e.Rune(); r == closing {
+					if parcount == 1 {
+						// FOUND, STOP
+						break
+					} else {
+						parcount--
+					}
+				} else if r == opening {
+					parcount++
+				}
+				e.Next(c)
+			}
+		case ')', '}', ']':
+			parcount := 0
+			for !e.AtStartOfDocument() {
+				if r := e.Rune(); r == opening {
+					if parcount == 1 {
+						// FOUND, STOP
+						break
+					} else {
+						parcount--
+					}
+				} else if r == closing {
+					parcount++
+				}
+				e.Prev(c)
+			}
+		}
+
+		e.redrawCursor = true
+		e.redraw = true
+	case "c:19": // ctrl-s, save (or step, if in debug mode)
+		// Pressing ctrl-s twice writes the file, even if it already has the same contents
+		e.forceSave = ks.kh.PrevIs("c:19")
+		e.UserSave(c, tty, status, undo)
+	case "c:31": // ctrl-_, go to definition
+		// First bookmark the current position
+		ks.bookmark = e.pos.Copy()
+		s := "Bookmarked line " + e.LineNumber().String()
+		status.SetMessage("  " + s + "  ")
+		// TODO: Also bookmark the filename
+		// For Go, ask gopls where the definition is, if it is installed, or else use the tags file from ctags
+		jump := e.JumpToTag
+		if e.mode == mode.Go && which(goplsCommand[0]) != "" {
+			jump = e.GoToDefinition
+		}
+		if err := jump(c, tty, status, fileLock); err != nil {
+			status.ClearAll(c)
+			status.SetError(err)
+			status.Show(c, e)
+		}
+	case "c:21", "c:26": // ctrl-u or ctrl-z (ctrl-z may background the application)
+		// Forget the cut, copy and paste line state
+		ks.ccp.Reset()
+
+		// Try to restore the previous editor state in the undo buffer
+		if err := undo.Undo(e); err == nil {
+			//c.Draw()
+			x := e.pos.ScreenX()
+			y := e.pos.ScreenY()
+			vt100.SetXY(uint(x), uint(y))
+			e.redrawCursor = true
+			e.redraw = true
+		} else {
+			status.SetMessage("Nothing more to undo")
+			status.Show(c, e)
+		}
+	case "c:25": // ctrl-y, redo
+		// Forget the cut, copy and paste line state
+		ks.ccp.Reset()
+
+		// Try to restore the editor state from before the last undo
+		if err := undo.Redo(e); err == nil {
+			x := e.pos.ScreenX()
+			y := e.pos.ScreenY()
+			vt100.SetXY(uint(x), uint(y))
+			e.redrawCursor = true
+			e.redraw = true
+		} else {
+			status.SetMessage("Nothing more to redo")
+			status.Show(c, e)
+		}
+	case "c:12": // ctrl-l, go to line number or percentage
+		status.ClearAll(c)
+		status.SetMessage("Go to line number or percentage:")
+		status.ShowNoTimeout(c, e)
+		lns := ""
+		cancel := false
+		doneCollectingDigits := false
+		goToEnd := false
+		goToTop := false
+		goToCenter := false
+		for !doneCollectingDigits {
+			numkey := readKey(tty)
+			switch numkey {
+			case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "%", ".", ",": // 0..9 + %,.
+				lns += numkey // string('0' + (numkey - 48))
+				status.SetMessage("Go to line number or percentage: " + lns)
+				status.ShowNoTimeout(c, e)
+			case "c:8", "c:127": // ctrl-h or backspace
+				if len(lns) > 0 {
+					lns = lns[:len(lns)-1]
+					status.SetMessage("Go to line number or percentage: " + lns)
+					status.ShowNoTimeout(c, e)
+				}
+			case "b", "t": // top of file
+				doneCollectingDigits = true
+				goToTop = true
+			case "e": // end of file
+				doneCollectingDigits = true
+				goToEnd = true
+			case "c", "m": // center of file
+				doneCollectingDigits = true
+				goToCenter = true
+			case "↑", "↓": // up arrow or down arrow
+				fallthrough // cancel
+			case "c:27", "c:17": // esc or ctrl-q
+				cancel = true
+				lns = ""
+				fallthrough // done
+			case "c:13": // return
+				doneCollectingDigits = true
+			}
+		}
+		if !cancel {
+			e.ClearSearchTerm()
+		}
+		status.ClearAll(c)
+		if goToTop {
+			e.GoToTop(c, status)
+		} else if goToCenter {
+			// Go to the center line
+			e.GoToMiddle(c, status)
+		} else if goToEnd {
+			e.GoToEnd(c, status)
+		} else if lns == "" && !cancel {
+			if e.DataY() > 0 {
+				// If not already at the top, go there
+				e.GoToTop(c, status)
+			} else {
+				// Go to the last line
+				e.GoToEnd(c, status)
+			}
+		} else if strings.HasSuffix(lns, "%") {
+			// Go to the specified percentage
+			if percentageInt, err := strconv.Atoi(lns[:len(lns)-1]); err == nil { // no error {
+				lineIndex := int(math.Round(float64(e.Len()) * float64(percentageInt) * 0.01))
+				e.redraw = e.GoToLineNumber(LineNumber(lineIndex), c, status, true)
+			}
+		} else if strings.Count(lns, ".") == 1 || strings.Count(lns, ",") == 1 {
+			if percentageFloat, err := strconv.ParseFloat(strings.ReplaceAll(lns, ",", "."), 64); err == nil { // no error
+				lineIndex := int(math.Round(float64(e.Len()) * percentageFloat))
+				e.redraw = e.GoToLineNumber(LineNumber(lineIndex), c, status, true)
+			}
+		} else {
+			// Go to the specified line
+			if ln, err := strconv.Atoi(lns); err == nil { // no error
+				e.redraw = e.GoToLineNumber(LineNumber(ln), c, status, true)
+			}
+		}
+		e.redrawCursor = true
+	case "c:24": // ctrl-x, cut line
+		if e.Selecting() {
+			// Cut the selected text
+			if s := e.CopySelection(c, tty, status, "Cut"); s != "" {
+				ks.ccp.SetSelection(s)
+				undo.Snapshot(e)
+				e.DeleteSelection(c)
+				e.redrawCursor = true
+			}
+			e.ClearSelection()
+			break
+		}
+		// Prepare to cut
+		undo.Snapshot(e)
+		// Also close the portal, if any
+		if !blankLine(e.CurrentLine()) {
+			ClosePortal(e)
+		}
+		// Cut the line, or the block of text after it if ctrl-x was pressed twice on this line
+		if s := ks.ccp.Cut(e, ks.bookmark); s != "" {
+			var err error
+			if e.ConfirmClipboardCopy(c, tty, status, s) {
+				// Copy the text to the clipboard, or else only keep it in the internal clipboard
+				err = e.CopyToClipboard(s)
+			}
+			if err == nil || err == errSystemClipboardDisabled {
+				// no issue
+			} else if err == errOSC52Truncated {
+				status.SetError(err)
+				status.Show(c, e)
+			} else if ks.firstCopyAction {
+				if env.Has("WAYLAND_DISPLAY") && which("wl-copy") == "" { // Wayland
+					status.SetErrorMessage("The wl-copy utility (from wl-clipboard) is missing!")
+				} else if env.Has("DISPLAY") && which("xclip") == "" && which("xsel") == "" {
+					status.SetErrorMessage("The xclip or xsel utility is missing!")
+				} else if runtime.GOOS == "darwin" && which("pbcopy") == "" { // pbcopy is missing, on macOS
+					status.SetErrorMessage("The pbcopy utility is missing!")
+				}
+			}
+			// Tell what ctrl-v will paste, when more than one line has been cut
+			if n := len(ks.ccp.entry.lines); n > 1 && err == nil {
+				status.SetMessageAfterRedraw(fmt.Sprintf("Cut %s, %s", lineCount(n), ks.ccp.PasteHint()))
+			}
+		}
+		// Go to the end of the current line
+		e.End(c)
+		e.redrawCursor = true
+		e.redraw = true
+	case "c:11": // ctrl-k, delete to end of line
+		if e.Empty() {
+			status.SetMessage("Empty file")
+			status.Show(c, e)
+			break
+		}
+
+		// Reset the cut/copy/paste double-keypress detection
+		ks.ccp.Reset()
+
+		undo.Snapshot(e)
+
+		e.DeleteRestOfLine()
+		if e.EmptyRightTrimmedLine() {
+			// Deleting the rest of the line cleared this line,
+			// so just remove it.
+			e.DeleteCurrentLineMoveBookmark(ks.bookmark)
+			// Then go to the end of the line, if needed
+			if e.AfterEndOfLine() {
+				e.End(c)
+			}
+		}
+
+		// TODO: Is this one needed/useful?
+		vt100.Do("Erase End of Line")
+
+		e.redraw = true
+		e.redrawCursor = true
+	case "c:3": // ctrl-c, copy the stripped contents of the current line
+
+		// ctrl-c might interrupt the program, but saving at the wrong time might be just as destructive.
+		//e.Save(c, tty)
+
+		if e.Selecting() {
+			// Copy the selected text
+			if s := e.CopySelection(c, tty, status, "Copied"); s != "" {
+				ks.ccp.SetSelection(s)
+			}
+			e.ClearSelection()
+			break
+		}
+
+		// close the portal, if any
+		closedPortal := ClosePortal(e) == nil
+
+		// Copy the trimmed line, or the block of text starting at this line if ctrl-c was pressed twice on this line
+		s := ks.ccp.Copy(e)
+		if s == "" {
+			break
+		}
+		if !ks.ccp.entry.block { // Single line copy
+			status.Clear(c)
+			// Copy the line to the clipboard
+			msg := "Copied 1 line"
+			if !e.ConfirmClipboardCopy(c, tty, status, s) {
+				err = errSecretNotCopied
+			} else {
+				err = e.CopyToClipboard(s)
+			}
+			if err == nil { // OK
+				// The copy operation worked out, using the clipboard
+				msg += " to the clipboard"
+			} else if err == errOSC52Truncated {
+				msg += " to the clipboard, but it was truncated"
+			}
+			// The portal was closed?
+			if closedPortal {
+				msg += " and closed the portal"
+			}
+			status.SetMessage(msg)
+			status.Show(c, e)
+			// Go to the end of the line, for easy line duplication with ctrl-c, enter, ctrl-v,
+			// but only if the copied line is shorter than the terminal width.
+			if uint(len(s)) < c.Width() {
+				e.End(c)
+			}
+		} else { // Multi line copy
+			lines := lineCount(len(ks.ccp.entry.lines))
+			// Place the block of text in the clipboard
+			if !e.ConfirmClipboardCopy(c, tty, status, s) {
+				err = errSecretNotCopied
+			} else {
+				err = e.CopyToClipboard(s)
+			}
+			if err == errOSC52Truncated {
+				status.SetErrorMessage(fmt.Sprintf("Copied %s, but %s", lines, err))
+			} else if err != nil {
+				status.SetMessage(fmt.Sprintf("Copied %s, %s", lines, ks.ccp.PasteHint()))
+			} else {
+				status.SetMessage(fmt.Sprintf("Copied %s (clipboard), %s", lines, ks.ccp.PasteHint()))
+			}
+			status.Show(c, e)
+		}
+	case "c:22": // ctrl-v, paste
+		if portal, err := LoadPortal(); err == nil { // no error
+			var gotLineFromPortal bool
+			line, err := portal.PopLine(e, false) // pop the line, but don't remove it from the source file
+			status.Clear(c)
+			if err != nil {
+				// status.SetErrorMessage("Could not copy text through the portal.")
+				status.SetError(err)
+				ClosePortal(e)
+			} else {
+				status.SetMessage(fmt.Sprintf("Using portal at %s\n", portal))
+				gotLineFromPortal = true
+			}
+			status.Show(c, e)
+
+			if gotLineFromPortal {
+
+				undo.Snapshot(e)
+
+				if e.EmptyRightTrimmedLine() {
+					// If the line is empty, replace with the string from the portal
+					e.SetCurrentLine(line)
+				} else {
+					// If the line is not empty, insert the trimmed string
+					e.InsertStringAndMove(c, strings.TrimSpace(line))
+				}
+
+				e.InsertLineBelow()
+				e.Down(c, nil) // no status message if the end of document is reached, there should always be a new line
+
+				e.redraw = true
+
+				break
+			} // errors with loading a portal are ignored
+		}
+
+		// This may only work for the same user, and not with sudo/su
+
+		// Try fetching the lines from the clipboard first
+		var s string
+
+		var err error
+		s, err = e.PasteFromClipboard(tty)
+		if err == nil && strings.TrimSpace(s) == "" && runtime.GOOS != "darwin" {
+			// Try the primary selection, for other platforms
+			s, err = getOtherClipboardContents()
+		}
+
+		if err == nil { // no error
+
+			// Make the replacements, then use the text, unless it is what was last cut or copied
+			ks.ccp.UseText(e.stringReplacer().Replace(s))
+
+			// Note that control characters are not replaced, they are just not printed.
+		} else if ks.firstPasteAction {
+			missingUtility := false
+
+			status.Clear(c)
+
+			if env.Has("WAYLAND_DISPLAY") && which("wl-paste") == "" { // Wayland + wl-paste not found
+				status.SetErrorMessage("The wl-paste utility (from wl-clipboard) is missing!")
+				missingUtility = true
+			} else if env.Has("DISPLAY") && which("xclip") == "" && which("xsel") == "" { // X + xclip or xsel not found
+				status.SetErrorMessage("The xclip or xsel utility is missing!")
+				missingUtility = true
+			} else if runtime.GOOS == "darwin" && which("pbpaste") == "" { // pbcopy is missing, on macOS
+				status.SetErrorMessage("The pbpaste utility is missing!")
+				missingUtility = true
+			}
+
+			if missingUtility && ks.firstPasteAction {
+				ks.firstPasteAction = false
+				status.Show(c, e)
+				break // Break instead of pasting from the internal buffer, but only the first time
+			}
+		} else {
+			status.Clear(c)
+			e.redrawCursor = true
+		}
+
+		// Now check if there is anything to paste
+		if ks.ccp.entry.Empty() {
+			break
+		}
+
+		// Paste all the lines, or just the first line if split paste is enabled
+		undo.Snapshot(e)
+		pasted, remaining := ks.ccp.Paste(e, c, ks.bookmark, ks.kh.Prev() == "c:13")
+		if remaining > 0 {
+			status.SetMessageAfterRedraw(fmt.Sprintf("Pasted %s, press ctrl-v again to paste the remaining %s", lineCount(pasted), lineCount(remaining)))
+		} else if pasted > 1 {
+			status.SetMessageAfterRedraw("Pasted " + lineCount(pasted))
+		}
+
+		// Prepare to redraw the text
+		e.redrawCursor = true
+		e.redraw = true
+	case "c:18": // ctrl-r, to open or close a portal. In debug mode, continue running the program.
+
+		if e.debugMode {
+			e.DebugContinue()
+			break
+		}
+
+		// Are we in git mode?
+		if line := e.CurrentLine(); e.mode == mode.Git && hasAnyPrefixWord(line, gitRebasePrefixes) {
+			undo.Snapshot(e)
+			newLine := nextGitRebaseKeyword(line)
+			e.SetCurrentLine(newLine)
+			e.redraw = true
+			e.redrawCursor = true
+			break
+		}
+
+		// Deal with the portal
+		status.Clear(c)
+		if HasPortal() {
+			status.SetMessage("Closing portal")
+			ClosePortal(e)
+		} else {
+			portal, err := e.NewPortal()
+			if err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				break
+			}
+			// Portals in the same file is a special case, since lines may move around when pasting
+			if portal.SameFile(e) {
+				e.sameFilePortal = portal
+			}
+			if err := portal.Save(); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				break
+			}
+			status.SetMessage("Opening a portal at " + portal.String())
+		}
+		status.Show(c, e)
+	case "c:2": // ctrl-b, bookmark, unbookmark or jump to bookmark, toggle breakpoint if in debug mode
+		status.Clear(c)
+		if e.debugMode {
+			if e.breakpoint == nil {
+				e.breakpoint = e.pos.Copy()
+				_, err := e.DebugActivateBreakpoint(filepath.Base(e.filename))
+				if err != nil {
+					status.SetError(err)
+					break
+				}
+				s := "Placed breakpoint at line " + e.LineNumber().String()
+				status.SetMessage("  " + s + "  ")
+			} else if e.breakpoint.LineNumber() == e.LineNumber() {
+				// setting a breakpoint at the same line twice: remove the breakpoint
+				s := "Removed breakpoint at line " + e.breakpoint.LineNumber().String()
+				status.SetMessage(s)
+				e.breakpoint = nil
+			} else {
+				undo.Snapshot(e)
+				// Go to the breakpoint position
+				e.GoToPosition(c, status, *e.breakpoint)
+				// TODO: Just use status.SetMessageAfterRedraw instead?
+				// Do the redraw manually before showing the status message
+				e.DrawLines(c, true, false)
+				e.redraw = false
+				// Show the status message
+				s := "Jumped to breakpoint at line " + e.LineNumber().String()
+				status.SetMessage(s)
+			}
+		} else {
+			// Remember the state, in case ctrl-b is followed by a digit, for a named bookmark
+			ks.bookmarkBeforeKey, ks.posBeforeBookmark = ks.bookmark, e.pos
+			if ks.bookmark == nil {
+				// no bookmark, create a bookmark at the current line
+				ks.bookmark = e.pos.Copy()
+				// TODO: Modify the statusbar implementation so that extra spaces are not needed here.
+				s := "Bookmarked line " + e.LineNumber().String()
+				status.SetMessage("  " + s + "  ")
+			} else if ks.bookmark.LineNumber() == e.LineNumber() {
+				// bookmarking the same line twice: remove the bookmark
+				s := "Removed bookmark for line " + ks.bookmark.LineNumber().String()
+				status.SetMessage(s)
+				ks.bookmark = nil
+			} else {
+				undo.Snapshot(e)
+				// Go to the saved bookmark position
+				e.GoToPosition(c, status, *ks.bookmark)
+				// TODO: Just use status.SetMessageAfterRedraw instead?
+				// Do the redraw manually before showing the status message
+				e.DrawLines(c, true, false)
+				e.redraw = false
+				// Show the status message
+				s := "Jumped to bookmark at line " + e.LineNumber().String()
+				status.SetMessage(s)
+			}
+		}
+		status.Show(c, e)
+		e.redrawCursor = true
+	case "c:10": // ctrl-j, join line
+		if e.Selecting() {
+			// Join the selected lines
+			undo.Snapshot(e)
+			r := e.SelectedLines()
+			e.ClearSelection()
+			if e.JoinRange(r, ks.bookmark) {
+				e.GoTo(r.From, c, status)
+				e.EndNoTrim(c)
+			}
+			e.redraw = true
+			e.redrawCursor = true
+		} else if e.Empty() {
+			status.SetMessage("Empty")
+			status.Show(c, e)
+		} else {
+			undo.Snapshot(e)
+
+			nextLineIndex := e.DataY() + 1
+			if e.EmptyRightTrimmedLineBelow() {
+				// Just delete the line below if it's empty
+				e.DeleteLineMoveBookmark(nextLineIndex, ks.bookmark)
+			} else {
+				// Join the line below with this line, the same way as when deleting at the end of the line
+				e.End(c)
+				e.Delete()
+			}
+
+			e.redraw = true
+		}
+		e.redrawCursor = true
+	default: // any other key
+		if strings.HasPrefix(key, macroCommandPrefix) {
+			// a command from the ctrl-o menu, when playing back a macro
+			if err := e.RunCommand(c, tty, status, ks.bookmark, undo, strings.Split(strings.TrimPrefix(key, macroCommandPrefix), " ")...); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		}
+		if key == "v" && ks.kh.AfterLeader() && !e.debugMode {
+			// esc v, start selecting text from the cursor
+			e.StartSelection()
+			status.SetMessage("Selecting (ctrl-c to copy, ctrl-x to cut, ctrl-d to delete, esc to stop)")
+			status.Show(c, e)
+			break
+		}
+		if key == "b" && ks.kh.AfterLeader() && !e.debugMode {
+			// esc b, cycle through the open files
+			if err := e.NextBuffer(c, tty, status, fileLock); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		}
+		if (key == "e" || key == "E") && ks.kh.AfterLeader() && !e.debugMode {
+			// esc e or esc E, jump to the next or previous error from the last build
+			jump := e.NextBuildError
+			if key == "E" {
+				jump = e.PrevBuildError
+			}
+			if err := jump(c, tty, status, fileLock); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		}
+		if key == "k" && ks.kh.AfterLeader() && !e.debugMode {
+			// esc k, show the documentation for the identifier at the cursor
+			if err := e.ShowHover(c, status); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		}
+		if key == "o" && ks.kh.AfterLeader() && !e.debugMode {
+			// esc o, open the file at the cursor, at the line and column after the filename, if any
+			if err := e.OpenPathAtCursor(c, tty, status, fileLock); err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			break
+		}
+		if key == "u" && ks.kh.AfterLeader() && !e.debugMode && !e.readOnly {
+			// esc u, change the case of the word at the cursor, from lowercase to UPPERCASE to Title case
+			undo.Snapshot(e)
+			if _, err := e.CycleWordCase(); err != nil {
+				status.ShowErrorAfterRedraw(err)
+			}
+			break
+		}
+		if key == "j" && ks.kh.AfterLeader() && !e.debugMode && !e.readOnly {
+			// esc j, join the lines of the current block into one line
+			undo.Snapshot(e)
+			r := e.BlockAt(e.DataY())
+			if e.JoinRange(r, ks.bookmark) {
+				e.GoTo(r.From, c, status)
+				e.EndNoTrim(c)
+			} else {
+				status.SetMessageAfterRedraw("Nothing to join")
+			}
+			break
+		}
+		if (key == ">" || key == "<") && ks.kh.AfterLeader() && !e.debugMode && !e.readOnly {
+			// esc > or esc <, indent or dedent the current block, for when shift-tab can not be used
+			undo.Snapshot(e)
+			if !e.IndentRange(e.SelectedLinesOrBlock(), key == "<") {
+				status.SetMessageAfterRedraw("Nothing to indent")
+			}
+			break
+		}
+		if (key == "*" || key == "#") && ks.kh.AfterLeader() && !e.debugMode {
+			// esc * or esc #, search for the word at the cursor and go to the next or previous match
+			forward := key == "*"
+			if wrapped, err := e.SearchWordAtCursor(c, status, forward); err == errNoSearchMatch {
+				status.Clear(c)
+				status.SetMessage(e.searchNotFoundMessage(searchWrap))
+				status.Show(c, e)
+			} else if err != nil {
+				status.Clear(c)
+				status.SetError(err)
+				status.Show(c, e)
+			} else {
+				status.SetMessageAfterRedraw(e.searchMatchMessage(wrapped, forward))
+			}
+			break
+		}
+		if ev, ok := parseMouseKey(key); ok {
+			// A mouse click or scroll wheel event
+			e.HandleMouseEvent(c, status, ev)
+			break
+		}
+		keyRunes := []rune(key)
+		if ks.kh.PrevIs("c:2") && !e.debugMode && len(keyRunes) == 1 && isBookmarkName(keyRunes[0]) {
+			// ctrl-b followed by a digit: use the named bookmark instead of the regular one
+			ks.bookmark = ks.bookmarkBeforeKey
+			if e.pos != ks.posBeforeBookmark {
+				e.GoToPosition(c, status, ks.posBeforeBookmark)
+			}
+			e.ToggleNamedBookmark(c, status, undo, keyRunes[0])
+			break
+		}
+		//panic(fmt.Sprintf("PRESSED KEY: %v", []rune(key)))
+		if e.Overwriting() && !lastKeyPasted && len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) { // overwrite mode, but not when pasting
+			undo.Snapshot(e)
+			for _, r := range keyRunes {
+				e.OverwriteRune(c, r)
+			}
+		} else if len(keyRunes) > 0 && unicode.IsLetter(keyRunes[0]) { // letter
+
+			undo.Snapshot(e)
+
+			if e.mode == mode.Go { // TODO: And e.onlyValidCode
+				if e.Empty() {
+					r := keyRunes[0]
+					// Only "/" or "p" is allowed
+					if r != 'p' && r != '/' {
+						status.Clear(c)
+						status.SetMessage("Not valid Go: " + string(r))
+						status.Show(c, e)
+						break
+					}
+				}
+			}
+
+			// Type in the letters that were pressed
+			for _, r := range keyRunes {
+				// Insert a letter. This is what normally happens.
+				wrapped := e.InsertRune(c, r)
+				if !wrapped && runeWidth(r) > 0 {
+					e.WriteRune(c)
+					e.Next(c)
+				}
+				e.redraw = true
+			}
+		} else if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) { // any other key that can be drawn
+			undo.Snapshot(e)
+			e.redraw = true
+
+			// Place *something*
+			r := keyRunes[0]
+
+			if r == 160 {
+				// This is a nonbreaking space that may be inserted with altgr+space that is HORRIBLE.
+				// Set r to a regular space instead.
+				r = ' '
+			}
+
+			// Close brackets and quotes, or skip over the closing rune, but not when pasting
+			if !lastKeyPasted && e.AutoClose(c, r) {
+				e.redrawCursor = true
+				break
+			}
+
+			// "smart dedent", typing a closing bracket on an empty line dedents it to match the opening bracket
+			if r == '}' || r == ']' || r == ')' {
+				e.DedentClosingBracket(c, r)
+			}
+
+			wrapped := e.InsertRune(c, r)
+			e.WriteRune(c)
+			if !wrapped && runeWidth(r) > 0 {
+				// Move to the next position, unless a combining mark was added to the rune before the cursor
+				e.Next(c)
+			}
+
+			// Dedent "else:", "elif ", "except:" and "finally:" in Python to match the "if" or "try"
+			if r == ':' || r == ' ' {
+				e.DedentPythonClause(c)
+			}
+			e.redrawCursor = true
+		}
+	}
+	if e.addSpace {
+		e.InsertString(c, " ")
+		e.addSpace = false
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyedFile is a small line-based format for state that is remembered between sessions, like the view state
+// per filename or the save policy per mode. The first line is a header with the format version, and each of
+// the following lines is a quoted key followed by fields, like: "/home/user/main.go" ruler wrap=80
+type keyedFile struct {
+	header      string
+	version     int
+	errNoHeader error // returned when the header is missing
+	errVersion  error // returned when the version in the header is not supported
+}
+
+// format returns the given fields per key in the keyed file format, sorted by key
+func (kf keyedFile) format(entries map[string][]string) string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s %d\n", kf.header, kf.version))
+	for _, key := range keys {
+		sb.WriteString(strconv.Quote(key))
+		for _, field := range entries[key] {
+			sb.WriteString(" " + field)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// parse returns the fields per key, from data in the format written by format.
+// Lines that can not be parsed are skipped, but the version in the header must match.
+func (kf keyedFile) parse(data string) (map[string][]string, error) {
+	entries := make(map[string][]string)
+	lines := strings.Split(data, "\n")
+	header := strings.Fields(lines[0])
+	if len(header) == 0 || !strings.HasPrefix(lines[0], kf.header+" ") {
+		return entries, kf.errNoHeader
+	}
+	if version, err := strconv.Atoi(header[len(header)-1]); err != nil || version != kf.version {
+		return entries, kf.errVersion
+	}
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line, "\"") {
+			continue
+		}
+		quotedKey, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			continue
+		}
+		key, err := strconv.Unquote(quotedKey)
+		if err != nil || key == "" {
+			continue
+		}
+		entries[key] = strings.Fields(line[len(quotedKey):])
+	}
+	return entries, nil
+}
+
+// load reads and parses the given file. The returned map can be empty.
+func (kf keyedFile) load(filename string) (map[string][]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return make(map[string][]string), err
+	}
+	return kf.parse(string(data))
+}
+
+// save writes the given fields per key to the given file
+func (kf keyedFile) save(filename string, entries map[string][]string) error {
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	return os.WriteFile(filename, []byte(kf.format(entries)), 0600)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeyedFile(t *testing.T) {
+	errNoHeader := errors.New("no header")
+	errVersion := errors.New("wrong version")
+	kf := keyedFile{header: "o test", version: 2, errNoHeader: errNoHeader, errVersion: errVersion}
+
+	data := kf.format(map[string][]string{"b c": {"x", "y=1"}, "a": nil})
+	if expected := "o test 2\n\"a\"\n\"b c\" x y=1\n"; data != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	// Lines without a quoted key, or with an empty key, are skipped
+	entries, err := kf.parse(data + "garbage\n\"\" x\n\"unterminated x\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(entries["a"]) != 0 || len(entries["b c"]) != 2 || entries["b c"][1] != "y=1" {
+		t.Errorf("unexpected entries: %q", entries)
+	}
+
+	if _, err := kf.parse("o test 3\n"); err != errVersion {
+		t.Errorf("expected a version error, got %v", err)
+	}
+	if _, err := kf.parse("o other 2\n"); err != errNoHeader {
+		t.Errorf("expected a header error, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+// keyLoopPollInterval is how long the key loop waits for a key before it handles events from other goroutines.
+// The terminal counts read timeouts in tenths of a second, so this is the shortest interval there is.
+const keyLoopPollInterval = 100 * time.Millisecond
+
+// keyLoopEvents are functions that are run by the key loop while it waits for the next key. Goroutines that
+// want to draw or change the editor, like the file watchers and the control socket, send functions here instead of
+// doing so themselves. Since the events are only run between keypresses, they are never drawn over menus.
+var keyLoopEvents = make(chan func(), 64)
+
+// runInKeyLoop sends f to the key loop, without waiting for it to be run.
+// It returns false if too many events are already waiting, in which case f is dropped.
+func runInKeyLoop(f func()) bool {
+	select {
+	case keyLoopEvents <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// readKeyRunningEvents reads the next key, while running the events from other goroutines, like the commands
+// from the control socket, as they arrive
+func readKeyRunningEvents(tty *vt100.TTY) string {
+	for {
+		runKeyLoopEvents()
+		if key, ok := readKeyWithTimeout(tty, keyLoopPollInterval); ok {
+			return key
+		}
+	}
+}
+
+// runKeyLoopEvents runs the events that are currently waiting, in the order they were sent
+func runKeyLoopEvents() {
+	for {
+		select {
+		case f := <-keyLoopEvents:
+			f()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestKeyLoopEvents(t *testing.T) {
+	defer func(events chan func()) { keyLoopEvents = events }(keyLoopEvents)
+	keyLoopEvents = make(chan func(), 2)
+
+	// Events are run in order, and are dropped when the queue is full
+	var order []int
+	for i := 1; i <= 3; i++ {
+		i := i
+		if sent := runInKeyLoop(func() { order = append(order, i) }); sent != (i <= 2) {
+			t.Errorf("expected event %d to be sent: %v", i, i <= 2)
+		}
+	}
+	runKeyLoopEvents()
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("expected the first two events to be run in order, got %v", order)
+	}
+	runKeyLoopEvents()
+	if len(order) != 2 {
+		t.Errorf("expected no more events to be run, got %v", order)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// Key strings for keys that are not decoded by vt100.TTY.String()
+const (
+	keyHome       = "⇱"   // Home
+	keyEnd        = "⇲"   // End
+	keyCtrlHome   = "c:⇱" // ctrl-Home
+	keyCtrlEnd    = "c:⇲" // ctrl-End
+	keyInsert     = "⎀"   // Insert
+	keyShiftUp    = "s:↑" // shift-arrow up
+	keyShiftDown  = "s:↓" // shift-arrow down
+	keyShiftRight = "s:→" // shift-arrow right
+	keyShiftLeft  = "s:←" // shift-arrow left
+
+	keyCtrlLeft     = "c:←" // ctrl-arrow left
+	keyCtrlRight    = "c:→" // ctrl-arrow right
+	keyAltLeft      = "a:←" // alt-arrow left
+	keyAltRight     = "a:→" // alt-arrow right
+	keyAltUp        = "a:↑" // alt-arrow up
+	keyAltDown      = "a:↓" // alt-arrow down
+	keyAltBackspace = "a:⌫" // alt-backspace
+	keyShiftTab     = "s:⇥" // shift-tab
+)
+
+// escapeSequenceKeys maps terminal escape sequences to the same key strings as returned by vt100.TTY.String(),
+// plus the key strings above. The sequences are from xterm (both normal and application cursor mode),
+// tmux/screen, rxvt and the Linux console.
+var escapeSequenceKeys = map[string]string{
+	// Arrow keys
+	"\x1b[A": "↑",
+	"\x1b[B": "↓",
+	"\x1b[C": "→",
+	"\x1b[D": "←",
+	"\x1bOA": "↑",
+	"\x1bOB": "↓",
+	"\x1bOC": "→",
+	"\x1bOD": "←",
+
+	// shift-arrow keys
+	"\x1b[1;2A": keyShiftUp,    // xterm and tmux
+	"\x1b[1;2B": keyShiftDown,  // xterm and tmux
+	"\x1b[1;2C": keyShiftRight, // xterm and tmux
+	"\x1b[1;2D": keyShiftLeft,  // xterm and tmux
+	"\x1b[a":    keyShiftUp,    // rxvt
+	"\x1b[b":    keyShiftDown,  // rxvt
+	"\x1b[c":    keyShiftRight, // rxvt
+	"\x1b[d":    keyShiftLeft,  // rxvt
+
+	// ctrl-arrow and alt-arrow keys, for moving by word
+	"\x1b[1;5C":  keyCtrlRight, // xterm and tmux
+	"\x1b[1;5D":  keyCtrlLeft,  // xterm and tmux
+	"\x1b[1;3C":  keyAltRight,  // xterm and tmux
+	"\x1b[1;3D":  keyAltLeft,   // xterm and tmux
+	"\x1bOc":     keyCtrlRight, // rxvt
+	"\x1bOd":     keyCtrlLeft,  // rxvt
+	"\x1b\x1b[C": keyAltRight,  // rxvt
+	"\x1b\x1b[D": keyAltLeft,   // rxvt
+
+	// alt-arrow up and down, for moving lines
+	"\x1b[1;3A":  keyAltUp,   // xterm and tmux
+	"\x1b[1;3B":  keyAltDown, // xterm and tmux
+	"\x1b\x1b[A": keyAltUp,   // rxvt
+	"\x1b\x1b[B": keyAltDown, // rxvt
+
+	// alt-backspace
+	"\x1b\x7f": keyAltBackspace,
+
+	// shift-tab
+	"\x1b[Z": keyShiftTab, // xterm, tmux, screen, rxvt and the Linux console
+
+	// Insert
+	"\x1b[2~": keyInsert, // xterm, tmux, screen, rxvt and the Linux console
+
+	// Home
+	"\x1b[H":  keyHome, // xterm
+	"\x1bOH":  keyHome, // xterm, application cursor mode
+	"\x1b[1~": keyHome, // tmux, screen and the Linux console
+	"\x1b[7~": keyHome, // rxvt
+
+	// End
+	"\x1b[F":  keyEnd, // xterm
+	"\x1bOF":  keyEnd, // xterm, application cursor mode
+	"\x1b[4~": keyEnd, // tmux, screen and the Linux console
+	"\x1b[8~": keyEnd, // rxvt
+
+	// ctrl-Home
+	"\x1b[1;5H": keyCtrlHome, // xterm and tmux
+	"\x1b[1;5~": keyCtrlHome, // tmux and screen, with modifier encoding
+	"\x1b[7^":   keyCtrlHome, // rxvt
+
+	// ctrl-End
+	"\x1b[1;5F": keyCtrlEnd, // xterm and tmux
+	"\x1b[4;5~": keyCtrlEnd, // tmux and screen, with modifier encoding
+	"\x1b[8^":   keyCtrlEnd, // rxvt
+}
+
+// The length of the longest escape sequence in escapeSequenceKeys
+const maxEscapeSequenceLength = 6
+
+// pendingKeyBytes are bytes that have been read from the TTY, but not yet decoded
+var pendingKeyBytes []byte
+
+// keyToReadAgain is a key that has been put back with unreadKey, and that is returned by the next call to readKey
+var keyToReadAgain string
+
+// unreadKey puts the given key back, so that it is returned by the next call to readKey.
+// This is for popups that are closed by a key that should then be handled by the key loop.
+func unreadKey(key string) {
+	keyToReadAgain = key
+}
+
+// lastKeyPasted is true if the last key arrived together with many other keys, which happens when text is pasted into the terminal
+var lastKeyPasted bool
+
+// pendingKeysPasted is true if the bytes in pendingKeyBytes arrived all at once, as a paste
+var pendingKeysPasted bool
+
+// minPasteLength is how many bytes must arrive at once for the keys to count as pasted. This is more than what
+// arrives when typing fast, and a single escape sequence, like for the arrow keys or the mouse, is never a paste.
+const minPasteLength = 8
+
+// isPaste checks if the given bytes, that arrived all at once, look like pasted text rather than typed keys
+func isPaste(data []byte) bool {
+	_, n := decodeKey(data)
+	return len(data) >= minPasteLength && n < len(data)
+}
+
+// decodeKey decodes the first key in the given bytes, and returns a key string together with
+// the number of bytes that were used. The key strings are the same as the ones returned by
+// vt100.TTY.String(), like "c:1" for ctrl-a or "↑" for arrow up, with the addition of
+// the Home and End keys and mouse events. An empty string is returned for unrecognized escape sequences.
+func decodeKey(bs []byte) (string, int) {
+	if len(bs) == 0 {
+		return "", 0
+	}
+	if bs[0] == 27 && len(bs) > 1 {
+		if key, n, ok := decodeMouseKey(bs); ok {
+			return key, n
+		}
+		// Try the longest escape sequences first
+		for l := maxEscapeSequenceLength; l >= 2; l-- {
+			if l > len(bs) {
+				continue
+			}
+			if key, ok := escapeSequenceKeys[string(bs[:l])]; ok {
+				return key, l
+			}
+		}
+		if bs[1] == '[' || bs[1] == 'O' {
+			// Skip an unrecognized control sequence, until and including the final byte
+			for i := 2; i < len(bs); i++ {
+				if bs[i] >= 0x40 && bs[i] <= 0x7e {
+					return "", i + 1
+				}
+			}
+			return "", len(bs)
+		}
+		// Esc followed by something else
+		return "c:27", 1
+	}
+	r, size := utf8.DecodeRune(bs)
+	if r == utf8.RuneError && size <= 1 {
+		return "", 1
+	}
+	if size == 1 && !unicode.IsPrint(r) {
+		return "c:" + strconv.Itoa(int(r)), 1
+	}
+	return string(r), size
+}
+
+// readKey reads and decodes the next key from the TTY. It works like vt100.TTY.String(),
+// but also handles escape sequences that are longer than three bytes, like the ones for Home and End.
+func readKey(tty *vt100.TTY) string {
+	key, _ := readKeyWithTimeout(tty, 0)
+	return key
+}
+
+// readKeyWithTimeout works like readKey, but gives up if no key has been pressed within the given duration,
+// which the terminal rounds to tenths of a second. A duration of 0 waits for as long as it takes.
+// The returned bool is false if no key could be read.
+func readKeyWithTimeout(tty *vt100.TTY, timeout time.Duration) (string, bool) {
+	if key := keyToReadAgain; key != "" {
+		// lastKeyPasted is kept as it was when the key was first read
+		keyToReadAgain = ""
+		return key, true
+	}
+	if len(pendingKeyBytes) == 0 {
+		data, err := readAvailableBytes(tty, timeout)
+		if err != nil {
+			return "", false
+		}
+		pendingKeyBytes = skipLateOSC52Response(data)
+		if len(pendingKeyBytes) == 0 {
+			// Only a part of a late clipboard response from the terminal emulator was read
+			return "", true
+		}
+		pendingKeysPasted = isPaste(pendingKeyBytes)
+	}
+	key, n := decodeKey(pendingKeyBytes)
+	pendingKeyBytes = pendingKeyBytes[n:]
+	lastKeyPasted = pendingKeysPasted
+	if len(pendingKeyBytes) == 0 {
+		pendingKeysPasted = false
+	}
+	return key, true
+}
+
+// readAvailableBytes waits for at least one byte from the TTY, for up to the given duration, and then keeps
+// reading until no input is left, so that nothing is lost when a large amount of text is pasted.
+// A duration of 0 waits for as long as it takes.
+func readAvailableBytes(tty *vt100.TTY, timeout time.Duration) ([]byte, error) {
+	buf := make([]byte, 32)
+	tty.RawMode()
+	defer tty.Restore()
+	tty.SetTimeout(timeout)
+	numRead, err := tty.Term().Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	data := buf[:numRead]
+	for {
+		available, err := tty.Term().Available()
+		if err != nil || available <= 0 {
+			break
+		}
+		buf = make([]byte, available)
+		numRead, err = tty.Term().Read(buf)
+		if err != nil || numRead == 0 {
+			break
+		}
+		data = append(data, buf[:numRead]...)
+	}
+	return data, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodeKey(t *testing.T) {
+	cases := []struct {
+		terminal string
+		input    string
+		key      string
+		n        int
+	}{
+		{"xterm", "\x1b[H", keyHome, 3},
+		{"xterm", "\x1b[F", keyEnd, 3},
+		{"xterm", "\x1bOH", keyHome, 3},
+		{"xterm", "\x1bOF", keyEnd, 3},
+		{"xterm", "\x1b[1;5H", keyCtrlHome, 6},
+		{"xterm", "\x1b[1;5F", keyCtrlEnd, 6},
+		{"xterm", "\x1b[A", "↑", 3},
+		{"xterm", "\x1bOD", "←", 3},
+		{"tmux", "\x1b[1~", keyHome, 4},
+		{"tmux", "\x1b[4~", keyEnd, 4},
+		{"tmux", "\x1b[1;5~", keyCtrlHome, 6},
+		{"tmux", "\x1b[4;5~", keyCtrlEnd, 6},
+		{"linux", "\x1b[1~", keyHome, 4},
+		{"linux", "\x1b[4~", keyEnd, 4},
+		{"rxvt", "\x1b[7~", keyHome, 4},
+		{"xterm", "\x1b[2~", keyInsert, 4},
+		{"rxvt", "\x1b[8^", keyCtrlEnd, 4},
+		{"xterm", "\x1b[1;2A", keyShiftUp, 6},
+		{"rxvt", "\x1b[d", keyShiftLeft, 3},
+		{"xterm", "\x1b[1;5D", keyCtrlLeft, 6},
+		{"xterm", "\x1b[1;3C", keyAltRight, 6},
+		{"rxvt", "\x1bOd", keyCtrlLeft, 3},
+		{"rxvt", "\x1b\x1b[D", keyAltLeft, 4},
+		{"any", "\x1b\x7f", keyAltBackspace, 2},
+		{"any", "\x1b[Z", keyShiftTab, 3},
+		{"any", "\x1b[5~", "", 4},   // page up is not decoded
+		{"any", "\x1b[15~", "", 5},  // F5 is not decoded
+		{"any", "\x1b", "c:27", 1},  // esc
+		{"any", "\x1bx", "c:27", 1}, // alt-x
+		{"any", "\x01", "c:1", 1},
+		{"any", "\x7f", "c:127", 1},
+		{"any", "a", "a", 1},
+		{"any", "æ", "æ", 2},
+		{"any", "\x1b[4~x", keyEnd, 4}, // End followed by a letter
+		{"any", "ab", "a", 1},
+		{"xterm", "\x1b[<0;13;4M", "m:0:12:3", 10}, // left click, SGR
+		{"xterm", "\x1b[<0;13;4mx", "", 10},        // button release, SGR
+		{"xterm", "\x1b[<65;1;1M", "m:65:0:0", 10}, // scroll wheel down, SGR
+		{"xterm", "\x1b[M -$", "m:0:12:3", 6},      // left click, X10
+		{"xterm", "\x1b[M#-$", "", 6},              // button release, X10
+	}
+	for _, c := range cases {
+		key, n := decodeKey([]byte(c.input))
+		if key != c.key || n != c.n {
+			t.Errorf("%s: %q should decode to %q (%d bytes), got %q (%d bytes)", c.terminal, c.input, c.key, c.n, key, n)
+		}
+	}
+}
+
+func TestIsPaste(t *testing.T) {
+	cases := []struct {
+		input string
+		paste bool
+	}{
+		{"a", false},
+		{"ab", false},                // typing fast
+		{"\x1b[1;5D", false},         // a single escape sequence
+		{"\x1b[<0;130;45M", false},   // a single mouse event
+		{"hello world", true},        // pasted text
+		{"\tfunc main() {\n", true},  // pasted code
+		{"\x1b[A\x1b[A\x1b[A", true}, // several keys at once
+	}
+	for _, c := range cases {
+		if paste := isPaste([]byte(c.input)); paste != c.paste {
+			t.Errorf("expected isPaste(%q) to be %v", c.input, c.paste)
+		}
+	}
+}
+
+func TestReadKeyPendingPaste(t *testing.T) {
+	defer func(pending []byte, pasted bool) {
+		pendingKeyBytes, pendingKeysPasted, lastKeyPasted = pending, pasted, false
+	}(pendingKeyBytes, pendingKeysPasted)
+	pendingKeyBytes, pendingKeysPasted = []byte("ab"), true
+	for _, expected := range []string{"a", "b"} {
+		if key := readKey(nil); key != expected || !lastKeyPasted {
+			t.Errorf("expected %q to be read as pasted, got %q and %v", expected, key, lastKeyPasted)
+		}
+	}
+	if pendingKeysPasted {
+		t.Error("expected the paste to be over when all the pending keys have been read")
+	}
+	// Keys that are queued while the spinner is shown are typed, not pasted
+	handleSpinnerKeys([]byte("xy"))
+	if key := readKey(nil); key != "x" || lastKeyPasted {
+		t.Errorf("expected x to be read as typed, got %q and %v", key, lastKeyPasted)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"unicode"
+)
+
+// repeatChangeKey repeats the last change when pressed after esc, like esc . or alt-.
+const repeatChangeKey = "."
+
+// changeKeys are the keys that each make a self-contained change, like deleting or pasting a line
+var changeKeys = []string{
+	"c:4",  // ctrl-d, delete
+	"c:10", // ctrl-j, join lines
+	"c:11", // ctrl-k, delete to the end of the line
+	"c:22", // ctrl-v, paste
+	"c:24", // ctrl-x, cut line
+	"c:28", // ctrl-\, toggle comment
+	keyAltBackspace,
+	keyAltUp,    // move the line up
+	keyAltDown,  // move the line down
+	keyShiftTab, // dedent the block
+}
+
+// ChangeRecorder records the keys of the most recent change, like a word that was typed or a line that was cut,
+// as a small macro that is kept until the next change, so that the change can be repeated at another position.
+// Moving the cursor ends the change that is being recorded, but does not forget the last change.
+type ChangeRecorder struct {
+	current   *Macro   // the change that is being recorded, if any
+	last      *Macro   // the last complete change, if any
+	typing    bool     // true if the change that is being recorded is text that is being typed
+	replay    []string // keys that are left to replay
+	replayLen int      // the number of keys in one repetition of the change that is being replayed
+}
+
+// isTypingKey checks if the given key inserts text when typed
+func isTypingKey(key string) bool {
+	switch key {
+	case "↑", "↓", "←", "→", keyHome, keyEnd, keyInsert:
+		return false
+	case "c:9", "c:13": // tab or return
+		return true
+	}
+	runes := []rune(key)
+	return len(runes) == 1 && unicode.IsPrint(runes[0])
+}
+
+// Record records the given key, which was pressed by the user, as part of the current change,
+// as the start of a new change or as the end of the current change
+func (cr *ChangeRecorder) Record(key string) {
+	switch {
+	case isTypingKey(key) && cr.typing:
+		cr.current.Add(key)
+	case isTypingKey(key):
+		cr.start(key)
+		cr.typing = true
+	case (key == "c:8" || key == "c:127") && cr.typing:
+		// Backspace corrects the text that is being typed
+		cr.current.Add(key)
+	case key == "c:8" || key == "c:127" || hasS(changeKeys, key):
+		cr.start(key)
+		cr.finish()
+	default:
+		// Cursor movements and other keys end the current change
+		cr.finish()
+	}
+}
+
+// start starts recording a new change, with the given key
+func (cr *ChangeRecorder) start(key string) {
+	cr.finish()
+	cr.current = NewMacro()
+	cr.current.Add(key)
+}
+
+// finish ends the change that is being recorded, if any, which then becomes the last change
+func (cr *ChangeRecorder) finish() {
+	if cr.current != nil && cr.current.Len() > 0 {
+		cr.last = cr.current
+	}
+	cr.current = nil
+	cr.typing = false
+}
+
+// Last returns the keys of the last change, including a change that is still being recorded
+func (cr *ChangeRecorder) Last() []string {
+	if cr.current != nil && cr.current.Len() > 0 {
+		return cr.current.KeyPresses
+	}
+	if cr.last == nil {
+		return nil
+	}
+	return cr.last.KeyPresses
+}
+
+// Replay prepares the keys of the last change to be replayed count times, by Next.
+// Returns false if there is no change to repeat.
+func (cr *ChangeRecorder) Replay(count int) bool {
+	cr.finish()
+	keys := cr.Last()
+	if len(keys) == 0 {
+		return false
+	}
+	cr.replay = nil
+	cr.replayLen = len(keys)
+	for i := 0; i < count; i++ {
+		cr.replay = append(cr.replay, keys...)
+	}
+	return true
+}
+
+// Replaying checks if there are keys left to replay
+func (cr *ChangeRecorder) Replaying() bool {
+	return len(cr.replay) > 0
+}
+
+// AtRepetitionStart checks if the next key to replay starts a new repetition of the change,
+// so that each repetition can be undone on its own
+func (cr *ChangeRecorder) AtRepetitionStart() bool {
+	return len(cr.replay) > 0 && len(cr.replay)%cr.replayLen == 0
+}
+
+// Next returns the next key to replay, if any
+func (cr *ChangeRecorder) Next() (string, bool) {
+	if len(cr.replay) == 0 {
+		return "", false
+	}
+	key := cr.replay[0]
+	cr.replay = cr.replay[1:]
+	return key, true
+}
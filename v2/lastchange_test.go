@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestChangeRecorder(t *testing.T) {
+	var cr ChangeRecorder
+	if cr.Replay(1) {
+		t.Fatal("expected nothing to repeat")
+	}
+
+	// Typing, with a correction, is one change
+	for _, key := range []string{"f", "o", "x", "c:127", "o", " "} {
+		cr.Record(key)
+	}
+	if last := strings.Join(cr.Last(), ","); last != "f,o,x,c:127,o, " {
+		t.Fatalf("unexpected change: %s", last)
+	}
+
+	// Moving the cursor does not forget the last change
+	cr.Record("↓")
+	cr.Record("c:1")
+	if last := strings.Join(cr.Last(), ","); last != "f,o,x,c:127,o, " {
+		t.Fatalf("unexpected change after moving: %s", last)
+	}
+
+	// But moving ends it, so that typing starts a new change
+	cr.Record("a")
+	cr.Record("→")
+	cr.Record("b")
+	if last := strings.Join(cr.Last(), ","); last != "b" {
+		t.Fatalf("expected a new change, got %s", last)
+	}
+
+	// Deleting is a change of its own, and backspace only corrects typed text
+	cr.Record("c:11")
+	cr.Record("c:127")
+	if last := strings.Join(cr.Last(), ","); last != "c:127" {
+		t.Fatalf("expected backspace to be a change of its own, got %s", last)
+	}
+
+	// Replaying with a count
+	cr.Record("c:11")
+	if !cr.Replay(3) {
+		t.Fatal("expected a change to repeat")
+	}
+	var replayed []string
+	starts := 0
+	for {
+		if cr.AtRepetitionStart() {
+			starts++
+		}
+		key, ok := cr.Next()
+		if !ok {
+			break
+		}
+		replayed = append(replayed, key)
+	}
+	if starts != 3 {
+		t.Errorf("expected each repetition to start an undo step, got %d starts", starts)
+	}
+	if s := strings.Join(replayed, ","); s != "c:11,c:11,c:11" {
+		t.Errorf("unexpected replayed keys: %s", s)
+	}
+}
+
+func TestReplayChangeAtNewPosition(t *testing.T) {
+	defer func(u *Undo) { undo = u }(undo)
+	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
+	discardStdout(t)
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "one\ntwo\nthree")
+	c := vt100.NewCanvas()
+	status := testStatusBar(e)
+	ks := newKeyLoopState(false)
+
+	// The keys are handled by the same function as in the key loop
+	var cr ChangeRecorder
+	press := func(keys ...string) {
+		for _, key := range keys {
+			e.handleKey(c, nil, status, ks, key)
+		}
+	}
+	replay := func() {
+		for {
+			key, ok := cr.Next()
+			if !ok {
+				break
+			}
+			press(key)
+		}
+	}
+	e.GoTo(0, c, status)
+	e.Home()
+	for _, key := range []string{"-", " "} {
+		cr.Record(key)
+		press(key)
+	}
+
+	// Move to the next line and repeat the typed text there
+	cr.Record("↓")
+	e.GoTo(1, c, status)
+	e.Home()
+	if !cr.Replay(1) {
+		t.Fatal("expected a change to repeat")
+	}
+	replay()
+	if s := e.String(); s != "- one\n- two\nthree\n" {
+		t.Errorf("unexpected contents after repeating typed text: %q", s)
+	}
+
+	// Delete the rest of the first line after the dash, then repeat that on the next lines
+	e.GoTo(0, c, status)
+	e.Home()
+	e.Next(c)
+	cr.Record("c:11")
+	press("c:11")
+	e.GoTo(1, c, status)
+	e.Home()
+	e.Next(c)
+	cr.Replay(1)
+	replay()
+	if s := e.String(); s != "-\n-\nthree\n" {
+		t.Errorf("unexpected contents after repeating a deletion: %q", s)
+	}
+
+	// Deleting a rune, repeated twice
+	e.GoTo(2, c, status)
+	e.Home()
+	cr.Record("c:4")
+	press("c:4")
+	cr.Replay(2)
+	replay()
+	if s := e.String(); s != "-\n-\nee\n" {
+		t.Errorf("unexpected contents after repeating a deletion twice: %q", s)
+	}
+}
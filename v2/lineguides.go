@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+// colorColumnRune is drawn at the word wrap column, on the lines that are shorter than it
+const colorColumnRune = '│'
+
+var (
+	// highlightCurrentLine is true if the background of the line with the cursor should be drawn in a different color.
+	// It is kept when switching between files.
+	highlightCurrentLine bool
+
+	// showColorColumn is true if a vertical guide should be drawn at the word wrap column.
+	// It is kept when switching between files.
+	showColorColumn bool
+)
+
+// lineBackground returns the background color for the given line, which is different for the line with the cursor
+// if highlightCurrentLine is enabled and colors are allowed
+func (e *Editor) lineBackground(y LineIndex) vt100.AttributeColor {
+	if highlightCurrentLine && !envNoColor && y == e.DataY() {
+		return e.CurrentLineBackground
+	}
+	return e.Background
+}
+
+// colorColumn returns the screen column of the word wrap guide, relative to the start of the lines,
+// or false if the guide is not shown or is scrolled out of view
+func (e *Editor) colorColumn() (uint, bool) {
+	if !showColorColumn || e.wrapWidth <= 0 || e.wrapWidth < e.pos.offsetX {
+		return 0, false
+	}
+	return uint(e.wrapWidth - e.pos.offsetX), true
+}
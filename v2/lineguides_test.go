@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestColorColumn(t *testing.T) {
+	t.Cleanup(func() { showColorColumn = false })
+	e := NewSimpleEditor(10)
+	e.LoadBytes([]byte("short\n" + strings.Repeat("x", 20) + "\n"))
+	c := vt100.NewCanvas()
+	showColorColumn = true
+	e.WriteLines(c, 0, 3, 0, 0)
+	if got := []rune(canvasLine(c, 0)); len(got) <= 10 || got[10] != colorColumnRune {
+		t.Errorf("expected the guide at column 10 on a short line, got %q", string(got))
+	}
+	if got := []rune(canvasLine(c, 1)); len(got) <= 10 || got[10] != 'x' {
+		t.Errorf("expected no guide on a line that is longer than the column, got %q", string(got))
+	}
+	// The guide follows the horizontal scrolling
+	e.pos.offsetX = 4
+	if col, ok := e.colorColumn(); !ok || col != 6 {
+		t.Errorf("expected the guide at screen column 6, got %d (%v)", col, ok)
+	}
+	showColorColumn = false
+	if _, ok := e.colorColumn(); ok {
+		t.Error("expected no guide when it is disabled")
+	}
+}
+
+func TestLineBackground(t *testing.T) {
+	t.Cleanup(func() { highlightCurrentLine = false })
+	e := NewSimpleEditor(80)
+	e.SetTheme(NewDefaultTheme())
+	e.LoadBytes([]byte("a\nb\n"))
+	e.pos.sy = 1
+	if got := e.lineBackground(1); got.String() != e.Background.String() {
+		t.Error("expected the regular background when the current line is not highlighted")
+	}
+	highlightCurrentLine = true
+	if got := e.lineBackground(1); !envNoColor && got.String() != e.CurrentLineBackground.String() {
+		t.Error("expected the current line background for the line with the cursor")
+	}
+	if got := e.lineBackground(0); got.String() != e.Background.String() {
+		t.Error("expected the regular background for the other lines")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// Range is a range of whole lines, from and including From, to and including To.
+// A range where To is before From is empty, but still has a position, at From.
+type Range struct {
+	From LineIndex
+	To   LineIndex
+}
+
+// Lines returns the range of lines from a to b, where a and b can be given in any order
+func Lines(a, b LineIndex) Range {
+	if b < a {
+		a, b = b, a
+	}
+	return Range{a, b}
+}
+
+// emptyRangeAt returns an empty range at the given line index, for inserting lines there
+func emptyRangeAt(y LineIndex) Range {
+	return Range{y, y - 1}
+}
+
+// Len returns the number of lines in the range
+func (r Range) Len() int {
+	if r.To < r.From {
+		return 0
+	}
+	return int(r.To-r.From) + 1
+}
+
+// Empty checks if the range has no lines
+func (r Range) Empty() bool {
+	return r.To < r.From
+}
+
+// Contains checks if the given line index is within the range
+func (r Range) Contains(y LineIndex) bool {
+	return y >= r.From && y <= r.To
+}
+
+// BlockAt returns the range of the block of text that starts at the given line index.
+// For prose, the block ends before the next blank line or at the end of the document.
+// For code, the block also continues past blank lines while a curly brace is still open,
+// or while the lines are indented deeper than the first line, depending on the language.
+// The range is empty if the line at the given index is blank.
+func (e *Editor) BlockAt(y LineIndex) Range {
+	if y < 0 || int(y) >= e.Len() || blankLine(e.Line(y)) {
+		return emptyRangeAt(y)
+	}
+	switch {
+	case braceLanguage(e.mode):
+		return Range{y, braceBlockEnd(e, y)}
+	case indentationLanguage(e.mode):
+		return Range{y, indentBlockEnd(e, y, e.indentation)}
+	}
+	return Range{y, paragraphEnd(e, y)}
+}
+
+// WholeFile returns the range of all the lines in the document
+func (e *Editor) WholeFile() Range {
+	return Range{0, LineIndex(e.Len() - 1)}
+}
+
+// RangeLines returns the lines in the given range
+func (e *Editor) RangeLines(r Range) []string {
+	lines := make([]string, 0, r.Len())
+	for y := r.From; y <= r.To; y++ {
+		lines = append(lines, e.Line(y))
+	}
+	return lines
+}
+
+// RangeString returns the lines in the given range, where each line is followed by a newline
+func (e *Editor) RangeString(r Range) string {
+	var sb strings.Builder
+	for _, line := range e.RangeLines(r) {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// ReplaceRange replaces the lines in the given range with the given lines.
+// The bookmark is moved if lines are inserted or deleted above it.
+func (e *Editor) ReplaceRange(r Range, lines []string, bookmark *Position) {
+	// Delete the lines that are not needed, from the end of the range
+	for r.Len() > len(lines) {
+		e.DeleteLineMoveBookmark(r.To, bookmark)
+		r.To--
+	}
+	// Insert empty lines at the end of the range, if more lines are needed
+	if extra := len(lines) - r.Len(); extra > 0 {
+		at := r.To + 1
+		for i := 0; i < extra; i++ {
+			if e.sameFilePortal != nil {
+				e.sameFilePortal.NewLineInserted(at)
+			}
+			e.bookmarks.LineInserted(at)
+			if bookmark != nil && bookmark.LineIndex() >= at {
+				bookmark.sy++
+			}
+		}
+		e.insertLinesAt(int(at), extra)
+	}
+	for i, line := range lines {
+		e.SetLine(r.From+LineIndex(i), line)
+	}
+	e.changed = true
+}
+
+// DeleteRange deletes the lines in the given range
+func (e *Editor) DeleteRange(r Range, bookmark *Position) {
+	e.ReplaceRange(r, nil, bookmark)
+}
+
+// InsertLines inserts the given lines at the given line index, above the line that is there
+func (e *Editor) InsertLines(y LineIndex, lines []string, bookmark *Position) {
+	e.ReplaceRange(emptyRangeAt(y), lines, bookmark)
+}
+
+// SortRange sorts the lines in the given range, according to the given sort options.
+// If duplicate lines are removed, the lines after the range and the bookmark are moved up.
+func (e *Editor) SortRange(r Range, opts SortOptions, bookmark *Position) {
+	e.ReplaceRange(r, sortLines(e.RangeLines(r), opts), bookmark)
+}
+
+// JoinRange joins the lines in the given range into one line, the same way as ctrl-j joins two lines.
+// Returns false if there are less than two lines in the range.
+func (e *Editor) JoinRange(r Range, bookmark *Position) bool {
+	if r.Len() < 2 {
+		return false
+	}
+	joined := e.Line(r.From)
+	for y := r.From + 1; y <= r.To; y++ {
+		joined = e.joinLine(joined, e.Line(y))
+	}
+	e.ReplaceRange(r, []string{joined}, bookmark)
+	return true
+}
+
+// SelectedLinesOrBlock returns the selected lines, or the block at the cursor if there is no selection
+func (e *Editor) SelectedLinesOrBlock() Range {
+	if e.Selecting() {
+		return e.SelectedLines()
+	}
+	return e.BlockAt(e.DataY())
+}
+
+// dedentLength returns the number of bytes of leading whitespace that one dedent removes from the given line,
+// which is a tab or up to one indentation of spaces
+func dedentLength(line string, indentation mode.TabsSpaces) int {
+	if strings.HasPrefix(line, "\t") {
+		return 1
+	}
+	n := 0
+	for n < len(line) && n < indentation.PerTab && line[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// IndentRange indents the non-blank lines in the given range by one indentation, or dedents them if dedent is true.
+// Dedenting only removes leading whitespace, so lines that are not indented are left as they are.
+// The cursor and the selection anchor follow the text on their lines. Returns false if no lines were changed.
+func (e *Editor) IndentRange(r Range, dedent bool) bool {
+	oneIndentation := e.indentation.String()
+	cursorY := e.DataY()
+	changed := false
+	for y := r.From; y <= r.To; y++ {
+		line := e.Line(y)
+		if blankLine(line) {
+			continue
+		}
+		var runeDelta, columnDelta int
+		if dedent {
+			n := dedentLength(line, e.indentation)
+			if n == 0 {
+				continue
+			}
+			runeDelta, columnDelta = -n, -e.indentation.WSLen(line[:n])
+			e.SetLine(y, line[n:])
+		} else {
+			runeDelta, columnDelta = len(oneIndentation), e.indentation.WSLen(oneIndentation)
+			e.SetLine(y, oneIndentation+line)
+		}
+		changed = true
+		if y == cursorY {
+			e.pos.sx += columnDelta
+			if e.pos.sx < 0 {
+				e.pos.sx = 0
+			}
+		}
+		if e.selection != nil && e.selection.y == y {
+			e.selection.x += runeDelta
+			if e.selection.x < 0 {
+				e.selection.x = 0
+			}
+		}
+	}
+	if changed {
+		e.redraw = true
+		e.redrawCursor = true
+	}
+	return changed
+}
+
+// ToggleCommentRange comments out the lines in the given range, or comments them in again
+// if most of them are already commented out
+func (e *Editor) ToggleCommentRange(r Range) {
+	commentMarker := e.SingleLineCommentMarker()
+	commentCounter := 0
+	for y := r.From; y <= r.To; y++ {
+		if e.LineCommented(y, commentMarker) {
+			commentCounter++
+		}
+	}
+	// A single line is toggled, while a block is commented in if most of the lines are comments
+	commentOff := commentCounter >= (r.Len() / 2)
+	if r.Len() == 1 {
+		commentOff = commentCounter == 1
+	}
+	for y := r.From; y <= r.To; y++ {
+		if commentOff {
+			e.CommentOff(y, commentMarker)
+		} else {
+			e.CommentOn(y, commentMarker)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+// newRangeEditor returns an editor with two blocks of text, separated by a blank line
+func newRangeEditor() *Editor {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("c\na\nb\n\nz\ny\n"))
+	return e
+}
+
+func TestRange(t *testing.T) {
+	r := Lines(4, 2)
+	if r.From != 2 || r.To != 4 || r.Len() != 3 || r.Empty() {
+		t.Errorf("expected lines 2 to 4, got %v", r)
+	}
+	if !r.Contains(2) || !r.Contains(4) || r.Contains(5) {
+		t.Error("expected the range to contain only the lines from 2 to 4")
+	}
+	e := newRangeEditor()
+	if r := e.BlockAt(0); r != Lines(0, 2) {
+		t.Errorf("expected the first block to be lines 0 to 2, got %v", r)
+	}
+	if r := e.BlockAt(4); r != Lines(4, 5) {
+		t.Errorf("expected the last block to end at the end of the document, got %v", r)
+	}
+	if r := e.BlockAt(3); !r.Empty() || r.From != 3 {
+		t.Errorf("expected an empty range at a blank line, got %v", r)
+	}
+	if r := e.WholeFile(); r != Lines(0, 5) {
+		t.Errorf("expected the whole file to be lines 0 to 5, got %v", r)
+	}
+	if s := e.Block(1); s != "a\nb\n" {
+		t.Errorf("expected the block to be a string with newlines, got %q", s)
+	}
+}
+
+func TestSortRange(t *testing.T) {
+	e := newRangeEditor()
+	e.SortRange(e.BlockAt(0), SortOptions{}, nil)
+	if s := e.String(); s != "a\nb\nc\n\nz\ny\n" {
+		t.Errorf("expected only the first block to be sorted, got %q", s)
+	}
+	e = newRangeEditor()
+	e.SortRange(Lines(4, 5), SortOptions{}, nil)
+	if s := e.String(); s != "c\na\nb\n\ny\nz\n" {
+		t.Errorf("expected only the last two lines to be sorted, got %q", s)
+	}
+}
+
+func TestReplaceRange(t *testing.T) {
+	e := newRangeEditor()
+	bookmark := &Position{sy: 4}
+	e.ReplaceRange(e.BlockAt(0), []string{"x"}, bookmark)
+	if s := e.String(); s != "x\n\nz\ny\n" {
+		t.Errorf("expected the first block to be replaced, got %q", s)
+	}
+	if bookmark.LineIndex() != 2 {
+		t.Errorf("expected the bookmark to move up to line index 2, got %d", bookmark.LineIndex())
+	}
+	e.ReplaceRange(Lines(2, 3), []string{"1", "2", "3"}, bookmark)
+	if s := e.String(); s != "x\n\n1\n2\n3\n" {
+		t.Errorf("expected the last two lines to be replaced by three lines, got %q", s)
+	}
+	if bookmark.LineIndex() != 2 {
+		t.Errorf("expected the bookmark to stay at line index 2, got %d", bookmark.LineIndex())
+	}
+}
+
+func TestDeleteRangeAndInsertLines(t *testing.T) {
+	e := newRangeEditor()
+	e.DeleteRange(e.BlockAt(4), nil)
+	if s := e.String(); s != "c\na\nb\n\n" {
+		t.Errorf("expected the last block to be deleted, got %q", s)
+	}
+	e = newRangeEditor()
+	e.DeleteRange(Lines(1, 3), nil)
+	if s := e.String(); s != "c\nz\ny\n" {
+		t.Errorf("expected lines 1 to 3 to be deleted, got %q", s)
+	}
+	bookmark := &Position{sy: 2}
+	e.InsertLines(1, []string{"1", "2"}, bookmark)
+	if s := e.String(); s != "c\n1\n2\nz\ny\n" {
+		t.Errorf("expected two lines to be inserted at line index 1, got %q", s)
+	}
+	if bookmark.LineIndex() != 4 {
+		t.Errorf("expected the bookmark to move down to line index 4, got %d", bookmark.LineIndex())
+	}
+}
+
+func TestToggleCommentRange(t *testing.T) {
+	e := newRangeEditor()
+	e.ToggleCommentRange(e.BlockAt(0))
+	if s := e.String(); s != "// c\n// a\n// b\n\nz\ny\n" {
+		t.Errorf("expected the first block to be commented out, got %q", s)
+	}
+	e.ToggleCommentRange(e.BlockAt(0))
+	if s := e.String(); s != "c\na\nb\n\nz\ny\n" {
+		t.Errorf("expected the first block to be commented in again, got %q", s)
+	}
+	e.ToggleCommentRange(Lines(5, 5))
+	e.ToggleCommentRange(Lines(4, 5))
+	if s := e.String(); s != "c\na\nb\n\nz\ny\n" {
+		t.Errorf("expected a range that is mostly comments to be commented in, got %q", s)
+	}
+
+	// Blocks that are longer than the screen are toggled as well
+	e = NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte(strings.Repeat("x\n", 30)))
+	e.ToggleCommentBlock()
+	if n := strings.Count(e.String(), "// x"); n != 30 {
+		t.Errorf("expected all 30 lines to be commented out, got %d", n)
+	}
+}
+
+func TestIndentRange(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: true}
+	e.LoadBytes([]byte("a\n  b\n\n\tc\n"))
+	e.pos.sy = 1
+	e.pos.sx = 3
+	if !e.IndentRange(e.WholeFile(), false) {
+		t.Fatal("expected the lines to be indented")
+	}
+	if s := e.String(); s != "    a\n      b\n\n    \tc\n" {
+		t.Errorf("unexpected contents after indenting: %q", s)
+	}
+	if e.pos.sx != 7 {
+		t.Errorf("expected the cursor to follow the text, got column %d", e.pos.sx)
+	}
+	// Dedenting twice never removes text from lines that are not indented
+	e.IndentRange(e.WholeFile(), true)
+	e.IndentRange(e.WholeFile(), true)
+	if s := e.String(); s != "a\nb\n\nc\n" {
+		t.Errorf("unexpected contents after dedenting: %q", s)
+	}
+	if e.IndentRange(Range{0, 1}, true) {
+		t.Error("expected nothing to dedent")
+	}
+	if e.pos.sx != 1 {
+		t.Errorf("expected the cursor to follow the text, got column %d", e.pos.sx)
+	}
+}
+
+func TestJoinRange(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte("// one\n//   two\nx := f(\n\ta,\n\tb)\n"))
+	if e.JoinRange(Range{0, 0}, nil) {
+		t.Error("expected a single line to not be joined")
+	}
+	if !e.JoinRange(Range{2, 4}, nil) || !e.JoinRange(Range{0, 1}, nil) {
+		t.Fatal("expected the lines to be joined")
+	}
+	if s := e.String(); s != "// one two\nx := f(a, b)\n" {
+		t.Errorf("unexpected contents after joining code: %q", s)
+	}
+
+	// For prose, the space after a period is kept as a single space
+	e.mode = mode.Markdown
+	e.LoadBytes([]byte("The end.  \n  Next one.\nLast\n"))
+	e.JoinRange(e.WholeFile(), nil)
+	if s := e.String(); s != "The end. Next one. Last\n" {
+		t.Errorf("unexpected contents after joining prose: %q", s)
+	}
+}
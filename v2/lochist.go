@@ -65,6 +65,50 @@ func LoadLocationHistory(configFile string) (map[string]LineNumber, error) {
 	return locationHistory, nil
 }
 
+// FindInLocationHistory looks up the line number for the given absolute filename in the o location history,
+// without parsing the entries for all the other files.
+func FindInLocationHistory(configFile, absFilename string) (LineNumber, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return LineNumber(-1), err
+	}
+	key := []byte("\"" + absFilename + "\":")
+	for pos := 0; pos < len(data); {
+		i := bytes.Index(data[pos:], key)
+		if i < 0 {
+			break
+		}
+		i += pos
+		pos = i + len(key)
+		// The filename must be at the start of a line
+		lineStart := bytes.LastIndexByte(data[:i], '\n') + 1
+		if len(bytes.TrimSpace(data[lineStart:i])) > 0 {
+			continue
+		}
+		lineEnd := bytes.IndexByte(data[pos:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(data) - pos
+		}
+		lineNumber, err := strconv.Atoi(string(bytes.TrimSpace(data[pos : pos+lineEnd])))
+		if err != nil {
+			// Could not convert to a number
+			continue
+		}
+		return LineNumber(lineNumber), nil
+	}
+	return LineNumber(-1), errors.New("filename not found in location history: " + absFilename)
+}
+
+// loadedLocationHistory returns the location history, which is only read from file
+// the first time it is needed, when a location is about to be saved
+func loadedLocationHistory() map[string]LineNumber {
+	if locationHistory == nil {
+		// The returned map is empty if the file could not be read, so this is only attempted once
+		locationHistory, _ = LoadLocationHistory(locationHistoryFilename)
+	}
+	return locationHistory
+}
+
 // LoadVimLocationHistory will attempt to load the history of where the cursor should be when opening a file from ~/.viminfo
 // The returned map can be empty. The filenames have absolute paths.
 func LoadVimLocationHistory(vimInfoFilename string) map[string]LineNumber {
@@ -429,6 +473,14 @@ func (e *Editor) SaveLocation(absFilename string, locationHistory map[string]Lin
 		// Cull the history
 		locationHistory = make(map[string]LineNumber, 1)
 	}
+	// Save the view state, like if the column ruler is shown
+	if err := e.SaveViewState(absFilename, viewStates); err != nil {
+		return err
+	}
+	// Save the named bookmarks
+	if err := e.SaveBookmarks(absFilename, bookmarkHistory); err != nil {
+		return err
+	}
 	// Save the current line location
 	locationHistory[absFilename] = e.LineNumber()
 	// Save the location history and return the error, if any
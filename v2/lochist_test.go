@@ -34,3 +34,30 @@ func TestNeoVimMsgPack(t *testing.T) {
 	// Enable this for debugging
 	//fmt.Println("line", line)
 }
+
+func TestFindInLocationHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "locations.txt")
+	data := "\"/etc/fstab\": 3\n\"/tmp/a b.txt\": 12\n  \"/etc/hosts\":7\n\"/etc/x\": \"/etc/fstab\": 9\n"
+	if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]LineNumber{"/etc/fstab": 3, "/tmp/a b.txt": 12, "/etc/hosts": 7}
+	for absFilename, expected := range tests {
+		if n, err := FindInLocationHistory(filename, absFilename); err != nil || n != expected {
+			t.Errorf("%s: expected line %d, got %d (%v)", absFilename, expected, n, err)
+		}
+	}
+	if _, err := FindInLocationHistory(filename, "/etc"); err == nil {
+		t.Error("expected a filename that is not in the history not to be found")
+	}
+	// The same as LoadLocationHistory finds
+	locations, err := LoadLocationHistory(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for absFilename, expected := range tests {
+		if locations[absFilename] != expected {
+			t.Errorf("%s: expected LoadLocationHistory to find line %d, got %d", absFilename, expected, locations[absFilename])
+		}
+	}
+}
@@ -14,6 +14,7 @@ var defaultLockFile = filepath.Join(userCacheDir, "o", "lockfile.txt")
 // LockKeeper keeps track of which files are currently being edited by o
 type LockKeeper struct {
 	lockedFiles  map[string]time.Time // from filename to lockfilestamp
+	owners       map[string]int       // from filename to the process ID of the editor that locked it
 	mut          *sync.RWMutex
 	lockFilename string
 }
@@ -22,7 +23,7 @@ type LockKeeper struct {
 // and creates a new LockKeeper struct, without loading the given lock file.
 func NewLockKeeper(lockFilename string) *LockKeeper {
 	lockMap := make(map[string]time.Time)
-	return &LockKeeper{lockMap, &sync.RWMutex{}, lockFilename}
+	return &LockKeeper{lockMap, make(map[string]int), &sync.RWMutex{}, lockFilename}
 }
 
 // Load loads the contents of the main lockfile
@@ -41,8 +42,12 @@ func (lk *LockKeeper) Load() error {
 	if err != nil {
 		return err
 	}
+	// The process IDs are stored after the timestamps, and are missing from lock files written by older versions
+	owners := make(map[string]int)
+	dec.Decode(&owners)
 	lk.mut.Lock()
 	lk.lockedFiles = lockMap
+	lk.owners = owners
 	lk.mut.Unlock()
 	return nil
 }
@@ -63,6 +68,9 @@ func (lk *LockKeeper) Save() error {
 
 	lk.mut.RLock()
 	err = enc.Encode(lk.lockedFiles)
+	if err == nil {
+		err = enc.Encode(lk.owners)
+	}
 	lk.mut.RUnlock()
 
 	f.Sync()
@@ -85,6 +93,7 @@ func (lk *LockKeeper) Lock(filename string) error {
 	// Add the file to the map
 	lk.mut.Lock()
 	lk.lockedFiles[filename] = time.Now()
+	lk.owners[filename] = os.Getpid()
 	lk.mut.Unlock()
 
 	return nil
@@ -106,6 +115,7 @@ func (lk *LockKeeper) Unlock(filename string) error {
 	// Remove the file from the map
 	lk.mut.Lock()
 	delete(lk.lockedFiles, filename)
+	delete(lk.owners, filename)
 	lk.mut.Unlock()
 
 	return nil
@@ -121,3 +131,18 @@ func (lk *LockKeeper) GetTimestamp(filename string) time.Time {
 
 	return timestamp
 }
+
+// IsLocked checks if the given absolute filename is locked
+func (lk *LockKeeper) IsLocked(filename string) bool {
+	lk.mut.RLock()
+	defer lk.mut.RUnlock()
+	_, has := lk.lockedFiles[filename]
+	return has
+}
+
+// Owner returns the process ID of the editor that locked the given filename, or 0 if it is not known
+func (lk *LockKeeper) Owner(filename string) int {
+	lk.mut.RLock()
+	defer lk.mut.RUnlock()
+	return lk.owners[filename]
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lspTimeout is how long to wait for a response from a language server
+const lspTimeout = 10 * time.Second
+
+var errLSPStopped = errors.New("the language server has stopped")
+
+// LSPClient is a minimal Language Server Protocol client, that talks to a language server like gopls over stdin and stdout
+type LSPClient struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	writeMut sync.Mutex               // only one message is written at the time
+	mut      sync.Mutex               // protects the fields below
+	nextID   int                      // the ID of the next request
+	pending  map[int]chan lspIncoming // the requests that are waiting for a response, by ID
+	versions map[string]int           // the version of each document that has been opened, by URI
+	done     chan struct{}            // closed when the language server has stopped sending messages
+}
+
+// lspRequest is a request or a notification (without an ID) from the client
+type lspRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int        `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// lspResponse is an empty response from the client, to a request from the language server
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+}
+
+// lspIncoming is a response, a request or a notification from the language server
+type lspIncoming struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// lspPosition is a zero-based line and a zero-based column, counted in UTF-16 code units
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// lspRange is a range in a document
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// lspLocation is a range in a document, given by URI
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// lspTextDocumentPositionParams are the parameters for requests about a position in a document
+type lspTextDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// fileURI returns the "file://" URI for the given absolute path
+func fileURI(absFilename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absFilename)}).String()
+}
+
+// uriToPath returns the path for the given "file://" URI
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", errors.New("not a file: " + uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// utf16Column converts the given rune index in a line to a column in UTF-16 code units, as used by language servers
+func utf16Column(runes []rune, x int) int {
+	column := 0
+	for i, r := range runes {
+		if i >= x {
+			break
+		}
+		if r >= 0x10000 {
+			column += 2
+		} else {
+			column++
+		}
+	}
+	return column
+}
+
+// runeColumn converts the given column in UTF-16 code units to a rune index in the given line
+func runeColumn(runes []rune, character int) int {
+	column := 0
+	for i, r := range runes {
+		if column >= character {
+			return i
+		}
+		if r >= 0x10000 {
+			column += 2
+		} else {
+			column++
+		}
+	}
+	return len(runes)
+}
+
+// readLSPMessage reads one message, with a Content-Length header, from the given reader
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("no Content-Length header")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// writeLSPMessage writes the given message as JSON, with a Content-Length header
+func writeLSPMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// StartLSPClient starts the given language server in the given root directory, and initializes it
+func StartLSPClient(rootDir, name string, args ...string) (*LSPClient, error) {
+	if which(name) == "" {
+		return nil, errors.New(name + " is not installed")
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	client := &LSPClient{
+		cmd:      cmd,
+		stdin:    stdin,
+		nextID:   1,
+		pending:  make(map[int]chan lspIncoming),
+		versions: make(map[string]int),
+		done:     make(chan struct{}),
+	}
+	go client.readMessages(bufio.NewReader(stdout))
+
+	rootURI := fileURI(rootDir)
+	initializeParams := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   rootURI,
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"hover": map[string]interface{}{"contentFormat": []string{"plaintext"}},
+			},
+		},
+		"workspaceFolders": []map[string]string{{"uri": rootURI, "name": filepath.Base(rootDir)}},
+	}
+	if err := client.call("initialize", initializeParams, nil); err != nil {
+		client.Stop()
+		return nil, err
+	}
+	if err := client.notify("initialized", struct{}{}); err != nil {
+		client.Stop()
+		return nil, err
+	}
+	return client, nil
+}
+
+// readMessages reads messages from the language server until it stops, and passes the responses on to the waiting requests.
+// Requests from the language server, like "window/workDoneProgress/create", get an empty response.
+func (client *LSPClient) readMessages(r *bufio.Reader) {
+	defer close(client.done)
+	for {
+		data, err := readLSPMessage(r)
+		if err != nil {
+			return
+		}
+		var msg lspIncoming
+		if json.Unmarshal(data, &msg) != nil || len(msg.ID) == 0 {
+			// Notifications, like diagnostics and log messages, are not used
+			continue
+		}
+		if msg.Method != "" {
+			client.send(lspResponse{JSONRPC: "2.0", ID: msg.ID})
+			continue
+		}
+		id, err := strconv.Atoi(string(msg.ID))
+		if err != nil {
+			continue
+		}
+		client.mut.Lock()
+		if responseChan, ok := client.pending[id]; ok {
+			responseChan <- msg
+			delete(client.pending, id)
+		}
+		client.mut.Unlock()
+	}
+}
+
+// send writes the given message to the language server
+func (client *LSPClient) send(v interface{}) error {
+	client.writeMut.Lock()
+	defer client.writeMut.Unlock()
+	return writeLSPMessage(client.stdin, v)
+}
+
+// notify sends a notification, which the language server does not respond to
+func (client *LSPClient) notify(method string, params interface{}) error {
+	return client.send(lspRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// call sends a request and waits for the response. The result is decoded into the given result, if it is not nil.
+func (client *LSPClient) call(method string, params, result interface{}) error {
+	responseChan := make(chan lspIncoming, 1)
+	client.mut.Lock()
+	id := client.nextID
+	client.nextID++
+	client.pending[id] = responseChan
+	client.mut.Unlock()
+	defer func() {
+		client.mut.Lock()
+		delete(client.pending, id)
+		client.mut.Unlock()
+	}()
+	if err := client.send(lspRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+	select {
+	case msg := <-responseChan:
+		if msg.Error != nil {
+			return errors.New(msg.Error.Message)
+		}
+		if result != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	case <-client.done:
+		return errLSPStopped
+	case <-time.After(lspTimeout):
+		return errors.New(method + " timed out")
+	}
+}
+
+// Stopped checks if the language server has stopped
+func (client *LSPClient) Stopped() bool {
+	select {
+	case <-client.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop asks the language server to shut down and exit, and kills it if it has not exited within a second
+func (client *LSPClient) Stop() {
+	if !client.Stopped() {
+		shutdownDone := make(chan error, 1)
+		go func() { shutdownDone <- client.call("shutdown", nil, nil) }()
+		select {
+		case <-shutdownDone:
+			client.notify("exit", nil)
+		case <-time.After(time.Second):
+		}
+	}
+	client.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		client.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		client.cmd.Process.Kill()
+		<-exited
+	}
+	// Waiting for the process closes stdout, which stops readMessages
+	<-client.done
+}
+
+// SyncDocument sends the contents of a document to the language server, by opening it the first time and then changing it
+func (client *LSPClient) SyncDocument(uri, languageID, text string) error {
+	client.mut.Lock()
+	version, opened := client.versions[uri]
+	version++
+	client.versions[uri] = version
+	client.mut.Unlock()
+	if !opened {
+		return client.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": languageID, "version": version, "text": text},
+		})
+	}
+	return client.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// positionParams returns the parameters for a request about the given position in the given document
+func positionParams(uri string, pos lspPosition) lspTextDocumentPositionParams {
+	var params lspTextDocumentPositionParams
+	params.TextDocument.URI = uri
+	params.Position = pos
+	return params
+}
+
+// Definition returns the locations of the definition of the identifier at the given position
+func (client *LSPClient) Definition(uri string, pos lspPosition) ([]lspLocation, error) {
+	var result json.RawMessage
+	if err := client.call("textDocument/definition", positionParams(uri, pos), &result); err != nil {
+		return nil, err
+	}
+	// The result can be a location, a list of locations or a list of location links
+	type locationOrLink struct {
+		lspLocation
+		TargetURI            string   `json:"targetUri"`
+		TargetSelectionRange lspRange `json:"targetSelectionRange"`
+	}
+	var links []locationOrLink
+	if result = bytes.TrimSpace(result); bytes.HasPrefix(result, []byte("[")) {
+		if err := json.Unmarshal(result, &links); err != nil {
+			return nil, err
+		}
+	} else if len(result) > 0 && !bytes.Equal(result, []byte("null")) {
+		var link locationOrLink
+		if err := json.Unmarshal(result, &link); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	locations := make([]lspLocation, 0, len(links))
+	for _, link := range links {
+		if link.TargetURI != "" {
+			locations = append(locations, lspLocation{link.TargetURI, link.TargetSelectionRange})
+		} else {
+			locations = append(locations, link.lspLocation)
+		}
+	}
+	return locations, nil
+}
+
+// hoverText returns the text from the contents of a hover result, which can be markup, a string,
+// a string with a language, or a list of strings with or without a language
+func hoverText(contents json.RawMessage) string {
+	var s string
+	if json.Unmarshal(contents, &s) == nil {
+		return s
+	}
+	var markup struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(contents, &markup) == nil && markup.Value != "" {
+		return markup.Value
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(contents, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+// Hover returns the documentation for the identifier at the given position, or an empty string
+func (client *LSPClient) Hover(uri string, pos lspPosition) (string, error) {
+	var result *struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := client.call("textDocument/hover", positionParams(uri, pos), &result); err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", nil
+	}
+	return strings.TrimSpace(hoverText(result.Contents)), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serveFakeLanguageServer answers the requests that the editor sends to gopls, for the files in TestGoToDefinition.
+// The definition of anything on line 4 is at line 3, column 6 of tmp.lib.go, in the same directory.
+func serveFakeLanguageServer(r io.Reader, w io.Writer) {
+	var (
+		br        = bufio.NewReader(r)
+		documents = make(map[string]string)
+	)
+	for {
+		data, err := readLSPMessage(br)
+		if err != nil {
+			return
+		}
+		var msg struct {
+			ID     *int   `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				TextDocument struct {
+					URI  string `json:"uri"`
+					Text string `json:"text"`
+				} `json:"textDocument"`
+				Position       lspPosition `json:"position"`
+				ContentChanges []struct {
+					Text string `json:"text"`
+				} `json:"contentChanges"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			return
+		}
+		reply := func(result interface{}) {
+			writeLSPMessage(w, map[string]interface{}{"jsonrpc": "2.0", "id": *msg.ID, "result": result})
+		}
+		uri := msg.Params.TextDocument.URI
+		switch msg.Method {
+		case "initialize":
+			reply(map[string]interface{}{"capabilities": map[string]interface{}{}})
+		case "textDocument/didOpen":
+			documents[uri] = msg.Params.TextDocument.Text
+		case "textDocument/didChange":
+			documents[uri] = msg.Params.ContentChanges[0].Text
+		case "textDocument/definition":
+			// Like gopls, ask the client for something before responding
+			writeLSPMessage(w, map[string]interface{}{"jsonrpc": "2.0", "id": 1000, "method": "window/workDoneProgress/create", "params": map[string]string{"token": "1"}})
+			if !strings.Contains(documents[uri], "Greet()") || msg.Params.Position.Line != 3 {
+				reply(nil)
+				continue
+			}
+			path, _ := uriToPath(uri)
+			target := lspRange{lspPosition{2, 5}, lspPosition{2, 10}}
+			reply([]map[string]interface{}{{"targetUri": fileURI(filepath.Join(filepath.Dir(path), "tmp.lib.go")), "targetRange": target, "targetSelectionRange": target}})
+		case "textDocument/hover":
+			reply(map[string]interface{}{"contents": map[string]string{"kind": "plaintext", "value": "func Greet() string\n\nGreet returns a friendly greeting."}})
+		case "shutdown":
+			reply(nil)
+		case "exit":
+			return
+		}
+	}
+}
+
+// TestFakeLanguageServer is started as a language server by TestGoToDefinition
+func TestFakeLanguageServer(t *testing.T) {
+	if os.Getenv("O_FAKE_LANGUAGE_SERVER") != "1" {
+		t.Skip("only used as a language server by other tests")
+	}
+	serveFakeLanguageServer(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+func TestUTF16Column(t *testing.T) {
+	runes := []rune("s := \"😀\" + x")
+	if column := utf16Column(runes, 11); column != 12 {
+		t.Errorf("expected the emoji to count as two code units, got column %d", column)
+	}
+	if x := runeColumn(runes, 12); x != 11 {
+		t.Errorf("expected rune index 11, got %d", x)
+	}
+	if x := runeColumn(runes, 100); x != len(runes) {
+		t.Errorf("expected the end of the line, got %d", x)
+	}
+}
+
+func TestGoToDefinition(t *testing.T) {
+	defer func(command []string) { goplsCommand = command }(goplsCommand)
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{
+		"tmp.main.go": "package main\n\nfunc main() {\n\tprintln(Greet())\n}\n",
+		"tmp.lib.go":  "package main\n\nfunc Greet() string {\n\treturn \"hi\"\n}\n",
+	})
+	mainFilename, libFilename := filepath.Join(dir, "tmp.main.go"), filepath.Join(dir, "tmp.lib.go")
+
+	c, e, status := openTestEditor(t, mainFilename)
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+
+	// Without gopls, there is a helpful error message
+	goplsCommand = []string{"o-no-such-language-server"}
+	if err := e.GoToDefinition(c, nil, status, lk); err == nil || err.Error() != "o-no-such-language-server is not installed" {
+		t.Errorf("expected an error about the missing language server, got %v", err)
+	}
+
+	t.Setenv("O_FAKE_LANGUAGE_SERVER", "1")
+	goplsCommand = []string{os.Args[0], "-test.run=^TestFakeLanguageServer$"}
+	defer StopGopls()
+
+	// The cursor is on "Greet" in "println(Greet())"
+	e.MoveToLineColumnNumber(c, status, 4, 10, false)
+	if err := e.ShowHover(c, status); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(c.String(), "Greet returns a friendly greeting.") {
+		t.Error("expected the documentation to be drawn")
+	}
+	if err := e.GoToDefinition(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != libFilename || e.LineNumber() != 3 {
+		t.Errorf("expected line 3 in %s, got line %d in %s", libFilename, e.LineNumber(), e.filename)
+	}
+	if x, _ := e.DataX(); x != 5 {
+		t.Errorf("expected the cursor to be at the function name, got column %d", x+1)
+	}
+	if err := e.GoToDefinition(c, nil, status, lk); err != errNoDefinition {
+		t.Errorf("expected no definition, got %v", err)
+	}
+
+	client := goplsClient
+	StopGopls()
+	if !client.Stopped() {
+		t.Error("expected the language server to be stopped")
+	}
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"errors"
+	"strings"
 )
 
+// macroCommandPrefix is the start of a recorded keypress that runs a command that was selected from the ctrl-o menu
+const macroCommandPrefix = "cmd:"
+
 // Macro represents a series of keypresses that can be played back later
 type Macro struct {
 	KeyPresses []string
@@ -42,6 +46,16 @@ func (m *Macro) Len() int {
 	return len(m.KeyPresses)
 }
 
+// RecordCommand replaces the recorded ctrl-o keypress that opened the command menu with the selected command,
+// so that the command is run again when the macro is played back, instead of the menu being shown.
+// Commands that insert the date, the time or a UUID then insert a new one each time.
+func (m *Macro) RecordCommand(args ...string) {
+	if last, err := m.Pop(); err == nil && last != "c:15" { // ctrl-o
+		m.Add(last)
+	}
+	m.Add(macroCommandPrefix + strings.Join(args, " "))
+}
+
 // Pop will pop the last keypress off the stack
 func (m *Macro) Pop() (string, error) {
 	l := len(m.KeyPresses)
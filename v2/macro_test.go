@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMacroRecordCommand(t *testing.T) {
+	m := NewMacro()
+	m.Recording = true
+	for _, key := range []string{"a", "c:15"} {
+		m.Add(key)
+	}
+	m.RecordCommand("insertuuid")
+	m.Add("b")
+	if s := strings.Join(m.KeyPresses, " "); s != "a cmd:insertuuid b" {
+		t.Errorf("expected the ctrl-o keypress to be replaced by the command, got %q", s)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/xyproto/vt100"
 )
@@ -18,11 +19,38 @@ const (
 	versionString = "o 2.59.0"
 )
 
+// searchArgument is a search pattern that is given on the command line, like "+/func main" or "+?TODO"
+type searchArgument struct {
+	pattern  string // the search term, which may start with "re:" and end with "/i" or "/w", like when searching with ctrl-f
+	backward bool   // search backwards from the end of the file, for "+?"
+}
+
+// parseSearchArgument parses a vim-style "+/pattern" or "+?pattern" argument
+func parseSearchArgument(arg string) (searchArgument, bool) {
+	if len(arg) < 3 || arg[0] != '+' || (arg[1] != '/' && arg[1] != '?') {
+		return searchArgument{}, false
+	}
+	return searchArgument{pattern: arg[2:], backward: arg[1] == '?'}, true
+}
+
+// splitSearchArgument removes the first "+/pattern" or "+?pattern" argument from the given arguments,
+// so that it can be given either before or after the filename
+func splitSearchArgument(args []string) ([]string, searchArgument, bool) {
+	for i, arg := range args {
+		if sa, ok := parseSearchArgument(arg); ok {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return rest, sa, true
+		}
+	}
+	return args, searchArgument{}, false
+}
+
 func main() {
 	var (
 		versionFlag = flag.Bool("version", false, "version information")
 		helpFlag    = flag.Bool("help", false, "quick overview of hotkeys")
 		forceFlag   = flag.Bool("f", false, "open even if already open")
+		remoteFlag  = flag.Bool("remote", false, "open the file in the running editor that has it open")
 	)
 
 	flag.Parse()
@@ -50,6 +78,8 @@ ctrl-w     for Zig, Rust, V and Go, format with the "... fmt" command
 ctrl-g     to toggle filename/line/column/unicode/word count status display
 ctrl-a     go to start of line, then start of text and then the previous line
 ctrl-e     go to end of line and then the next line
+home/end   go to the start or end of the line, with ctrl for the top or end of the file
+insert     toggle between inserting and overwriting text
 ctrl-n     to scroll down 10 lines or go to the next match if a search is active
 ctrl-p     to scroll up 10 lines or go to the previous match
 ctrl-k     to delete characters to the end of the line, then delete the line
@@ -59,17 +89,37 @@ ctrl-t     for C and C++, toggle between the header and implementation,
            for Agda, insert a symbol,
            for the rest, record and then play back a macro
 ctrl-c     to copy the current line, press twice to copy the current block
-ctrl-v     to paste one line, press twice to paste the rest
+ctrl-v     to paste all the copied lines, the status bar tells how many
 ctrl-x     to cut the current line, press twice to cut the current block
 ctrl-b     to toggle a bookmark for the current line, or jump to a bookmark
+           (ctrl-b followed by a digit for one of several named bookmarks)
 ctrl-u     to undo (ctrl-z is also possible, but may background the application)
+ctrl-y     to redo
 ctrl-l     to jump to a specific line (press return to jump to the top or bottom)
 ctrl-f     to find a string, press Tab after the text to search and replace
+           (then return to replace all, Tab to replace once or ctrl-r to confirm each),
+           start with "re:" to find a regular expression, like "re:func \w+Handler"
 ctrl-\     to toggle single-line comments for a block of code
 ctrl-~     to jump to matching parenthesis
 esc        to redraw the screen and clear the last search
+esc 1 2    followed by an arrow key, ctrl-n, ctrl-p, ctrl-k, ctrl-d, backspace or ctrl-j
+           to repeat it 12 times, as one undo step (esc cancels the count)
+esc v      to start selecting text, then move the cursor and press ctrl-c, ctrl-x or ctrl-d
+           to copy, cut or delete exactly the selected text (esc stops selecting)
+esc .      to repeat the last change, like typed text or a deleted line (esc 3 . repeats it 3 times)
 
 Set NO_COLOR=1 to disable colors.
+Set O_REDUCE_MOTION=1 to disable the spinner animation and the menu selection flash.
+Set O_CLOCK=1 to show the time in the status bar.
+Set O_SYSTEM_CLIPBOARD=0 to only copy and paste within the editor.
+Set O_OSC52_PASTE=1 to paste from the local terminal emulator over ssh.
+Set O_MOUSE=0 to select text with the mouse in the terminal emulator, instead of clicking and scrolling.
+Set O_SEARCH_WRAP=0 to stop at the last match when searching, instead of continuing from the other end.
+Set O_SPLIT_PASTE=1 to paste one line with ctrl-v, and the rest of the lines when ctrl-v is pressed again.
+Set O_AUTO_CLOSE=0 to stop closing brackets and quotes automatically when typing code.
+Set O_HIGHLIGHT_MAX_LINE_LENGTH=10000 to draw longer lines without syntax highlighting (0 for no limit).
+Set O_HIGHLIGHT_TIME_BUDGET=50 to stop syntax highlighting a redraw after 50 ms (0 for no limit).
+Set O_CONTROL_SOCKET=1 to let "o --remote filename [line [col]]" and other tools control the editor.
 
 See the man page for more information.
 
@@ -77,6 +127,20 @@ See the man page for more information.
 		return
 	}
 
+	if *remoteFlag {
+		// Ask the editor that has the file open to go to the given line and column
+		filename, lineNumber, colNumber := FilenameAndLineNumberAndColNumber(flag.Arg(0), flag.Arg(1), flag.Arg(2))
+		if filename == "" {
+			fmt.Fprintln(os.Stderr, "please provide a filename")
+			os.Exit(1)
+		}
+		if err := RemoteOpen(fileLock, filename, int(lineNumber), int(colNumber)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	traceStart() // if building with -tags trace
 
 	// Check if the executable starts with "g" or "f"
@@ -95,10 +159,11 @@ See the man page for more information.
 	}
 
 	var (
-		err        error
-		fnord      FilenameOrData
-		lineNumber LineNumber
-		colNumber  ColNumber
+		err         error
+		fnord       FilenameOrData
+		lineNumber  LineNumber
+		colNumber   ColNumber
+		startSearch *searchArgument // a search pattern from the command line, if any
 	)
 
 	stdinFilename := len(os.Args) == 1 || (len(os.Args) == 2 && (os.Args[1] == "-" || os.Args[1] == "/dev/stdin"))
@@ -119,7 +184,13 @@ See the man page for more information.
 			fnord.length = uint64(lendata)
 		}
 	} else {
-		fnord.filename, lineNumber, colNumber = FilenameAndLineNumberAndColNumber(flag.Arg(0), flag.Arg(1), flag.Arg(2))
+		// A search pattern, like "+/func main", can be given instead of a line number
+		args, sa, ok := splitSearchArgument(flag.Args())
+		if ok {
+			startSearch = &sa
+		}
+		args = append(args, "", "", "")
+		fnord.filename, lineNumber, colNumber = FilenameAndLineNumberAndColNumber(args[0], args[1], args[2])
 	}
 
 	// Check if the given filename contains something
@@ -173,6 +244,23 @@ See the man page for more information.
 		}
 	}
 
+	// Load the settings. A missing settings file is fine, and errors are reported when the editor has started.
+	settings, settingsErr = LoadSettings(settingsFilename)
+	reduceMotion = settingEnabled(settings, settingReduceMotion, "O_REDUCE_MOTION")
+	showClock = settingEnabled(settings, settingClock, "O_CLOCK")
+	useSystemClipboard = settingEnabledByDefault(settings, settingClipboard, "O_SYSTEM_CLIPBOARD", true)
+	osc52Paste = settingEnabled(settings, settingOSC52Paste, "O_OSC52_PASTE")
+	useMouse = settingEnabledByDefault(settings, settingMouse, "O_MOUSE", true)
+	searchWrap = settingEnabledByDefault(settings, settingSearchWrap, "O_SEARCH_WRAP", true)
+	splitPaste = settingEnabled(settings, settingSplitPaste, "O_SPLIT_PASTE")
+	useControlSocket = settingEnabled(settings, settingControlSocket, "O_CONTROL_SOCKET")
+	autoClose = settingEnabledByDefault(settings, settingAutoClose, "O_AUTO_CLOSE", true)
+	highlightMaxLineLength = settingNumber(settings, settingHighlightMaxLineLength, "O_HIGHLIGHT_MAX_LINE_LENGTH", highlightMaxLineLength)
+	highlightTimeBudget = time.Duration(settingNumber(settings, settingHighlightTimeBudget, "O_HIGHLIGHT_TIME_BUDGET", int(highlightTimeBudget/time.Millisecond))) * time.Millisecond
+	if modeNames, ok := settings[settingCountLeader]; ok {
+		countWithoutLeaderModes = parseModeList(modeNames)
+	}
+
 	// Set the terminal title, if the current terminal emulator supports it, and NO_COLOR is not set
 	fnord.SetTitle()
 
@@ -193,13 +281,13 @@ See the man page for more information.
 				specificLetter = true
 				editTheme = true
 			case 'l', 'v': // lo, light, vs, vscode etc.
-				theme = NewDarkVSTheme()
+				theme = NewDarkVSTrueColorTheme()
 				specificLetter = true
 			case 'r': // rb, ro, rt, red etc.
 				theme = NewRedBlackTheme()
 				specificLetter = true
 			case 's': // s, sw, synthwave etc.
-				theme = NewSynthwaveTheme()
+				theme = NewSynthwaveTrueColorTheme()
 				specificLetter = true
 			}
 		}
@@ -214,7 +302,7 @@ See the man page for more information.
 	defer tty.Close()
 
 	// Run the main editor loop
-	userMessage, stopParent, err := Loop(tty, fnord, lineNumber, colNumber, *forceFlag, theme, syntaxHighlight)
+	userMessage, stopParent, err := Loop(tty, fnord, lineNumber, colNumber, startSearch, *forceFlag, theme, syntaxHighlight)
 
 	// SIGQUIT the parent PID. Useful if being opened repeatedly by a find command.
 	if stopParent {
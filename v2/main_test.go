@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitSearchArgument(t *testing.T) {
+	tests := []struct {
+		args     []string
+		rest     []string
+		expected searchArgument
+		ok       bool
+	}{
+		{[]string{"main.go", "+/func main"}, []string{"main.go"}, searchArgument{pattern: "func main"}, true},
+		{[]string{"+?TODO", "main.go"}, []string{"main.go"}, searchArgument{pattern: "TODO", backward: true}, true},
+		{[]string{"main.go", `+/re:func \w+Handler/i`}, []string{"main.go"}, searchArgument{pattern: `re:func \w+Handler/i`}, true},
+		{[]string{"main.go", "+/a b", "+/c"}, []string{"main.go", "+/c"}, searchArgument{pattern: "a b"}, true},
+		{[]string{"main.go", "+12"}, []string{"main.go", "+12"}, searchArgument{}, false},
+		{[]string{"main.go", "+/"}, []string{"main.go", "+/"}, searchArgument{}, false},
+		{[]string{"main.go", "/tmp"}, []string{"main.go", "/tmp"}, searchArgument{}, false},
+		{[]string{"+/x+y"}, []string{}, searchArgument{pattern: "x+y"}, true},
+	}
+	for _, test := range tests {
+		rest, sa, ok := splitSearchArgument(test.args)
+		if ok != test.ok || sa != test.expected || fmt.Sprint(rest) != fmt.Sprint(test.rest) {
+			t.Errorf("%q: expected %q %+v %v, got %q %+v %v", test.args, test.rest, test.expected, test.ok, rest, sa, ok)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// manInputLine matches the line number in a message from groff, like "troff:<standard input>:12: warning: ..."
+var manInputLine = regexp.MustCompile(`<standard input>:(\d+):`)
+
+// errNoManRenderer is returned when neither man nor groff is installed
+var errNoManRenderer = errors.New("neither man nor groff is installed")
+
+// ManRenderError is a problem that man or groff found while rendering a man page
+type ManRenderError struct {
+	message    string
+	lineNumber LineNumber // the line in the nroff source, or 0 if the message has no line number
+}
+
+func (mre *ManRenderError) Error() string {
+	if mre.lineNumber > 0 {
+		return "line " + mre.lineNumber.String() + ": " + mre.message
+	}
+	return mre.message
+}
+
+// parseManRenderError returns the first message that has a line number, from what man or groff wrote to stderr.
+// If no message has a line number, the first line is used. Returns nil if there are no messages.
+func parseManRenderError(stderr string) *ManRenderError {
+	var first string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if first == "" {
+			first = line
+		}
+		loc := manInputLine.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+		n, err := strconv.Atoi(line[loc[2]:loc[3]])
+		if err != nil {
+			continue
+		}
+		message := strings.TrimSpace(line[loc[1]:])
+		if message == "" {
+			message = line
+		}
+		return &ManRenderError{message, LineNumber(n)}
+	}
+	if first == "" {
+		return nil
+	}
+	return &ManRenderError{first, 0}
+}
+
+// manRenderCommand returns a command that renders nroff source from stdin as a man page with the given width,
+// using man, or groff if man is not installed. The output is plain text, without bold or underline.
+// Returns nil if neither is installed.
+func manRenderCommand(width int) *exec.Cmd {
+	if manPath := which("man"); manPath != "" {
+		cmd := exec.Command(manPath, "-P", "cat", "-l", "-")
+		cmd.Env = append(os.Environ(), "MANWIDTH="+strconv.Itoa(width))
+		return cmd
+	}
+	if groffPath := which("groff"); groffPath != "" {
+		return exec.Command(groffPath, "-man", "-Tutf8", "-P-cbou", "-rLL="+strconv.Itoa(width)+"n")
+	}
+	return nil
+}
+
+// renderManPage renders the given nroff source as a man page, as plain text.
+// If man or groff reports a problem, a *ManRenderError is returned.
+func renderManPage(source []byte, width int) ([]byte, error) {
+	cmd := manRenderCommand(width)
+	if cmd == nil {
+		return nil, errNoManRenderer
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if mre := parseManRenderError(stderr.String()); mre != nil {
+		return nil, mre
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Some versions of man may still use ^H for bold and underline
+	return []byte(handleManPageEscape(stdout.String())), nil
+}
+
+// PreviewManPage renders the current nroff source as a man page and shows it in a read-only buffer,
+// while the source is kept in the switch buffer, so that ctrl-space switches back to it.
+// If the source could not be rendered, the error is shown and the cursor is moved to the line with the problem.
+func (e *Editor) PreviewManPage(c *vt100.Canvas, status *StatusBar) {
+	width := 80
+	if c != nil {
+		width = int(c.Width())
+	}
+	rendered, err := renderManPage([]byte(e.String()), width)
+	if err != nil {
+		status.ClearAll(c)
+		var mre *ManRenderError
+		if errors.As(err, &mre) && mre.lineNumber > 0 {
+			e.redraw = e.GoToLineNumber(mre.lineNumber, c, status, true)
+			e.redrawCursor = true
+		}
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+
+	// Keep the source, with its undo history, one switch away
+	switchBuffer.Snapshot(e)
+	undo, switchUndoBackup = switchUndoBackup, undo
+
+	preview := NewCustomEditor(e.indentation, e.pos.scrollSpeed, mode.ManPage, e.Theme, true, false)
+	preview.filename = e.filename
+	preview.LoadBytes(rendered)
+	preview.readOnly = true
+	preview.manPagePreview = true
+	preview.clearOnQuit = e.clearOnQuit
+	preview.changed = false
+	*e = *preview
+
+	status.SetMessageAfterRedraw("Preview of the man page, press ctrl-space to go back to the source")
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// LeaveManPagePreview switches from a man page preview back to the nroff source, as it was when the preview was made
+func (e *Editor) LeaveManPagePreview() error {
+	if !e.manPagePreview {
+		return errors.New("not a man page preview")
+	}
+	if err := switchBuffer.Restore(e); err != nil {
+		return err
+	}
+	undo, switchUndoBackup = switchUndoBackup, undo
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
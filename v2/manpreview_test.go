@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestParseManRenderError(t *testing.T) {
+	stderr := "man: some general problem\ntroff:<standard input>:12: warning: macro 'XX' not defined\n"
+	mre := parseManRenderError(stderr)
+	if mre == nil || mre.lineNumber != 12 || mre.message != "warning: macro 'XX' not defined" {
+		t.Errorf("expected the message with the line number, got %v", mre)
+	}
+	if mre := parseManRenderError("  \nman: no line number here\n"); mre == nil || mre.lineNumber != 0 || mre.message != "man: no line number here" {
+		t.Errorf("expected the first line without a line number, got %v", mre)
+	}
+	if mre := parseManRenderError("\n"); mre != nil {
+		t.Errorf("expected no error, got %v", mre)
+	}
+}
+
+const testManSource = `.TH HELLO 1
+.SH NAME
+hello \- say hello
+.SH DESCRIPTION
+Greets the world.
+`
+
+func TestRenderManPage(t *testing.T) {
+	if which("groff") == "" {
+		t.Skip("groff is not installed")
+	}
+	rendered, err := renderManPage([]byte(testManSource), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(rendered); !strings.Contains(s, "NAME") || !strings.Contains(s, "Greets the world.") || strings.Contains(s, "\b") {
+		t.Errorf("expected a plain text man page, got %q", s)
+	}
+}
+
+func TestManPagePreviewSwitch(t *testing.T) {
+	if which("groff") == "" {
+		t.Skip("groff is not installed")
+	}
+	defer func(b *Undo) { switchBuffer = b }(switchBuffer)
+	switchBuffer = NewUndo(1, defaultUndoMemory)
+
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Nroff
+	e.filename = "hello.1"
+	e.LoadBytes([]byte(testManSource))
+	status := testStatusBar(e)
+
+	e.PreviewManPage(c, status)
+	if !e.manPagePreview || !e.readOnly || e.mode != mode.ManPage {
+		t.Fatalf("expected a read-only man page preview, got mode %s", e.mode)
+	}
+	if !strings.Contains(e.String(), "Greets the world.") {
+		t.Errorf("expected the rendered man page, got %q", e.String())
+	}
+	if err := e.LeaveManPagePreview(); err != nil {
+		t.Fatal(err)
+	}
+	if e.manPagePreview || e.mode != mode.Nroff || e.String() != testManSource {
+		t.Errorf("expected the nroff source to be back, got %q", e.String())
+	}
+	if err := e.LeaveManPagePreview(); err == nil {
+		t.Error("expected an error when not in a preview")
+	}
+}
@@ -130,11 +130,18 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 		selectedDelay      = 100 * time.Millisecond
 		c                  = vt100.NewCanvas()
 		menu               = NewMenuWidget(title, choices, titleColor, arrowColor, textColor, highlightColor, selectedColor, c.W(), c.H(), extraDashes, selectionLetterMap)
+		bt                 = e.NewBoxTheme()
 		sigChan            = make(chan os.Signal, 1)
 		running            = true
 		changed            = true
 	)
 
+	// The menu is drawn inside a box with double borders
+	bt.SetBorderStyle(doubleBorders)
+	bt.Background = &bgColor
+	bt.UpperEdge = &arrowColor
+	bt.LowerEdge = &arrowColor
+
 	// Set up a new resize handler
 	signal.Notify(sigChan, syscall.SIGWINCH)
 
@@ -146,6 +153,7 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 			if nc != nil {
 				vt100.Clear()
 				c = nc
+				e.DrawBox(bt, c, menu.Frame())
 				menu.Draw(c)
 				c.Redraw()
 				changed = true
@@ -172,6 +180,7 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 
 		if changed {
 			resizeMut.RLock()
+			e.DrawBox(bt, c, menu.Frame())
 			menu.Draw(c)
 			resizeMut.RUnlock()
 
@@ -180,7 +189,7 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 		}
 
 		// Handle events
-		key := tty.String()
+		key := readKey(tty)
 		switch key {
 		case "↑", "←", "c:16": // Up, left or ctrl-p
 			resizeMut.Lock()
@@ -221,8 +230,8 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 			changed = true
 			resizeMut.Unlock()
 		default:
-			if len([]rune(key)) == 0 {
-				// this happens if pgup or pgdn is pressed
+			if len([]rune(key)) == 0 || isMouseKey(key) {
+				// this happens if pgup or pgdn is pressed, or for mouse events
 				break
 			}
 			// Check if the key matches the first letter (A-Z, a-z) in the choices
@@ -276,7 +285,7 @@ func (e *Editor) Menu(status *StatusBar, tty *vt100.TTY, title string, choices [
 
 	}
 
-	if menu.Selected() >= 0 {
+	if menu.Selected() >= 0 && !reduceMotion {
 		// Draw the selected item in a different color for a very short while
 		resizeMut.Lock()
 		menu.SelectDraw(c)
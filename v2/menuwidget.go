@@ -69,6 +69,24 @@ func (m *MenuWidget) Selected() int {
 	return m.selected
 }
 
+// Frame returns the box that is drawn around the title and the menu choices.
+// It may be partially outside of the canvas, if the margins are small.
+func (m *MenuWidget) Frame() *Box {
+	const titleHeight = 2
+	contentWidth := len([]rune(m.title))
+	for _, choice := range m.choices {
+		// the width of the arrow, the choice and the trailing space
+		if l := len([]rune(choice)) + 4; l > contentWidth {
+			contentWidth = l
+		}
+	}
+	if m.extraDashes && int(m.w) > contentWidth {
+		contentWidth = int(m.w)
+	}
+	// Leave room for the borders and one column of space on each side
+	return &Box{m.marginLeft - 2, m.marginTop - 1, contentWidth + 4, int(m.h) + titleHeight + 2}
+}
+
 // Draw will draw this menu widget on the given canvas
 func (m *MenuWidget) Draw(c *vt100.Canvas) {
 	// Draw the title
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// MixedEndings is the contents of a file with both CRLF and LF line endings, as it was loaded or last saved,
+// together with which of the lines ended with CRLF. This is used for keeping the line endings of the lines
+// that are unchanged, until the line endings are normalized by an explicit conversion.
+type MixedEndings struct {
+	lines []string // the lines, as they were loaded or saved, with LF line endings
+	crlf  []bool   // did line n end with CRLF? There is one entry per line break.
+}
+
+// crlfLineBreaks returns, for each line break in the given data, if it is CRLF.
+// A lone CR is loaded as a line break, but it is not kept when saving, so it counts as LF.
+func crlfLineBreaks(data []byte) []bool {
+	crlf := make([]bool, 0, bytes.Count(data, []byte{'\n'}))
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			crlf = append(crlf, true)
+			i++
+		case data[i] == '\r' || data[i] == '\n':
+			crlf = append(crlf, false)
+		}
+	}
+	return crlf
+}
+
+// newMixedEndings returns the line endings of a file with mixed line endings, where text is the
+// contents with LF line endings, as they are loaded, and crlf is the result of crlfLineBreaks
+func newMixedEndings(text []byte, crlf []bool) *MixedEndings {
+	lines := strings.Split(string(text), "\n")
+	if len(crlf) != len(lines)-1 { // the opinionated replacements should never change the number of lines
+		return nil
+	}
+	return &MixedEndings{lines, crlf}
+}
+
+// Apply adds line endings to the given text, which has LF line endings. The lines that are the same at the start
+// and at the end, compared to the lines that were loaded or saved, keep their line endings, while the lines in
+// between get CRLF or LF, depending on dominantCRLF. Returns the text with the line endings, and the mixed line
+// endings that should be used the next time, if the text is saved.
+func (me *MixedEndings) Apply(text []byte, dominantCRLF bool) ([]byte, *MixedEndings) {
+	lines := strings.Split(string(text), "\n")
+	prefix := 0
+	for prefix < len(lines) && prefix < len(me.lines) && lines[prefix] == me.lines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(lines)-prefix && suffix < len(me.lines)-prefix && lines[len(lines)-1-suffix] == me.lines[len(me.lines)-1-suffix] {
+		suffix++
+	}
+	var (
+		buf   bytes.Buffer
+		crlf  = make([]bool, len(lines)-1)
+		delta = len(me.lines) - len(lines) // the difference in line indices, for the lines at the end
+	)
+	for i, line := range lines {
+		buf.WriteString(line)
+		if i == len(crlf) {
+			break
+		}
+		switch {
+		case i < prefix && i < len(me.crlf):
+			crlf[i] = me.crlf[i]
+		case i >= len(lines)-suffix && i+delta < len(me.crlf):
+			crlf[i] = me.crlf[i+delta]
+		default:
+			crlf[i] = dominantCRLF
+		}
+		if crlf[i] {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), &MixedEndings{lines, crlf}
+}
+
+// encode converts the text that is about to be saved to the text format of the file. For a file with mixed line
+// endings, the lines that are unchanged since the file was loaded or saved keep their line endings.
+// Returns the encoded data, and the mixed line endings that should be remembered if the data is saved, if any.
+func (e *Editor) encode(s string) ([]byte, *MixedEndings, error) {
+	tf := e.textFormat
+	text := []byte(s)
+	var mixedEndings *MixedEndings
+	if tf.mixed && e.mixedEndings != nil {
+		text, mixedEndings = e.mixedEndings.Apply(text, tf.crlf)
+		tf.crlf = false // the line endings are already in place
+	}
+	data, err := tf.Encode(text)
+	return data, mixedEndings, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMixedEndingsApply(t *testing.T) {
+	original := []byte("a\r\nb\nc\r\nd\r\n")
+	text := []byte("a\nb\nc\nd\n")
+	me := newMixedEndings(text, crlfLineBreaks(original))
+	if me == nil {
+		t.Fatal("expected the line endings to be recorded")
+	}
+	if data, _ := me.Apply(text, true); string(data) != string(original) {
+		t.Errorf("expected unchanged lines to keep their line endings, got %q", data)
+	}
+	// Changed and inserted lines get the dominant line ending, while the lines around them are kept
+	data, next := me.Apply([]byte("a\nB\nnew\nc\nd\n"), true)
+	if string(data) != "a\r\nB\r\nnew\r\nc\r\nd\r\n" {
+		t.Errorf("expected the changed lines to get CRLF, got %q", data)
+	}
+	data, _ = me.Apply([]byte("a\nc\nd\n"), false)
+	if string(data) != "a\r\nc\r\nd\r\n" {
+		t.Errorf("expected the lines after a removed line to keep their line endings, got %q", data)
+	}
+	// The next time, the lines are compared with what was saved
+	if data, _ := next.Apply([]byte("a\nB\nnew\nc\nd\n"), false); string(data) != "a\r\nB\r\nnew\r\nc\r\nd\r\n" {
+		t.Errorf("expected the saved line endings to be kept, got %q", data)
+	}
+	// A lone CR counts as a line break, but not as CRLF
+	if crlf := crlfLineBreaks([]byte("a\rb\r\nc\n")); len(crlf) != 3 || crlf[0] || !crlf[1] || crlf[2] {
+		t.Errorf("unexpected line breaks: %v", crlf)
+	}
+}
+
+func TestMixedEndingsSave(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mixed.txt")
+	if err := os.WriteFile(filename, []byte("one\r\ntwo\nthree\r\nfour\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	if tf := e.textFormat.String(); tf != "UTF-8 CRLF (mixed)" {
+		t.Errorf("expected mixed CRLF line endings to be detected, got %s", tf)
+	}
+	e.SetLine(3, "FOUR")
+	e.InsertLines(4, []string{"five"}, nil)
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "one\r\ntwo\nthree\r\nFOUR\r\nfive\r\n" {
+		t.Errorf("expected only the changed lines to get the dominant line ending, got %q", data)
+	}
+
+	// Normalizing the line endings is an explicit conversion
+	for _, conversion := range textFormatConversions {
+		if conversion.applies(e.textFormat) && conversion.title == "Normalize line endings to CRLF" {
+			if data, _, _ := e.encode(e.String()); conversion.count(data) != 1 {
+				t.Errorf("expected 1 affected line, got %d", conversion.count(data))
+			}
+			conversion.apply(&e.textFormat)
+		}
+	}
+	if e.textFormat.mixed {
+		t.Fatal("expected the line endings to be normalized")
+	}
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "one\r\ntwo\r\nthree\r\nFOUR\r\nfive\r\n" {
+		t.Errorf("expected all lines to end with CRLF, got %q", data)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNoMixedIndentation = errors.New("no lines that are indented differently from the rest of the file")
+
+// MixedIndentation checks if some lines were indented with tabs and others with spaces, when the file was loaded
+func (e *Editor) MixedIndentation() bool {
+	return e.tabIndentCount > 0 && e.spaceIndentCount > 0
+}
+
+// mixedIndentationMessage describes how many lines were indented with tabs and with spaces
+func (e *Editor) mixedIndentationMessage() string {
+	return fmt.Sprintf("mixed indentation: %d lines with tabs, %d with spaces", e.tabIndentCount, e.spaceIndentCount)
+}
+
+// wrongIndentation checks if the leading whitespace of the given line differs from the indentation of the file,
+// which is tabs or spaces, as detected when loading. Spaces after tabs are allowed, for alignment.
+func (e *Editor) wrongIndentation(line string) bool {
+	whitespace := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	if e.indentation.Spaces {
+		return strings.Contains(whitespace, "\t")
+	}
+	return strings.HasPrefix(whitespace, "  ")
+}
+
+// NextMixedIndentation moves the cursor to the next line that is not indented like the rest of the file,
+// wrapping around at the end of the file
+func (e *Editor) NextMixedIndentation(c *vt100.Canvas, status *StatusBar) error {
+	y, l := e.DataY(), e.Len()
+	for i := 1; i <= l; i++ {
+		next := LineIndex((int(y) + i) % l)
+		if e.wrongIndentation(e.Line(next)) {
+			e.GoTo(next, c, status)
+			e.Home()
+			e.redraw = true
+			e.redrawCursor = true
+			return nil
+		}
+	}
+	return errNoMixedIndentation
+}
+
+// WriteMixedIndentation marks the leading whitespace of the lines that are not indented like the rest of the file,
+// with "→" for tabs and "·" for spaces
+func (e *Editor) WriteMixedIndentation(c *vt100.Canvas, fromline LineIndex, numLines, cx, cy uint) {
+	if e.indentation.PerTab < 1 {
+		return
+	}
+	fg := e.MultiLineComment
+	if envNoColor {
+		fg = e.Foreground
+	}
+	cw := c.Width()
+	for i := uint(0); i < numLines; i++ {
+		y := fromline + LineIndex(i)
+		if int(y) >= e.Len() {
+			break
+		}
+		line := e.Line(y)
+		if !e.wrongIndentation(line) {
+			continue
+		}
+		screenX := -e.pos.offsetX
+		for _, r := range line {
+			var mark string
+			switch r {
+			case '\t':
+				mark = "→" + strings.Repeat(" ", e.indentation.PerTab-1)
+			case ' ':
+				mark = "·"
+			}
+			if mark == "" {
+				break
+			}
+			for _, m := range mark {
+				if screenX >= 0 && uint(screenX)+cx < cw {
+					c.WriteRune(cx+uint(screenX), cy+i, fg, e.Background, m)
+				}
+				screenX++
+			}
+		}
+	}
+}
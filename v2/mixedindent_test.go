@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMixedIndentation(t *testing.T) {
+	discardStdout(t)
+	c, e, status := newTestEditor("func main() {\n\tf()\n\tg()\n    h()\n\t  i()\n}\n")
+	if !e.MixedIndentation() || e.tabIndentCount != 3 || e.spaceIndentCount != 1 {
+		t.Fatalf("expected 3 lines with tabs and 1 with spaces, got %d and %d", e.tabIndentCount, e.spaceIndentCount)
+	}
+	if e.indentation.Spaces {
+		t.Fatal("expected tabs to be detected")
+	}
+	// Spaces after a tab are used for alignment, and are not mixed indentation
+	if err := e.NextMixedIndentation(c, status); err != nil || e.DataY() != 3 {
+		t.Errorf("expected to jump to line index 3, got %d (%v)", e.DataY(), err)
+	}
+	if err := e.NextMixedIndentation(c, status); err != nil || e.DataY() != 3 {
+		t.Errorf("expected to wrap around to line index 3, got %d (%v)", e.DataY(), err)
+	}
+
+	e.LoadBytes([]byte("if x:\n    f()\n"))
+	if e.MixedIndentation() {
+		t.Error("expected no mixed indentation")
+	}
+	if err := e.NextMixedIndentation(c, status); err != errNoMixedIndentation {
+		t.Errorf("expected errNoMixedIndentation, got %v", err)
+	}
+}
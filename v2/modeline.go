@@ -0,0 +1,230 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/mode"
+)
+
+// modelineLines is how many lines at the start and at the end of a file are searched for a modeline
+const modelineLines = 5
+
+var (
+	// vimModeline matches "vim:", "vi:", "Vim:" and "ex:", optionally with a version number, like "vim700:"
+	vimModeline = regexp.MustCompile(`(^|\s)(vim?|Vim|ex)([<=>]?\d+)?:\s*(.*)$`)
+
+	// emacsModeline matches the variables between the -*- markers
+	emacsModeline = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+
+	// modelineFiletypes maps Vim filetypes and Emacs modes to a filename that mode.Detect recognizes,
+	// for the names that are not also file extensions
+	modelineFiletypes = map[string]string{
+		"bash":         "modeline.sh",
+		"c++":          "modeline.cpp",
+		"conf":         "modeline.conf",
+		"cpp":          "modeline.cpp",
+		"csharp":       "modeline.cs",
+		"dosini":       "modeline.ini",
+		"elisp":        "modeline.el",
+		"emacs-lisp":   "modeline.el",
+		"erlang":       "modeline.erl",
+		"gitcommit":    "COMMIT_EDITMSG",
+		"haskell":      "modeline.hs",
+		"javascript":   "modeline.js",
+		"js":           "modeline.js",
+		"make":         "Makefile",
+		"makefile":     "Makefile",
+		"markdown":     "modeline.md",
+		"nroff":        "modeline.1",
+		"perl":         "modeline.pl",
+		"python":       "modeline.py",
+		"rust":         "modeline.rs",
+		"shell-script": "modeline.sh",
+		"text":         "modeline.txt",
+		"typescript":   "modeline.ts",
+		"yaml":         "modeline.yml",
+		"zsh":          "modeline.sh",
+	}
+)
+
+// Modeline contains the settings from a Vim or Emacs modeline, like "# vim: set ts=2 sw=2 et:"
+type Modeline struct {
+	perTab    int       // the indentation width, or 0 if not set
+	spaces    bool      // indent with spaces instead of tabs
+	spacesSet bool      // was "spaces" set by the modeline?
+	m         mode.Mode // the file type
+	modeSet   bool      // was the file type set by the modeline?
+}
+
+// positiveWidth parses an indentation width, and returns 0 if it is not a number in a sensible range
+func positiveWidth(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 || n > 16 {
+		return 0
+	}
+	return n
+}
+
+// modelineMode returns the editor mode for a Vim filetype or an Emacs mode name
+func modelineMode(name string) (mode.Mode, bool) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), "-mode")
+	if name == "" {
+		return mode.Blank, false
+	}
+	filename, ok := modelineFiletypes[name]
+	if !ok {
+		filename = "modeline." + name
+	}
+	m := mode.Detect(filename)
+	return m, m != mode.Blank
+}
+
+// parseVimModeline parses a Vim modeline, like "vim: set ts=2 sw=2 et:" or "vi: ts=4 noet"
+func parseVimModeline(line string) (Modeline, bool) {
+	var ml Modeline
+	matches := vimModeline.FindStringSubmatch(line)
+	if matches == nil {
+		return ml, false
+	}
+	rest := matches[4]
+	var options []string
+	if strings.HasPrefix(rest, "set ") || strings.HasPrefix(rest, "se ") {
+		// The "set" form ends at the next colon, and the options are separated by spaces
+		rest = rest[strings.Index(rest, " ")+1:]
+		end := strings.Index(rest, ":")
+		if end == -1 {
+			return ml, false
+		}
+		options = strings.Fields(rest[:end])
+	} else {
+		// The options are separated by spaces or colons
+		options = strings.FieldsFunc(rest, func(r rune) bool { return r == ':' || r == ' ' || r == '\t' })
+	}
+	var tabStop, shiftWidth int
+	found := false
+	for _, option := range options {
+		name, value, hasValue := strings.Cut(option, "=")
+		switch {
+		case hasValue && (name == "ts" || name == "tabstop"):
+			tabStop = positiveWidth(value)
+			found = found || tabStop > 0
+		case hasValue && (name == "sw" || name == "shiftwidth"):
+			shiftWidth = positiveWidth(value)
+			found = found || shiftWidth > 0
+		case hasValue && (name == "ft" || name == "filetype" || name == "syn" || name == "syntax"):
+			if m, ok := modelineMode(value); ok {
+				ml.m, ml.modeSet = m, true
+				found = true
+			}
+		case !hasValue && (name == "et" || name == "expandtab"):
+			ml.spaces, ml.spacesSet = true, true
+			found = true
+		case !hasValue && (name == "noet" || name == "noexpandtab"):
+			ml.spaces, ml.spacesSet = false, true
+			found = true
+		}
+	}
+	// The shift width is the indentation width, when it is set
+	ml.perTab = tabStop
+	if shiftWidth > 0 {
+		ml.perTab = shiftWidth
+	}
+	return ml, found
+}
+
+// parseEmacsModeline parses an Emacs modeline, like "-*- mode: python; tab-width: 8; indent-tabs-mode: nil -*-" or "-*- python -*-"
+func parseEmacsModeline(line string) (Modeline, bool) {
+	var ml Modeline
+	matches := emacsModeline.FindStringSubmatch(line)
+	if matches == nil {
+		return ml, false
+	}
+	if !strings.Contains(matches[1], ":") {
+		// Only the mode is given
+		if m, ok := modelineMode(matches[1]); ok {
+			ml.m, ml.modeSet = m, true
+			return ml, true
+		}
+		return ml, false
+	}
+	found := false
+	for _, variable := range strings.Split(matches[1], ";") {
+		name, value, ok := strings.Cut(variable, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "mode":
+			if m, ok := modelineMode(value); ok {
+				ml.m, ml.modeSet = m, true
+				found = true
+			}
+		case "tab-width":
+			if n := positiveWidth(value); n > 0 {
+				ml.perTab = n
+				found = true
+			}
+		case "indent-tabs-mode":
+			if value == "nil" || value == "t" {
+				ml.spaces, ml.spacesSet = value == "nil", true
+				found = true
+			}
+		}
+	}
+	return ml, found
+}
+
+// parseModeline parses a Vim or an Emacs modeline in the given line
+func parseModeline(line string) (Modeline, bool) {
+	if ml, ok := parseEmacsModeline(line); ok {
+		return ml, true
+	}
+	return parseVimModeline(line)
+}
+
+// FindModeline looks for a Vim or Emacs modeline in the first and the last lines of the file.
+// Returns nil if there is none, or if it could not be parsed.
+func (e *Editor) FindModeline() *Modeline {
+	l := e.Len()
+	for i := 0; i < l; i++ {
+		if i == modelineLines && l-modelineLines > i {
+			// Skip to the last lines
+			i = l - modelineLines
+		}
+		if ml, ok := parseModeline(e.Line(LineIndex(i))); ok {
+			return &ml
+		}
+	}
+	return nil
+}
+
+// ApplyModeline uses the file type and the indentation from the modeline that was found when loading, if any.
+// Returns true if the indentation settings were changed.
+func (e *Editor) ApplyModeline() bool {
+	ml := e.modeline
+	if ml == nil {
+		return false
+	}
+	if ml.modeSet {
+		e.mode = ml.m
+	}
+	before := e.indentation
+	if ml.perTab > 0 {
+		e.indentation.PerTab = ml.perTab
+	}
+	if ml.spacesSet {
+		e.indentation.Spaces = ml.spaces
+	}
+	return e.indentation != before
+}
+
+// modelineIndentationMessage describes the indentation that was set by a modeline
+func (e *Editor) modelineIndentationMessage() string {
+	if !e.indentation.Spaces {
+		return "indentation from the modeline: tabs"
+	}
+	return "indentation from the modeline: " + strconv.Itoa(e.indentation.PerTab) + " spaces"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestParseModeline(t *testing.T) {
+	tests := []struct {
+		line     string
+		ok       bool
+		expected Modeline
+	}{
+		{"# vim: set ts=2 sw=2 et:", true, Modeline{perTab: 2, spaces: true, spacesSet: true}},
+		{"// vim: ts=8 noet", true, Modeline{perTab: 8, spacesSet: true}},
+		{"/* vi:set ts=4 ft=python: */", true, Modeline{perTab: 4, m: mode.Python, modeSet: true}},
+		{"# vim700: sw=3:ts=8", true, Modeline{perTab: 3}},
+		{"; -*- mode: python; tab-width: 8; indent-tabs-mode: nil -*-", true, Modeline{perTab: 8, spaces: true, spacesSet: true, m: mode.Python, modeSet: true}},
+		{"# -*- makefile -*-", true, Modeline{m: mode.Make, modeSet: true}},
+		{"-*- coding: utf-8 -*-", false, Modeline{}},
+		{"# vim: set ts=two:", false, Modeline{}},
+		{"# vim: set ts=2", false, Modeline{}},
+		{"# vim: ts=1000", false, Modeline{}},
+		{"# navim: ts=2", false, Modeline{}},
+		{"# -*- tab-width: -1 -*-", false, Modeline{}},
+	}
+	for _, test := range tests {
+		ml, ok := parseModeline(test.line)
+		if ok != test.ok || (ok && ml != test.expected) {
+			t.Errorf("%q: expected %v %+v, got %v %+v", test.line, test.ok, test.expected, ok, ml)
+		}
+	}
+}
+
+func TestFindModeline(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	e := NewSimpleEditor(80)
+
+	// A modeline in the middle of the file is not used
+	lines[10] = "# vim: set ts=2 sw=2 et:"
+	e.LoadBytes([]byte(strings.Join(lines, "\n")))
+	if ml := e.FindModeline(); ml != nil {
+		t.Errorf("expected no modeline, got %+v", *ml)
+	}
+
+	// But it is used in the last five lines
+	lines[10] = "line 10"
+	lines[16] = "# vim: set ts=2 sw=2 et:"
+	e.LoadBytes([]byte(strings.Join(lines, "\n")))
+	if ml := e.FindModeline(); ml == nil || ml.perTab != 2 {
+		t.Errorf("expected the modeline at the end of the file to be found, got %v", ml)
+	}
+}
+
+func TestLoadModeline(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script")
+	data := "#!/bin/sh\n# -*- mode: python; tab-width: 2; indent-tabs-mode: nil -*-\n\tprint('hi')\n"
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	if e.mode != mode.Python || e.indentation.PerTab != 2 || !e.indentation.Spaces {
+		t.Errorf("expected the modeline to set Python mode with 2 spaces, got %s and %+v", e.mode, e.indentation)
+	}
+	if msg := e.modelineIndentationMessage(); msg != "indentation from the modeline: 2 spaces" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// keyMousePrefix is the start of the key strings for mouse events, like "m:0:12:3" for a left click
+	// at column 12 and row 3, counted from 0
+	keyMousePrefix = "m:"
+
+	// Button numbers, as used by xterm mouse reporting
+	mouseButtonLeft      = 0
+	mouseButtonWheelUp   = 64
+	mouseButtonWheelDown = 65
+
+	// mouseMotionFlag is set in the button number when the mouse is moved while a button is held down
+	mouseMotionFlag = 32
+
+	// mouseWheelScrollLines is how many lines one step of the scroll wheel scrolls
+	mouseWheelScrollLines = 3
+)
+
+// useMouse is true if the terminal emulator should report mouse clicks and scroll wheel events.
+// When it is false, the terminal emulator can select text with the mouse, as usual.
+var useMouse = true
+
+// MouseEvent is a mouse button press or scroll wheel event, at a position on the screen
+type MouseEvent struct {
+	button int
+	x, y   int // counted from 0
+}
+
+// mouseKey returns the key string for a mouse event, for the given button and the 1-based column and row
+// that the terminal emulator reported. An empty string is returned for events that o does not use,
+// like button releases and mouse movement.
+func mouseKey(button, column, row int, pressed bool) string {
+	if !pressed || button&mouseMotionFlag != 0 || column < 1 || row < 1 {
+		return ""
+	}
+	return fmt.Sprintf("%s%d:%d:%d", keyMousePrefix, button, column-1, row-1)
+}
+
+// decodeMouseKey decodes a mouse event escape sequence at the start of the given bytes, either in the SGR format,
+// ESC [ < button ; column ; row M (or m for a release), or in the X10 format, ESC [ M followed by three bytes.
+// Returns the key string, which may be empty for ignored events, the number of bytes used and true,
+// or false if the bytes do not start with a mouse event.
+func decodeMouseKey(bs []byte) (string, int, bool) {
+	s := string(bs)
+	switch {
+	case strings.HasPrefix(s, "\x1b[<"):
+		end := strings.IndexAny(s, "Mm")
+		if end < 0 {
+			return "", len(bs), true
+		}
+		fields := strings.Split(s[3:end], ";")
+		if len(fields) != 3 {
+			return "", end + 1, true
+		}
+		var numbers [3]int
+		for i, field := range fields {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return "", end + 1, true
+			}
+			numbers[i] = n
+		}
+		return mouseKey(numbers[0], numbers[1], numbers[2], s[end] == 'M'), end + 1, true
+	case strings.HasPrefix(s, "\x1b[M") && len(bs) >= 6:
+		button := int(bs[3]) - 32
+		// Button 3 means that a button was released
+		return mouseKey(button, int(bs[4])-32, int(bs[5])-32, button&3 != 3), 6, true
+	}
+	return "", 0, false
+}
+
+// isMouseKey checks if the given key string is for a mouse event
+func isMouseKey(key string) bool {
+	return strings.HasPrefix(key, keyMousePrefix)
+}
+
+// parseMouseKey parses a key string for a mouse event, as returned by readKey
+func parseMouseKey(key string) (MouseEvent, bool) {
+	if !isMouseKey(key) {
+		return MouseEvent{}, false
+	}
+	fields := strings.Split(strings.TrimPrefix(key, keyMousePrefix), ":")
+	if len(fields) != 3 {
+		return MouseEvent{}, false
+	}
+	var numbers [3]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return MouseEvent{}, false
+		}
+		numbers[i] = n
+	}
+	return MouseEvent{numbers[0], numbers[1], numbers[2]}, true
+}
+
+// EnableMouse asks the terminal emulator to report mouse clicks and scroll wheel events, if useMouse is true
+func EnableMouse() {
+	if useMouse {
+		os.Stdout.WriteString("\033[?1000h\033[?1006h")
+	}
+}
+
+// DisableMouse asks the terminal emulator to stop reporting mouse events
+func DisableMouse() {
+	os.Stdout.WriteString("\033[?1006l\033[?1000l")
+}
+
+// dataXForScreenX returns the rune index in the given line that is shown at the given screen column,
+// when tabs are expanded to tabWidth columns and wide runes take up two columns. Columns after the end of the line
+// give the position right after the last rune, and columns within a tab or a wide rune give the position of that rune.
+func dataXForScreenX(line string, screenX, tabWidth int) int {
+	screenCounter, dataX := 0, 0
+	for _, r := range line {
+		width := runeWidth(r)
+		if r == '\t' {
+			width = tabWidth
+		}
+		if screenX < screenCounter+width {
+			return dataX
+		}
+		screenCounter += width
+		dataX++
+	}
+	return dataX
+}
+
+// HandleMouseEvent moves the cursor to the position that was clicked, or scrolls when the scroll wheel is used.
+// Returns true if the event was used.
+func (e *Editor) HandleMouseEvent(c *vt100.Canvas, status *StatusBar, ev MouseEvent) bool {
+	switch ev.button {
+	case mouseButtonWheelUp:
+		e.redraw = e.ScrollUp(c, status, mouseWheelScrollLines)
+	case mouseButtonWheelDown:
+		e.redraw = e.ScrollDown(c, status, mouseWheelScrollLines)
+	case mouseButtonLeft:
+		// The bottom line is used by the status bar, and the top rows by the column ruler, if it is shown
+		if e.Empty() || ev.y >= int(c.H())-1 || ev.y < e.topRows() {
+			return false
+		}
+		dataY := e.pos.offsetY + ev.y - e.topRows()
+		if lastIndex := e.Len() - 1; dataY > lastIndex {
+			dataY = lastIndex
+		}
+		if dataY < e.pos.offsetY {
+			return false
+		}
+		dataX := dataXForScreenX(e.Line(LineIndex(dataY)), ev.x+e.pos.offsetX, e.indentation.PerTab)
+		e.pos.sy = dataY - e.pos.offsetY
+		e.GoToDataX(c, dataX)
+		e.pos.savedX = e.pos.sx
+		e.redraw = true
+	default:
+		return false
+	}
+	e.redrawCursor = true
+	if e.AfterLineScreenContents() {
+		e.End(c)
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestParseMouseKey(t *testing.T) {
+	ev, ok := parseMouseKey("m:64:10:2")
+	if !ok || ev != (MouseEvent{mouseButtonWheelUp, 10, 2}) {
+		t.Errorf("unexpected mouse event: %v %v", ev, ok)
+	}
+	for _, key := range []string{"m", "m:1:2", "m:a:b:c", "c:13"} {
+		if _, ok := parseMouseKey(key); ok {
+			t.Errorf("%q should not be parsed as a mouse event", key)
+		}
+	}
+	if key := mouseKey(mouseButtonLeft|mouseMotionFlag, 5, 5, true); key != "" {
+		t.Errorf("mouse movement should be ignored, got %q", key)
+	}
+}
+
+func TestDataXForScreenX(t *testing.T) {
+	cases := []struct {
+		line    string
+		screenX int
+		dataX   int
+	}{
+		{"hello", 0, 0},
+		{"hello", 4, 4},
+		{"hello", 20, 5},
+		{"\tx", 0, 0},
+		{"\tx", 3, 0},
+		{"\tx", 4, 1},
+		{"a\tb", 5, 2},
+		{"æøå", 2, 2},
+	}
+	for _, c := range cases {
+		if dataX := dataXForScreenX(c.line, c.screenX, 4); dataX != c.dataX {
+			t.Errorf("%q at column %d: expected %d, got %d", c.line, c.screenX, c.dataX, dataX)
+		}
+	}
+}
+
+func TestHandleMouseEvent(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation.PerTab = 4
+	e.InsertStringAndMove(nil, "first\n\tsecond\nthird")
+	c := vt100.NewCanvas()
+	if !e.HandleMouseEvent(c, nil, MouseEvent{mouseButtonLeft, 6, 1}) {
+		t.Fatal("expected the click to be used")
+	}
+	if y, x := e.DataY(), e.pos.sx; y != 1 || x != 6 {
+		t.Errorf("expected the cursor at line index 1, column 6, got %d, %d", y, x)
+	}
+	if dataX, _ := e.DataX(); dataX != 3 {
+		t.Errorf("expected data position 3, got %d", dataX)
+	}
+	// Clicking below the last line goes to the last line
+	e.HandleMouseEvent(c, nil, MouseEvent{mouseButtonLeft, 1, 10})
+	if y := e.DataY(); y != 2 {
+		t.Errorf("expected the cursor at the last line, got line index %d", y)
+	}
+	// The column ruler takes up the top row
+	e.showRuler = true
+	if e.HandleMouseEvent(c, nil, MouseEvent{mouseButtonLeft, 1, 0}) {
+		t.Error("expected a click on the ruler to be ignored")
+	}
+	e.HandleMouseEvent(c, nil, MouseEvent{mouseButtonLeft, 1, 1})
+	if y := e.DataY(); y != 0 {
+		t.Errorf("expected the cursor at the first line, below the ruler, got line index %d", y)
+	}
+}
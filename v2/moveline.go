@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+// movedLineIndex returns where the line at index y ends up when the lines in r are moved one line up or down,
+// past the line above or below, which then ends up on the other side of r
+func movedLineIndex(y LineIndex, r Range, up bool) LineIndex {
+	switch {
+	case r.Contains(y) && up:
+		return y - 1
+	case r.Contains(y):
+		return y + 1
+	case up && y == r.From-1:
+		return r.To
+	case !up && y == r.To+1:
+		return r.From
+	}
+	return y
+}
+
+// moveToLine moves the position to the given line index, without changing the X position
+func (p *Position) moveToLine(y LineIndex) {
+	p.sy += int(y) - int(p.LineIndex())
+	if p.sy < 0 {
+		p.offsetY += p.sy
+		p.sy = 0
+	}
+}
+
+// SelectedLines returns the range of the selected lines, or of the current line if there is no selection.
+// A selection that ends at the start of a line does not include that line.
+func (e *Editor) SelectedLines() Range {
+	if !e.Selecting() {
+		return Range{e.DataY(), e.DataY()}
+	}
+	_, startY, endX, endY := e.SelectionRange()
+	if endX == 0 && endY > startY {
+		endY--
+	}
+	return Range{startY, endY}
+}
+
+// MoveLines moves the lines in the given range one line up or down, by deleting the line above or below
+// the range and inserting it on the other side. The cursor, the selection, the bookmark, the named bookmarks
+// and a portal to the same file follow the lines that are moved. Returns false if the lines can not be moved.
+func (e *Editor) MoveLines(c *vt100.Canvas, status *StatusBar, r Range, up bool, bookmark *Position) bool {
+	if r.Empty() || (up && r.From <= 0) || (!up && int(r.To)+1 >= e.Len()) {
+		return false
+	}
+
+	// Find where the tracked positions end up, before the lines are moved
+	var positions []*Position
+	if bookmark != nil {
+		positions = append(positions, bookmark)
+	}
+	for _, pos := range e.bookmarks {
+		positions = append(positions, pos)
+	}
+	targets := make([]LineIndex, len(positions))
+	for i, pos := range positions {
+		targets[i] = movedLineIndex(pos.LineIndex(), r, up)
+	}
+
+	// Move the line above the range to below it, or the line below the range to above it
+	past, at := r.To+1, r.From
+	if up {
+		past, at = r.From-1, r.To
+	}
+	line := e.Line(past)
+	e.DeleteLine(past)
+	e.insertLinesAt(int(at), 1)
+	e.SetLine(at, line)
+	e.changed = true
+
+	for i, pos := range positions {
+		pos.moveToLine(targets[i])
+	}
+	if e.sameFilePortal != nil {
+		e.sameFilePortal.lineNumber = movedLineIndex(e.sameFilePortal.LineIndex(), r, up).LineNumber()
+	}
+
+	// The cursor and the selection anchor are on the moved lines, or at the start of the line after them,
+	// and are moved together with the lines, keeping the same column
+	delta := LineIndex(1)
+	if up {
+		delta = -1
+	}
+	if e.selection != nil {
+		e.selection.y += delta
+	}
+	if y := e.DataY() + delta; int(y) < e.Len() {
+		sx, offsetX := e.pos.sx, e.pos.offsetX
+		e.GoTo(y, c, status)
+		e.pos.sx, e.pos.offsetX = sx, offsetX
+	} else {
+		// There is no line after the moved lines, so the end of the last line ends the selection
+		e.GoTo(y-1, c, status)
+		e.EndNoTrim(c)
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return true
+}
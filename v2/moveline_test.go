@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMoveLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\n\tb\nc\nd\n"))
+	e.pos.sy = 1
+	e.bookmarks['1'] = &Position{sy: 0}
+	bookmark := &Position{sy: 1}
+
+	if !e.MoveLines(nil, nil, e.SelectedLines(), true, bookmark) {
+		t.Fatal("expected the line to be moved up")
+	}
+	if s := e.String(); s != "\tb\na\nc\nd\n" {
+		t.Fatalf("unexpected contents after moving a line up: %q", s)
+	}
+	if e.DataY() != 0 || bookmark.LineIndex() != 0 || e.bookmarks['1'].LineIndex() != 1 {
+		t.Errorf("expected the cursor and bookmark to follow the line, and the named bookmark to follow \"a\", got %d, %d, %d", e.DataY(), bookmark.LineIndex(), e.bookmarks['1'].LineIndex())
+	}
+	if e.MoveLines(nil, nil, e.SelectedLines(), true, bookmark) {
+		t.Error("expected the first line to not be moved further up")
+	}
+
+	// Move the selected lines down, past the last line
+	e.GoTo(1, nil, nil)
+	e.Home()
+	e.StartSelection()
+	e.GoTo(3, nil, nil)
+	e.Home()
+	if r := e.SelectedLines(); r.From != 1 || r.To != 2 {
+		t.Fatalf("expected the selection to cover two lines, got %v", r)
+	}
+	if !e.MoveLines(nil, nil, e.SelectedLines(), false, nil) {
+		t.Fatal("expected the lines to be moved down")
+	}
+	if s := e.String(); s != "\tb\nd\na\nc\n" {
+		t.Errorf("unexpected contents after moving two lines down: %q", s)
+	}
+	if r := e.SelectedLines(); r.From != 2 || r.To != 3 {
+		t.Errorf("expected the selection to follow the lines, got %v", r)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/env"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// includeLine matches C and C++ include directives, like #include <stdio.h> or #include "config.h"
+	includeLine = regexp.MustCompile(`^\s*#\s*include\s*[<"]([^>"]+)[>"]`)
+
+	// systemIncludeDirectories are searched last, for C and C++ include directives
+	systemIncludeDirectories = []string{"/usr/local/include", "/usr/include"}
+
+	errNoPathAtCursor = errors.New("no filename at the cursor")
+)
+
+// isPathRune checks if the given rune can be part of a path, like "../include/config.h" or "src/main.rs:42:7"
+func isPathRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("\"'`<>()[]{},;|=", r)
+}
+
+// includePath returns the path from a C or C++ include directive, if the given line has one
+func includePath(line string) (string, bool) {
+	matches := includeLine.FindStringSubmatch(line)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// PathAtCursor returns the filename at the cursor, possibly followed by a line and column number,
+// or the included filename if the current line is an include directive in C or C++ mode.
+func (e *Editor) PathAtCursor() string {
+	if e.mode == mode.C || e.mode == mode.Cpp {
+		if path, ok := includePath(e.CurrentLine()); ok {
+			return path
+		}
+	}
+	runes, ok := e.lineRunes(int(e.DataY()))
+	if !ok || len(runes) == 0 {
+		return ""
+	}
+	x, err := e.DataX()
+	if err != nil || x >= len(runes) {
+		x = len(runes) - 1
+	}
+	if !isPathRune(runes[x]) {
+		return ""
+	}
+	start, end := x, x+1
+	for start > 0 && isPathRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isPathRune(runes[end]) {
+		end++
+	}
+	// Skip punctuation at the end of a sentence, or after a compiler error location
+	return strings.TrimRight(string(runes[start:end]), ".:")
+}
+
+// splitPathLocation splits a string like "src/main.rs:42:7" or "main.go+12" into a filename, a line number and a column number
+func splitPathLocation(s string) (string, LineNumber, ColNumber) {
+	fields := strings.Split(s, ":")
+	var numbers []string
+	for len(fields) > 1 && len(numbers) < 2 {
+		if _, err := strconv.Atoi(fields[len(fields)-1]); err != nil {
+			break
+		}
+		numbers = append([]string{fields[len(fields)-1]}, numbers...)
+		fields = fields[:len(fields)-1]
+	}
+	lineNumberString, colNumberString := "", ""
+	if len(numbers) > 0 {
+		lineNumberString = numbers[0]
+	}
+	if len(numbers) > 1 {
+		colNumberString = numbers[1]
+	}
+	return FilenameAndLineNumberAndColNumber(strings.Join(fields, ":"), lineNumberString, colNumberString)
+}
+
+// resolvePath finds an existing file with the given name, by first looking in each of the given directories,
+// unless the name is an absolute path. Returns the absolute path, or an error if no file was found.
+func resolvePath(name string, dirs ...string) (string, error) {
+	name = env.ExpandUser(name)
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if fileInfo, err := os.Stat(path); err == nil && !fileInfo.IsDir() {
+			return filepath.Abs(path)
+		}
+	}
+	return "", errors.New("found no " + name)
+}
+
+// resolveIncludePath finds the file for a C or C++ include directive, by also searching the current directory
+// and the parent directories in depth, and then the system include directories
+func resolveIncludePath(name, absFilename string, dirs ...string) (string, error) {
+	if path, err := resolvePath(name, dirs...); err == nil {
+		return path, nil
+	}
+	ext := filepath.Ext(name)
+	if ext != "" {
+		if path, err := ExtFileSearch(filepath.Join(filepath.Dir(absFilename), filepath.Base(name)), []string{ext}, fileSearchMaxTime); err == nil && strings.HasSuffix(filepath.ToSlash(path), "/"+strings.TrimPrefix(filepath.ToSlash(name), "./")) {
+			return path, nil
+		}
+	}
+	return resolvePath(name, systemIncludeDirectories...)
+}
+
+// OpenPathAtCursor opens the file at the cursor, and goes to the line and column number after the filename, if any.
+// Relative paths are resolved from the directory of the current file first, and then from the current directory.
+func (e *Editor) OpenPathAtCursor(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
+	s := e.PathAtCursor()
+	if s == "" {
+		return errNoPathAtCursor
+	}
+	filename, lineNumber, colNumber := splitPathLocation(s)
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	dirs := []string{filepath.Dir(absFilename)}
+	if workDir, err := os.Getwd(); err == nil {
+		dirs = append(dirs, workDir)
+	}
+	var path string
+	if _, ok := includePath(e.CurrentLine()); ok && (e.mode == mode.C || e.mode == mode.Cpp) {
+		path, err = resolveIncludePath(filename, absFilename, dirs...)
+	} else {
+		path, err = resolvePath(filename, dirs...)
+	}
+	if err != nil {
+		return err
+	}
+	if err := e.Switch(c, tty, status, lk, path, false); err != nil {
+		return err
+	}
+	if lineNumber > 0 {
+		if colNumber < 1 {
+			colNumber = 1
+		}
+		e.MoveToLineColumnNumber(c, status, int(lineNumber), int(colNumber), false)
+	}
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
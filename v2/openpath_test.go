@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestSplitPathLocation(t *testing.T) {
+	tests := []struct {
+		s        string
+		filename string
+		line     LineNumber
+		col      ColNumber
+	}{
+		{"../include/config.h", "../include/config.h", 0, 0},
+		{"src/main.rs:42", "src/main.rs", 42, 0},
+		{"src/main.rs:42:7", "src/main.rs", 42, 7},
+		{"main.go+12", "main.go", 12, 0},
+		{"C:notes.txt:3", "C:notes.txt", 3, 0},
+	}
+	for _, test := range tests {
+		filename, line, col := splitPathLocation(test.s)
+		if filename != test.filename || line != test.line || col != test.col {
+			t.Errorf("%q: expected %s %d %d, got %s %d %d", test.s, test.filename, test.line, test.col, filename, line, col)
+		}
+	}
+}
+
+func TestPathAtCursor(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("see (src/main.rs:42:7), for details.\n#include <sys/types.h>\n"))
+	e.pos.sx = 10
+	if path := e.PathAtCursor(); path != "src/main.rs:42:7" {
+		t.Errorf("expected the path in the parentheses, got %q", path)
+	}
+	e.pos.sx = 3
+	if path := e.PathAtCursor(); path != "" {
+		t.Errorf("expected no path at a space, got %q", path)
+	}
+	e.pos.sy = 1
+	if path := e.PathAtCursor(); path != "#include" {
+		t.Errorf("expected the word at the cursor outside of C mode, got %q", path)
+	}
+	e.mode = mode.C
+	if path := e.PathAtCursor(); path != "sys/types.h" {
+		t.Errorf("expected the included file in C mode, got %q", path)
+	}
+}
+
+func TestOpenPathAtCursor(t *testing.T) {
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{
+		"src/tmp.main.c":        "#include \"util/tmp.config.h\"\nsee ../tmp.notes.txt:2:3\n",
+		"src/util/tmp.config.h": "#define X 1\n",
+		"tmp.notes.txt":         "one\ntwo words\n",
+	})
+	c, e, status := openTestEditor(t, filepath.Join(dir, "src", "tmp.main.c"))
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+
+	// A relative path is resolved from the directory of the current file, with the line and column number
+	e.GoToLineNumber(2, c, status, false)
+	e.pos.sx = 6
+	if err := e.OpenPathAtCursor(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != filepath.Join(dir, "tmp.notes.txt") || e.LineNumber() != 2 || e.ColNumber() != 3 {
+		t.Errorf("expected tmp.notes.txt at line 2, column 3, got %s at %d, %d", e.filename, e.LineNumber(), e.ColNumber())
+	}
+
+	// An include directive is resolved regardless of where the cursor is on the line
+	if err := e.Switch(c, nil, status, lk, filepath.Join(dir, "src", "tmp.main.c"), false); err != nil {
+		t.Fatal(err)
+	}
+	e.GoToLineNumber(1, c, status, false)
+	if err := e.OpenPathAtCursor(c, nil, status, lk); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != filepath.Join(dir, "src", "util", "tmp.config.h") {
+		t.Errorf("expected the included file to be opened, got %s", e.filename)
+	}
+
+	if _, err := resolvePath("missing.txt", dir); err == nil {
+		t.Error("expected an error for a file that does not exist")
+	}
+}
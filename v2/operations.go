@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// operationTickInterval is how often the operation segment in the status bar is updated
+const operationTickInterval = 250 * time.Millisecond
+
+// operationGlyphs are the frames of the small spinner that is shown next to the name of the current operation
+var operationGlyphs = []rune{'|', '/', '-', '\\'}
+
+// operations is the registry that long running operations, like building or formatting, register with
+var operations = NewOperationRegistry()
+
+// operation is a long running operation that has been registered
+type operation struct {
+	name    string
+	started time.Time
+}
+
+// OperationRegistry keeps track of the long running operations that are currently active,
+// so that they can be shown in the status bar. It is safe for concurrent use.
+type OperationRegistry struct {
+	mut    sync.RWMutex
+	active map[uint64]operation
+	nextID uint64
+}
+
+// NewOperationRegistry creates a new registry without any active operations
+func NewOperationRegistry() *OperationRegistry {
+	return &OperationRegistry{active: make(map[uint64]operation)}
+}
+
+// Start registers an active operation with the given name, like "building", and returns a function
+// that must be called when the operation is done. Calling the returned function more than once is fine.
+func (r *OperationRegistry) Start(name string) func() {
+	r.mut.Lock()
+	id := r.nextID
+	r.nextID++
+	r.active[id] = operation{name, time.Now()}
+	r.mut.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mut.Lock()
+			delete(r.active, id)
+			r.mut.Unlock()
+		})
+	}
+}
+
+// Len returns the number of active operations
+func (r *OperationRegistry) Len() int {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return len(r.active)
+}
+
+// Current returns the name and start time of the most recently started operation that is still active
+func (r *OperationRegistry) Current() (string, time.Time, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	var (
+		current operation
+		found   bool
+		maxID   uint64
+	)
+	for id, op := range r.active {
+		if !found || id > maxID {
+			current, maxID, found = op, id, true
+		}
+	}
+	return current.name, current.started, found
+}
+
+// formatElapsed formats a duration as seconds, or as minutes and seconds, like "7s" or "2m05s"
+func formatElapsed(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds < 60 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	return fmt.Sprintf("%dm%02ds", seconds/60, seconds%60)
+}
+
+// operationSegment returns the text for the right side of the status bar. If an operation is active, it is
+// a spinner glyph for the given frame, the name of the operation and the elapsed time.
+// If not, it is the time of day if the clock is enabled, or else an empty string.
+func operationSegment(r *OperationRegistry, now time.Time, frame int, clock bool) string {
+	name, started, ok := r.Current()
+	if !ok {
+		if clock {
+			return now.Format("15:04")
+		}
+		return ""
+	}
+	glyph := operationGlyphs[frame%len(operationGlyphs)]
+	if reduceMotion {
+		glyph = '*'
+	}
+	s := fmt.Sprintf("%c %s %s", glyph, name, formatElapsed(now.Sub(started)))
+	if n := r.Len(); n > 1 {
+		s += fmt.Sprintf(" (+%d)", n-1)
+	}
+	return s
+}
+
+// DrawOperationSegment draws the given operation segment text at the right side of the bottom line
+func (e *Editor) DrawOperationSegment(c *vt100.Canvas, text string) {
+	w := int(c.W())
+	if text == "" || terminalTooSmall(c.W(), c.H()) {
+		return
+	}
+	// Leave most of the bottom line to the regular status messages
+	text = fitString(" "+text+" ", w/3)
+	c.Write(uint(w-utf8.RuneCountInString(text)), c.H()-1, e.StatusForeground, e.StatusBackground, text)
+}
+
+// operationWatcher is the state of the operation segment, as last drawn by the key loop
+type operationWatcher struct {
+	frame    int
+	lastText string
+}
+
+// WatchOperations updates the operation segment in the status bar while operations are active,
+// and the clock, if it is enabled. Lines that were drawn without syntax highlighting, because drawing took
+// too long, are highlighted when the editor is idle. It should be run in a goroutine, and never returns.
+// The drawing is done by the key loop, between keypresses, so that menus and prompts are left alone.
+func (e *Editor) WatchOperations(c *vt100.Canvas) {
+	ow := &operationWatcher{}
+	for range time.Tick(operationTickInterval) {
+		runInKeyLoop(func() {
+			e.updateOperationSegment(c, ow)
+		})
+	}
+}
+
+// updateOperationSegment draws the next frame of the operation segment, if it has changed,
+// and the lines with deferred syntax highlighting. It must only be called by the key loop.
+func (e *Editor) updateOperationSegment(c *vt100.Canvas, ow *operationWatcher) {
+	ow.frame++
+	if e.HighlightDeferred(operationTickInterval) && !e.overlayShown {
+		e.WriteDeferredHighlight(c)
+		c.Draw()
+	}
+	text := operationSegment(operations, time.Now(), ow.frame, showClock)
+	if text == ow.lastText {
+		return
+	}
+	if text == "" && e.overlayShown {
+		// Remove the segment when the overlay is gone, instead of drawing the lines on top of it
+		return
+	}
+	if text == "" {
+		// The last operation is done, so remove the segment by drawing the editor lines again
+		h := int(c.H())
+		offsetY := e.pos.OffsetY()
+		e.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0)
+	} else {
+		e.DrawOperationSegment(c, text)
+	}
+	c.Draw()
+	ow.lastText = text
+}
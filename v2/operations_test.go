@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOperationRegistry(t *testing.T) {
+	r := NewOperationRegistry()
+	if _, _, ok := r.Current(); ok {
+		t.Fatal("expected no active operation")
+	}
+	doneBuilding := r.Start("building")
+	doneFormatting := r.Start("formatting")
+	if name, _, _ := r.Current(); name != "formatting" || r.Len() != 2 {
+		t.Errorf("expected formatting to be the current of 2 operations, got %q of %d", name, r.Len())
+	}
+	doneFormatting()
+	doneFormatting() // calling it twice is fine
+	if name, _, _ := r.Current(); name != "building" || r.Len() != 1 {
+		t.Errorf("expected building to be the only operation, got %q of %d", name, r.Len())
+	}
+	doneBuilding()
+	if r.Len() != 0 {
+		t.Errorf("expected no active operations, got %d", r.Len())
+	}
+}
+
+func TestOperationRegistryConcurrent(t *testing.T) {
+	r := NewOperationRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := r.Start("searching")
+			r.Current()
+			r.Len()
+			done()
+		}()
+	}
+	wg.Wait()
+	if r.Len() != 0 {
+		t.Errorf("expected no active operations, got %d", r.Len())
+	}
+}
+
+func TestOperationSegment(t *testing.T) {
+	r := NewOperationRegistry()
+	now := time.Date(2023, 4, 5, 9, 7, 0, 0, time.Local)
+	if s := operationSegment(r, now, 0, false); s != "" {
+		t.Errorf("expected an empty segment when idle, got %q", s)
+	}
+	if s := operationSegment(r, now, 0, true); s != "09:07" {
+		t.Errorf("expected the clock when idle, got %q", s)
+	}
+	defer r.Start("building")()
+	s := operationSegment(r, time.Now().Add(3*time.Second), 1, true)
+	if !strings.HasPrefix(s, "/ building 3s") && !strings.HasPrefix(s, "/ building 2s") {
+		t.Errorf("unexpected segment: %q", s)
+	}
+	if got := formatElapsed(125 * time.Second); got != "2m05s" {
+		t.Errorf("expected 2m05s, got %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/env"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// maxOSC52Bytes is how much text can be copied with OSC 52. Many terminal emulators ignore
+	// sequences that are longer than around 100 KB, and the text grows by a third when base64 encoded.
+	maxOSC52Bytes = 74 * 1024
+
+	// osc52QuerySequence asks the terminal emulator for the contents of the clipboard
+	osc52QuerySequence = "\033]52;c;?\a"
+
+	// osc52ResponseTimeout is how long to wait for the terminal emulator to respond with the clipboard contents
+	osc52ResponseTimeout = 300 * time.Millisecond
+)
+
+var (
+	// osc52Paste is true if the clipboard of the terminal emulator should be read with OSC 52 when pasting over ssh.
+	// Not all terminal emulators support this, and those that do may ask the user first.
+	osc52Paste bool
+
+	// osc52ReplyLate is true if the terminal emulator did not respond in time, so that the response may arrive later,
+	// together with the keys that are pressed. osc52SkippingReply is true while the rest of such a response is skipped,
+	// and osc52ReplyEsc is true if the last skipped byte was ESC, which may be the start of the terminator.
+	osc52ReplyLate, osc52SkippingReply, osc52ReplyEsc bool
+
+	errOSC52Truncated  = fmt.Errorf("the copied text was truncated to %d KiB for the terminal clipboard", maxOSC52Bytes/1024)
+	errOSC52NoResponse = errors.New("no clipboard contents from the terminal emulator")
+)
+
+// truncateUTF8 shortens the given string to at most n bytes, without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// osc52CopySequence returns the terminal escape sequence for placing the given text in the clipboard of the
+// terminal emulator, and true if the text had to be truncated. If tmux is true, the sequence is wrapped so
+// that tmux passes it through to the terminal emulator.
+func osc52CopySequence(s string, tmux bool) (string, bool) {
+	truncated := len(s) > maxOSC52Bytes
+	if truncated {
+		s = truncateUTF8(s, maxOSC52Bytes)
+	}
+	seq := "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
+	if tmux {
+		seq = "\033Ptmux;" + strings.ReplaceAll(seq, "\033", "\033\033") + "\033\\"
+	}
+	return seq, truncated
+}
+
+// parseOSC52Response finds and decodes a clipboard response from the terminal emulator, on the form
+// ESC ] 52 ; c ; base64 BEL, where the sequence may also end with ESC \. Returns false if the response is incomplete.
+func parseOSC52Response(data []byte) (string, bool, error) {
+	start := bytes.Index(data, []byte("\033]52;"))
+	if start < 0 {
+		return "", false, nil
+	}
+	rest := data[start+len("\033]52;"):]
+	end := bytes.IndexAny(rest, "\a\033")
+	if end < 0 || (rest[end] == '\033' && (end+1 >= len(rest) || rest[end+1] != '\\')) {
+		return "", false, nil
+	}
+	payload := rest[:end]
+	if i := bytes.IndexByte(payload, ';'); i >= 0 {
+		// Skip the selection parameter, like "c"
+		payload = payload[i+1:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(payload))
+	if err != nil {
+		return "", true, err
+	}
+	return string(decoded), true, nil
+}
+
+// copyToTerminalClipboard places the given text in the clipboard of the terminal emulator, with OSC 52.
+// This also works over ssh. errOSC52Truncated is returned if the text was too long and had to be truncated.
+func copyToTerminalClipboard(s string) error {
+	seq, truncated := osc52CopySequence(s, env.Has("TMUX"))
+	if _, err := os.Stdout.WriteString(seq); err != nil {
+		return err
+	}
+	if truncated {
+		return errOSC52Truncated
+	}
+	return nil
+}
+
+// pasteFromTerminalClipboard asks the terminal emulator for the contents of its clipboard, with OSC 52
+func pasteFromTerminalClipboard(tty *vt100.TTY) (string, error) {
+	if err := tty.WriteString(osc52QuerySequence); err != nil {
+		return "", err
+	}
+	var (
+		data     []byte
+		buf      = make([]byte, 4096)
+		deadline = time.Now().Add(osc52ResponseTimeout)
+	)
+	for time.Now().Before(deadline) {
+		n, _ := tty.Term().Read(buf)
+		if n == 0 {
+			continue
+		}
+		data = append(data, buf[:n]...)
+		if s, complete, err := parseOSC52Response(data); complete {
+			return s, err
+		}
+	}
+	// Skip the rest of the response when it arrives, instead of handling it as keypresses
+	osc52ReplyLate = true
+	osc52SkippingReply = bytes.Contains(data, []byte("\033]52;"))
+	osc52ReplyEsc = len(data) > 0 && data[len(data)-1] == '\033'
+	return "", errOSC52NoResponse
+}
+
+// skipLateOSC52Response removes a clipboard response from the terminal emulator that arrived after
+// pasteFromTerminalClipboard gave up waiting, from the start of the given bytes that were read as keys.
+// The response may be spread over several reads, and ends with BEL or ESC \. Returns the bytes after the response.
+func skipLateOSC52Response(bs []byte) []byte {
+	if !osc52SkippingReply {
+		if !osc52ReplyLate || !bytes.HasPrefix(bs, []byte("\033]52;")) {
+			return bs
+		}
+		osc52SkippingReply, osc52ReplyEsc = true, false
+		bs = bs[len("\033]52;"):]
+	}
+	for i, b := range bs {
+		if b == '\a' || (b == '\\' && ((i > 0 && bs[i-1] == '\033') || (i == 0 && osc52ReplyEsc))) {
+			osc52ReplyLate, osc52SkippingReply, osc52ReplyEsc = false, false, false
+			return bs[i+1:]
+		}
+	}
+	osc52ReplyEsc = len(bs) > 0 && bs[len(bs)-1] == '\033'
+	return nil
+}
+
+// CopyToClipboard places the given text in the system clipboard. When o is used over ssh and no clipboard
+// utility can be used, the text is placed in the clipboard of the local terminal emulator instead, with OSC 52.
+func (e *Editor) CopyToClipboard(s string) error {
+	err := copyToClipboard(s)
+	if err == nil || err == errSystemClipboardDisabled || !e.sshMode {
+		return err
+	}
+	return copyToTerminalClipboard(s)
+}
+
+// PasteFromClipboard returns the contents of the system clipboard. When o is used over ssh, no clipboard
+// utility can be used and osc52Paste is enabled, the clipboard of the local terminal emulator is read instead.
+func (e *Editor) PasteFromClipboard(tty *vt100.TTY) (string, error) {
+	s, err := pasteFromClipboard()
+	if err == nil || err == errSystemClipboardDisabled || !e.sshMode || !osc52Paste || tty == nil {
+		return s, err
+	}
+	return pasteFromTerminalClipboard(tty)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOSC52CopySequence(t *testing.T) {
+	seq, truncated := osc52CopySequence("hello", false)
+	if seq != "\033]52;c;aGVsbG8=\a" || truncated {
+		t.Errorf("unexpected sequence %q (truncated %v)", seq, truncated)
+	}
+	seq, _ = osc52CopySequence("hello", true)
+	if seq != "\033Ptmux;\033\033]52;c;aGVsbG8=\a\033\\" {
+		t.Errorf("unexpected tmux sequence %q", seq)
+	}
+	// A long text is truncated, without splitting a rune
+	long := strings.Repeat("æ", maxOSC52Bytes)
+	seq, truncated = osc52CopySequence(long, false)
+	if !truncated {
+		t.Error("expected the text to be truncated")
+	}
+	s, complete, err := parseOSC52Response([]byte(seq))
+	if err != nil || !complete {
+		t.Fatalf("could not parse the sequence: %v", err)
+	}
+	if len(s) > maxOSC52Bytes || !utf8.ValidString(s) || !strings.HasPrefix(long, s) {
+		t.Errorf("unexpected truncated text of length %d", len(s))
+	}
+}
+
+func TestParseOSC52Response(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+		complete bool
+	}{
+		{"\033]52;c;aGVsbG8=\a", "hello", true},
+		{"junk\033]52;c;aGVsbG8=\033\\", "hello", true},
+		{"\033]52;c;aGVs", "", false},
+		{"\033]52;c;aGVsbG8=\033", "", false},
+		{"no response", "", false},
+	}
+	for _, test := range tests {
+		s, complete, err := parseOSC52Response([]byte(test.data))
+		if err != nil || s != test.expected || complete != test.complete {
+			t.Errorf("parseOSC52Response(%q) = %q, %v, %v", test.data, s, complete, err)
+		}
+	}
+	if _, complete, err := parseOSC52Response([]byte("\033]52;c;!!!\a")); !complete || err == nil {
+		t.Error("expected an error for an invalid payload")
+	}
+}
+
+func TestSkipLateOSC52Response(t *testing.T) {
+	defer func() { osc52ReplyLate, osc52SkippingReply, osc52ReplyEsc = false, false, false }()
+
+	// Without a query that timed out, nothing is skipped
+	if got := string(skipLateOSC52Response([]byte("\033]52;c;aGVsbG8=\a"))); got != "\033]52;c;aGVsbG8=\a" {
+		t.Errorf("expected the bytes to be left alone, got %q", got)
+	}
+
+	// A late response is skipped, even when it is read in several parts, and the keys after it are kept
+	osc52ReplyLate = true
+	for _, part := range []string{"\033]52;c;aGVs", "bG8=\033"} {
+		if got := skipLateOSC52Response([]byte(part)); len(got) != 0 {
+			t.Errorf("expected %q to be skipped, got %q", part, got)
+		}
+	}
+	if got := string(skipLateOSC52Response([]byte("\\x"))); got != "x" {
+		t.Errorf("expected the key after the response, got %q", got)
+	}
+	if got := string(skipLateOSC52Response([]byte("\033]52;c;aGVsbG8=\a"))); got == "" {
+		t.Error("expected only one late response to be skipped")
+	}
+}
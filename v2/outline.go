@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// outlineRule describes which lines are definitions for a mode
+type outlineRule struct {
+	definition     *regexp.Regexp // matches the lines that should be listed in the outline
+	skipFencedCode bool           // ignore lines within ``` blocks, for Markdown
+}
+
+// outlineRules are the definitions that are listed in the outline, for each mode that supports it
+var outlineRules = map[mode.Mode]outlineRule{
+	mode.Go:         {definition: regexp.MustCompile(`^(func|type)\s`)},
+	mode.Rust:       {definition: regexp.MustCompile(`^\s*(pub(\([\w:]+\))?\s+)?((async|const|unsafe|extern\s+"\w+")\s+)*(fn|struct|enum|trait|impl|mod|macro_rules!)[\s<]`)},
+	mode.Python:     {definition: regexp.MustCompile(`^\s*(async\s+)?(def|class)\s`)},
+	mode.Markdown:   {definition: regexp.MustCompile(`^#{1,6}\s`), skipFencedCode: true},
+	mode.Shell:      {definition: regexp.MustCompile(`^\s*(function\s+[\w:.-]+|[\w:.-]+\s*\(\s*\))`)},
+	mode.JavaScript: {definition: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(async\s+)?(function\*?|class)\s`)},
+	mode.TypeScript: {definition: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(abstract\s+)?(async\s+)?(function\*?|class|interface|type|enum)\s`)},
+	mode.Zig:        {definition: regexp.MustCompile(`^\s*(pub\s+)?(fn\s|(const|var)\s+\w+\s*=\s*(struct|enum|union)\b)`)},
+	mode.Lua:        {definition: regexp.MustCompile(`^\s*(local\s+)?function\s`)},
+}
+
+var errNoOutline = errors.New("no outline for this file type")
+
+// OutlineEntry is a definition in the outline of the current file
+type OutlineEntry struct {
+	y    LineIndex
+	text string // the line, with the indentation expanded and the trailing opening brace or colon removed
+}
+
+// Outline returns the definitions in the current file, like functions and types, or headers for Markdown
+func (e *Editor) Outline() ([]OutlineEntry, error) {
+	rule, ok := outlineRules[e.mode]
+	if !ok {
+		return nil, errNoOutline
+	}
+	var (
+		entries   []OutlineEntry
+		inFence   bool
+		tabSpaces = strings.Repeat(" ", e.indentation.PerTab)
+	)
+	for i := 0; i < e.Len(); i++ {
+		line := e.Line(LineIndex(i))
+		if rule.skipFencedCode && strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || !rule.definition.MatchString(line) {
+			continue
+		}
+		text := strings.TrimRight(strings.ReplaceAll(line, "\t", tabSpaces), " \t")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(text, "{"), ":"))
+		if indentation := len(line) - len(strings.TrimLeft(line, " \t")); indentation > 0 {
+			text = strings.ReplaceAll(line[:indentation], "\t", tabSpaces) + text
+		}
+		entries = append(entries, OutlineEntry{LineIndex(i), text})
+	}
+	return entries, nil
+}
+
+// ShowOutline lists the definitions in the current file, and jumps to the selected one
+func (e *Editor) ShowOutline(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	entries, err := e.Outline()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("found no definitions")
+	}
+	// Start at the definition that the cursor is in, or the closest one above it
+	initialIndex, y := 0, e.DataY()
+	for i, entry := range entries {
+		if entry.y > y {
+			break
+		}
+		initialIndex = i
+	}
+	numberWidth := len(entries[len(entries)-1].y.LineNumber().String())
+	title := fmt.Sprintf("Outline of %s (%d definitions)", e.filename, len(entries))
+	index, ok := e.ListOverlay(c, tty, title, len(entries), initialIndex, func(bt *BoxTheme, index, x, y, w int, selected bool) {
+		textColor := *bt.Text
+		if selected {
+			textColor = *bt.Highlight
+		}
+		runes := []rune(fmt.Sprintf("%*d  %s", numberWidth, entries[index].y.LineNumber(), entries[index].text))
+		for i := 0; i < w; i++ {
+			r := ' '
+			if i < len(runes) {
+				r = runes[i]
+			}
+			c.WriteRune(uint(x+i), uint(y), textColor, *bt.Background, r)
+		}
+	})
+	e.redraw = true
+	e.redrawCursor = true
+	if !ok {
+		return nil
+	}
+	e.GoToLineNumber(entries[index].y.LineNumber(), c, status, true)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/mode"
+)
+
+func TestOutline(t *testing.T) {
+	tests := []struct {
+		m        mode.Mode
+		contents string
+		want     []string
+	}{
+		{mode.Go, "package main\n\ntype Point struct {\n\tX, Y int\n}\n\n// func inComment()\nfunc (p *Point) String() string {\n\tf := func() {}\n}\n\nfunc main() {\n}\n", []string{"3:type Point struct", "8:func (p *Point) String() string", "12:func main()"}},
+		{mode.Rust, "pub struct App;\n\nimpl App {\n    pub(crate) async fn run(&self) {\n        let fnord = 1;\n    }\n}\n", []string{"1:pub struct App;", "3:impl App", "4:    pub(crate) async fn run(&self)"}},
+		{mode.Python, "import os\n\nclass Parser:\n    def parse(self):\n        define = 1\n\nasync def main():\n    pass\n", []string{"3:class Parser", "4:    def parse(self)", "7:async def main()"}},
+		{mode.Markdown, "# Title\n\nText\n\n## Usage\n\n```sh\n# not a header\n```\n\n#hashtag\n", []string{"1:# Title", "5:## Usage"}},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.mode = test.m
+		e.LoadBytes([]byte(test.contents))
+		entries, err := e.Outline()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, fmt.Sprintf("%d:%s", entry.y.LineNumber(), entry.text))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: expected %q, got %q", test.m, test.want, got)
+		}
+	}
+
+	e := NewSimpleEditor(80)
+	e.mode = mode.Blank
+	if _, err := e.Outline(); err != errNoOutline {
+		t.Errorf("expected no outline for plain text, got %v", err)
+	}
+}
+
+func TestOutlineLargeFile(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("package main\n\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, "// f%d returns %d\nfunc f%d() int {\n\treturn %d\n}\n\n", i, i, i, i)
+	}
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte(sb.String()))
+	start := time.Now()
+	entries, err := e.Outline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10000 {
+		t.Errorf("expected 10000 functions, got %d", len(entries))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the outline of %d lines took %v", e.Len(), elapsed)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/xyproto/vt100"
+)
+
+// ToggleOverwriteMode toggles between inserting and overwriting when typing
+func (e *Editor) ToggleOverwriteMode() {
+	e.overwriteMode = !e.overwriteMode
+}
+
+// Overwriting returns true if typed runes should replace the runes under the cursor,
+// which is the case in overwrite mode and in ASCII draw mode
+func (e *Editor) Overwriting() bool {
+	return e.overwriteMode || e.drawMode
+}
+
+// OverwriteRune replaces the rune under the cursor with r, then moves to the next position.
+// If the cursor is after the end of the line, the rune is inserted instead.
+func (e *Editor) OverwriteRune(c *vt100.Canvas, r rune) {
+	if e.AfterEndOfLine() {
+		e.InsertRune(c, r)
+	} else {
+		e.SetRune(r)
+		e.changed = true
+	}
+	e.WriteRune(c)
+	e.Next(c)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// OverwriteBackspace moves one position to the left and replaces the rune there with a space.
+// Lines are never joined when in overwrite mode.
+func (e *Editor) OverwriteBackspace(c *vt100.Canvas) {
+	if x, _ := e.DataX(); x == 0 {
+		return
+	}
+	e.Prev(c)
+	if !e.AfterEndOfLine() {
+		e.SetRune(' ')
+		e.changed = true
+	}
+	e.WriteRune(c)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// OverwriteTab moves to the next tab stop, overwriting the runes on the way with spaces
+func (e *Editor) OverwriteTab(c *vt100.Canvas) {
+	perTab := e.indentation.PerTab
+	if perTab <= 0 {
+		perTab = 1
+	}
+	screenX := e.pos.sx + e.pos.offsetX
+	nextTabStop := (screenX/perTab + 1) * perTab
+	for i := screenX; i < nextTabStop; i++ {
+		e.OverwriteRune(c, ' ')
+	}
+}
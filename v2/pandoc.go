@@ -48,7 +48,7 @@ func (e *Editor) exportPandoc(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar
 
 	status.ClearAll(c)
 	status.SetMessage("Rendering to PDF using Pandoc...")
-	status.ShowNoTimeout(c, e)
+	status.ShowUntilRedraw(c, e)
 
 	// The reason for writing to a temporary file is to be able to export without saving
 	// the currently edited file.
@@ -64,20 +64,14 @@ func (e *Editor) exportPandoc(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar
 	defer os.Remove(tempFilename)
 	tempFilename = f.Name()
 
-	// TODO: Implement a SaveAs function
-
 	// Save to tmpfn
-	oldFilename := e.filename
-	e.filename = tempFilename
-	err = e.Save(c, tty)
+	err = e.SaveTemporary(c, tty, tempFilename)
 	if err != nil {
-		e.filename = oldFilename
 		status.ClearAll(c)
 		status.SetError(err)
 		status.Show(c, e)
 		return err
 	}
-	e.filename = oldFilename
 
 	// Check if the PAPERSIZE environment variable is set. Default to "a4".
 	papersize := env.Str("PAPERSIZE", "a4")
@@ -104,7 +98,7 @@ func (e *Editor) exportPandoc(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar
 	pandocCommand.Args = append(pandocCommand.Args, "--listings", "-H"+expandedTexFilename)
 
 	// add output and input filenames
-	pandocCommand.Args = append(pandocCommand.Args, "-o"+pdfFilename, oldFilename)
+	pandocCommand.Args = append(pandocCommand.Args, "-o"+pdfFilename, e.filename)
 
 	// Save the command in a temporary file, using the current filename
 	saveCommand(pandocCommand)
@@ -131,6 +125,6 @@ func (e *Editor) exportPandoc(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar
 
 	status.ClearAll(c)
 	status.SetMessage("Saved " + pdfFilename)
-	status.ShowNoTimeout(c, e)
+	status.Show(c, e)
 	return nil
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNoOutput = errors.New("no output")
+
+// filterThroughShell runs the given shell command with the given input on stdin, and returns what it writes to stdout.
+// If the command fails, the error is the first line that it writes to stderr, if any.
+// The command is stopped if it takes longer than commandTimeout, or if something is sent to the abort channel.
+func filterThroughShell(command, input string, abortChan <-chan bool) (string, error) {
+	return filterThroughShellWithTimeout(command, input, commandTimeout, abortChan)
+}
+
+// filterThroughShellWithTimeout works like filterThroughShell, but with the given timeout. The shell runs in a
+// process group of its own, so that the processes it has started are stopped too, like with build commands.
+func filterThroughShellWithTimeout(command, input string, timeout time.Duration, abortChan <-chan bool) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return "", fmt.Errorf("%s: timed out after %s", command, timeout)
+	case <-abortChan:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return "", fmt.Errorf("%s: stopped by user", command)
+	}
+	if err != nil {
+		if line := firstLine(stderr.String()); line != "" {
+			return "", errors.New(line)
+		}
+		return "", fmt.Errorf("%s: %w", command, err)
+	}
+	return stdout.String(), nil
+}
+
+// FilterRange replaces the lines in the given range with the output of the given shell command,
+// when the lines are given as input. A spinner is shown while the command runs, and pressing esc stops it.
+// The lines are left as they are if the command fails or has no output. If undo is not nil,
+// a snapshot is taken right before the lines are replaced.
+func (e *Editor) FilterRange(c *vt100.Canvas, tty *vt100.TTY, undo *Undo, r Range, command string, bookmark *Position) error {
+	quitChan, abortChan := startSpinner(c, tty, fmt.Sprintf("Filtering through %s... ", command), "filtering: stopped by user", 200*time.Millisecond, e.ItalicsColor)
+	output, err := filterThroughShell(command, e.RangeString(r), abortChan)
+	quitChan <- true
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return errNoOutput
+	}
+	if undo != nil {
+		undo.Snapshot(e)
+	}
+	e.ReplaceRange(r, strings.Split(strings.TrimSuffix(output, "\n"), "\n"), bookmark)
+	return nil
+}
+
+// FilterBlock pipes the block of lines at the current position, or the whole file, through the given shell command,
+// and replaces it with the output. The cursor stays at the same line, if the output is long enough.
+func (e *Editor) FilterBlock(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo, bookmark *Position, command string, wholeFile bool) error {
+	y := e.LineIndex()
+	r := e.WholeFile()
+	if !wholeFile {
+		if blankLine(e.CurrentLine()) {
+			return errors.New("no text block at the current position")
+		}
+		r = e.BlockAt(y)
+	}
+	if err := e.FilterRange(c, tty, undo, r, command, bookmark); err != nil {
+		return err
+	}
+	e.GoTo(y, c, status)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
+
+// filterCommand asks for a shell command if none is given, and then filters the current block of lines,
+// or the whole file, through it, as one undo step. Nothing is added to the undo history if the command fails.
+func (e *Editor) filterCommand(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, bookmark *Position, undo *Undo, command string, wholeFile bool) {
+	if strings.TrimSpace(command) == "" {
+		var ok bool
+		if command, ok = e.UserInput(c, tty, status, "Filter through", []string{}, false); !ok || strings.TrimSpace(command) == "" {
+			return
+		}
+	}
+	if err := e.FilterBlock(c, tty, status, undo, bookmark, command, wholeFile); err != nil {
+		status.ShowErrorAfterRedraw(err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterRange(t *testing.T) {
+	e := newRangeEditor()
+	bookmark := &Position{sy: 5}
+	if err := e.FilterRange(nil, nil, nil, e.BlockAt(0), "sort -r; echo d", bookmark); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.String(); s != "c\nb\na\nd\n\nz\ny\n" {
+		t.Errorf("expected the first block to be replaced by the output, got %q", s)
+	}
+	if bookmark.LineIndex() != 6 {
+		t.Errorf("expected the bookmark to move down one line, got line index %d", bookmark.LineIndex())
+	}
+	err := e.FilterRange(nil, nil, nil, e.WholeFile(), "cat; echo 'first problem' >&2; echo second >&2; exit 3", bookmark)
+	if err == nil || err.Error() != "first problem" {
+		t.Errorf("expected the first line of stderr as the error, got %v", err)
+	}
+	if err := e.FilterRange(nil, nil, nil, e.WholeFile(), "true", bookmark); err != errNoOutput {
+		t.Errorf("expected an error when there is no output, got %v", err)
+	}
+	if s := e.String(); s != "c\nb\na\nd\n\nz\ny\n" {
+		t.Errorf("expected the lines to be left as they are when the command fails, got %q", s)
+	}
+}
+
+func TestFilterThroughShellTimeout(t *testing.T) {
+	// The processes that the shell has started are stopped too, so that their output pipes are closed
+	start := time.Now()
+	_, err := filterThroughShellWithTimeout("cat; sleep 25 | cat", "hello\n", 100*time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the command to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be stopped right away, but it took %s", elapsed)
+	}
+}
+
+func TestFilterAbort(t *testing.T) {
+	abortChan := make(chan bool, 1)
+	abortChan <- true
+	start := time.Now()
+	_, err := filterThroughShellWithTimeout("sleep 25", "", time.Minute, abortChan)
+	if err == nil || !strings.Contains(err.Error(), "stopped by user") {
+		t.Errorf("expected the command to be stopped, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be stopped right away, but it took %s", elapsed)
+	}
+}
+
+func TestFilterUndo(t *testing.T) {
+	e := newRangeEditor()
+	undo := NewUndo(10, 0)
+	if err := e.FilterRange(nil, nil, undo, e.WholeFile(), "exit 1", nil); err == nil {
+		t.Error("expected an error from the failing command")
+	}
+	if undo.Len() != 0 {
+		t.Errorf("expected no undo step when the command fails, got %d", undo.Len())
+	}
+	before := e.String()
+	if err := e.FilterRange(nil, nil, undo, e.WholeFile(), "sort", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := undo.Undo(e); err != nil || e.String() != before {
+		t.Errorf("expected undo to restore the lines from before filtering, got %q (%v)", e.String(), err)
+	}
+}
@@ -50,7 +50,7 @@ func (p *Position) OffsetY() int {
 func (p *Position) SetX(c *vt100.Canvas, x int) {
 	p.sx = x
 	w := 80 // default width
-	if c != nil {
+	if c != nil && c.W() > 0 {
 		w = int(c.W())
 	}
 	if x < w {
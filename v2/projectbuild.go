@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// projectBuildFilename is the name of a file with a shell command for building the project, like "make -C build" or "zig build test".
+// It is searched for in the directory of the source file and in the parent directories.
+const projectBuildFilename = ".o-build"
+
+// findProjectBuildFile searches the given directory and all parent directories for a project build file.
+// Returns the path to the file, or an empty string.
+func findProjectBuildFile(dir string) string {
+	for {
+		if path := filepath.Join(dir, projectBuildFilename); exists(path) && !isDir(path) {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ProjectBuildCommand returns a command for building the project that the given source file is in,
+// if there is a project build file in the directory of the source file or in a parent directory.
+// The contents of the file are run with "sh -c", from the directory that contains the file.
+func ProjectBuildCommand(sourceFilename string) (*exec.Cmd, bool) {
+	path := findProjectBuildFile(filepath.Dir(sourceFilename))
+	if path == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	script := strings.TrimSpace(string(data))
+	if script == "" {
+		return nil, false
+	}
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = filepath.Dir(path)
+	return cmd, true
+}
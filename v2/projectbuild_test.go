@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestProjectBuildCommand(t *testing.T) {
+	dir := t.TempDir()
+	sourceFilename := filepath.Join(dir, "src", "main.c")
+	if err := os.MkdirAll(filepath.Dir(sourceFilename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourceFilename, []byte("int main() {\n  return 0\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ProjectBuildCommand(sourceFilename); ok {
+		t.Fatal("expected no project build command without a project build file")
+	}
+
+	// The project build file is found in a parent directory, and the command runs from there
+	configFilename := filepath.Join(dir, projectBuildFilename)
+	if err := os.WriteFile(configFilename, []byte("# build the library first\necho \"lib/util.c:2:5: error: expected ';'\" >&2\nexit 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd, ok := ProjectBuildCommand(sourceFilename)
+	if !ok || cmd.Dir != dir {
+		t.Fatalf("expected a command that runs from %s, got %v", dir, cmd)
+	}
+
+	// The output is handled as if it came from the built-in build command
+	e := NewSimpleEditor(80)
+	e.mode = mode.C
+	if _, err := e.BuildOrExport(nil, nil, nil, sourceFilename, false); err == nil || err.Error() != "In util.c: error: expected ';'" {
+		t.Errorf("expected the error from the project build command, got %v", err)
+	}
+	if e.buildErrors.Len() != 1 || e.buildErrors.errors[0].absFilename != filepath.Join(dir, "lib", "util.c") {
+		t.Errorf("expected the error location to be relative to the project build file, got %v", e.buildErrors)
+	}
+
+	// An empty project build file is ignored
+	if err := os.WriteFile(configFilename, []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ProjectBuildCommand(sourceFilename); ok {
+		t.Error("expected an empty project build file to be ignored")
+	}
+}
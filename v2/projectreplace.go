@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// How many before/after example lines to show per file when previewing a multi-file replace
+const maxReplaceExamples = 3
+
+// lastMultiReplace holds the backups from the last multi-file replace, so that it can be reverted
+var lastMultiReplace *MultiReplace
+
+// FileReplacement is a planned (or applied) replacement of all matches in a single file
+type FileReplacement struct {
+	err         error       // an error that occurred when reading, writing or reverting this file
+	filename    string      // the filename, relative to the project root
+	absFilename string      // the absolute filename
+	oldContents string      // the contents before replacing, used as a backup when reverting
+	newContents string      // the contents after replacing
+	examples    [][2]string // a few examples of lines before and after replacing
+	matchCount  int         // the number of matches that are replaced
+	lineCount   int         // the number of lines that are changed
+	inBuffer    bool        // is the file open in the editor, or in one of the open buffers? Then the buffer is changed instead of the file.
+	applied     bool        // has the replacement been applied?
+}
+
+// MultiReplace is a replacement across several files in a project
+type MultiReplace struct {
+	root        string             // the absolute path to the project root
+	pattern     string             // the search pattern, as given by the user
+	replacement string             // the replacement string
+	files       []*FileReplacement // one entry per file that has matches
+}
+
+// planFileReplacement replaces all matches of re in the given contents, line by line, without touching any files.
+// If literal is true, the replacement string is used as it is, otherwise "$1" and similar are expanded.
+func planFileReplacement(re *regexp.Regexp, replacement string, literal bool, filename, contents string) *FileReplacement {
+	fr := &FileReplacement{filename: filename, oldContents: contents}
+	lines := strings.Split(contents, "\n")
+	for i, line := range lines {
+		matchCount := len(re.FindAllStringIndex(line, -1))
+		if matchCount == 0 {
+			continue
+		}
+		var newLine string
+		if literal {
+			newLine = re.ReplaceAllLiteralString(line, replacement)
+		} else {
+			newLine = re.ReplaceAllString(line, replacement)
+		}
+		if newLine == line {
+			continue
+		}
+		fr.matchCount += matchCount
+		fr.lineCount++
+		if len(fr.examples) < maxReplaceExamples {
+			fr.examples = append(fr.examples, [2]string{strings.TrimSpace(line), strings.TrimSpace(newLine)})
+		}
+		lines[i] = newLine
+	}
+	fr.newContents = strings.Join(lines, "\n")
+	return fr
+}
+
+// bufferContents returns the contents of the editor as lines joined by "\n"
+func (e *Editor) bufferContents() string {
+	l := e.Len()
+	lines := make([]string, l)
+	for i := 0; i < l; i++ {
+		lines[i] = e.Line(LineIndex(i))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setBufferContents replaces the lines that differ from the given contents.
+// The number of lines is expected to be unchanged.
+func (e *Editor) setBufferContents(contents string) {
+	for i, line := range strings.Split(contents, "\n") {
+		if e.Line(LineIndex(i)) != line {
+			e.SetLine(LineIndex(i), line)
+			e.changed = true
+		}
+	}
+	e.redraw = true
+	e.redrawCursor = true
+}
+
+// openContents returns the contents of the given file, if it is shown in the editor or is one of the open buffers.
+// e may be nil.
+func openContents(e *Editor, absFilename string) (string, bool) {
+	if e != nil {
+		if editorAbsFilename, err := e.AbsFilename(); err == nil && editorAbsFilename == absFilename {
+			return e.bufferContents(), true
+		}
+	}
+	if b := openBuffers.Find(absFilename); b != nil {
+		return b.Contents(), true
+	}
+	return "", false
+}
+
+// setOpenContents replaces the contents of the given file, if it is shown in the editor or is one of the open buffers.
+// Returns false if the file is not open. e may be nil.
+func setOpenContents(e *Editor, absFilename, contents string) bool {
+	if e != nil {
+		if editorAbsFilename, err := e.AbsFilename(); err == nil && editorAbsFilename == absFilename {
+			e.setBufferContents(contents)
+			return true
+		}
+	}
+	if b := openBuffers.Find(absFilename); b != nil {
+		b.SetContents(contents)
+		return true
+	}
+	return false
+}
+
+// PlanReplace prepares replacing all matches from the project search with the given replacement string,
+// but does not change anything. If one of the files is shown in the editor (if e is not nil) or is one of
+// the open buffers, the contents of the buffer is used instead of the file on disk.
+func (ps *ProjectSearch) PlanReplace(e *Editor, replacement string) *MultiReplace {
+	mr := &MultiReplace{root: ps.root, pattern: ps.pattern, replacement: replacement}
+	seen := make(map[string]bool)
+	for _, m := range ps.matches {
+		if seen[m.filename] {
+			continue
+		}
+		seen[m.filename] = true
+		absFilename := filepath.Join(ps.root, filepath.FromSlash(m.filename))
+		var fr *FileReplacement
+		if contents, ok := openContents(e, absFilename); ok {
+			fr = planFileReplacement(ps.re, replacement, ps.literal, m.filename, contents)
+			fr.inBuffer = true
+		} else if data, err := os.ReadFile(absFilename); err != nil {
+			fr = &FileReplacement{filename: m.filename, err: err}
+		} else {
+			fr = planFileReplacement(ps.re, replacement, ps.literal, m.filename, string(data))
+		}
+		fr.absFilename = absFilename
+		if fr.err == nil && fr.lineCount == 0 {
+			// The file may have changed since searching
+			continue
+		}
+		mr.files = append(mr.files, fr)
+	}
+	return mr
+}
+
+// Counts returns the number of files, lines and matches that will be (or were) replaced
+func (mr *MultiReplace) Counts() (int, int, int) {
+	var fileCount, lineCount, matchCount int
+	for _, fr := range mr.files {
+		if fr.err != nil {
+			continue
+		}
+		fileCount++
+		lineCount += fr.lineCount
+		matchCount += fr.matchCount
+	}
+	return fileCount, lineCount, matchCount
+}
+
+// Preview returns a list of the files that will be changed, with the number of changes
+// and a few examples of how lines will look before and after.
+func (mr *MultiReplace) Preview() []string {
+	var preview []string
+	for _, fr := range mr.files {
+		if fr.err != nil {
+			preview = append(preview, fr.filename+": "+fr.err.Error())
+			continue
+		}
+		s := fmt.Sprintf("%s: %d matches on %d lines", fr.filename, fr.matchCount, fr.lineCount)
+		if fr.inBuffer {
+			s += " (in the editor)"
+		}
+		preview = append(preview, s)
+		for _, example := range fr.examples {
+			preview = append(preview, "  - "+example[0], "  + "+example[1])
+		}
+	}
+	return preview
+}
+
+// Apply performs the planned replacements, either in the given editor or in one of the open buffers
+// (if the file is open) or by writing to the files atomically. Errors are recorded per file, and a combined error is returned.
+func (mr *MultiReplace) Apply(e *Editor) error {
+	var failed []string
+	for _, fr := range mr.files {
+		if fr.err != nil {
+			failed = append(failed, fr.filename+": "+fr.err.Error())
+			continue
+		}
+		if fr.inBuffer {
+			if !setOpenContents(e, fr.absFilename, fr.newContents) {
+				fr.err = errors.New("no longer open")
+				failed = append(failed, fr.filename+": "+fr.err.Error())
+				continue
+			}
+		} else if err := writeFileAtomic(fr.absFilename, []byte(fr.newContents), 0o644); err != nil {
+			fr.err = err
+			failed = append(failed, fr.filename+": "+err.Error())
+			continue
+		}
+		fr.applied = true
+	}
+	if len(failed) > 0 {
+		return errors.New("could not replace in " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Revert restores the backups of all files that were changed by Apply.
+// Files that have been changed since the replacement are left as they are.
+func (mr *MultiReplace) Revert(e *Editor) (int, error) {
+	var (
+		failed        []string
+		revertedCount int
+	)
+	for _, fr := range mr.files {
+		if !fr.applied {
+			continue
+		}
+		if fr.inBuffer {
+			if contents, ok := openContents(e, fr.absFilename); !ok || contents != fr.newContents {
+				failed = append(failed, fr.filename+": changed since the replace")
+				continue
+			}
+			setOpenContents(e, fr.absFilename, fr.oldContents)
+		} else {
+			data, err := os.ReadFile(fr.absFilename)
+			if err != nil {
+				failed = append(failed, fr.filename+": "+err.Error())
+				continue
+			}
+			if string(data) != fr.newContents {
+				failed = append(failed, fr.filename+": changed since the replace")
+				continue
+			}
+			if err := writeFileAtomic(fr.absFilename, []byte(fr.oldContents), 0o644); err != nil {
+				failed = append(failed, fr.filename+": "+err.Error())
+				continue
+			}
+		}
+		fr.applied = false
+		revertedCount++
+	}
+	if len(failed) > 0 {
+		return revertedCount, errors.New("could not revert " + strings.Join(failed, ", "))
+	}
+	return revertedCount, nil
+}
+
+// ProjectReplacePrompt asks for a replacement string for the last project search,
+// shows a preview of the changes and then replaces all matches in all files, if confirmed.
+func (e *Editor) ProjectReplacePrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) {
+	if projectSearch == nil || projectSearch.Len() == 0 {
+		status.SetErrorMessage("Search in the project first")
+		status.Show(c, e)
+		return
+	}
+	if projectSearch.truncated {
+		// Files after the first maxProjectSearchMatches matches would be left unchanged
+		status.SetErrorMessage(fmt.Sprintf("More than %d matches, search for something more specific first", maxProjectSearchMatches))
+		status.Show(c, e)
+		return
+	}
+	replacement, ok := e.UserInput(c, tty, status, "Replace "+projectSearch.pattern+" in project with", []string{}, false)
+	if !ok {
+		e.redraw = true
+		e.redrawCursor = true
+		return
+	}
+	mr := projectSearch.PlanReplace(e, replacement)
+	fileCount, lineCount, matchCount := mr.Counts()
+	if fileCount == 0 {
+		status.SetMessage("Nothing to replace")
+		status.Show(c, e)
+		return
+	}
+
+	// Show the preview and ask for confirmation
+	preview := mr.Preview()
+	title := fmt.Sprintf("Replace %d matches on %d lines in %d files? (return: yes, esc: no)", matchCount, lineCount, fileCount)
+	_, confirmed := e.ListOverlay(c, tty, title, len(preview), 0, func(bt *BoxTheme, index, x, y, w int, selected bool) {
+		textColor := *bt.Text
+		if selected {
+			textColor = *bt.Highlight
+		}
+		runes := []rune(preview[index])
+		if len(runes) > w {
+			runes = runes[:w]
+		}
+		c.Write(uint(x), uint(y), textColor, *bt.Background, string(runes)+strings.Repeat(" ", w-len(runes)))
+	})
+	e.redraw = true
+	e.redrawCursor = true
+	if !confirmed {
+		status.SetMessageAfterRedraw("Replace cancelled")
+		return
+	}
+
+	undo.Snapshot(e)
+	err := mr.Apply(e)
+	lastMultiReplace = mr
+	fileCount, lineCount, _ = mr.Counts()
+	if err != nil {
+		status.ShowErrorAfterRedraw(fmt.Errorf("replaced %d lines in %d files, %w", lineCount, fileCount, err))
+		return
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("Replaced %d lines in %d files", lineCount, fileCount))
+}
+
+// RevertProjectReplace reverts the last multi-file replace
+func (e *Editor) RevertProjectReplace(c *vt100.Canvas, status *StatusBar, undo *Undo) {
+	if lastMultiReplace == nil {
+		status.SetErrorMessage("No multi-file replace to revert")
+		status.Show(c, e)
+		return
+	}
+	undo.Snapshot(e)
+	n, err := lastMultiReplace.Revert(e)
+	if err != nil {
+		status.SetError(fmt.Errorf("reverted %d files, %w", n, err))
+		status.Show(c, e)
+		return
+	}
+	lastMultiReplace = nil
+	status.SetMessageAfterRedraw(fmt.Sprintf("Reverted %d files", n))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestPlanFileReplacement(t *testing.T) {
+	re := regexp.MustCompile(`(\w+)Count`)
+	fr := planFileReplacement(re, "${1}Total", false, "a.go", "lineCount := 0\nfoo()\nwordCount, lineCount = 1, 2\n")
+	if fr.matchCount != 3 || fr.lineCount != 2 {
+		t.Fatalf("expected 3 matches on 2 lines, got %d matches on %d lines", fr.matchCount, fr.lineCount)
+	}
+	if fr.newContents != "lineTotal := 0\nfoo()\nwordTotal, lineTotal = 1, 2\n" {
+		t.Errorf("unexpected contents after replacing: %q", fr.newContents)
+	}
+	if len(fr.examples) != 2 || fr.examples[0] != [2]string{"lineCount := 0", "lineTotal := 0"} {
+		t.Errorf("unexpected examples: %v", fr.examples)
+	}
+	literal := planFileReplacement(regexp.MustCompile(regexp.QuoteMeta("$x")), "$1", true, "b.sh", "echo $x\n")
+	if literal.newContents != "echo $1\n" {
+		t.Errorf("a literal replacement should not expand $1, got %q", literal.newContents)
+	}
+}
+
+func TestMultiReplace(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "one apple\ntwo apples\n",
+		"sub/b.txt": "no fruit\nan apple a day\n",
+		"c.txt":     "nothing here\n",
+	}
+	for filename, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(filename))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ps, err := NewProjectSearch(root, "apple", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Planning a replacement is a dry run, and should not touch any files
+	mr := ps.PlanReplace(nil, "pear")
+	if fileCount, lineCount, matchCount := mr.Counts(); fileCount != 2 || lineCount != 3 || matchCount != 3 {
+		t.Fatalf("expected 2 files, 3 lines and 3 matches, got %d, %d and %d", fileCount, lineCount, matchCount)
+	}
+	if preview := mr.Preview(); len(preview) != 8 || preview[0] != "a.txt: 2 matches on 2 lines" || preview[1] != "  - one apple" || preview[2] != "  + one pear" {
+		t.Errorf("unexpected preview: %q", preview)
+	}
+	for filename, contents := range files {
+		if data, _ := os.ReadFile(filepath.Join(root, filename)); string(data) != contents {
+			t.Fatalf("%s was changed by a dry run", filename)
+		}
+	}
+
+	if err := mr.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "sub", "b.txt")); string(data) != "no fruit\nan pear a day\n" {
+		t.Errorf("unexpected contents after replacing: %q", string(data))
+	}
+	if n, err := mr.Revert(nil); err != nil || n != 2 {
+		t.Fatalf("expected 2 files to be reverted, got %d and %v", n, err)
+	}
+	for filename, contents := range files {
+		if data, _ := os.ReadFile(filepath.Join(root, filename)); string(data) != contents {
+			t.Errorf("%s was not reverted", filename)
+		}
+	}
+}
+
+func TestMultiReplaceOpenBuffers(t *testing.T) {
+	defer func(br *BufferRing) { openBuffers = br }(openBuffers)
+	openBuffers = &BufferRing{}
+	discardStdout(t)
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+	for _, filename := range []string{a, b} {
+		if err := os.WriteFile(filename, []byte("an apple\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := vt100.NewCanvas()
+	// b.txt is open in another buffer, with a change that is not saved yet
+	other, _, err := NewEditor(nil, c, FilenameOrData{filename: b}, LineNumber(0), ColNumber(0), NewDefaultTheme(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.SetLine(0, "an apple, unsaved")
+	if err := openBuffers.Push(other, NewUndo(1, defaultUndoMemory)); err != nil {
+		t.Fatal(err)
+	}
+	e, _, err := NewEditor(nil, c, FilenameOrData{filename: a}, LineNumber(0), ColNumber(0), NewDefaultTheme(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := NewProjectSearch(root, "apple", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := ps.PlanReplace(e, "pear")
+	for _, fr := range mr.files {
+		if !fr.inBuffer {
+			t.Errorf("expected %s to be replaced in the open buffer", fr.filename)
+		}
+	}
+	if err := mr.Apply(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Line(0); got != "an pear" {
+		t.Errorf("expected the shown file to be changed, got %q", got)
+	}
+	if got := openBuffers.Find(b).Contents(); got != "an pear, unsaved" {
+		t.Errorf("expected the unsaved change in the open buffer to be kept, got %q", got)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "an apple\n" {
+		t.Errorf("expected the file of the open buffer to be left alone, got %q", string(data))
+	}
+	if n, err := mr.Revert(e); err != nil || n != 2 {
+		t.Fatalf("expected 2 files to be reverted, got %d and %v", n, err)
+	}
+	if got := openBuffers.Find(b).Contents(); got != "an apple, unsaved" {
+		t.Errorf("expected the open buffer to be reverted, got %q", got)
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/binary"
+	"github.com/xyproto/vt100"
+)
+
+// Files larger than this are skipped when searching in the project
+const maxProjectSearchFileSize = 1024 * 1024
+
+// Stop collecting matches after this many, to keep the results overlay responsive
+const maxProjectSearchMatches = 10000
+
+var (
+	// projectSearch holds the results of the last project-wide search, for cycling with ctrl-n and ctrl-p
+	projectSearch *ProjectSearch
+
+	errNoProjectSearchMatch = errors.New("no project search match")
+)
+
+// ProjectMatch is a single match from a project-wide search
+type ProjectMatch struct {
+	filename   string     // the filename, relative to the project root, with forward slashes
+	lineNumber LineNumber // the line number of the match
+	col        ColIndex   // the rune index of the match on the line
+	line       string     // the contents of the matching line
+}
+
+// ProjectSearch is a collection of matches from searching the files in a project
+type ProjectSearch struct {
+	re        *regexp.Regexp // the compiled search pattern
+	root      string         // the absolute path to the project root
+	pattern   string         // the pattern, as given by the user
+	matches   []ProjectMatch // all matches, sorted by filename and line number
+	index     int            // the currently selected match
+	literal   bool           // was the pattern a literal string and not a regular expression?
+	truncated bool           // were there more than maxProjectSearchMatches matches?
+}
+
+// String returns the match as "path:line: contents"
+func (m ProjectMatch) String() string {
+	return m.filename + ":" + m.lineNumber.String() + ": " + strings.TrimSpace(m.line)
+}
+
+// findProjectRoot returns the root directory of the git repository that contains
+// the given directory, or the given directory if it is not in a git repository.
+func findProjectRoot(dir string) string {
+	if gitRoot := findGitRoot(dir); gitRoot != "" {
+		return gitRoot
+	}
+	return dir
+}
+
+// compileProjectSearchPattern compiles the given pattern, which is quoted first if literal is true
+func compileProjectSearchPattern(pattern string, literal bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("empty search pattern")
+	}
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// projectPathIgnored checks if the given slash-separated path (relative to the project root)
+// should be skipped when searching, either because it is hidden, generated or ignored by git.
+func projectPathIgnored(relPath string, isDir bool, im *IgnoreMatcher) bool {
+	for _, part := range strings.Split(relPath, "/") {
+		if (strings.HasPrefix(part, ".") && part != "." && part != "..") || hasS(generatedDirectories, part) {
+			return true
+		}
+	}
+	return im.Match(relPath, isDir)
+}
+
+// newProjectMatch creates a ProjectMatch and finds the rune index of the first match on the line
+func newProjectMatch(re *regexp.Regexp, filename string, lineNumber LineNumber, line string) ProjectMatch {
+	m := ProjectMatch{filename: filepath.ToSlash(filename), lineNumber: lineNumber, line: line}
+	if loc := re.FindStringIndex(line); loc != nil {
+		m.col = ColIndex(len([]rune(line[:loc[0]])))
+	}
+	return m
+}
+
+// searchFileContents returns all lines in the given data that match the regular expression
+func searchFileContents(re *regexp.Regexp, relFilename string, data []byte) []ProjectMatch {
+	var matches []ProjectMatch
+	if !re.Match(data) {
+		return matches
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if re.MatchString(line) {
+			matches = append(matches, newProjectMatch(re, relFilename, LineIndex(i).LineNumber(), line))
+		}
+	}
+	return matches
+}
+
+// sortProjectMatches sorts the matches by filename and then by line number
+func sortProjectMatches(matches []ProjectMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].filename != matches[j].filename {
+			return matches[i].filename < matches[j].filename
+		}
+		return matches[i].lineNumber < matches[j].lineNumber
+	})
+}
+
+// projectSearchInternal walks the project root and searches the contents of all files
+// that are not ignored, not too large and not binary, using several goroutines.
+// No more files are searched once more than limit matches have been found in the first files,
+// and at most limit+1 matches are returned, which are always the first ones in sorted order.
+func projectSearchInternal(root string, re *regexp.Regexp, im *IgnoreMatcher, limit int) ([]ProjectMatch, error) {
+	var filenames []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip files and directories that can not be read
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+		if projectPathIgnored(relPath, d.IsDir(), im) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxProjectSearchFileSize {
+			return nil
+		}
+		filenames = append(filenames, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Search the files in the same order as the matches are sorted in, so that the matches that are kept
+	// when there are too many are always the first ones, no matter which goroutine finishes first
+	sort.Strings(filenames)
+	var (
+		wg         sync.WaitGroup
+		matchMut   sync.Mutex
+		results    = make([][]ProjectMatch, len(filenames)) // the matches per file, by index
+		searched   = make([]bool, len(filenames))
+		doneCount  int // the number of files, from the first one, that have all been searched
+		doneFound  int // the number of matches in those files
+		filenameCh = make(chan int)
+	)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range filenameCh {
+				var fileMatches []ProjectMatch
+				if data, err := os.ReadFile(filepath.Join(root, filenames[i])); err == nil && !binary.Data(data) {
+					fileMatches = searchFileContents(re, filenames[i], data)
+				}
+				matchMut.Lock()
+				results[i], searched[i] = fileMatches, true
+				for doneCount < len(filenames) && searched[doneCount] {
+					doneFound += len(results[doneCount])
+					doneCount++
+				}
+				matchMut.Unlock()
+			}
+		}()
+	}
+	for i := range filenames {
+		matchMut.Lock()
+		enough := doneFound > limit
+		matchMut.Unlock()
+		if enough {
+			break
+		}
+		filenameCh <- i
+	}
+	close(filenameCh)
+	wg.Wait()
+
+	// Collect the matches in order, and keep one more than the limit, so that the caller can tell that there were more
+	var matches []ProjectMatch
+	for _, fileMatches := range results {
+		matches = append(matches, fileMatches...)
+		if len(matches) > limit {
+			break
+		}
+	}
+	sortProjectMatches(matches)
+	if len(matches) > limit+1 {
+		matches = matches[:limit+1]
+	}
+	return matches, nil
+}
+
+// parseGrepLine parses a line of output from "rg --null" or "grep -Z", on the form "filename\x00linenumber:contents".
+// Returns false if the line could not be parsed, if the file is ignored, or if the line does not match
+// the regular expression, since the syntax that rg supports is not exactly the same as for Go.
+func parseGrepLine(re *regexp.Regexp, line []byte, im *IgnoreMatcher) (ProjectMatch, bool) {
+	fields := bytes.SplitN(line, []byte{0}, 2)
+	if len(fields) != 2 {
+		return ProjectMatch{}, false
+	}
+	filename := filepath.ToSlash(filepath.Clean(string(fields[0])))
+	lineNumberAndContents := strings.SplitN(string(fields[1]), ":", 2)
+	if len(lineNumberAndContents) != 2 {
+		return ProjectMatch{}, false
+	}
+	lineNumber, err := strconv.Atoi(lineNumberAndContents[0])
+	if err != nil {
+		return ProjectMatch{}, false
+	}
+	if projectPathIgnored(filename, false, im) {
+		return ProjectMatch{}, false
+	}
+	contents := strings.TrimSuffix(lineNumberAndContents[1], "\r")
+	if !re.MatchString(contents) {
+		return ProjectMatch{}, false
+	}
+	return newProjectMatch(re, filename, LineNumber(lineNumber), contents), true
+}
+
+// parseGrepOutput parses the output from "rg --null" or "grep -Z". Matches in ignored files are skipped.
+func parseGrepOutput(re *regexp.Regexp, output []byte, im *IgnoreMatcher) []ProjectMatch {
+	var matches []ProjectMatch
+	for _, line := range bytes.Split(output, []byte{'\n'}) {
+		if m, ok := parseGrepLine(re, line, im); ok {
+			matches = append(matches, m)
+		}
+	}
+	sortProjectMatches(matches)
+	return matches
+}
+
+// projectSearchExternal searches the project root by using either "rg" or "grep".
+// grep is only used for literal searches, since its regular expressions are too different from the ones in Go.
+// The search is stopped once more than limit matches have been found.
+func projectSearchExternal(root, pattern string, literal bool, re *regexp.Regexp, im *IgnoreMatcher, limit int) ([]ProjectMatch, error) {
+	var cmd *exec.Cmd
+	if rgPath := which("rg"); rgPath != "" {
+		args := []string{"--null", "--line-number", "--no-heading", "--color", "never", "--max-filesize", strconv.Itoa(maxProjectSearchFileSize)}
+		if literal {
+			args = append(args, "--fixed-strings")
+		}
+		args = append(args, "-e", pattern, ".")
+		cmd = exec.Command(rgPath, args...)
+	} else if grepPath := which("grep"); grepPath != "" && literal {
+		args := []string{"-rnIZF", "--exclude-dir=.[!.]*", "--exclude=.*"}
+		for _, dirName := range generatedDirectories {
+			args = append(args, "--exclude-dir="+dirName)
+		}
+		args = append(args, "-e", pattern, ".")
+		cmd = exec.Command(grepPath, args...)
+	} else if literal {
+		return nil, errors.New("found neither rg nor grep")
+	} else {
+		return nil, errors.New("rg is needed for searching with a regular expression")
+	}
+	cmd.Dir = root
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// Read the matches as they are found, so that the search can be stopped early
+	matches := []ProjectMatch{}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxProjectSearchFileSize+1024)
+	for len(matches) <= limit && scanner.Scan() {
+		if m, ok := parseGrepLine(re, scanner.Bytes(), im); ok {
+			matches = append(matches, m)
+		}
+	}
+	scanErr := scanner.Err()
+	enough := len(matches) > limit
+	if enough || scanErr != nil {
+		cmd.Process.Kill()
+	}
+	err = cmd.Wait()
+	switch {
+	case enough:
+		// The process was stopped on purpose
+	case scanErr != nil:
+		return nil, scanErr
+	case err != nil:
+		// Both rg and grep exits with status 1 if there are no matches
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return []ProjectMatch{}, nil
+		}
+		return nil, err
+	}
+	sortProjectMatches(matches)
+	return matches, nil
+}
+
+// NewProjectSearch searches all files in the given project root directory for the given pattern.
+// "rg" or "grep" is used if available, with a fallback to searching with goroutines.
+// The matches are always checked with the Go regular expression.
+func NewProjectSearch(root, pattern string, literal bool) (*ProjectSearch, error) {
+	re, err := compileProjectSearchPattern(pattern, literal)
+	if err != nil {
+		return nil, err
+	}
+	defer operations.Start("searching")()
+	im, err := LoadIgnoreMatcher(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		im = NewIgnoreMatcher([]string{})
+	}
+	matches, err := projectSearchExternal(root, pattern, literal, re, im, maxProjectSearchMatches)
+	if err != nil {
+		if matches, err = projectSearchInternal(root, re, im, maxProjectSearchMatches); err != nil {
+			return nil, err
+		}
+	}
+	truncated := len(matches) > maxProjectSearchMatches
+	if truncated {
+		matches = matches[:maxProjectSearchMatches]
+	}
+	return &ProjectSearch{re: re, root: root, pattern: pattern, matches: matches, literal: literal, truncated: truncated}, nil
+}
+
+// Len returns the number of matches
+func (ps *ProjectSearch) Len() int {
+	return len(ps.matches)
+}
+
+// Current returns the currently selected match
+func (ps *ProjectSearch) Current() (ProjectMatch, error) {
+	if len(ps.matches) == 0 {
+		return ProjectMatch{}, errNoProjectSearchMatch
+	}
+	return ps.matches[ps.index], nil
+}
+
+// Next selects the next match, wrapping around at the end
+func (ps *ProjectSearch) Next() (ProjectMatch, error) {
+	if len(ps.matches) == 0 {
+		return ProjectMatch{}, errNoProjectSearchMatch
+	}
+	ps.index = (ps.index + 1) % len(ps.matches)
+	return ps.matches[ps.index], nil
+}
+
+// Prev selects the previous match, wrapping around at the start
+func (ps *ProjectSearch) Prev() (ProjectMatch, error) {
+	if len(ps.matches) == 0 {
+		return ProjectMatch{}, errNoProjectSearchMatch
+	}
+	ps.index = (ps.index - 1 + len(ps.matches)) % len(ps.matches)
+	return ps.matches[ps.index], nil
+}
+
+// GoToProjectMatch opens the file of the given match, if it is not already open, and moves to the match
+func (e *Editor) GoToProjectMatch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, ps *ProjectSearch, m ProjectMatch) error {
+	absFilename := filepath.Join(ps.root, filepath.FromSlash(m.filename))
+	if currentAbsFilename, err := e.AbsFilename(); err != nil || currentAbsFilename != absFilename {
+		if err := e.Switch(c, tty, status, fileLock, absFilename, false); err != nil {
+			return err
+		}
+	}
+	e.MoveToLineColumnNumber(c, status, int(m.lineNumber), int(m.col.ColNumber()), false)
+	e.redraw = true
+	e.redrawCursor = true
+	status.SetMessageAfterRedraw(fmt.Sprintf("%d/%d %s:%d", ps.index+1, ps.Len(), m.filename, m.lineNumber))
+	return nil
+}
+
+// drawProjectMatch draws a single line in the results overlay, with the match highlighted
+func (e *Editor) drawProjectMatch(bt *BoxTheme, c *vt100.Canvas, x, y, w int, ps *ProjectSearch, m ProjectMatch, selected bool) {
+	prefix := "  "
+	if selected {
+		prefix = "> "
+	}
+	location := prefix + m.filename + ":" + m.lineNumber.String() + ": "
+	line := strings.TrimSpace(m.line)
+	textColor := *bt.Text
+	if selected {
+		textColor = *bt.Highlight
+	}
+	runes := []rune(location + line)
+	var matchStart, matchStop int
+	if loc := ps.re.FindStringIndex(line); loc != nil {
+		matchStart = len([]rune(location)) + len([]rune(line[:loc[0]]))
+		matchStop = matchStart + len([]rune(line[loc[0]:loc[1]]))
+	}
+	for i := 0; i < w; i++ {
+		r := ' '
+		if i < len(runes) {
+			r = runes[i]
+		}
+		if i >= matchStart && i < matchStop {
+			c.WriteRune(uint(x+i), uint(y), e.SearchHighlight, *bt.Background, r)
+		} else {
+			c.WriteRune(uint(x+i), uint(y), textColor, *bt.Background, r)
+		}
+	}
+}
+
+// ListOverlay displays a scrollable list of count items in a box, where drawItem draws a single item.
+// Returns the index of the selected item, and false if the overlay was cancelled.
+func (e *Editor) ListOverlay(c *vt100.Canvas, tty *vt100.TTY, title string, count, initialIndex int, drawItem func(bt *BoxTheme, index, x, y, w int, selected bool)) (int, bool) {
+	var (
+		canvasBox = NewCanvasBox(c)
+		bt        = e.NewBoxTheme()
+		outerBox  = NewBox()
+		listBox   = NewBox()
+		selected  = initialIndex
+		scrollY   = 0
+	)
+	outerBox.FillWithMargins(canvasBox, 2, 1)
+	listBox.FillWithMargins(outerBox, 2, 1)
+	for {
+		// Scroll the list so that the selected item is visible
+		if selected < scrollY {
+			scrollY = selected
+		} else if selected >= scrollY+listBox.H {
+			scrollY = selected - listBox.H + 1
+		}
+		e.DrawBox(bt, c, outerBox)
+		e.DrawTitle(bt, c, outerBox, title)
+		for i := 0; i < listBox.H && scrollY+i < count; i++ {
+			index := scrollY + i
+			drawItem(bt, index, listBox.X, listBox.Y+i, listBox.W, index == selected)
+		}
+		c.Draw()
+
+		switch readKey(tty) {
+		case "↑", "c:16": // up or ctrl-p
+			if selected > 0 {
+				selected--
+			}
+		case "↓", "c:14": // down or ctrl-n
+			if selected < count-1 {
+				selected++
+			}
+		case "←": // left, one page up
+			selected -= listBox.H
+			if selected < 0 {
+				selected = 0
+			}
+		case "→": // right, one page down
+			selected += listBox.H
+			if selected > count-1 {
+				selected = count - 1
+			}
+		case "c:1": // ctrl-a, first item
+			selected = 0
+		case "c:5": // ctrl-e, last item
+			selected = count - 1
+		case "c:13": // return
+			return selected, true
+		case "c:27", "q", "c:3", "c:17": // esc, q, ctrl-c or ctrl-q
+			return -1, false
+		}
+	}
+}
+
+// ProjectSearchOverlay displays a scrollable list of matches and lets the user select one.
+// Returns the index of the selected match, and false if the overlay was cancelled.
+func (e *Editor) ProjectSearchOverlay(c *vt100.Canvas, tty *vt100.TTY, ps *ProjectSearch) (int, bool) {
+	title := fmt.Sprintf("%d matches for %s", ps.Len(), ps.pattern)
+	if ps.truncated {
+		title = fmt.Sprintf("The first %d matches for %s (truncated)", ps.Len(), ps.pattern)
+	}
+	return e.ListOverlay(c, tty, title, ps.Len(), ps.index, func(bt *BoxTheme, index, x, y, w int, selected bool) {
+		e.drawProjectMatch(bt, c, x, y, w, ps, ps.matches[index], selected)
+	})
+}
+
+// ProjectSearchPrompt asks the user for a search pattern, searches the project and displays the results.
+// If the pattern starts with "/", the rest is used as a regular expression.
+func (e *Editor) ProjectSearchPrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	pattern, ok := e.UserInput(c, tty, status, "Search in project (prefix with / for regex)", []string{}, false)
+	if !ok || pattern == "" {
+		e.redraw = true
+		e.redrawCursor = true
+		return
+	}
+	literal := true
+	if strings.HasPrefix(pattern, "/") && len(pattern) > 1 {
+		pattern = pattern[1:]
+		literal = false
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	root := findProjectRoot(filepath.Dir(absFilename))
+
+	status.SetMessage("Searching in " + root + "...")
+	status.ShowUntilRedraw(c, e)
+
+	ps, err := NewProjectSearch(root, pattern, literal)
+	status.ClearAll(c)
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	if ps.Len() == 0 {
+		status.SetMessage(pattern + " not found in " + root)
+		status.Show(c, e)
+		return
+	}
+	projectSearch = ps
+	e.ShowProjectSearch(c, tty, status)
+}
+
+// ShowProjectSearch displays the results overlay for the last project search, if any, and jumps to the selected match
+func (e *Editor) ShowProjectSearch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	if projectSearch == nil || projectSearch.Len() == 0 {
+		status.SetMessage("No project search results")
+		status.Show(c, e)
+		return
+	}
+	index, ok := e.ProjectSearchOverlay(c, tty, projectSearch)
+	e.redraw = true
+	e.redrawCursor = true
+	if !ok {
+		return
+	}
+	projectSearch.index = index
+	if err := e.GoToProjectMatch(c, tty, status, projectSearch, projectSearch.matches[index]); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+	}
+}
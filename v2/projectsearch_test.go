@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGrepOutput(t *testing.T) {
+	re, err := compileProjectSearchPattern("hello", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := []byte("./a.go\x003:\tfmt.Println(\"hello\")\nsub/b:c.txt\x0010:say hello: there\r\nnode_modules/x.js\x001:hello\nc.txt\x002:goodbye\ngarbage\n")
+	matches := parseGrepOutput(re, output, NewIgnoreMatcher([]string{}))
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d: %v", len(matches), matches)
+	}
+	if matches[0].filename != "a.go" || matches[0].lineNumber != 3 || matches[0].col != 14 {
+		t.Errorf("unexpected first match: %+v", matches[0])
+	}
+	if matches[1].filename != "sub/b:c.txt" || matches[1].lineNumber != 10 || matches[1].line != "say hello: there" {
+		t.Errorf("unexpected second match: %+v", matches[1])
+	}
+}
+
+func TestProjectSearch(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"main.go":                "package main\n\nfunc main() {\n\tprintln(\"needle\")\n}\n",
+		"docs/readme.md":         "# Needle\n\nA needle in a haystack.\n",
+		"node_modules/x/y.js":    "needle\n",
+		"out/generated.txt":      "needle\n",
+		".hidden/secret.txt":     "needle\n",
+		"binary.dat":             "needle\n" + strings.Repeat("\x00\x01\x02\xff", 64),
+		".gitignore":             "out/\n",
+		"docs/nothing/empty.txt": "",
+	}
+	for filename, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	re, err := compileProjectSearchPattern("needle", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := LoadIgnoreMatcher(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docs/readme.md:3: A needle in a haystack.", "main.go:4: println(\"needle\")"}
+	check := func(name string, matches []ProjectMatch) {
+		if len(matches) != len(expected) {
+			t.Fatalf("%s: expected %d matches, got %d: %v", name, len(expected), len(matches), matches)
+		}
+		for i, m := range matches {
+			if m.String() != expected[i] {
+				t.Errorf("%s: expected %q, got %q", name, expected[i], m.String())
+			}
+		}
+	}
+	matches, err := projectSearchInternal(root, re, im, maxProjectSearchMatches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("internal", matches)
+	if which("rg") != "" || which("grep") != "" {
+		matches, err = projectSearchExternal(root, "needle", true, re, im, maxProjectSearchMatches)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("external", matches)
+	}
+	ps, err := NewProjectSearch(root, "ne+dle", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("regexp", ps.matches)
+	if m, _ := ps.Next(); m.filename != "main.go" {
+		t.Errorf("expected the next match to be in main.go, got %s", m.filename)
+	}
+	if m, _ := ps.Next(); m.filename != "docs/readme.md" {
+		t.Errorf("expected the matches to wrap around, got %s", m.filename)
+	}
+	// The pattern uses the syntax of Go regular expressions, which "grep -E" does not support
+	ps, err = NewProjectSearch(root, `n\w{2}dle\b`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("go regexp", ps.matches)
+}
+
+func TestProjectSearchLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 200; i++ {
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("%03d.txt", i)), []byte("needle\nneedle\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	re, err := compileProjectSearchPattern("needle", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := NewIgnoreMatcher([]string{})
+	// One match more than the limit is returned, so that the results can be marked as truncated
+	matches, err := projectSearchInternal(root, re, im, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 4 {
+		t.Errorf("expected the internal search to stop after 4 matches, got %d", len(matches))
+	}
+	// The matches that are kept are the first ones in sorted order, no matter which files were searched first
+	for i := 0; i < 20; i++ {
+		matches, err := projectSearchInternal(root, re, im, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 4 || matches[0].filename != "000.txt" || matches[2].filename != "001.txt" || matches[3].lineNumber != 2 {
+			t.Fatalf("expected the first 4 matches in sorted order, got %+v", matches)
+		}
+	}
+	if which("rg") != "" || which("grep") != "" {
+		matches, err = projectSearchExternal(root, "needle", true, re, im, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 4 {
+			t.Errorf("expected the external search to stop after 4 matches, got %d", len(matches))
+		}
+	}
+	ps, err := NewProjectSearch(root, "needle", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.Len() != 400 || ps.truncated {
+		t.Errorf("expected all 400 matches, got %d (truncated: %v)", ps.Len(), ps.truncated)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"strings"
+	"time"
+
 	"github.com/xyproto/vt100"
 )
 
@@ -23,15 +26,12 @@ func (e *Editor) FullResetRedraw(c *vt100.Canvas, status *StatusBar, drawLines,
 	newC := vt100.NewCanvas()
 	newC.ShowCursor()
 	vt100.EchoOff()
+	EnableMouse()
 	w := int(newC.Width())
 
 	resizeMut.Unlock()
 
-	if w < e.wrapWidth {
-		e.wrapWidth = w
-	} else if e.wrapWidth < 80 && w >= 80 {
-		e.wrapWidth = w
-	}
+	e.wrapWidth = clampWrapWidth(e.wrapWidth, w)
 
 	if drawLines {
 		e.DrawLines(c, true, e.sshMode)
@@ -50,11 +50,7 @@ func (e *Editor) FullResetRedraw(c *vt100.Canvas, status *StatusBar, drawLines,
 
 	resizeMut.Unlock()
 
-	if w < e.wrapWidth {
-		e.wrapWidth = w
-	} else if e.wrapWidth < 80 && w >= 80 {
-		e.wrapWidth = w
-	}
+	e.wrapWidth = clampWrapWidth(e.wrapWidth, w)
 
 	if drawLines {
 		e.DrawLines(c, true, e.sshMode)
@@ -73,6 +69,15 @@ func (e *Editor) FullResetRedraw(c *vt100.Canvas, status *StatusBar, drawLines,
 	}
 
 	e.pos = savePos
+
+	// The cursor may end up below the bottom when the terminal is made smaller
+	if drawLines && !terminalTooSmall(c.W(), c.H()) {
+		e.KeepCursorWithinCanvas(c)
+		if e.redraw {
+			e.RedrawIfNeeded(c)
+			e.RepositionCursorIfNeeded()
+		}
+	}
 }
 
 // RedrawIfNeeded will redraw the text on the canvas if e.redraw is set
@@ -97,7 +102,7 @@ func (e *Editor) RepositionCursor(x, y int) {
 func (e *Editor) RepositionCursorIfNeeded() {
 	// Redraw the cursor, if needed
 	x := e.pos.ScreenX()
-	y := e.pos.ScreenY()
+	y := e.pos.ScreenY() + e.topRows()
 	if e.redrawCursor || x != e.previousX || y != e.previousY {
 		e.RepositionCursor(x, y)
 		e.redrawCursor = false
@@ -106,6 +111,10 @@ func (e *Editor) RepositionCursorIfNeeded() {
 
 // DrawLines will draw a screen full of lines on the given canvas
 func (e *Editor) DrawLines(c *vt100.Canvas, respectOffset, redrawCanvas bool) {
+	if terminalTooSmall(c.W(), c.H()) {
+		e.DrawTooSmall(c)
+		return
+	}
 	h := int(c.Height())
 	if respectOffset {
 		offsetY := e.pos.OffsetY()
@@ -150,15 +159,62 @@ func (e *Editor) InitialRedraw(c *vt100.Canvas, status *StatusBar) {
 	e.RepositionCursorIfNeeded()
 }
 
+// persistentStatusMessage returns a status message that should be shown whenever no other status message is shown
+func (e *Editor) persistentStatusMessage() string {
+	var msgs []string
+	if e.drawMode {
+		msgs = append(msgs, "DRAW")
+	} else if e.overwriteMode {
+		msgs = append(msgs, "OVR")
+	}
+	if e.generatedFile {
+		msgs = append(msgs, generatedFileWarning)
+	}
+	if e.secretsFound {
+		if e.redactSecrets {
+			msgs = append(msgs, secretsWarning+" (hidden)")
+		} else {
+			msgs = append(msgs, secretsWarning+" (revealed)")
+		}
+	}
+	return strings.Join(msgs, " - ")
+}
+
 // RedrawAtEndOfKeyLoop is called after each main loop
 func (e *Editor) RedrawAtEndOfKeyLoop(c *vt100.Canvas, status *StatusBar) {
 
+	// Only draw a message if the terminal is too small for the editor to be usable
+	if terminalTooSmall(c.W(), c.H()) {
+		e.DrawTooSmall(c)
+		return
+	}
+
 	redrawCanvas := !e.debugMode
 
+	// The cursor should not end up below the bottom, when the lines are shifted down by the column ruler
+	e.KeepCursorAboveRulerShift(c)
+
+	// The crosshair and the highlighted ruler column follow the cursor
+	if (e.showCrosshair || e.showRuler) && e.pos.sx != e.previousX {
+		e.redraw = true
+	}
+
+	// The highlighted current line follows the cursor
+	if highlightCurrentLine && e.pos.sy != e.previousY {
+		e.redraw = true
+	}
+
+	// Hide what looks like a secret as soon as it has been typed or pasted
+	e.CheckCurrentLineForSecrets()
+
 	// Redraw, if needed
 	if e.redraw {
-		// Draw the editor lines on the canvas, respecting the offset
-		e.DrawLines(c, true, redrawCanvas)
+		// Progress messages are only shown until the lines are drawn again
+		status.Redrawn()
+		// Draw only the changed lines, if possible, or all the editor lines on the canvas, respecting the offset
+		if !e.DrawChangedLines(c) {
+			e.DrawLines(c, true, redrawCanvas)
+		}
 		e.redraw = false
 	} else if e.Changed() {
 		c.Draw()
@@ -167,11 +223,14 @@ func (e *Editor) RedrawAtEndOfKeyLoop(c *vt100.Canvas, status *StatusBar) {
 	// Drawing status messages should come after redrawing, but before cursor positioning
 	if e.statusMode {
 		status.ShowLineColWordCount(c, e, e.filename)
-	} else if status.IsError() {
-		// Show the status message, if *statusMessage is not set
-		if status.messageAfterRedraw == "" {
-			status.Show(c, e)
-		}
+	} else if msg := e.persistentStatusMessage(); msg != "" && status.messageAfterRedraw == "" && status.Message() == "" {
+		// Keep on showing the overwrite mode indicator, or warning about editing a generated or ignored file or secrets
+		status.SetMessage(msg)
+		status.ShowNoTimeout(c, e)
+	} else if status.messageAfterRedraw == "" {
+		// Draw the current status message again, in case the lines were drawn on top of it,
+		// or draw the status row again if the message was cleared by a keypress
+		status.Refresh(c, e)
 	}
 
 	if status.messageAfterRedraw != "" {
@@ -181,5 +240,11 @@ func (e *Editor) RedrawAtEndOfKeyLoop(c *vt100.Canvas, status *StatusBar) {
 		status.Show(c, e)
 	}
 
+	// Draw the name of the active operation, like building, or the clock, at the right side of the status bar
+	if text := operationSegment(operations, time.Now(), 0, showClock); text != "" {
+		e.DrawOperationSegment(c, text)
+		c.Draw()
+	}
+
 	e.RepositionCursorIfNeeded()
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+var errNoReindent = errors.New("reindenting is only available for languages with curly braces or significant indentation")
+
+// bracketDepth returns the indentation depth for the given open brackets, where brackets that were opened on
+// the same line only count once, like for "foo({"
+func bracketDepth(stack []openBracket) int {
+	depth := 0
+	for i, b := range stack {
+		if i == 0 || b.y != stack[i-1].y {
+			depth++
+		}
+	}
+	return depth
+}
+
+// reindentBraces returns the lines in the given range, indented by how many brackets are open at the start of each
+// line. Lines that start within a multi-line comment or string are returned unchanged.
+func (e *Editor) reindentBraces(r Range) []string {
+	stack, ok := e.openBracketsBefore(r.From)
+	q, err := e.newQuoteState()
+	if err != nil {
+		return e.RangeLines(r)
+	}
+	if !ok {
+		// The range starts within a multi-line comment or string, so process the lines above again to get the state
+		for y := LineIndex(0); y < r.From; y++ {
+			runes, _ := e.lineRunes(int(y))
+			processLineQuoteState(q, runes, nil)
+		}
+	}
+	var (
+		oneIndentation = e.indentation.String()
+		lines          = make([]string, 0, r.Len())
+	)
+	for y := r.From; y <= r.To; y++ {
+		line := e.Line(y)
+		q.hasSingleLineComment = false
+		startsInCode := q.None()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !startsInCode:
+			lines = append(lines, line)
+		case trimmed == "":
+			lines = append(lines, "")
+		case strings.HasPrefix(trimmed, "#") && (e.mode == mode.C || e.mode == mode.Cpp || e.mode == mode.Shader):
+			// Preprocessor directives start at the beginning of the line
+			lines = append(lines, trimmed)
+		default:
+			// Closing brackets at the start of the line belong to the indentation of the opening line
+			depthStack := stack
+			for _, r := range trimmed {
+				opening, ok := openingBrackets[r]
+				if !ok {
+					break
+				}
+				for j := len(depthStack) - 1; j >= 0; j-- {
+					if depthStack[j].r == opening {
+						depthStack = depthStack[:j]
+						break
+					}
+				}
+			}
+			depth := bracketDepth(depthStack)
+			if (strings.HasPrefix(trimmed, "case ") || strings.HasPrefix(trimmed, "default:")) && depth > 0 {
+				// Switch cases are at the same level as the switch
+				depth--
+			}
+			lines = append(lines, strings.Repeat(oneIndentation, depth)+trimmed)
+		}
+		runes, _ := e.lineRunes(int(y))
+		lineIndex := y
+		processLineQuoteState(q, runes, func(_ int, r rune) {
+			switch r {
+			case '{', '[', '(':
+				stack = append(stack, openBracket{r, lineIndex})
+			case '}', ']', ')':
+				for j := len(stack) - 1; j >= 0; j-- {
+					if stack[j].r == openingBrackets[r] {
+						stack = stack[:j]
+						break
+					}
+				}
+			}
+		})
+	}
+	return lines
+}
+
+// tripleQuotes returns the number of triple double and single quotes on the given line, for knowing if a multi-line
+// string starts or ends. Quotes in a comment are not counted, unless the line is within a multi-line string.
+func tripleQuotes(line string, inString bool) int {
+	if !inString && strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return 0
+	}
+	return strings.Count(line, `"""`) + strings.Count(line, "'''")
+}
+
+// reindentIndentation returns the lines in the given range, with the levels of indentation kept as they are, but with
+// one indentation per level. A line after a line that ends with ":" is always indented one level deeper,
+// and "else:", "elif", "except" and "finally" are dedented to match their statement. Lines within multi-line
+// strings and brackets are returned unchanged.
+func (e *Editor) reindentIndentation(r Range) []string {
+	inString := false
+	for y := LineIndex(0); y < r.From; y++ {
+		if tripleQuotes(e.Line(y), inString)%2 == 1 {
+			inString = !inString
+		}
+	}
+	var (
+		oneIndentation = e.indentation.String()
+		lines          = make([]string, 0, r.Len())
+		widths         []int // the original indentation widths of the enclosing levels
+		blockOpened    bool  // the previous line ended with ":"
+		continued      bool  // the previous line had an open bracket or ended with a backslash
+		brackets       int
+		ref            = NewSimpleEditor(0) // the reindented lines, for finding the statements of clauses
+	)
+	ref.mode = e.mode
+	ref.indentation = e.indentation
+	// Keep the indentation of the first line, for when a block within a function or class is reindented
+	base := e.indentationWidth(e.LeadingWhitespaceAt(r.From))
+	prefix := strings.Repeat(oneIndentation, base/e.indentation.PerTab)
+	widths = append(widths, base)
+	for y := r.From; y <= r.To; y++ {
+		line := e.Line(y)
+		trimmed := strings.TrimSpace(line)
+		n := tripleQuotes(line, inString)
+		comment := false
+		switch {
+		case inString || continued:
+			lines = append(lines, line)
+		case trimmed == "":
+			lines = append(lines, "")
+		case strings.HasPrefix(trimmed, "#"):
+			// Comments are indented to the level of the code that they are closest to, and do not open or close levels
+			w, depth := e.indentationWidth(line[:len(line)-len(strings.TrimLeft(line, " \t"))]), 0
+			for i, width := range widths {
+				if width <= w {
+					depth = i
+				}
+			}
+			if blockOpened && len(widths) > 0 && w > widths[len(widths)-1] {
+				depth = len(widths)
+			}
+			lines = append(lines, prefix+strings.Repeat(oneIndentation, depth)+trimmed)
+			comment = true
+		default:
+			w := e.indentationWidth(line[:len(line)-len(strings.TrimLeft(line, " \t"))])
+			if blockOpened && (len(widths) == 0 || w <= widths[len(widths)-1]) {
+				// The line must be indented deeper than the line that opened the block
+				w = 1
+				if len(widths) > 0 {
+					w = widths[len(widths)-1] + 1
+				}
+			}
+			for len(widths) > 0 && w < widths[len(widths)-1] {
+				widths = widths[:len(widths)-1]
+			}
+			if len(widths) == 0 || w > widths[len(widths)-1] {
+				widths = append(widths, w)
+			}
+			indented := prefix + strings.Repeat(oneIndentation, len(widths)-1) + trimmed
+			// Dedent else, elif, except and finally to match the reindented statements above
+			ref.lines = append(ref.lines, []rune(indented))
+			ref.pos.sy = len(ref.lines) - 1
+			if whitespace, ok := ref.PythonClauseIndentation(); ok {
+				indented = whitespace + trimmed
+				ref.lines[len(ref.lines)-1] = []rune(indented)
+				for len(widths) > 1 && e.indentationWidth(prefix+strings.Repeat(oneIndentation, len(widths)-1)) > e.indentationWidth(whitespace) {
+					widths = widths[:len(widths)-1]
+				}
+			}
+			lines = append(lines, indented)
+		}
+		if n%2 == 1 {
+			inString = !inString
+		}
+		if !inString && trimmed != "" && !comment {
+			code := strings.TrimSpace(e.StripSingleLineComment(trimmed))
+			brackets += strings.Count(code, "(") + strings.Count(code, "[") + strings.Count(code, "{")
+			brackets -= strings.Count(code, ")") + strings.Count(code, "]") + strings.Count(code, "}")
+			if brackets < 0 {
+				brackets = 0
+			}
+			continued = brackets > 0 || strings.HasSuffix(code, "\\")
+			blockOpened = !continued && strings.HasSuffix(code, ":")
+		}
+	}
+	return lines
+}
+
+// Reindent reindents the lines in the given range, using the brackets for languages with curly braces,
+// and the indentation levels and keywords for languages like Python. Returns the number of changed lines.
+func (e *Editor) Reindent(r Range, bookmark *Position) (int, error) {
+	var lines []string
+	switch {
+	case braceLanguage(e.mode):
+		lines = e.reindentBraces(r)
+	case indentationLanguage(e.mode):
+		lines = e.reindentIndentation(r)
+	default:
+		return 0, errNoReindent
+	}
+	changed := 0
+	for i, line := range lines {
+		if line != e.Line(r.From+LineIndex(i)) {
+			changed++
+		}
+	}
+	if changed > 0 {
+		e.ReplaceRange(r, lines, bookmark)
+		if e.AfterEndOfLine() {
+			e.End(nil)
+		}
+		e.redraw = true
+		e.redrawCursor = true
+	}
+	return changed, nil
+}
+
+// reindentCommand reindents the given range as one undo step, and tells how many lines were changed
+func (e *Editor) reindentCommand(c *vt100.Canvas, status *StatusBar, bookmark *Position, undo *Undo, r Range) {
+	if r.Empty() {
+		status.SetErrorMessage("no text block at the current position")
+		return
+	}
+	y := e.LineIndex()
+	undo.Snapshot(e)
+	changed, err := e.Reindent(r, bookmark)
+	if err != nil {
+		status.ShowErrorAfterRedraw(err)
+		return
+	}
+	e.GoTo(y, c, status)
+	switch changed {
+	case 0:
+		status.SetMessageAfterRedraw("Already indented")
+	case 1:
+		status.SetMessageAfterRedraw("Reindented 1 line")
+	default:
+		status.SetMessageAfterRedraw(fmt.Sprintf("Reindented %d lines", changed))
+	}
+}
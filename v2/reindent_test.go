@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestReindentBraces(t *testing.T) {
+	discardStdout(t)
+	tests := []struct {
+		contents string
+		want     string
+	}{
+		{"func main() {\nf()\n    if x {\n  g()\n}\n}", "func main() {\n\tf()\n\tif x {\n\t\tg()\n\t}\n}"},
+		// Switch cases are at the level of the switch
+		{"switch x {\n\t\tcase 1:\nf()\ndefault:\ng()\n}", "switch x {\ncase 1:\n\tf()\ndefault:\n\tg()\n}"},
+		// Several brackets opened on the same line only indent one level
+		{"f(func() {\ng()\n})", "f(func() {\n\tg()\n})"},
+		// Multi-line comments and strings are left as they are
+		{"func main() {\n/*\n  {\n*/\ns := `\n  x\n`\n}", "func main() {\n\t/*\n  {\n*/\n\ts := `\n  x\n`\n}"},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.mode = mode.Go
+		e.LoadBytes([]byte(test.contents))
+		e.indentation.Spaces = false
+		if _, err := e.Reindent(e.WholeFile(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(e.RangeLines(e.WholeFile()), "\n"); got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.contents, test.want, got)
+		}
+	}
+}
+
+func TestReindentPython(t *testing.T) {
+	discardStdout(t)
+	tests := []struct {
+		contents string
+		want     string
+	}{
+		{"def f():\n  if x:\n      g()\n  else:\n      h()\n  return 1", "def f():\n    if x:\n        g()\n    else:\n        h()\n    return 1"},
+		// Tabs are replaced, and the line after a colon is always indented
+		{"if x:\n\tf()\nfor y in z:\ng(y)", "if x:\n    f()\nfor y in z:\n    g(y)"},
+		// Multi-line strings and continued lines are left as they are
+		{"def f():\n  s = \"\"\"\n x\n\"\"\"\n  g(1,\n 2)", "def f():\n    s = \"\"\"\n x\n\"\"\"\n    g(1,\n 2)"},
+		// Triple quotes in a comment do not start a string, but they can end one
+		{"def f():\n  # not ''' a string\n  g()\n  s = '''\n# '''\n  h()", "def f():\n    # not ''' a string\n    g()\n    s = '''\n# '''\n    h()"},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.mode = mode.Python
+		e.LoadBytes([]byte(test.contents))
+		e.indentation.Spaces = true
+		e.indentation.PerTab = 4
+		if _, err := e.Reindent(e.WholeFile(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(e.RangeLines(e.WholeFile()), "\n"); got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.contents, test.want, got)
+		}
+	}
+}
+
+func TestReindentBlock(t *testing.T) {
+	discardStdout(t)
+	e := NewSimpleEditor(80)
+	e.mode = mode.Python
+	e.LoadBytes([]byte("class A:\n    def f(self):\n      return 1\n\nx = 1"))
+	e.indentation.Spaces = true
+	e.indentation.PerTab = 4
+	changed, err := e.Reindent(e.BlockAt(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The block keeps the indentation of its first line, and the lines after it are not changed
+	if want := "class A:\n    def f(self):\n        return 1\n\nx = 1"; changed != 1 || strings.Join(e.RangeLines(e.WholeFile()), "\n") != want {
+		t.Errorf("expected %q with 1 changed line, got %q with %d", want, strings.Join(e.RangeLines(e.WholeFile()), "\n"), changed)
+	}
+	e.mode = mode.Markdown
+	if _, err := e.Reindent(e.WholeFile(), nil); err != errNoReindent {
+		t.Errorf("expected errNoReindent for Markdown, got %v", err)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"path/filepath"
 	"strings"
 
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
 	"go4.org/bytereplacer"
 )
 
@@ -31,3 +34,69 @@ var opinionatedByteReplacer = bytereplacer.New(
 	// Replace any remaining \r characters with \n
 	string([]byte{'\r'}), string([]byte{'\n'}),
 )
+
+// lineEndingStringReplacer only replaces \r\n and \r, for when the other opinionated replacements are disabled
+var lineEndingStringReplacer = strings.NewReplacer(
+	string([]byte{'\r', '\n'}), string([]byte{'\n'}),
+	string([]byte{'\r'}), string([]byte{'\n'}),
+)
+
+// lineEndingByteReplacer only replaces \r\n and \r, for when the other opinionated replacements are disabled
+var lineEndingByteReplacer = bytereplacer.New(
+	string([]byte{'\r', '\n'}), string([]byte{'\n'}),
+	string([]byte{'\r'}), string([]byte{'\n'}),
+)
+
+// fixtureDirectories are directories where files often contain non-breaking spaces or odd characters on purpose
+var fixtureDirectories = []string{"testdata", "fixtures", "__fixtures__", "golden"}
+
+// keepCharactersByDefault checks if non-breaking spaces and odd characters should be kept in the given file,
+// since it is a test fixture, or a data or config file where the exact bytes are likely to matter
+func keepCharactersByDefault(filename string, m mode.Mode) bool {
+	switch m {
+	case mode.Blank, mode.Config, mode.JSON, mode.Log, mode.PolicyLanguage, mode.XML:
+		return true
+	}
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(filename)), "/") {
+		if hasS(fixtureDirectories, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringReplacer returns the replacer for text that is saved, pasted or inserted.
+// Only the line endings are replaced if non-breaking spaces and odd characters should be kept.
+func (e *Editor) stringReplacer() *strings.Replacer {
+	if e.keepCharacters {
+		return lineEndingStringReplacer
+	}
+	return opinionatedStringReplacer
+}
+
+// byteReplacer returns the replacer for data that is loaded.
+// Only the line endings are replaced if non-breaking spaces and odd characters should be kept.
+func (e *Editor) byteReplacer() *bytereplacer.Replacer {
+	if e.keepCharacters {
+		return lineEndingByteReplacer
+	}
+	return opinionatedByteReplacer
+}
+
+// ToggleKeepCharacters toggles if non-breaking spaces and odd characters are kept when loading and saving.
+// When they should be kept, an unchanged file is loaded again, to get back the characters that were replaced.
+func (e *Editor) ToggleKeepCharacters(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) {
+	e.keepCharacters = !e.keepCharacters
+	if !e.keepCharacters {
+		status.SetMessageAfterRedraw("Non-breaking spaces and odd characters will be replaced when saving")
+		return
+	}
+	if !e.changed && exists(e.filename) {
+		if err := e.Reload(c, tty, status, undo); err != nil {
+			status.SetError(err)
+			status.Show(c, e)
+			return
+		}
+	}
+	status.SetMessageAfterRedraw("Keeping non-breaking spaces and odd characters")
+}
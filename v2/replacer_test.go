@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestKeepCharactersByDefault(t *testing.T) {
+	tests := []struct {
+		filename string
+		m        mode.Mode
+		expected bool
+	}{
+		{"main.go", mode.Go, false},
+		{"README.md", mode.Markdown, false},
+		{"config.toml", mode.Config, true},
+		{"strings.json", mode.JSON, true},
+		{"testdata/input.txt", mode.Text, true},
+		{"/src/project/fixtures/nbsp.md", mode.Markdown, true},
+		{"notes/fixturesmd/a.txt", mode.Text, false},
+	}
+	for _, test := range tests {
+		if keep := keepCharactersByDefault(test.filename, test.m); keep != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.filename, test.expected, keep)
+		}
+	}
+}
+
+func TestKeepCharactersRoundTrip(t *testing.T) {
+	original := []byte("non\xc2\xa0breaking\r\nodd a\xcc\x88 tilde\r\n")
+	filename := filepath.Join(t.TempDir(), "fixture.txt")
+	if err := os.WriteFile(filename, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	load := func(keep bool) *Editor {
+		e := NewSimpleEditor(80)
+		e.filename = filename
+		e.keepCharacters = keep
+		if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// Loading and saving with the characters kept gives the same bytes
+	e := load(true)
+	if e.Line(0) != "non\u00a0breaking" {
+		t.Errorf("expected the non-breaking space to be kept, got %q", e.Line(0))
+	}
+	e.forceSave = true
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); !bytes.Equal(data, original) {
+		t.Errorf("expected the file to be byte-identical, got %q", data)
+	}
+
+	// By default, the characters are replaced
+	e = load(false)
+	if e.Line(0) != "non breaking" || e.Line(1) != "odd a~ tilde" {
+		t.Errorf("expected the characters to be replaced, got %q and %q", e.Line(0), e.Line(1))
+	}
+
+	// Keeping the characters loads an unchanged file again
+	c := vt100.NewCanvas()
+	status := testStatusBar(e)
+	e.ToggleKeepCharacters(c, nil, status, NewUndo(10, defaultUndoMemory))
+	if !e.keepCharacters || e.Line(0) != "non\u00a0breaking" {
+		t.Errorf("expected the file to be loaded again with the characters kept, got %q", e.Line(0))
+	}
+}
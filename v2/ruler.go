@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/xyproto/vt100"
+)
+
+// rulerLine returns a column ruler of the given width, for when the view is scrolled offsetX columns to the right.
+// Every 5th column is marked with '+' and every 10th column with the column number, right aligned to that column.
+func rulerLine(offsetX, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	ruler := make([]rune, width)
+	for i := range ruler {
+		colNumber := offsetX + i + 1
+		if colNumber%5 == 0 {
+			ruler[i] = '+'
+		} else {
+			ruler[i] = '.'
+		}
+	}
+	// Write the column numbers, also for numbers that end just after the right edge
+	for i := 0; i < width+10; i++ {
+		colNumber := offsetX + i + 1
+		if colNumber%10 != 0 {
+			continue
+		}
+		digits := []rune(strconv.Itoa(colNumber))
+		for j, r := range digits {
+			x := i - (len(digits) - 1) + j
+			if x >= 0 && x < width {
+				ruler[x] = r
+			}
+		}
+	}
+	return string(ruler)
+}
+
+// topRows returns the number of canvas rows above the first line of text, which is 1 when the column ruler is shown
+func (e *Editor) topRows() int {
+	if e.showRuler {
+		return 1
+	}
+	return 0
+}
+
+// WriteRuler draws the column ruler at the given canvas row
+func (e *Editor) WriteRuler(c *vt100.Canvas, cx, cy uint) {
+	w := int(c.Width()) - int(cx)
+	c.Write(cx, cy, e.StatusForeground, e.StatusBackground, rulerLine(e.pos.offsetX, w))
+	// Highlight the column of the cursor
+	if x := uint(e.pos.sx) + cx; x < c.Width() {
+		if r, err := c.At(x, cy); err == nil {
+			c.WriteRune(x, cy, e.SearchHighlight, e.StatusBackground, r)
+		}
+	}
+}
+
+// WriteCrosshair draws a vertical line at the column of the cursor, for the given number of canvas rows.
+// Blank cells are drawn as '│', while other runes are kept, but highlighted.
+func (e *Editor) WriteCrosshair(c *vt100.Canvas, cx, cy, rows uint) {
+	x := uint(e.pos.sx) + cx
+	if x >= c.Width() {
+		return
+	}
+	for y := cy; y < cy+rows && y < c.Height(); y++ {
+		r, err := c.At(x, y)
+		if err != nil {
+			break
+		}
+		if r == ' ' || r == 0 {
+			c.WriteRune(x, y, e.MultiLineComment, e.Background, '│')
+		} else {
+			c.WriteRune(x, y, e.SearchHighlight, e.Background, r)
+		}
+	}
+}
+
+// KeepCursorAboveRulerShift scrolls one line down if the cursor would be hidden below the bottom of the canvas,
+// since all lines are shifted one row down when the column ruler is shown
+func (e *Editor) KeepCursorAboveRulerShift(c *vt100.Canvas) {
+	if !e.showRuler || c == nil {
+		return
+	}
+	h := int(c.Height())
+	if e.pos.sy >= h-1 && h > 1 {
+		diff := e.pos.sy - (h - 2)
+		e.pos.offsetY += diff
+		e.pos.sy -= diff
+		e.redraw = true
+		e.redrawCursor = true
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRulerLine(t *testing.T) {
+	if s := rulerLine(0, 22); s != "....+...10....+...20.." {
+		t.Errorf("unexpected ruler: %q", s)
+	}
+	// When scrolled, the numbers should still match the columns
+	if s := rulerLine(95, 20); s != "..100....+..110....+" {
+		t.Errorf("unexpected scrolled ruler: %q", s)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+)
+
+// wideRunePlaceholder is written to the canvas cell after a wide rune, since the wide rune covers that cell as well.
+// It is a zero width space, so that the terminal emulator does not move the rest of the line to the right.
+const wideRunePlaceholder = '\u200b'
+
+// wideRuneRanges are the ranges of runes that take up two columns in a terminal emulator,
+// which are the East Asian wide and fullwidth runes, and the emoji that are shown as pictures by default
+var wideRuneRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC}, {0x23F0, 0x23F0}, {0x23F3, 0x23F3},
+	{0x25FD, 0x25FE}, {0x2614, 0x2615}, {0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE}, {0x26D4, 0x26D4}, {0x26EA, 0x26EA},
+	{0x26F2, 0x26F3}, {0x26F5, 0x26F5}, {0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797},
+	{0x27B0, 0x27B0}, {0x27BF, 0x27BF}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xA960, 0xA97F}, {0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF}, {0xFE10, 0xFE19}, {0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x17000, 0x18AFF}, {0x1B000, 0x1B2FF}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E},
+	{0x1F191, 0x1F19A}, {0x1F200, 0x1F202}, {0x1F210, 0x1F23B}, {0x1F240, 0x1F248}, {0x1F250, 0x1F251},
+	{0x1F260, 0x1F265}, {0x1F300, 0x1F320}, {0x1F32D, 0x1F335}, {0x1F337, 0x1F37C}, {0x1F37E, 0x1F393},
+	{0x1F3A0, 0x1F3CA}, {0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0}, {0x1F3F4, 0x1F3F4}, {0x1F3F8, 0x1F43E},
+	{0x1F440, 0x1F440}, {0x1F442, 0x1F4FC}, {0x1F4FF, 0x1F53D}, {0x1F54B, 0x1F54E}, {0x1F550, 0x1F567},
+	{0x1F57A, 0x1F57A}, {0x1F595, 0x1F596}, {0x1F5A4, 0x1F5A4}, {0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5},
+	{0x1F6CC, 0x1F6CC}, {0x1F6D0, 0x1F6D2}, {0x1F6D5, 0x1F6D7}, {0x1F6EB, 0x1F6EC}, {0x1F6F4, 0x1F6FC},
+	{0x1F7E0, 0x1F7EB}, {0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945}, {0x1F947, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+	{0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// precomposedRunes are the Latin letters that a letter followed by a combining mark can be drawn as, per mark,
+// as pairs of the letter and the precomposed rune
+var precomposedRunes = map[rune]string{
+	0x0300: "aàeèiìnǹoòuùwẁyỳAÀEÈIÌNǸOÒUÙWẀYỲ",
+	0x0301: "aácćeégǵiíkḱlĺmḿnńoópṕrŕsśuúwẃyýzźAÁCĆEÉGǴIÍKḰLĹMḾNŃOÓPṔRŔSŚUÚWẂYÝZŹ",
+	0x0302: "aâcĉeêgĝhĥiîjĵoôsŝuûwŵyŷzẑAÂCĈEÊGĜHĤIÎJĴOÔSŜUÛWŴYŶZẐ",
+	0x0303: "aãeẽiĩnñoõuũvṽyỹAÃEẼIĨNÑOÕUŨVṼYỸ",
+	0x0304: "aāeēgḡiīoōuūyȳAĀEĒGḠIĪOŌUŪYȲ",
+	0x0306: "aăeĕgğiĭoŏuŭAĂEĔGĞIĬOŎUŬ",
+	0x0307: "aȧbḃcċdḋeėfḟgġhḣmṁnṅoȯpṗrṙsṡtṫwẇxẋyẏzżAȦBḂCĊDḊEĖFḞGĠHḢIİMṀNṄOȮPṖRṘSṠTṪWẆXẊYẎZŻ",
+	0x0308: "aäeëhḧiïoötẗuüwẅxẍyÿAÄEËHḦIÏOÖUÜWẄXẌYŸ",
+	0x030A: "aåuůwẘyẙAÅUŮ",
+	0x030B: "oőuűOŐUŰ",
+	0x030C: "aǎcčdďeěgǧhȟiǐjǰkǩlľnňoǒrřsštťuǔzžAǍCČDĎEĚGǦHȞIǏKǨLĽNŇOǑRŘSŠTŤUǓZŽ",
+	0x0327: "cçdḑeȩgģhḩkķlļnņrŗsştţCÇDḐEȨGĢHḨKĶLĻNŅRŖSŞTŢ",
+	0x0328: "aąeęiįoǫuųAĄEĘIĮOǪUŲ",
+}
+
+// composeRune returns the precomposed rune for the given letter followed by the given combining mark,
+// for drawing them in one cell. Returns false if there is no such rune.
+func composeRune(base, mark rune) (rune, bool) {
+	pairs := []rune(precomposedRunes[mark])
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == base {
+			return pairs[i+1], true
+		}
+	}
+	return 0, false
+}
+
+// combineRune returns the rune that the given rune and the zero width rune after it are drawn as, in one cell.
+// This is the precomposed rune, if there is one. Since a cell can only hold one rune, a combining mark that
+// can not be composed with the rune before it is shown by drawing controlRuneReplacement instead, so that the
+// mark does not go unnoticed. Variation selectors, zero width spaces and joiners leave the rune as it is.
+func combineRune(base, r rune) rune {
+	if composed, ok := composeRune(base, r); ok {
+		return composed
+	}
+	if unicode.IsMark(r) && !(r >= 0xFE00 && r <= 0xFE0F) {
+		return controlRuneReplacement
+	}
+	return base
+}
+
+// runeWidth returns the number of columns that the given rune takes up in a terminal emulator, 0, 1 or 2.
+// Combining marks, zero width spaces and joiners and variation selectors take up no columns,
+// since they are drawn together with the rune before them.
+func runeWidth(r rune) int {
+	if r < 0x0300 {
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me) || (r >= 0x200B && r <= 0x200D) || (r >= 0xFE00 && r <= 0xFE0F) {
+		return 0
+	}
+	if r < wideRuneRanges[0][0] {
+		return 1
+	}
+	i := sort.Search(len(wideRuneRanges), func(i int) bool { return wideRuneRanges[i][1] >= r })
+	if i < len(wideRuneRanges) && wideRuneRanges[i][0] <= r {
+		return 2
+	}
+	return 1
+}
+
+// runeColumns returns the number of columns that the given rune takes up in the editor, where a tab is PerTab wide
+// and combining marks take up no columns
+func (e *Editor) runeColumns(r rune) int {
+	if r == '\t' {
+		return e.indentation.PerTab
+	}
+	return runeWidth(r)
+}
+
+// lineColumns returns the number of columns that the given line takes up in the editor
+func (e *Editor) lineColumns(n LineIndex) int {
+	runes, _ := e.lineRunes(int(n))
+	columns := 0
+	for _, r := range runes {
+		columns += e.runeColumns(r)
+	}
+	return columns
+}
+
+// leftRuneColumns returns the number of columns that the rune to the left of the cursor takes up,
+// together with any combining marks after it, which is how far the cursor should move when moving one step to the left
+func (e *Editor) leftRuneColumns() int {
+	runes, _ := e.lineRunes(int(e.DataY()))
+	x, err := e.DataX()
+	if err != nil {
+		// After the end of the line, only the position right after the last rune is next to it
+		if e.pos.sx+e.pos.offsetX != e.LastScreenPosition(e.DataY())+1 {
+			return 1
+		}
+		x = len(runes)
+	}
+	// Skip the combining marks, to find the rune that they are drawn together with
+	i := x - 1
+	for i > 0 && runeWidth(runes[i]) == 0 {
+		i--
+	}
+	if i < 0 || e.runeColumns(runes[i]) == 0 {
+		return 1
+	}
+	return e.runeColumns(runes[i])
+}
+
+// clusterEnd returns the index after the given rune and the combining marks that follow it
+func clusterEnd(runes []rune, x int) int {
+	end := x + 1
+	for end < len(runes) && runeWidth(runes[end]) == 0 {
+		end++
+	}
+	return end
+}
+
+// alignCursorToRune moves the cursor to the start of the rune it is on, if it ended up in the middle of a wide rune,
+// for instance after moving up or down
+func (e *Editor) alignCursorToRune() {
+	if x, err := e.DataX(); err == nil {
+		if sx := e.ScreenXForDataX(e.DataY(), x) - e.pos.offsetX; sx >= 0 {
+			e.pos.sx = sx
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestRuneWidth(t *testing.T) {
+	for r, want := range map[rune]int{'a': 1, 'æ': 1, '中': 2, '한': 2, 'Ａ': 2, '😀': 2, '→': 1, '…': 1} {
+		if got := runeWidth(r); got != want {
+			t.Errorf("%q: expected width %d, got %d", r, want, got)
+		}
+	}
+}
+
+func TestWideRuneCursor(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a中文b\n中\n"))
+	if got := e.LastScreenPosition(0); got != 5 {
+		t.Errorf("expected the last screen position to be 5, got %d", got)
+	}
+	// Moving right skips both columns of a wide rune
+	var xs []int
+	for i := 0; i < 4; i++ {
+		e.Next(c)
+		xs = append(xs, e.pos.sx)
+	}
+	if want := []int{1, 3, 5, 6}; !equalInts(xs, want) {
+		t.Errorf("expected the screen positions %v when moving right, got %v", want, xs)
+	}
+	if x, err := e.DataX(); err == nil || x != 4 {
+		t.Errorf("expected to be after the end of the line, at data position 4, got %d", x)
+	}
+	e.Prev(c)
+	e.Prev(c)
+	if x, _ := e.DataX(); e.pos.sx != 3 || x != 2 {
+		t.Errorf("expected to move left to screen position 3 and data position 2, got %d and %d", e.pos.sx, x)
+	}
+	// A position in the middle of a wide rune belongs to that rune
+	e.pos.sx = 4
+	if x, err := e.DataX(); err != nil || x != 2 {
+		t.Errorf("expected data position 2 in the middle of a wide rune, got %d (%v)", x, err)
+	}
+	// Moving down does not place the cursor in the middle of a wide rune
+	e.pos.sx, e.pos.savedX = 1, 1
+	e.DownEnd(c)
+	if e.pos.sx != 0 {
+		t.Errorf("expected the cursor to be at the start of the wide rune, got %d", e.pos.sx)
+	}
+	if got := dataXForScreenX("a中b", 2, 4); got != 1 {
+		t.Errorf("expected a click on the second half of a wide rune to give its position, got %d", got)
+	}
+}
+
+func TestChopLineWide(t *testing.T) {
+	e := NewSimpleEditor(80)
+	placeholder := string(wideRunePlaceholder)
+	if got := e.ChopLine("a中b", 4); got != "a中"+placeholder+"b" {
+		t.Errorf("expected each wide rune to be followed by a placeholder, got %q", got)
+	}
+	// A wide rune is never split in half by the edges
+	if got := e.ChopLine("a中b", 2); got != "a " {
+		t.Errorf("expected a space instead of half of a wide rune, got %q", got)
+	}
+	e.pos.offsetX = 2
+	if got := e.ChopLine("a中b", 4); got != " b" {
+		t.Errorf("expected a space for the scrolled half of a wide rune, got %q", got)
+	}
+}
+
+func TestWriteLinesWide(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.syntaxHighlight = true
+	e.LoadBytes([]byte("// 中文 ok\n"))
+	c := vt100.NewCanvas()
+	e.WriteLines(c, 0, 1, 0, 0)
+	runes := []rune(canvasLine(c, 0))
+	if len(runes) < 9 || runes[3] != '中' || runes[4] != wideRunePlaceholder || runes[5] != '文' || runes[7] != ' ' || runes[8] != 'o' {
+		t.Errorf("expected the wide runes to take up two cells each, got %q", string(runes))
+	}
+}
+
+// equalInts checks if the given slices have the same elements
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCombiningMarks(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	// "é" written as "e" followed by a combining acute accent, twice
+	e.LoadBytes([]byte("ae\u0301e\u0301b\n"))
+	if got := e.LastScreenPosition(0); got != 3 {
+		t.Errorf("expected the last screen position to be 3, got %d", got)
+	}
+	e.End(c)
+	if e.pos.sx != 4 {
+		t.Errorf("expected the end of the line to be at screen position 4, got %d", e.pos.sx)
+	}
+	// Moving over the clusters
+	e.Home()
+	var xs []int
+	for i := 0; i < 4; i++ {
+		x, _ := e.DataX()
+		xs = append(xs, x)
+		e.Next(c)
+	}
+	if want := []int{0, 1, 3, 5}; !equalInts(xs, want) {
+		t.Errorf("expected the data positions %v when moving right, got %v", want, xs)
+	}
+	e.Prev(c)
+	e.Prev(c)
+	if x, _ := e.DataX(); e.pos.sx != 2 || x != 3 {
+		t.Errorf("expected to move left to screen position 2 and data position 3, got %d and %d", e.pos.sx, x)
+	}
+	// Deleting removes the whole cluster
+	e.Delete()
+	if got := e.Line(0); got != "ae\u0301b" {
+		t.Errorf("expected the letter and the combining mark to be deleted, got %q", got)
+	}
+	if got := e.ChopLine("ae\u0301b", 80); got != "a\u00e9b" {
+		t.Errorf("expected the combining mark to be composed with the letter, got %q", got)
+	}
+	e.WriteLines(c, 0, 1, 0, 0)
+	if got := canvasLine(c, 0); !strings.HasPrefix(got, "a\u00e9b ") {
+		t.Errorf("expected the cluster to be drawn in one cell, got %q", got)
+	}
+
+	// A combining mark without a precomposed rune is not left out, and a variation selector changes nothing
+	if got := e.ChopLine("aq\u0301b\u2764\uFE0F", 80); got != "a"+string(controlRuneReplacement)+"b\u2764" {
+		t.Errorf("expected the letter with the combining mark to be replaced, got %q", got)
+	}
+	e.LoadBytes([]byte("aq\u0301b\n"))
+	e.WriteLines(c, 0, 1, 0, 0)
+	if got := canvasLine(c, 0); !strings.HasPrefix(got, "a"+string(controlRuneReplacement)+"b ") {
+		t.Errorf("expected the letter with the combining mark to be drawn as a replacement, got %q", got)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// goTestFunc matches the start of a Go test function, like "func TestParse(t *testing.T) {"
+	goTestFunc = regexp.MustCompile(`^func (Test\w*)\(`)
+
+	// rustFunc matches the start of a Rust function, like "fn it_works() {" or "pub async fn parse() {"
+	rustFunc = regexp.MustCompile(`^\s*(?:pub(?:\([\w:]+\))? )?(?:async )?fn (\w+)`)
+
+	// pythonFunc matches the start of a Python function or method, like "def test_parse():"
+	pythonFunc = regexp.MustCompile(`^(\s*)(?:async )?def (\w+)\(`)
+
+	// pythonClass matches the start of a Python class, like "class TestParser:"
+	pythonClass = regexp.MustCompile(`^(\s*)class (\w+)`)
+
+	// rustPanicLine matches where a Rust test panicked, like "thread 'tests::it_works' panicked at src/lib.rs:10:5:",
+	// or "panicked at 'assertion failed', src/lib.rs:10:5" for older versions of Rust
+	rustPanicLine = regexp.MustCompile(`panicked at (?:'(.*)', )?([^\s:']+):(\d+):(\d+):?$`)
+
+	errNoTestAtCursor = errors.New("the cursor is not in a test function")
+)
+
+// reverseFindLine searches from the current line and upwards for a line that matches the given regular expression.
+// Returns the line index and the submatches, or false if no line matches.
+func (e *Editor) reverseFindLine(re *regexp.Regexp, from LineIndex) (LineIndex, []string, bool) {
+	for i := from; i >= 0; i-- {
+		if matches := re.FindStringSubmatch(e.Line(i)); matches != nil {
+			return i, matches, true
+		}
+	}
+	return 0, nil, false
+}
+
+// TestAtCursor returns the name of the test function that the cursor is in, for Go, Rust and Python.
+// For Python test methods, the class name is included, like "TestParser::test_parse".
+func (e *Editor) TestAtCursor() (string, error) {
+	switch e.mode {
+	case mode.Go:
+		// The closest function above the cursor must be a test function
+		_, y, ok := e.ContentsAndReverseSearchPrefix("func ")
+		if !ok {
+			return "", errNoTestAtCursor
+		}
+		if matches := goTestFunc.FindStringSubmatch(e.Line(y)); matches != nil {
+			return matches[1], nil
+		}
+	case mode.Rust:
+		y, matches, ok := e.reverseFindLine(rustFunc, e.LineIndex())
+		if !ok {
+			return "", errNoTestAtCursor
+		}
+		// Look for a test attribute, like #[test] or #[tokio::test], among the attributes above the function
+		for i := y - 1; i >= 0 && strings.HasPrefix(strings.TrimSpace(e.Line(i)), "#["); i-- {
+			if strings.Contains(e.Line(i), "test]") {
+				return matches[1], nil
+			}
+		}
+	case mode.Python:
+		y, matches, ok := e.reverseFindLine(pythonFunc, e.LineIndex())
+		if !ok || !strings.HasPrefix(matches[2], "test") {
+			return "", errNoTestAtCursor
+		}
+		indentation, name := matches[1], matches[2]
+		if indentation == "" {
+			return name, nil
+		}
+		// A test method, so find the class it is in
+		for i := y - 1; i >= 0; i-- {
+			if matches := pythonClass.FindStringSubmatch(e.Line(i)); matches != nil && len(matches[1]) < len(indentation) {
+				return matches[2] + "::" + name, nil
+			}
+		}
+	default:
+		return "", fmt.Errorf("running a single test is not supported for %s", e.mode)
+	}
+	return "", errNoTestAtCursor
+}
+
+// testCommand returns a command for running the given test function in the given source file,
+// using "go test", "cargo test" or "pytest", depending on the mode
+func testCommand(m mode.Mode, absFilename, name string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	switch m {
+	case mode.Go:
+		cmd = exec.Command("go", "test", "-run", "^"+name+"$", ".")
+		cmd.Dir = filepath.Dir(absFilename)
+	case mode.Rust:
+		cmd = exec.Command("cargo", "test", name)
+		cmd.Dir = rustCrateDir(absFilename)
+	case mode.Python:
+		cmd = exec.Command("pytest", filepath.Base(absFilename)+"::"+name)
+		cmd.Dir = filepath.Dir(absFilename)
+	default:
+		return nil, fmt.Errorf("running a single test is not supported for %s", m)
+	}
+	if which(cmd.Args[0]) == "" {
+		return nil, errors.New("could not find " + cmd.Args[0])
+	}
+	return cmd, nil
+}
+
+// ParseTestErrors finds the locations of the failures in the output from running tests.
+// The locations may be indented, like the ones from "go test", and panics from Rust tests are also found.
+func ParseTestErrors(output, dir string) []BuildError {
+	var (
+		lines = strings.Split(output, "\n")
+		sb    strings.Builder
+	)
+	for i, line := range lines {
+		if matches := rustPanicLine.FindStringSubmatch(line); matches != nil {
+			// Newer versions of Rust have the message on the line after the location
+			message := matches[1]
+			if message == "" && i+1 < len(lines) {
+				message = strings.TrimSpace(lines[i+1])
+			}
+			fmt.Fprintf(&sb, "%s:%s:%s: %s\n", matches[2], matches[3], matches[4], message)
+			continue
+		}
+		sb.WriteString(strings.TrimLeft(line, " \t") + "\n")
+	}
+	return ParseBuildErrors(sb.String(), dir)
+}
+
+// runTest runs the given test command, like a build command that can be stopped with esc,
+// and returns the combined output and the error from running it. A build that is running is stopped first.
+func runTest(cmd *exec.Cmd) ([]byte, error) {
+	defer operations.Start("testing")()
+	return runBuildCommand(cmd, nil)
+}
+
+// testResult returns a status message for the output and error from running the given test, and true if it passed.
+// The locations of the failures are kept as the errors from the last build, so that they can be jumped to.
+func (e *Editor) testResult(cmd *exec.Cmd, name string, output []byte, err error) (string, bool) {
+	if err == errBuildCancelled {
+		return "Stopped " + name, false
+	}
+	if err == nil {
+		e.buildErrors = nil
+		return name + " passed", true
+	}
+	if testErrors := ParseTestErrors(string(output), cmd.Dir); len(testErrors) > 0 {
+		e.buildErrors = &BuildErrors{testErrors, -1}
+		first := testErrors[0]
+		return fmt.Sprintf("%s failed at %s:%d: %s", name, filepath.Base(first.absFilename), first.line, first.message), false
+	}
+	e.buildErrors = nil
+	outputLines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return name + " failed: " + outputLines[len(outputLines)-1], false
+}
+
+// RunTestAtCursor saves the file and runs the test function that the cursor is in, in the background.
+// The result is shown in the status bar by the key loop. The test can be stopped with esc, like a build.
+func (e *Editor) RunTestAtCursor(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	name, err := e.TestAtCursor()
+	if err != nil {
+		return err
+	}
+	cmd, err := testCommand(e.mode, absFilename, name)
+	if err != nil {
+		return err
+	}
+	if e.changed && !e.UserSave(c, tty, status, undo) {
+		// UserSave has already told the user why the file was not saved
+		return nil
+	}
+	status.SetMessage("Running " + name)
+	status.ShowUntilRedraw(c, e)
+	go func() {
+		output, err := runTest(cmd)
+		keyLoopEvents <- func() {
+			message, passed := e.testResult(cmd, name, output, err)
+			status.ClearAll(c)
+			if passed {
+				status.SetMessage(message)
+			} else {
+				status.SetErrorMessage(message)
+			}
+			status.ShowNoTimeout(c, e)
+		}
+	}()
+	return nil
+}
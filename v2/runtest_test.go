@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestTestAtCursor(t *testing.T) {
+	tests := []struct {
+		m        mode.Mode
+		contents string
+		line     LineIndex
+		want     string
+	}{
+		{mode.Go, "package main\n\nfunc TestParse(t *testing.T) {\n\tif x := parse(); x != 1 {\n\t}\n}\n", 3, "TestParse"},
+		{mode.Go, "package main\n\nfunc TestParse(t *testing.T) {\n}\n\nfunc helper() {\n\treturn\n}\n", 6, ""},
+		{mode.Rust, "#[cfg(test)]\nmod tests {\n    #[test]\n    #[should_panic]\n    fn it_panics() {\n        panic!();\n    }\n}\n", 5, "it_panics"},
+		{mode.Rust, "fn helper() {\n    println!();\n}\n", 1, ""},
+		{mode.Python, "def test_parse():\n    assert parse() == 1\n", 1, "test_parse"},
+		{mode.Python, "class TestParser:\n    def setup_method(self):\n        pass\n\n    def test_parse(self):\n        assert True\n", 5, "TestParser::test_parse"},
+		{mode.Python, "class TestParser:\n    def setup_method(self):\n        pass\n", 2, ""},
+	}
+	for _, test := range tests {
+		e := NewSimpleEditor(80)
+		e.mode = test.m
+		e.LoadBytes([]byte(test.contents))
+		e.pos.sy = int(test.line)
+		name, err := e.TestAtCursor()
+		if test.want == "" {
+			if err != errNoTestAtCursor {
+				t.Errorf("%s, line %d: expected no test at the cursor, got %q (%v)", test.m, test.line+1, name, err)
+			}
+		} else if name != test.want {
+			t.Errorf("%s, line %d: expected %q, got %q (%v)", test.m, test.line+1, test.want, name, err)
+		}
+	}
+}
+
+func TestParseTestErrors(t *testing.T) {
+	goOutput := "--- FAIL: TestParse (0.00s)\n    parse_test.go:12: expected 1, got 2\nFAIL\nFAIL\texample.com/parse\t0.002s\n"
+	rustOutput := "running 1 test\nthread 'tests::it_works' panicked at src/lib.rs:10:5:\nassertion `left == right` failed\n"
+	oldRustOutput := "thread 'main' panicked at 'index out of bounds', src/main.rs:4:13\n"
+	pythonOutput := "    def test_parse():\n>       assert parse() == 1\nE       assert 2 == 1\n\ntest_parse.py:4: AssertionError\n"
+	tests := []struct {
+		output string
+		want   BuildError
+	}{
+		{goOutput, BuildError{"/src/parse_test.go", 12, 0, "expected 1, got 2"}},
+		{rustOutput, BuildError{"/src/src/lib.rs", 10, 5, "assertion `left == right` failed"}},
+		{oldRustOutput, BuildError{"/src/src/main.rs", 4, 13, "index out of bounds"}},
+		{pythonOutput, BuildError{"/src/test_parse.py", 4, 0, "AssertionError"}},
+	}
+	for _, test := range tests {
+		if got := ParseTestErrors(test.output, "/src"); len(got) != 1 || got[0] != test.want {
+			t.Errorf("expected %v, got %v", test.want, got)
+		}
+	}
+}
+
+func TestRunTest(t *testing.T) {
+	if which("go") == "" {
+		t.Skip("go is not installed")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/parse\n\ngo 1.18\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testFilename := filepath.Join(dir, "parse_test.go")
+	if err := os.WriteFile(testFilename, []byte("package parse\n\nimport \"testing\"\n\nfunc TestPass(t *testing.T) {\n}\n\nfunc TestFail(t *testing.T) {\n\tt.Error(\"expected 1\")\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	cmd, err := testCommand(mode.Go, testFilename, "TestPass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := runTest(cmd)
+	if message, passed := e.testResult(cmd, "TestPass", output, err); !passed {
+		t.Errorf("expected the test to pass, got %q", message)
+	}
+
+	// Only the given test is run, and the failure location can be jumped to
+	cmd, _ = testCommand(mode.Go, testFilename, "TestFail")
+	output, err = runTest(cmd)
+	message, passed := e.testResult(cmd, "TestFail", output, err)
+	if passed || !strings.HasPrefix(message, "TestFail failed at parse_test.go:9: expected 1") {
+		t.Errorf("expected the test to fail, got %q", message)
+	}
+	if e.buildErrors.Len() != 1 || e.buildErrors.errors[0].absFilename != testFilename || e.buildErrors.errors[0].line != 9 {
+		t.Errorf("expected the failure location to be kept, got %v", e.buildErrors)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// goPackageName returns the package name from the package clause in the given Go source code, or an empty string
+func goPackageName(contents string) string {
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "package" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// goPackageForDir returns the package name used by the other Go files in the given directory.
+// Test files and the file given as exclude are skipped. If there are no other Go files,
+// the package name is derived from the directory name.
+func goPackageForDir(dir, exclude string) string {
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || filepath.Join(dir, name) == exclude {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			if packageName := goPackageName(string(data)); packageName != "" {
+				return packageName
+			}
+		}
+	}
+	// Derive the package name from the directory name, like "go-yaml" -> "yaml"
+	name := strings.ToLower(filepath.Base(dir))
+	name = strings.TrimPrefix(name, "go-")
+	var sb strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			sb.WriteRune(r)
+		}
+	}
+	if sb.Len() == 0 || unicode.IsDigit([]rune(sb.String())[0]) {
+		return "main"
+	}
+	return sb.String()
+}
+
+// headerGuardName returns the conventional header guard for a C or C++ header filename, like "FOO_BAR_H" for "foo-bar.h"
+func headerGuardName(filename string) string {
+	var sb strings.Builder
+	for _, r := range filepath.Base(filename) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(unicode.ToUpper(r))
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+// GoPackageClause returns the line index and the package name of the package clause, if found
+func (e *Editor) GoPackageClause() (LineIndex, string, bool) {
+	l := e.Len()
+	for i := 0; i < l; i++ {
+		if fields := strings.Fields(e.Line(LineIndex(i))); len(fields) >= 2 && fields[0] == "package" {
+			return LineIndex(i), fields[1], true
+		}
+	}
+	return 0, "", false
+}
+
+// SetGoPackage replaces the package name in the package clause
+func (e *Editor) SetGoPackage(packageName string) bool {
+	y, oldPackageName, ok := e.GoPackageClause()
+	if !ok {
+		return false
+	}
+	e.SetLine(y, strings.Replace(e.Line(y), "package "+oldPackageName, "package "+packageName, 1))
+	e.changed = true
+	e.redraw = true
+	return true
+}
+
+// HeaderGuard returns the header guard of a C or C++ header, if the first directives are "#ifndef X" and "#define X"
+func (e *Editor) HeaderGuard() (string, bool) {
+	var ifndef string
+	l := e.Len()
+	for i := 0; i < l; i++ {
+		fields := strings.Fields(e.Line(LineIndex(i)))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") || strings.HasPrefix(fields[0], "/*") || strings.HasPrefix(fields[0], "*") {
+			continue
+		}
+		if ifndef == "" {
+			if fields[0] != "#ifndef" || len(fields) < 2 {
+				return "", false
+			}
+			ifndef = fields[1]
+			continue
+		}
+		if fields[0] == "#define" && len(fields) >= 2 && fields[1] == ifndef {
+			return ifndef, true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// RenameHeaderGuard replaces the old header guard with the new one, in the #ifndef, #define and #endif lines.
+// Returns the number of lines that were changed.
+func (e *Editor) RenameHeaderGuard(oldGuard, newGuard string) int {
+	counter := 0
+	l := e.Len()
+	for i := 0; i < l; i++ {
+		line := e.Line(LineIndex(i))
+		trimmedLine := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmedLine, "#ifndef") && !strings.HasPrefix(trimmedLine, "#define") && !strings.HasPrefix(trimmedLine, "#endif") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') })
+		if !hasS(fields, oldGuard) {
+			continue
+		}
+		newLine := strings.Replace(line, oldGuard, newGuard, 1)
+		// The #endif line may also have the guard in a comment, like "#endif // FOO_H" or "#endif /* FOO_H */"
+		if strings.HasPrefix(trimmedLine, "#endif") {
+			newLine = strings.ReplaceAll(line, oldGuard, newGuard)
+		}
+		e.SetLine(LineIndex(i), newLine)
+		counter++
+	}
+	if counter > 0 {
+		e.changed = true
+		e.redraw = true
+	}
+	return counter
+}
+
+// detectModeAfterRename detects the mode from the new filename, like when a file is opened, unless the mode is
+// set by a modeline. The save policy, which depends on the mode and the filename, is looked up again.
+func (e *Editor) detectModeAfterRename() {
+	if e.modeline == nil || !e.modeline.modeSet {
+		if m := mode.Detect(withoutGZ(e.filename)); m != mode.Blank {
+			e.mode = m
+		}
+	}
+	e.savePolicy = savePolicyFor(e.mode, e.filename)
+	e.redraw = true
+}
+
+// SaveAs saves the current file with a new filename, then continues editing the new file.
+// The lock, the mode and the location history follow the file to the new filename.
+// If the file was moved to another directory or renamed, the user is asked if the Go package clause
+// or the C/C++ header guard should be updated to match.
+func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, undo *Undo, newFilename string) {
+	newFilename = strings.TrimSpace(newFilename)
+	if newFilename == "" {
+		status.SetErrorMessage("No filename given")
+		status.Show(c, e)
+		return
+	}
+	if !filepath.IsAbs(newFilename) {
+		newFilename = filepath.Join(filepath.Dir(e.filename), newFilename)
+	}
+	if exists(newFilename) {
+		answer, ok := e.UserInput(c, tty, status, newFilename+" exists. Overwrite? (y/n)", []string{"y", "n"}, false)
+		if !ok || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			status.Clear(c)
+			status.SetMessage("Not saved")
+			status.Show(c, e)
+			return
+		}
+	}
+	oldFilename, oldDiskState, oldGeneratedFile, oldGeneratedFileSaved := e.filename, e.diskState, e.generatedFile, e.generatedFileSaved
+	oldAbsFilename, err := e.AbsFilename()
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	// Save through UserSave, like any other save, so that the hooks, formatting and checks are done too.
+	// The new file has not been loaded, so it is not checked for changes on disk, but the permissions are kept.
+	e.filename = newFilename
+	e.diskState = DiskState{perm: oldDiskState.perm}
+	e.generatedFile, e.generatedFileSaved = inIgnoredOrGeneratedDirectory(newFilename), false
+	if !e.UserSave(c, tty, status, undo) {
+		e.filename, e.diskState, e.generatedFile, e.generatedFileSaved = oldFilename, oldDiskState, oldGeneratedFile, oldGeneratedFileSaved
+		return
+	}
+	e.redraw = true
+	e.redrawCursor = true
+
+	// Save the current location for the old file, then move the lock over to the new file.
+	// A lock that has been released to another instance of the editor belongs to that instance.
+	e.SaveLocation(oldAbsFilename, loadedLocationHistory())
+	if !e.lockReleased {
+		lk.Unlock(oldAbsFilename)
+	}
+	if newAbsFilename, err := e.AbsFilename(); err == nil {
+		lk.Lock(newAbsFilename)
+	}
+	lk.Save()
+	fnord := FilenameOrData{filename: e.filename}
+	fnord.SetTitle()
+
+	// The mode may be different for the new filename, for instance when saving notes.txt as notes.md
+	e.detectModeAfterRename()
+
+	// Offer to update the package clause or header guard, then save again
+	if e.UpdateAfterMove(c, tty, status, undo, oldFilename) && !e.UserSave(c, tty, status, undo) {
+		return
+	}
+	// Store the location, view state and bookmarks for the new filename
+	if newAbsFilename, err := e.AbsFilename(); err == nil {
+		e.SaveLocation(newAbsFilename, loadedLocationHistory())
+	}
+}
+
+// UpdateAfterMove asks the user if the Go package clause or C/C++ header guard should be rewritten,
+// after the current file has been saved with a new filename. Each rewrite is a single undo step.
+// Returns true if the contents were changed.
+func (e *Editor) UpdateAfterMove(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo, oldFilename string) bool {
+	confirm := func(prompt string) bool {
+		answer, ok := e.UserInput(c, tty, status, prompt+" (y/n)", []string{"y", "n"}, false)
+		return ok && strings.ToLower(strings.TrimSpace(answer)) == "y"
+	}
+	oldDir, _ := filepath.Abs(filepath.Dir(oldFilename))
+	newDir, _ := filepath.Abs(filepath.Dir(e.filename))
+	switch {
+	case e.mode == mode.Go && oldDir != newDir:
+		_, oldPackageName, ok := e.GoPackageClause()
+		if !ok {
+			return false
+		}
+		newPackageName := goPackageForDir(newDir, filepath.Join(newDir, filepath.Base(e.filename)))
+		if strings.HasSuffix(e.filename, "_test.go") && strings.HasSuffix(oldPackageName, "_test") {
+			newPackageName += "_test"
+		}
+		if newPackageName == oldPackageName || !confirm(fmt.Sprintf("Change package %s → %s?", oldPackageName, newPackageName)) {
+			return false
+		}
+		undo.Snapshot(e)
+		return e.SetGoPackage(newPackageName)
+	case (e.mode == mode.C || e.mode == mode.Cpp) && hasS([]string{".h", ".hpp", ".h++", ".hh"}, filepath.Ext(e.filename)):
+		oldGuard, ok := e.HeaderGuard()
+		if !ok {
+			return false
+		}
+		// Only rename header guards that follow the filename convention, but keep a project prefix, like "MYLIB_FOO_H"
+		var newGuard string
+		oldConventionalGuard := headerGuardName(oldFilename)
+		switch {
+		case oldGuard == oldConventionalGuard:
+			newGuard = headerGuardName(e.filename)
+		case strings.HasSuffix(oldGuard, "_"+oldConventionalGuard):
+			newGuard = strings.TrimSuffix(oldGuard, oldConventionalGuard) + headerGuardName(e.filename)
+		default:
+			return false
+		}
+		if newGuard == oldGuard {
+			return false
+		}
+		if !confirm(fmt.Sprintf("Change header guard %s → %s?", oldGuard, newGuard)) {
+			return false
+		}
+		undo.Snapshot(e)
+		return e.RenameHeaderGuard(oldGuard, newGuard) > 0
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestGoPackageForDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "go-yaml")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Without any Go files, the package name is derived from the directory name
+	if name := goPackageForDir(dir, ""); name != "yaml" {
+		t.Errorf("expected yaml, got %s", name)
+	}
+	os.WriteFile(filepath.Join(dir, "a_test.go"), []byte("package other_test\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.go"), []byte("// Package parser ...\npackage parser\n"), 0o644)
+	if name := goPackageForDir(dir, ""); name != "parser" {
+		t.Errorf("expected parser, got %s", name)
+	}
+	if name := goPackageForDir(dir, filepath.Join(dir, "b.go")); name != "yaml" {
+		t.Errorf("expected the excluded file to be skipped, got %s", name)
+	}
+}
+
+func TestRewriteAfterMove(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "// Package a does things")
+	e.SetLine(1, "package a")
+	if !e.SetGoPackage("b") || e.Line(1) != "package b" {
+		t.Errorf("expected the package clause to be rewritten, got %q", e.Line(1))
+	}
+
+	if guard := headerGuardName("my-lib.hpp"); guard != "MY_LIB_HPP" {
+		t.Errorf("expected MY_LIB_HPP, got %s", guard)
+	}
+	h := NewSimpleEditor(80)
+	for i, line := range []string{"// comment", "#ifndef OLD_H", "#define OLD_H", "", "#define OLD_H_VERSION 2", "", "#endif // OLD_H"} {
+		h.SetLine(LineIndex(i), line)
+	}
+	guard, ok := h.HeaderGuard()
+	if !ok || guard != "OLD_H" {
+		t.Fatalf("expected the header guard OLD_H, got %q", guard)
+	}
+	if n := h.RenameHeaderGuard("OLD_H", "NEW_H"); n != 3 {
+		t.Errorf("expected 3 lines to be changed, got %d", n)
+	}
+	if h.Line(1) != "#ifndef NEW_H" || h.Line(2) != "#define NEW_H" || h.Line(4) != "#define OLD_H_VERSION 2" || h.Line(6) != "#endif // NEW_H" {
+		t.Errorf("unexpected contents after renaming the header guard:\n%s", h.String())
+	}
+}
+
+func TestSaveAs(t *testing.T) {
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{"tmp.notes.txt": "# Notes\n"})
+	oldFilename, newFilename := filepath.Join(dir, "tmp.notes.txt"), filepath.Join(dir, "tmp.notes.md")
+	c, e, status := openTestEditor(t, oldFilename)
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+	lk.Lock(oldFilename)
+
+	// Saving as another file goes through the same steps as any other save, like the before-save hooks
+	defer func(h map[string][]string) { hooks = h }(hooks)
+	hooks = map[string][]string{hookBeforeSave: {"exit 1"}}
+	e.SaveAs(c, nil, status, lk, NewUndo(10, 0), "tmp.blocked.md")
+	if exists(filepath.Join(dir, "tmp.blocked.md")) || e.filename != oldFilename {
+		t.Errorf("expected a failing before-save hook to stop saving as another file, and the filename to be kept, got %s", e.filename)
+	}
+	hooks = nil
+
+	e.SaveAs(c, nil, status, lk, NewUndo(10, 0), filepath.Base(newFilename))
+	if data, err := os.ReadFile(newFilename); err != nil || string(data) != "# Notes\n" {
+		t.Fatalf("expected the file to be saved as %s, got %q (%v)", newFilename, string(data), err)
+	}
+	if lk.IsLocked(oldFilename) || !lk.IsLocked(newFilename) {
+		t.Error("expected the lock to be moved over to the new file")
+	}
+	if e.mode != mode.Markdown {
+		t.Errorf("expected the mode to be detected from the new filename, got %s", e.mode)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	savePolicyVersion        = 1
+	savePolicyHeader         = "o save policy"
+	savePolicyWhitespaceFlag = "strip-whitespace"
+	savePolicyNewlineFlag    = "final-newline"
+	savePolicyBlankLinesFlag = "strip-blank-lines"
+)
+
+var (
+	savePolicies           map[string]SavePolicy // per mode save policies, that differ from the default
+	savePolicyFilename     = filepath.Join(userCacheDir, "o", "savepolicy.txt")
+	errSavePolicyVersion   = errors.New("unsupported save policy version")
+	errSavePolicyNoHeader  = errors.New("missing save policy header")
+	errPatchWhitespaceKept = errors.New("trailing whitespace is always kept in patches")
+)
+
+// SavePolicy is what is done with whitespace at the end of lines and at the end of the file, when saving
+type SavePolicy struct {
+	stripTrailingWhitespace bool // strip trailing whitespace from every line
+	finalNewline            bool // end the file with a newline, also if it was loaded without one
+	stripTrailingBlankLines bool // remove the blank lines at the end of the file
+}
+
+// patchFile checks if the given file is a patch or a diff, or a git commit or rebase, where trailing spaces are significant
+func patchFile(m mode.Mode, filename string) bool {
+	ext := strings.ToLower(filepath.Ext(withoutGZ(filename)))
+	return m == mode.Git || ext == ".patch" || ext == ".diff"
+}
+
+// defaultSavePolicy returns the save policy for files of the given mode, when nothing else has been chosen.
+// Code is stripped of trailing whitespace and blank lines, while text and Markdown are saved as they are.
+func defaultSavePolicy(m mode.Mode, filename string) SavePolicy {
+	switch {
+	case patchFile(m, filename):
+		return SavePolicy{finalNewline: true}
+	case m == mode.Text || m == mode.Markdown:
+		return SavePolicy{}
+	}
+	return SavePolicy{stripTrailingWhitespace: true, finalNewline: true, stripTrailingBlankLines: true}
+}
+
+// savePolicyFor returns the save policy that has been chosen for the given mode, or the default one.
+// Patches are never stripped of trailing whitespace or blank lines.
+func savePolicyFor(m mode.Mode, filename string) SavePolicy {
+	sp, ok := savePolicies[m.String()]
+	if !ok {
+		return defaultSavePolicy(m, filename)
+	}
+	if patchFile(m, filename) {
+		sp.stripTrailingWhitespace = false
+		sp.stripTrailingBlankLines = false
+	}
+	return sp
+}
+
+// withoutTrailingBlankLines returns the given text without the lines at the end that are empty or only contain whitespace
+func withoutTrailingBlankLines(s string) string {
+	trimmed := strings.TrimRight(s, " \t\r\n\f\v")
+	if trimmed == "" {
+		return ""
+	}
+	// Keep the whitespace at the end of the last line that is not blank, and the newline after it
+	end := len(trimmed)
+	if i := strings.IndexByte(s[end:], '\n'); i != -1 {
+		return s[:end+i+1]
+	}
+	return s
+}
+
+// savePolicyFile is where the save policies are stored, one line per mode
+var savePolicyFile = keyedFile{header: savePolicyHeader, version: savePolicyVersion, errNoHeader: errSavePolicyNoHeader, errVersion: errSavePolicyVersion}
+
+// savePolicyEntries returns the flags that each save policy is stored as, per mode
+func savePolicyEntries(savePolicies map[string]SavePolicy) map[string][]string {
+	entries := make(map[string][]string, len(savePolicies))
+	for modeName, sp := range savePolicies {
+		var fields []string
+		if sp.stripTrailingWhitespace {
+			fields = append(fields, savePolicyWhitespaceFlag)
+		}
+		if sp.finalNewline {
+			fields = append(fields, savePolicyNewlineFlag)
+		}
+		if sp.stripTrailingBlankLines {
+			fields = append(fields, savePolicyBlankLinesFlag)
+		}
+		entries[modeName] = fields
+	}
+	return entries
+}
+
+// savePoliciesFromEntries returns the save policy per mode, from the stored flags. Unknown flags are skipped.
+func savePoliciesFromEntries(entries map[string][]string) map[string]SavePolicy {
+	savePolicies := make(map[string]SavePolicy, len(entries))
+	for modeName, fields := range entries {
+		var sp SavePolicy
+		for _, field := range fields {
+			switch field {
+			case savePolicyWhitespaceFlag:
+				sp.stripTrailingWhitespace = true
+			case savePolicyNewlineFlag:
+				sp.finalNewline = true
+			case savePolicyBlankLinesFlag:
+				sp.stripTrailingBlankLines = true
+			}
+		}
+		savePolicies[modeName] = sp
+	}
+	return savePolicies
+}
+
+// formatSavePolicies returns the given save policies in the keyed file format, sorted by mode
+func formatSavePolicies(savePolicies map[string]SavePolicy) string {
+	return savePolicyFile.format(savePolicyEntries(savePolicies))
+}
+
+// parseSavePolicies parses save policies in the format written by formatSavePolicies
+func parseSavePolicies(data string) (map[string]SavePolicy, error) {
+	entries, err := savePolicyFile.parse(data)
+	return savePoliciesFromEntries(entries), err
+}
+
+// LoadSavePolicies loads the per-mode save policies. The returned map can be empty.
+func LoadSavePolicies(savePolicyFilename string) (map[string]SavePolicy, error) {
+	entries, err := savePolicyFile.load(savePolicyFilename)
+	return savePoliciesFromEntries(entries), err
+}
+
+// SaveSavePolicies saves the per-mode save policies
+func SaveSavePolicies(savePolicies map[string]SavePolicy, savePolicyFilename string) error {
+	return savePolicyFile.save(savePolicyFilename, savePolicyEntries(savePolicies))
+}
+
+// SetSavePolicy uses the given save policy for the current file, and remembers it for files of the same mode.
+// A policy that is the same as the default one for the mode is forgotten instead.
+func (e *Editor) SetSavePolicy(sp SavePolicy) error {
+	if patchFile(e.mode, e.filename) && (sp.stripTrailingWhitespace || sp.stripTrailingBlankLines) {
+		return errPatchWhitespaceKept
+	}
+	e.savePolicy = sp
+	if savePolicies == nil {
+		savePolicies = make(map[string]SavePolicy)
+	}
+	if sp == defaultSavePolicy(e.mode, "") {
+		delete(savePolicies, e.mode.String())
+	} else {
+		savePolicies[e.mode.String()] = sp
+	}
+	return SaveSavePolicies(savePolicies, savePolicyFilename)
+}
+
+// onOff returns "on" or "off"
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// SavePolicyMenu lets the user toggle what is done with trailing whitespace and the final newline when saving.
+// The choice is used for the current file and remembered for files of the same mode.
+func (e *Editor) SavePolicyMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, extraDashes bool) {
+	sp := e.savePolicy
+	toggles := []struct {
+		title  string
+		toggle *bool
+	}{
+		{"Strip trailing whitespace", &sp.stripTrailingWhitespace},
+		{"Ensure final newline", &sp.finalNewline},
+		{"Strip trailing blank lines", &sp.stripTrailingBlankLines},
+	}
+	if patchFile(e.mode, e.filename) {
+		// Trailing spaces are significant in patches
+		toggles = toggles[1:2]
+	}
+	menuChoices := make([]string, len(toggles))
+	for i, t := range toggles {
+		menuChoices[i] = t.title + ": " + onOff(*t.toggle)
+	}
+	selected := e.Menu(status, tty, "Whitespace when saving "+e.mode.String()+" files", menuChoices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+	if selected < 0 || selected >= len(toggles) {
+		return
+	}
+	*toggles[selected].toggle = !*toggles[selected].toggle
+	status.ClearAll(c)
+	if err := e.SetSavePolicy(sp); err != nil {
+		status.SetError(err)
+	} else {
+		status.SetMessage(toggles[selected].title + ": " + onOff(*toggles[selected].toggle))
+	}
+	status.Show(c, e)
+}
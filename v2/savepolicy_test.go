@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestDefaultSavePolicy(t *testing.T) {
+	all := SavePolicy{stripTrailingWhitespace: true, finalNewline: true, stripTrailingBlankLines: true}
+	tests := []struct {
+		filename string
+		m        mode.Mode
+		expected SavePolicy
+	}{
+		{"main.go", mode.Go, all},
+		{"notes.txt", mode.Text, SavePolicy{}},
+		{"README.md", mode.Markdown, SavePolicy{}},
+		{"COMMIT_EDITMSG", mode.Git, SavePolicy{finalNewline: true}},
+		{"fix.patch", mode.Blank, SavePolicy{finalNewline: true}},
+		{"fix.diff.gz", mode.Blank, SavePolicy{finalNewline: true}},
+	}
+	for _, test := range tests {
+		if sp := defaultSavePolicy(test.m, test.filename); sp != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.filename, test.expected, sp)
+		}
+	}
+}
+
+func TestSavePoliciesRoundTrip(t *testing.T) {
+	defer func(m map[string]SavePolicy) { savePolicies = m }(savePolicies)
+	savePolicies = map[string]SavePolicy{
+		mode.Mode(mode.Text).String():  {finalNewline: true},
+		mode.Mode(mode.Go).String():    {stripTrailingWhitespace: true},
+		mode.Mode(mode.Blank).String(): {stripTrailingWhitespace: true, stripTrailingBlankLines: true},
+	}
+	parsed, err := parseSavePolicies(formatSavePolicies(savePolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(savePolicies) {
+		t.Fatalf("expected %d save policies, got %d", len(savePolicies), len(parsed))
+	}
+	for modeName, sp := range savePolicies {
+		if parsed[modeName] != sp {
+			t.Errorf("%s: expected %+v, got %+v", modeName, sp, parsed[modeName])
+		}
+	}
+	if _, err := parseSavePolicies("o save policy 2\n"); err != errSavePolicyVersion {
+		t.Errorf("expected a version error, got %v", err)
+	}
+
+	// The chosen policy is used, but patches are never stripped
+	if sp := savePolicyFor(mode.Text, "notes.txt"); sp != (SavePolicy{finalNewline: true}) {
+		t.Errorf("expected the chosen policy for text, got %+v", sp)
+	}
+	if sp := savePolicyFor(mode.Blank, "fix.patch"); sp.stripTrailingWhitespace || sp.stripTrailingBlankLines {
+		t.Errorf("expected patches to keep trailing whitespace, got %+v", sp)
+	}
+	if sp := savePolicyFor(mode.Markdown, "README.md"); sp != (SavePolicy{}) {
+		t.Errorf("expected the default policy for Markdown, got %+v", sp)
+	}
+}
+
+func TestWithoutTrailingBlankLines(t *testing.T) {
+	tests := map[string]string{
+		"a  \n\n \t\n":  "a  \n",
+		"a\nb\n":        "a\nb\n",
+		"a":             "a",
+		"\n\n":          "",
+		"a\n  b \n  \n": "a\n  b \n",
+	}
+	for s, expected := range tests {
+		if trimmed := withoutTrailingBlankLines(s); trimmed != expected {
+			t.Errorf("%q: expected %q, got %q", s, expected, trimmed)
+		}
+	}
+}
+
+func TestSaveWithSavePolicy(t *testing.T) {
+	const contents = "trailing  \ntext\t\n\n\nlast"
+	filename := filepath.Join(t.TempDir(), "notes.txt")
+	save := func(sp SavePolicy) string {
+		if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e := NewSimpleEditor(80)
+		e.filename = filename
+		e.savePolicy = sp
+		if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+			t.Fatal(err)
+		}
+		e.forceSave = true
+		if err := e.Save(vt100.NewCanvas(), nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if s := save(SavePolicy{}); s != contents {
+		t.Errorf("expected the file to be saved as it was, got %q", s)
+	}
+	if s := save(SavePolicy{finalNewline: true}); s != contents+"\n" {
+		t.Errorf("expected only a final newline to be added, got %q", s)
+	}
+	if s := save(SavePolicy{stripTrailingWhitespace: true, finalNewline: true, stripTrailingBlankLines: true}); s != "trailing\ntext\n\n\nlast\n" {
+		t.Errorf("expected trailing whitespace to be stripped, got %q", s)
+	}
+	const blankLines = "text  \n\n \n"
+	if err := os.WriteFile(filename, []byte(blankLines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.savePolicy = SavePolicy{finalNewline: true, stripTrailingBlankLines: true}
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	e.forceSave = true
+	if err := e.Save(vt100.NewCanvas(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "text  \n" {
+		t.Errorf("expected only the trailing blank lines to be stripped, got %q", data)
+	}
+}
@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/xyproto/mode"
 	"github.com/xyproto/vt100"
@@ -16,18 +21,188 @@ var (
 	searchHistoryFilename = filepath.Join(userCacheDir, "o", "search.txt")
 	searchHistory         = []string{}
 	errNoSearchMatch      = errors.New("no search match")
+	errNoSearchTerm       = errors.New("no word at the cursor and no previous search")
+
+	// searchWrap is true if searching continues from the other end of the file when there are no more matches
+	searchWrap = true
 )
 
+// regexpSearchPrefix is the prefix for search terms that are regular expressions, like "re:func \w+Handler"
+const regexpSearchPrefix = "re:"
+
+// splitSearchModifiers returns the search term without the modifiers at the end, and which modifiers were given.
+// "foo/i" ignores case, "foo/w" only matches whole words and "foo/iw" does both.
+func splitSearchModifiers(term string) (string, bool, bool) {
+	i := strings.LastIndex(term, "/")
+	if i < 1 || i == len(term)-1 || len(term)-i > 3 {
+		return term, false, false
+	}
+	ignoreCase, wholeWord := false, false
+	for _, r := range term[i+1:] {
+		switch {
+		case r == 'i' && !ignoreCase:
+			ignoreCase = true
+		case r == 'w' && !wholeWord:
+			wholeWord = true
+		default:
+			return term, false, false
+		}
+	}
+	return term[:i], ignoreCase, wholeWord
+}
+
+// SearchRegexp returns the compiled regular expression and true, if the search term starts with "re:"
+// or if case should be ignored. The regular expression is nil if the pattern is invalid,
+// and then SearchRegexpError returns the error.
+func (e *Editor) SearchRegexp() (*regexp.Regexp, bool) {
+	term, ignoreCase, _ := splitSearchModifiers(e.searchTerm)
+	isRegexp := strings.HasPrefix(term, regexpSearchPrefix)
+	if !isRegexp && !ignoreCase {
+		return nil, false
+	}
+	if e.searchTerm != e.searchRegexpTerm {
+		e.searchRegexpTerm = e.searchTerm
+		pattern := regexp.QuoteMeta(term)
+		if isRegexp {
+			pattern = strings.TrimPrefix(term, regexpSearchPrefix)
+		}
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		e.searchRegexp, e.searchRegexpErr = regexp.Compile(pattern)
+	}
+	return e.searchRegexp, true
+}
+
+// SearchRegexpError returns an error if the search term is an invalid regular expression
+func (e *Editor) SearchRegexpError() error {
+	if re, ok := e.SearchRegexp(); ok && re == nil {
+		return fmt.Errorf("invalid regular expression: %w", e.searchRegexpErr)
+	}
+	return nil
+}
+
+// searchIndex returns the byte index of the first match of the search term in the given string,
+// that starts at the given byte index or later. -1 is returned if there is no match.
+// Regular expressions are matched against the whole string, so that "^" and "\b" work as expected.
+func (e *Editor) searchIndex(s string, from int) int {
+	if re, ok := e.SearchRegexp(); ok {
+		if re == nil {
+			return -1
+		}
+		for _, loc := range re.FindAllStringIndex(s, -1) {
+			if loc[0] >= from && e.wholeWordMatch(s, loc[0], loc[1]) {
+				return loc[0]
+			}
+		}
+		return -1
+	}
+	term, _, _ := splitSearchModifiers(e.searchTerm)
+	for from <= len(s) {
+		i := strings.Index(s[from:], term)
+		if i < 0 {
+			break
+		}
+		i += from
+		if e.wholeWordMatch(s, i, i+len(term)) {
+			return i
+		}
+		from = i + 1
+	}
+	return -1
+}
+
+// isWordRune checks if the given rune can be part of an identifier, like when searching for the word at the cursor
+// or when converting an identifier between camelCase and snake_case
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// isWholeWord checks if the text from byte index i up to j in s is not a part of a longer word,
+// where the given function decides which runes words are made of
+func isWholeWord(s string, i, j int, wordRune func(rune) bool) bool {
+	if r, _ := utf8.DecodeLastRuneInString(s[:i]); i > 0 && wordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(s[j:]); j < len(s) && wordRune(r) {
+		return false
+	}
+	return true
+}
+
+// wholeWordMatch checks if the match from byte index i up to j in s should be used, when only whole words should match.
+// Search terms that end with "/w" match words like the ones that WordAtCursor returns.
+func (e *Editor) wholeWordMatch(s string, i, j int) bool {
+	if _, _, wholeWord := splitSearchModifiers(e.searchTerm); wholeWord {
+		return isWholeWord(s, i, j, isWordAtCursorRune)
+	}
+	return !e.searchWholeWord || isWholeWord(s, i, j, isWordRune)
+}
+
+// searchMatchRunes returns which of the given runes are part of a match of the search term,
+// or nil if there are no matches
+func (e *Editor) searchMatchRunes(runes []rune) []bool {
+	if e.searchTerm == "" {
+		return nil
+	}
+	s := string(runes)
+	var spans [][]int
+	if re, ok := e.SearchRegexp(); ok {
+		if re == nil {
+			return nil
+		}
+		for _, span := range re.FindAllStringIndex(s, -1) {
+			if e.wholeWordMatch(s, span[0], span[1]) {
+				spans = append(spans, span)
+			}
+		}
+	} else {
+		term, _, _ := splitSearchModifiers(e.searchTerm)
+		for i := 0; i < len(s); {
+			j := strings.Index(s[i:], term)
+			if j < 0 {
+				break
+			}
+			if !e.wholeWordMatch(s, i+j, i+j+len(term)) {
+				i += j + 1
+				continue
+			}
+			spans = append(spans, []int{i + j, i + j + len(term)})
+			i += j + len(term)
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	matched := make([]bool, len(runes))
+	runeIndex := 0
+	for byteIndex := range s {
+		for _, span := range spans {
+			if byteIndex >= span[0] && byteIndex < span[1] {
+				matched[runeIndex] = true
+				break
+			}
+		}
+		runeIndex++
+	}
+	return matched
+}
+
 // SetSearchTerm will set the current search term to highlight
 func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string) {
+	// Remember where a new search was started, but not while the search term is being changed
+	if e.searchTerm == "" {
+		e.lineBeforeSearch = e.DataY()
+	}
 	// set the search term
 	e.searchTerm = s
 	// set the sticky search term (used by ctrl-n, cleared by Esc only)
 	e.stickySearchTerm = s
+	// search terms that are typed in match anywhere, also within longer words
+	e.searchWholeWord = false
 	// Go to the first instance after the current line, if found
-	e.lineBeforeSearch = e.DataY()
 	for y := e.DataY(); y < LineIndex(e.Len()); y++ {
-		if strings.Contains(e.Line(y), s) {
+		if e.searchIndex(e.Line(y), 0) >= 0 {
 			// Found an instance, scroll there
 			// GoTo returns true if the screen should be redrawn
 			redraw, _ := e.GoTo(y, c, status)
@@ -41,6 +216,28 @@ func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string) {
 	e.DrawLines(c, true, false)
 }
 
+// SearchState is the part of the search that belongs to the editing session instead of to a file,
+// so that the same search can be continued with ctrl-n after switching to another file
+type SearchState struct {
+	term       string // the search term that is highlighted, if any
+	stickyTerm string // the search term that is used by ctrl-n and ctrl-p
+	wholeWord  bool   // only match whole words, like after esc *
+}
+
+// SearchState returns the current search state
+func (e *Editor) SearchState() SearchState {
+	return SearchState{e.searchTerm, e.stickySearchTerm, e.searchWholeWord}
+}
+
+// RestoreSearchState restores a search state, for instance after switching to another file.
+// Jumping between the matches starts from the current line.
+func (e *Editor) RestoreSearchState(ss SearchState) {
+	e.searchTerm = ss.term
+	e.stickySearchTerm = ss.stickyTerm
+	e.searchWholeWord = ss.wholeWord
+	e.lineBeforeSearch = e.DataY()
+}
+
 // SearchTerm will return the current search term
 func (e *Editor) SearchTerm() string {
 	return e.searchTerm
@@ -55,6 +252,10 @@ func (e *Editor) ClearSearchTerm() {
 // which is not cleared by Esc, but by ctrl-p.
 func (e *Editor) UseStickySearchTerm() {
 	if e.stickySearchTerm != "" {
+		if e.searchTerm == "" {
+			// Jumping between the matches starts from here
+			e.lineBeforeSearch = e.DataY()
+		}
 		e.searchTerm = e.stickySearchTerm
 	}
 }
@@ -64,161 +265,237 @@ func (e *Editor) ClearStickySearchTerm() {
 	e.stickySearchTerm = ""
 }
 
-// forwardSearch is a helper function for searching for a string from the given startIndex,
-// up to the given stopIndex. -1
-// -1 is returned if there are no matches.
-// startIndex is expected to be smaller than stopIndex
-// x, y is returned.
-func (e *Editor) forwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex) {
-	var (
-		s      = e.SearchTerm()
-		foundX = -1
-		foundY = LineIndex(-1)
-	)
-	if s == "" {
-		// Return -1, -1 if no search term is set
-		return foundX, foundY
-	}
-	currentIndex := e.DataY()
-	// Search from the given startIndex up to the given stopIndex
-	for y := startIndex; y < stopIndex; y++ {
-		lineContents := e.Line(y)
-		if y == currentIndex {
-			x, err := e.DataX()
-			if err != nil {
-				continue
-			}
-			// Search from the next byte (not rune) position on this line
-			// TODO: Move forward one rune instead of one byte
-			x++
-			if x >= len(lineContents) {
-				continue
-			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
-				foundY = y
-				break
-			}
-		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
-				foundY = y
-				break
-			}
+// searchMatchPositions returns the rune indexes of where the matches of the search term start on the given line
+func (e *Editor) searchMatchPositions(y LineIndex) []int {
+	line := e.Line(y)
+	var positions []int
+	for from := 0; from <= len(line); {
+		i := e.searchIndex(line, from)
+		if i < 0 {
+			break
+		}
+		positions = append(positions, utf8.RuneCountInString(line[:i]))
+		// Move past the first rune of the match, so that empty regular expression matches are not found again
+		_, size := utf8.DecodeRuneInString(line[i:])
+		if size == 0 {
+			size = 1
 		}
+		from = i + size
 	}
-	return foundX, LineIndex(foundY)
+	return positions
 }
 
-// backwardSearch is a helper function for searching for a string from the given startIndex,
-// backwards to the given stopIndex. -1, -1 is returned if there are no matches.
-// startIndex is expected to be larger than stopIndex
-func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex) {
-	var (
-		s      = e.SearchTerm()
-		foundX = -1
-		foundY = LineIndex(-1)
-	)
-	if len(s) == 0 {
-		// Return -1, -1 if no search term is set
-		return foundX, foundY
-	}
-	currentIndex := e.DataY()
-	// Search from the given startIndex backwards up to the given stopIndex
-	for y := startIndex; y >= stopIndex; y-- {
-		lineContents := e.Line(y)
-		if y == currentIndex {
-			x, err := e.DataX()
-			if err != nil {
-				continue
-			}
-			// Search from the next byte (not rune) position on this line
-			// TODO: Move forward one rune instead of one byte
-			x++
-			if x >= len(lineContents) {
-				continue
-			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
-				foundY = y
-				break
-			}
-		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
-				foundY = y
-				break
-			}
+// searchMatch is the position of a match of the search term, as a rune index and a line index
+type searchMatch struct {
+	x int
+	y LineIndex
+}
+
+// before checks if this match comes before the given position
+func (m searchMatch) before(x int, y LineIndex) bool {
+	return m.y < y || (m.y == y && m.x < x)
+}
+
+// searchMatchCache is the matches of a search term, for a generation of the editor contents
+type searchMatchCache struct {
+	generation uint64
+	valid      bool
+	term       string
+	wholeWord  bool
+	matches    []searchMatch
+}
+
+// searchMatchList returns all matches of the search term, in order. The matches are only found
+// again after the contents or the search term have been changed.
+func (e *Editor) searchMatchList() []searchMatch {
+	if e.SearchTerm() == "" || e.SearchRegexpError() != nil {
+		return nil
+	}
+	generation := e.dirty.Generation()
+	cache := &e.searchMatches
+	if e.dirty != nil && cache.valid && cache.generation == generation && cache.term == e.searchTerm && cache.wholeWord == e.searchWholeWord {
+		return cache.matches
+	}
+	var matches []searchMatch
+	for y := LineIndex(0); y < LineIndex(e.Len()); y++ {
+		for _, x := range e.searchMatchPositions(y) {
+			matches = append(matches, searchMatch{x, y})
+		}
+	}
+	*cache = searchMatchCache{generation, true, e.searchTerm, e.searchWholeWord, matches}
+	return matches
+}
+
+// findMatch finds the next or previous match of the search term, from the cursor.
+// If wrap is true and there are no more matches in that direction, the search continues from the other end.
+// Returns the rune index and line index of the match, or -1, -1 if there are no matches,
+// and true if the search wrapped around.
+func (e *Editor) findMatch(wrap, forward bool) (int, LineIndex, bool) {
+	matches := e.searchMatchList()
+	if len(matches) == 0 {
+		return -1, -1, false
+	}
+	cursorX, cursorY := e.cursorDataPosition()
+	if forward {
+		// The first match after the cursor
+		i := sort.Search(len(matches), func(i int) bool { return !matches[i].before(cursorX+1, cursorY) })
+		if i < len(matches) {
+			return matches[i].x, matches[i].y, false
 		}
+		if wrap {
+			// Continue from the top, up to and including the match at the cursor, if any
+			return matches[0].x, matches[0].y, true
+		}
+		return -1, -1, false
+	}
+	// The last match before the cursor
+	i := sort.Search(len(matches), func(i int) bool { return !matches[i].before(cursorX, cursorY) }) - 1
+	if i >= 0 {
+		return matches[i].x, matches[i].y, false
 	}
-	return foundX, LineIndex(foundY)
+	if wrap {
+		// Continue from the bottom, down to and including the match at the cursor, if any
+		last := matches[len(matches)-1]
+		return last.x, last.y, true
+	}
+	return -1, -1, false
+}
+
+// SearchMatchCount returns the number of the match at the cursor, counting from 1, and the total number of matches
+// of the search term. The number is 0 if the cursor is not at a match.
+func (e *Editor) SearchMatchCount() (int, int) {
+	matches := e.searchMatchList()
+	cursorX, cursorY := e.cursorDataPosition()
+	i := sort.Search(len(matches), func(i int) bool { return !matches[i].before(cursorX, cursorY) })
+	if i < len(matches) && matches[i].x == cursorX && matches[i].y == cursorY {
+		return i + 1, len(matches)
+	}
+	return 0, len(matches)
 }
 
 // GoToNextMatch will go to the next match, searching for "e.SearchTerm()".
 // * The search wraps around if wrap is true.
 // * The search is backawards if forward is false.
 // * The search is case-sensitive.
+// Returns true if the search wrapped around.
 // Returns an error if the search was successful but no match was found.
-func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward bool) error {
-	var (
-		foundX int
-		foundY LineIndex
-		s      = e.SearchTerm()
-	)
-
+func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward bool) (bool, error) {
 	// Check if there's something to search for
-	if s == "" {
-		return nil
+	if e.SearchTerm() == "" {
+		return false, nil
 	}
 
-	// Search forward or backward
-	if forward {
-		// Forward search from the current location
-		startIndex := e.DataY()
-		stopIndex := LineIndex(e.Len())
-		foundX, foundY = e.forwardSearch(startIndex, stopIndex)
-	} else {
-		// Backward search form the current location
-		startIndex := e.DataY()
-		stopIndex := LineIndex(0)
-		foundX, foundY = e.backwardSearch(startIndex, stopIndex)
-	}
-
-	if foundY == -1 && wrap {
-		if forward {
-			// Do a search from the top if a match was not found
-			startIndex := LineIndex(0)
-			stopIndex := LineIndex(e.Len())
-			foundX, foundY = e.forwardSearch(startIndex, stopIndex)
-		} else {
-			// Do a search from the bottom if a match was not found
-			startIndex := LineIndex(e.Len())
-			stopIndex := LineIndex(0)
-			foundX, foundY = e.backwardSearch(startIndex, stopIndex)
-		}
+	// Check if the search term is a valid regular expression
+	if err := e.SearchRegexpError(); err != nil {
+		return false, err
 	}
 
+	foundX, foundY, wrapped := e.findMatch(wrap, forward)
+
 	// Check if a match was found
 	if foundY == -1 {
 		// Not found
 		e.GoTo(e.lineBeforeSearch, c, status)
-		return errNoSearchMatch
+		return false, errNoSearchMatch
 	}
 
 	// Go to the found match
 	e.redraw, _ = e.GoTo(foundY, c, status)
-	if foundX != -1 {
-		tabs := strings.Count(e.Line(foundY), "\t")
-		e.pos.sx = foundX + (tabs * (e.indentation.PerTab - 1))
-		e.HorizontalScrollIfNeeded(c)
-	}
+	e.GoToDataX(c, foundX)
 
 	// Center and prepare to redraw
 	e.Center(c)
 	e.redraw = true
 	e.redrawCursor = e.redraw
 
-	return nil
+	return wrapped, nil
+}
+
+// SearchFromArgument goes to the first match of a search pattern that was given on the command line,
+// or to the last match if the search is backwards. The pattern becomes the sticky search term, so that
+// ctrl-n and ctrl-p continue from there. Returns false if there are no matches, and then the cursor is not moved.
+func (e *Editor) SearchFromArgument(c *vt100.Canvas, status *StatusBar, sa searchArgument) bool {
+	e.searchTerm = sa.pattern
+	e.searchWholeWord = false
+	matches := e.searchMatchList()
+	if len(matches) == 0 {
+		e.searchTerm = ""
+		return false
+	}
+	e.stickySearchTerm = sa.pattern
+	e.lineBeforeSearch = e.DataY()
+	m := matches[0]
+	if sa.backward {
+		m = matches[len(matches)-1]
+	}
+	e.GoTo(m.y, c, status)
+	e.GoToDataX(c, m.x)
+	e.Center(c)
+	e.redraw = true
+	e.redrawCursor = true
+	return true
+}
+
+// SearchWordAtCursor searches for the word at the cursor as a whole word, like * and # in vim, and goes to the next
+// or previous match. The word is made of letters, digits and underscores, so only one part of a selector expression
+// like os.ReadFile is searched for. If the cursor is not at a word, the last search term is used instead.
+// Returns true if the search wrapped around.
+func (e *Editor) SearchWordAtCursor(c *vt100.Canvas, status *StatusBar, forward bool) (bool, error) {
+	runes, x := e.cursorRunes()
+	if start, end, ok := wordBounds(runes, x, isWordRune); ok {
+		word := string(runes[start:end])
+		if e.searchTerm == "" {
+			e.lineBeforeSearch = e.DataY()
+		}
+		e.searchTerm = word
+		e.stickySearchTerm = word
+		e.searchWholeWord = true
+	} else {
+		e.UseStickySearchTerm()
+	}
+	if e.SearchTerm() == "" {
+		return false, errNoSearchTerm
+	}
+	return e.GoToNextMatch(c, status, searchWrap, forward)
+}
+
+// searchMatchMessage returns a status message with the number of the current match, like "Match 2 of 5",
+// that also tells if the search wrapped around
+func (e *Editor) searchMatchMessage(wrapped, forward bool) string {
+	current, total := e.SearchMatchCount()
+	switch {
+	case wrapped && forward:
+		return fmt.Sprintf("Search wrapped to top, match %d of %d", current, total)
+	case wrapped:
+		return fmt.Sprintf("Search wrapped to bottom, match %d of %d", current, total)
+	}
+	return fmt.Sprintf("Match %d of %d", current, total)
+}
+
+// searchNotFoundMessage returns a status message for when there is no match to go to,
+// that tells if there are no matches in the file at all
+func (e *Editor) searchNotFoundMessage(wrap bool) string {
+	if _, total := e.SearchMatchCount(); total == 0 {
+		return "No matches for " + e.SearchTerm()
+	}
+	if wrap {
+		return e.SearchTerm() + " not found"
+	}
+	return e.SearchTerm() + " not found from here"
+}
+
+// searchPromptMessage returns the search prompt with the search term that has been typed in so far,
+// and tells right away if there are no matches
+func (e *Editor) searchPromptMessage(searchPrompt, s string) string {
+	if s == "" {
+		return searchPrompt
+	}
+	if e.SearchTerm() == s && e.SearchRegexpError() == nil {
+		if _, total := e.SearchMatchCount(); total == 0 {
+			return searchPrompt + " " + s + " (no matches)"
+		}
+	}
+	return searchPrompt + " " + s
 }
 
 // SearchMode will enter the interactive "search mode" where the user can type in a string and then press return to search
@@ -235,20 +512,17 @@ AGAIN:
 	doneCollectingLetters := false
 	pressedReturn := false
 	pressedTab := false
+	pressedConfirm := false
 	if clear {
 		// Clear the previous search
 		e.SetSearchTerm(c, status, "")
 	}
 	s := e.SearchTerm()
 	status.ClearAll(c)
-	if s == "" {
-		status.SetMessage(searchPrompt)
-	} else {
-		status.SetMessage(searchPrompt + " " + s)
-	}
+	status.SetMessage(e.searchPromptMessage(searchPrompt, s))
 	status.ShowNoTimeout(c, e)
 	for !doneCollectingLetters {
-		key = tty.String()
+		key = readKey(tty)
 		switch key {
 		case "c:8", "c:127": // ctrl-h or backspace
 			if len(s) > 0 {
@@ -257,7 +531,7 @@ AGAIN:
 					e.SetSearchTerm(c, status, s)
 				}
 				e.GoToLineNumber(initialLocation, c, status, false)
-				status.SetMessage(searchPrompt + " " + s)
+				status.SetMessage(e.searchPromptMessage(searchPrompt, s))
 				status.ShowNoTimeout(c, e)
 			}
 		case "c:27", "c:17": // esc or ctrl-q
@@ -273,6 +547,11 @@ AGAIN:
 		case "c:13": // return
 			pressedReturn = true
 			doneCollectingLetters = true
+		case "c:18": // ctrl-r, replace after confirming each match
+			if previousSearch != "" {
+				pressedConfirm = true
+				doneCollectingLetters = true
+			}
 		case "↑": // previous in the search history
 			if len(searchHistory) == 0 {
 				break
@@ -286,7 +565,7 @@ AGAIN:
 			if previousSearch == "" {
 				e.SetSearchTerm(c, status, s)
 			}
-			status.SetMessage(searchPrompt + " " + s)
+			status.SetMessage(e.searchPromptMessage(searchPrompt, s))
 			status.ShowNoTimeout(c, e)
 		case "↓": // next in the search history
 			if len(searchHistory) == 0 {
@@ -301,15 +580,15 @@ AGAIN:
 			if previousSearch == "" {
 				e.SetSearchTerm(c, status, s)
 			}
-			status.SetMessage(searchPrompt + " " + s)
+			status.SetMessage(e.searchPromptMessage(searchPrompt, s))
 			status.ShowNoTimeout(c, e)
 		default:
-			if key != "" && !strings.HasPrefix(key, "c:") {
+			if key != "" && !strings.HasPrefix(key, "c:") && key != keyHome && key != keyEnd && key != keyInsert && !strings.HasPrefix(key, "s:") && !isMouseKey(key) {
 				s += key
 				if previousSearch == "" {
 					e.SetSearchTerm(c, status, s)
 				}
-				status.SetMessage(searchPrompt + " " + s)
+				status.SetMessage(e.searchPromptMessage(searchPrompt, s))
 				status.ShowNoTimeout(c, e)
 			}
 		}
@@ -317,8 +596,8 @@ AGAIN:
 	status.ClearAll(c)
 
 	// Search settings
-	forward := true // forward search
-	wrap := true    // with wraparound
+	forward := true    // forward search
+	wrap := searchWrap // with wraparound, unless disabled in the settings
 
 	// A special case, search backwards to the start of the function (or to "main")
 	if s == "f" {
@@ -351,11 +630,45 @@ AGAIN:
 		forward = false
 	}
 
+	// Ignore case when replacing by using a regular expression. Replacing only whole words is not supported.
+	if term, ignoreCase, wholeWord := splitSearchModifiers(previousSearch); previousSearch != "" && wholeWord && (pressedTab || pressedReturn || pressedConfirm) {
+		status.SetErrorMessage("Can not replace whole words only, remove /w from the search term")
+		status.ShowNoTimeout(c, e)
+		return
+	} else if ignoreCase {
+		if strings.HasPrefix(term, regexpSearchPrefix) {
+			previousSearch = regexpSearchPrefix + "(?i)" + strings.TrimPrefix(term, regexpSearchPrefix)
+		} else {
+			previousSearch = regexpSearchPrefix + "(?i)" + regexp.QuoteMeta(term)
+			s = strings.ReplaceAll(s, "$", "$$")
+		}
+	}
+
 	if pressedTab && previousSearch == "" { // search text -> tab
 		// got the search text, now gather the replace text
 		previousSearch = e.searchTerm
-		searchPrompt = "Replace with:"
+		searchPrompt = "Replace with (ctrl-r to confirm each):"
 		goto AGAIN
+	} else if pressedConfirm && previousSearch != "" { // search text -> tab -> replace text -> ctrl-r
+		e.ReplaceInteractively(c, tty, status, undo, previousSearch, s)
+		return
+	} else if previousSearch != "" && (pressedTab || pressedReturn) && strings.HasPrefix(previousSearch, regexpSearchPrefix) {
+		// replace once (tab) or all (return), using a regular expression, where "$1" is the first group
+		replaced, instanceCount, err := replaceRegexp(e.String(), strings.TrimPrefix(previousSearch, regexpSearchPrefix), s, pressedTab)
+		if err != nil {
+			status.SetError(err)
+			status.ShowNoTimeout(c, e)
+			return
+		}
+		undo.Snapshot(e)
+		e.LoadBytes([]byte(replaced))
+		extraS := ""
+		if instanceCount != 1 {
+			extraS = "s"
+		}
+		status.messageAfterRedraw = fmt.Sprintf("Replaced %d instance%s of %s with %s", instanceCount, extraS, previousSearch, s)
+		e.redraw = true
+		return
 	} else if pressedTab && previousSearch != "" { // search text -> tab -> replace text- > tab
 		undo.Snapshot(e)
 		// replace once
@@ -417,24 +730,201 @@ AGAIN:
 
 	if previousSearch == "" {
 		// Perform the actual search
-		if err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
+		if wrapped, err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
 			// If no match was found, and return was not pressed, try again from the top
 			//e.GoToTop(c, status)
 			//err = e.GoToNextMatch(c, status)
 			if err == errNoSearchMatch {
-				if wrap {
-					status.SetMessage(s + " not found")
-				} else {
-					status.SetMessage(s + " not found from here")
-				}
+				status.SetMessage(e.searchNotFoundMessage(wrap))
 				status.ShowNoTimeout(c, e)
 			}
+		} else if err != nil {
+			// Show that the regular expression is invalid, instead of silently not matching anything
+			status.SetError(err)
+			status.ShowNoTimeout(c, e)
+		} else {
+			// Show the number of the match, and if the search wrapped around
+			status.SetMessageAfterRedraw(e.searchMatchMessage(wrapped, forward))
 		}
 		e.Center(c)
 	}
 
 }
 
+// replaceRegexp replaces the matches of the given regular expression in s, where "$1" in the replacement
+// expands to the first group. "^" and "$" match at the start and end of each line.
+// If once is true, only the first match is replaced. Returns the new string and the number of replacements.
+func replaceRegexp(s, pattern, replacement string, once bool) (string, int, error) {
+	re, err := regexp.Compile("(?m)" + pattern)
+	if err != nil {
+		return s, 0, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	if err := checkReplacementGroups(re, replacement); err != nil {
+		return s, 0, err
+	}
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if once && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(s[last:m[0]])
+		sb.Write(re.ExpandString(nil, replacement, s, m))
+		last = m[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), len(matches), nil
+}
+
+// checkReplacementGroups checks that the groups that the replacement refers to, like "$1", "${2}" or "${name}",
+// exist in the regular expression, since regexp.Expand silently replaces missing groups with nothing
+func checkReplacementGroups(re *regexp.Regexp, replacement string) error {
+	for i := 0; i < len(replacement)-1; i++ {
+		if replacement[i] != '$' {
+			continue
+		}
+		rest := replacement[i+1:]
+		if rest[0] == '$' { // "$$" is a literal "$"
+			i++
+			continue
+		}
+		var name string
+		if rest[0] == '{' {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				continue
+			}
+			name = rest[1:end]
+			i += end + 1
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+			if end < 0 {
+				end = len(rest)
+			}
+			name = rest[:end]
+			i += end
+		}
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > re.NumSubexp() {
+				return fmt.Errorf("the replacement refers to group $%d, but the regular expression has %d group(s)", n, re.NumSubexp())
+			}
+		} else if re.SubexpIndex(name) < 0 {
+			return fmt.Errorf("the replacement refers to group ${%s}, which is not in the regular expression", name)
+		}
+	}
+	return nil
+}
+
+// nextReplaceMatch finds the next match in the given line, starting at the given byte index or later.
+// If re is nil, searchFor is matched literally. Returns the start and end byte index of the match
+// and the text to replace it with, or -1 as the start index if there are no more matches.
+func nextReplaceMatch(re *regexp.Regexp, searchFor, replaceWith, line string, from int) (int, int, string) {
+	if from > len(line) {
+		return -1, -1, ""
+	}
+	if re == nil {
+		i := strings.Index(line[from:], searchFor)
+		if i < 0 || searchFor == "" {
+			return -1, -1, ""
+		}
+		return from + i, from + i + len(searchFor), replaceWith
+	}
+	for _, m := range re.FindAllStringSubmatchIndex(line, -1) {
+		if m[0] >= from {
+			return m[0], m[1], string(re.ExpandString(nil, replaceWith, line, m))
+		}
+	}
+	return -1, -1, ""
+}
+
+// ReplaceInteractively goes to each match of searchFor, from the top, and asks if it should be replaced with replaceWith.
+// The answers are y (yes), n (no), a (all remaining) and q (quit). If searchFor starts with "re:", it is a
+// regular expression and "$1" in the replacement expands to the first group. All replacements are one undo step.
+func (e *Editor) ReplaceInteractively(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo, searchFor, replaceWith string) {
+	var re *regexp.Regexp
+	if strings.HasPrefix(searchFor, regexpSearchPrefix) {
+		var err error
+		if re, err = regexp.Compile(strings.TrimPrefix(searchFor, regexpSearchPrefix)); err != nil {
+			status.SetError(fmt.Errorf("invalid regular expression: %w", err))
+			status.ShowNoTimeout(c, e)
+			return
+		}
+		if err := checkReplacementGroups(re, replaceWith); err != nil {
+			status.SetError(err)
+			status.ShowNoTimeout(c, e)
+			return
+		}
+	}
+
+	// Highlight the matches while asking
+	e.searchTerm = searchFor
+
+	var (
+		instanceCount int
+		all           bool
+		snapshotTaken bool
+	)
+OUT:
+	for y := LineIndex(0); y < LineIndex(e.Len()); y++ {
+		for x := 0; ; {
+			line := e.Line(y)
+			start, end, replacement := nextReplaceMatch(re, searchFor, replaceWith, line, x)
+			if start < 0 {
+				break
+			}
+			if !all {
+				// Go to the match and ask the user
+				e.redraw, _ = e.GoTo(y, c, status)
+				e.GoToDataX(c, utf8.RuneCountInString(line[:start]))
+				e.Center(c)
+				e.DrawLines(c, true, false)
+				e.redrawCursor = true
+				e.RepositionCursorIfNeeded()
+				answer, ok := e.UserInput(c, tty, status, "Replace? (y/n/a/q)", []string{"y", "n", "a", "q"}, false)
+				switch answer = strings.ToLower(strings.TrimSpace(answer)); {
+				case !ok, answer == "q":
+					break OUT
+				case answer == "a":
+					all = true
+				case answer != "y":
+					// Skip this match
+					x = end
+					if end == start {
+						x++
+					}
+					continue
+				}
+			}
+			// The whole replace session is a single undo step
+			if !snapshotTaken {
+				undo.Snapshot(e)
+				snapshotTaken = true
+			}
+			e.SetLine(y, line[:start]+replacement+line[end:])
+			instanceCount++
+			x = start + len(replacement)
+			if end == start {
+				x++
+			}
+		}
+	}
+
+	if instanceCount > 0 {
+		e.changed = true
+	}
+	extraS := ""
+	if instanceCount != 1 {
+		extraS = "s"
+	}
+	status.messageAfterRedraw = fmt.Sprintf("Replaced %d instance%s of %s with %s", instanceCount, extraS, searchFor, replaceWith)
+	e.redraw = true
+	e.redrawCursor = true
+}
+
 // LoadSearchHistory will load a list of strings from the given filename
 func LoadSearchHistory(filename string) ([]string, error) {
 	data, err := os.ReadFile(filename)
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.searchTerm = "re:func \\w+Handler"
+	line := "func rootHandler(w http.ResponseWriter) { funcHandler() }"
+	if i := e.searchIndex(line, 0); i != 0 {
+		t.Errorf("expected a match at 0, got %d", i)
+	}
+	if i := e.searchIndex(line, 1); i != -1 {
+		t.Errorf("expected no match after 0, got %d", i)
+	}
+	// Anchors are matched against the whole line, also when searching from the middle of it
+	e.searchTerm = "re:^x"
+	if i := e.searchIndex("xax", 1); i != -1 {
+		t.Errorf("expected ^ to only match at the start of the line, got %d", i)
+	}
+	e.searchTerm = "ax"
+	if i := e.searchIndex("xaxax", 2); i != 3 {
+		t.Errorf("expected a literal match at 3, got %d", i)
+	}
+}
+
+func TestSearchRegexpError(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.searchTerm = "re:func ("
+	if err := e.SearchRegexpError(); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+	if i := e.searchIndex("func (", 0); i != -1 {
+		t.Errorf("expected no match for an invalid regular expression, got %d", i)
+	}
+	e.searchTerm = "func ("
+	if err := e.SearchRegexpError(); err != nil {
+		t.Errorf("did not expect an error for a literal search term: %v", err)
+	}
+}
+
+func TestSearchMatchRunes(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.searchTerm = "re:[0-9]+"
+	got := e.searchMatchRunes([]rune("æ12ø3"))
+	expected := []bool{false, true, true, false, true}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+	e.searchTerm = "aa"
+	got = e.searchMatchRunes([]rune("aaa"))
+	if !got[0] || !got[1] || got[2] {
+		t.Errorf("expected non-overlapping literal matches, got %v", got)
+	}
+	e.searchTerm = "re:x"
+	if got := e.searchMatchRunes([]rune("abc")); got != nil {
+		t.Errorf("expected nil when there are no matches, got %v", got)
+	}
+}
+
+func TestReplaceRegexp(t *testing.T) {
+	s := "func aHandler()\nfunc bHandler()\n"
+	replaced, n, err := replaceRegexp(s, `^func (\w+)Handler`, "func handle_$1", false)
+	if err != nil || n != 2 || replaced != "func handle_a()\nfunc handle_b()\n" {
+		t.Errorf("got %q, %d, %v", replaced, n, err)
+	}
+	replaced, n, err = replaceRegexp(s, `Handler`, "H", true)
+	if err != nil || n != 1 || replaced != "func aH()\nfunc bHandler()\n" {
+		t.Errorf("got %q, %d, %v", replaced, n, err)
+	}
+	if _, _, err := replaceRegexp(s, `(`, "", false); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestCheckReplacementGroups(t *testing.T) {
+	re := regexp.MustCompile(`foo(\w+)-(?P<suffix>\d)`)
+	for replacement, ok := range map[string]bool{
+		"bar($1)":        true,
+		"${2}${0}":       true,
+		"${suffix}":      true,
+		"$$3 costs $$":   true,
+		"price: $":       true,
+		"$3":             false,
+		"${3}":           false,
+		"$1x":            false,
+		"${prefix}":      false,
+		"a $2 b ${name":  true,
+		"$suffix$1$2$$9": true,
+	} {
+		if err := checkReplacementGroups(re, replacement); (err == nil) != ok {
+			t.Errorf("%q: expected ok to be %v, got %v", replacement, ok, err)
+		}
+	}
+
+	// Nothing is replaced if the replacement refers to a missing group
+	s := "foo(x) foo(y)"
+	if replaced, n, err := replaceRegexp(s, `foo\((\w)\)`, "bar($2)", false); err == nil || n != 0 || replaced != s {
+		t.Errorf("expected an error and no replacements, got %q, %d, %v", replaced, n, err)
+	}
+	if replaced, n, err := replaceRegexp(s, `foo\((\w)\)`, "bar($1)", false); err != nil || n != 2 || replaced != "bar(x) bar(y)" {
+		t.Errorf("got %q, %d, %v", replaced, n, err)
+	}
+
+	// Edit expressions are checked when they are parsed
+	if _, err := ParseEditExpression(`%s/foo(\w)/\2/g`); err == nil {
+		t.Error("expected an error for a missing group in an edit expression")
+	}
+}
+
+func TestNextReplaceMatch(t *testing.T) {
+	line := "a := foo(b) + foo(c)"
+	start, end, replacement := nextReplaceMatch(nil, "foo", "bar", line, 0)
+	if start != 5 || end != 8 || replacement != "bar" {
+		t.Errorf("got %d, %d, %q", start, end, replacement)
+	}
+	if start, _, _ = nextReplaceMatch(nil, "foo", "bar", line, 6); start != 14 {
+		t.Errorf("expected the second match at 14, got %d", start)
+	}
+	if start, _, _ = nextReplaceMatch(nil, "foo", "bar", line, 15); start != -1 {
+		t.Errorf("expected no more matches, got %d", start)
+	}
+	re := regexp.MustCompile(`foo\((\w)\)`)
+	start, end, replacement = nextReplaceMatch(re, "", "$1.foo()", line, 6)
+	if start != 14 || end != 20 || replacement != "c.foo()" {
+		t.Errorf("got %d, %d, %q", start, end, replacement)
+	}
+	if start, _, _ = nextReplaceMatch(re, "", "", line, len(line)+1); start != -1 {
+		t.Errorf("expected no match after the end of the line, got %d", start)
+	}
+}
+
+func TestGoToNextMatchWrap(t *testing.T) {
+	c, e, status := newTestEditor("foo\nbar\nbaz\nqux\n")
+
+	// The only match is above where the search is started
+	e.GoTo(2, c, status)
+	e.stickySearchTerm = "foo"
+	e.UseStickySearchTerm()
+	for i := 0; i < 3; i++ {
+		wrapped, err := e.GoToNextMatch(c, status, true, true)
+		if err != nil || !wrapped {
+			t.Fatalf("expected the search to wrap to the top, got %v and %v", wrapped, err)
+		}
+		if x, y := e.cursorDataPosition(); x != 0 || y != 0 {
+			t.Fatalf("expected the cursor to be at the match, got %d, %d", x, y)
+		}
+	}
+	if msg := e.searchMatchMessage(true, true); msg != "Search wrapped to top, match 1 of 1" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if e.lineBeforeSearch != 2 {
+		t.Errorf("expected the search to still have started at line 2, got %d", e.lineBeforeSearch)
+	}
+
+	// Without wrapping, there are no more matches, and the cursor returns to where the search was started
+	if _, err := e.GoToNextMatch(c, status, false, true); err != errNoSearchMatch {
+		t.Errorf("expected no match, got %v", err)
+	}
+	if y := e.DataY(); y != 2 {
+		t.Errorf("expected the cursor to return to line 2, got %d", y)
+	}
+}
+
+func TestGoToPreviousMatchWrap(t *testing.T) {
+	c, e, status := newTestEditor("foo\nx\nfoo x foo\n")
+	e.searchTerm = "foo"
+	wrapped, err := e.GoToNextMatch(c, status, true, false)
+	if err != nil || !wrapped {
+		t.Fatalf("expected the search to wrap to the bottom, got %v and %v", wrapped, err)
+	}
+	if x, y := e.cursorDataPosition(); x != 6 || y != 2 {
+		t.Errorf("expected the cursor to be at the last match, got %d, %d", x, y)
+	}
+	if msg := e.searchMatchMessage(wrapped, false); msg != "Search wrapped to bottom, match 3 of 3" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if wrapped, err := e.GoToNextMatch(c, status, true, false); err != nil || wrapped {
+		t.Fatalf("expected the previous match on the same line, got %v and %v", wrapped, err)
+	}
+	if current, total := e.SearchMatchCount(); current != 2 || total != 3 {
+		t.Errorf("expected match 2 of 3, got %d of %d", current, total)
+	}
+}
+
+func TestSearchMatchCountCache(t *testing.T) {
+	c, e, status := newTestEditor("foo\nbar foo\nfoo\n")
+	e.searchTerm = "foo"
+	if _, err := e.GoToNextMatch(c, status, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if msg := e.searchMatchMessage(false, true); msg != "Match 2 of 3" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+
+	// The matches are found again after the contents have changed
+	e.InsertStringBelow(2, "foo ")
+	if current, total := e.SearchMatchCount(); current != 2 || total != 4 {
+		t.Errorf("expected match 2 of 4, got %d of %d", current, total)
+	}
+
+	// And after the search term has changed
+	e.searchTerm = "qux"
+	if msg := e.searchNotFoundMessage(true); msg != "No matches for qux" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	if msg := e.searchPromptMessage("Search:", "qux"); msg != "Search: qux (no matches)" {
+		t.Errorf("unexpected prompt: %q", msg)
+	}
+	e.searchTerm = "bar"
+	if msg := e.searchPromptMessage("Search:", "bar"); msg != "Search: bar" {
+		t.Errorf("unexpected prompt: %q", msg)
+	}
+	if msg := e.searchNotFoundMessage(false); msg != "bar not found from here" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+func TestSearchWholeWord(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.searchTerm = "foo"
+	e.searchWholeWord = true
+	for s, expected := range map[string]int{
+		"foo":          0,
+		"(foo)":        1,
+		"x.foo, y":     2,
+		"foobar foo;":  7,
+		"afoo _foo fo": -1,
+		"føo foo":      5,
+		"ølfoo foo9":   -1,
+	} {
+		if i := e.searchIndex(s, 0); i != expected {
+			t.Errorf("expected %q to match at %d, got %d", s, expected, i)
+		}
+	}
+	got := e.searchMatchRunes([]rune("foobar(foo)"))
+	for i, matched := range got {
+		if matched != (i >= 7 && i < 10) {
+			t.Errorf("expected only the whole word to be highlighted, got %v", got)
+			break
+		}
+	}
+}
+
+func TestSearchModifiers(t *testing.T) {
+	tests := []struct {
+		term                  string
+		expected              string
+		ignoreCase, wholeWord bool
+	}{
+		{"foo/i", "foo", true, false},
+		{"foo/w", "foo", false, true},
+		{"foo/wi", "foo", true, true},
+		{"re:fo+/i", "re:fo+", true, false},
+		{"/i", "/i", false, false},
+		{"a/b", "a/b", false, false},
+		{"foo/ii", "foo/ii", false, false},
+		{"foo/", "foo/", false, false},
+	}
+	for _, test := range tests {
+		term, ignoreCase, wholeWord := splitSearchModifiers(test.term)
+		if term != test.expected || ignoreCase != test.ignoreCase || wholeWord != test.wholeWord {
+			t.Errorf("%q: expected %q %v %v, got %q %v %v", test.term, test.expected, test.ignoreCase, test.wholeWord, term, ignoreCase, wholeWord)
+		}
+	}
+
+	e := NewSimpleEditor(80)
+	for term, expected := range map[string][]int{
+		"foo/i":    {0, 4, 13, 17},
+		"foo/w":    {17},
+		"foo/iw":   {0, 17},
+		"re:f.o/i": {0, 4, 13, 17},
+	} {
+		e.searchTerm = term
+		e.LoadBytes([]byte("FOO Foobar x-foo foo"))
+		if positions := e.searchMatchPositions(0); fmt.Sprint(positions) != fmt.Sprint(expected) {
+			t.Errorf("%q: expected matches at %v, got %v", term, expected, positions)
+		}
+		// The highlighted runes are the same as the matches that ctrl-n jumps to
+		matched := e.searchMatchRunes([]rune(e.Line(0)))
+		for _, x := range expected {
+			if !matched[x] {
+				t.Errorf("%q: expected the match at %d to be highlighted, got %v", term, x, matched)
+			}
+		}
+		highlighted := 0
+		for i, m := range matched {
+			if m && (i == 0 || !matched[i-1]) {
+				highlighted++
+			}
+		}
+		if highlighted != len(expected) {
+			t.Errorf("%q: expected %d highlighted matches, got %d", term, len(expected), highlighted)
+		}
+	}
+}
+
+func TestSearchFromArgument(t *testing.T) {
+	c, e, status := newTestEditor("// TODO: one\nfunc main() {\n\t// TODO: two\n}\n")
+
+	if !e.SearchFromArgument(c, status, searchArgument{pattern: "TODO", backward: true}) {
+		t.Fatal("expected a match")
+	}
+	if x, y := e.cursorDataPosition(); x != 4 || y != 2 {
+		t.Errorf("expected the last match, got %d, %d", x, y)
+	}
+	if e.stickySearchTerm != "TODO" {
+		t.Errorf("expected the pattern to be the sticky search term, got %q", e.stickySearchTerm)
+	}
+	if !e.SearchFromArgument(c, status, searchArgument{pattern: `re:func \w+`}) || e.DataY() != 1 {
+		t.Errorf("expected the regular expression to match the second line, got line %d", e.DataY())
+	}
+
+	// A pattern without matches leaves the cursor where it was
+	if e.SearchFromArgument(c, status, searchArgument{pattern: "missing"}) {
+		t.Error("expected no match")
+	}
+	if e.DataY() != 1 || e.SearchTerm() != "" {
+		t.Errorf("expected the cursor to stay at line 1 without a search term, got %d and %q", e.DataY(), e.SearchTerm())
+	}
+}
+
+func TestSearchWordAtCursor(t *testing.T) {
+	c, e, status := newTestEditor("x := foo.Bar\nfoobar(foo)\nfoo, bar\n")
+	// Only the part of the selector expression at the cursor is searched for
+	e.GoToDataX(c, 6)
+	if _, err := e.SearchWordAtCursor(c, status, true); err != nil {
+		t.Fatal(err)
+	}
+	if e.SearchTerm() != "foo" || e.stickySearchTerm != "foo" {
+		t.Errorf("expected the identifier at the cursor to be the search term, got %q", e.SearchTerm())
+	}
+	if x, y := e.cursorDataPosition(); x != 7 || y != 1 {
+		t.Errorf("expected to skip foobar and go to (foo), got %d, %d", x, y)
+	}
+	if wrapped, err := e.SearchWordAtCursor(c, status, false); err != nil || wrapped {
+		t.Fatalf("expected to go back to the first line, got %v and %v", wrapped, err)
+	}
+	if x, y := e.cursorDataPosition(); x != 5 || y != 0 {
+		t.Errorf("expected the previous match, got %d, %d", x, y)
+	}
+
+	// Without a word at the cursor, the last search term is used
+	e.GoToDataX(c, 1)
+	if _, err := e.SearchWordAtCursor(c, status, true); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := e.cursorDataPosition(); x != 5 || y != 0 {
+		t.Errorf("expected the next match of the last search term, got %d, %d", x, y)
+	}
+
+	// The dot before the identifier is not a part of it
+	e.GoToDataX(c, 10)
+	if _, err := e.SearchWordAtCursor(c, status, true); err != nil {
+		t.Fatal(err)
+	}
+	if e.SearchTerm() != "Bar" {
+		t.Errorf("expected the identifier after the dot to be the search term, got %q", e.SearchTerm())
+	}
+}
+
+func TestSearchStateAfterSwitch(t *testing.T) {
+	withTestBuffers(t)
+	dir := writeTempFiles(t, map[string]string{
+		"tmp.first.txt":  "hello\nworld\n",
+		"tmp.second.txt": "a\nb\nhello world\nworld\n",
+	})
+	first, second := filepath.Join(dir, "tmp.first.txt"), filepath.Join(dir, "tmp.second.txt")
+	c, e, status := openTestEditor(t, first)
+	e.stickySearchTerm = "world"
+	e.UseStickySearchTerm()
+	e.searchWholeWord = true
+	if _, err := e.GoToNextMatch(c, status, true, true); err != nil || e.DataY() != 1 {
+		t.Fatalf("expected a match in the first file, got line index %d and %v", e.DataY(), err)
+	}
+
+	lk := NewLockKeeper(filepath.Join(dir, "lockfile.txt"))
+	if err := e.Switch(c, nil, status, lk, second, false); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != second {
+		t.Fatalf("expected to switch to %s, got %s", second, e.filename)
+	}
+	if e.SearchTerm() != "world" || e.stickySearchTerm != "world" || !e.searchWholeWord {
+		t.Errorf("expected the search state to survive the switch, got %q, %q and %v", e.SearchTerm(), e.stickySearchTerm, e.searchWholeWord)
+	}
+	if _, err := e.GoToNextMatch(c, status, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := e.cursorDataPosition(); x != 6 || y != 2 {
+		t.Errorf("expected ctrl-n to go to the first match in the second file, got %d, %d", x, y)
+	}
+
+	// Switching back keeps the search as well
+	if err := e.Switch(c, nil, status, lk, first, false); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != first || e.stickySearchTerm != "world" {
+		t.Errorf("expected to switch back with the same search, got %s and %q", e.filename, e.stickySearchTerm)
+	}
+}
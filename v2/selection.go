@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// Selection is the anchor of a selection. The selected text is between the anchor and the cursor.
+type Selection struct {
+	x int       // the rune index of the anchor
+	y LineIndex // the line index of the anchor
+}
+
+// selectionMovementKeys are the keys that move the cursor without ending the selection
+var selectionMovementKeys = []string{"↑", "↓", "←", "→", "c:1", "c:5", "c:14", "c:16", "c:29", "c:30", keyHome, keyEnd, keyCtrlHome, keyCtrlEnd, keyCtrlLeft, keyCtrlRight, keyAltLeft, keyAltRight}
+
+// isSelectionMovementKey checks if the given key moves the cursor and extends the selection
+func isSelectionMovementKey(key string) bool {
+	return hasS(selectionMovementKeys, key) || isMouseKey(key)
+}
+
+// cursorDataPosition returns the rune index and line index of the cursor. If the cursor is after the end
+// of the line, the rune index is the length of the line.
+func (e *Editor) cursorDataPosition() (int, LineIndex) {
+	x, _ := e.DataX()
+	return x, e.DataY()
+}
+
+// StartSelection places the anchor of a new selection at the cursor
+func (e *Editor) StartSelection() {
+	x, y := e.cursorDataPosition()
+	e.selection = &Selection{x, y}
+}
+
+// ClearSelection ends the selection, if any
+func (e *Editor) ClearSelection() {
+	e.selection = nil
+}
+
+// Selecting checks if there is an active selection
+func (e *Editor) Selecting() bool {
+	return e.selection != nil
+}
+
+// SelectionRange returns the start and end of the selection, as rune indexes and line indexes,
+// where the start is before the end and the end is not included
+func (e *Editor) SelectionRange() (startX int, startY LineIndex, endX int, endY LineIndex) {
+	if e.selection == nil {
+		return 0, 0, 0, 0
+	}
+	startX, startY = e.selection.x, e.selection.y
+	endX, endY = e.cursorDataPosition()
+	if endY < startY || (endY == startY && endX < startX) {
+		startX, startY, endX, endY = endX, endY, startX, startY
+	}
+	if lastY := LineIndex(e.Len() - 1); endY > lastY {
+		endY = lastY
+	}
+	// The lines may have become shorter since the anchor was placed
+	if l := len([]rune(e.Line(startY))); startX > l {
+		startX = l
+	}
+	if l := len([]rune(e.Line(endY))); endX > l {
+		endX = l
+	}
+	return startX, startY, endX, endY
+}
+
+// selectedRunes returns the range of rune indexes that are selected on the given line, where the end is not
+// included, and true if the newline at the end of the line is also selected
+func (e *Editor) selectedRunes(y LineIndex) (from, to int, newline bool) {
+	startX, startY, endX, endY := e.SelectionRange()
+	if e.selection == nil || y < startY || y > endY {
+		return 0, 0, false
+	}
+	to = len([]rune(e.Line(y)))
+	if y == startY {
+		from = startX
+	}
+	if y == endY {
+		to = endX
+	}
+	return from, to, y < endY
+}
+
+// SelectedText returns the text that is selected
+func (e *Editor) SelectedText() string {
+	if e.selection == nil {
+		return ""
+	}
+	_, startY, _, endY := e.SelectionRange()
+	var sb strings.Builder
+	for y := startY; y <= endY; y++ {
+		from, to, newline := e.selectedRunes(y)
+		sb.WriteString(string([]rune(e.Line(y))[from:to]))
+		if newline {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// DeleteSelection removes the selected text, places the cursor where the selection started and ends the selection
+func (e *Editor) DeleteSelection(c *vt100.Canvas) {
+	if e.selection == nil {
+		return
+	}
+	startX, startY, endX, endY := e.SelectionRange()
+	before := []rune(e.Line(startY))[:startX]
+	after := []rune(e.Line(endY))[endX:]
+	for y := endY; y > startY; y-- {
+		e.DeleteLine(y)
+	}
+	e.SetLine(startY, string(before)+string(after))
+	e.changed = true
+	e.selection = nil
+	e.GoTo(startY, c, nil)
+	e.GoToDataX(c, startX)
+}
+
+// CopySelection places the selected text in the clipboard. A status message is shown,
+// where the given verb is "Copied" or "Cut". Returns the selected text.
+func (e *Editor) CopySelection(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, verb string) string {
+	s := e.SelectedText()
+	e.redraw = true
+	if s == "" {
+		status.SetMessage("Nothing selected")
+		status.Show(c, e)
+		return ""
+	}
+	var err error
+	if !e.ConfirmClipboardCopy(c, tty, status, s) {
+		err = errSecretNotCopied
+	} else {
+		err = e.CopyToClipboard(s)
+	}
+	msg := fmt.Sprintf("%s %d characters", verb, utf8.RuneCountInString(s))
+	status.Clear(c)
+	switch err {
+	case nil:
+		status.SetMessage(msg + " (clipboard)")
+	case errOSC52Truncated:
+		status.SetErrorMessage(msg + ", but " + err.Error())
+	default:
+		status.SetMessage(msg)
+	}
+	status.Show(c, e)
+	return s
+}
+
+// InsertTextAtCursor inserts the given text at the cursor, even if it contains newlines, and places the cursor
+// after the inserted text. The current line is split if needed, so that the text is inserted mid-line.
+func (e *Editor) InsertTextAtCursor(c *vt100.Canvas, text string) {
+	x, y := e.cursorDataPosition()
+	line := []rune(e.Line(y))
+	if x > len(line) {
+		x = len(line)
+	}
+	before, after := string(line[:x]), string(line[x:])
+	parts := strings.Split(text, "\n")
+	last := len(parts) - 1
+	e.SetLine(y, before+parts[0])
+	for i := 1; i <= last; i++ {
+		e.InsertLineBelowAt(y + LineIndex(i-1))
+		e.SetLine(y+LineIndex(i), parts[i])
+	}
+	endX := len([]rune(e.Line(y + LineIndex(last))))
+	e.SetLine(y+LineIndex(last), e.Line(y+LineIndex(last))+after)
+	e.changed = true
+	e.GoTo(y+LineIndex(last), c, nil)
+	e.GoToDataX(c, endX)
+}
+
+// WriteSelection draws the selected text on top of the given lines, with the search highlight color
+func (e *Editor) WriteSelection(c *vt100.Canvas, fromline LineIndex, numLines, cx, cy uint) {
+	if e.selection == nil {
+		return
+	}
+	cw := c.Width()
+	tabString := strings.Repeat(" ", e.indentation.PerTab)
+	for i := uint(0); i < numLines; i++ {
+		y := fromline + LineIndex(i)
+		from, to, _ := e.selectedRunes(y)
+		runes := []rune(e.Line(y))
+		screenX := e.ScreenXForDataX(y, from) - e.pos.offsetX
+		var (
+			lastRune rune // the last rune that was drawn in a single cell, for combining marks
+			lastX    uint
+		)
+		for runeIndex := from; runeIndex < to && runeIndex < len(runes); runeIndex++ {
+			r := runes[runeIndex]
+			width := e.runeColumns(r)
+			if width == 0 {
+				// Combining marks are drawn together with the rune before them
+				if lastRune != 0 {
+					lastRune = combineRune(lastRune, r)
+					c.WriteRune(lastX, cy+i, e.SearchHighlight, e.Background, lastRune)
+				}
+				continue
+			}
+			lastRune = 0
+			if screenX >= 0 && uint(screenX)+cx < cw {
+				if r == '\t' {
+					c.Write(cx+uint(screenX), cy+i, e.SearchHighlight, e.Background, tabString)
+				} else if width > 1 && uint(screenX+1)+cx < cw {
+					c.WriteRune(cx+uint(screenX), cy+i, e.SearchHighlight, e.Background, r)
+					c.WriteRune(cx+uint(screenX+1), cy+i, e.SearchHighlight, e.Background, wideRunePlaceholder)
+				} else {
+					if unicode.IsControl(r) {
+						r = controlRuneReplacement
+					}
+					c.WriteRune(cx+uint(screenX), cy+i, e.SearchHighlight, e.Background, r)
+					lastRune, lastX = r, cx+uint(screenX)
+				}
+			}
+			screenX += width
+		}
+	}
+}
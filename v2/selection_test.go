@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+// moveTo places the cursor at the given rune index and line index
+func moveTo(e *Editor, x int, y LineIndex) {
+	e.GoTo(y, nil, nil)
+	e.GoToDataX(nil, x)
+}
+
+func TestSelection(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "first line\n\tsecond line\nthird line")
+	if e.Selecting() || e.SelectedText() != "" {
+		t.Fatal("expected no selection")
+	}
+
+	// Select from the middle of the first line to the middle of the second line
+	moveTo(e, 6, 0)
+	e.StartSelection()
+	moveTo(e, 4, 1)
+	if s := e.SelectedText(); s != "line\n\tsec" {
+		t.Errorf("unexpected selected text: %q", s)
+	}
+
+	// Selecting backwards gives the same range
+	e.ClearSelection()
+	e.StartSelection()
+	moveTo(e, 6, 0)
+	if s := e.SelectedText(); s != "line\n\tsec" {
+		t.Errorf("unexpected selected text when selecting backwards: %q", s)
+	}
+	if from, to, newline := e.selectedRunes(1); from != 0 || to != 4 || newline {
+		t.Errorf("unexpected selected runes on the second line: %d %d %v", from, to, newline)
+	}
+
+	e.DeleteSelection(nil)
+	if e.Selecting() {
+		t.Error("expected the selection to end when deleting")
+	}
+	if s := e.String(); s != "first ond line\nthird line\n" {
+		t.Errorf("unexpected contents after deleting the selection: %q", s)
+	}
+	if x, y := e.cursorDataPosition(); x != 6 || y != 0 {
+		t.Errorf("expected the cursor at the start of the deleted text, got %d, %d", x, y)
+	}
+}
+
+func TestInsertTextAtCursor(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.InsertStringAndMove(nil, "abcdef\nxyz")
+
+	// A partial line is inserted mid-line
+	moveTo(e, 3, 0)
+	e.InsertTextAtCursor(nil, "123")
+	if s := e.String(); s != "abc123def\nxyz\n" {
+		t.Errorf("unexpected contents: %q", s)
+	}
+
+	// Text with newlines splits the line
+	e.InsertTextAtCursor(nil, "-\n+")
+	if s := e.String(); s != "abc123-\n+def\nxyz\n" {
+		t.Errorf("unexpected contents after inserting several lines: %q", s)
+	}
+	if x, y := e.cursorDataPosition(); x != 1 || y != 1 {
+		t.Errorf("expected the cursor after the inserted text, got %d, %d", x, y)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/env"
+)
+
+// The settings that can be given in the [settings] section of settings.conf
+const (
+	settingReduceMotion  = "reduce-motion"
+	settingClock         = "clock"
+	settingClipboard     = "system-clipboard"
+	settingOSC52Paste    = "osc52-paste"
+	settingCountLeader   = "count-without-leader"
+	settingMouse         = "mouse"
+	settingSearchWrap    = "search-wrap"
+	settingSplitPaste    = "split-paste"
+	settingControlSocket = "control-socket"
+	settingAutoClose     = "auto-close"
+
+	settingHighlightMaxLineLength = "highlight-max-line-length"
+	settingHighlightTimeBudget    = "highlight-time-budget"
+)
+
+var (
+	settings         map[string]string // from the [settings] section of settings.conf
+	settingsErr      error             // the error from loading settings.conf, if any
+	settingsFilename = filepath.Join(userConfigDir, "o", "settings.conf")
+	settingNames     = []string{settingReduceMotion, settingClock, settingClipboard, settingOSC52Paste, settingCountLeader, settingMouse, settingSearchWrap, settingSplitPaste, settingControlSocket, settingAutoClose, settingHighlightMaxLineLength, settingHighlightTimeBudget}
+
+	// reduceMotion disables the spinner animation and the short flash when a menu item is selected
+	reduceMotion bool
+
+	// showClock shows the time of day at the right side of the status bar, when no operation is active
+	showClock bool
+)
+
+// parseSettings parses the [settings] section of a configuration file, where each line is on the form "name = value".
+// Lines starting with "#" are comments.
+func parseSettings(data string) (map[string]string, error) {
+	settings := make(map[string]string)
+	inSettingsSection := false
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSettingsSection = line == "[settings]"
+			continue
+		}
+		if !inSettingsSection {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return settings, fmt.Errorf("line %d: expected name = value", i+1)
+		}
+		if !hasS(settingNames, name) {
+			return settings, fmt.Errorf("line %d: unknown setting: %s", i+1, name)
+		}
+		settings[name] = value
+	}
+	return settings, nil
+}
+
+// LoadSettings loads the settings from the given configuration file. The returned map can be empty.
+func LoadSettings(settingsFilename string) (map[string]string, error) {
+	data, err := os.ReadFile(settingsFilename)
+	if err != nil {
+		return make(map[string]string), err
+	}
+	return parseSettings(string(data))
+}
+
+// settingEnabled checks if the given boolean setting is enabled. If the given environment variable is set,
+// it takes precedence over the settings file. Values like "1", "true" and "yes" are true.
+func settingEnabled(settings map[string]string, name, envName string) bool {
+	return settingEnabledByDefault(settings, name, envName, false)
+}
+
+// settingEnabledByDefault is like settingEnabled, but returns the given default value
+// if neither the environment variable nor the setting is set
+func settingEnabledByDefault(settings map[string]string, name, envName string, defaultValue bool) bool {
+	if env.Has(envName) {
+		return env.Bool(envName)
+	}
+	if value, ok := settings[name]; ok {
+		return env.AsBool(value)
+	}
+	return defaultValue
+}
+
+// settingNumber returns the value of the given setting, as a number that is 0 or larger. If the given environment
+// variable is set, it takes precedence over the settings file. If neither is set to a valid number,
+// the given default value is returned.
+func settingNumber(settings map[string]string, name, envName string, defaultValue int) int {
+	value, ok := settings[name]
+	if env.Has(envName) {
+		value, ok = env.Str(envName), true
+	}
+	if !ok {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestParseSettings(t *testing.T) {
+	settings, err := parseSettings("# comment\n[hooks]\nfoo = bar\n\n[settings]\nreduce-motion = yes\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings[settingReduceMotion] != "yes" {
+		t.Errorf("expected reduce-motion to be yes, got %q", settings[settingReduceMotion])
+	}
+	if _, ok := settings["foo"]; ok {
+		t.Error("expected settings outside of the [settings] section to be ignored")
+	}
+	if _, err := parseSettings("[settings]\nunknown = 1\n"); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+	if _, err := parseSettings("[settings]\nreduce-motion\n"); err == nil {
+		t.Error("expected an error for a setting without a value")
+	}
+}
+
+func TestSettingEnabled(t *testing.T) {
+	const envName = "O_TEST_SETTING"
+	os.Unsetenv(envName)
+	settings := map[string]string{settingReduceMotion: "true"}
+	if !settingEnabled(settings, settingReduceMotion, envName) {
+		t.Error("expected the setting to be enabled")
+	}
+	if settingEnabled(map[string]string{}, settingReduceMotion, envName) {
+		t.Error("expected a missing setting to be disabled")
+	}
+	t.Setenv(envName, "0")
+	if settingEnabled(settings, settingReduceMotion, envName) {
+		t.Error("expected the environment variable to take precedence")
+	}
+}
+
+func TestHighContrastTheme(t *testing.T) {
+	theme := NewHighContrastTheme()
+	// Search matches must not be told apart by color alone
+	hasAttribute := func(ac vt100.AttributeColor, attribute byte) bool {
+		for _, a := range ac {
+			if a == attribute {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasAttribute(theme.SearchHighlight, vt100.Underscore.Head()) || !hasAttribute(theme.SearchHighlight, vt100.Reverse.Head()) {
+		t.Errorf("expected search matches to be underlined and reversed, got %v", theme.SearchHighlight)
+	}
+	if !hasTextAttributes(theme.SearchHighlight) || hasTextAttributes(theme.Foreground) {
+		t.Error("expected only the search highlight to have text attributes")
+	}
+	plain := withPlainAttributes(vt100.White)
+	if len(plain) != len(plainAttributes)+len(vt100.White) || hasTextAttributes(plain) {
+		t.Errorf("unexpected plain attributes: %v", plain)
+	}
+	if len(vt100.White) != 1 {
+		t.Error("withPlainAttributes modified the given color")
+	}
+}
+
+func TestSettingEnabledByDefault(t *testing.T) {
+	const envName = "O_TEST_SETTING"
+	os.Unsetenv(envName)
+	if !settingEnabledByDefault(map[string]string{}, settingClipboard, envName, true) {
+		t.Error("expected a missing setting to use the default value")
+	}
+	if settingEnabledByDefault(map[string]string{settingClipboard: "no"}, settingClipboard, envName, true) {
+		t.Error("expected the setting to take precedence over the default value")
+	}
+}
+
+func TestSettingNumber(t *testing.T) {
+	const envName = "O_TEST_SETTING"
+	os.Unsetenv(envName)
+	settings := map[string]string{settingHighlightTimeBudget: "20"}
+	if n := settingNumber(settings, settingHighlightTimeBudget, envName, 50); n != 20 {
+		t.Errorf("expected 20, got %d", n)
+	}
+	if n := settingNumber(map[string]string{settingHighlightTimeBudget: "-1"}, settingHighlightTimeBudget, envName, 50); n != 50 {
+		t.Errorf("expected an invalid setting to use the default value, got %d", n)
+	}
+	t.Setenv(envName, "0")
+	if n := settingNumber(settings, settingHighlightTimeBudget, envName, 50); n != 0 {
+		t.Errorf("expected the environment variable to take precedence, got %d", n)
+	}
+}
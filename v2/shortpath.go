@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xyproto/env"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// maxTitlePathLength is the longest path that is used for the terminal emulator title
+	maxTitlePathLength = 48
+
+	// minStatusPathLength is the shortest the path in the status bar is shortened to, to make room for the line and column
+	minStatusPathLength = 12
+
+	// fileInfoLineLength is how many runes of the full path are shown per line in the file info overlay
+	fileInfoLineLength = 70
+)
+
+// abbreviatePathComponent shortens a directory name to the first rune, or to the first two runes for hidden directories,
+// like ".c" for ".config"
+func abbreviatePathComponent(s string) string {
+	runes := []rune(s)
+	switch {
+	case s == "~" || len(runes) <= 1:
+		return s
+	case runes[0] == '.':
+		return string(runes[:2])
+	default:
+		return string(runes[:1])
+	}
+}
+
+// shortenPath shortens the given path to at most width runes, if possible, in the style of the fish shell.
+// The home directory is shown as "~", directories are abbreviated from the left, like "/h/u/p/o/editor.go",
+// and the last two path components are kept in full. If that is still too long, the start of the path is
+// replaced with "…". Bytes that are not valid UTF-8 are shown as "�". A width of 0 or less means no limit.
+func shortenPath(path, home string, width int) string {
+	path = strings.ToValidUTF8(path, string(utf8.RuneError))
+	sep := string(filepath.Separator)
+	if home = strings.TrimSuffix(home, sep); home != "" && (path == home || strings.HasPrefix(path, home+sep)) {
+		path = "~" + strings.TrimPrefix(path, home)
+	}
+	if width <= 0 || utf8.RuneCountInString(path) <= width {
+		return path
+	}
+	parts := strings.Split(path, sep)
+	for i := 0; i < len(parts)-2 && utf8.RuneCountInString(strings.Join(parts, sep)) > width; i++ {
+		parts[i] = abbreviatePathComponent(parts[i])
+	}
+	shortened := []rune(strings.Join(parts, sep))
+	if len(shortened) <= width {
+		return string(shortened)
+	}
+	return "…" + string(shortened[len(shortened)-(width-1):])
+}
+
+// shortenPathForDisplay shortens the given path to at most width runes, with the home directory of the current user
+func shortenPathForDisplay(path string, width int) string {
+	return shortenPath(path, env.HomeDir(), width)
+}
+
+// statusPathWidth returns how long the filename in the status bar can be, next to the given status message
+func statusPathWidth(c *vt100.Canvas, statusMessage string) int {
+	if c == nil {
+		return 0
+	}
+	// Make room for ": " and the padding of the status bar message
+	width := int(c.W()) - utf8.RuneCountInString(statusMessage) - 12
+	if width < minStatusPathLength {
+		return minStatusPathLength
+	}
+	return width
+}
+
+// ShowFileInfo draws an overlay with the full path of the current file, together with a few other facts
+func (e *Editor) ShowFileInfo(c *vt100.Canvas) {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		absFilename = e.filename
+	}
+	var sb strings.Builder
+	runes := []rune(strings.ToValidUTF8(absFilename, string(utf8.RuneError)))
+	for len(runes) > fileInfoLineLength {
+		sb.WriteString(string(runes[:fileInfoLineLength]) + "\n")
+		runes = runes[fileInfoLineLength:]
+	}
+	sb.WriteString(string(runes) + "\n")
+	sb.WriteString(fmt.Sprintf("%d lines, %s mode", e.Len(), e.mode))
+	if e.readOnly {
+		sb.WriteString(", read-only")
+	}
+	if e.changed {
+		sb.WriteString(", changed")
+	}
+	e.DrawOutput(c, 20, "File info", sb.String(), e.DebugRegistersBackground, true)
+}
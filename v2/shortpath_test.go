@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortenPath(t *testing.T) {
+	const home = "/home/user"
+	tests := []struct {
+		path     string
+		width    int
+		expected string
+	}{
+		{"/home/user/projects/o/editor.go", 0, "~/projects/o/editor.go"},
+		{"/home/user/projects/o/editor.go", 100, "~/projects/o/editor.go"},
+		{"/home/user/projects/o/editor.go", 20, "~/p/o/editor.go"},
+		{"/usr/share/projects/o/editor.go", 20, "/u/s/p/o/editor.go"},
+		{"/usr/share/projects/o/editor.go", 26, "/u/s/projects/o/editor.go"},
+		{"/home/user/.config/o/settings.conf", 20, "~/.c/o/settings.conf"},
+		{"/home/user", 5, "~"},
+		{"/home/username/main.go", 100, "/home/username/main.go"},
+		{"/a/very/long/directory/name/and/a_very_long_filename.go", 12, "…filename.go"},
+		{"/a/b/c.go", 1, "…"},
+		{"main.go", 3, "…go"},
+		{"/tmp/\xff\xfe/main.go", 100, "/tmp/�/main.go"},
+		{"/tmp/\xffdir/x/y/main.go", 16, "/t/�/x/y/main.go"},
+		{"/tmp/\xffdir/x/y/main.go", 14, "…�/x/y/main.go"},
+	}
+	for _, test := range tests {
+		got := shortenPath(test.path, home, test.width)
+		if got != test.expected {
+			t.Errorf("shortenPath(%q, %d) = %q, expected %q", test.path, test.width, got, test.expected)
+		}
+		if test.width > 0 && utf8.RuneCountInString(got) > test.width {
+			t.Errorf("shortenPath(%q, %d) is longer than %d runes: %q", test.path, test.width, test.width, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("shortenPath(%q, %d) is not valid UTF-8: %q", test.path, test.width, got)
+		}
+	}
+}
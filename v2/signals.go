@@ -11,7 +11,8 @@ import (
 )
 
 // SetUpSignalHandlers sets up a signal handler for when ctrl-c is pressed (SIGTERM),
-// and also for when SIGUSR1 or SIGWINCH is received.
+// and also for when SIGUSR1 or SIGWINCH is received. SIGUSR1 unlocks the file,
+// or asks the user if another instance of the editor has requested to take it over.
 func (e *Editor) SetUpSignalHandlers(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
 	resizeMut.Lock()
 	defer resizeMut.Unlock()
@@ -46,17 +47,22 @@ func (e *Editor) SetUpSignalHandlers(c *vt100.Canvas, tty *vt100.TTY, status *St
 			switch sig {
 			case syscall.SIGTERM:
 				// Save the file
-				e.UserSave(c, tty, status)
+				e.UserSave(c, tty, status, nil)
 				status.SetMessage("ctrl-c")
 				status.Show(c, e)
 			case syscall.SIGUSR1:
-				// Unlock the file
-				if absFilename, err := filepath.Abs(e.filename); err != nil {
-					// Just unlock the non-absolute filename
-					fileLock.Unlock(e.filename)
-				} else {
-					fileLock.Unlock(absFilename)
+				absFilename, err := filepath.Abs(e.filename)
+				if err != nil {
+					// Just use the non-absolute filename
+					absFilename = e.filename
+				}
+				// Ask the user, if another instance of the editor wants to take over the file
+				if !e.lockReleased && takeoverRequestedFor(fileLock, absFilename) {
+					e.askTakeover(c, status)
+					break
 				}
+				// Unlock the file
+				fileLock.Unlock(absFilename)
 				fileLock.Save()
 			case syscall.SIGWINCH:
 				// Full redraw, like if Esc was pressed
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/iferr"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// Snippet is a piece of text that a trigger word expands to.
+// In the body, a tab at the start of a line is one indentation level, and $1, $2 or ${1:default} are placeholders
+// that can be jumped between, in the order they appear. $0 is where the cursor ends up after the last placeholder,
+// and \$ is a literal dollar sign.
+type Snippet struct {
+	trigger  string
+	body     string
+	generate func(e *Editor) string // generates the body from the contents of the editor, if set
+}
+
+// snippetStop is a placeholder that can be jumped to. The position is counted from the end of the file and the end
+// of the line, so that it stays the same while the text at the placeholders before it is changed.
+type snippetStop struct {
+	linesFromEnd int
+	runesFromEnd int
+}
+
+var (
+	// snippetsDir contains one file per mode, like go.snippets, with the snippets for that mode
+	snippetsDir = filepath.Join(userConfigDir, "o", "snippets")
+
+	// loadedSnippets are the snippets per mode, loaded the first time they are needed
+	loadedSnippets = make(map[mode.Mode]map[string]*Snippet)
+
+	// builtinSnippets are available even without a snippets file, but can be replaced by one
+	builtinSnippets = map[mode.Mode][]*Snippet{
+		mode.Go: {
+			{trigger: "forr", body: "for ${1:_}, ${2:v} := range $3 {\n\t$0\n}"},
+			{trigger: "iferr", generate: goIfErrBody},
+		},
+	}
+
+	errNoSnippetStops = errors.New("no more placeholders")
+)
+
+// goIfErrBody returns an "if err != nil" block that returns suitable values for the signature of the current function
+func goIfErrBody(e *Editor) string {
+	// default "if err != nil" block if iferr.IfErr can not find a more suitable one
+	ifErrBlock := "if err != nil {\n\treturn nil, err\n}\n"
+	// search backwards for "func ", return the full contents, the resulting line index and if it was found
+	contents, functionLineIndex, found := e.ContentsAndReverseSearchPrefix("func ")
+	if found {
+		// count the bytes from the start to the end of the "func " line, since this is what iferr.IfErr uses
+		byteCount := 0
+		for i := LineIndex(0); i <= functionLineIndex; i++ {
+			byteCount += len(e.Line(i))
+		}
+		// fetch a suitable "if err != nil" block for the current function signature
+		if generatedIfErrBlock, err := iferr.IfErr([]byte(contents), byteCount); err != nil {
+			logf("could not generate iferrblock: %s\n", err)
+		} else {
+			ifErrBlock = generatedIfErrBlock
+		}
+	}
+	return strings.ReplaceAll(strings.TrimSpace(ifErrBlock), "$", `\$`)
+}
+
+// snippetsFilename returns the snippets file for the given mode, like ~/.config/o/snippets/go.snippets
+func snippetsFilename(m mode.Mode) string {
+	name := strings.ToLower(strings.ReplaceAll(m.String(), " ", ""))
+	return filepath.Join(snippetsDir, name+".snippets")
+}
+
+// parseSnippets parses a snippets file, where each snippet starts with a "snippet trigger" line,
+// followed by the body, where each line is indented with one tab. Lines starting with "#" are comments.
+func parseSnippets(data string) map[string]*Snippet {
+	var (
+		snippets = make(map[string]*Snippet)
+		current  *Snippet
+		body     []string
+	)
+	finish := func() {
+		if current != nil {
+			// Blank lines between the snippets are not part of the body
+			for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+				body = body[:len(body)-1]
+			}
+			current.body = strings.Join(body, "\n")
+			snippets[current.trigger] = current
+		}
+		current, body = nil, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "snippet "):
+			finish()
+			if trigger := strings.TrimSpace(strings.TrimPrefix(line, "snippet ")); trigger != "" {
+				current = &Snippet{trigger: trigger}
+			}
+		case strings.HasPrefix(line, "\t") && current != nil:
+			body = append(body, line[1:])
+		case strings.TrimSpace(line) == "" && current != nil:
+			body = append(body, "")
+		case strings.HasPrefix(line, "#"):
+		default:
+			finish()
+		}
+	}
+	finish()
+	return snippets
+}
+
+// Snippets returns the snippets for the given mode, from the built-in snippets and the snippets file for the mode.
+// The snippets file is read the first time the snippets for a mode are needed.
+func Snippets(m mode.Mode) map[string]*Snippet {
+	if snippets, ok := loadedSnippets[m]; ok {
+		return snippets
+	}
+	snippets := make(map[string]*Snippet)
+	for _, snippet := range builtinSnippets[m] {
+		snippets[snippet.trigger] = snippet
+	}
+	if data, err := os.ReadFile(snippetsFilename(m)); err == nil {
+		for trigger, snippet := range parseSnippets(string(data)) {
+			snippets[trigger] = snippet
+		}
+	}
+	loadedSnippets[m] = snippets
+	return snippets
+}
+
+// expandSnippetBody indents the body with the given indentation, and removes the placeholders.
+// Returns the lines, and the positions of the placeholders as line indexes and rune indexes within the lines,
+// in the order they should be jumped to.
+func expandSnippetBody(body, leadingWhitespace, oneIndentation string) ([]string, [][2]int) {
+	var (
+		lines      []string
+		stops      [][2]int
+		finalStop  [][2]int
+		bodyLines  = strings.Split(body, "\n")
+		lineRunes  []rune
+		appendStop = func(n rune) {
+			stop := [2]int{len(lines), len(lineRunes)}
+			if n == '0' {
+				finalStop = [][2]int{stop}
+			} else {
+				stops = append(stops, stop)
+			}
+		}
+	)
+	for i, bodyLine := range bodyLines {
+		tabs := len(bodyLine) - len(strings.TrimLeft(bodyLine, "\t"))
+		lineRunes = []rune(strings.Repeat(oneIndentation, tabs))
+		if i > 0 {
+			lineRunes = append([]rune(leadingWhitespace), lineRunes...)
+		}
+		runes := []rune(bodyLine[tabs:])
+		for j := 0; j < len(runes); j++ {
+			switch {
+			case runes[j] == '\\' && j+1 < len(runes) && runes[j+1] == '$':
+				lineRunes = append(lineRunes, '$')
+				j++
+			case runes[j] == '$' && j+1 < len(runes) && unicode.IsDigit(runes[j+1]):
+				appendStop(runes[j+1])
+				j++
+			case runes[j] == '$' && j+3 < len(runes) && runes[j+1] == '{' && unicode.IsDigit(runes[j+2]) && (runes[j+3] == '}' || runes[j+3] == ':'):
+				end := j + 3
+				for end < len(runes) && runes[end] != '}' {
+					end++
+				}
+				if runes[j+3] == ':' {
+					// The default text is inserted, and the cursor is placed after it
+					lineRunes = append(lineRunes, runes[j+4:end]...)
+				}
+				appendStop(runes[j+2])
+				j = end
+			default:
+				lineRunes = append(lineRunes, runes[j])
+			}
+		}
+		lines = append(lines, string(lineRunes))
+	}
+	return lines, append(stops, finalStop...)
+}
+
+// SnippetBeforeCursor returns the snippet for the word before the cursor, or nil
+func (e *Editor) SnippetBeforeCursor() *Snippet {
+	word := e.LettersBeforeCursor()
+	if word == "" || unicode.IsLetter(e.Rune()) {
+		return nil
+	}
+	return Snippets(e.mode)[word]
+}
+
+// ExpandSnippet replaces the trigger word before the cursor with the body of the given snippet,
+// and moves the cursor to the first placeholder, or to the end of the snippet if there are no placeholders.
+func (e *Editor) ExpandSnippet(c *vt100.Canvas, status *StatusBar, snippet *Snippet) {
+	body := snippet.body
+	if snippet.generate != nil {
+		body = snippet.generate(e)
+	}
+	var (
+		y            = e.DataY()
+		runes, _     = e.lineRunes(int(y))
+		x, err       = e.DataX()
+		leadingSpace = e.LeadingWhitespace()
+	)
+	if err != nil {
+		x = len(runes)
+	}
+	before := string(runes[:x-len([]rune(snippet.trigger))])
+	after := string(runes[x:])
+	lines, stops := expandSnippetBody(body, leadingSpace, e.indentation.String())
+	if len(stops) == 0 {
+		// Place the cursor at the end of the snippet
+		stops = [][2]int{{len(lines) - 1, len([]rune(lines[len(lines)-1]))}}
+	}
+	lines[0] = before + lines[0]
+	for i := range stops {
+		if stops[i][0] == 0 {
+			stops[i][1] += len([]rune(before))
+		}
+	}
+	lines[len(lines)-1] += after
+	e.SetLine(y, lines[0])
+	for i, line := range lines[1:] {
+		e.InsertLineBelowAt(y + LineIndex(i))
+		e.SetLine(y+LineIndex(i+1), line)
+	}
+	// Store the placeholders as positions counted from the end
+	e.snippetStops = nil
+	for _, stop := range stops {
+		e.snippetStops = append(e.snippetStops, snippetStop{
+			linesFromEnd: e.Len() - 1 - (int(y) + stop[0]),
+			runesFromEnd: len([]rune(lines[stop[0]])) - stop[1],
+		})
+	}
+	e.snippetStart = y
+	e.redraw = true
+	e.redrawCursor = true
+	e.NextSnippetStop(c, status)
+}
+
+// InSnippet checks if there are placeholders left to jump to, and if the cursor is within the expanded snippet.
+// If the cursor has been moved out of the snippet, the placeholders are forgotten.
+func (e *Editor) InSnippet() bool {
+	if len(e.snippetStops) == 0 {
+		return false
+	}
+	last := e.snippetStops[len(e.snippetStops)-1]
+	if y := e.DataY(); y < e.snippetStart || int(y) > e.Len()-1-last.linesFromEnd {
+		e.snippetStops = nil
+		return false
+	}
+	return true
+}
+
+// NextSnippetStop moves the cursor to the next placeholder in the last expanded snippet
+func (e *Editor) NextSnippetStop(c *vt100.Canvas, status *StatusBar) error {
+	if len(e.snippetStops) == 0 {
+		return errNoSnippetStops
+	}
+	stop := e.snippetStops[0]
+	e.snippetStops = e.snippetStops[1:]
+	y := LineIndex(e.Len() - 1 - stop.linesFromEnd)
+	runes, ok := e.lineRunes(int(y))
+	if !ok || stop.runesFromEnd > len(runes) {
+		// The text after the placeholder has been changed
+		e.snippetStops = nil
+		return errNoSnippetStops
+	}
+	e.GoTo(y, c, status)
+	e.GoToDataX(c, len(runes)-stop.runesFromEnd)
+	e.redraw = true
+	e.redrawCursor = true
+	return nil
+}
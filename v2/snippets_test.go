@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestParseSnippets(t *testing.T) {
+	data := "# Python snippets\nsnippet ifmain\n\tif __name__ == \"__main__\":\n\t\t${1:main()}\n\nsnippet pdb\n\timport pdb; pdb.set_trace()\n"
+	snippets := parseSnippets(data)
+	if len(snippets) != 2 {
+		t.Fatalf("expected 2 snippets, got %d", len(snippets))
+	}
+	if body := snippets["ifmain"].body; body != "if __name__ == \"__main__\":\n\t${1:main()}" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	if body := snippets["pdb"].body; body != "import pdb; pdb.set_trace()" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestExpandSnippetBody(t *testing.T) {
+	lines, stops := expandSnippetBody("for ${1:_}, ${2:v} := range $3 {\n\t$0\n}\n\\$4", "\t", "    ")
+	want := []string{"for _, v := range  {", "\t    ", "\t}", "\t$4"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %q, got %q", want, lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: expected %q, got %q", i, want[i], lines[i])
+		}
+	}
+	wantStops := [][2]int{{0, 5}, {0, 8}, {0, 18}, {1, 5}}
+	if len(stops) != len(wantStops) {
+		t.Fatalf("expected the stops %v, got %v", wantStops, stops)
+	}
+	for i := range wantStops {
+		if stops[i] != wantStops[i] {
+			t.Errorf("stop %d: expected %v, got %v", i, wantStops[i], stops[i])
+		}
+	}
+}
+
+func TestExpandSnippet(t *testing.T) {
+	defer func(dir string) {
+		snippetsDir = dir
+		loadedSnippets = make(map[mode.Mode]map[string]*Snippet)
+	}(snippetsDir)
+	snippetsDir = t.TempDir()
+	loadedSnippets = make(map[mode.Mode]map[string]*Snippet)
+	if err := os.WriteFile(filepath.Join(snippetsDir, "go.snippets"), []byte("snippet pl\n\tfmt.Println($1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.indentation.Spaces = false
+	e.LoadBytes([]byte("package main\n\nfunc main() {\n\tforr\n\tpl\n}\n"))
+	status := testStatusBar(e)
+
+	// The built-in snippet
+	e.pos.sy = 3
+	e.End(c)
+	snippet := e.SnippetBeforeCursor()
+	if snippet == nil {
+		t.Fatal("expected forr to be a snippet")
+	}
+	e.ExpandSnippet(c, status, snippet)
+	if x, _ := e.DataX(); e.DataY() != 3 || x != 6 {
+		t.Errorf("expected the cursor to be at the first placeholder, got line %d, column %d", e.DataY()+1, x+1)
+	}
+
+	// Type at the placeholders, including a new line, and jump between them
+	e.InsertString(c, "i")
+	if err := e.NextSnippetStop(c, status); err != nil {
+		t.Fatal(err)
+	}
+	e.InsertString(c, "x")
+	e.NextSnippetStop(c, status)
+	e.InsertString(c, "xs")
+	e.NextSnippetStop(c, status)
+	e.InsertString(c, "println(x)")
+	if e.InSnippet() {
+		t.Error("expected all the placeholders to have been visited")
+	}
+	if err := e.NextSnippetStop(c, status); err != errNoSnippetStops {
+		t.Errorf("expected no more placeholders, got %v", err)
+	}
+	want := "package main\n\nfunc main() {\n\tfor _i, vx := range xs {\n\t\tprintln(x)\n\t}\n\tpl\n}\n"
+	if got := e.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// A snippet from the snippets file
+	e.pos.sy = 6
+	e.End(c)
+	e.ExpandSnippet(c, status, e.SnippetBeforeCursor())
+	if line := e.Line(6); line != "\tfmt.Println()" {
+		t.Errorf("expected the snippet from the file, got %q", line)
+	}
+	if x, _ := e.DataX(); x != 13 {
+		t.Errorf("expected the cursor to be in the parentheses, got column %d", x+1)
+	}
+}
+
+func TestIfErrSnippet(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.indentation.Spaces = false
+	e.LoadBytes([]byte("package main\n\nfunc parse() (int, error) {\n\tx, err := strconv.Atoi(\"1\")\n\tiferr\n}\n"))
+	status := testStatusBar(e)
+	e.pos.sy = 4
+	e.End(c)
+	e.ExpandSnippet(c, status, Snippets(mode.Go)["iferr"])
+	want := "package main\n\nfunc parse() (int, error) {\n\tx, err := strconv.Atoi(\"1\")\n\tif err != nil {\n\t\treturn 0, err\n\t}\n}\n"
+	if got := e.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e.DataY() != 6 || e.InSnippet() {
+		t.Errorf("expected the cursor to be after the block, at line %d", e.DataY()+1)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SortOptions are the ways that a range of lines can be sorted, in addition to a plain lexicographic sort
+type SortOptions struct {
+	Reverse    bool // sort in descending order
+	Numeric    bool // compare the leading integers of the lines, so that "9" sorts before "10"
+	IgnoreCase bool // compare the lines without regard to case
+	Unique     bool // remove lines that are equal to the line before them, after sorting
+}
+
+// parseSortOptions returns the sort options for the given arguments to the sort command,
+// like "reverse", "numeric", "ignorecase" or "unique"
+func parseSortOptions(args []string) (SortOptions, error) {
+	var opts SortOptions
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "r", "rev", "reverse", "desc", "descending":
+			opts.Reverse = true
+		case "n", "num", "numeric", "numerical":
+			opts.Numeric = true
+		case "i", "ic", "ignorecase", "nocase", "caseinsensitive":
+			opts.IgnoreCase = true
+		case "u", "uniq", "unique":
+			opts.Unique = true
+		default:
+			return opts, fmt.Errorf("unknown sort option: %s", arg)
+		}
+	}
+	return opts, nil
+}
+
+// leadingInteger returns the digits of the integer at the start of the given line, after any leading whitespace,
+// without leading zeros, and if the integer is negative. Returns false if the line does not start with an integer.
+func leadingInteger(line string) (string, bool, bool) {
+	s := strings.TrimLeftFunc(line, unicode.IsSpace)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return "", false, false
+	}
+	digits := strings.TrimLeft(s[:n], "0")
+	return digits, negative && digits != "", true
+}
+
+// compareDigits compares two strings of digits without leading zeros, of any length, as integers
+func compareDigits(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareNumeric compares the leading integers of two lines. Lines without a leading integer sort
+// before the lines with one. Returns 0 if the integers are equal or if neither line has one.
+func compareNumeric(a, b string) int {
+	aDigits, aNegative, aOK := leadingInteger(a)
+	bDigits, bNegative, bOK := leadingInteger(b)
+	switch {
+	case !aOK && !bOK:
+		return 0
+	case !aOK:
+		return -1
+	case !bOK:
+		return 1
+	case aNegative && !bNegative:
+		return -1
+	case !aNegative && bNegative:
+		return 1
+	case aNegative:
+		return compareDigits(bDigits, aDigits)
+	}
+	return compareDigits(aDigits, bDigits)
+}
+
+// compare compares two lines according to the sort options, but without reversing the order.
+// Lines that are equal when compared numerically or without case are then compared as they are,
+// so that the result does not depend on the original order of the lines.
+func (opts SortOptions) compare(a, b string) int {
+	if opts.Numeric {
+		if n := compareNumeric(a, b); n != 0 {
+			return n
+		}
+	}
+	if opts.IgnoreCase {
+		if n := strings.Compare(strings.ToLower(a), strings.ToLower(b)); n != 0 {
+			return n
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// equal checks if two lines count as duplicates when sorting with these options
+func (opts SortOptions) equal(a, b string) bool {
+	if opts.IgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// sortLines sorts the given lines according to the sort options, in place,
+// and returns the sorted lines, which are fewer if duplicate lines are removed
+func sortLines(lines []string, opts SortOptions) []string {
+	sort.SliceStable(lines, func(i, j int) bool {
+		if opts.Reverse {
+			return opts.compare(lines[j], lines[i]) < 0
+		}
+		return opts.compare(lines[i], lines[j]) < 0
+	})
+	if !opts.Unique || len(lines) == 0 {
+		return lines
+	}
+	unique := lines[:1]
+	for _, line := range lines[1:] {
+		if !opts.equal(unique[len(unique)-1], line) {
+			unique = append(unique, line)
+		}
+	}
+	return unique
+}
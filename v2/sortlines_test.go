@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortLines(t *testing.T) {
+	lines := "10\nb\n9\nB\n-3\na\n10\n007"
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "-3\n007\n10\n10\n9\nB\na\nb"},
+		{[]string{"reverse"}, "b\na\nB\n9\n10\n10\n007\n-3"},
+		{[]string{"numeric"}, "B\na\nb\n-3\n007\n9\n10\n10"},
+		{[]string{"ignorecase"}, "-3\n007\n10\n10\n9\na\nB\nb"},
+		{[]string{"unique"}, "-3\n007\n10\n9\nB\na\nb"},
+		{[]string{"numeric", "reverse", "unique"}, "10\n9\n007\n-3\nb\na\nB"},
+		{[]string{"ignorecase", "unique"}, "-3\n007\n10\n9\na\nB"},
+	}
+	for _, test := range tests {
+		opts, err := parseSortOptions(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(sortLines(strings.Split(lines, "\n"), opts), "\n"); got != test.expected {
+			t.Errorf("sorting with %v: expected %q, got %q", test.args, test.expected, got)
+		}
+	}
+	if _, err := parseSortOptions([]string{"sideways"}); err == nil {
+		t.Error("expected an error for an unknown sort option")
+	}
+}
+
+func TestSortRangeUnique(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("b\na\nb\na\n\nz\n"))
+	bookmark := &Position{sy: 5}
+	e.SortRange(e.BlockAt(0), SortOptions{Unique: true}, bookmark)
+	if s := e.String(); s != "a\nb\n\nz\n" {
+		t.Errorf("expected the duplicate lines to be removed, got %q", s)
+	}
+	if bookmark.LineIndex() != 3 {
+		t.Errorf("expected the bookmark to follow the last line, got line index %d", bookmark.LineIndex())
+	}
+}
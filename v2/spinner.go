@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/xyproto/textoutput"
@@ -23,6 +24,9 @@ var pacmanNoColor = []string{
 	"|¤· · · |",
 }
 
+// reducedMotionSpinnerText is shown instead of the spinner animation when motion should be reduced
+const reducedMotionSpinnerText = "working…"
+
 var pacmanColor = []string{
 	"<red>| <yellow>C<blue> · ·</blue> <red>|<off>",
 	"<red>| <blue> <yellow>C<blue>· · <red>|<off>",
@@ -38,14 +42,68 @@ var pacmanColor = []string{
 	"<red>|<yellow>¤<blue>· · · <red>|<off>",
 }
 
-// Spinner waits a bit, then displays a spinner together with the given message string (msg).
-// If the spinner is aborted, the qmsg string is displayed.
-// Returns a quit channel (chan bool).
-// The spinner is shown asynchronously.
-// "true" must be sent to the quit channel once whatever operating that the spinner is spinning for is completed.
-func Spinner(c *vt100.Canvas, tty *vt100.TTY, umsg, qmsg string, startIn time.Duration, textColor vt100.AttributeColor) chan bool {
+// spinnerKeyTimeout is how long the spinner waits for a key, between each frame of the animation
+const spinnerKeyTimeout = 20 * time.Millisecond
+
+// startSpinner starts the spinner that is shown while loading and saving. It can be replaced when testing.
+var startSpinner = Spinner
+
+// readSpinnerKeys reads the bytes of the keys that are pressed while the spinner is shown,
+// or returns nil if no key is pressed within a short while
+func readSpinnerKeys(tty *vt100.TTY) []byte {
+	buf := make([]byte, 32)
+	tty.RawMode()
+	tty.NoBlock()
+	tty.SetTimeout(spinnerKeyTimeout)
+	numRead, err := tty.Term().Read(buf)
+	tty.Restore()
+	if err != nil {
+		return nil
+	}
+	return buf[:numRead]
+}
+
+// handleSpinnerKeys checks if any of the keys that were pressed while the spinner was shown asks to abort
+// the operation, which are esc, q, ctrl-q and ctrl-c. The other keys are queued, so that they are
+// handled by the key loop when the operation is done.
+func handleSpinnerKeys(data []byte) bool {
+	abort := false
+	for len(data) > 0 {
+		key, n := decodeKey(data)
+		switch key {
+		case "c:27", "q", "c:17", "c:3": // esc, q, ctrl-q or ctrl-c
+			abort = true
+		default:
+			pendingKeyBytes = append(pendingKeyBytes, data[:n]...)
+		}
+		data = data[n:]
+	}
+	return abort
+}
+
+// spinnerAborted checks if the user has asked to abort the operation that the spinner is shown for
+func spinnerAborted(abortChan <-chan bool) bool {
+	select {
+	case <-abortChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Spinner waits a bit, then displays a spinner together with the given message string (umsg).
+// Returns a quit channel and an abort channel. The spinner is shown asynchronously.
+// "true" must be sent to the quit channel once whatever operation that the spinner is spinning for is completed.
+// If esc, q, ctrl-q or ctrl-c is pressed while the spinner is shown, the qmsg string is shown and "true" is
+// sent to the abort channel, so that the caller can stop the operation at a point where it is safe to do so.
+// Other keys that are pressed meanwhile are handled by the key loop afterwards.
+func Spinner(c *vt100.Canvas, tty *vt100.TTY, umsg, qmsg string, startIn time.Duration, textColor vt100.AttributeColor) (chan bool, <-chan bool) {
 	quitChan := make(chan bool)
+	abortChan := make(chan bool, 1)
 	go func() {
+		// Register the operation, so that it can be shown in the status bar
+		defer operations.Start(strings.TrimSuffix(strings.TrimSpace(umsg), "..."))()
+
 		// Divide the startIn time into 5, then wait while listening to the quitChan
 		// If the quitChan does not receive anything by then, show the spinner
 		const N = 50
@@ -97,30 +155,40 @@ func Spinner(c *vt100.Canvas, tty *vt100.TTY, umsg, qmsg string, startIn time.Du
 		// Echo off
 		vt100.EchoOff()
 
-		if envNoColor {
+		switch {
+		case reduceMotion:
+			spinnerAnimation = []string{reducedMotionSpinnerText}
+		case envNoColor:
 			spinnerAnimation = pacmanNoColor
-		} else {
+		default:
 			spinnerAnimation = pacmanColor
 		}
 
 		// Start the spinner
+		aborted := false
 		for {
 			select {
 			case <-quitChan:
 				return
 			default:
-				vt100.SetXY(x, y)
-				// Iterate over the 12 different ASCII images as the counter increases
-				o.Print(spinnerAnimation[counter%12])
+				// Iterate over the 12 different ASCII images as the counter increases.
+				// The static text for reduced motion is only drawn once.
+				if counter == 0 || len(spinnerAnimation) > 1 {
+					vt100.SetXY(x, y)
+					o.Print(spinnerAnimation[counter%uint(len(spinnerAnimation))])
+				}
 				counter++
-				// Wait for a key press (also sleeps just a bit)
-				switch tty.Key() {
-				case 27, 113, 17, 3: // esc, q, ctrl-q or ctrl-c
-					quitMessage(tty, qmsg)
+				// Wait for a key press (also sleeps just a bit). The keys are queued before the
+				// quit channel is read again, so they are ready when the caller continues.
+				if handleSpinnerKeys(readSpinnerKeys(tty)) && !aborted {
+					aborted = true
+					vt100.SetXY(uint(int(c.Width())/7), y+1)
+					fmt.Print(textColor.Get(qmsg))
+					abortChan <- true
 				}
 			}
 
 		}
 	}()
-	return quitChan
+	return quitChan, abortChan
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestHandleSpinnerKeys(t *testing.T) {
+	defer func(b []byte) { pendingKeyBytes = b }(pendingKeyBytes)
+	pendingKeyBytes = nil
+
+	// Regular keys are queued for the key loop, including escape sequences
+	if handleSpinnerKeys([]byte("ab\x1b[A")) {
+		t.Error("expected no abort")
+	}
+	if string(pendingKeyBytes) != "ab\x1b[A" {
+		t.Errorf("expected the keys to be queued, got %q", pendingKeyBytes)
+	}
+	if key := readKey(nil); key != "a" {
+		t.Errorf("expected the first queued key, got %q", key)
+	}
+
+	// The keys that abort are not queued
+	pendingKeyBytes = nil
+	for _, data := range []string{"q", "\x1b", "\x11", "x\x03y"} {
+		if !handleSpinnerKeys([]byte(data)) {
+			t.Errorf("%q: expected an abort", data)
+		}
+	}
+	if string(pendingKeyBytes) != "xy" {
+		t.Errorf("expected only the other keys to be queued, got %q", pendingKeyBytes)
+	}
+}
+
+// fakeSpinner replaces the spinner for loading and saving, and returns the abort channel it uses
+func fakeSpinner(t *testing.T) chan bool {
+	original := startSpinner
+	t.Cleanup(func() { startSpinner = original })
+	abortChan := make(chan bool, 1)
+	startSpinner = func(c *vt100.Canvas, tty *vt100.TTY, umsg, qmsg string, startIn time.Duration, textColor vt100.AttributeColor) (chan bool, <-chan bool) {
+		quitChan := make(chan bool)
+		go func() { <-quitChan }()
+		return quitChan, abortChan
+	}
+	return abortChan
+}
+
+func TestSaveAbortedWhileWriting(t *testing.T) {
+	abortChan := fakeSpinner(t)
+	defer func(f func(string, []byte, os.FileMode) error) { saveFile = f }(saveFile)
+
+	// The user aborts while a slow write is in progress
+	saveFile = func(filename string, data []byte, perm os.FileMode) error {
+		abortChan <- true
+		time.Sleep(50 * time.Millisecond)
+		return writeFileAtomicWithPermissions(filename, data, perm)
+	}
+	filename := filepath.Join(t.TempDir(), "main.go")
+	contents := strings.Repeat("package main // a line that is long enough\n", 1000)
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.LoadBytes([]byte(contents))
+	e.changed = true
+	if err := e.Save(vt100.NewCanvas(), nil); err != nil {
+		t.Fatalf("expected the write to be completed, got %v", err)
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != contents {
+		t.Errorf("expected the whole file to be written, got %d bytes (%v)", len(data), err)
+	}
+}
+
+func TestSaveAbortedBeforeWriting(t *testing.T) {
+	abortChan := fakeSpinner(t)
+	filename := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(filename, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.LoadBytes([]byte("package main\n\nfunc main() {}\n"))
+	e.changed = true
+	abortChan <- true
+	if err := e.Save(vt100.NewCanvas(), nil); err == nil || !strings.HasSuffix(err.Error(), "stopped by user") {
+		t.Fatalf("expected the saving to be stopped, got %v", err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "package main\n" {
+		t.Errorf("expected the file to be left as it was, got %q", data)
+	}
+	if !e.Changed() {
+		t.Error("expected the contents to still be marked as changed")
+	}
+}
+
+func TestLoadSmallFileWithoutSpinner(t *testing.T) {
+	abortChan := fakeSpinner(t)
+	filename := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(filename, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An abort is only seen if a spinner was started
+	abortChan <- true
+	e := NewSimpleEditor(80)
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatalf("expected the small file to be read without a spinner, got %v", err)
+	}
+	if line := e.Line(0); line != "127.0.0.1 localhost" {
+		t.Errorf("unexpected contents: %q", line)
+	}
+}
+
+func TestLoadAborted(t *testing.T) {
+	abortChan := fakeSpinner(t)
+	// Small files are read without a spinner, so the file needs to be larger than that
+	filename := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("new contents\n", smallFileSize/10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("old contents\n"))
+	abortChan <- true
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err == nil {
+		t.Fatal("expected the reading to be stopped")
+	}
+	if line := e.Line(0); line != "old contents" {
+		t.Errorf("expected the contents to be unchanged, got %q", line)
+	}
+}
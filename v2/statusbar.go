@@ -1,6 +1,8 @@
 package main
 
 import (
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,6 +13,30 @@ import (
 
 var mut *sync.RWMutex
 
+// MessagePolicy decides when a status message is cleared
+type MessagePolicy int
+
+const (
+	timedMessage       MessagePolicy = iota // cleared by a timer, after a number of seconds
+	stickyMessage                           // cleared when the next key is pressed
+	untilRedrawMessage                      // cleared when the editor lines are redrawn, for progress messages
+)
+
+// statusClock is used for clearing timed status messages, and can be replaced in tests
+type statusClock interface {
+	// AfterFunc calls f in its own goroutine after the given duration, unless the returned stop function is called first.
+	// Since f is not called by the key loop, it must not change or draw the editor itself.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// realClock is the statusClock that uses the time package
+type realClock struct{}
+
+// AfterFunc calls f in its own goroutine after the given duration
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
 // StatusBar represents the little status field that can appear at the bottom of the screen
 type StatusBar struct {
 	msg                string               // status message
@@ -23,20 +49,28 @@ type StatusBar struct {
 	offsetY            int                  // scroll offset
 	isError            bool                 // is this an error message that should be shown after redraw?
 	messageAfterRedraw string               // a message to be drawn and cleared AFTER the redraw
+	policy             MessagePolicy        // when the current message is cleared
+	clock              statusClock          // for clearing timed messages
+	stopTimer          func() bool          // stops the timer for the current timed message, if any
+	generation         int                  // increased for every message that is shown, so that old timers can be ignored
+	clearRow           bool                 // the status row should be drawn again, since the message was cleared by a keypress
+	out                io.Writer            // where the status row is written when a timed message is cleared
 }
 
-// Used for keeping track of how many status messages are lined up to be cleared
-var statusBeingShown int
-
 // NewStatusBar takes a foreground color, background color, foreground color for clearing,
 // background color for clearing and a duration for how long to display status messages.
 func NewStatusBar(fg, bg, errfg, errbg vt100.AttributeColor, editor *Editor, show time.Duration, initialMessageAfterRedraw string) *StatusBar {
 	mut = &sync.RWMutex{}
-	return &StatusBar{"", fg, bg, errfg, errbg, editor, show, 0, false, initialMessageAfterRedraw}
+	return &StatusBar{msg: "", fg: fg, bg: bg, errfg: errfg, errbg: errbg, editor: editor, show: show, messageAfterRedraw: initialMessageAfterRedraw, clock: realClock{}, out: os.Stdout}
 }
 
 // Draw will draw the status bar to the canvas
 func (sb *StatusBar) Draw(c *vt100.Canvas, offsetY int) {
+	// The status bar is not drawn on top of the message about the terminal being too small
+	if terminalTooSmall(c.W(), c.H()) {
+		return
+	}
+
 	w := int(c.W())
 
 	// Shorten the status message if it's longer than the terminal width
@@ -46,11 +80,11 @@ func (sb *StatusBar) Draw(c *vt100.Canvas, offsetY int) {
 
 	if sb.IsError() {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), c.H()-1, sb.errfg, sb.errbg, sb.msg)
+		c.Write(centeredX(w, len(sb.msg)), c.H()-1, sb.errfg, sb.errbg, sb.msg)
 		mut.RUnlock()
 	} else {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), c.H()-1, sb.fg, sb.bg, sb.msg)
+		c.Write(centeredX(w, len(sb.msg)), c.H()-1, sb.fg, sb.bg, sb.msg)
 		mut.RUnlock()
 	}
 
@@ -127,6 +161,8 @@ func (sb *StatusBar) Clear(c *vt100.Canvas) error {
 	sb.msg = ""
 	// Not an error message
 	sb.isError = false
+	// The lines are drawn below
+	sb.clearRow = false
 
 	mut.Unlock()
 
@@ -147,11 +183,15 @@ func (sb *StatusBar) Clear(c *vt100.Canvas) error {
 // ClearAll will clear all status messages
 func (sb *StatusBar) ClearAll(c *vt100.Canvas) {
 	mut.Lock()
-	statusBeingShown = 0
+	// Forget about all timers
+	sb.stopTimerLocked()
+	sb.generation++
 	// Clear the message
 	sb.msg = ""
 	// Not an error message
 	sb.isError = false
+	// The lines are drawn below
+	sb.clearRow = false
 	mut.Unlock()
 
 	if c == nil {
@@ -167,83 +207,144 @@ func (sb *StatusBar) ClearAll(c *vt100.Canvas) {
 	c.Draw()
 }
 
-// Show will draw a status message, then clear it after a certain delay
-func (sb *StatusBar) Show(c *vt100.Canvas, e *Editor) {
-	mut.Lock()
-	statusBeingShown++
-	mut.Unlock()
+// stopTimerLocked stops the timer for the current timed message, if there is one. mut must be locked.
+func (sb *StatusBar) stopTimerLocked() {
+	if sb.stopTimer != nil {
+		sb.stopTimer()
+		sb.stopTimer = nil
+	}
+}
 
-	mut.RLock()
+// display draws the current status message, and decides when it is cleared. Returns false if there is no message.
+func (sb *StatusBar) display(c *vt100.Canvas, e *Editor, policy MessagePolicy) (int, bool) {
+	mut.Lock()
 	if sb.msg == "" {
-		mut.RUnlock()
-		return
+		mut.Unlock()
+		return 0, false
 	}
+	sb.stopTimerLocked()
+	sb.generation++
+	sb.policy = policy
+	sb.clearRow = false
+	generation := sb.generation
 	offsetY := e.pos.OffsetY()
-	mut.RUnlock()
+	mut.Unlock()
 
 	sb.Draw(c, offsetY)
+	c.Draw()
+	return generation, true
+}
 
-	go func() {
-		mut.RLock()
-		sleepDuration := sb.show
-		mut.RUnlock()
-
-		if sb.IsError() {
-			// Show error messages for 3x as long
-			sleepDuration *= 3
-		}
-		time.Sleep(sleepDuration)
+// Show will draw a status message, then clear it after a certain delay.
+// Error messages are shown for 3x as long.
+func (sb *StatusBar) Show(c *vt100.Canvas, e *Editor) {
+	duration := sb.show
+	if sb.IsError() {
+		duration *= 3
+	}
+	sb.ShowFor(c, e, duration)
+}
 
-		mut.RLock()
-		// Has everyhing been cleared while sleeping?
-		if statusBeingShown <= 0 {
-			// Yes, so just quit
-			mut.RUnlock()
-			return
-		}
-		mut.RUnlock()
+// ShowFor will draw a status message, then clear it after the given duration.
+// The message is drawn again if the editor is redrawn before that.
+// When the timer runs out, the key loop clears the message and draws only the status row again.
+func (sb *StatusBar) ShowFor(c *vt100.Canvas, e *Editor, duration time.Duration) {
+	generation, ok := sb.display(c, e, timedMessage)
+	if !ok {
+		return
+	}
+	mut.Lock()
+	sb.stopTimer = sb.clock.AfterFunc(duration, func() {
+		runInKeyLoop(func() {
+			sb.expire(c, generation)
+		})
+	})
+	mut.Unlock()
+}
 
-		mut.Lock()
-		statusBeingShown--
+// expire clears the timed message with the given generation, if it is still shown, and draws the status row again
+func (sb *StatusBar) expire(c *vt100.Canvas, generation int) {
+	mut.Lock()
+	// Has another message been shown, or everything been cleared, in the meantime?
+	if sb.generation != generation {
 		mut.Unlock()
-
-		mut.RLock()
-		if statusBeingShown == 0 {
-			mut.RUnlock()
-			mut.Lock()
-			// Clear the message
-			sb.msg = ""
-			// Not an error message
-			sb.isError = false
-			mut.Unlock()
-		} else {
-			mut.RUnlock()
-		}
-	}()
-	c.Draw()
+		return
+	}
+	sb.msg = ""
+	sb.isError = false
+	sb.stopTimer = nil
+	mut.Unlock()
+	sb.redrawStatusRow(c)
 }
 
 // ShowNoTimeout will draw a status message that will not be
-// cleared after a certain timeout.
+// cleared after a certain timeout, but when the next key is pressed.
 func (sb *StatusBar) ShowNoTimeout(c *vt100.Canvas, e *Editor) {
-	mut.RLock()
-	if sb.msg == "" {
-		mut.RUnlock()
-		return
-	}
-	mut.RUnlock()
+	sb.display(c, e, stickyMessage)
+}
 
-	mut.RLock()
-	offsetY := e.pos.OffsetY()
-	mut.RUnlock()
+// ShowUntilRedraw will draw a status message that is cleared when the editor lines are drawn again,
+// for instance when the operation that the message is about is done.
+func (sb *StatusBar) ShowUntilRedraw(c *vt100.Canvas, e *Editor) {
+	sb.display(c, e, untilRedrawMessage)
+}
 
-	sb.Draw(c, offsetY)
+// KeyPressed clears the current status message, if it should only be shown until the next keypress.
+// The status row is drawn again by Refresh, unless another message is shown first.
+func (sb *StatusBar) KeyPressed() {
+	mut.Lock()
+	defer mut.Unlock()
+	if sb.policy == stickyMessage && sb.msg != "" {
+		sb.msg = ""
+		sb.isError = false
+		sb.clearRow = true
+	}
+}
 
+// Redrawn clears the current status message, if it should only be shown until the editor is redrawn.
+// It should be called right before all the editor lines are drawn again.
+func (sb *StatusBar) Redrawn() {
 	mut.Lock()
-	statusBeingShown++
+	defer mut.Unlock()
+	if sb.policy == untilRedrawMessage {
+		sb.msg = ""
+		sb.isError = false
+		sb.clearRow = false
+	}
+}
+
+// Refresh draws the current status message again, since the editor lines may have been drawn on top of it.
+// If the message was cleared by a keypress, the status row is drawn again instead.
+func (sb *StatusBar) Refresh(c *vt100.Canvas, e *Editor) {
+	mut.Lock()
+	msg, clearRow := sb.msg, sb.clearRow
+	sb.clearRow = false
+	offsetY := e.pos.OffsetY()
 	mut.Unlock()
+	if msg != "" {
+		sb.Draw(c, offsetY)
+		c.Draw()
+	} else if clearRow {
+		sb.redrawStatusRow(c)
+	}
+}
 
-	c.Draw()
+// redrawStatusRow draws the editor line at the bottom of the canvas again,
+// and writes only that row to the terminal
+func (sb *StatusBar) redrawStatusRow(c *vt100.Canvas) {
+	e := sb.editor
+	if c == nil || e == nil || terminalTooSmall(c.W(), c.H()) {
+		return
+	}
+	row := int(c.H()) - 1
+	y := e.pos.OffsetY() + row
+	if e.showRuler {
+		// The lines are shifted one row down by the column ruler
+		y--
+	}
+	out := newCellWriter(c, row)
+	e.writeLines(out, LineIndex(y), LineIndex(y+1), 0, uint(row), highlightTimeBudget)
+	writeRow(sb.out, uint(row), out.cells)
 }
 
 // ShowWordCount displays a status message with only the current word count
@@ -255,27 +356,16 @@ func (sb *StatusBar) ShowWordCount(c *vt100.Canvas, e *Editor) {
 
 // ShowLineColWordCount shows a status message with the current filename, line, column and word count
 func (sb *StatusBar) ShowLineColWordCount(c *vt100.Canvas, e *Editor, filename string) {
-	statusString := filename + ": " + e.StatusMessage()
+	statusMessage := e.StatusMessage()
+	statusString := shortenPathForDisplay(filename, statusPathWidth(c, statusMessage)) + ": " + statusMessage
 	sb.SetMessage(statusString)
 	sb.ShowNoTimeout(c, e)
 }
 
 // ShowLineColWordCountAfterRedraw shows a status message with the current filename, line, column and word count, after the redraw
 func (sb *StatusBar) ShowLineColWordCountAfterRedraw(c *vt100.Canvas, e *Editor, filename string) {
-	sb.messageAfterRedraw = filename + ": " + e.StatusMessage()
-}
-
-// HoldMessage can be used to let a status message survive on screen for N seconds,
-// even if e.redraw has been set. statusMessageAfterRedraw is a pointer to the one-off
-// variable that will be used in keyloop.go, after redrawing.
-func (sb *StatusBar) HoldMessage(c *vt100.Canvas, dur time.Duration) {
-	if strings.TrimSpace(sb.msg) != "" {
-		sb.messageAfterRedraw = sb.msg
-		go func() {
-			time.Sleep(dur)
-			sb.ClearAll(c)
-		}()
-	}
+	statusMessage := e.StatusMessage()
+	sb.messageAfterRedraw = shortenPathForDisplay(filename, statusPathWidth(c, statusMessage)) + ": " + statusMessage
 }
 
 // SetMessageAfterRedraw prepares a status bar message that will be shown after redraw
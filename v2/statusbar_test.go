@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+// fakeClock is a statusClock where the time only passes when Advance is called
+type fakeClock struct {
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+// AfterFunc schedules f to be called when the clock has been advanced past the given duration
+func (fc *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	ft := &fakeTimer{at: fc.now + d, f: f}
+	fc.timers = append(fc.timers, ft)
+	return func() bool {
+		wasRunning := !ft.stopped
+		ft.stopped = true
+		return wasRunning
+	}
+}
+
+// Advance moves the time forward and calls the functions of the timers that run out,
+// then runs the events that they sent to the key loop
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.now += d
+	for _, ft := range fc.timers {
+		if !ft.stopped && ft.at <= fc.now {
+			ft.stopped = true
+			ft.f()
+		}
+	}
+	runKeyLoopEvents()
+}
+
+// newTestStatusBar returns a status bar with a fake clock, and the buffer where redrawn status rows are written
+func newTestStatusBar(e *Editor) (*StatusBar, *fakeClock, *bytes.Buffer) {
+	var buf bytes.Buffer
+	fc := &fakeClock{}
+	status := testStatusBar(e)
+	status.clock = fc
+	status.out = &buf
+	return status, fc, &buf
+}
+
+func TestStatusTimedMessage(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	status, fc, buf := newTestStatusBar(e)
+
+	status.SetMessage("first")
+	status.Show(c, e)
+	fc.Advance(500 * time.Millisecond)
+	status.SetMessage("second")
+	status.Show(c, e)
+
+	// The timer for the first message must not clear the second one
+	fc.Advance(600 * time.Millisecond)
+	if status.Message() != "second" || buf.Len() != 0 {
+		t.Fatalf("expected the second message to still be shown, got %q", status.Message())
+	}
+	fc.Advance(500 * time.Millisecond)
+	if status.Message() != "" {
+		t.Errorf("expected the message to be cleared, got %q", status.Message())
+	}
+	if rows := strings.Count(buf.String(), "\0337"); rows != 1 {
+		t.Errorf("expected the status row to be drawn once, got %d rows", rows)
+	}
+
+	// Error messages are shown for longer
+	status.SetErrorMessage("oops")
+	status.Show(c, e)
+	fc.Advance(2 * time.Second)
+	if status.Message() != "oops" {
+		t.Errorf("expected the error message to still be shown, got %q", status.Message())
+	}
+	fc.Advance(time.Second)
+	if status.Message() != "" {
+		t.Errorf("expected the error message to be cleared, got %q", status.Message())
+	}
+}
+
+func TestStatusStickyAndUntilRedraw(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	status, fc, buf := newTestStatusBar(e)
+
+	// A sticky message is only cleared by a keypress
+	status.SetMessage("Count: 3")
+	status.ShowNoTimeout(c, e)
+	fc.Advance(time.Minute)
+	status.Redrawn()
+	if status.Message() != "Count: 3" {
+		t.Fatalf("expected the sticky message to still be shown, got %q", status.Message())
+	}
+	status.KeyPressed()
+	if status.Message() != "" {
+		t.Errorf("expected the sticky message to be cleared, got %q", status.Message())
+	}
+	status.Refresh(c, e)
+	if rows := strings.Count(buf.String(), "\0337"); rows != 1 {
+		t.Errorf("expected the status row to be drawn once, got %d rows", rows)
+	}
+
+	// A progress message is cleared by a redraw, but not by a keypress
+	status.SetMessage("Building")
+	status.ShowUntilRedraw(c, e)
+	status.KeyPressed()
+	if status.Message() != "Building" {
+		t.Fatalf("expected the progress message to still be shown, got %q", status.Message())
+	}
+	status.Redrawn()
+	if status.Message() != "" {
+		t.Errorf("expected the progress message to be cleared, got %q", status.Message())
+	}
+
+	// Clearing everything stops the timers
+	status.SetMessage("timed")
+	status.Show(c, e)
+	status.ClearAll(nil)
+	status.SetMessage("sticky")
+	status.ShowNoTimeout(c, e)
+	fc.Advance(time.Minute)
+	if status.Message() != "sticky" {
+		t.Errorf("expected the old timer to be stopped, got %q", status.Message())
+	}
+}
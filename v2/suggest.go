@@ -75,7 +75,7 @@ func (e *Editor) SuggestMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY,
 
 	var doneChoosing bool
 	for !doneChoosing {
-		key := tty.String()
+		key := readKey(tty)
 		switch key {
 		case "c:9", "↓", "→": // tab, down arrow or right arrow
 			// Cycle suggested words
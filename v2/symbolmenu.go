@@ -66,7 +66,7 @@ func (e *Editor) SymbolMenu(status *StatusBar, tty *vt100.TTY, title string, cho
 		}
 
 		// Handle events
-		key := tty.String()
+		key := readKey(tty)
 		switch key {
 		case "↑", "c:16": // Up or ctrl-p
 			resizeMut.Lock()
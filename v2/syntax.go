@@ -68,6 +68,11 @@ var (
 	erlangWords = []string{"after", "and", "andalso", "band", "begin", "bnot", "bor", "bsl", "bsr", "bxor", "case", "catch", "cond", "div", "end", "fun", "if", "let", "not", "of", "or", "orelse", "receive", "rem", "try", "when", "xor"}
 )
 
+var (
+	keywordsPrepared bool      // have the keywords been adjusted for keywordsMode?
+	keywordsMode     mode.Mode // the mode the keywords were last adjusted for
+)
+
 func clearKeywords() {
 	syntax.Keywords = make(map[string]struct{})
 }
@@ -212,6 +217,16 @@ func adjustSyntaxHighlightingKeywords(m mode.Mode) {
 	}
 }
 
+// prepareSyntaxKeywords adjusts the keywords for the given mode, if they have not already been adjusted for it.
+// This is done when the keywords are first needed, so that files that are not highlighted start faster.
+func prepareSyntaxKeywords(m mode.Mode) {
+	if keywordsPrepared && keywordsMode == m {
+		return
+	}
+	adjustSyntaxHighlightingKeywords(m)
+	keywordsPrepared, keywordsMode = true, m
+}
+
 // SingleLineCommentMarker will return the string that starts a single-line
 // comment for the current language mode the editor is in.
 func (e *Editor) SingleLineCommentMarker() string {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// syntaxErrorPrefix is the start of the messages for syntax errors that are found when saving
+const syntaxErrorPrefix = "syntax error: "
+
+// syntaxCheckOnSave is true if JSON files should be checked for syntax errors, and YAML files for indentation
+// with tabs, when they are saved. It can be disabled in the ctrl-o menu, for huge files where the check is slow.
+var syntaxCheckOnSave = true
+
+var errYAMLTabIndentation = errors.New("tabs can not be used for indentation in YAML")
+
+// lineColAt returns the line and column number of the given byte offset in the given data
+func lineColAt(data []byte, offset int) (LineNumber, ColNumber) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return LineNumber(bytes.Count(before, []byte{'\n'}) + 1), ColNumber(utf8.RuneCount(before[lineStart:]) + 1)
+}
+
+// checkJSONSyntax checks if the given data is valid JSON, and returns where the first syntax error is, if any
+func checkJSONSyntax(data []byte) (LineNumber, ColNumber, error) {
+	var v any
+	err := json.Unmarshal(data, &v)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The offset is right after the byte that could not be parsed
+		line, col := lineColAt(data, int(syntaxErr.Offset))
+		if col > 1 {
+			col--
+		}
+		return line, col, err
+	}
+	return 1, 1, err
+}
+
+// checkYAMLIndentation checks the indentation of the given YAML data, and returns where the first line that is
+// indented with tabs is, if any. In block scalars, like after "key: |", tabs after the indentation are part of the
+// text. This is the most common mistake in YAML files, but the rest of the YAML syntax is not checked.
+func checkYAMLIndentation(data []byte) (LineNumber, ColNumber, error) {
+	blockIndentation := -1 // the indentation of the line that starts a block scalar, or -1 when not in one
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		if blockIndentation >= 0 && spaces > blockIndentation {
+			continue
+		}
+		blockIndentation = -1
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; strings.Contains(indentation, "\t") {
+			return LineNumber(i + 1), ColNumber(strings.Index(indentation, "\t") + 1), errYAMLTabIndentation
+		}
+		if startsYAMLBlockScalar(trimmed) {
+			blockIndentation = spaces
+		}
+	}
+	return 0, 0, nil
+}
+
+// startsYAMLBlockScalar checks if the given trimmed YAML line ends with a block scalar indicator, like "|" or ">-"
+func startsYAMLBlockScalar(trimmed string) bool {
+	if i := strings.Index(trimmed, " #"); i >= 0 {
+		trimmed = strings.TrimSpace(trimmed[:i])
+	}
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return false
+	}
+	last := fields[len(fields)-1]
+	return strings.ContainsAny(last[:1], "|>") && strings.Trim(last[1:], "+-0123456789") == ""
+}
+
+// CheckSyntaxOnSave checks JSON files for syntax errors, and YAML files for indentation with tabs. If there is an
+// error, it is kept apart from the errors from the last build, so that it can be jumped to with esc e, and it is
+// returned. Otherwise, a syntax error from the last time this file was saved is forgotten.
+func (e *Editor) CheckSyntaxOnSave() *BuildError {
+	var check func([]byte) (LineNumber, ColNumber, error)
+	switch strings.ToLower(filepath.Ext(e.filename)) {
+	case ".json":
+		check = checkJSONSyntax
+	case ".yaml", ".yml":
+		check = checkYAMLIndentation
+	}
+	if check == nil || !syntaxCheckOnSave || e.binaryFile || strings.TrimSpace(e.String()) == "" {
+		e.syntaxError = nil
+		return nil
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		absFilename = e.filename
+	}
+	line, col, err := check([]byte(e.String()))
+	if err == nil {
+		e.syntaxError = nil
+		return nil
+	}
+	e.syntaxError = &BuildError{absFilename, line, col, syntaxErrorPrefix + err.Error()}
+	return e.syntaxError
+}
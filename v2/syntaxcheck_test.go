@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckJSONSyntax(t *testing.T) {
+	if _, _, err := checkJSONSyntax([]byte("{\n  \"a\": [1, 2]\n}\n")); err != nil {
+		t.Errorf("expected valid JSON, got %v", err)
+	}
+	line, col, err := checkJSONSyntax([]byte("{\n  \"a\": 1,\n  \"b\" 2\n}\n"))
+	if err == nil || line != 3 || col != 7 {
+		t.Errorf("expected a syntax error at line 3, column 7, got %d:%d %v", line, col, err)
+	}
+	if line, _, err := checkJSONSyntax([]byte("{\n  \"a\": 1\n")); err == nil || line != 3 {
+		t.Errorf("expected an error at the end for unclosed JSON, got line %d %v", line, err)
+	}
+}
+
+func TestCheckYAMLIndentation(t *testing.T) {
+	valid := "a: 1\nb:\n  - c\n  - d # \tcomment\nscript: |\n  echo\tfirst\n    \tindented\n\t# a comment\nlast: >-\n  folded\n"
+	if _, _, err := checkYAMLIndentation([]byte(valid)); err != nil {
+		t.Errorf("expected valid YAML, got %v", err)
+	}
+	line, col, err := checkYAMLIndentation([]byte("a:\n  b: 1\n \tc: 2\n"))
+	if err != errYAMLTabIndentation || line != 3 || col != 2 {
+		t.Errorf("expected a tab indentation error at line 3, column 2, got %d:%d %v", line, col, err)
+	}
+	if line, _, err := checkYAMLIndentation([]byte("text: |\n  ok\n\tbad: 1\n")); err == nil || line != 3 {
+		t.Errorf("expected the block scalar to end before a line indented with a tab, got line %d %v", line, err)
+	}
+}
+
+func TestCheckSyntaxOnSave(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.filename = "/tmp/config.yml"
+	e.LoadBytes([]byte("a:\n\tb: 1\n"))
+	buildErrors := &BuildErrors{[]BuildError{{"/tmp/main.go", 3, 1, "undefined: x"}}, -1}
+	e.buildErrors = buildErrors
+	syntaxError := e.CheckSyntaxOnSave()
+	if syntaxError == nil || syntaxError.line != 2 || e.syntaxError != syntaxError {
+		t.Fatalf("expected a syntax error at line 2 to be kept, got %v", syntaxError)
+	}
+	if e.buildErrors != buildErrors {
+		t.Error("expected the errors from the last build to be kept apart from the syntax error")
+	}
+	e.LoadBytes([]byte("a:\n  b: 1\n"))
+	if syntaxError := e.CheckSyntaxOnSave(); syntaxError != nil || e.syntaxError != nil || e.buildErrors.Len() != 1 {
+		t.Errorf("expected only the syntax error to be forgotten when it is fixed, got %v", syntaxError)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+var (
+	// useSystemClipboard is false if ctrl-c, ctrl-x and ctrl-v should only use the internal copy buffer
+	useSystemClipboard = true
+
+	errSystemClipboardDisabled = errors.New("the system clipboard is disabled")
+	errNoClipboardUtility      = errors.New("no clipboard utility found, like wl-copy, xclip or xsel")
+)
+
+// clipboardUtility is a pair of commands for copying to and pasting from the system clipboard
+type clipboardUtility struct {
+	copyArgs  []string
+	pasteArgs []string
+}
+
+// isWSL checks if this is Linux running under the Windows Subsystem for Linux
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+// clipboardUtilities returns the clipboard utilities that can be used for the given platform and environment,
+// in the order they should be tried. Utilities that are not installed are not filtered out.
+func clipboardUtilities(goos string, getenv func(string) string, wsl bool) []clipboardUtility {
+	var utilities []clipboardUtility
+	if goos == "darwin" {
+		return append(utilities, clipboardUtility{[]string{"pbcopy"}, []string{"pbpaste"}})
+	}
+	if getenv("WAYLAND_DISPLAY") != "" {
+		utilities = append(utilities, clipboardUtility{[]string{"wl-copy"}, []string{"wl-paste", "--no-newline"}})
+	}
+	if getenv("DISPLAY") != "" {
+		utilities = append(utilities,
+			clipboardUtility{[]string{"xclip", "-in", "-selection", "clipboard"}, []string{"xclip", "-out", "-selection", "clipboard"}},
+			clipboardUtility{[]string{"xsel", "--input", "--clipboard"}, []string{"xsel", "--output", "--clipboard"}})
+	}
+	if wsl {
+		utilities = append(utilities, clipboardUtility{[]string{"clip.exe"}, []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"}})
+	}
+	return utilities
+}
+
+// availableClipboardUtility returns the first clipboard utility that is installed, if any
+func availableClipboardUtility() (clipboardUtility, bool) {
+	for _, utility := range clipboardUtilities(runtime.GOOS, os.Getenv, runtime.GOOS == "linux" && isWSL()) {
+		if which(utility.copyArgs[0]) != "" && which(utility.pasteArgs[0]) != "" {
+			return utility, true
+		}
+	}
+	return clipboardUtility{}, false
+}
+
+// copyToClipboard places the given text in the system clipboard. An error is returned if the system
+// clipboard is disabled or could not be used, in which case only the internal copy buffer is used.
+func copyToClipboard(s string) error {
+	if !useSystemClipboard {
+		return errSystemClipboardDisabled
+	}
+	if runtime.GOOS == "windows" {
+		return clipboard.WriteAll(s)
+	}
+	utility, ok := availableClipboardUtility()
+	if !ok {
+		return errNoClipboardUtility
+	}
+	cmd := exec.Command(utility.copyArgs[0], utility.copyArgs[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	return cmd.Run()
+}
+
+// pasteFromClipboard returns the contents of the system clipboard. An error is returned if the system
+// clipboard is disabled or could not be used, in which case the internal copy buffer should be used instead.
+func pasteFromClipboard() (string, error) {
+	if !useSystemClipboard {
+		return "", errSystemClipboardDisabled
+	}
+	if runtime.GOOS == "windows" {
+		return clipboard.ReadAll()
+	}
+	utility, ok := availableClipboardUtility()
+	if !ok {
+		return "", errNoClipboardUtility
+	}
+	var buf bytes.Buffer
+	cmd := exec.Command(utility.pasteArgs[0], utility.pasteArgs[1:]...)
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	s := buf.String()
+	if utility.pasteArgs[0] == "powershell.exe" {
+		// Get-Clipboard uses Windows line endings and adds a trailing newline
+		s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	}
+	return s, nil
+}
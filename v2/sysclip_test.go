@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClipboardUtilities(t *testing.T) {
+	getenv := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	firstCommands := func(utilities []clipboardUtility) []string {
+		var commands []string
+		for _, utility := range utilities {
+			commands = append(commands, utility.copyArgs[0]+"/"+utility.pasteArgs[0])
+		}
+		return commands
+	}
+	tests := []struct {
+		goos     string
+		vars     map[string]string
+		wsl      bool
+		expected []string
+	}{
+		{"darwin", map[string]string{"DISPLAY": ":0"}, false, []string{"pbcopy/pbpaste"}},
+		{"linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, false, []string{"wl-copy/wl-paste", "xclip/xclip", "xsel/xsel"}},
+		{"linux", map[string]string{"DISPLAY": ":0"}, false, []string{"xclip/xclip", "xsel/xsel"}},
+		{"linux", map[string]string{}, true, []string{"clip.exe/powershell.exe"}},
+		{"linux", map[string]string{}, false, nil},
+	}
+	for _, test := range tests {
+		got := firstCommands(clipboardUtilities(test.goos, getenv(test.vars), test.wsl))
+		if len(got) != len(test.expected) {
+			t.Errorf("%s %v: expected %v, got %v", test.goos, test.vars, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%s %v: expected %v, got %v", test.goos, test.vars, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSystemClipboardDisabled(t *testing.T) {
+	defer func(b bool) { useSystemClipboard = b }(useSystemClipboard)
+	useSystemClipboard = false
+	if err := copyToClipboard("hello"); err != errSystemClipboardDisabled {
+		t.Errorf("expected the system clipboard to be disabled, got %v", err)
+	}
+	if _, err := pasteFromClipboard(); err != errSystemClipboardDisabled {
+		t.Errorf("expected the system clipboard to be disabled, got %v", err)
+	}
+}
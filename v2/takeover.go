@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/vt100"
+)
+
+// takeoverTimeout is how long to wait for the other instance of the editor to answer a takeover request
+const takeoverTimeout = 60 * time.Second
+
+var (
+	errTakeoverDeclined = errors.New("the other instance of the editor did not release the file")
+	errTakeoverTimeout  = errors.New("the other instance of the editor did not answer in time")
+)
+
+// takeoverRequested is 1 while a takeover request from another instance of the editor waits for an answer
+var takeoverRequested int32
+
+// Taking over a file from another instance of the editor works like this:
+//
+//  1. The new instance finds that the file is locked by an editor process that is still running.
+//  2. It writes the filename to a takeover request file, named after the process ID of the other instance,
+//     and sends SIGUSR1 to it.
+//  3. The other instance asks the user if the file should be saved and released.
+//     If yes, it saves the file, unlocks it and becomes read-only. Then it removes the request file.
+//     If no, it just removes the request file.
+//  4. The new instance waits for the request file to be removed, then checks if the file was unlocked.
+//
+// A SIGUSR1 without a request file just unlocks the file, like before.
+
+// takeoverRequestFilename returns the name of the file with a takeover request for the given process
+func takeoverRequestFilename(lockFilename string, pid int) string {
+	return lockFilename + "." + strconv.Itoa(pid) + ".takeover"
+}
+
+// runningEditor checks if the given process is running, and, if it can be checked, that it runs this editor
+func runningEditor(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	if err := syscall.Kill(pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	// On Linux, check that the process runs an executable with the same name
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return true
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	return filepath.Base(strings.TrimSuffix(exe, " (deleted)")) == filepath.Base(self)
+}
+
+// RequestTakeover asks the editor that has locked the given absolute filename to save and release it,
+// and waits until it has answered. Returns nil if the file was released.
+func RequestTakeover(lk *LockKeeper, filename string, timeout time.Duration) error {
+	pid := lk.Owner(filename)
+	if !runningEditor(pid) {
+		return errors.New("the file is not locked by a running editor")
+	}
+	requestFilename := takeoverRequestFilename(lk.lockFilename, pid)
+	if err := os.WriteFile(requestFilename, []byte(filename), 0600); err != nil {
+		return err
+	}
+	if err := syscall.Kill(pid, syscall.SIGUSR1); err != nil {
+		os.Remove(requestFilename)
+		return err
+	}
+	defer os.Remove(requestFilename)
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(50 * time.Millisecond) {
+		// The request file is removed after the file has been unlocked, so check it first
+		if exists(requestFilename) && runningEditor(pid) {
+			continue
+		}
+		if err := lk.Load(); err != nil {
+			return err
+		}
+		if lk.IsLocked(filename) && lk.Owner(filename) == pid && runningEditor(pid) {
+			return errTakeoverDeclined
+		}
+		return nil
+	}
+	return errTakeoverTimeout
+}
+
+// takeoverRequestedFor checks if another instance of the editor has asked this process to release the given file
+func takeoverRequestedFor(lk *LockKeeper, filename string) bool {
+	data, err := os.ReadFile(takeoverRequestFilename(lk.lockFilename, os.Getpid()))
+	return err == nil && string(data) == filename
+}
+
+// answerTakeover removes the takeover request file, which tells the other instance of the editor
+// that the request has been answered
+func answerTakeover(lk *LockKeeper) {
+	os.Remove(takeoverRequestFilename(lk.lockFilename, os.Getpid()))
+}
+
+// AcceptTakeover saves the file, unlocks it and makes this editor read-only, then tells the other instance
+// of the editor that the file has been released. If the file could not be saved, it is not released.
+func (e *Editor) AcceptTakeover(c *vt100.Canvas, tty *vt100.TTY, lk *LockKeeper, filename string) error {
+	defer answerTakeover(lk)
+	if e.changed {
+		if err := e.Save(c, tty); err != nil {
+			return err
+		}
+	}
+	lk.Unlock(filename)
+	if err := lk.Save(); err != nil {
+		return err
+	}
+	e.readOnly = true
+	e.lockReleased = true
+	return nil
+}
+
+// AnswerTakeover lets the user answer a takeover request with y or n, when one is waiting.
+// Returns true if the given key was used for answering.
+func (e *Editor) AnswerTakeover(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filename, key string) bool {
+	if atomic.LoadInt32(&takeoverRequested) == 0 || (key != "y" && key != "n" && key != "c:27") {
+		return false
+	}
+	atomic.StoreInt32(&takeoverRequested, 0)
+	status.ClearAll(c)
+	if key != "y" {
+		answerTakeover(lk)
+		status.SetMessage("Kept " + filepath.Base(filename))
+		status.Show(c, e)
+		return true
+	}
+	if err := e.AcceptTakeover(c, tty, lk, filename); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return true
+	}
+	status.SetMessage("Saved and released " + filepath.Base(filename) + ", read-only from now on")
+	status.Show(c, e)
+	e.redraw = true
+	return true
+}
+
+// askTakeover is called from the signal handler when another instance of the editor wants this file
+func (e *Editor) askTakeover(c *vt100.Canvas, status *StatusBar) {
+	atomic.StoreInt32(&takeoverRequested, 1)
+	status.ClearAll(c)
+	status.SetMessage("Another o wants this file. Save and release? (y/n)")
+	status.ShowNoTimeout(c, e)
+}
+
+// TakeOver offers to ask the editor that has locked the given absolute filename to save and release it,
+// if that editor is still running. If the file is released, it is locked and loaded again.
+// Returns true if the file was taken over.
+func (e *Editor) TakeOver(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filename string) bool {
+	pid := lk.Owner(filename)
+	if !runningEditor(pid) {
+		return false
+	}
+	prompt := fmt.Sprintf("%s is open in another o (pid %d). Request takeover? (y/n)", filepath.Base(filename), pid)
+	answer, ok := e.UserInput(c, tty, status, prompt, []string{"y", "n"}, false)
+	if !ok || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		return false
+	}
+	status.ClearAll(c)
+	status.SetMessage("Waiting for the other o to save and release " + filepath.Base(filename) + "...")
+	status.ShowUntilRedraw(c, e)
+	if err := RequestTakeover(lk, filename, takeoverTimeout); err != nil {
+		return false
+	}
+	// The other instance may have quit without unlocking the file
+	lk.Unlock(filename)
+	if err := lk.Lock(filename); err != nil {
+		return false
+	}
+	lk.Save()
+	// Load the file again, since the other instance may have saved it
+	if _, err := e.Load(c, tty, FilenameOrData{filename: e.filename}); err != nil {
+		lk.Unlock(filename)
+		lk.Save()
+		return false
+	}
+	status.ClearAll(c)
+	status.SetMessageAfterRedraw("Took over " + filepath.Base(filename))
+	return true
+}
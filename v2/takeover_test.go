@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestTakeoverHelperProcess is not a real test. It is started as a separate process by the takeover tests,
+// where it plays the part of the editor that has the file open.
+func TestTakeoverHelperProcess(t *testing.T) {
+	lockFilename := os.Getenv("O_TAKEOVER_LOCKFILE")
+	if lockFilename == "" {
+		return
+	}
+	filename := os.Getenv("O_TAKEOVER_FILE")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+
+	lk := NewLockKeeper(lockFilename)
+	lk.Lock(filename)
+	lk.Save()
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	e.SetLine(0, "changed by the first instance")
+	fmt.Println("ready")
+
+	select {
+	case <-sigChan:
+	case <-time.After(10 * time.Second):
+		fmt.Println("no signal")
+		os.Exit(1)
+	}
+	switch {
+	case !takeoverRequestedFor(lk, filename):
+		fmt.Println("no request")
+	case os.Getenv("O_TAKEOVER_ACCEPT") == "1":
+		err := e.AcceptTakeover(nil, nil, lk, filename)
+		fmt.Printf("released %v, read-only %v\n", err == nil, e.readOnly && e.lockReleased)
+	default:
+		answerTakeover(lk)
+		fmt.Println("kept")
+	}
+	// Keep running until the test is done
+	io.Copy(io.Discard, os.Stdin)
+	os.Exit(0)
+}
+
+// startTakeoverHelper starts another process that locks the given file, and waits until it is ready
+func startTakeoverHelper(t *testing.T, lockFilename, filename string, accept bool) (*exec.Cmd, *bufio.Reader) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestTakeoverHelperProcess$")
+	cmd.Env = append(os.Environ(), "O_TAKEOVER_LOCKFILE="+lockFilename, "O_TAKEOVER_FILE="+filename)
+	if accept {
+		cmd.Env = append(cmd.Env, "O_TAKEOVER_ACCEPT=1")
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	r := bufio.NewReader(stdout)
+	if line, _ := r.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("expected the other process to be ready, got %q", line)
+	}
+	return cmd, r
+}
+
+func TestTakeover(t *testing.T) {
+	dir := t.TempDir()
+	lockFilename := filepath.Join(dir, "lockfile.txt")
+	filename := filepath.Join(dir, "shared.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd, r := startTakeoverHelper(t, lockFilename, filename, true)
+
+	lk := NewLockKeeper(lockFilename)
+	if err := lk.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if lk.Lock(filename) == nil || lk.Owner(filename) != cmd.Process.Pid {
+		t.Fatalf("expected the file to be locked by process %d, got %d", cmd.Process.Pid, lk.Owner(filename))
+	}
+	if !runningEditor(cmd.Process.Pid) {
+		t.Fatal("expected the other process to be detected as a running editor")
+	}
+	if err := RequestTakeover(lk, filename, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := r.ReadString('\n'); line != "released true, read-only true\n" {
+		t.Errorf("expected the other process to release the file and become read-only, got %q", line)
+	}
+	if lk.IsLocked(filename) {
+		t.Error("expected the file to be unlocked")
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "changed by the first instance\n" {
+		t.Errorf("expected the other process to save the file first, got %q", data)
+	}
+	if exists(takeoverRequestFilename(lockFilename, cmd.Process.Pid)) {
+		t.Error("expected the takeover request to be removed")
+	}
+}
+
+func TestTakeoverDeclined(t *testing.T) {
+	dir := t.TempDir()
+	lockFilename := filepath.Join(dir, "lockfile.txt")
+	filename := filepath.Join(dir, "shared.txt")
+	if err := os.WriteFile(filename, []byte("original\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd, r := startTakeoverHelper(t, lockFilename, filename, false)
+
+	lk := NewLockKeeper(lockFilename)
+	if err := lk.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RequestTakeover(lk, filename, 10*time.Second); !errors.Is(err, errTakeoverDeclined) {
+		t.Errorf("expected the takeover to be declined, got %v", err)
+	}
+	if line, _ := r.ReadString('\n'); strings.TrimSpace(line) != "kept" {
+		t.Errorf("expected the other process to keep the file, got %q", line)
+	}
+	if !lk.IsLocked(filename) || lk.Owner(filename) != cmd.Process.Pid {
+		t.Error("expected the file to still be locked by the other process")
+	}
+}
+
+func TestLockOwnerCompatibility(t *testing.T) {
+	// Lock files that were written without the process IDs can still be loaded
+	lockFilename := filepath.Join(t.TempDir(), "lockfile.txt")
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(map[string]time.Time{"/tmp/a.txt": time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockFilename, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lk := NewLockKeeper(lockFilename)
+	if err := lk.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !lk.IsLocked("/tmp/a.txt") || lk.Owner("/tmp/a.txt") != 0 {
+		t.Error("expected the lock to be loaded, without an owner")
+	}
+	if runningEditor(0) || runningEditor(os.Getpid()) {
+		t.Error("did not expect an unknown process or this process to count as another running editor")
+	}
+}
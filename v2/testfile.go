@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// testFileRule describes how to find the test file for a source file, and the other way around,
+// for one programming language
+type testFileRule struct {
+	isTestFile      func(filename string) bool                         // is this a test file?
+	testFilenames   func(sourceFilename string) []string               // possible test filenames, the preferred one first
+	sourceFilenames func(testFilename string) []string                 // possible source filenames, the preferred one first
+	skeleton        func(sourceFilename, sourceContents string) string // the initial contents of a new test file
+}
+
+var errNoTestFileRule = errors.New("no test file convention for this file type")
+
+// testFileRules are the test file conventions for Go, Rust and Python
+var testFileRules = map[mode.Mode]testFileRule{
+	mode.Go: {
+		isTestFile: func(filename string) bool {
+			return strings.HasSuffix(filename, "_test.go")
+		},
+		testFilenames: func(sourceFilename string) []string {
+			return []string{strings.TrimSuffix(sourceFilename, ".go") + "_test.go"}
+		},
+		sourceFilenames: func(testFilename string) []string {
+			return []string{strings.TrimSuffix(testFilename, "_test.go") + ".go"}
+		},
+		skeleton: goTestSkeleton,
+	},
+	mode.Rust: {
+		isTestFile: func(filename string) bool {
+			return filepath.Base(filepath.Dir(filename)) == "tests"
+		},
+		testFilenames: func(sourceFilename string) []string {
+			return []string{filepath.Join(rustCrateDir(sourceFilename), "tests", filepath.Base(sourceFilename))}
+		},
+		sourceFilenames: func(testFilename string) []string {
+			crateDir := filepath.Dir(filepath.Dir(testFilename))
+			name := strings.TrimSuffix(filepath.Base(testFilename), ".rs")
+			return []string{
+				filepath.Join(crateDir, "src", name+".rs"),
+				filepath.Join(crateDir, "src", name, "mod.rs"),
+			}
+		},
+		skeleton: rustTestSkeleton,
+	},
+	mode.Python: {
+		isTestFile: func(filename string) bool {
+			base := filepath.Base(filename)
+			return strings.HasPrefix(base, "test_") || strings.HasSuffix(base, "_test.py")
+		},
+		testFilenames: func(sourceFilename string) []string {
+			dir, base := filepath.Split(sourceFilename)
+			return []string{
+				filepath.Join(dir, "tests", "test_"+base),
+				filepath.Join(filepath.Dir(filepath.Clean(dir)), "tests", "test_"+base),
+				filepath.Join(dir, "test_"+base),
+			}
+		},
+		sourceFilenames: func(testFilename string) []string {
+			dir, base := filepath.Split(testFilename)
+			base = strings.TrimPrefix(base, "test_")
+			base = strings.TrimSuffix(base, "_test.py")
+			if !strings.HasSuffix(base, ".py") {
+				base += ".py"
+			}
+			return []string{
+				filepath.Join(dir, base),
+				filepath.Join(filepath.Dir(filepath.Clean(dir)), base),
+			}
+		},
+		skeleton: pythonTestSkeleton,
+	},
+}
+
+// testFileCounterparts returns the possible counterpart filenames for the given filename, the preferred one first.
+// Also returns true if the counterparts are test files (and false if they are source files).
+func testFileCounterparts(m mode.Mode, filename string) ([]string, bool, error) {
+	rule, ok := testFileRules[m]
+	if !ok {
+		return nil, false, errNoTestFileRule
+	}
+	if rule.isTestFile(filename) {
+		return rule.sourceFilenames(filename), false, nil
+	}
+	return rule.testFilenames(filename), true, nil
+}
+
+// camelCaseName converts a base filename like "foo_bar.go" to "FooBar"
+func camelCaseName(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	return sb.String()
+}
+
+// snakeCaseName converts a base filename like "foo-bar.rs" to "foo_bar"
+func snakeCaseName(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// goTestSkeleton returns a Go test file for the package of the given source file
+func goTestSkeleton(sourceFilename, sourceContents string) string {
+	packageName := goPackageName(sourceContents)
+	if packageName == "" {
+		packageName = "main"
+	}
+	return "package " + packageName + "\n\nimport (\n\t\"testing\"\n)\n\nfunc Test" + camelCaseName(sourceFilename) + "(t *testing.T) {\n}\n"
+}
+
+// rustCrateDir returns the directory that contains the "src" directory of the given Rust source file.
+// If there is no "src" directory, the directory of the source file is returned.
+func rustCrateDir(sourceFilename string) string {
+	for dir := filepath.Dir(sourceFilename); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == "src" {
+			return filepath.Dir(dir)
+		}
+	}
+	return filepath.Dir(sourceFilename)
+}
+
+// rustCrateName returns the package name from Cargo.toml in the given directory, as used in Rust code
+func rustCrateName(crateDir string) string {
+	data, err := os.ReadFile(filepath.Join(crateDir, "Cargo.toml"))
+	if err != nil {
+		return ""
+	}
+	inPackage := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inPackage = line == "[package]"
+			continue
+		}
+		if !inPackage || !strings.HasPrefix(line, "name") {
+			continue
+		}
+		if _, value, ok := strings.Cut(line, "="); ok {
+			return strings.ReplaceAll(strings.Trim(strings.TrimSpace(value), `"'`), "-", "_")
+		}
+	}
+	return ""
+}
+
+// rustTestSkeleton returns an integration test file for the crate of the given Rust source file
+func rustTestSkeleton(sourceFilename, _ string) string {
+	name := snakeCaseName(sourceFilename)
+	var sb strings.Builder
+	if crateName := rustCrateName(rustCrateDir(sourceFilename)); crateName != "" && name != "lib" && name != "main" {
+		sb.WriteString("use " + crateName + "::" + name + ";\n\n")
+	}
+	sb.WriteString("#[test]\nfn test_" + name + "() {\n}\n")
+	return sb.String()
+}
+
+// pythonTestSkeleton returns a pytest file for the module of the given Python source file
+func pythonTestSkeleton(sourceFilename, _ string) string {
+	name := snakeCaseName(sourceFilename)
+	return "import " + name + "\n\n\ndef test_" + name + "():\n    pass\n"
+}
+
+// rustTestModule returns the line of the #[cfg(test)] module in the current file, if there is one
+// and the cursor is above it. When the cursor is already in the module, false is returned.
+func (e *Editor) rustTestModule() (LineIndex, bool) {
+	for i := 0; i < e.Len(); i++ {
+		if strings.HasPrefix(strings.TrimSpace(e.Line(LineIndex(i))), "#[cfg(test)]") {
+			return LineIndex(i), e.LineIndex() < LineIndex(i)
+		}
+	}
+	return 0, false
+}
+
+// ToggleTestFile switches to the test file for the current source file, or to the source file for the current test file.
+// For Rust, the #[cfg(test)] module in the current file is jumped to first, if there is one,
+// and the integration test file in the tests directory when the cursor is already in the module.
+// If the test file does not exist, the user is asked if it should be created.
+func (e *Editor) ToggleTestFile(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	counterparts, toTest, err := testFileCounterparts(e.mode, absFilename)
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+
+	// Rust unit tests are often placed in a module in the same file
+	if e.mode == mode.Rust && toTest {
+		if y, ok := e.rustTestModule(); ok {
+			e.redraw, _ = e.GoTo(y, c, status)
+			e.redrawCursor = true
+			return
+		}
+	}
+
+	// Switch to the first counterpart that exists
+	for _, filename := range counterparts {
+		if exists(filename) {
+			if err := e.Switch(c, tty, status, fileLock, filename, false); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+			}
+			return
+		}
+	}
+
+	if !toTest {
+		status.SetErrorMessage("No corresponding source file")
+		status.Show(c, e)
+		return
+	}
+
+	// Create the test file in the first directory that exists, or else in the preferred location
+	testFilename := counterparts[0]
+	for _, filename := range counterparts {
+		if isDir(filepath.Dir(filename)) {
+			testFilename = filename
+			break
+		}
+	}
+	relFilename := testFilename
+	if rel, err := filepath.Rel(filepath.Dir(absFilename), testFilename); err == nil {
+		relFilename = rel
+	}
+	answer, ok := e.UserInput(c, tty, status, "Create "+relFilename+"? (y/n)", []string{"y", "n"}, false)
+	if !ok || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		status.Clear(c)
+		status.SetMessage("No test file was created")
+		status.Show(c, e)
+		return
+	}
+	skeleton := testFileRules[e.mode].skeleton(absFilename, e.String())
+	if err := os.MkdirAll(filepath.Dir(testFilename), 0o755); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	if err := os.WriteFile(testFilename, []byte(skeleton), 0o644); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	if err := e.Switch(c, tty, status, fileLock, testFilename, false); err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+	}
+}
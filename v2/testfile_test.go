@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestTestFileCounterparts(t *testing.T) {
+	cases := []struct {
+		m        mode.Mode
+		filename string
+		expected string // the preferred counterpart
+		toTest   bool
+	}{
+		{mode.Go, "/p/foo.go", "/p/foo_test.go", true},
+		{mode.Go, "/p/foo_test.go", "/p/foo.go", false},
+		{mode.Rust, "/p/src/foo.rs", "/p/tests/foo.rs", true},
+		{mode.Rust, "/p/src/net/foo.rs", "/p/tests/foo.rs", true},
+		{mode.Rust, "/p/tests/foo.rs", "/p/src/foo.rs", false},
+		{mode.Rust, "/p/foo.rs", "/p/tests/foo.rs", true},
+		{mode.Python, "/p/foo.py", "/p/tests/test_foo.py", true},
+		{mode.Python, "/p/tests/test_foo.py", "/p/tests/foo.py", false},
+		{mode.Python, "/p/foo_test.py", "/p/foo.py", false},
+	}
+	for _, c := range cases {
+		counterparts, toTest, err := testFileCounterparts(c.m, c.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counterparts[0] != c.expected || toTest != c.toTest {
+			t.Errorf("%s: expected %s (to test: %v), got %s (to test: %v)", c.filename, c.expected, c.toTest, counterparts[0], toTest)
+		}
+	}
+	if _, _, err := testFileCounterparts(mode.Markdown, "/p/README.md"); err != errNoTestFileRule {
+		t.Errorf("expected no test file rule for Markdown, got %v", err)
+	}
+}
+
+func TestTestFileSkeletons(t *testing.T) {
+	if s := goTestSkeleton("/p/foo_bar.go", "// comment\npackage server\n"); s != "package server\n\nimport (\n\t\"testing\"\n)\n\nfunc TestFooBar(t *testing.T) {\n}\n" {
+		t.Errorf("unexpected Go skeleton: %q", s)
+	}
+	if s := pythonTestSkeleton("/p/foo.py", ""); s != "import foo\n\n\ndef test_foo():\n    pass\n" {
+		t.Errorf("unexpected Python skeleton: %q", s)
+	}
+	crateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(crateDir, "Cargo.toml"), []byte("[package]\nname = \"my-crate\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s := rustTestSkeleton(filepath.Join(crateDir, "src", "parser.rs"), ""); s != "use my_crate::parser;\n\n#[test]\nfn test_parser() {\n}\n" {
+		t.Errorf("unexpected Rust skeleton: %q", s)
+	}
+}
+
+func TestRustTestModule(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Rust
+	e.LoadBytes([]byte("fn add(a: i32, b: i32) -> i32 {\n    a + b\n}\n\n#[cfg(test)]\nmod tests {\n    #[test]\n    fn it_adds() {}\n}\n"))
+	if y, ok := e.rustTestModule(); !ok || y != 4 {
+		t.Errorf("expected the test module at line index 4, got %d (%v)", y, ok)
+	}
+	// When the cursor is in the test module, the integration test file should be used instead
+	e.pos.sy = 6
+	if _, ok := e.rustTestModule(); ok {
+		t.Error("expected no test module to jump to when the cursor is already in it")
+	}
+	e.LoadBytes([]byte("fn main() {}\n"))
+	if _, ok := e.rustTestModule(); ok {
+		t.Error("expected no test module in a file without one")
+	}
+}
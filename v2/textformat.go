@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// utf8BOM is the UTF-8 byte order mark
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// utf16LEBOM and utf16BEBOM are the UTF-16 byte order marks, for little-endian and big-endian
+var (
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// TextFormat is the line endings, byte order mark and encoding that a text file is saved with.
+// The editor contents are always UTF-8 with LF line endings.
+type TextFormat struct {
+	crlf    bool // use \r\n line endings instead of \n, or for the changed lines, if the line endings are mixed
+	mixed   bool // the file has both CRLF and LF line endings, which are kept for the lines that are not changed
+	bom     bool // start the file with a UTF-8 byte order mark
+	latin1  bool // encode the file as Latin-1 (ISO-8859-1) instead of UTF-8
+	utf16   bool // encode the file as UTF-16 with a byte order mark, instead of UTF-8
+	utf16BE bool // use big-endian instead of little-endian UTF-16
+}
+
+// String returns a short description of the text format, like "UTF-8 LF"
+func (tf TextFormat) String() string {
+	encoding := "UTF-8"
+	if tf.utf16 && tf.utf16BE {
+		encoding = "UTF-16BE"
+	} else if tf.utf16 {
+		encoding = "UTF-16LE"
+	} else if tf.latin1 {
+		encoding = "Latin-1"
+	} else if tf.bom {
+		encoding = "UTF-8 BOM"
+	}
+	lineEndings := " LF"
+	if tf.crlf {
+		lineEndings = " CRLF"
+	}
+	if tf.mixed {
+		lineEndings += " (mixed)"
+	}
+	return encoding + lineEndings
+}
+
+// isLatin1Text checks if the given data is not valid UTF-8, but looks like text encoded as Latin-1.
+// NUL, most control characters and the C1 control range 0x80 - 0x9f are not expected in such text.
+func isLatin1Text(data []byte) bool {
+	if utf8.Valid(data) {
+		return false
+	}
+	for _, b := range data {
+		switch {
+		case b == '\t', b == '\n', b == '\r', b == '\f', b == 0x1b:
+		case b < 0x20, b == 0x7f, b >= 0x80 && b < 0xa0:
+			return false
+		}
+	}
+	return true
+}
+
+// detectTextFormat detects the line endings, byte order mark and encoding of the given data.
+// UTF-16 is only detected if the data starts with a byte order mark.
+// CRLF is detected if at least half of the line endings are CRLF.
+// The line endings are mixed if some, but not all, of the line endings are CRLF.
+func detectTextFormat(data []byte) TextFormat {
+	var tf TextFormat
+	switch {
+	case bytes.HasPrefix(data, utf16LEBOM):
+		tf.utf16 = true
+		data = utf16ToUTF8(data, false)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		tf.utf16 = true
+		tf.utf16BE = true
+		data = utf16ToUTF8(data, true)
+	default:
+		tf.bom = bytes.HasPrefix(data, utf8BOM)
+		tf.latin1 = !tf.bom && isLatin1Text(data)
+	}
+	crlfCount := bytes.Count(data, []byte{'\r', '\n'})
+	lfCount := bytes.Count(data, []byte{'\n'})
+	tf.crlf = crlfCount > 0 && crlfCount*2 >= lfCount
+	tf.mixed = crlfCount > 0 && crlfCount < lfCount
+	return tf
+}
+
+// convertToLF replaces CRLF and lone CR line endings with LF.
+// Returns the converted data and the number of line endings that were changed.
+func convertToLF(data []byte) ([]byte, int) {
+	converted := make([]byte, 0, len(data))
+	count := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\r' {
+			converted = append(converted, data[i])
+			continue
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			i++
+		}
+		converted = append(converted, '\n')
+		count++
+	}
+	return converted, count
+}
+
+// convertToCRLF replaces LF and lone CR line endings with CRLF.
+// Returns the converted data and the number of line endings that were changed.
+func convertToCRLF(data []byte) ([]byte, int) {
+	converted := make([]byte, 0, len(data)+bytes.Count(data, []byte{'\n'}))
+	count := 0
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			converted = append(converted, '\r', '\n')
+			i++
+		case data[i] == '\r' || data[i] == '\n':
+			converted = append(converted, '\r', '\n')
+			count++
+		default:
+			converted = append(converted, data[i])
+		}
+	}
+	return converted, count
+}
+
+// latin1ToUTF8 converts Latin-1 encoded data to UTF-8. Data that is already valid UTF-8 is returned as it is.
+// Returns the converted data and the number of bytes that were converted.
+func latin1ToUTF8(data []byte) ([]byte, int) {
+	if utf8.Valid(data) {
+		return data, 0
+	}
+	converted := make([]byte, 0, len(data)*2)
+	count := 0
+	for _, b := range data {
+		if b < utf8.RuneSelf {
+			converted = append(converted, b)
+			continue
+		}
+		converted = utf8.AppendRune(converted, rune(b))
+		count++
+	}
+	return converted, count
+}
+
+// utf8ToLatin1 converts UTF-8 encoded data to Latin-1.
+// An error is returned if the data contains runes that can not be encoded as Latin-1.
+func utf8ToLatin1(data []byte) ([]byte, error) {
+	converted := make([]byte, 0, len(data))
+	for _, r := range string(data) {
+		if r > 0xff {
+			return data, fmt.Errorf("%c (%U) can not be saved as Latin-1", r, r)
+		}
+		converted = append(converted, byte(r))
+	}
+	return converted, nil
+}
+
+// utf16ToUTF8 converts UTF-16 encoded data, with or without a byte order mark, to UTF-8.
+// Invalid surrogate pairs and a trailing odd byte are converted to the replacement character.
+func utf16ToUTF8(data []byte, bigEndian bool) []byte {
+	if bytes.HasPrefix(data, utf16LEBOM) || bytes.HasPrefix(data, utf16BEBOM) {
+		data = data[2:]
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	converted := make([]byte, 0, len(data))
+	for _, r := range utf16.Decode(units) {
+		converted = utf8.AppendRune(converted, r)
+	}
+	if len(data)%2 == 1 {
+		converted = utf8.AppendRune(converted, utf8.RuneError)
+	}
+	return converted
+}
+
+// utf8ToUTF16 converts UTF-8 encoded data to UTF-16, starting with a byte order mark
+func utf8ToUTF16(data []byte, bigEndian bool) []byte {
+	var order binary.ByteOrder = binary.LittleEndian
+	bom := utf16LEBOM
+	if bigEndian {
+		order = binary.BigEndian
+		bom = utf16BEBOM
+	}
+	units := utf16.Encode([]rune(string(data)))
+	converted := make([]byte, len(bom)+len(units)*2)
+	copy(converted, bom)
+	for i, unit := range units {
+		order.PutUint16(converted[len(bom)+i*2:], unit)
+	}
+	return converted
+}
+
+// removeBOM removes the UTF-8 byte order mark, if there is one.
+// Returns the data and the number of bytes that were removed.
+func removeBOM(data []byte) ([]byte, int) {
+	if !bytes.HasPrefix(data, utf8BOM) {
+		return data, 0
+	}
+	return data[len(utf8BOM):], len(utf8BOM)
+}
+
+// addBOM adds a UTF-8 byte order mark, if there is not one already.
+// Returns the data and the number of bytes that were added.
+func addBOM(data []byte) ([]byte, int) {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return data, 0
+	}
+	return append(append([]byte{}, utf8BOM...), data...), len(utf8BOM)
+}
+
+// Decode converts data in this text format to UTF-8 without a byte order mark.
+// The line endings are kept as they are.
+func (tf TextFormat) Decode(data []byte) []byte {
+	if tf.utf16 {
+		return utf16ToUTF8(data, tf.utf16BE)
+	}
+	if tf.bom {
+		data, _ = removeBOM(data)
+	}
+	if tf.latin1 {
+		data, _ = latin1ToUTF8(data)
+	}
+	return data
+}
+
+// Encode converts UTF-8 data with LF line endings to this text format
+func (tf TextFormat) Encode(data []byte) ([]byte, error) {
+	if tf.latin1 {
+		var err error
+		if data, err = utf8ToLatin1(data); err != nil {
+			return data, err
+		}
+	}
+	if tf.crlf {
+		data, _ = convertToCRLF(data)
+	}
+	if tf.utf16 {
+		return utf8ToUTF16(data, tf.utf16BE), nil
+	}
+	if tf.bom && !tf.latin1 {
+		data, _ = addBOM(data)
+	}
+	return data, nil
+}
+
+// textFormatConversion is an explicit conversion of the line endings, byte order mark or encoding
+type textFormatConversion struct {
+	title   string                   // the menu title
+	applies func(tf TextFormat) bool // can the conversion be applied to a file with this format?
+	apply   func(tf *TextFormat)     // change the format
+	count   func(data []byte) int    // the number of affected lines or bytes, given the data as it would be saved
+	unit    string                   // "line" or "byte"
+}
+
+// textFormatConversions are the conversions that can be selected from the menu
+var textFormatConversions = []textFormatConversion{
+	{
+		title:   "Convert to LF",
+		applies: func(tf TextFormat) bool { return tf.crlf },
+		apply:   func(tf *TextFormat) { tf.crlf, tf.mixed = false, false },
+		count:   func(data []byte) int { _, n := convertToLF(data); return n },
+		unit:    "line",
+	},
+	{
+		title:   "Convert to CRLF",
+		applies: func(tf TextFormat) bool { return !tf.crlf },
+		apply:   func(tf *TextFormat) { tf.crlf, tf.mixed = true, false },
+		count:   func(data []byte) int { _, n := convertToCRLF(data); return n },
+		unit:    "line",
+	},
+	{
+		title:   "Normalize line endings to CRLF",
+		applies: func(tf TextFormat) bool { return tf.mixed && tf.crlf },
+		apply:   func(tf *TextFormat) { tf.mixed = false },
+		count:   func(data []byte) int { _, n := convertToCRLF(data); return n },
+		unit:    "line",
+	},
+	{
+		title:   "Normalize line endings to LF",
+		applies: func(tf TextFormat) bool { return tf.mixed && !tf.crlf },
+		apply:   func(tf *TextFormat) { tf.mixed = false },
+		count:   func(data []byte) int { _, n := convertToLF(data); return n },
+		unit:    "line",
+	},
+	{
+		title:   "Convert to UTF-8 (from Latin-1)",
+		applies: func(tf TextFormat) bool { return tf.latin1 },
+		apply:   func(tf *TextFormat) { tf.latin1 = false },
+		count:   func(data []byte) int { _, n := latin1ToUTF8(data); return n },
+		unit:    "byte",
+	},
+	{
+		title:   "Convert to UTF-8 (from UTF-16)",
+		applies: func(tf TextFormat) bool { return tf.utf16 },
+		apply:   func(tf *TextFormat) { tf.utf16 = false },
+		count:   func(data []byte) int { return utf8.RuneCount(utf16ToUTF8(data, bytes.HasPrefix(data, utf16BEBOM))) },
+		unit:    "character",
+	},
+	{
+		title:   "Remove BOM",
+		applies: func(tf TextFormat) bool { return tf.bom },
+		apply:   func(tf *TextFormat) { tf.bom = false },
+		count:   func(data []byte) int { _, n := removeBOM(data); return n },
+		unit:    "byte",
+	},
+	{
+		title:   "Add BOM",
+		applies: func(tf TextFormat) bool { return !tf.bom && !tf.latin1 && !tf.utf16 },
+		apply:   func(tf *TextFormat) { tf.bom = true },
+		count:   func(data []byte) int { _, n := addBOM(data); return n },
+		unit:    "byte",
+	},
+}
+
+// ConvertTextFormat shows how many lines or bytes the given conversion affects, and asks the user before applying it.
+// The conversion changes how the file is saved, so the contents are marked as changed.
+func (e *Editor) ConvertTextFormat(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, conversion textFormatConversion) {
+	data, _, err := e.encode(e.String())
+	if err != nil {
+		status.SetError(err)
+		status.Show(c, e)
+		return
+	}
+	n := conversion.count(data)
+	plural := ""
+	if n != 1 {
+		plural = "s"
+	}
+	if n > 0 {
+		prompt := fmt.Sprintf("%s: %d %s%s affected. Continue? (y/n)", conversion.title, n, conversion.unit, plural)
+		answer, ok := e.UserInput(c, tty, status, prompt, []string{"y", "n"}, false)
+		if !ok || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			status.Clear(c)
+			status.SetMessage("Not converted")
+			status.Show(c, e)
+			return
+		}
+	}
+	conversion.apply(&e.textFormat)
+	e.changed = true
+	e.redraw = true
+	status.SetMessageAfterRedraw(fmt.Sprintf("%s (%d %s%s), will be saved as %s", conversion.title, n, conversion.unit, plural, e.textFormat))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertToLF(t *testing.T) {
+	tests := []struct {
+		input, expected string
+		count           int
+	}{
+		{"", "", 0},
+		{"a\nb\n", "a\nb\n", 0},
+		{"a\r\nb\r\n", "a\nb\n", 2},
+		{"a\rb\r", "a\nb\n", 2},
+		{"a\r\nb\nc\rd", "a\nb\nc\nd", 2},
+		{"\r\r\n", "\n\n", 2},
+		{"æ\r\nø", "æ\nø", 1},
+	}
+	for _, test := range tests {
+		got, count := convertToLF([]byte(test.input))
+		if string(got) != test.expected || count != test.count {
+			t.Errorf("convertToLF(%q) = %q, %d, expected %q, %d", test.input, got, count, test.expected, test.count)
+		}
+		// Converting again should not change anything
+		again, count := convertToLF(got)
+		if !bytes.Equal(again, got) || count != 0 {
+			t.Errorf("convertToLF is not idempotent for %q", test.input)
+		}
+	}
+}
+
+func TestConvertToCRLF(t *testing.T) {
+	tests := []struct {
+		input, expected string
+		count           int
+	}{
+		{"", "", 0},
+		{"a\r\nb\r\n", "a\r\nb\r\n", 0},
+		{"a\nb\n", "a\r\nb\r\n", 2},
+		{"a\rb\r", "a\r\nb\r\n", 2},
+		{"a\r\nb\nc\rd", "a\r\nb\r\nc\r\nd", 2},
+		{"\n\r", "\r\n\r\n", 2},
+		{"\r", "\r\n", 1},
+	}
+	for _, test := range tests {
+		got, count := convertToCRLF([]byte(test.input))
+		if string(got) != test.expected || count != test.count {
+			t.Errorf("convertToCRLF(%q) = %q, %d, expected %q, %d", test.input, got, count, test.expected, test.count)
+		}
+		// Converting again should not change anything
+		again, count := convertToCRLF(got)
+		if !bytes.Equal(again, got) || count != 0 {
+			t.Errorf("convertToCRLF is not idempotent for %q", test.input)
+		}
+	}
+}
+
+func TestLatin1(t *testing.T) {
+	latin1 := []byte{'b', 'l', 0xe5, 'b', 0xe6, 'r', '\n'}
+	if !isLatin1Text(latin1) {
+		t.Error("expected Latin-1 text to be detected")
+	}
+	utf8Data, count := latin1ToUTF8(latin1)
+	if string(utf8Data) != "blåbær\n" || count != 2 {
+		t.Errorf("latin1ToUTF8 returned %q, %d", utf8Data, count)
+	}
+	// Data that is already UTF-8 should not be converted again
+	again, count := latin1ToUTF8(utf8Data)
+	if !bytes.Equal(again, utf8Data) || count != 0 {
+		t.Error("latin1ToUTF8 is not idempotent")
+	}
+	back, err := utf8ToLatin1(utf8Data)
+	if err != nil || !bytes.Equal(back, latin1) {
+		t.Errorf("utf8ToLatin1 returned %q, %v", back, err)
+	}
+	if _, err := utf8ToLatin1([]byte("€")); err == nil {
+		t.Error("expected an error when saving € as Latin-1")
+	}
+	for _, data := range [][]byte{[]byte("blåbær"), []byte("ascii"), {0, 1, 2, 0xff}, {'a', 0x9b, 'b'}} {
+		if isLatin1Text(data) {
+			t.Errorf("did not expect %q to be detected as Latin-1", data)
+		}
+	}
+}
+
+func TestBOM(t *testing.T) {
+	withBOM, count := addBOM([]byte("abc"))
+	if !bytes.Equal(withBOM, []byte("\xef\xbb\xbfabc")) || count != 3 {
+		t.Errorf("addBOM returned %q, %d", withBOM, count)
+	}
+	if again, count := addBOM(withBOM); !bytes.Equal(again, withBOM) || count != 0 {
+		t.Error("addBOM is not idempotent")
+	}
+	withoutBOM, count := removeBOM(withBOM)
+	if string(withoutBOM) != "abc" || count != 3 {
+		t.Errorf("removeBOM returned %q, %d", withoutBOM, count)
+	}
+	if again, count := removeBOM(withoutBOM); string(again) != "abc" || count != 0 {
+		t.Error("removeBOM is not idempotent")
+	}
+}
+
+func TestTextFormatRoundTrip(t *testing.T) {
+	for _, original := range [][]byte{
+		[]byte("a\nb\n"),
+		[]byte("a\r\nb\r\n"),
+		[]byte("\xef\xbb\xbfa\r\nb\r\n"),
+		{'b', 'l', 0xe5, '\r', '\n', 0xe6, '\r', '\n'},
+		{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0, 0xe5, 0, '\r', 0, '\n', 0},
+		{0xfe, 0xff, 0, 'a', 0, '\n', 0xd8, 0x3d, 0xde, 0x00, 0, '\n'},
+	} {
+		tf := detectTextFormat(original)
+		decoded, _ := convertToLF(tf.Decode(original))
+		encoded, err := tf.Encode(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, original) {
+			t.Errorf("%s: got %q, expected %q", tf, encoded, original)
+		}
+	}
+	if tf := detectTextFormat([]byte("a\r\nb\nc\n")); tf.crlf {
+		t.Error("expected LF to be detected when most lines end with LF")
+	}
+	if tf := detectTextFormat([]byte("\xef\xbb\xbfa\n")); tf.String() != "UTF-8 BOM LF" {
+		t.Errorf("got %s", tf)
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	le := []byte{0xff, 0xfe, 'h', 0, 'i', 0, '\n', 0, 0xac, 0x20, '\n', 0}
+	tf := detectTextFormat(le)
+	if !tf.utf16 || tf.utf16BE || tf.String() != "UTF-16LE LF" {
+		t.Errorf("expected UTF-16LE to be detected, got %s", tf)
+	}
+	if decoded := tf.Decode(le); string(decoded) != "hi\n€\n" {
+		t.Errorf("expected the data to be decoded to UTF-8, got %q", decoded)
+	}
+	be := utf8ToUTF16([]byte("😀\r\n"), true)
+	if tf := detectTextFormat(be); !tf.utf16BE || !tf.crlf {
+		t.Errorf("expected UTF-16BE with CRLF to be detected, got %s", tf)
+	}
+	if decoded := utf16ToUTF8(be, true); string(decoded) != "😀\r\n" {
+		t.Errorf("expected the surrogate pair to be decoded, got %q", decoded)
+	}
+	if decoded := utf16ToUTF8([]byte{'a', 0, 'b'}, false); string(decoded) != "a\uFFFD" {
+		t.Errorf("expected a trailing odd byte to be replaced, got %q", decoded)
+	}
+
+	// A UTF-16 file is loaded as text, and saved as UTF-16 again
+	filename := filepath.Join(t.TempDir(), "windows.txt")
+	if err := os.WriteFile(filename, le, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if _, err := e.Load(nil, nil, FilenameOrData{filename: filename}); err != nil {
+		t.Fatal(err)
+	}
+	if e.binaryFile || e.Line(1) != "€" {
+		t.Errorf("expected UTF-16 to be loaded as text, got %q", e.Line(1))
+	}
+	e.SetLine(0, "hello")
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filename); err != nil || !bytes.Equal(data, utf8ToUTF16([]byte("hello\n€\n"), false)) {
+		t.Errorf("expected the file to be saved as UTF-16LE, got %q", data)
+	}
+}
+
+func TestTextFormatConversionCounts(t *testing.T) {
+	data := []byte("a\nb\nc\n")
+	for _, conversion := range textFormatConversions {
+		if conversion.title == "Convert to CRLF" {
+			if n := conversion.count(data); n != 3 {
+				t.Errorf("expected 3 affected lines, got %d", n)
+			}
+			var tf TextFormat
+			conversion.apply(&tf)
+			if !tf.crlf {
+				t.Error("expected the CRLF conversion to be applied")
+			}
+		}
+	}
+}
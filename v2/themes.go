@@ -13,6 +13,32 @@ var (
 	initialLightBackground *bool
 )
 
+// plainAttributes turns off bold, underline, blink and reverse video. The canvas only outputs the attributes
+// of each rune when they change, without resetting the previous ones, so colors that follow bold,
+// underlined or reversed text must start with these.
+var plainAttributes = vt100.AttributeColor{22, 24, 25, 27}
+
+// hasTextAttributes checks if the given color also turns on bold, underline, blink or reverse video.
+// The numbers of a 24-bit color, like 38;2;r;g;b, are not text attributes.
+func hasTextAttributes(ac vt100.AttributeColor) bool {
+	for i := 0; i < len(ac); i++ {
+		if (ac[i] == 38 || ac[i] == 48) && i+1 < len(ac) && ac[i+1] == 2 {
+			i += 4
+			continue
+		}
+		if ac[i] >= 1 && ac[i] <= 9 {
+			return true
+		}
+	}
+	return false
+}
+
+// withPlainAttributes returns the given color, starting with the attributes that turn off bold, underline,
+// blink and reverse video
+func withPlainAttributes(ac vt100.AttributeColor) vt100.AttributeColor {
+	return append(append(vt100.AttributeColor{}, plainAttributes...), ac...)
+}
+
 // Theme contains iformation about:
 // * If the theme is light or dark
 // * If syntax highlighting should be enabled
@@ -94,6 +120,7 @@ type Theme struct {
 	DebugRegistersBackground    vt100.AttributeColor
 	DebugOutputBackground       vt100.AttributeColor
 	TableBackground             vt100.AttributeColor
+	CurrentLineBackground       vt100.AttributeColor
 	StatusMode                  bool
 	Light                       bool
 }
@@ -159,6 +186,7 @@ func NewDefaultTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.LightYellow,
 		TableBackground:             vt100.BackgroundDefault,
+		CurrentLineBackground:       vt100.BackgroundBlack,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.Red,
@@ -242,6 +270,7 @@ func NewSynthwaveTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.LightGray,
 		TableBackground:             vt100.BackgroundDefault,
+		CurrentLineBackground:       vt100.BackgroundBlack,
 		UnmatchedParenColor:         vt100.LightRed, // to really stand out
 		MenuTitleColor:              vt100.LightGray,
 		MenuArrowColor:              vt100.Magenta,
@@ -324,8 +353,9 @@ func NewRedBlackTheme() Theme {
 		TableColor:                  vt100.White,
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Red,
-		TableBackground:             vt100.BackgroundBlack, // Dark gray background, as opposed to vt100.BackgroundDefault
-		UnmatchedParenColor:         vt100.LightCyan,       // To really stand out
+		TableBackground:             vt100.BackgroundBlack,   // Dark gray background, as opposed to vt100.BackgroundDefault
+		CurrentLineBackground:       vt100.BackgroundDefault, // Black, as opposed to the dark gray background
+		UnmatchedParenColor:         vt100.LightCyan,         // To really stand out
 		MenuTitleColor:              vt100.LightRed,
 		MenuArrowColor:              vt100.Red,
 		MenuTextColor:               vt100.Gray,
@@ -408,6 +438,7 @@ func NewLightBlueEditTheme() Theme {
 		CheckboxColor:               vt100.White,
 		XColor:                      vt100.LightYellow,
 		TableBackground:             vt100.BackgroundBlue,
+		CurrentLineBackground:       vt100.BackgroundBlack,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.LightRed,
@@ -491,6 +522,7 @@ func NewDarkBlueEditTheme() Theme {
 		CheckboxColor:               vt100.White,
 		XColor:                      vt100.White,
 		TableBackground:             vt100.BackgroundBlue,
+		CurrentLineBackground:       vt100.BackgroundBlack,
 		UnmatchedParenColor:         vt100.LightRed,
 		MenuTitleColor:              vt100.LightYellow,
 		MenuArrowColor:              vt100.White,
@@ -573,6 +605,7 @@ func NewLightVSTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Blue,
 		TableBackground:             vt100.BackgroundDefault,
+		CurrentLineBackground:       vt100.BackgroundLightGray,
 		UnmatchedParenColor:         vt100.Red,
 		MenuTitleColor:              vt100.Blue,
 		MenuArrowColor:              vt100.Red,
@@ -655,6 +688,7 @@ func NewDarkVSTheme() Theme {
 		CheckboxColor:               vt100.Black,
 		XColor:                      vt100.Blue,
 		TableBackground:             vt100.DarkGray,
+		CurrentLineBackground:       vt100.BackgroundCyan,
 		UnmatchedParenColor:         vt100.Red,
 		MenuTitleColor:              vt100.Blue,
 		MenuArrowColor:              vt100.Red,
@@ -676,6 +710,70 @@ func NewDarkVSTheme() Theme {
 	}
 }
 
+// NewSynthwaveTrueColorTheme returns the Synthwave theme with 24-bit colors,
+// or the same as NewSynthwaveTheme if the terminal emulator does not support 24-bit colors
+func NewSynthwaveTrueColorTheme() Theme {
+	t := NewSynthwaveTheme()
+	if !envTrueColor {
+		return t
+	}
+	t.Foreground = trueColorNames["synthblue"]
+	t.SearchHighlight = trueColorNames["synthpink"]
+	t.MultiLineComment = trueColorNames["synthlavender"]
+	t.MultiLineString = trueColorNames["synthorange"]
+	t.Git = trueColorNames["synthcyan"]
+	t.String = "synthorange"
+	t.Keyword = "synthpink"
+	t.Comment = "synthlavender"
+	t.Type = "synthyellow"
+	t.Literal = "synthcyan"
+	t.Punctuation = "synthblue"
+	t.Plaintext = "synthcyan"
+	t.Tag = "synthcyan"
+	t.TextTag = "synthcyan"
+	t.TextAttrName = "synthcyan"
+	t.TextAttrValue = "synthcyan"
+	t.Decimal = "synthwhite"
+	t.Dollar = "synthpink"
+	t.Self = "synthwhite"
+	t.Class = "synthpink"
+	t.Private = "synthpink"
+	t.MarkdownTextColor = trueColorNames["synthblue"]
+	t.HeaderTextColor = trueColorNames["synthcyan"]
+	t.ListBulletColor = trueColorNames["synthpink"]
+	t.LinkColor = trueColorNames["synthpink"]
+	t.CommentColor = trueColorNames["synthlavender"]
+	t.MenuArrowColor = trueColorNames["synthpink"]
+	return t
+}
+
+// NewDarkVSTrueColorTheme returns the VS Dark theme with 24-bit colors,
+// or the same as NewDarkVSTheme if the terminal emulator does not support 24-bit colors
+func NewDarkVSTrueColorTheme() Theme {
+	t := NewDarkVSTheme()
+	if !envTrueColor {
+		return t
+	}
+	t.MultiLineComment = trueColorNames["vsgreen"]
+	t.MultiLineString = trueColorNames["vsred"]
+	t.Git = trueColorNames["vsblue"]
+	t.String = "vsred"
+	t.Keyword = "vsblue"
+	t.Comment = "vsgreen"
+	t.Type = "vsteal"
+	t.Literal = "vsnumber"
+	t.Decimal = "vsnumber"
+	t.Dollar = "vsred"
+	t.Star = "vsred"
+	t.Static = "vsred"
+	t.Self = "vsnumber"
+	t.Class = "vsteal"
+	t.AssemblyEnd = "vsred"
+	t.HeaderTextColor = trueColorNames["vsblue"]
+	t.CommentColor = trueColorNames["vsgreen"]
+	return t
+}
+
 // NewAmberTheme returns a theme where all text is amber / yellow
 func NewAmberTheme() Theme {
 	t := NewDefaultTheme()
@@ -703,6 +801,100 @@ func NewBlueTheme() Theme {
 	return t
 }
 
+// NewHighContrastTheme creates a theme with only white, black and yellow, where bold text is used for emphasis.
+// Search matches are also underlined and reversed, so that they do not rely on color alone.
+func NewHighContrastTheme() Theme {
+	var (
+		white      = withPlainAttributes(vt100.White)
+		yellow     = withPlainAttributes(vt100.LightYellow)
+		black      = withPlainAttributes(vt100.Black)
+		boldWhite  = vt100.NewAttributeColor("24", "27", "Bright", "97")
+		boldYellow = vt100.NewAttributeColor("24", "27", "Bright", "93")
+		boldBlack  = vt100.NewAttributeColor("24", "27", "Bright", "30")
+		reversed   = vt100.NewAttributeColor("22", "24", "Reverse", "93")
+		match      = vt100.NewAttributeColor("Bright", "Underscore", "Reverse", "93")
+	)
+	return Theme{
+		Name:                        "High contrast",
+		Light:                       false,
+		Foreground:                  white,
+		Background:                  vt100.BackgroundBlack,
+		StatusForeground:            boldBlack,
+		StatusBackground:            vt100.BackgroundYellow,
+		StatusErrorForeground:       vt100.NewAttributeColor("27", "Bright", "Underscore", "97"),
+		StatusErrorBackground:       vt100.BackgroundBlack,
+		SearchHighlight:             match,
+		MultiLineComment:            white,
+		MultiLineString:             yellow,
+		Git:                         yellow,
+		String:                      "lightyellow",
+		Keyword:                     "lightyellow",
+		Comment:                     "lightgray",
+		Type:                        "lightyellow",
+		Literal:                     "lightyellow",
+		Punctuation:                 "lightwhite",
+		Plaintext:                   "lightwhite",
+		Tag:                         "lightyellow",
+		TextTag:                     "lightwhite",
+		TextAttrName:                "lightwhite",
+		TextAttrValue:               "lightyellow",
+		Decimal:                     "lightyellow",
+		AndOr:                       "lightyellow",
+		Dollar:                      "lightyellow",
+		Star:                        "lightwhite",
+		Static:                      "lightyellow",
+		Self:                        "lightwhite",
+		Class:                       "lightyellow",
+		Private:                     "lightwhite",
+		Protected:                   "lightwhite",
+		Public:                      "lightwhite",
+		Whitespace:                  "",
+		AssemblyEnd:                 "lightyellow",
+		Mut:                         "lightyellow",
+		RainbowParenColors:          []vt100.AttributeColor{white, yellow},
+		MarkdownTextColor:           white,
+		HeaderBulletColor:           boldYellow,
+		HeaderTextColor:             boldYellow,
+		ListBulletColor:             boldYellow,
+		ListTextColor:               white,
+		ListCodeColor:               yellow,
+		CodeColor:                   yellow,
+		CodeBlockColor:              yellow,
+		ImageColor:                  yellow,
+		LinkColor:                   vt100.NewAttributeColor("22", "27", "Underscore", "93"),
+		QuoteColor:                  yellow,
+		QuoteTextColor:              white,
+		HTMLColor:                   white,
+		CommentColor:                white,
+		BoldColor:                   boldWhite,
+		ItalicsColor:                yellow,
+		StrikeColor:                 white,
+		TableColor:                  yellow,
+		CheckboxColor:               boldYellow,
+		XColor:                      boldYellow,
+		TableBackground:             vt100.BackgroundBlack,
+		CurrentLineBackground:       vt100.BackgroundBlue,
+		UnmatchedParenColor:         reversed,
+		MenuTitleColor:              boldYellow,
+		MenuArrowColor:              boldYellow,
+		MenuTextColor:               white,
+		MenuHighlightColor:          reversed,
+		MenuSelectedColor:           match,
+		ManSectionColor:             boldYellow,
+		ManSynopsisColor:            boldWhite,
+		BoxTextColor:                black,
+		BoxBackground:               vt100.BackgroundYellow,
+		BoxHighlight:                boldBlack,
+		DebugRunningBackground:      vt100.BackgroundYellow,
+		DebugStoppedBackground:      vt100.BackgroundYellow,
+		DebugRegistersBackground:    vt100.BackgroundYellow,
+		DebugOutputBackground:       vt100.BackgroundYellow,
+		DebugInstructionsForeground: black,
+		DebugInstructionsBackground: vt100.BackgroundYellow,
+		BoxUpperEdge:                black,
+	}
+}
+
 // NewNoColorDarkBackgroundTheme creates a new theme without colors or syntax highlighting
 func NewNoColorDarkBackgroundTheme() Theme {
 	return Theme{
@@ -764,6 +956,7 @@ func NewNoColorDarkBackgroundTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.White,
 		TableBackground:             vt100.BackgroundDefault,
+		CurrentLineBackground:       vt100.BackgroundDefault,
 		UnmatchedParenColor:         vt100.White,
 		MenuTitleColor:              vt100.White,
 		MenuArrowColor:              vt100.White,
@@ -846,6 +1039,7 @@ func NewNoColorLightBackgroundTheme() Theme {
 		CheckboxColor:               vt100.Default,
 		XColor:                      vt100.Black,
 		TableBackground:             vt100.BackgroundDefault,
+		CurrentLineBackground:       vt100.BackgroundDefault,
 		UnmatchedParenColor:         vt100.Black,
 		MenuTitleColor:              vt100.Black,
 		MenuArrowColor:              vt100.Black,
@@ -924,7 +1118,7 @@ func (e *Editor) setDefaultTheme() {
 
 // setSynthwaveTheme sets the synthwave-like colors
 func (e *Editor) setSynthwaveTheme() {
-	e.SetTheme(NewSynthwaveTheme())
+	e.SetTheme(NewSynthwaveTrueColorTheme())
 }
 
 // setVSTheme sets the VS theme
@@ -932,7 +1126,7 @@ func (e *Editor) setVSTheme() {
 	if initialLightBackground != nil && *initialLightBackground {
 		e.SetTheme(NewLightVSTheme())
 	} else {
-		e.SetTheme(NewDarkVSTheme())
+		e.SetTheme(NewDarkVSTrueColorTheme())
 	}
 }
 
@@ -985,3 +1179,8 @@ func (e *Editor) setGreenTheme() {
 func (e *Editor) setBlueTheme() {
 	e.SetTheme(NewBlueTheme())
 }
+
+// setHighContrastTheme sets a white, black and yellow theme
+func (e *Editor) setHighContrastTheme() {
+	e.SetTheme(NewHighContrastTheme())
+}
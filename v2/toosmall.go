@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xyproto/vt100"
+)
+
+// The smallest terminal size, in columns and rows, where the editor is usable.
+// Below this, only a message about the terminal being too small is drawn.
+const (
+	minTerminalWidth  = 40
+	minTerminalHeight = 8
+)
+
+// terminalTooSmall checks if the given canvas size is below the minimum usable size
+func terminalTooSmall(w, h uint) bool {
+	return w < minTerminalWidth || h < minTerminalHeight
+}
+
+// clamp returns x, but not less than low and not more than high.
+// If high is less than low, low is returned.
+func clamp(x, low, high int) int {
+	if x > high {
+		x = high
+	}
+	if x < low {
+		x = low
+	}
+	return x
+}
+
+// centeredX returns the column where a string of the given length should start,
+// to be centered on a line of the given width. Strings that are too long start at column 0.
+func centeredX(width, length int) uint {
+	return uint(clamp((width-length)/2, 0, width))
+}
+
+// fitString shortens the given string to at most width runes
+func fitString(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// tooSmallMessage returns the longest message about the terminal being too small that fits within the given width
+func tooSmallMessage(width int) string {
+	for _, msg := range []string{
+		fmt.Sprintf("terminal too small (need ≥ %dx%d)", minTerminalWidth, minTerminalHeight),
+		fmt.Sprintf("too small (%dx%d)", minTerminalWidth, minTerminalHeight),
+		"too small",
+	} {
+		if utf8.RuneCountInString(msg) <= width {
+			return msg
+		}
+	}
+	return fitString("!", width)
+}
+
+// clampWrapWidth returns the word wrap width to use after the terminal has been resized to the given width.
+// While the terminal is too small, the wrap width is kept, but not below the minimum usable width,
+// so that it is still sensible when the terminal is made larger again.
+func clampWrapWidth(wrapWidth, w int) int {
+	if w < minTerminalWidth {
+		return clamp(wrapWidth, minTerminalWidth, wrapWidth)
+	}
+	if w < wrapWidth || (wrapWidth < 80 && w >= 80) {
+		return w
+	}
+	return wrapWidth
+}
+
+// clampScreenY returns a new screen y position and y offset, so that the cursor is within the given number
+// of rows, while still being at the same line of the file
+func clampScreenY(sy, offsetY, rows int) (int, int) {
+	maxY := clamp(rows-1, 0, rows)
+	if sy > maxY {
+		offsetY += sy - maxY
+		sy = maxY
+	}
+	if sy < 0 {
+		sy = 0
+	}
+	return sy, offsetY
+}
+
+// DrawTooSmall clears the canvas and draws a centered message about the terminal being too small
+func (e *Editor) DrawTooSmall(c *vt100.Canvas) {
+	w, h := int(c.W()), int(c.H())
+	msg := tooSmallMessage(w)
+	blankLine := strings.Repeat(" ", w)
+	for y := 0; y < h; y++ {
+		c.Write(0, uint(y), e.Foreground, e.Background, blankLine)
+	}
+	c.Write(centeredX(w, utf8.RuneCountInString(msg)), uint(h/2), e.Foreground, e.Background, msg)
+	c.HideCursor()
+	c.Redraw()
+}
+
+// KeepCursorWithinCanvas scrolls the view if the cursor would be below the bottom of the canvas,
+// for instance after the terminal has been resized to be smaller
+func (e *Editor) KeepCursorWithinCanvas(c *vt100.Canvas) {
+	rows := int(c.H()) - e.topRows()
+	sy, offsetY := clampScreenY(e.pos.sy, e.pos.offsetY, rows)
+	if sy != e.pos.sy || offsetY != e.pos.offsetY {
+		e.pos.sy, e.pos.offsetY = sy, offsetY
+		e.redraw = true
+		e.redrawCursor = true
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTerminalTooSmall(t *testing.T) {
+	tests := []struct {
+		w, h     uint
+		expected bool
+	}{
+		{0, 0, true},
+		{1, 1, true},
+		{1, 100, true},
+		{100, 1, true},
+		{39, 8, true},
+		{40, 7, true},
+		{40, 8, false},
+		{80, 25, false},
+	}
+	for _, test := range tests {
+		if got := terminalTooSmall(test.w, test.h); got != test.expected {
+			t.Errorf("terminalTooSmall(%d, %d) = %v, expected %v", test.w, test.h, got, test.expected)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	tests := []struct {
+		x, low, high, expected int
+	}{
+		{5, 0, 10, 5},
+		{-5, 0, 10, 0},
+		{15, 0, 10, 10},
+		{3, 0, -1, 0},
+		{0, 0, 0, 0},
+	}
+	for _, test := range tests {
+		if got := clamp(test.x, test.low, test.high); got != test.expected {
+			t.Errorf("clamp(%d, %d, %d) = %d, expected %d", test.x, test.low, test.high, got, test.expected)
+		}
+	}
+}
+
+func TestCenteredX(t *testing.T) {
+	tests := []struct {
+		width, length int
+		expected      uint
+	}{
+		{80, 20, 30},
+		{80, 80, 0},
+		{10, 20, 0},
+		{1, 1, 0},
+		{1, 5, 0},
+		{0, 5, 0},
+	}
+	for _, test := range tests {
+		if got := centeredX(test.width, test.length); got != test.expected {
+			t.Errorf("centeredX(%d, %d) = %d, expected %d", test.width, test.length, got, test.expected)
+		}
+	}
+}
+
+func TestTooSmallMessage(t *testing.T) {
+	for _, width := range []int{0, 1, 2, 9, 10, 20, 39, 40, 80} {
+		msg := tooSmallMessage(width)
+		if n := utf8.RuneCountInString(msg); n > width {
+			t.Errorf("tooSmallMessage(%d) is %d runes long: %q", width, n, msg)
+		}
+		if width > 0 && msg == "" {
+			t.Errorf("tooSmallMessage(%d) is empty", width)
+		}
+	}
+	if got := tooSmallMessage(80); got != "terminal too small (need ≥ 40x8)" {
+		t.Errorf("got %q", got)
+	}
+	if got := fitString("abc", -1); got != "" {
+		t.Errorf("fitString with a negative width returned %q", got)
+	}
+}
+
+func TestClampWrapWidth(t *testing.T) {
+	tests := []struct {
+		wrapWidth, w, expected int
+	}{
+		{80, 120, 80},
+		{80, 60, 60},
+		{60, 100, 100},
+		{80, 1, 80},
+		{80, 0, 80},
+		{40, 1, 40},
+		{30, 1, 40},
+	}
+	for _, test := range tests {
+		if got := clampWrapWidth(test.wrapWidth, test.w); got != test.expected {
+			t.Errorf("clampWrapWidth(%d, %d) = %d, expected %d", test.wrapWidth, test.w, got, test.expected)
+		}
+	}
+}
+
+func TestClampScreenY(t *testing.T) {
+	tests := []struct {
+		sy, offsetY, rows          int
+		expectedSY, expectedOffset int
+	}{
+		{5, 0, 25, 5, 0},
+		{24, 10, 8, 7, 27},
+		{3, 0, 1, 0, 3},
+		{3, 0, 0, 0, 3},
+		{-1, 0, 25, 0, 0},
+	}
+	for _, test := range tests {
+		sy, offsetY := clampScreenY(test.sy, test.offsetY, test.rows)
+		if sy != test.expectedSY || offsetY != test.expectedOffset {
+			t.Errorf("clampScreenY(%d, %d, %d) = %d, %d, expected %d, %d", test.sy, test.offsetY, test.rows, sy, offsetY, test.expectedSY, test.expectedOffset)
+		}
+		// The line of the file that the cursor is at must stay the same
+		if test.sy >= 0 && sy+offsetY != test.sy+test.offsetY {
+			t.Errorf("clampScreenY(%d, %d, %d) moved the cursor to another line", test.sy, test.offsetY, test.rows)
+		}
+	}
+}
+
+func TestChopLineNarrow(t *testing.T) {
+	e := NewSimpleEditor(80)
+	for _, width := range []int{-5, 0} {
+		if got := e.ChopLine("hello", width); got != "" {
+			t.Errorf("ChopLine with width %d returned %q", width, got)
+		}
+	}
+	if got := e.ChopLine("hello", 1); got != "h" {
+		t.Errorf("ChopLine with width 1 returned %q", got)
+	}
+}
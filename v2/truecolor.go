@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/xyproto/env"
+	"github.com/xyproto/vt100"
+)
+
+// envTrueColor is true if the terminal emulator says it supports 24-bit colors, and colors are not disabled
+var envTrueColor = !envNoColor && (env.Str("COLORTERM") == "truecolor" || env.Str("COLORTERM") == "24bit")
+
+// trueColorNames are the names of the 24-bit colors that can be used for syntax highlighting, in the same way as
+// "lightblue" or "magenta", together with the 16-color fallback that is used if 24-bit colors are not supported
+var trueColorNames = map[string]vt100.AttributeColor{
+	"synthpink":     trueColor(255, 126, 219, vt100.Magenta),
+	"synthcyan":     trueColor(54, 249, 246, vt100.Cyan),
+	"synthblue":     trueColor(114, 180, 255, vt100.LightBlue),
+	"synthyellow":   trueColor(254, 222, 93, vt100.LightYellow),
+	"synthorange":   trueColor(255, 139, 57, vt100.LightGray),
+	"synthlavender": trueColor(132, 139, 189, vt100.Gray),
+	"synthwhite":    trueColor(241, 241, 255, vt100.White),
+	"vsblue":        trueColor(0, 0, 255, vt100.Blue),
+	"vsred":         trueColor(163, 21, 21, vt100.Red),
+	"vsgreen":       trueColor(0, 128, 0, vt100.Gray),
+	"vsteal":        trueColor(38, 127, 153, vt100.Blue),
+	"vsnumber":      trueColor(9, 134, 88, vt100.Cyan),
+}
+
+func init() {
+	// Make the 24-bit colors available as tags, like <synthpink>, for the syntax highlighting.
+	// Both maps must have the same keys, since the tag replacers are built from both.
+	for name, ac := range trueColorNames {
+		vt100.DarkColorMap[name] = ac
+		vt100.LightColorMap[name] = ac
+	}
+	tout.EnableColors()
+}
+
+// reservedTrueColorComponent checks if the given color component could be mistaken for a text attribute,
+// for a background color or for a part of the 24-bit color sequence itself, when the attributes are combined
+// with the background color or with plainAttributes before being drawn
+func reservedTrueColorComponent(v int) bool {
+	switch {
+	case v <= 9, v == 22, v == 24, v == 25, v == 27, v == 38:
+		return true
+	case v >= 40 && v <= 49, v >= 100 && v <= 107:
+		return true
+	}
+	return false
+}
+
+// trueColor returns a 24-bit foreground color, or the given fallback color if 24-bit colors are not supported.
+// The canvas combines the foreground and background attributes without repeating any number, so each
+// color component is changed by the smallest possible amount to be different from the others and from
+// any text attribute or background color.
+func trueColor(r, g, b byte, fallback vt100.AttributeColor) vt100.AttributeColor {
+	if !envTrueColor {
+		return fallback
+	}
+	ac := vt100.AttributeColor{38, 2}
+	for _, component := range []byte{r, g, b} {
+		ac = append(ac, nearestFreeComponent(int(component), ac[2:]))
+	}
+	return ac
+}
+
+// nearestFreeComponent returns the value closest to v that is not reserved and not already used
+func nearestFreeComponent(v int, used []byte) byte {
+	free := func(x int) bool {
+		if x < 0 || x > 255 || reservedTrueColorComponent(x) {
+			return false
+		}
+		for _, u := range used {
+			if int(u) == x {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= 255; d++ {
+		if free(v + d) {
+			return byte(v + d)
+		}
+		if free(v - d) {
+			return byte(v - d)
+		}
+	}
+	return byte(v)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestTrueColor(t *testing.T) {
+	previous := envTrueColor
+	t.Cleanup(func() { envTrueColor = previous })
+
+	envTrueColor = false
+	if got := trueColor(255, 126, 219, vt100.Magenta); got.String() != vt100.Magenta.String() {
+		t.Errorf("expected the fallback color without 24-bit color support, got %q", got.String())
+	}
+
+	envTrueColor = true
+	for _, rgb := range [][3]byte{{0, 0, 0}, {255, 255, 255}, {40, 40, 45}, {38, 2, 22}} {
+		ac := trueColor(rgb[0], rgb[1], rgb[2], vt100.Default)
+		if len(ac) != 5 || ac[0] != 38 || ac[1] != 2 {
+			t.Fatalf("expected a 24-bit color for %v, got %v", rgb, []byte(ac))
+		}
+		if hasTextAttributes(ac) {
+			t.Errorf("the color for %v looks like it has text attributes: %v", rgb, []byte(ac))
+		}
+		if bold := append(vt100.AttributeColor{1}, ac...); !hasTextAttributes(bold) {
+			t.Errorf("expected bold to be found in %v", []byte(bold))
+		}
+		// The canvas combines the colors without repeating any number, which must not drop any part of the color
+		for _, bg := range []vt100.AttributeColor{vt100.BackgroundDefault, vt100.BackgroundBlue, vt100.BackgroundWhite} {
+			if combined := withPlainAttributes(ac).Combine(bg); len(combined) != len(bg)+len(plainAttributes)+len(ac) {
+				t.Errorf("the color for %v was changed when combined with %v: %v", rgb, []byte(bg), []byte(combined))
+			}
+		}
+	}
+}
+
+func TestTrueColorTags(t *testing.T) {
+	cas := tout.Extract(tout.DarkTags("<synthpink>x</synthpink>"))
+	if len(cas) != 1 || cas[0].R != 'x' || cas[0].A.String() != trueColorNames["synthpink"].String() {
+		t.Errorf("expected the synthpink tag to be replaced with its color, got %v", cas)
+	}
+}
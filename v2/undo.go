@@ -11,12 +11,15 @@ import (
 type Undo struct {
 	mut                  *sync.RWMutex
 	editorCopies         []Editor
-	editorLineCopies     []map[int][]rune
+	editorLineCopies     [][][]rune
 	editorPositionCopies []Position
 	index                int
 	size                 int
 	maxMemoryUse         uint64 // can be <= 0 to not check for memory use
 	ignoreSnapshots      bool   // used when playing back macros
+	redoEditorCopies     []Editor
+	redoLineCopies       [][][]rune
+	redoPositionCopies   []Position
 }
 
 const (
@@ -27,22 +30,24 @@ const (
 	defaultUndoMemory = 0 // 32 * 1024 * 1024
 )
 
+var errNothingToRedo = errors.New("nothing to redo")
+
 var (
 	// Circular undo buffer with room for N actions, change false to true to check for too limit memory use
 	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
 
 	// Save the contents of one switch.
-	// Used when switching between a .c or .cpp file to the corresponding .h file.
+	// Used when switching between the nroff source and the man page preview.
 	switchBuffer = NewUndo(1, defaultUndoMemory)
 
-	// Save a copy of the undo stack when switching between files
+	// Save a copy of the undo stack when switching to the man page preview
 	switchUndoBackup = NewUndo(defaultUndoCount, defaultUndoMemory)
 )
 
 // NewUndo takes arguments that are only for initializing the undo buffers.
 // The *Position and *vt100.Canvas is used only as a default values for the elements in the undo buffers.
 func NewUndo(size int, maxMemoryUse uint64) *Undo {
-	return &Undo{&sync.RWMutex{}, make([]Editor, size), make([]map[int][]rune, size), make([]Position, size), 0, size, maxMemoryUse, false}
+	return &Undo{&sync.RWMutex{}, make([]Editor, size), make([][][]rune, size), make([]Position, size), 0, size, maxMemoryUse, false, nil, nil, nil}
 }
 
 // IgnoreSnapshots is used when playing back macros, to snapshot the macro playback as a whole instead
@@ -50,9 +55,10 @@ func (u *Undo) IgnoreSnapshots(b bool) {
 	u.ignoreSnapshots = b
 }
 
-func lineMapMemoryFootprint(m map[int][]rune) uint64 {
+// linesMemoryFootprint returns roughly how much memory the given lines use, in runes
+func linesMemoryFootprint(lines [][]rune) uint64 {
 	var sum uint64
-	for _, v := range m {
+	for _, v := range lines {
 		sum += uint64(cap(v))
 	}
 	return sum
@@ -63,7 +69,7 @@ func lineMapMemoryFootprint(m map[int][]rune) uint64 {
 func (u *Undo) MemoryFootprint() uint64 {
 	var sum uint64
 	for _, m := range u.editorLineCopies {
-		sum += lineMapMemoryFootprint(m)
+		sum += linesMemoryFootprint(m)
 	}
 	sum += uint64(unsafe.Sizeof(u.index))
 	sum += uint64(unsafe.Sizeof(u.size))
@@ -74,12 +80,24 @@ func (u *Undo) MemoryFootprint() uint64 {
 	return sum
 }
 
-// Snapshot will store a snapshot, and move to the next position in the circular buffer
+// Snapshot will store a snapshot, and move to the next position in the circular buffer.
+// A snapshot is taken right before a change, so the states that could be redone are forgotten.
 func (u *Undo) Snapshot(e *Editor) {
 	if u.ignoreSnapshots {
 		return
 	}
 
+	u.mut.Lock()
+	u.redoEditorCopies = nil
+	u.redoLineCopies = nil
+	u.redoPositionCopies = nil
+	u.mut.Unlock()
+
+	u.snapshot(e)
+}
+
+// snapshot will store a snapshot, and move to the next position in the circular buffer, without forgetting the redo states
+func (u *Undo) snapshot(e *Editor) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
@@ -139,6 +157,26 @@ func (u *Undo) Snapshot(e *Editor) {
 
 }
 
+// keepAcrossUndo copies the fields that are about the file on disk, the file lock and the editor settings,
+// rather than about the contents, from the current editor state to a snapshot that is about to be restored.
+// A file that has been released to another instance of the editor stays read-only, even if the change before
+// the release is undone, and a setting that was toggled from the menu stays toggled.
+func (e *Editor) keepAcrossUndo(snapshot *Editor) {
+	snapshot.diskState = e.diskState
+	snapshot.syntaxError = e.syntaxError
+	snapshot.readOnly = e.readOnly
+	snapshot.lockReleased = e.lockReleased
+	snapshot.keepCharacters = e.keepCharacters
+	snapshot.savePolicy = e.savePolicy
+	snapshot.redactSecrets = e.redactSecrets
+	snapshot.markMixedIndent = e.markMixedIndent
+	snapshot.showRuler = e.showRuler
+	snapshot.showCrosshair = e.showCrosshair
+	snapshot.wrapWidth = e.wrapWidth
+	snapshot.wrapWhenTyping = e.wrapWhenTyping
+	snapshot.rainbowParenthesis = e.rainbowParenthesis
+}
+
 // Restore will restore a previous snapshot, and move to the previous position in the circular buffer
 func (u *Undo) Restore(e *Editor) error {
 	u.mut.Lock()
@@ -154,15 +192,59 @@ func (u *Undo) Restore(e *Editor) error {
 	// Restore the state from this index, if there is something there
 	if lines := u.editorLineCopies[u.index]; len(lines) > 0 {
 
-		*e = u.editorCopies[u.index]
+		snapshot := u.editorCopies[u.index]
+		e.keepAcrossUndo(&snapshot)
+		*e = snapshot
 		e.lines = lines
 		e.pos = u.editorPositionCopies[u.index]
+		e.dirty.MarkAll()
 
 		return nil
 	}
 	return errors.New("no undo state at this index")
 }
 
+// Undo will restore the previous snapshot, like Restore, but the current state is kept so that it can be redone
+func (u *Undo) Undo(e *Editor) error {
+	current, currentLines, currentPosition := *e, e.CopyLines(), e.pos
+	if err := u.Restore(e); err != nil {
+		return err
+	}
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	u.redoEditorCopies = append(u.redoEditorCopies, current)
+	u.redoLineCopies = append(u.redoLineCopies, currentLines)
+	u.redoPositionCopies = append(u.redoPositionCopies, currentPosition)
+	return nil
+}
+
+// Redo will restore the state from before the last undo. The current state is stored as a snapshot,
+// so that the redo can be undone.
+func (u *Undo) Redo(e *Editor) error {
+	u.mut.Lock()
+	n := len(u.redoEditorCopies)
+	if n == 0 {
+		u.mut.Unlock()
+		return errNothingToRedo
+	}
+	editorCopy, lines, position := u.redoEditorCopies[n-1], u.redoLineCopies[n-1], u.redoPositionCopies[n-1]
+	u.redoEditorCopies = u.redoEditorCopies[:n-1]
+	u.redoLineCopies = u.redoLineCopies[:n-1]
+	u.redoPositionCopies = u.redoPositionCopies[:n-1]
+	u.mut.Unlock()
+
+	u.snapshot(e)
+
+	e.keepAcrossUndo(&editorCopy)
+	*e = editorCopy
+	e.lines = lines
+	e.pos = position
+	e.dirty.MarkAll()
+	return nil
+}
+
 // Index will return the current undo index, in the undo buffers
 func (u *Undo) Index() int {
 	return u.index
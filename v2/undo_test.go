@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+	u.Snapshot(e)
+	e.SetLine(0, "three")
+
+	if err := u.Undo(e); err != nil || e.Line(0) != "two" {
+		t.Fatalf("expected two after undo, got %q (%v)", e.Line(0), err)
+	}
+	if err := u.Undo(e); err != nil || e.Line(0) != "one" {
+		t.Fatalf("expected one after undo, got %q (%v)", e.Line(0), err)
+	}
+	if err := u.Redo(e); err != nil || e.Line(0) != "two" {
+		t.Fatalf("expected two after redo, got %q (%v)", e.Line(0), err)
+	}
+	if err := u.Redo(e); err != nil || e.Line(0) != "three" {
+		t.Fatalf("expected three after redo, got %q (%v)", e.Line(0), err)
+	}
+	if err := u.Redo(e); err != errNothingToRedo {
+		t.Errorf("expected nothing more to redo, got %v", err)
+	}
+
+	// A redo can be undone
+	if err := u.Undo(e); err != nil || e.Line(0) != "two" {
+		t.Fatalf("expected two after undoing the redo, got %q (%v)", e.Line(0), err)
+	}
+
+	// A new change after an undo forgets what could be redone
+	u.Snapshot(e)
+	e.SetLine(0, "four")
+	if err := u.Redo(e); err != errNothingToRedo || e.Line(0) != "four" {
+		t.Errorf("expected nothing to redo after a new change, got %q (%v)", e.Line(0), err)
+	}
+}
+
+func TestUndoKeepsReleasedLock(t *testing.T) {
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+
+	// The file is released to another instance of the editor, like when a takeover is accepted
+	e.readOnly, e.lockReleased = true, true
+	if err := u.Undo(e); err != nil || e.Line(0) != "one" {
+		t.Fatalf("expected one after undo, got %q (%v)", e.Line(0), err)
+	}
+	if !e.readOnly || !e.lockReleased {
+		t.Error("expected the file to still be released and read-only after undo")
+	}
+	if err := u.Redo(e); err != nil || !e.readOnly || !e.lockReleased {
+		t.Errorf("expected the file to still be released and read-only after redo (%v)", err)
+	}
+}
+
+func TestUndoKeepsSettings(t *testing.T) {
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+
+	// Settings are toggled from the menu after the last change
+	e.keepCharacters = !e.keepCharacters
+	e.showRuler = !e.showRuler
+	keepCharacters, showRuler := e.keepCharacters, e.showRuler
+	if err := u.Undo(e); err != nil || e.Line(0) != "one" {
+		t.Fatalf("expected one after undo, got %q (%v)", e.Line(0), err)
+	}
+	if e.keepCharacters != keepCharacters || e.showRuler != showRuler {
+		t.Error("expected the toggled settings to be kept after undo")
+	}
+	if err := u.Redo(e); err != nil || e.keepCharacters != keepCharacters || e.showRuler != showRuler {
+		t.Errorf("expected the toggled settings to be kept after redo (%v)", err)
+	}
+}
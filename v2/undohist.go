@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	undoHistoryVersion = 2
+
+	// maxUndoHistoryBytes is roughly how much undo history can be stored per file.
+	// The oldest snapshots are dropped first.
+	maxUndoHistoryBytes = 16 * 1024 * 1024
+)
+
+var (
+	undoHistoryDir           = filepath.Join(userCacheDir, "o", "undo")
+	errUndoHistoryStale      = errors.New("the file has changed since the undo history was saved")
+	errUndoHistoryMismatch   = errors.New("the undo history is for another file or version")
+	errUndoHistoryEmptyStack = errors.New("no undo history")
+)
+
+// undoHistoryPosition is the cursor position of one snapshot, with exported fields so that it can be encoded
+type undoHistoryPosition struct {
+	SX, SY, OffsetX, OffsetY int
+}
+
+// undoHistory is the undo history for one file, as it is stored in the cache directory
+type undoHistory struct {
+	Version     int
+	Filename    string     // the absolute filename
+	ContentHash []byte     // the SHA-256 hash of the file contents, when the undo history was saved
+	Lines       [][][]rune // the snapshots, the oldest first
+	Positions   []undoHistoryPosition
+}
+
+// undoHistoryFilename returns the filename of the stored undo history for the given absolute filename
+func undoHistoryFilename(absFilename string) string {
+	sum := sha256.Sum256([]byte(absFilename))
+	return filepath.Join(undoHistoryDir, hex.EncodeToString(sum[:])+".undo")
+}
+
+// fileContentHash returns the SHA-256 hash of the contents of the given file
+func fileContentHash(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// Snapshots returns the snapshots that can be undone to and their cursor positions, the oldest first
+func (u *Undo) Snapshots() ([][][]rune, []Position) {
+	lines, positions, _ := u.snapshots()
+	return lines, positions
+}
+
+// snapshots returns the snapshots that can be undone to, the oldest first, together with their cursor positions
+// and if the contents were changed since the file was last saved, at the time of each snapshot.
+// The snapshots are the ones before the current index, since the snapshot at the index is either the one that
+// was last undone to or the oldest one, which is overwritten by the next snapshot.
+func (u *Undo) snapshots() ([][][]rune, []Position, []bool) {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+	var (
+		lines     [][][]rune
+		positions []Position
+		changed   []bool
+	)
+	for i := 1; i < u.size; i++ {
+		j := (u.index - i + u.size) % u.size
+		if len(u.editorLineCopies[j]) == 0 {
+			break
+		}
+		lines = append([][][]rune{u.editorLineCopies[j]}, lines...)
+		positions = append([]Position{u.editorPositionCopies[j]}, positions...)
+		changed = append([]bool{u.editorCopies[j].changed}, changed...)
+	}
+	return lines, positions, changed
+}
+
+// SetSnapshots replaces the undo buffers with the given snapshots and cursor positions, the oldest first.
+// The rest of the editor state is taken from the given editor, and is marked as changed.
+// If there are more snapshots than there is room for, the oldest ones are dropped.
+func (u *Undo) SetSnapshots(e *Editor, lines [][][]rune, positions []Position) {
+	if len(lines) > u.size {
+		lines, positions = lines[len(lines)-u.size:], positions[len(positions)-u.size:]
+	}
+	editorCopy := *e
+	editorCopy.changed = true
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	for i := 0; i < u.size; i++ {
+		if i < len(lines) {
+			u.editorCopies[i] = editorCopy
+			u.editorLineCopies[i] = lines[i]
+			u.editorPositionCopies[i] = positions[i]
+		} else {
+			u.editorCopies[i] = Editor{}
+			u.editorLineCopies[i] = nil
+			u.editorPositionCopies[i] = Position{}
+		}
+	}
+	u.index = len(lines) % u.size
+	u.redoEditorCopies = nil
+	u.redoLineCopies = nil
+	u.redoPositionCopies = nil
+}
+
+// SaveUndoHistory stores the undo history for the given absolute filename in the cache directory,
+// together with a hash of the file contents, so that it can be restored when the file is opened again.
+// If the contents have been changed since the file was saved, only the snapshots from before the last saved
+// state are stored, since the undo history must match the file on disk when it is restored.
+// If there is no undo history, the stored undo history is removed.
+func (e *Editor) SaveUndoHistory(absFilename string, u *Undo) error {
+	if baseFilename := filepath.Base(absFilename); strings.HasPrefix(baseFilename, "tmp.") {
+		// Not storing undo history for /tmp/tmp.* files
+		return nil
+	}
+	historyFilename := undoHistoryFilename(absFilename)
+	lines, positions, changed := u.snapshots()
+	if e.changed {
+		// Leave out the last saved state and the unsaved changes after it
+		saved := 0
+		for i := len(changed) - 1; i >= 0; i-- {
+			if !changed[i] {
+				saved = i
+				break
+			}
+		}
+		lines, positions = lines[:saved], positions[:saved]
+	}
+	if len(lines) == 0 {
+		os.Remove(historyFilename)
+		return nil
+	}
+	contentHash, err := fileContentHash(absFilename)
+	if err != nil {
+		return err
+	}
+	// Drop the oldest snapshots if the undo history is too large
+	var size uint64
+	first := len(lines)
+	for first > 0 {
+		size += linesMemoryFootprint(lines[first-1]) * 4
+		if size > maxUndoHistoryBytes {
+			break
+		}
+		first--
+	}
+	if first == len(lines) {
+		os.Remove(historyFilename)
+		return nil
+	}
+	history := undoHistory{
+		Version:     undoHistoryVersion,
+		Filename:    absFilename,
+		ContentHash: contentHash,
+		Lines:       lines[first:],
+	}
+	for _, pos := range positions[first:] {
+		history.Positions = append(history.Positions, undoHistoryPosition{pos.sx, pos.sy, pos.offsetX, pos.offsetY})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(history); err != nil {
+		return err
+	}
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(undoHistoryDir, os.ModePerm)
+	return writeFileAtomic(historyFilename, buf.Bytes(), 0600)
+}
+
+// LoadUndoHistory restores the undo history for the given absolute filename from the cache directory.
+// An error is returned if there is no undo history, if it can not be read, or if the file has changed since
+// the undo history was saved. In that case, the undo buffers are left as they are.
+func (e *Editor) LoadUndoHistory(absFilename string, u *Undo) error {
+	f, err := os.Open(undoHistoryFilename(absFilename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var history undoHistory
+	if err := gob.NewDecoder(f).Decode(&history); err != nil {
+		return err
+	}
+	if history.Version != undoHistoryVersion || history.Filename != absFilename || len(history.Lines) != len(history.Positions) {
+		return errUndoHistoryMismatch
+	}
+	if len(history.Lines) == 0 {
+		return errUndoHistoryEmptyStack
+	}
+	contentHash, err := fileContentHash(absFilename)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(contentHash, history.ContentHash) {
+		return errUndoHistoryStale
+	}
+	positions := make([]Position, len(history.Positions))
+	for i, pos := range history.Positions {
+		positions[i] = Position{sx: pos.SX, sy: pos.SY, offsetX: pos.OffsetX, offsetY: pos.OffsetY, scrollSpeed: e.pos.scrollSpeed}
+	}
+	u.SetSnapshots(e, history.Lines, positions)
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoHistoryRoundTrip(t *testing.T) {
+	defer func(dir string) { undoHistoryDir = dir }(undoHistoryDir)
+	undoHistoryDir = t.TempDir()
+	filename := filepath.Join(t.TempDir(), "main.txt")
+	if err := os.WriteFile(filename, []byte("three\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+	u.Snapshot(e)
+	e.SetLine(0, "three")
+	// The file is saved
+	e.changed = false
+	if err := e.SaveUndoHistory(filename, u); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the file again, with an empty undo stack
+	u = NewUndo(10, 0)
+	e = NewSimpleEditor(80)
+	e.SetLine(0, "three")
+	if err := e.LoadUndoHistory(filename, u); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Undo(e); err != nil || e.Line(0) != "two" {
+		t.Fatalf("expected two after undo, got %q (%v)", e.Line(0), err)
+	}
+	if !e.changed {
+		t.Error("expected the contents to be marked as changed after undo")
+	}
+	if err := u.Undo(e); err != nil || e.Line(0) != "one" {
+		t.Fatalf("expected one after undo, got %q (%v)", e.Line(0), err)
+	}
+	if err := u.Redo(e); err != nil || e.Line(0) != "two" {
+		t.Fatalf("expected two after redo, got %q (%v)", e.Line(0), err)
+	}
+}
+
+func TestUndoHistoryStaleOrCorrupt(t *testing.T) {
+	defer func(dir string) { undoHistoryDir = dir }(undoHistoryDir)
+	undoHistoryDir = t.TempDir()
+	filename := filepath.Join(t.TempDir(), "main.txt")
+	if err := os.WriteFile(filename, []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+	e.changed = false
+	if err := e.SaveUndoHistory(filename, u); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is changed outside of the editor
+	if err := os.WriteFile(filename, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u = NewUndo(10, 0)
+	if err := e.LoadUndoHistory(filename, u); err != errUndoHistoryStale {
+		t.Errorf("expected the undo history to be stale, got %v", err)
+	}
+	if lines, _ := u.Snapshots(); len(lines) != 0 {
+		t.Errorf("expected the undo stack to be left empty, got %d snapshots", len(lines))
+	}
+
+	// The undo history file is corrupt
+	if err := os.WriteFile(undoHistoryFilename(filename), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadUndoHistory(filename, u); err == nil {
+		t.Error("expected an error when loading a corrupt undo history")
+	}
+
+	// Without any undo history, the stored undo history is removed
+	if err := e.SaveUndoHistory(filename, NewUndo(10, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(undoHistoryFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("expected the undo history file to be removed, got %v", err)
+	}
+}
+
+func TestUndoHistoryUnsaved(t *testing.T) {
+	defer func(dir string) { undoHistoryDir = dir }(undoHistoryDir)
+	undoHistoryDir = t.TempDir()
+	filename := filepath.Join(t.TempDir(), "main.txt")
+	if err := os.WriteFile(filename, []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUndo(10, 0)
+	e := NewSimpleEditor(80)
+	e.SetLine(0, "one")
+	u.Snapshot(e)
+	e.SetLine(0, "two")
+	// The file is saved, and then changed and undone, without being saved again
+	e.changed = false
+	u.Snapshot(e)
+	e.SetLine(0, "three")
+	u.Snapshot(e)
+	e.SetLine(0, "four")
+	if err := u.Undo(e); err != nil || e.Line(0) != "three" {
+		t.Fatalf("expected three after undo, got %q (%v)", e.Line(0), err)
+	}
+	if lines, _ := u.Snapshots(); len(lines) != 2 || string(lines[0][0]) != "one" || string(lines[1][0]) != "two" {
+		t.Errorf("expected the snapshots that can be undone to, the oldest first, got %q", lines)
+	}
+	if err := e.SaveUndoHistory(filename, u); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the snapshots from before the saved state are stored
+	u = NewUndo(10, 0)
+	e = NewSimpleEditor(80)
+	e.SetLine(0, "two")
+	if err := e.LoadUndoHistory(filename, u); err != nil {
+		t.Fatal(err)
+	}
+	if lines, _ := u.Snapshots(); len(lines) != 1 || string(lines[0][0]) != "one" {
+		t.Errorf("expected only the snapshot from before the saved state, got %q", lines)
+	}
+}
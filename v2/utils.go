@@ -24,6 +24,12 @@ func exists(path string) bool {
 	return err == nil
 }
 
+// isDir checks if the given path exists and is a directory
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
 // which tries to find the given executable name in the $PATH
 // Returns an empty string if not found.
 func which(executable string) string {
@@ -418,3 +424,94 @@ func lastEntryIsNot(xs []string, x string) bool {
 	}
 	return xs[l-1] != x
 }
+
+// writeFileAtomic writes data to a temporary file in the same directory as the given filename,
+// then renames it to the given filename, so that the file is never left half-written.
+// The permissions of an existing file are kept, otherwise perm is used.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicWithPermissions(filename, data, filePermissions(filename, perm))
+}
+
+// saveFile writes the file when the editor saves. It can be replaced when testing.
+var saveFile = writeFileAtomicWithPermissions
+
+// writeFileAtomicWithPermissions is like writeFileAtomic, but the file always gets the given permissions.
+// If the filename is a symbolic link, the file it points to is replaced instead of the link.
+// The owner and the extended attributes of an existing file are kept. If that is not possible,
+// or if the directory is not writable, the file is written in place instead.
+// If the data was written, but the permissions could not be set, a *keepAttributesError is returned.
+func writeFileAtomicWithPermissions(filename string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil { // no error
+		filename = resolved
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		if !os.IsPermission(err) {
+			return err
+		}
+		return writeFileInPlace(filename, data, perm)
+	}
+	tempFilename := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tempFilename)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tempFilename)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFilename)
+		return err
+	}
+	if err := copyFileAttributes(filename, tempFilename); err != nil {
+		// Replacing the file would change its owner or lose some of its attributes
+		os.Remove(tempFilename)
+		return writeFileInPlace(filename, data, perm)
+	}
+	if err := os.Chmod(tempFilename, perm); err != nil {
+		os.Remove(tempFilename)
+		return err
+	}
+	if err := os.Rename(tempFilename, filename); err != nil {
+		os.Remove(tempFilename)
+		return err
+	}
+	return nil
+}
+
+// writeFileInPlace overwrites the contents of the given file, which keeps its owner and attributes,
+// and then sets the given permissions, if they are different.
+// If the data was written, but the permissions could not be set, a *keepAttributesError is returned.
+func writeFileInPlace(filename string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(filename, data, perm); err != nil {
+		return err
+	}
+	return chmodIfNeeded(filename, perm)
+}
+
+// filePermissions returns the permissions of the given file, including the setuid, setgid and sticky bits,
+// or the given default if the file does not exist
+func filePermissions(filename string, defaultPerm os.FileMode) os.FileMode {
+	if fi, err := os.Stat(filename); err == nil { // no error
+		return permissionBits(fi.Mode())
+	}
+	return defaultPerm
+}
+
+// permissionBits returns the permissions of the given file mode, including the setuid, setgid and sticky bits
+func permissionBits(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// withExecutableBits returns the given permissions, where everyone that can read can also execute, like chmod +x
+func withExecutableBits(perm os.FileMode) os.FileMode {
+	return perm | (perm&0444)>>2
+}
+
+// withoutExecutableBits returns the given permissions, where no one can execute, like chmod -x
+func withoutExecutableBits(perm os.FileMode) os.FileMode {
+	return perm &^ 0111
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	viewStateVersion       = 1
+	viewStateHeader        = "o view state"
+	maxViewStateEntries    = 1024
+	viewStateRulerFlag     = "ruler"
+	viewStateCrosshairFlag = "crosshair"
+	viewStateWrapFlag      = "wrap"
+	viewStateWrapTypeFlag  = "wraptyping"
+)
+
+var (
+	viewStates            map[string]ViewState // per filename view state, like if the column ruler is shown
+	viewStateFilename     = filepath.Join(userCacheDir, "o", "viewstate.txt")
+	errViewStateVersion   = errors.New("unsupported view state version")
+	errViewStateNoHeader  = errors.New("missing view state header")
+	errNoViewStateToReset = errors.New("no view state to reset for this file")
+)
+
+// ViewState is the per-file state of the view toggles, that is restored when a file is opened again
+type ViewState struct {
+	wrapWidth      int  // word wrap width, 0 if disabled
+	ruler          bool // show the column ruler
+	crosshair      bool // show the cursor crosshair
+	wrapWhenTyping bool // wrap when typing
+}
+
+// ViewState returns the current view state
+func (e *Editor) ViewState() ViewState {
+	return ViewState{
+		wrapWidth:      e.wrapWidth,
+		ruler:          e.showRuler,
+		crosshair:      e.showCrosshair,
+		wrapWhenTyping: e.wrapWhenTyping,
+	}
+}
+
+// SetViewState restores the given view state
+func (e *Editor) SetViewState(vs ViewState) {
+	e.wrapWidth = vs.wrapWidth
+	e.showRuler = vs.ruler
+	e.showCrosshair = vs.crosshair
+	e.wrapWhenTyping = vs.wrapWhenTyping
+	e.redraw = true
+}
+
+// DefaultViewState returns the view state that a newly opened file would have
+func (e *Editor) DefaultViewState() ViewState {
+	wrapWidth, wrapWhenTyping := defaultWrap(e.mode, e.syntaxHighlight)
+	return ViewState{wrapWidth: wrapWidth, wrapWhenTyping: wrapWhenTyping}
+}
+
+// viewStateFile is where the view states are stored, one line per filename
+var viewStateFile = keyedFile{header: viewStateHeader, version: viewStateVersion, errNoHeader: errViewStateNoHeader, errVersion: errViewStateVersion}
+
+// viewStateEntries returns the fields that each view state is stored as, per filename
+func viewStateEntries(viewStates map[string]ViewState) map[string][]string {
+	entries := make(map[string][]string, len(viewStates))
+	for filename, vs := range viewStates {
+		var fields []string
+		if vs.ruler {
+			fields = append(fields, viewStateRulerFlag)
+		}
+		if vs.crosshair {
+			fields = append(fields, viewStateCrosshairFlag)
+		}
+		if vs.wrapWhenTyping {
+			fields = append(fields, viewStateWrapTypeFlag)
+		}
+		entries[filename] = append(fields, viewStateWrapFlag+"="+strconv.Itoa(vs.wrapWidth))
+	}
+	return entries
+}
+
+// viewStatesFromEntries returns the view state per filename, from the stored fields. Unknown fields are skipped.
+func viewStatesFromEntries(entries map[string][]string) map[string]ViewState {
+	viewStates := make(map[string]ViewState, len(entries))
+	for filename, fields := range entries {
+		var vs ViewState
+		for _, field := range fields {
+			switch {
+			case field == viewStateRulerFlag:
+				vs.ruler = true
+			case field == viewStateCrosshairFlag:
+				vs.crosshair = true
+			case field == viewStateWrapTypeFlag:
+				vs.wrapWhenTyping = true
+			case strings.HasPrefix(field, viewStateWrapFlag+"="):
+				if n, err := strconv.Atoi(strings.TrimPrefix(field, viewStateWrapFlag+"=")); err == nil && n >= 0 {
+					vs.wrapWidth = n
+				}
+			}
+		}
+		viewStates[filename] = vs
+	}
+	return viewStates
+}
+
+// formatViewStates returns the given view states in the keyed file format, sorted by filename
+func formatViewStates(viewStates map[string]ViewState) string {
+	return viewStateFile.format(viewStateEntries(viewStates))
+}
+
+// parseViewStates parses view states in the format written by formatViewStates
+func parseViewStates(data string) (map[string]ViewState, error) {
+	entries, err := viewStateFile.parse(data)
+	return viewStatesFromEntries(entries), err
+}
+
+// LoadViewStates loads the per-absolute-filename view states. The returned map can be empty.
+func LoadViewStates(viewStateFilename string) (map[string]ViewState, error) {
+	entries, err := viewStateFile.load(viewStateFilename)
+	return viewStatesFromEntries(entries), err
+}
+
+// SaveViewStates saves the per-absolute-filename view states
+func SaveViewStates(viewStates map[string]ViewState, viewStateFilename string) error {
+	return viewStateFile.save(viewStateFilename, viewStateEntries(viewStates))
+}
+
+// SaveViewState stores the current view state for the given filename, if it differs from the default view state.
+// Files that have the default view state are removed from the view states.
+func (e *Editor) SaveViewState(absFilename string, viewStates map[string]ViewState) error {
+	if viewStates == nil {
+		return nil
+	}
+	vs := e.ViewState()
+	_, found := viewStates[absFilename]
+	if vs == e.DefaultViewState() {
+		if !found {
+			// Nothing to save or remove
+			return nil
+		}
+		delete(viewStates, absFilename)
+	} else {
+		if !found && len(viewStates) >= maxViewStateEntries {
+			// Cull the view states
+			for k := range viewStates {
+				delete(viewStates, k)
+			}
+		}
+		viewStates[absFilename] = vs
+	}
+	return SaveViewStates(viewStates, viewStateFilename)
+}
+
+// ResetViewState restores the default view state for the current file and removes the stored view state
+func (e *Editor) ResetViewState() error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	vs := e.ViewState()
+	e.SetViewState(e.DefaultViewState())
+	if _, found := viewStates[absFilename]; !found && vs == e.DefaultViewState() {
+		return errNoViewStateToReset
+	}
+	return e.SaveViewState(absFilename, viewStates)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestViewStateRoundTrip(t *testing.T) {
+	viewStates := map[string]ViewState{
+		"/tmp/a b.txt":     {ruler: true, wrapWidth: 79},
+		"/tmp/\"quoted\"":  {crosshair: true, wrapWhenTyping: true, wrapWidth: 72},
+		"/home/x/main.go":  {},
+		"/home/x/data.dat": {ruler: true, crosshair: true},
+	}
+	filename := filepath.Join(t.TempDir(), "viewstate.txt")
+	if err := SaveViewStates(viewStates, filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadViewStates(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(viewStates) {
+		t.Fatalf("expected %d view states, got %d", len(viewStates), len(loaded))
+	}
+	for k, v := range viewStates {
+		if loaded[k] != v {
+			t.Errorf("%s: expected %+v, got %+v", k, v, loaded[k])
+		}
+	}
+}
+
+func TestViewStateVersion(t *testing.T) {
+	if _, err := parseViewStates("o view state 999\n\"/tmp/a\" ruler wrap=0\n"); err != errViewStateVersion {
+		t.Errorf("expected a version error, got %v", err)
+	}
+	if _, err := parseViewStates("\"/tmp/a\": 12\n"); err != errViewStateNoHeader {
+		t.Errorf("expected a header error, got %v", err)
+	}
+}
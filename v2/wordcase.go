@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/vt100"
+)
+
+var errNoWordAtCursor = errors.New("no word at the cursor")
+
+// wordBounds returns the start and end rune indexes of the word that the given index is in,
+// where the end is not included. The given function decides which runes words are made of.
+func wordBounds(runes []rune, x int, wordRune func(rune) bool) (int, int, bool) {
+	if x < 0 || x >= len(runes) || !wordRune(runes[x]) {
+		return 0, 0, false
+	}
+	start, end := x, x+1
+	for start > 0 && wordRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && wordRune(runes[end]) {
+		end++
+	}
+	return start, end, true
+}
+
+// nextWordCase returns the given word in the next case, cycling from lowercase to UPPERCASE to Title case,
+// and back to lowercase. Each rune is converted on its own, so the number of runes stays the same.
+func nextWordCase(word []rune) []rune {
+	lower := make([]rune, len(word))
+	upper := make([]rune, len(word))
+	title := make([]rune, len(word))
+	seenLetter := false
+	for i, r := range word {
+		lower[i], upper[i], title[i] = unicode.ToLower(r), unicode.ToUpper(r), unicode.ToLower(r)
+		if unicode.IsLetter(r) && !seenLetter {
+			title[i] = unicode.ToTitle(r)
+			seenLetter = true
+		}
+	}
+	switch string(word) {
+	case string(lower):
+		return upper
+	case string(upper):
+		if string(title) != string(word) {
+			return title
+		}
+	}
+	return lower
+}
+
+// CycleWordCase changes the case of the word at the cursor, from lowercase to UPPERCASE to Title case,
+// and back to lowercase. Mixed case words become lowercase. The cursor stays at the same rune in the word.
+// Returns the changed word.
+func (e *Editor) CycleWordCase() (string, error) {
+	runes, x := e.cursorRunes()
+	start, end, ok := wordBounds(runes, x, isWordAtCursorRune)
+	if !ok {
+		return "", errNoWordAtCursor
+	}
+	word := nextWordCase(runes[start:end])
+	e.SetCurrentLine(string(runes[:start]) + string(word) + string(runes[end:]))
+	e.redrawCursor = true
+	return string(word), nil
+}
+
+var errNotCamelOrSnakeCase = errors.New("the word at the cursor is neither camelCase nor snake_case")
+
+// camelToSnakeCase converts a camelCase or PascalCase identifier to snake_case. A run of capital letters, like an
+// acronym, is kept together, so "HTTPServer" becomes "http_server" and "userID" becomes "user_id".
+func camelToSnakeCase(word []rune) []rune {
+	var snake []rune
+	for i, r := range word {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := word[i-1]
+			nextIsLower := i+1 < len(word) && unicode.IsLower(word[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				snake = append(snake, '_')
+			}
+		}
+		snake = append(snake, unicode.ToLower(r))
+	}
+	return snake
+}
+
+// snakeToCamelCase converts a snake_case or SCREAMING_SNAKE_CASE identifier to camelCase. Leading and trailing
+// underscores are kept, and the identifier starts with a capital letter if it did so and was not all capitals.
+func snakeToCamelCase(word []rune) []rune {
+	s := string(word)
+	trimmed := []rune(strings.Trim(s, "_"))
+	if len(trimmed) == 0 {
+		return word
+	}
+	prefix := s[:strings.Index(s, string(trimmed))]
+	suffix := s[len(prefix)+len(string(trimmed)):]
+	keepCapital := unicode.IsUpper(trimmed[0]) && strings.ToUpper(string(trimmed)) != string(trimmed)
+	camel := []rune(prefix)
+	for i, part := range strings.Split(string(trimmed), "_") {
+		partRunes := []rune(strings.ToLower(part))
+		if len(partRunes) == 0 {
+			continue
+		}
+		if i > 0 || keepCapital {
+			partRunes[0] = unicode.ToUpper(partRunes[0])
+		}
+		camel = append(camel, partRunes...)
+	}
+	return append(camel, []rune(suffix)...)
+}
+
+// ToggleIdentifierCase converts the identifier at the cursor from camelCase or PascalCase to snake_case,
+// or from snake_case to camelCase, depending on which of them it is. The identifier is made of letters, digits and
+// underscores, so only one part of a selector expression like os.ReadFile is converted. The cursor is placed at the
+// start of the identifier.
+func (e *Editor) ToggleIdentifierCase(c *vt100.Canvas) (string, error) {
+	runes, x := e.cursorRunes()
+	start, end, ok := wordBounds(runes, x, isWordRune)
+	if !ok {
+		return "", errNoWordAtCursor
+	}
+	word := runes[start:end]
+	var converted []rune
+	if strings.Contains(strings.Trim(string(word), "_"), "_") {
+		converted = snakeToCamelCase(word)
+	} else {
+		converted = camelToSnakeCase(word)
+	}
+	if string(converted) == string(word) {
+		return "", errNotCamelOrSnakeCase
+	}
+	e.SetCurrentLine(string(runes[:start]) + string(converted) + string(runes[end:]))
+	e.GoToDataX(c, start)
+	return string(converted), nil
+}
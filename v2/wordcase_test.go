@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCycleWordCase(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("(ærlig.navn)\n"))
+	e.pos.sx = 3
+	var got []string
+	for i := 0; i < 4; i++ {
+		if _, err := e.CycleWordCase(); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Line(0))
+	}
+	expected := []string{"(ÆRLIG.NAVN)", "(Ærlig.navn)", "(ærlig.navn)", "(ÆRLIG.NAVN)"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("press %d: expected %q, got %q", i+1, expected[i], got[i])
+		}
+	}
+	if x, _ := e.DataX(); x != 3 {
+		t.Errorf("expected the cursor to stay at rune 3, got %d", x)
+	}
+	e.pos.sx = 0
+	if _, err := e.CycleWordCase(); err != errNoWordAtCursor {
+		t.Errorf("expected no word at the parenthesis, got %v", err)
+	}
+	if s := string(nextWordCase([]rune("fooBar"))); s != "foobar" {
+		t.Errorf("expected a mixed case word to become lowercase, got %q", s)
+	}
+}
+
+func TestIdentifierCase(t *testing.T) {
+	for camel, snake := range map[string]string{
+		"HTTPServer":      "http_server",
+		"getHTTPResponse": "get_http_response",
+		"userID":          "user_id",
+		"parseV2Config":   "parse_v2_config",
+	} {
+		if got := string(camelToSnakeCase([]rune(camel))); got != snake {
+			t.Errorf("%s should become %s, got %s", camel, snake, got)
+		}
+	}
+	for snake, camel := range map[string]string{
+		"http_server": "httpServer",
+		"MAX_VALUE":   "maxValue",
+		"_private_id": "_privateId",
+		"Foo_bar":     "FooBar",
+	} {
+		if got := string(snakeToCamelCase([]rune(snake))); got != camel {
+			t.Errorf("%s should become %s, got %s", snake, camel, got)
+		}
+	}
+
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("x := newHTTPServer()\n"))
+	e.pos.sx = 9
+	if word, err := e.ToggleIdentifierCase(nil); err != nil || word != "new_http_server" {
+		t.Fatalf("unexpected conversion: %q, %v", word, err)
+	}
+	if word, err := e.ToggleIdentifierCase(nil); err != nil || word != "newHttpServer" || e.Line(0) != "x := newHttpServer()" {
+		t.Errorf("unexpected conversion back: %q, %v, %q", word, err, e.Line(0))
+	}
+	e.pos.sx = 0
+	if _, err := e.ToggleIdentifierCase(nil); err != errNotCamelOrSnakeCase {
+		t.Errorf("expected a single letter to not be converted, got %v", err)
+	}
+
+	// Only the identifier at the cursor in a selector expression is converted
+	e.LoadBytes([]byte("my_obj.someMethod()\n"))
+	e.pos.sx = 2
+	if word, err := e.ToggleIdentifierCase(nil); err != nil || word != "myObj" || e.Line(0) != "myObj.someMethod()" {
+		t.Errorf("expected only the receiver to be converted, got %q, %v, %q", word, err, e.Line(0))
+	}
+	e.pos.sx = 8
+	if word, err := e.ToggleIdentifierCase(nil); err != nil || word != "some_method" || e.Line(0) != "myObj.some_method()" {
+		t.Errorf("expected only the method to be converted, got %q, %v, %q", word, err, e.Line(0))
+	}
+	if x, _ := e.DataX(); x != 6 {
+		t.Errorf("expected the cursor to be at the start of the method, got %d", x)
+	}
+}
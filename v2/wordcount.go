@@ -0,0 +1,255 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+)
+
+var (
+	// linkDefinition matches a Markdown link reference definition, like "[1]: https://example.com"
+	linkDefinition = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*\S`)
+
+	// listMarker matches the start of a list item, like "- " or "1. "
+	listMarker = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+)
+
+// wordCountCache is the word count for a generation of the editor contents
+type wordCountCache struct {
+	generation uint64
+	valid      bool
+	words      int
+	proseWords int
+}
+
+// WordCount returns the number of whitespace-separated words
+func (e *Editor) WordCount() int {
+	words, _ := e.WordCounts()
+	return words
+}
+
+// WordCounts returns the number of whitespace-separated words, and for Markdown and text,
+// the number of words when markup and code are not counted. The counts are only calculated
+// again after the contents have been changed.
+func (e *Editor) WordCounts() (int, int) {
+	generation := e.dirty.Generation()
+	if e.dirty != nil && e.wordCount.valid && e.wordCount.generation == generation { // the contents are unchanged
+		return e.wordCount.words, e.wordCount.proseWords
+	}
+	text := e.String()
+	words, proseWords := len(strings.Fields(text)), 0
+	if e.proseMode() {
+		proseWords = proseWordCount(text)
+	}
+	e.wordCount = wordCountCache{generation, true, words, proseWords}
+	return words, proseWords
+}
+
+// proseMode checks if this mode is for prose, where words are counted without markup
+// and joined lines are separated by exactly one space
+func (e *Editor) proseMode() bool {
+	return e.mode == mode.Markdown || e.mode == mode.Text
+}
+
+// proseWordCount counts the words in Markdown or plain text, as they would be read.
+// YAML front matter, fenced code blocks, inline code, HTML tags and comments, images, link URLs and
+// link definitions are skipped, while the text of links is counted. List markers, and tokens without any
+// letters or digits, like heading markers and table borders, are not counted either, and neither are bare URLs.
+func proseWordCount(text string) int {
+	var (
+		sb    strings.Builder
+		lines = strings.Split(text, "\n")
+		fence string // the fence that started the current code block, like "```"
+	)
+	// Skip YAML front matter
+	if len(lines) > 0 && strings.TrimRight(lines[0], " \t") == "---" {
+		for i := 1; i < len(lines); i++ {
+			if end := strings.TrimRight(lines[i], " \t"); end == "---" || end == "..." {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+	// Skip fenced code blocks and link definitions
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if f := codeFence(trimmed); f != "" && len(line)-len(strings.TrimLeft(line, " ")) < 4 {
+			fence = f
+			continue
+		}
+		if linkDefinition.MatchString(line) {
+			continue
+		}
+		sb.WriteString(listMarker.ReplaceAllString(line, ""))
+		sb.WriteByte('\n')
+	}
+	count := 0
+	for _, word := range strings.Fields(stripInlineMarkup(removeHTMLComments(sb.String()))) {
+		if strings.Contains(word, "://") || strings.IndexFunc(word, isLetterOrDigit) == -1 {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// isLetterOrDigit checks if the given rune is a letter or a digit
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// codeFence returns the backticks or tildes that start a fenced code block, like "```", or "" if there are none
+func codeFence(trimmedLine string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(trimmedLine) - len(strings.TrimLeft(trimmedLine, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+// removeHTMLComments removes all <!-- --> comments, which may span several lines
+func removeHTMLComments(s string) string {
+	for {
+		start := strings.Index(s, "<!--")
+		if start == -1 {
+			return s
+		}
+		end := strings.Index(s[start+4:], "-->")
+		if end == -1 {
+			return s[:start]
+		}
+		s = s[:start] + " " + s[start+4+end+3:]
+	}
+}
+
+// stripInlineMarkup removes inline code, HTML tags, images and link URLs from Markdown,
+// while keeping the text of links, which may also contain markup
+func stripInlineMarkup(s string) string {
+	var (
+		sb    strings.Builder
+		runes = []rune(s)
+	)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '`':
+			// Inline code ends with the same number of backticks as it started with, on the same line
+			n := runLength(runes, i, '`')
+			end := -1
+			for j := i + n; j < len(runes) && runes[j] != '\n' && end == -1; {
+				switch m := runLength(runes, j, '`'); m {
+				case n:
+					end = j + m - 1
+				case 0:
+					j++
+				default:
+					j += m
+				}
+			}
+			if end == -1 {
+				// Just backticks
+				i += n - 1
+				continue
+			}
+			i = end
+			sb.WriteRune(' ')
+		case r == '<':
+			// HTML tags and autolinks, like <br> or <https://example.com>
+			end := indexRune(runes, '>', i+1)
+			if end == -1 || i+1 >= len(runes) || !(unicode.IsLetter(runes[i+1]) || runes[i+1] == '/') {
+				sb.WriteRune(r)
+				continue
+			}
+			i = end
+			sb.WriteRune(' ')
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '[':
+			// Images are skipped, including the alt text
+			if textEnd, end := linkEnd(runes, i+1); end != -1 && textEnd != -1 {
+				i = end
+				sb.WriteRune(' ')
+				continue
+			}
+			sb.WriteRune(r)
+		case r == '[':
+			// Only the text of links is kept
+			textEnd, end := linkEnd(runes, i)
+			if textEnd == -1 {
+				sb.WriteRune(' ')
+				continue
+			}
+			sb.WriteString(" " + stripInlineMarkup(string(runes[i+1:textEnd])) + " ")
+			if end != -1 {
+				i = end
+			} else {
+				i = textEnd
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// runLength returns how many times r is repeated in runes, starting at the given index
+func runLength(runes []rune, start int, r rune) int {
+	n := 0
+	for start+n < len(runes) && runes[start+n] == r {
+		n++
+	}
+	return n
+}
+
+// indexRune returns the index of the first r in runes, starting at the given index, or -1
+func indexRune(runes []rune, r rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// linkEnd finds the end of a Markdown link that starts with "[" at the given index. Returns the index of
+// the "]" that ends the link text, and the index of the ")" or "]" that ends the URL or reference, if any.
+// Brackets and parentheses may be nested.
+func linkEnd(runes []rune, start int) (int, int) {
+	textEnd := matchingBracket(runes, start, '[', ']')
+	if textEnd == -1 || textEnd+1 >= len(runes) {
+		return textEnd, -1
+	}
+	switch runes[textEnd+1] {
+	case '(':
+		return textEnd, matchingBracket(runes, textEnd+1, '(', ')')
+	case '[':
+		return textEnd, matchingBracket(runes, textEnd+1, '[', ']')
+	}
+	return textEnd, -1
+}
+
+// matchingBracket returns the index of the bracket that closes the one at the given index, or -1
+func matchingBracket(runes []rune, start int, open, closing rune) int {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestProseWordCount(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"one two three", 3},
+		{"# A heading\n\n## Another one", 4},
+		{"- one\n- two\n* three\n1. four", 4},
+		{"Use `go build ./...` to build", 3},
+		{"Use ``a `nested` span`` here", 2},
+		{"See [the docs](https://example.com/docs?a=(b)) now", 4},
+		{"See [**bold `code` link**](https://example.com)", 3},
+		{"A [reference link][1] here\n\n[1]: https://example.com", 4},
+		{"An ![image of a cat](cat.png) here", 2},
+		{"Go to https://example.com or <https://example.com>", 3},
+		{"---\ntitle: Hello world\ntags: [a, b]\n---\nJust this", 2},
+		{"Before\n\n```go\nfunc main() {\n}\n```\n\nafter", 2},
+		{"Before\n\n~~~~\n```\nnot a fence end\n~~~~\nafter", 2},
+		{"    ```\nindented code\n    ```", 2},
+		{"| a | b |\n|---|---|\n| c | d |", 4},
+		{"Some <b>bold</b> text<!-- a\nlong comment -->!", 3},
+		{"**Emphasis** and _more_ --- and > quotes", 5},
+		{"2 + 2 = 4", 3},
+	}
+	for _, test := range tests {
+		if n := proseWordCount(test.text); n != test.expected {
+			t.Errorf("%q: expected %d words, got %d", test.text, test.expected, n)
+		}
+	}
+}
+
+func TestWordCounts(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Markdown
+	e.LoadBytes([]byte("# Title\n\nSee [this](https://example.com).\n"))
+	if words, prose := e.WordCounts(); words != 4 || prose != 3 {
+		t.Errorf("expected 4 words and 3 prose words, got %d and %d", words, prose)
+	}
+	if !strings.Contains(e.StatusMessage(), "words 4 (prose 3)") {
+		t.Errorf("expected both counts in the status message, got %q", e.StatusMessage())
+	}
+
+	// The counts are cached until the contents are changed
+	e.lines[0] = []rune("# Changed without telling anyone")
+	if words, _ := e.WordCounts(); words != 4 {
+		t.Errorf("expected the cached count, got %d", words)
+	}
+	e.SetLine(0, "# Title and more")
+	if words, prose := e.WordCounts(); words != 6 || prose != 5 {
+		t.Errorf("expected the count to be updated after a change, got %d and %d", words, prose)
+	}
+
+	// Only the raw count is shown for code
+	e.mode = mode.Go
+	if strings.Contains(e.StatusMessage(), "prose") {
+		t.Error("did not expect a prose word count for Go code")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/xyproto/vt100"
+)
+
+// wordRuneClass returns 0 for spaces and tabs, 1 for runes that can be part of a word, like for WordAtCursor,
+// and 2 for punctuation and other runes, so that a run of punctuation is skipped as if it was one word
+func wordRuneClass(r rune) int {
+	switch {
+	case r == ' ' || r == '\t':
+		return 0
+	case isWordAtCursorRune(r) || unicode.Is(unicode.Mn, r):
+		return 1
+	}
+	return 2
+}
+
+// nextWordIndex returns the index of the start of the next word after index x in the given runes,
+// or the length of the runes if there are no more words
+func nextWordIndex(runes []rune, x int) int {
+	if x >= len(runes) {
+		return len(runes)
+	}
+	if class := wordRuneClass(runes[x]); class != 0 {
+		for x < len(runes) && wordRuneClass(runes[x]) == class {
+			x++
+		}
+	}
+	for x < len(runes) && wordRuneClass(runes[x]) == 0 {
+		x++
+	}
+	return x
+}
+
+// prevWordIndex returns the index of the start of the word before index x in the given runes, or 0
+func prevWordIndex(runes []rune, x int) int {
+	if x > len(runes) {
+		x = len(runes)
+	}
+	for x > 0 && wordRuneClass(runes[x-1]) == 0 {
+		x--
+	}
+	if x == 0 {
+		return 0
+	}
+	class := wordRuneClass(runes[x-1])
+	for x > 0 && wordRuneClass(runes[x-1]) == class {
+		x--
+	}
+	return x
+}
+
+// cursorRunes returns the runes of the current line and the rune index of the cursor,
+// which is the length of the line if the cursor is after the end of the line
+func (e *Editor) cursorRunes() ([]rune, int) {
+	runes, _ := e.lineRunes(int(e.DataY()))
+	x, err := e.DataX()
+	if err != nil || x > len(runes) {
+		x = len(runes)
+	}
+	return runes, x
+}
+
+// NextWord moves the cursor to the start of the next word, or to the end of the line if there are no more words.
+// At the end of the line, the cursor moves to the first word on the next line.
+func (e *Editor) NextWord(c *vt100.Canvas, status *StatusBar) {
+	runes, x := e.cursorRunes()
+	if x < len(runes) {
+		e.GoToDataX(c, nextWordIndex(runes, x))
+		return
+	}
+	if int(e.DataY())+1 >= e.Len() {
+		return
+	}
+	e.GoTo(e.DataY()+1, c, status)
+	runes, _ = e.lineRunes(int(e.DataY()))
+	x = 0
+	for x < len(runes) && wordRuneClass(runes[x]) == 0 {
+		x++
+	}
+	e.GoToDataX(c, x)
+}
+
+// PrevWord moves the cursor to the start of the previous word, or to the start of the line.
+// At the start of the line, the cursor moves to the end of the previous line.
+func (e *Editor) PrevWord(c *vt100.Canvas, status *StatusBar) {
+	runes, x := e.cursorRunes()
+	if x > 0 {
+		e.GoToDataX(c, prevWordIndex(runes, x))
+		return
+	}
+	if e.DataY() == 0 {
+		return
+	}
+	e.GoTo(e.DataY()-1, c, status)
+	runes, _ = e.lineRunes(int(e.DataY()))
+	e.GoToDataX(c, len(runes))
+}
+
+// DeleteWordBeforeCursor deletes the word before the cursor, together with the spaces between the word
+// and the cursor. Returns false if the cursor is at the start of the line.
+func (e *Editor) DeleteWordBeforeCursor(c *vt100.Canvas) bool {
+	runes, x := e.cursorRunes()
+	if x == 0 {
+		return false
+	}
+	start := prevWordIndex(runes, x)
+	e.SetCurrentLine(string(runes[:start]) + string(runes[x:]))
+	e.GoToDataX(c, start)
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWordIndex(t *testing.T) {
+	runes := []rune("\tfoo.bar := baz(1, 2) // done")
+	var starts []int
+	for x := 0; x < len(runes); {
+		x = nextWordIndex(runes, x)
+		starts = append(starts, x)
+	}
+	if !equalInts(starts, []int{1, 9, 12, 15, 16, 17, 19, 20, 22, 25, 29}) {
+		t.Errorf("unexpected word starts: %v", starts)
+	}
+	var back []int
+	for x := len(runes); x > 0; {
+		x = prevWordIndex(runes, x)
+		back = append(back, x)
+	}
+	if !equalInts(back, []int{25, 22, 20, 19, 17, 16, 15, 12, 9, 1, 0}) {
+		t.Errorf("unexpected word starts backwards: %v", back)
+	}
+}
+
+func TestWordMovement(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("one two\n\tthree\n"))
+	e.NextWord(nil, nil)
+	if x, _ := e.DataX(); x != 4 {
+		t.Fatalf("expected to be at the second word, got %d", x)
+	}
+	e.NextWord(nil, nil)
+	e.NextWord(nil, nil)
+	if x, _ := e.DataX(); e.DataY() != 1 || x != 1 {
+		t.Fatalf("expected to wrap to the first word on the next line, got %d,%d", x, e.DataY())
+	}
+	e.PrevWord(nil, nil)
+	e.PrevWord(nil, nil)
+	if x, err := e.DataX(); e.DataY() != 0 || err == nil {
+		t.Fatalf("expected to wrap to the end of the previous line, got %d,%d", x, e.DataY())
+	}
+	if !e.DeleteWordBeforeCursor(nil) || e.Line(0) != "one " {
+		t.Errorf("unexpected line after deleting a word: %q", e.Line(0))
+	}
+	e.Home()
+	if e.DeleteWordBeforeCursor(nil) {
+		t.Error("expected nothing to delete at the start of the line")
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// copyXattrs copies the extended attributes, like SELinux labels and ACLs, from one file to another
+func copyXattrs(from, to string) error {
+	size, err := syscall.Listxattr(from, nil)
+	if err == syscall.ENOTSUP || size == 0 {
+		// Extended attributes are not supported by the file system, or there are none
+		return nil
+	} else if err != nil {
+		return err
+	}
+	names := make([]byte, size)
+	if size, err = syscall.Listxattr(from, names); err != nil {
+		return err
+	}
+	for _, name := range bytes.Split(bytes.TrimRight(names[:size], "\x00"), []byte{0}) {
+		value, err := getXattr(from, string(name))
+		if err != nil {
+			return err
+		}
+		if current, err := getXattr(to, string(name)); err == nil && bytes.Equal(current, value) {
+			// The new file already got the same attribute, like a SELinux label for the directory
+			continue
+		}
+		if err := syscall.Setxattr(to, string(name), value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getXattr returns the value of the given extended attribute of a file
+func getXattr(filename, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(filename, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = syscall.Getxattr(filename, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
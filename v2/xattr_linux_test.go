@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSaveKeepsXattrs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "labeled.txt")
+	if err := os.WriteFile(filename, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(filename, "user.o.test", []byte("kept"), 0); err != nil {
+		t.Skip("extended attributes are not supported here:", err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	e.LoadBytes([]byte("new\n"))
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := getXattr(filename, "user.o.test"); err != nil || string(value) != "kept" {
+		t.Errorf("expected the extended attribute to be kept, got %q", value)
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != "new\n" {
+		t.Errorf("expected the file to be saved, got %q", data)
+	}
+}
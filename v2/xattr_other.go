@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// copyXattrs does nothing on platforms where extended attributes are not handled
+func copyXattrs(from, to string) error {
+	return nil
+}